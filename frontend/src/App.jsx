@@ -5,6 +5,7 @@ import RequestList from './components/RequestList'
 import ResponseDisplay from './components/ResponseDisplay'
 import EnvironmentSelector from './components/EnvironmentSelector'
 import CollectionEnvironmentEditor from './components/CollectionEnvironmentEditor'
+import { apiFetch } from './api'
 
 function App() {
   const [selectedRequest, setSelectedRequest] = useState(null)
@@ -30,7 +31,7 @@ function App() {
       return
     }
     try {
-      const res = await fetch(`/api/collection-environments/${encodeURIComponent(collection)}`)
+      const res = await apiFetch(`/api/collection-environments/${encodeURIComponent(collection)}`)
       if (res.ok) {
         const data = await res.json()
         setCollectionEnvs(data)
@@ -42,13 +43,13 @@ function App() {
 
   const loadInitialData = async () => {
     try {
-      const envResponse = await fetch('/api/environments')
+      const envResponse = await apiFetch('/api/environments')
       if (envResponse.ok) {
         const envData = await envResponse.json()
         setEnvironments(envData)
       }
 
-      const reqResponse = await fetch('/api/requests')
+      const reqResponse = await apiFetch('/api/requests')
       if (reqResponse.ok) {
         const reqData = await reqResponse.json()
         setRequests(reqData)
@@ -59,7 +60,7 @@ function App() {
   }
 
   const handleCreateEnvironment = async (name, source) => {
-    const res = await fetch('/api/environments', {
+    const res = await apiFetch('/api/environments', {
       method: 'POST',
       headers: { 'Content-Type': 'application/json' },
       body: JSON.stringify({ name, source: source || undefined }),
@@ -94,7 +95,7 @@ function App() {
     const formData = new FormData()
     formData.append('spec', file)
     if (collection) formData.append('collection', collection)
-    const res = await fetch('/api/openapi-preview', { method: 'POST', body: formData })
+    const res = await apiFetch('/api/openapi-preview', { method: 'POST', body: formData })
     if (!res.ok) {
       const message = await res.text()
       throw new Error(message.trim() || 'Preview failed')
@@ -112,7 +113,7 @@ function App() {
     if (overwrite) formData.append('overwrite', 'true')
 
     try {
-      const res = await fetch('/api/import-openapi', {
+      const res = await apiFetch('/api/import-openapi', {
         method: 'POST',
         body: formData,
       })
@@ -134,7 +135,7 @@ function App() {
       }
 
       const result = await res.json()
-      const reqResponse = await fetch('/api/requests')
+      const reqResponse = await apiFetch('/api/requests')
       if (reqResponse.ok) {
         const reqData = await reqResponse.json()
         setRequests(reqData)
@@ -162,7 +163,7 @@ function App() {
     setImportStatus({ type: 'loading', message: `Exporting ${collection}...` })
 
     try {
-      const res = await fetch(`/api/export-collection/${encodeURIComponent(collection)}`)
+      const res = await apiFetch(`/api/export-collection/${encodeURIComponent(collection)}`)
       if (!res.ok) {
         const message = await res.text()
         throw new Error(message.trim() || 'Export failed')
@@ -189,7 +190,7 @@ function App() {
   const handleSaveCollectionEnvs = async (updatedEnvs) => {
     if (!activeCollection) return
     try {
-      const res = await fetch(`/api/collection-environments/${encodeURIComponent(activeCollection)}`, {
+      const res = await apiFetch(`/api/collection-environments/${encodeURIComponent(activeCollection)}`, {
         method: 'PUT',
         headers: { 'Content-Type': 'application/json' },
         body: JSON.stringify(updatedEnvs),
@@ -207,17 +208,23 @@ function App() {
     setLastCurlRequest('')
     setLastExecutedRequest(null)
     try {
-      const res = await fetch('/api/execute', {
+      const execute = (confirmed) => apiFetch('/api/execute', {
         method: 'POST',
         headers: { 'Content-Type': 'application/json' },
         body: JSON.stringify({
           request: requestData,
           environment: selectedEnv,
           collection: activeCollection || '',
+          confirmed,
         }),
-      })
+      }).then(res => res.json())
 
-      const result = await res.json()
+      let result = await execute(false)
+      if (result.confirm) {
+        result = window.confirm(result.message)
+          ? await execute(true)
+          : { error: true, message: 'Not sent' }
+      }
       setResponse(result)
       setLastCurlRequest(result.curl || '')
       setLastExecutedRequest(result.request || null)
@@ -0,0 +1,26 @@
+// apiFetch is fetch for the api-man server: it sends the CSRF token the
+// server requires on every request that changes something.
+let tokenPromise = null
+
+const csrfToken = () => {
+  if (!tokenPromise) {
+    tokenPromise = fetch('/api/session')
+      .then(res => res.json())
+      .then(data => data.token)
+      .catch(error => {
+        tokenPromise = null
+        throw error
+      })
+  }
+  return tokenPromise
+}
+
+export async function apiFetch(url, options = {}) {
+  const method = (options.method || 'GET').toUpperCase()
+  if (method === 'GET' || method === 'HEAD') {
+    return fetch(url, options)
+  }
+  const headers = new Headers(options.headers)
+  headers.set('X-CSRF-Token', await csrfToken())
+  return fetch(url, { ...options, headers })
+}
@@ -1,6 +1,7 @@
 import { useState, useEffect, useRef } from 'react'
+import { apiFetch } from '../api'
 
-const HTTP_METHODS = ['GET', 'POST', 'PUT', 'DELETE', 'PATCH', 'HEAD', 'OPTIONS']
+const HTTP_METHODS = ['GET', 'POST', 'PUT', 'DELETE', 'PATCH', 'HEAD', 'OPTIONS', 'TRACE']
 const BODY_NAME_PATTERN = /^[a-z0-9._-]+$/
 const HEADER_PRESETS = [
   { label: 'Bearer auth', key: 'Authorization', value: 'Bearer ' },
@@ -75,7 +76,7 @@ function RequestBuilder({ request, onExecute, isLoading, curlRequest, executedRe
 
   const loadBodyTemplates = async (requestPath) => {
     try {
-      const res = await fetch(`/api/request-bodies/${requestPath}`)
+      const res = await apiFetch(`/api/request-bodies/${requestPath}`)
       if (!res.ok) return
       const data = await res.json()
       applyBodyList(data)
@@ -189,6 +190,7 @@ function RequestBuilder({ request, onExecute, isLoading, curlRequest, executedRe
 
   const handleExecute = () => {
     const requestData = {
+      path: request?.path,
       method,
       url,
       headers: headers.reduce((acc, header) => {
@@ -250,7 +252,7 @@ function RequestBuilder({ request, onExecute, isLoading, curlRequest, executedRe
 
     if (!request?.path) return
     try {
-      const res = await fetch(`/api/request-bodies/${request.path}`, {
+      const res = await apiFetch(`/api/request-bodies/${request.path}`, {
         method: 'PATCH',
         headers: { 'Content-Type': 'application/json' },
         body: JSON.stringify({ active: name }),
@@ -267,7 +269,7 @@ function RequestBuilder({ request, onExecute, isLoading, curlRequest, executedRe
   const persistBodyContent = async (name, content) => {
     if (!request?.path) return
     try {
-      const res = await fetch(
+      const res = await apiFetch(
         `/api/request-bodies/${request.path}?body=${encodeURIComponent(name)}`,
         {
           method: 'PUT',
@@ -329,7 +331,7 @@ function RequestBuilder({ request, onExecute, isLoading, curlRequest, executedRe
     }
 
     try {
-      const res = await fetch(`/api/request-bodies/${request.path}`, {
+      const res = await apiFetch(`/api/request-bodies/${request.path}`, {
         method: 'POST',
         headers: { 'Content-Type': 'application/json' },
         body: JSON.stringify({ name: trimmed, source: activeBodyName }),
@@ -340,7 +342,7 @@ function RequestBuilder({ request, onExecute, isLoading, curlRequest, executedRe
       }
       const data = await res.json()
       // Set active server-side, then apply.
-      await fetch(`/api/request-bodies/${request.path}`, {
+      await apiFetch(`/api/request-bodies/${request.path}`, {
         method: 'PATCH',
         headers: { 'Content-Type': 'application/json' },
         body: JSON.stringify({ active: trimmed }),
@@ -378,7 +380,7 @@ function RequestBuilder({ request, onExecute, isLoading, curlRequest, executedRe
     if (!window.confirm(`Delete body "${activeBodyName}"?`)) return
 
     try {
-      const res = await fetch(
+      const res = await apiFetch(
         `/api/request-bodies/${request.path}?body=${encodeURIComponent(activeBodyName)}`,
         { method: 'DELETE' }
       )
@@ -423,7 +425,7 @@ function RequestBuilder({ request, onExecute, isLoading, curlRequest, executedRe
           className="method-select"
           disabled={isLoading}
         >
-          {HTTP_METHODS.map(m => (
+          {(HTTP_METHODS.includes(method) ? HTTP_METHODS : [...HTTP_METHODS, method]).map(m => (
             <option key={m} value={m}>{m}</option>
           ))}
         </select>
@@ -1,4 +1,5 @@
 import { useState, useEffect } from 'react'
+import { apiFetch } from '../api'
 
 function RequestList({ requests, onRequestSelect, selectedRequest, onImportOpenAPI, onPreviewOpenAPI, onExportCollection, onClearImportStatus, importStatus }) {
   const [expandedFolders, setExpandedFolders] = useState(new Set())
@@ -90,7 +91,7 @@ function RequestList({ requests, onRequestSelect, selectedRequest, onImportOpenA
   }
 
   const getMethodFromRequestName = (name) => {
-    const method = ['OPTIONS', 'DELETE', 'PATCH', 'POST', 'HEAD', 'PUT', 'GET']
+    const method = ['OPTIONS', 'DELETE', 'PATCH', 'TRACE', 'POST', 'HEAD', 'PUT', 'GET']
       .find(candidate => name.toUpperCase().startsWith(candidate))
     return method || 'GET'
   }
@@ -360,7 +361,7 @@ function RequestList({ requests, onRequestSelect, selectedRequest, onImportOpenA
                     
                     const handleRequestClick = async () => {
                       try {
-                        const response = await fetch(`/api/request/${encodeURIComponent(actualPath)}`)
+                        const response = await apiFetch(`/api/request/${encodeURIComponent(actualPath)}`)
                         if (response.ok) {
                           const requestDetails = await response.json()
                           onRequestSelect({
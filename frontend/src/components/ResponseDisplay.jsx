@@ -22,14 +22,17 @@ function ResponseDisplay({ response, isLoading }) {
     }
   }
 
-  const getResponseSize = (body) => {
-    if (!body) return '0 B'
-    const bytes = new Blob([body]).size
+  const formatBytes = (bytes) => {
     if (bytes < 1024) return `${bytes} B`
     if (bytes < 1024 * 1024) return `${(bytes / 1024).toFixed(1)} KB`
     return `${(bytes / (1024 * 1024)).toFixed(1)} MB`
   }
 
+  const getResponseSize = (body) => {
+    if (!body) return '0 B'
+    return formatBytes(new Blob([body]).size)
+  }
+
   if (isLoading) {
     return (
       <div className="response-display" aria-busy="true">
@@ -110,6 +113,11 @@ function ResponseDisplay({ response, isLoading }) {
           <span className="response-time">
             {getResponseSize(response.body)}
           </span>
+          {response.encoding && (
+            <span className="response-time" title="Size received before decoding">
+              {response.encoding} {formatBytes(response.encodedSize || 0)}
+            </span>
+          )}
         </div>
       </div>
 
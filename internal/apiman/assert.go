@@ -0,0 +1,256 @@
+// assert.go
+package apiman
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Assertions describes the checks applied to an ExecutionResult. Every
+// field is optional; unset fields are not evaluated.
+type Assertions struct {
+	// Status is the exact expected status code.
+	Status int `json:"status,omitempty" yaml:"status,omitempty"`
+	// Headers maps header names to their exact expected value.
+	Headers map[string]string `json:"headers,omitempty" yaml:"headers,omitempty"`
+	// BodyContains lists substrings that must all appear in the body.
+	BodyContains []string `json:"bodyContains,omitempty" yaml:"bodyContains,omitempty"`
+	// JSONPath checks values inside a JSON response body.
+	JSONPath []JSONPathAssertion `json:"jsonPath,omitempty" yaml:"jsonPath,omitempty"`
+	// MaxLatencyMS fails the check when the round trip took longer.
+	MaxLatencyMS int64 `json:"maxLatencyMs,omitempty" yaml:"maxLatencyMs,omitempty"`
+	// Expect lists JavaScript expressions that must be truthy, e.g.
+	// "response.status == 200 && body.items.length > 0" (see scriptScope).
+	Expect []string `json:"expect,omitempty" yaml:"expect,omitempty"`
+	// Caching checks Cache-Control, Vary, Age and ETag headers.
+	Caching *CachingAssertions `json:"caching,omitempty" yaml:"caching,omitempty"`
+}
+
+// JSONPathAssertion checks the value found at Path (see EvalJSONPath), or
+// produced by the jq expression Query instead (see EvalQuery). Exactly one
+// of Equals, Exists, Contains or Matches is normally set; when none is, the
+// path only has to resolve.
+type JSONPathAssertion struct {
+	Path     string      `json:"path,omitempty" yaml:"path,omitempty"`
+	Query    string      `json:"query,omitempty" yaml:"query,omitempty"`
+	Equals   interface{} `json:"equals,omitempty" yaml:"equals,omitempty"`
+	Exists   *bool       `json:"exists,omitempty" yaml:"exists,omitempty"`
+	Contains string      `json:"contains,omitempty" yaml:"contains,omitempty"`
+	Matches  string      `json:"matches,omitempty" yaml:"matches,omitempty"`
+}
+
+// UnmarshalJSON keeps a number in equals as a json.Number, so that it is
+// compared with the response exactly however large it is. Unknown fields
+// are errors, as they would be in a strict decode of the whole file.
+func (jp *JSONPathAssertion) UnmarshalJSON(data []byte) error {
+	type plain JSONPathAssertion
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	dec.DisallowUnknownFields()
+	return dec.Decode((*plain)(jp))
+}
+
+// AssertionResult is the outcome of a single check.
+type AssertionResult struct {
+	Name    string `json:"name"`
+	Passed  bool   `json:"passed"`
+	Message string `json:"message,omitempty"`
+}
+
+// IsEmpty reports whether no checks are configured.
+func (a *Assertions) IsEmpty() bool {
+	return a == nil || (a.Status == 0 && len(a.Headers) == 0 && len(a.BodyContains) == 0 && len(a.JSONPath) == 0 && a.MaxLatencyMS == 0 && len(a.Expect) == 0 && a.Caching == nil)
+}
+
+// Evaluate runs every configured check against result in a stable order.
+func (a *Assertions) Evaluate(result *ExecutionResult) []AssertionResult {
+	if a == nil {
+		return nil
+	}
+	var results []AssertionResult
+
+	if a.Status != 0 {
+		results = append(results, check(
+			fmt.Sprintf("status == %d", a.Status),
+			result.StatusCode == a.Status,
+			"got %d", result.StatusCode,
+		))
+	}
+
+	headerNames := make([]string, 0, len(a.Headers))
+	for name := range a.Headers {
+		headerNames = append(headerNames, name)
+	}
+	sort.Strings(headerNames)
+	for _, name := range headerNames {
+		want := a.Headers[name]
+		got := result.Headers.Get(http.CanonicalHeaderKey(name))
+		results = append(results, check(
+			fmt.Sprintf("header %s == %q", name, want),
+			got == want,
+			"got %q", got,
+		))
+	}
+
+	for _, needle := range a.BodyContains {
+		results = append(results, check(
+			fmt.Sprintf("body contains %q", needle),
+			strings.Contains(string(result.Body), needle),
+			"not found in %d byte body", len(result.Body),
+		))
+	}
+
+	if len(a.JSONPath) > 0 {
+		doc, bodyErr := decodeJSON(result.Body)
+		for _, jp := range a.JSONPath {
+			if bodyErr != nil {
+				results = append(results, AssertionResult{Name: jp.describe(), Message: "response body is not JSON"})
+				continue
+			}
+			results = append(results, jp.evaluate(doc))
+		}
+	}
+
+	if a.MaxLatencyMS > 0 {
+		results = append(results, check(
+			fmt.Sprintf("latency <= %dms", a.MaxLatencyMS),
+			result.DurationMS() <= a.MaxLatencyMS,
+			"took %dms", result.DurationMS(),
+		))
+	}
+
+	if len(a.Expect) > 0 {
+		scope := responseScope(result)
+		for _, expression := range a.Expect {
+			value, err := evalScript(expression, scope)
+			if err != nil {
+				results = append(results, AssertionResult{Name: expression, Message: err.Error()})
+				continue
+			}
+			results = append(results, check(expression, value.ToBoolean(), "was %s", value))
+		}
+	}
+
+	if a.Caching != nil {
+		results = append(results, a.Caching.evaluate(result)...)
+	}
+
+	return results
+}
+
+func (jp JSONPathAssertion) describe() string {
+	subject := jp.Path
+	if jp.Query != "" {
+		subject = "query " + jp.Query
+	}
+	switch {
+	case jp.Exists != nil && !*jp.Exists:
+		return fmt.Sprintf("%s does not exist", subject)
+	case jp.Exists != nil:
+		return fmt.Sprintf("%s exists", subject)
+	case jp.Contains != "":
+		return fmt.Sprintf("%s contains %q", subject, jp.Contains)
+	case jp.Matches != "":
+		return fmt.Sprintf("%s matches /%s/", subject, jp.Matches)
+	case jp.Equals != nil:
+		want, _ := json.Marshal(normalizeYAMLValue(jp.Equals))
+		return fmt.Sprintf("%s == %s", subject, want)
+	}
+	return fmt.Sprintf("%s resolves", subject)
+}
+
+func (jp JSONPathAssertion) evaluate(doc interface{}) AssertionResult {
+	name := jp.describe()
+	var value interface{}
+	var err error
+	var found bool
+	if jp.Query != "" {
+		value, err = querySingle(doc, jp.Query)
+		found = err == nil
+	} else {
+		value, err = EvalJSONPath(doc, jp.Path)
+		found = err == nil
+		// Wildcards and recursive descent always resolve, possibly to nothing.
+		if list, ok := value.([]interface{}); ok && found && (strings.Contains(jp.Path, "*") || strings.Contains(jp.Path, "..")) {
+			found = len(list) > 0
+		}
+	}
+
+	if jp.Exists != nil {
+		// A query yielding null doesn't exist, as with a missing key in jq.
+		found = found && (jp.Query == "" || value != nil)
+		if *jp.Exists {
+			return check(name, found, "no match")
+		}
+		return check(name, !found, "found %s", jsonValueString(value))
+	}
+	if !found {
+		msg := "no match"
+		if err != nil {
+			msg = err.Error()
+		}
+		return AssertionResult{Name: name, Message: msg}
+	}
+
+	switch {
+	case jp.Contains != "":
+		return check(name, strings.Contains(jsonValueString(value), jp.Contains), "got %s", jsonValueString(value))
+	case jp.Matches != "":
+		re, err := regexp.Compile(jp.Matches)
+		if err != nil {
+			return AssertionResult{Name: name, Message: fmt.Sprintf("invalid pattern: %v", err)}
+		}
+		return check(name, re.MatchString(jsonValueString(value)), "got %s", jsonValueString(value))
+	case jp.Equals != nil:
+		got, _ := json.Marshal(value)
+		return check(name, jsonValuesEqual(normalizeYAMLValue(jp.Equals), value), "got %s", string(got))
+	}
+	return check(name, true, "")
+}
+
+// normalizeYAMLValue converts map[interface{}]interface{} produced by some
+// YAML decoders into JSON-compatible maps so values compare like JSON.
+func normalizeYAMLValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, val := range t {
+			m[fmt.Sprint(k)] = normalizeYAMLValue(val)
+		}
+		return m
+	case map[string]interface{}:
+		for k, val := range t {
+			t[k] = normalizeYAMLValue(val)
+		}
+		return t
+	case []interface{}:
+		for i, val := range t {
+			t[i] = normalizeYAMLValue(val)
+		}
+		return t
+	}
+	return v
+}
+
+func check(name string, passed bool, format string, args ...interface{}) AssertionResult {
+	r := AssertionResult{Name: name, Passed: passed}
+	if !passed {
+		r.Message = fmt.Sprintf(format, args...)
+	}
+	return r
+}
+
+// assertionsPassed reports whether every result passed.
+func assertionsPassed(results []AssertionResult) bool {
+	for _, r := range results {
+		if !r.Passed {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,596 @@
+// asyncapi.go
+package apiman
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// api-man generate also reads AsyncAPI 2.x and 3.0 documents. Each channel
+// served over ws:// or wss:// becomes a WebSocket request whose body is the
+// first message the client sends, the others becoming body templates. On
+// http(s):// servers, a channel the client receives from becomes a streamed
+// Server-Sent Events request and one it sends to a POST. Other protocols
+// (Kafka, MQTT, AMQP...) are skipped with a warning.
+
+// AsyncAPISpec is an AsyncAPI document with its local $refs inlined.
+type AsyncAPISpec struct {
+	AsyncAPI string `json:"asyncapi"`
+	Info     struct {
+		Title string `json:"title"`
+	} `json:"info"`
+	Servers  map[string]asyncAPIServer  `json:"servers"`
+	Channels map[string]asyncAPIChannel `json:"channels"`
+	// Operations are 3.0's; 2.x keeps them in the channels.
+	Operations map[string]asyncAPIOperation `json:"operations"`
+
+	// warnings holds what parsing couldn't make sense of.
+	warnings []string
+}
+
+type asyncAPIServer struct {
+	// URL is 2.x's; 3.0 splits it into Host and Pathname.
+	URL       string `json:"url"`
+	Host      string `json:"host"`
+	Pathname  string `json:"pathname"`
+	Protocol  string `json:"protocol"`
+	Variables map[string]struct {
+		Default string `json:"default"`
+	} `json:"variables"`
+}
+
+type asyncAPIChannel struct {
+	// Address is 3.0's; a 2.x channel's address is its key. A null address
+	// is only known at runtime.
+	Address     *string  `json:"address"`
+	Description string   `json:"description"`
+	Servers     []string `json:"servers"`
+	Parameters  map[string]struct {
+		Description string          `json:"description"`
+		Default     interface{}     `json:"default"`
+		Enum        []interface{}   `json:"enum"`
+		Examples    []interface{}   `json:"examples"`
+		Schema      json.RawMessage `json:"schema"`
+	} `json:"parameters"`
+	Publish   *asyncAPIOperation          `json:"publish"`
+	Subscribe *asyncAPIOperation          `json:"subscribe"`
+	Messages  map[string]*asyncAPIMessage `json:"messages"`
+}
+
+type asyncAPIOperation struct {
+	// Action and Channel are 3.0's: Channel is the name of the channel
+	// and Messages the names of its messages the operation uses.
+	Action      string `json:"action"`
+	Channel     string `json:"channel"`
+	OperationID string `json:"operationId"`
+	Summary     string `json:"summary"`
+	Description string `json:"description"`
+	// Message is 2.x's, a message or a oneOf of messages.
+	Message  *asyncAPIMessage `json:"message"`
+	Messages []string         `json:"messages"`
+}
+
+type asyncAPIMessage struct {
+	Name        string          `json:"name"`
+	Title       string          `json:"title"`
+	ContentType string          `json:"contentType"`
+	Payload     json.RawMessage `json:"payload"`
+	Examples    []struct {
+		Name    string      `json:"name"`
+		Payload interface{} `json:"payload"`
+	} `json:"examples"`
+	OneOf []*asyncAPIMessage `json:"oneOf"`
+}
+
+// isAsyncAPI reports whether data is an AsyncAPI document.
+func isAsyncAPI(data []byte) bool {
+	converted, err := yamlToJSON(data)
+	if err != nil {
+		return false
+	}
+	var probe struct {
+		AsyncAPI interface{} `json:"asyncapi"`
+	}
+	return json.Unmarshal(converted, &probe) == nil && probe.AsyncAPI != nil
+}
+
+// ParseAsyncAPISpec parses a YAML or JSON AsyncAPI 2.x or 3.0 document.
+// References to other files aren't followed.
+func ParseAsyncAPISpec(data []byte) (*AsyncAPISpec, error) {
+	converted, err := yamlToJSON(data)
+	if err != nil {
+		return nil, fmt.Errorf("parsing AsyncAPI spec: %w", err)
+	}
+	var root map[string]interface{}
+	if err := json.Unmarshal(converted, &root); err != nil {
+		return nil, fmt.Errorf("parsing AsyncAPI spec: %w", err)
+	}
+	version, _ := root["asyncapi"].(string)
+	if !strings.HasPrefix(version, "2.") && !strings.HasPrefix(version, "3.") {
+		return nil, fmt.Errorf("AsyncAPI %v isn't supported; use 2.x or 3.0", root["asyncapi"])
+	}
+
+	// 3.0 links channels to servers and operations to channels and
+	// messages by $ref; they are kept as names rather than inlined.
+	channels, _ := root["channels"].(map[string]interface{})
+	for _, channel := range channels {
+		if channel, ok := channel.(map[string]interface{}); ok {
+			channel["servers"] = refNames(channel["servers"])
+		}
+	}
+	operations, _ := root["operations"].(map[string]interface{})
+	for _, operation := range operations {
+		if operation, ok := operation.(map[string]interface{}); ok {
+			if names := refNames([]interface{}{operation["channel"]}); len(names) == 1 {
+				operation["channel"] = names[0]
+			}
+			operation["messages"] = refNames(operation["messages"])
+		}
+	}
+
+	resolver := &asyncAPIRefResolver{root: root, resolving: map[string]bool{}}
+	resolved := resolver.resolve(root)
+	data, err = json.Marshal(resolved)
+	if err != nil {
+		return nil, err
+	}
+	spec := &AsyncAPISpec{}
+	if err := json.Unmarshal(data, spec); err != nil {
+		return nil, fmt.Errorf("parsing AsyncAPI spec: %w", err)
+	}
+	if resolver.external > 0 {
+		spec.warnings = append(spec.warnings, fmt.Sprintf("%d $ref(s) to other files weren't followed", resolver.external))
+	}
+	return spec, nil
+}
+
+// refNames returns the last segment of each $ref in list, and the strings
+// in it as they are.
+func refNames(list interface{}) []string {
+	items, _ := list.([]interface{})
+	names := []string{}
+	for _, item := range items {
+		switch item := item.(type) {
+		case string:
+			names = append(names, item)
+		case map[string]interface{}:
+			if ref, ok := item["$ref"].(string); ok {
+				names = append(names, unescapeJSONPointer(ref[strings.LastIndex(ref, "/")+1:]))
+			}
+		}
+	}
+	return names
+}
+
+// asyncAPIRefResolver inlines the $refs within a document. A $ref to
+// another file is left as it is, and so is one met again while it is being
+// resolved, which a recursive schema would otherwise expand forever.
+type asyncAPIRefResolver struct {
+	root      map[string]interface{}
+	resolving map[string]bool
+	external  int
+}
+
+func (r *asyncAPIRefResolver) resolve(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		if ref, ok := value["$ref"].(string); ok {
+			if !strings.HasPrefix(ref, "#/") {
+				r.external++
+				return value
+			}
+			target, ok := r.lookup(ref)
+			if !ok || r.resolving[ref] {
+				return value
+			}
+			r.resolving[ref] = true
+			defer delete(r.resolving, ref)
+			return r.resolve(target)
+		}
+		resolved := make(map[string]interface{}, len(value))
+		for key, child := range value {
+			resolved[key] = r.resolve(child)
+		}
+		return resolved
+	case []interface{}:
+		resolved := make([]interface{}, len(value))
+		for i, child := range value {
+			resolved[i] = r.resolve(child)
+		}
+		return resolved
+	}
+	return value
+}
+
+// lookup follows the JSON pointer of a local $ref through the document.
+func (r *asyncAPIRefResolver) lookup(ref string) (interface{}, bool) {
+	var current interface{} = r.root
+	for _, segment := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+		object, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if current, ok = object[unescapeJSONPointer(segment)]; !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+func unescapeJSONPointer(segment string) string {
+	if unescaped, err := url.PathUnescape(segment); err == nil {
+		segment = unescaped
+	}
+	return strings.ReplaceAll(strings.ReplaceAll(segment, "~1", "/"), "~0", "~")
+}
+
+// AsyncAPICollectionName returns the collection folder a spec is generated
+// into, named after its title.
+func AsyncAPICollectionName(spec *AsyncAPISpec) string {
+	if strings.TrimSpace(spec.Info.Title) != "" {
+		return sanitizeRequestPathSegment(spec.Info.Title)
+	}
+	return "api"
+}
+
+// baseURL returns the server's URL with its variables filled with their
+// defaults.
+func (s asyncAPIServer) baseURL() string {
+	base := s.URL
+	if base == "" {
+		base = s.Host + s.Pathname
+	}
+	if !strings.Contains(base, "://") {
+		base = s.Protocol + "://" + base
+	}
+	for name, variable := range s.Variables {
+		base = strings.ReplaceAll(base, "{"+name+"}", variable.Default)
+	}
+	return strings.TrimSuffix(base, "/")
+}
+
+// scheme returns the server's protocol, lowercased.
+func (s asyncAPIServer) scheme() string {
+	if s.Protocol != "" {
+		return strings.ToLower(s.Protocol)
+	}
+	scheme, _, _ := strings.Cut(s.URL, "://")
+	return strings.ToLower(scheme)
+}
+
+// asyncAPISchemes are the protocols requests can be generated for.
+var asyncAPISchemes = map[string]bool{"ws": true, "wss": true, "http": true, "https": true}
+
+// channelServer picks the server a channel is used through among its
+// servers, or all servers when it names none: the first WebSocket one, else
+// the first HTTP one. Without either, it returns the protocols the channel
+// is served over.
+func (spec *AsyncAPISpec) channelServer(channel asyncAPIChannel) (string, []string) {
+	names := channel.Servers
+	if len(names) == 0 {
+		names = sortedKeys(spec.Servers)
+	}
+	var httpServer string
+	var protocols []string
+	for _, name := range names {
+		server, ok := spec.Servers[name]
+		if !ok {
+			continue
+		}
+		switch scheme := server.scheme(); {
+		case scheme == "ws" || scheme == "wss":
+			return name, nil
+		case asyncAPISchemes[scheme]:
+			httpServer = cmp.Or(httpServer, name)
+		default:
+			protocols = append(protocols, scheme)
+		}
+	}
+	if httpServer != "" {
+		return httpServer, nil
+	}
+	return "", protocols
+}
+
+// asyncAPIRequest is a request generated for a channel and the body
+// templates that come with it.
+type asyncAPIRequest struct {
+	name   string
+	config RequestConfig
+	bodies map[string]string
+}
+
+// asyncAPIRequests builds the requests of spec, and the name of the server
+// the generated environment points at.
+func (spec *AsyncAPISpec) asyncAPIRequests() ([]asyncAPIRequest, string, []string) {
+	warnings := append([]string(nil), spec.warnings...)
+	envServer := ""
+	var requests []asyncAPIRequest
+	for _, channelName := range sortedKeys(spec.Channels) {
+		channel := spec.Channels[channelName]
+		address := channelName
+		if strings.HasPrefix(spec.AsyncAPI, "3.") {
+			if channel.Address == nil {
+				warnings = append(warnings, fmt.Sprintf("channel %s has no address; skipped", channelName))
+				continue
+			}
+			address = *channel.Address
+		}
+		serverName, protocols := spec.channelServer(channel)
+		if serverName == "" {
+			if len(protocols) == 0 {
+				warnings = append(warnings, fmt.Sprintf("channel %s has no server; skipped", channelName))
+			} else {
+				warnings = append(warnings, fmt.Sprintf("channel %s is only served over %s, which api-man can't send; skipped", channelName, strings.Join(protocols, ", ")))
+			}
+			continue
+		}
+		if envServer == "" {
+			envServer = serverName
+		}
+		server := spec.Servers[serverName]
+		// Channels served elsewhere than the environment's server get
+		// absolute URLs.
+		requestURL := "/" + strings.TrimPrefix(address, "/")
+		if serverName != envServer {
+			requestURL = server.baseURL() + requestURL
+		}
+		pathParams := map[string]string{}
+		for name, parameter := range channel.Parameters {
+			pathParams[name] = asyncAPIParameterValue(parameter.Default, parameter.Enum, parameter.Examples, parameter.Schema)
+		}
+
+		messages := spec.channelMessages(channelName, channel)
+		sends, receives := messages.sends, messages.receives
+		base := RequestConfig{
+			URL:        requestURL,
+			Headers:    map[string]string{},
+			Cookies:    map[string]string{},
+			Params:     map[string]interface{}{},
+			PathParams: pathParams,
+		}
+		name := sanitizeRequestPathSegment(strings.ReplaceAll(strings.Trim(channelName, "/"), "/", "-"))
+
+		switch server.scheme() {
+		case "ws", "wss":
+			config := base
+			config.Name = name
+			config.Method = "GET"
+			config.WebSocket = &WebSocketConfig{}
+			config.Description = cmp.Or(messages.sendSummary, messages.receiveSummary, channel.Description)
+			bodies := map[string]string{}
+			for i, message := range sends {
+				body := asyncAPIMessageBody(message)
+				if i == 0 {
+					config.Body = body
+				} else if body != "" {
+					bodies[sanitizeRequestPathSegment(asyncAPIMessageName(message, i))] = body
+				}
+			}
+			requests = append(requests, asyncAPIRequest{name: name, config: config, bodies: bodies})
+		default:
+			if len(receives) > 0 {
+				config := base
+				config.Name = name
+				config.Method = "GET"
+				config.Headers = map[string]string{"Accept": "text/event-stream"}
+				config.Stream = true
+				config.Description = cmp.Or(messages.receiveSummary, channel.Description)
+				if len(sends) > 0 {
+					config.Name = name + "-receive"
+				}
+				requests = append(requests, asyncAPIRequest{name: config.Name, config: config})
+			}
+			if len(sends) > 0 {
+				config := base
+				config.Name = name
+				config.Method = "POST"
+				config.Description = cmp.Or(messages.sendSummary, channel.Description)
+				if len(receives) > 0 {
+					config.Name = name + "-send"
+				}
+				contentType := cmp.Or(sends[0].ContentType, "application/json")
+				config.Headers = map[string]string{"Content-Type": contentType}
+				config.Body = asyncAPIMessageBody(sends[0])
+				bodies := map[string]string{}
+				for i, message := range sends[1:] {
+					if body := asyncAPIMessageBody(message); body != "" {
+						bodies[sanitizeRequestPathSegment(asyncAPIMessageName(message, i+1))] = body
+					}
+				}
+				requests = append(requests, asyncAPIRequest{name: config.Name, config: config, bodies: bodies})
+			}
+			if len(sends) == 0 && len(receives) == 0 {
+				warnings = append(warnings, fmt.Sprintf("channel %s has no operations; skipped", channelName))
+			}
+		}
+	}
+	return requests, envServer, warnings
+}
+
+// asyncAPIChannelMessages are the messages a client sends to a channel and
+// those it receives from it, with the summaries of their operations.
+type asyncAPIChannelMessages struct {
+	sends, receives             []*asyncAPIMessage
+	sendSummary, receiveSummary string
+}
+
+// channelMessages returns the messages of a channel. 2.x describes the
+// application, so the client sends what its publish operation takes; 3.0
+// describes it the other way round, so the client sends what a receive
+// operation takes.
+func (spec *AsyncAPISpec) channelMessages(channelName string, channel asyncAPIChannel) asyncAPIChannelMessages {
+	var messages asyncAPIChannelMessages
+	if !strings.HasPrefix(spec.AsyncAPI, "3.") {
+		if op := channel.Publish; op != nil {
+			messages.sends = op.Message.alternatives()
+			messages.sendSummary = cmp.Or(op.Summary, op.Description)
+		}
+		if op := channel.Subscribe; op != nil {
+			messages.receives = op.Message.alternatives()
+			messages.receiveSummary = cmp.Or(op.Summary, op.Description)
+		}
+		return messages
+	}
+	for _, operationName := range sortedKeys(spec.Operations) {
+		op := spec.Operations[operationName]
+		if op.Channel != channelName {
+			continue
+		}
+		var used []*asyncAPIMessage
+		names := op.Messages
+		if len(names) == 0 {
+			names = sortedKeys(channel.Messages)
+		}
+		for _, name := range names {
+			if message := channel.Messages[name]; message != nil {
+				if message.Name == "" {
+					message.Name = name
+				}
+				used = append(used, message)
+			}
+		}
+		if op.Action == "receive" {
+			messages.sends = append(messages.sends, used...)
+			messages.sendSummary = cmp.Or(messages.sendSummary, op.Summary, op.Description)
+		} else {
+			messages.receives = append(messages.receives, used...)
+			messages.receiveSummary = cmp.Or(messages.receiveSummary, op.Summary, op.Description)
+		}
+	}
+	return messages
+}
+
+// alternatives returns the messages of a 2.x operation: the message, or
+// each of its oneOf.
+func (m *asyncAPIMessage) alternatives() []*asyncAPIMessage {
+	if m == nil {
+		return nil
+	}
+	if len(m.OneOf) > 0 {
+		return m.OneOf
+	}
+	return []*asyncAPIMessage{m}
+}
+
+func asyncAPIMessageName(message *asyncAPIMessage, i int) string {
+	return cmp.Or(message.Name, message.Title, fmt.Sprintf("message-%d", i+1))
+}
+
+// asyncAPIMessageBody returns the first example of a message's payload, or
+// a value built from its schema. JSON payloads are indented; a string
+// payload is sent as it is.
+func asyncAPIMessageBody(message *asyncAPIMessage) string {
+	var payload interface{}
+	for _, example := range message.Examples {
+		if example.Payload != nil {
+			payload = example.Payload
+			break
+		}
+	}
+	if payload == nil && len(message.Payload) > 0 {
+		payload = exampleValue(asyncAPISchema(message.Payload), 0)
+	}
+	if payload == nil {
+		return ""
+	}
+	if text, ok := payload.(string); ok {
+		return text
+	}
+	data, err := json.MarshalIndent(payload, "", "  ")
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// asyncAPISchema reads a JSON Schema payload as an OpenAPI schema, close
+// enough to build an example value from.
+func asyncAPISchema(data json.RawMessage) *openapi3.SchemaRef {
+	var schema openapi3.SchemaRef
+	if json.Unmarshal(data, &schema) != nil {
+		return nil
+	}
+	return &schema
+}
+
+// asyncAPIParameterValue returns the value a channel parameter is filled
+// with: its default, first example or first enum value in 3.0, or those of
+// its schema in 2.x.
+func asyncAPIParameterValue(def interface{}, enum, examples []interface{}, schema json.RawMessage) string {
+	switch {
+	case def != nil:
+		return fmt.Sprint(def)
+	case len(examples) > 0:
+		return fmt.Sprint(examples[0])
+	case len(enum) > 0:
+		return fmt.Sprint(enum[0])
+	case len(schema) > 0:
+		if value := exampleValue(asyncAPISchema(schema), 0); value != nil {
+			return fmt.Sprint(value)
+		}
+	}
+	return ""
+}
+
+// GenerateRequestsFromAsyncAPI writes the requests of an AsyncAPI spec
+// into requests/<title>/, replacing those generated before, and seeds an
+// environment named after the collection with the spec's first usable
+// server unless it exists.
+func (cm *ConfigManager) GenerateRequestsFromAsyncAPI(spec *AsyncAPISpec) (*OpenAPIImportResult, error) {
+	collection := AsyncAPICollectionName(spec)
+	requests, envServer, warnings := spec.asyncAPIRequests()
+	result := &OpenAPIImportResult{Collection: collection, Warnings: warnings}
+	if len(requests) == 0 {
+		return nil, fmt.Errorf("no WebSocket or HTTP channels in the spec")
+	}
+
+	names := map[string]bool{}
+	for _, request := range requests {
+		if names[request.name] {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("%s/%s is generated for more than one channel; keeping the first", collection, request.name))
+			continue
+		}
+		names[request.name] = true
+		requestPath := collection + "/" + request.name
+		if err := os.MkdirAll(filepath.Join(cm.requestsDir, requestPath), 0755); err != nil {
+			return nil, fmt.Errorf("creating request directory: %w", err)
+		}
+		if err := cm.SaveRequest(requestPath, request.config); err != nil {
+			return nil, fmt.Errorf("saving %s: %w", requestPath, err)
+		}
+		result.Imported++
+		for _, name := range sortedKeys(request.bodies) {
+			if err := cm.SaveBodyContent(requestPath, name, request.bodies[name]); err != nil {
+				return nil, fmt.Errorf("saving body %s of %s: %w", name, requestPath, err)
+			}
+			result.Bodies++
+		}
+	}
+
+	// As with OpenAPI, an existing environment holds the user's
+	// credentials and is never overwritten.
+	if ValidateEnvironmentName(collection) == nil {
+		if _, exists := cm.environmentFile(collection); !exists {
+			env := Environment{
+				BaseURL:   spec.Servers[envServer].baseURL(),
+				Headers:   map[string]string{},
+				Cookies:   map[string]string{},
+				Auth:      map[string]string{},
+				Variables: map[string]string{},
+			}
+			if err := cm.SaveEnvironment(collection, env); err != nil {
+				return nil, err
+			}
+			result.Environments = append(result.Environments, collection)
+		}
+	}
+	return result, nil
+}
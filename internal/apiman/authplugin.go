@@ -0,0 +1,147 @@
+// authplugin.go
+package apiman
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Auth types other than the built-in ones are handed to a plugin: an
+// executable named api-man-auth-<type>, looked up in the workspace's
+// plugins/ directory and then on PATH. An environment with
+//
+//	"auth": {"type": "aws-sigv4", "region": "eu-west-1", "service": "execute-api"}
+//
+// runs api-man-auth-aws-sigv4 for every request. The plugin reads an
+// AuthPluginInput as JSON on stdin and writes an AuthPluginOutput as JSON on
+// stdout; its stderr is passed through, and a non-zero exit fails the
+// request.
+const authPluginTimeout = 30 * time.Second
+
+// authPluginPrefix is the name every auth plugin executable starts with.
+const authPluginPrefix = "api-man-auth-"
+
+// builtinAuthTypes are the auth types handled without a plugin.
+var builtinAuthTypes = []string{"", "none", "bearer", "basic", "api-key", "oauth2", "jwt", "digest", "ntlm", "negotiate"}
+
+var authTypePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]*$`)
+
+// AuthPluginInput is what an auth plugin reads from stdin: the environment's
+// auth block and the request to authenticate.
+type AuthPluginInput struct {
+	Type        string            `json:"type"`
+	Environment string            `json:"environment"`
+	Auth        map[string]string `json:"auth"`
+	Request     AuthPluginRequest `json:"request"`
+}
+
+// AuthPluginRequest is the request as it will be sent, minus the plugin's
+// own headers.
+type AuthPluginRequest struct {
+	Method  string            `json:"method"`
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers"`
+	Body    string            `json:"body,omitempty"`
+}
+
+// AuthPluginOutput is what an auth plugin writes to stdout: headers to set
+// on the request (replacing any with the same name) and query parameters to
+// add to its URL, e.g. for presigned URLs.
+type AuthPluginOutput struct {
+	Headers map[string]string `json:"headers,omitempty"`
+	Query   map[string]string `json:"query,omitempty"`
+}
+
+// findAuthPlugin returns the executable for an auth type.
+func (cm *ConfigManager) findAuthPlugin(authType string) (string, error) {
+	if !authTypePattern.MatchString(authType) {
+		return "", fmt.Errorf("invalid auth type %q", authType)
+	}
+	name := authPluginPrefix + authType
+	local := filepath.Join(cm.configDir, "plugins", name)
+	if info, err := os.Stat(local); err == nil && !info.IsDir() {
+		return local, nil
+	}
+	path, err := exec.LookPath(name)
+	if errors.Is(err, exec.ErrNotFound) {
+		return "", fmt.Errorf("unknown auth type %q: no %s in plugins/ or on PATH", authType, name)
+	}
+	return path, err
+}
+
+// applyAuthPlugin runs the plugin for env's auth type and applies what it
+// returns to req.
+func (cm *ConfigManager) applyAuthPlugin(req *http.Request, envName string, env *Environment) error {
+	authType := env.Auth["type"]
+	plugin, err := cm.findAuthPlugin(authType)
+	if err != nil {
+		return err
+	}
+	body, err := readRequestBody(req)
+	if err != nil {
+		return err
+	}
+	input := AuthPluginInput{
+		Type:        authType,
+		Environment: envName,
+		Auth:        env.Auth,
+		Request: AuthPluginRequest{
+			Method:  req.Method,
+			URL:     req.URL.String(),
+			Headers: flattenHeaders(req.Header),
+			Body:    body,
+		},
+	}
+	payload, err := json.Marshal(input)
+	if err != nil {
+		return fmt.Errorf("encoding auth plugin input: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), authPluginTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, plugin)
+	cmd.Dir = cm.configDir
+	cmd.Stdin = bytes.NewReader(payload)
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(),
+		"API_MAN_AUTH_TYPE="+authType,
+		"API_MAN_ENVIRONMENT="+envName,
+		"API_MAN_WORKSPACE="+cm.configDir,
+	)
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("auth plugin %s: %w", filepath.Base(plugin), err)
+	}
+
+	var output AuthPluginOutput
+	if err := json.Unmarshal(bytes.TrimSpace(stdout.Bytes()), &output); err != nil {
+		return fmt.Errorf("parsing output of auth plugin %s: %w", filepath.Base(plugin), err)
+	}
+	for name, value := range output.Headers {
+		if strings.EqualFold(name, "Host") {
+			req.Host = value
+			continue
+		}
+		req.Header.Set(name, value)
+	}
+	if len(output.Query) > 0 {
+		query := req.URL.Query()
+		for name, value := range output.Query {
+			query.Set(name, value)
+		}
+		req.URL.RawQuery = query.Encode()
+	}
+	return nil
+}
@@ -0,0 +1,321 @@
+// awssm.go
+package apiman
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// awsSecretsManagerProvider reads {{aws-sm:<secret-id>#<field>}} from AWS
+// Secrets Manager. The secret ID is a name or ARN; #field picks one key of a
+// secret stored as JSON. Credentials come from AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN, or the AWS_PROFILE (default
+// "default") profile of ~/.aws/credentials; the region from the ARN,
+// AWS_REGION or AWS_DEFAULT_REGION. AWS_ENDPOINT_URL_SECRETS_MANAGER or
+// AWS_ENDPOINT_URL point it at another endpoint, e.g. LocalStack.
+type awsSecretsManagerProvider struct{}
+
+// awsHTTPClient sends requests to AWS, for Secrets Manager and S3 remotes.
+var awsHTTPClient = &http.Client{Timeout: 30 * time.Second}
+
+// awsAuthErrors are the Secrets Manager error types caused by missing,
+// wrong or expired credentials.
+var awsAuthErrors = []string{
+	"UnrecognizedClientException", "InvalidSignatureException", "ExpiredTokenException",
+	"IncompleteSignature", "MissingAuthenticationToken", "AccessDeniedException",
+	"InvalidClientTokenId", "SignatureDoesNotMatch",
+}
+
+type awsCredentials struct {
+	accessKeyID, secretAccessKey, sessionToken string
+}
+
+func (awsSecretsManagerProvider) FetchSecret(ctx context.Context, reference string) (string, error) {
+	secretID, field := splitSecretKey(reference)
+	region := awsRegion(secretID)
+	if region == "" {
+		return "", fmt.Errorf("aws-sm: no region: set AWS_REGION or use the secret's ARN")
+	}
+	creds, err := loadAWSCredentials()
+	if err != nil {
+		return "", fmt.Errorf("aws-sm: %w", err)
+	}
+
+	endpoint := os.Getenv("AWS_ENDPOINT_URL_SECRETS_MANAGER")
+	if endpoint == "" {
+		endpoint = os.Getenv("AWS_ENDPOINT_URL")
+	}
+	if endpoint == "" {
+		endpoint = "https://secretsmanager." + region + ".amazonaws.com"
+	}
+	payload, err := json.Marshal(map[string]string{"SecretId": secretID})
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(endpoint, "/")+"/", bytes.NewReader(payload))
+	if err != nil {
+		return "", fmt.Errorf("aws-sm: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	signAWSv4(req, payload, creds, region, "secretsmanager", time.Now().UTC())
+
+	resp, err := awsHTTPClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("aws-sm: reading %s: %w", secretID, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("aws-sm: reading %s: %w", secretID, err)
+	}
+
+	if resp.StatusCode >= 300 {
+		var failure struct {
+			Type         string `json:"__type"`
+			Message      string `json:"message"`
+			MessageUpper string `json:"Message"`
+		}
+		json.Unmarshal(body, &failure)
+		errorType := failure.Type[strings.LastIndex(failure.Type, "#")+1:]
+		message := failure.Message
+		if message == "" {
+			message = failure.MessageUpper
+		}
+		if message == "" {
+			message = resp.Status
+		}
+		for _, authError := range awsAuthErrors {
+			if errorType == authError {
+				return "", fmt.Errorf("aws-sm: authentication failed reading %s: %s: %s (check AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, AWS_SESSION_TOKEN or AWS_PROFILE)", secretID, errorType, message)
+			}
+		}
+		if errorType == "ResourceNotFoundException" {
+			return "", fmt.Errorf("aws-sm: no secret %s in %s", secretID, region)
+		}
+		if errorType != "" {
+			message = errorType + ": " + message
+		}
+		return "", fmt.Errorf("aws-sm: reading %s: %s", secretID, message)
+	}
+
+	var secret struct {
+		SecretString string `json:"SecretString"`
+		SecretBinary string `json:"SecretBinary"`
+	}
+	if err := json.Unmarshal(body, &secret); err != nil {
+		return "", fmt.Errorf("aws-sm: parsing %s: %w", secretID, err)
+	}
+	value := secret.SecretString
+	if value == "" && secret.SecretBinary != "" {
+		decoded, err := base64.StdEncoding.DecodeString(secret.SecretBinary)
+		if err != nil {
+			return "", fmt.Errorf("aws-sm: decoding %s: %w", secretID, err)
+		}
+		value = string(decoded)
+	}
+	if field == "" {
+		return value, nil
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(value), &fields); err != nil {
+		return "", fmt.Errorf("aws-sm: %s is not a JSON secret, so #%s can't be selected", secretID, field)
+	}
+	return structuredSecretField("aws-sm", secretID, fields, field)
+}
+
+// awsRegion returns the region of an ARN, where the resource lives, or
+// else the configured region.
+func awsRegion(secretID string) string {
+	// arn:aws:secretsmanager:<region>:<account>:secret:<name>
+	if parts := strings.Split(secretID, ":"); len(parts) > 3 && parts[0] == "arn" && parts[3] != "" {
+		return parts[3]
+	}
+	for _, name := range []string{"AWS_REGION", "AWS_DEFAULT_REGION"} {
+		if region := os.Getenv(name); region != "" {
+			return region
+		}
+	}
+	return ""
+}
+
+// loadAWSCredentials reads credentials from the environment, then from the
+// shared credentials file.
+func loadAWSCredentials() (awsCredentials, error) {
+	creds := awsCredentials{
+		accessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		sessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if creds.accessKeyID != "" && creds.secretAccessKey != "" {
+		return creds, nil
+	}
+
+	file := os.Getenv("AWS_SHARED_CREDENTIALS_FILE")
+	if file == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			file = filepath.Join(home, ".aws", "credentials")
+		}
+	}
+	profile := os.Getenv("AWS_PROFILE")
+	if profile == "" {
+		profile = "default"
+	}
+	values, err := readINISection(file, profile)
+	if err == nil && values["aws_access_key_id"] != "" && values["aws_secret_access_key"] != "" {
+		return awsCredentials{
+			accessKeyID:     values["aws_access_key_id"],
+			secretAccessKey: values["aws_secret_access_key"],
+			sessionToken:    values["aws_session_token"],
+		}, nil
+	}
+	return awsCredentials{}, fmt.Errorf("no AWS credentials: set AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY, or add profile %q to %s", profile, file)
+}
+
+// readINISection returns the key = value pairs of one [section] of an INI
+// file such as ~/.aws/credentials.
+func readINISection(path, section string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	values := make(map[string]string)
+	inSection := false
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";"):
+			continue
+		case strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]"):
+			inSection = strings.TrimSpace(line[1:len(line)-1]) == section
+		case inSection:
+			if key, value, ok := strings.Cut(line, "="); ok {
+				values[strings.TrimSpace(key)] = strings.TrimSpace(value)
+			}
+		}
+	}
+	return values, scanner.Err()
+}
+
+// signAWSv4 adds AWS Signature Version 4 headers to req. The URL's path
+// and query are re-encoded the way they are signed, so that the request
+// sent matches the signature.
+func signAWSv4(req *http.Request, payload []byte, creds awsCredentials, region, service string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(payload)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	if creds.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.sessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	req.URL.RawPath = awsURIEncode(req.URL.Path, true)
+	req.URL.RawQuery = awsCanonicalQuery(req.URL.Query())
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if service != "s3" {
+		// Every service but S3 signs the path encoded a second time.
+		path = awsURIEncode(path, true)
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method, path, req.URL.RawQuery, canonicalHeaders.String(), signedHeaders, payloadHash,
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+	key := hmacSHA256([]byte("AWS4"+creds.secretAccessKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		creds.accessKeyID, scope, signedHeaders, signature))
+}
+
+// awsURIEncode percent-encodes s as SigV4 requires: every byte but the
+// unreserved A-Z, a-z, 0-9, '-', '_', '.' and '~', so a space is %20, not
+// '+'. With keepSlash set, '/' is left alone, for paths.
+func awsURIEncode(s string, keepSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/' && keepSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// awsCanonicalQuery encodes query as SigV4 signs it: names and values
+// encoded with awsURIEncode and sorted by name, then value.
+func awsCanonicalQuery(query url.Values) string {
+	var pairs [][2]string
+	for name, values := range query {
+		for _, value := range values {
+			pairs = append(pairs, [2]string{awsURIEncode(name, false), awsURIEncode(value, false)})
+		}
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i][0] != pairs[j][0] {
+			return pairs[i][0] < pairs[j][0]
+		}
+		return pairs[i][1] < pairs[j][1]
+	})
+	encoded := make([]string, len(pairs))
+	for i, pair := range pairs {
+		encoded[i] = pair[0] + "=" + pair[1]
+	}
+	return strings.Join(encoded, "&")
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,64 @@
+package apiman
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// TestSignAWSv4 checks signatures from the AWS Signature Version 4 test
+// suite (get-vanilla, get-vanilla-query-order-key-case and
+// get-vanilla-utf8-query).
+func TestSignAWSv4(t *testing.T) {
+	tests := []struct {
+		url, signature string
+	}{
+		{"https://example.amazonaws.com/", "5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"},
+		{"https://example.amazonaws.com/?Param2=value2&Param1=value1", "b97d918cfa904a5beff61c982a1b6f458b799221646efd99d3219ec94cdf2500"},
+		{"https://example.amazonaws.com/?%E1%88%B4=bar", "2cdec8eed098649ff3a119c94853b13c643bcf08f8b0a1d91e12c9027818dd04"},
+	}
+	creds := awsCredentials{accessKeyID: "AKIDEXAMPLE", secretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"}
+	now := time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+	for _, tt := range tests {
+		req, err := http.NewRequest(http.MethodGet, tt.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		signAWSv4(req, nil, creds, "us-east-1", "service", now)
+		want := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=" + tt.signature
+		if got := req.Header.Get("Authorization"); got != want {
+			t.Errorf("%s:\n got %s\nwant %s", tt.url, got, want)
+		}
+	}
+}
+
+func TestAWSURIEncoding(t *testing.T) {
+	query := url.Values{"b": {"x y"}, "a": {"2", "1"}, "a-b": {"~+*"}}
+	if got, want := awsCanonicalQuery(query), "a=1&a=2&a-b=~%2B%2A&b=x%20y"; got != want {
+		t.Errorf("canonical query %q, want %q", got, want)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, "https://bucket.s3.us-east-1.amazonaws.com/sync/a b+c(1).json?list-type=2&prefix=a b", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signAWSv4(req, nil, awsCredentials{accessKeyID: "id", secretAccessKey: "secret"}, "us-east-1", "s3", time.Now())
+	if got, want := req.URL.String(), "https://bucket.s3.us-east-1.amazonaws.com/sync/a%20b%2Bc%281%29.json?list-type=2&prefix=a%20b"; got != want {
+		t.Errorf("signed request sent to %s, want %s", got, want)
+	}
+}
+
+func TestAWSRegionPrefersARN(t *testing.T) {
+	t.Setenv("AWS_REGION", "us-east-1")
+	t.Setenv("AWS_DEFAULT_REGION", "")
+	if got := awsRegion("arn:aws:secretsmanager:eu-west-2:123456789012:secret:db"); got != "eu-west-2" {
+		t.Errorf("ARN region: got %s", got)
+	}
+	if got := awsRegion("db"); got != "us-east-1" {
+		t.Errorf("name: got %s", got)
+	}
+	if got := awsRegion("arn:aws:secretsmanager::123:secret:db"); got != "us-east-1" {
+		t.Error("ARN without a region didn't fall back to AWS_REGION")
+	}
+}
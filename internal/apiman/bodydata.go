@@ -0,0 +1,69 @@
+// bodydata.go
+package apiman
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// requestDataDir is the folder, beside a request's body templates, holding
+// its data files: JSON objects whose values fill the {{placeholders}} of the
+// body, so one body template serves many datasets.
+const requestDataDir = "data"
+
+// requestDataPath returns the data folder of requestPath.
+func (cm *ConfigManager) requestDataPath(requestPath string) string {
+	return filepath.Join(cm.requestsDir, requestPath, requestDataDir)
+}
+
+// ListRequestData returns the names of requestPath's data files, sorted.
+func (cm *ConfigManager) ListRequestData(requestPath string) ([]string, error) {
+	entries, err := os.ReadDir(cm.requestDataPath(requestPath))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading data folder: %w", err)
+	}
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".json") {
+			names = append(names, strings.TrimSuffix(entry.Name(), ".json"))
+		}
+	}
+	return names, nil
+}
+
+// LoadRequestData reads the dataset name for requestPath as variables: a
+// file in the request's data folder, with or without its .json extension,
+// or else a JSON file at that path. Its top-level values become variables;
+// objects, arrays and null are written as JSON, to be placed unquoted in a
+// body.
+func (cm *ConfigManager) LoadRequestData(requestPath, name string) (map[string]string, error) {
+	file := filepath.Join(cm.requestDataPath(requestPath), strings.TrimSuffix(name, ".json")+".json")
+	if !fileExists(file) {
+		if !fileExists(name) {
+			return nil, fmt.Errorf("data file %q not found in %s", name, cm.relativePath(cm.requestDataPath(requestPath)))
+		}
+		file = name
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("reading data file: %w", err)
+	}
+	var values map[string]interface{}
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, fmt.Errorf("parsing data file %s: %w", name, err)
+	}
+	vars := make(map[string]string, len(values))
+	for key, value := range values {
+		vars[key] = jsonValueString(value)
+		if value == nil {
+			vars[key] = "null"
+		}
+	}
+	return vars, nil
+}
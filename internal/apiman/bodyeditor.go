@@ -0,0 +1,130 @@
+// bodyeditor.go
+package apiman
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// templateTagPattern matches any {{...}} in a body template: variables,
+// secrets and template functions with their arguments.
+var templateTagPattern = regexp.MustCompile(`\{\{[^{}]*\}\}`)
+
+// BodySyntaxError reports where a body template stops being JSON.
+type BodySyntaxError struct {
+	Line, Column int
+	Message      string
+}
+
+func (e *BodySyntaxError) Error() string {
+	return fmt.Sprintf("invalid JSON at line %d, column %d: %s", e.Line, e.Column, e.Message)
+}
+
+// checkBodyJSON reports a *BodySyntaxError when content, with its
+// {{placeholders}} standing in for values, isn't JSON. Empty content is
+// fine: it sends no body.
+func checkBodyJSON(content string) error {
+	if strings.TrimSpace(content) == "" {
+		return nil
+	}
+	// A placeholder may stand for a string, number or object, quoted or
+	// not; a 0 padded to its length keeps offsets pointing at the original.
+	stubbed := templateTagPattern.ReplaceAllStringFunc(content, func(tag string) string {
+		return "0" + strings.Repeat(" ", len(tag)-1)
+	})
+	decoder := json.NewDecoder(strings.NewReader(stubbed))
+	var value interface{}
+	err := decoder.Decode(&value)
+	if err == nil {
+		if _, extra := decoder.Token(); extra == nil {
+			return bodySyntaxError(stubbed, decoder.InputOffset(), "unexpected content after the JSON value")
+		}
+		return nil
+	}
+	var syntax *json.SyntaxError
+	if errors.As(err, &syntax) {
+		return bodySyntaxError(stubbed, syntax.Offset, syntax.Error())
+	}
+	return bodySyntaxError(stubbed, int64(len(stubbed)), err.Error())
+}
+
+// bodySyntaxError locates the byte before offset, where encoding/json
+// reports errors, in content by line and column.
+func bodySyntaxError(content string, offset int64, message string) *BodySyntaxError {
+	before := content[:max(min(int(offset), len(content))-1, 0)]
+	line := strings.Count(before, "\n") + 1
+	column := len(before) - strings.LastIndex(before, "\n")
+	return &BodySyntaxError{Line: line, Column: column, Message: message}
+}
+
+// SchemaExampleBody builds an example body from the JSON schema a request
+// was generated with, as api-man generate does for new requests.
+func (cm *ConfigManager) SchemaExampleBody(requestPath string) (string, error) {
+	config, err := cm.LoadRequest(requestPath)
+	if err != nil {
+		return "", fmt.Errorf("loading request: %w", err)
+	}
+	if config.Schema == nil || config.Schema.Body == nil {
+		return "", fmt.Errorf("request %s has no body schema (it wasn't generated from an OpenAPI spec)", requestPath)
+	}
+	data, err := json.Marshal(config.Schema.Body)
+	if err != nil {
+		return "", err
+	}
+	var schema openapi3.Schema
+	if err := json.Unmarshal(data, &schema); err != nil {
+		return "", fmt.Errorf("reading body schema: %w", err)
+	}
+	example, err := json.MarshalIndent(exampleValue(&openapi3.SchemaRef{Value: &schema}, 0), "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(example) + "\n", nil
+}
+
+// editorCommand returns the command line of the user's editor: $VISUAL,
+// then $EDITOR, then vi.
+func editorCommand() []string {
+	for _, name := range []string{"VISUAL", "EDITOR"} {
+		if fields := strings.Fields(os.Getenv(name)); len(fields) > 0 {
+			return fields
+		}
+	}
+	return []string{"vi"}
+}
+
+// editText opens content in the user's editor in a temporary file named
+// like pattern (see os.CreateTemp) and returns what was saved.
+func editText(content, pattern string) (string, error) {
+	file, err := os.CreateTemp("", pattern)
+	if err != nil {
+		return "", fmt.Errorf("creating temporary file: %w", err)
+	}
+	defer os.Remove(file.Name())
+	_, err = file.WriteString(content)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", fmt.Errorf("writing temporary file: %w", err)
+	}
+
+	editor := editorCommand()
+	cmd := exec.Command(editor[0], append(editor[1:], file.Name())...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("running editor %s: %w", editor[0], err)
+	}
+	data, err := os.ReadFile(file.Name())
+	if err != nil {
+		return "", fmt.Errorf("reading edited file: %w", err)
+	}
+	return string(data), nil
+}
@@ -0,0 +1,136 @@
+// bodyfiles.go
+package apiman
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// bodyContentTypes are the body template file types besides JSON, with the
+// Content-Type sent for each unless the request sets its own. A JSON
+// template is named without its extension, so users.json is the body
+// "users"; the others keep theirs, so soap.xml is the body "soap.xml". A
+// .graphql body is sent as a JSON {"query": ...} document.
+var bodyContentTypes = map[string]string{
+	".xml":     "application/xml",
+	".txt":     "text/plain; charset=utf-8",
+	".graphql": "application/json",
+	".bin":     "application/octet-stream",
+}
+
+// bodyFileName returns the file name of the body template name.
+func bodyFileName(name string) string {
+	if _, ok := bodyContentTypes[filepath.Ext(name)]; ok {
+		return name
+	}
+	return name + ".json"
+}
+
+// bodyTemplateName returns the name of the body template stored in fileName, in a
+// request's directory, and false when the file is the request, its
+// defaults or not a body at all.
+func bodyTemplateName(fileName string) (string, bool) {
+	if fileName == "request.json" || fileName == defaultsFileName {
+		return "", false
+	}
+	ext := filepath.Ext(fileName)
+	if ext == ".json" {
+		return strings.TrimSuffix(fileName, ext), true
+	}
+	_, ok := bodyContentTypes[ext]
+	return fileName, ok
+}
+
+// bodyFile returns the path of requestPath's body template name and
+// whether it exists.
+func (cm *ConfigManager) bodyFile(requestPath, name string) (string, bool) {
+	file := filepath.Join(cm.requestsDir, requestPath, bodyFileName(name))
+	return file, fileExists(file)
+}
+
+// isBinaryBodyFile reports whether file is a .bin body, sent byte for byte.
+func isBinaryBodyFile(file string) bool {
+	return filepath.Ext(file) == ".bin"
+}
+
+// isJSONBody reports whether a body read from file, or the inline body when
+// file is "", is JSON: only those are checked against a request's schema.
+func isJSONBody(file string) bool {
+	return file == "" || filepath.Ext(file) == ".json"
+}
+
+// encodeBody turns the interpolated content of a body template read from
+// file into what is sent: GraphQL queries are wrapped in a JSON document,
+// everything else is sent as is.
+func encodeBody(file, content string) (string, error) {
+	if filepath.Ext(file) != ".graphql" || strings.TrimSpace(content) == "" {
+		return content, nil
+	}
+	data, err := json.Marshal(map[string]string{"query": content})
+	if err != nil {
+		return "", fmt.Errorf("encoding GraphQL body: %w", err)
+	}
+	return string(data), nil
+}
+
+// bodyContentType returns the Content-Type to send with a body read from
+// file, or "" to leave it to the request and environment headers.
+func bodyContentType(file string) string {
+	return bodyContentTypes[filepath.Ext(file)]
+}
+
+// hasHeader reports whether headers set name, in any case, to a value.
+func hasHeader(headers map[string]string, name string) bool {
+	for key, value := range headers {
+		if value != "" && http.CanonicalHeaderKey(key) == http.CanonicalHeaderKey(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// bodyPreview describes content read from file for display: binary bodies
+// by their size, everything else as text.
+func bodyPreview(file, content string) string {
+	if isBinaryBodyFile(file) {
+		return fmt.Sprintf("(binary, %d bytes)", len(content))
+	}
+	return content
+}
+
+// readBodyFile reads requestPath's body template name and returns it with
+// the file it came from.
+func (cm *ConfigManager) readBodyFile(requestPath, name string) (string, string, error) {
+	file, ok := cm.bodyFile(requestPath, name)
+	if !ok {
+		return "", file, fmt.Errorf("body file %q does not exist", name)
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return "", file, fmt.Errorf("reading body file: %w", err)
+	}
+	return string(data), file, nil
+}
+
+// exportBodyContent returns the content of body template name as it is
+// stored in a collection export: base64 for binary bodies, which JSON
+// strings can't hold.
+func exportBodyContent(name string, content []byte) string {
+	if isBinaryBodyFile(name) {
+		return base64.StdEncoding.EncodeToString(content)
+	}
+	return string(content)
+}
+
+// importBodyContent reverses exportBodyContent.
+func importBodyContent(name, content string) ([]byte, error) {
+	if isBinaryBodyFile(name) {
+		return base64.StdEncoding.DecodeString(content)
+	}
+	return []byte(content), nil
+}
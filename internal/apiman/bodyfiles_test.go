@@ -0,0 +1,74 @@
+package apiman
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEditedBodyKeepsItsTemplateType(t *testing.T) {
+	cm, err := InitWorkspace(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cm.SaveEnvironment("dev", Environment{BaseURL: "http://localhost"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := cm.SaveRequest("gql", RequestConfig{Method: "POST", URL: "/graphql", ActiveBody: "query.graphql"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := cm.SaveBodyContent("gql", "query.graphql", "{ users { id } }"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The TUI sends its edited body with the template it came from.
+	edited := "{ users { id name } }"
+	file := filepath.Join(cm.requestsDir, "gql", "query.graphql")
+	prepared, err := cm.PrepareRequest("gql", "dev", RequestOptions{Body: &edited, BodyFile: file})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sent, err := io.ReadAll(prepared.Request.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"query":"{ users { id name } }"}`; string(sent) != want {
+		t.Errorf("sent %s, want %s", sent, want)
+	}
+	if got := prepared.Request.Header.Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type %q", got)
+	}
+	if prepared.BodyName != "query.graphql" {
+		t.Errorf("body name %q", prepared.BodyName)
+	}
+}
+
+func TestSaveRequestEditsLeavesBinaryBodies(t *testing.T) {
+	cm, err := InitWorkspace(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cm.SaveRequest("upload", RequestConfig{Method: "PUT", URL: "/files", ActiveBody: "image.bin"}); err != nil {
+		t.Fatal(err)
+	}
+	image := "\x89PNG\r\n\x1a\n{{not a placeholder}}"
+	if err := cm.SaveBodyContent("upload", "image.bin", image); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := cm.saveRequestEdits("upload", "upload", "POST", "/files/new", "(binary, 24 bytes)"); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(cm.requestsDir, "upload", "image.bin"))
+	if err != nil || string(data) != image {
+		t.Errorf("binary body overwritten: %q, %v", data, err)
+	}
+	config, err := cm.LoadRequest("upload")
+	if err != nil || config.Method != "POST" || config.URL != "/files/new" {
+		t.Errorf("edits not saved: %+v, %v", config, err)
+	}
+	if err := cm.SaveBody("upload", "text"); err == nil {
+		t.Error("SaveBody overwrote a binary body")
+	}
+}
@@ -0,0 +1,330 @@
+// bodyformat.go
+package apiman
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"golang.org/x/net/html"
+	"gopkg.in/yaml.v3"
+)
+
+// bodyKind classifies a body for formatting by its Content-Type, sniffing
+// the body when the type is missing or generic.
+func bodyKind(body []byte, contentType string) string {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case mediaType == "text/html" || mediaType == "application/xhtml+xml":
+		return "html"
+	case mediaType == "application/xml" || mediaType == "text/xml" || strings.HasSuffix(mediaType, "+xml"):
+		return "xml"
+	case strings.HasSuffix(mediaType, "yaml") || strings.HasSuffix(mediaType, "yml"):
+		return "yaml"
+	case mediaType != "" && mediaType != "text/plain" && mediaType != "application/octet-stream":
+		return ""
+	}
+	trimmed := bytes.ToLower(bytes.TrimSpace(body[:min(len(body), 512)]))
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("<!doctype html")), bytes.HasPrefix(trimmed, []byte("<html")):
+		return "html"
+	case bytes.HasPrefix(trimmed, []byte("<?xml")):
+		return "xml"
+	}
+	return ""
+}
+
+// formatResponseBody pretty prints JSON, XML, HTML and YAML bodies and
+// returns anything else, or a body that doesn't parse as its type, as is.
+func formatResponseBody(body []byte, contentType string) string {
+	var jsonObj interface{}
+	if err := json.Unmarshal(body, &jsonObj); err == nil {
+		if prettyJSON, err := json.MarshalIndent(jsonObj, "", "  "); err == nil {
+			return string(prettyJSON)
+		}
+	}
+	var formatted string
+	var err error
+	switch bodyKind(body, contentType) {
+	case "xml":
+		formatted, err = indentXML(body)
+	case "html":
+		formatted, err = indentHTML(body)
+	case "yaml":
+		formatted, err = indentYAML(body)
+	default:
+		return string(body)
+	}
+	if err != nil {
+		return string(body)
+	}
+	return formatted
+}
+
+// indentXML re-indents an XML document two spaces per level. Elements
+// holding only text stay on one line, and namespace prefixes are kept as
+// written.
+func indentXML(body []byte) (string, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+	decoder.Strict = false
+	var tokens []xml.Token
+	for {
+		token, err := decoder.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		if text, ok := token.(xml.CharData); ok && len(bytes.TrimSpace(text)) == 0 {
+			continue
+		}
+		tokens = append(tokens, xml.CopyToken(token))
+	}
+
+	var b strings.Builder
+	depth := 0
+	indent := func() { b.WriteString(strings.Repeat("  ", depth)) }
+	for i := 0; i < len(tokens); i++ {
+		switch t := tokens[i].(type) {
+		case xml.StartElement:
+			indent()
+			b.WriteString("<" + xmlName(t.Name))
+			for _, attr := range t.Attr {
+				fmt.Fprintf(&b, " %s=\"%s\"", xmlName(attr.Name), xmlEscape(attr.Value))
+			}
+			next := func(j int) xml.Token {
+				if j < len(tokens) {
+					return tokens[j]
+				}
+				return nil
+			}
+			if _, ok := next(i + 1).(xml.EndElement); ok {
+				b.WriteString("/>\n")
+				i++
+				continue
+			}
+			if text, ok := next(i + 1).(xml.CharData); ok {
+				if _, ok := next(i + 2).(xml.EndElement); ok {
+					fmt.Fprintf(&b, ">%s</%s>\n", xmlEscape(strings.TrimSpace(string(text))), xmlName(t.Name))
+					i += 2
+					continue
+				}
+			}
+			b.WriteString(">\n")
+			depth++
+		case xml.EndElement:
+			depth = max(depth-1, 0)
+			indent()
+			b.WriteString("</" + xmlName(t.Name) + ">\n")
+		case xml.CharData:
+			indent()
+			b.WriteString(xmlEscape(strings.TrimSpace(string(t))) + "\n")
+		case xml.Comment:
+			indent()
+			b.WriteString("<!--" + string(t) + "-->\n")
+		case xml.ProcInst:
+			indent()
+			b.WriteString("<?" + t.Target + " " + string(t.Inst) + "?>\n")
+		case xml.Directive:
+			indent()
+			b.WriteString("<!" + string(t) + ">\n")
+		}
+	}
+	return strings.TrimSuffix(b.String(), "\n"), nil
+}
+
+func xmlName(name xml.Name) string {
+	if name.Space != "" {
+		return name.Space + ":" + name.Local
+	}
+	return name.Local
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// htmlRawElements keep their content as written when HTML is re-indented.
+var htmlRawElements = map[string]bool{"pre": true, "textarea": true, "script": true, "style": true}
+
+// htmlVoidElements have no closing tag.
+var htmlVoidElements = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true, "hr": true, "img": true,
+	"input": true, "link": true, "meta": true, "source": true, "track": true, "wbr": true,
+}
+
+// indentHTML parses an HTML document the way a browser would and writes it
+// back one element per line.
+func indentHTML(body []byte) (string, error) {
+	doc, err := html.Parse(bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	var walk func(n *html.Node, depth int)
+	walk = func(n *html.Node, depth int) {
+		pad := strings.Repeat("  ", depth)
+		switch n.Type {
+		case html.DocumentNode:
+			for c := n.FirstChild; c != nil; c = c.NextSibling {
+				walk(c, depth)
+			}
+		case html.DoctypeNode:
+			b.WriteString("<!DOCTYPE " + n.Data + ">\n")
+		case html.CommentNode:
+			b.WriteString(pad + "<!--" + n.Data + "-->\n")
+		case html.TextNode:
+			if text := strings.Join(strings.Fields(n.Data), " "); text != "" {
+				b.WriteString(pad + html.EscapeString(text) + "\n")
+			}
+		case html.ElementNode:
+			b.WriteString(pad + "<" + n.Data)
+			for _, attr := range n.Attr {
+				fmt.Fprintf(&b, " %s=\"%s\"", attr.Key, html.EscapeString(attr.Val))
+			}
+			b.WriteString(">")
+			if htmlVoidElements[n.Data] {
+				b.WriteString("\n")
+				return
+			}
+			if htmlRawElements[n.Data] {
+				var raw strings.Builder
+				for c := n.FirstChild; c != nil; c = c.NextSibling {
+					html.Render(&raw, c)
+				}
+				b.WriteString(raw.String() + "</" + n.Data + ">\n")
+				return
+			}
+			if n.FirstChild != nil && n.FirstChild == n.LastChild && n.FirstChild.Type == html.TextNode {
+				text := strings.Join(strings.Fields(n.FirstChild.Data), " ")
+				b.WriteString(html.EscapeString(text) + "</" + n.Data + ">\n")
+				return
+			}
+			b.WriteString("\n")
+			for c := n.FirstChild; c != nil; c = c.NextSibling {
+				walk(c, depth+1)
+			}
+			b.WriteString(pad + "</" + n.Data + ">\n")
+		}
+	}
+	walk(doc, 0)
+	return strings.TrimSuffix(b.String(), "\n"), nil
+}
+
+// indentYAML re-indents YAML two spaces per level, keeping key order and
+// comments.
+func indentYAML(body []byte) (string, error) {
+	var b strings.Builder
+	decoder := yaml.NewDecoder(bytes.NewReader(body))
+	encoder := yaml.NewEncoder(&b)
+	encoder.SetIndent(2)
+	for {
+		var doc yaml.Node
+		if err := decoder.Decode(&doc); err == io.EOF {
+			break
+		} else if err != nil {
+			return "", err
+		}
+		if err := encoder.Encode(&doc); err != nil {
+			return "", err
+		}
+	}
+	if err := encoder.Close(); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(b.String(), "\n"), nil
+}
+
+// xmlToJSON converts an XML document to JSON for querying and diffing. An
+// element becomes an object of its attributes ("@name"), child elements
+// (an array when a name repeats) and text ("#text"); an element with only
+// text becomes a string. The root element is the single top-level key.
+func xmlToJSON(body []byte) ([]byte, error) {
+	type element struct {
+		name     string
+		fields   map[string]interface{}
+		repeated map[string]bool
+		text     strings.Builder
+		children bool
+	}
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+	decoder.Strict = false
+	var stack []*element
+	for {
+		token, err := decoder.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parsing XML: %w", err)
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			e := &element{name: xmlName(t.Name), fields: map[string]interface{}{}, repeated: map[string]bool{}}
+			for _, attr := range t.Attr {
+				e.fields["@"+xmlName(attr.Name)] = attr.Value
+			}
+			stack = append(stack, e)
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].text.Write(t)
+			}
+		case xml.EndElement:
+			if len(stack) == 0 {
+				return nil, errors.New("parsing XML: unexpected closing tag")
+			}
+			e := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			var value interface{} = e.fields
+			text := strings.TrimSpace(e.text.String())
+			switch {
+			case len(e.fields) == 0 && !e.children:
+				value = text
+			case text != "":
+				e.fields["#text"] = text
+			}
+			if len(stack) == 0 {
+				return json.Marshal(map[string]interface{}{e.name: value})
+			}
+			parent := stack[len(stack)-1]
+			parent.children = true
+			existing, seen := parent.fields[e.name]
+			switch {
+			case !seen:
+				parent.fields[e.name] = value
+			case parent.repeated[e.name]:
+				parent.fields[e.name] = append(existing.([]interface{}), value)
+			default:
+				parent.fields[e.name] = []interface{}{existing, value}
+				parent.repeated[e.name] = true
+			}
+		}
+	}
+	return nil, errors.New("parsing XML: no root element")
+}
+
+// convertXMLResult returns a copy of result with its XML body converted to
+// JSON by xmlToJSON.
+func convertXMLResult(result *ExecutionResult) (*ExecutionResult, error) {
+	body, err := xmlToJSON(result.Body)
+	if err != nil {
+		return nil, fmt.Errorf("converting response body: %w", err)
+	}
+	converted := *result
+	converted.Body = body
+	converted.Headers = http.Header{}
+	for key, values := range result.Headers {
+		converted.Headers[key] = values
+	}
+	converted.Headers.Set("Content-Type", "application/json")
+	return &converted, nil
+}
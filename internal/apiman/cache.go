@@ -0,0 +1,264 @@
+// cache.go
+package apiman
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Requests with "cache": true, or run with --cache, keep their GET and HEAD
+// responses that carry an ETag or Last-Modified in .api-man/cache/, one file
+// per request, environment and URL, and per value of the request headers a
+// response's Vary header names. Later runs send those validators back as
+// If-None-Match and If-Modified-Since, and when the server answers 304 Not
+// Modified the stored response is served instead, with " (cached)" after its
+// status. Requests setting either header themselves are sent as they are, so
+// a server's conditional handling can still be tested by hand.
+
+// CachedResponse is a response kept for revalidation. Headers and Body are
+// as received, before any Content-Encoding was decoded.
+type CachedResponse struct {
+	Request     string      `json:"request"`
+	Environment string      `json:"environment"`
+	Method      string      `json:"method"`
+	URL         string      `json:"url"`
+	Status      string      `json:"status"`
+	StatusCode  int         `json:"statusCode"`
+	Headers     http.Header `json:"headers"`
+	Body        []byte      `json:"body"`
+	Stored      time.Time   `json:"stored"`
+	// Vary holds the values the request sent for the headers named by the
+	// response's Vary header; the response only serves requests sending
+	// the same.
+	Vary map[string]string `json:"vary,omitempty"`
+}
+
+func (cm *ConfigManager) cacheDir() string {
+	return filepath.Join(cm.stateDir(), "cache")
+}
+
+// cacheKey names the cache files of the responses to prepared.
+func cacheKey(prepared *PreparedRequest) string {
+	key := strings.Join([]string{prepared.Path, prepared.Environment, prepared.Request.Method, prepared.Request.URL.String()}, "\n")
+	return sha256Hex([]byte(key))[:32]
+}
+
+// cacheFile is where the response to prepared varying on vary is kept.
+func (cm *ConfigManager) cacheFile(prepared *PreparedRequest, vary map[string]string) string {
+	name := cacheKey(prepared)
+	if len(vary) > 0 {
+		var values []string
+		for _, header := range sortedKeys(vary) {
+			values = append(values, header+": "+vary[header])
+		}
+		name += "-" + sha256Hex([]byte(strings.Join(values, "\n")))[:16]
+	}
+	return filepath.Join(cm.cacheDir(), name+".json")
+}
+
+// varyValues returns the values req sends for the headers named by the Vary
+// header in headers. It reports false for "Vary: *", whose responses can't
+// be reused.
+func varyValues(req *http.Request, headers http.Header) (map[string]string, bool) {
+	names := headerList(headers, "Vary")
+	if len(names) == 0 {
+		return nil, true
+	}
+	values := make(map[string]string, len(names))
+	for _, name := range names {
+		if name == "*" {
+			return nil, false
+		}
+		name = http.CanonicalHeaderKey(name)
+		values[name] = strings.Join(req.Header.Values(name), ", ")
+	}
+	return values, true
+}
+
+// matchesVary reports whether req sends the header values cached varied on.
+func (cached *CachedResponse) matchesVary(req *http.Request) bool {
+	for name, value := range cached.Vary {
+		if strings.Join(req.Header.Values(name), ", ") != value {
+			return false
+		}
+	}
+	return true
+}
+
+// usesCache reports whether prepared goes through the response cache.
+func usesCache(prepared *PreparedRequest, opts RequestOptions) bool {
+	if !opts.Cache && !prepared.Config.Cache {
+		return false
+	}
+	req := prepared.Request
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return false
+	}
+	return req.Header.Get("If-None-Match") == "" && req.Header.Get("If-Modified-Since") == ""
+}
+
+// revalidate loads the cached response to prepared, if there is one, and
+// adds its validators to the request. A cache file that can't be read is
+// treated as missing; api-man doctor reports it.
+func (cm *ConfigManager) revalidate(prepared *PreparedRequest) *CachedResponse {
+	files, err := filepath.Glob(filepath.Join(cm.cacheDir(), cacheKey(prepared)+"*.json"))
+	if err != nil {
+		return nil
+	}
+	var cached *CachedResponse
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		var candidate CachedResponse
+		if json.Unmarshal(data, &candidate) == nil && candidate.matchesVary(prepared.Request) {
+			cached = &candidate
+			break
+		}
+	}
+	if cached == nil {
+		return nil
+	}
+	if etag := cached.Headers.Get("ETag"); etag != "" {
+		prepared.Request.Header.Set("If-None-Match", etag)
+	}
+	if modified := cached.Headers.Get("Last-Modified"); modified != "" {
+		prepared.Request.Header.Set("If-Modified-Since", modified)
+	}
+	return cached
+}
+
+// applyCache serves cached, the response revalidate found, when result is
+// a 304 Not Modified, and otherwise keeps result for the next run when it
+// can be revalidated. result must not have been decoded yet. Failures to
+// write the cache never fail the request, so they are only reported.
+func (cm *ConfigManager) applyCache(prepared *PreparedRequest, cached *CachedResponse, result *ExecutionResult) {
+	var err error
+	switch {
+	case result.StatusCode == http.StatusNotModified && cached != nil:
+		// A 304 updates the stored headers, e.g. Date and a new Expires.
+		headers := cached.Headers.Clone()
+		for name, values := range result.Headers {
+			if name != "Content-Length" {
+				headers[name] = values
+			}
+		}
+		result.Status = cached.Status + " (cached)"
+		result.StatusCode = cached.StatusCode
+		result.Headers = headers
+		result.Body = cached.Body
+		result.Cached = true
+		cached.Headers = headers
+		err = cm.storeCachedResponse(cm.cacheFile(prepared, cached.Vary), cached)
+	case result.StatusCode != http.StatusOK:
+		// Errors leave the cached response for the next run.
+	default:
+		err = cm.replaceCachedResponse(prepared, cached, result)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: caching response: %v\n", err)
+	}
+}
+
+// replaceCachedResponse keeps result, a 200, in place of cached when it can
+// be revalidated, and otherwise drops cached.
+func (cm *ConfigManager) replaceCachedResponse(prepared *PreparedRequest, cached *CachedResponse, result *ExecutionResult) error {
+	vary, reusable := varyValues(prepared.Request, result.Headers)
+	if result.Headers.Get("ETag") == "" && result.Headers.Get("Last-Modified") == "" || hasDirective(result.Headers, "no-store") {
+		reusable = false
+	}
+	file := cm.cacheFile(prepared, vary)
+	if cached != nil && (!reusable || cm.cacheFile(prepared, cached.Vary) != file) {
+		// The server no longer allows caching, or varies on other headers.
+		if err := os.Remove(cm.cacheFile(prepared, cached.Vary)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if !reusable {
+		return nil
+	}
+	return cm.storeCachedResponse(file, &CachedResponse{
+		Request:     prepared.Path,
+		Environment: prepared.Environment,
+		Method:      result.Method,
+		URL:         result.URL,
+		Status:      result.Status,
+		StatusCode:  result.StatusCode,
+		Headers:     result.Headers,
+		Body:        result.Body,
+		Stored:      time.Now().UTC(),
+		Vary:        vary,
+	})
+}
+
+func (cm *ConfigManager) storeCachedResponse(file string, cached *CachedResponse) error {
+	if err := os.MkdirAll(cm.cacheDir(), 0755); err != nil {
+		return err
+	}
+	return writeJSONFileAtomic(file, cached, 0644)
+}
+
+// hasDirective reports whether the Cache-Control header has directive.
+func hasDirective(headers http.Header, directive string) bool {
+	_, ok := parseCacheControl(headers)[directive]
+	return ok
+}
+
+// CachedResponses returns the responses in the cache, by request and
+// environment.
+func (cm *ConfigManager) CachedResponses() ([]*CachedResponse, error) {
+	files, err := filepath.Glob(filepath.Join(cm.cacheDir(), "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var responses []*CachedResponse
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("reading cache: %w", err)
+		}
+		var cached CachedResponse
+		if err := json.Unmarshal(data, &cached); err != nil {
+			continue
+		}
+		responses = append(responses, &cached)
+	}
+	slices.SortFunc(responses, func(a, b *CachedResponse) int {
+		return strings.Compare(a.Request+"\n"+a.Environment+"\n"+a.URL, b.Request+"\n"+b.Environment+"\n"+b.URL)
+	})
+	return responses, nil
+}
+
+// ClearCache removes the cached responses to requestPath, or every cached
+// response when it is "", and reports how many there were.
+func (cm *ConfigManager) ClearCache(requestPath string) (int, error) {
+	files, err := filepath.Glob(filepath.Join(cm.cacheDir(), "*.json"))
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, file := range files {
+		if requestPath != "" {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return n, fmt.Errorf("reading cache: %w", err)
+			}
+			var cached CachedResponse
+			if json.Unmarshal(data, &cached) == nil && cached.Request != requestPath {
+				continue
+			}
+		}
+		if err := os.Remove(file); err != nil {
+			return n, fmt.Errorf("clearing cache: %w", err)
+		}
+		n++
+	}
+	return n, nil
+}
@@ -0,0 +1,113 @@
+package apiman
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newCacheTestWorkspace returns a workspace whose dev environment points at
+// handler and which has a cached GET request named "greeting".
+func newCacheTestWorkspace(t *testing.T, handler http.HandlerFunc) *ConfigManager {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	cm, err := InitWorkspace(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cm.SaveEnvironment("dev", Environment{BaseURL: server.URL}); err != nil {
+		t.Fatal(err)
+	}
+	if err := cm.SaveRequest("greeting", RequestConfig{Method: "GET", URL: "/greeting", Cache: true}); err != nil {
+		t.Fatal(err)
+	}
+	return cm
+}
+
+func TestCacheServesNotModifiedWithCachedStatus(t *testing.T) {
+	cm := newCacheTestWorkspace(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Write([]byte("hello"))
+	})
+
+	first, err := cm.RunRequest("greeting", "dev", RequestOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Cached || first.StatusCode != http.StatusOK {
+		t.Fatalf("first run: status %d, cached %v", first.StatusCode, first.Cached)
+	}
+
+	second, err := cm.RunRequest("greeting", "dev", RequestOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !second.Cached || second.StatusCode != http.StatusOK || string(second.Body) != "hello" {
+		t.Errorf("second run: status %d %q, cached %v, body %q", second.StatusCode, second.Status, second.Cached, second.Body)
+	}
+	if second.Status != "200 OK (cached)" {
+		t.Errorf("second run status %q", second.Status)
+	}
+}
+
+func TestCacheKeepsVariantsApart(t *testing.T) {
+	bodies := map[string]string{"en": "hello", "fr": "bonjour"}
+	cm := newCacheTestWorkspace(t, func(w http.ResponseWriter, r *http.Request) {
+		lang := r.Header.Get("Accept-Language")
+		etag := `"` + lang + `"`
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Vary", "Accept-Language")
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Write([]byte(bodies[lang]))
+	})
+	run := func(lang string) *ExecutionResult {
+		t.Helper()
+		result, err := cm.RunRequest("greeting", "dev", RequestOptions{Headers: map[string]string{"Accept-Language": lang}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(result.Body) != bodies[lang] {
+			t.Fatalf("Accept-Language %s: got %q", lang, result.Body)
+		}
+		return result
+	}
+
+	if run("en").Cached {
+		t.Error("en served from an empty cache")
+	}
+	if run("fr").Cached {
+		t.Error("fr served from the en response")
+	}
+	if !run("en").Cached || !run("fr").Cached {
+		t.Error("variants not revalidated from the cache")
+	}
+	files, _ := filepath.Glob(filepath.Join(cm.cacheDir(), "*.json"))
+	if len(files) != 2 {
+		t.Errorf("%d cache files, want one per variant", len(files))
+	}
+}
+
+func TestCacheSkipsVaryStar(t *testing.T) {
+	cm := newCacheTestWorkspace(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Vary", "*")
+		w.Write([]byte("hello"))
+	})
+	if _, err := cm.RunRequest("greeting", "dev", RequestOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := os.ReadDir(cm.cacheDir()); len(entries) != 0 {
+		t.Errorf("Vary: * response cached")
+	}
+}
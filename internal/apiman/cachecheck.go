@@ -0,0 +1,338 @@
+// cachecheck.go
+package apiman
+
+import (
+	"cmp"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// CachingAssertions check a response's caching headers, e.g. that a CDN
+// serves it with the intended Cache-Control:
+//
+//	"caching": {
+//	  "cacheControl": ["public", "max-age>=300", "!no-store"],
+//	  "vary": ["Accept-Encoding", "!Cookie"],
+//	  "age": ">0",
+//	  "etag": true,
+//	  "stableETag": true
+//	}
+type CachingAssertions struct {
+	// CacheControl lists directives the Cache-Control header must have:
+	// "public", "max-age=600", a bound such as "max-age>=300" or
+	// "s-maxage<86400", or "!no-store" for one it must not have.
+	CacheControl []string `json:"cacheControl,omitempty" yaml:"cacheControl,omitempty"`
+	// Vary lists header names the Vary header must include, or with a
+	// leading ! must not.
+	Vary []string `json:"vary,omitempty" yaml:"vary,omitempty"`
+	// Age bounds the Age header in seconds, e.g. ">0" for a response
+	// served from a cache or "<=60".
+	Age string `json:"age,omitempty" yaml:"age,omitempty"`
+	// ETag requires an ETag header when true and none when false.
+	ETag *bool `json:"etag,omitempty" yaml:"etag,omitempty"`
+	// StableETag sends the request again and requires the same ETag, as
+	// every origin and edge behind a CDN should give.
+	StableETag bool `json:"stableETag,omitempty" yaml:"stableETag,omitempty"`
+}
+
+// directivePattern splits a cacheControl entry into its directive, an
+// optional comparison and the value compared with.
+var directivePattern = regexp.MustCompile(`^([A-Za-z-]+)\s*(?:(<=|>=|<|>|=)\s*(\S+))?$`)
+
+// boundPattern is an age bound: an optional comparison and seconds.
+var boundPattern = regexp.MustCompile(`^(<=|>=|<|>|=)?\s*(\d+)$`)
+
+// parseCacheControl returns the directives of the Cache-Control header by
+// lower-cased name, with their unquoted values ("" for none).
+func parseCacheControl(headers http.Header) map[string]string {
+	directives := make(map[string]string)
+	for _, value := range headers.Values("Cache-Control") {
+		for _, directive := range strings.Split(value, ",") {
+			name, value, _ := strings.Cut(directive, "=")
+			if name = strings.ToLower(strings.TrimSpace(name)); name != "" {
+				directives[name] = strings.Trim(strings.TrimSpace(value), `"`)
+			}
+		}
+	}
+	return directives
+}
+
+// headerList returns the comma-separated values of a header such as Vary.
+func headerList(headers http.Header, name string) []string {
+	var list []string
+	for _, value := range headers.Values(name) {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+	}
+	return list
+}
+
+// compareBound reports whether got op want holds; an empty op is equality.
+func compareBound(got int64, op string, want int64) bool {
+	switch op {
+	case "<":
+		return got < want
+	case "<=":
+		return got <= want
+	case ">":
+		return got > want
+	case ">=":
+		return got >= want
+	}
+	return got == want
+}
+
+// evaluate runs the checks Evaluate can make on result alone; StableETag
+// needs the request sent again (see ConfigManager.evaluateAssertions).
+func (c *CachingAssertions) evaluate(result *ExecutionResult) []AssertionResult {
+	var results []AssertionResult
+	cacheControl := strings.Join(result.Headers.Values("Cache-Control"), ", ")
+	directives := parseCacheControl(result.Headers)
+	got := fmt.Sprintf("got %q", cacheControl)
+	if cacheControl == "" {
+		got = "no Cache-Control header"
+	}
+	for _, entry := range c.CacheControl {
+		entry = strings.TrimSpace(entry)
+		name := "Cache-Control has " + entry
+		if absent, ok := strings.CutPrefix(entry, "!"); ok {
+			_, found := directives[strings.ToLower(strings.TrimSpace(absent))]
+			results = append(results, check("Cache-Control has no "+strings.TrimSpace(absent), !found, "%s", got))
+			continue
+		}
+		match := directivePattern.FindStringSubmatch(entry)
+		if match == nil {
+			results = append(results, AssertionResult{Name: name, Message: "invalid directive, e.g. max-age>=300 or !no-store"})
+			continue
+		}
+		value, found := directives[strings.ToLower(match[1])]
+		switch op, want := match[2], match[3]; {
+		case op == "":
+			results = append(results, check(name, found, "%s", got))
+		case op == "=" && !isDigits(want):
+			results = append(results, check(name, found && strings.EqualFold(value, want), "%s", got))
+		default:
+			wantSeconds, err := strconv.ParseInt(want, 10, 64)
+			if err != nil {
+				results = append(results, AssertionResult{Name: name, Message: "bounds need a number of seconds"})
+				continue
+			}
+			seconds, err := strconv.ParseInt(value, 10, 64)
+			results = append(results, check(name, found && err == nil && compareBound(seconds, op, wantSeconds), "%s", got))
+		}
+	}
+
+	vary := headerList(result.Headers, "Vary")
+	for _, entry := range c.Vary {
+		entry = strings.TrimSpace(entry)
+		if absent, ok := strings.CutPrefix(entry, "!"); ok {
+			absent = strings.TrimSpace(absent)
+			found := slices.ContainsFunc(vary, func(v string) bool { return strings.EqualFold(v, absent) })
+			results = append(results, check("Vary excludes "+absent, !found, "got %q", strings.Join(vary, ", ")))
+			continue
+		}
+		found := slices.ContainsFunc(vary, func(v string) bool { return strings.EqualFold(v, entry) })
+		results = append(results, check("Vary includes "+entry, found, "got %q", strings.Join(vary, ", ")))
+	}
+
+	if c.Age != "" {
+		name := "Age " + c.Age
+		if match := boundPattern.FindStringSubmatch(strings.TrimSpace(c.Age)); match == nil {
+			results = append(results, AssertionResult{Name: name, Message: "invalid bound, e.g. >0 or <=60"})
+		} else if header := result.Headers.Get("Age"); header == "" {
+			results = append(results, AssertionResult{Name: name, Message: "no Age header"})
+		} else {
+			want, _ := strconv.ParseInt(match[2], 10, 64)
+			age, err := strconv.ParseInt(strings.TrimSpace(header), 10, 64)
+			results = append(results, check(name, err == nil && compareBound(age, match[1], want), "got %s", header))
+		}
+	}
+
+	if c.ETag != nil {
+		etag := result.Headers.Get("ETag")
+		if *c.ETag {
+			results = append(results, check("ETag present", etag != "", "no ETag header"))
+		} else {
+			results = append(results, check("no ETag", etag == "", "got %s", etag))
+		}
+	}
+	return results
+}
+
+func isDigits(s string) bool {
+	_, err := strconv.ParseUint(s, 10, 64)
+	return err == nil
+}
+
+// evaluateAssertions is assertions.Evaluate plus the checks that send the
+// request again, with opts, which Evaluate can't.
+func (cm *ConfigManager) evaluateAssertions(assertions *Assertions, result *ExecutionResult, opts RequestOptions) []AssertionResult {
+	results := assertions.Evaluate(result)
+	if assertions != nil && assertions.Caching != nil && assertions.Caching.StableETag {
+		results = append(results, cm.checkStableETag(result, opts))
+	}
+	return results
+}
+
+// checkStableETag sends result's request again and checks it gets the
+// same ETag. A 304 to the If-None-Match sent by a cached request shows the
+// same.
+func (cm *ConfigManager) checkStableETag(result *ExecutionResult, opts RequestOptions) AssertionResult {
+	const name = "ETag stable across two requests"
+	first := result.Headers.Get("ETag")
+	if first == "" {
+		return AssertionResult{Name: name, Message: "no ETag header"}
+	}
+	if result.Method != http.MethodGet && result.Method != http.MethodHead {
+		return AssertionResult{Name: name, Message: "only GET and HEAD requests are sent again"}
+	}
+	opts.Progress = nil
+	again, err := cm.RunRequest(result.Request, result.Environment, opts)
+	if err != nil {
+		return AssertionResult{Name: name, Message: fmt.Sprintf("sending again: %v", err)}
+	}
+	second := again.Headers.Get("ETag")
+	return check(name, second == first, "got %s, then %s", first, cmp.Or(second, "none"))
+}
+
+// cacheStatusHeaders report how a CDN or proxy cache served a response.
+var cacheStatusHeaders = []string{"Cache-Status", "X-Cache", "X-Cache-Status", "CF-Cache-Status", "X-Cache-Hits", "X-Served-By", "Via"}
+
+// CachingReport summarises how a response may be cached, for api-man cache
+// check.
+type CachingReport struct {
+	Method       string            `json:"method"`
+	URL          string            `json:"url"`
+	Status       string            `json:"status"`
+	CacheControl string            `json:"cacheControl,omitempty"`
+	Directives   map[string]string `json:"directives,omitempty"`
+	// Age is the Age header in seconds, or -1 without one.
+	Age          int64             `json:"age"`
+	Vary         []string          `json:"vary,omitempty"`
+	ETag         string            `json:"etag,omitempty"`
+	LastModified string            `json:"lastModified,omitempty"`
+	Expires      string            `json:"expires,omitempty"`
+	CacheStatus  map[string]string `json:"cacheStatus,omitempty"`
+	// Revalidation is the status of the request sent again with the
+	// response's validators, and StableETag whether its ETag matched; both
+	// are empty when the request wasn't sent again.
+	Revalidation string `json:"revalidation,omitempty"`
+	StableETag   *bool  `json:"stableETag,omitempty"`
+	// Notes point out likely mistakes, e.g. a public response setting a
+	// cookie.
+	Notes      []string          `json:"notes,omitempty"`
+	Assertions []AssertionResult `json:"assertions,omitempty"`
+}
+
+// CheckCaching sends a request and, for GET and HEAD, sends it again with
+// its ETag and Last-Modified as If-None-Match and If-Modified-Since, then
+// reports the caching headers and how the server revalidated. The request's
+// caching assertions are checked against the first response.
+func (cm *ConfigManager) CheckCaching(requestPath, envName string, opts RequestOptions) (*CachingReport, error) {
+	first, err := cm.RunRequest(requestPath, envName, opts)
+	if err != nil {
+		return nil, err
+	}
+	report := &CachingReport{
+		Method:       first.Method,
+		URL:          first.URL,
+		Status:       first.Status,
+		CacheControl: strings.Join(first.Headers.Values("Cache-Control"), ", "),
+		Directives:   parseCacheControl(first.Headers),
+		Age:          -1,
+		Vary:         headerList(first.Headers, "Vary"),
+		ETag:         first.Headers.Get("ETag"),
+		LastModified: first.Headers.Get("Last-Modified"),
+		Expires:      first.Headers.Get("Expires"),
+	}
+	if age, err := strconv.ParseInt(strings.TrimSpace(first.Headers.Get("Age")), 10, 64); err == nil {
+		report.Age = age
+	}
+	for _, name := range cacheStatusHeaders {
+		if value := first.Headers.Get(name); value != "" {
+			if report.CacheStatus == nil {
+				report.CacheStatus = make(map[string]string)
+			}
+			report.CacheStatus[name] = value
+		}
+	}
+
+	if first.Method == http.MethodGet || first.Method == http.MethodHead {
+		again := opts
+		again.Progress = nil
+		again.Headers = mergeVariables(opts.Headers)
+		if report.ETag != "" {
+			again.Headers["If-None-Match"] = report.ETag
+		}
+		if report.LastModified != "" {
+			again.Headers["If-Modified-Since"] = report.LastModified
+		}
+		second, err := cm.RunRequest(requestPath, envName, again)
+		if err != nil {
+			return nil, fmt.Errorf("sending again: %w", err)
+		}
+		report.Revalidation = second.Status
+		if report.ETag != "" {
+			// A 304 to If-None-Match says the ETag still matches.
+			stable := second.StatusCode == http.StatusNotModified || second.Headers.Get("ETag") == report.ETag
+			report.StableETag = &stable
+		}
+	}
+	report.Notes = report.notes(first.Headers)
+
+	if config, err := cm.LoadRequest(requestPath); err == nil && config.Assertions != nil && config.Assertions.Caching != nil {
+		caching := config.Assertions.Caching
+		report.Assertions = caching.evaluate(first)
+		if caching.StableETag {
+			result := AssertionResult{Name: "ETag stable across two requests", Passed: report.StableETag != nil && *report.StableETag}
+			if !result.Passed {
+				result.Message = "the ETag changed or is missing"
+			}
+			report.Assertions = append(report.Assertions, result)
+		}
+	}
+	return report, nil
+}
+
+// notes points out caching headers that likely don't do what was meant.
+func (r *CachingReport) notes(headers http.Header) []string {
+	var notes []string
+	_, public := r.Directives["public"]
+	_, private := r.Directives["private"]
+	_, noStore := r.Directives["no-store"]
+	_, maxAge := r.Directives["max-age"]
+	_, sMaxAge := r.Directives["s-maxage"]
+	switch {
+	case r.CacheControl == "" && r.Expires == "":
+		notes = append(notes, "no Cache-Control or Expires: caches guess a lifetime from Last-Modified, if at all")
+	case noStore:
+		notes = append(notes, "no-store: nothing may keep this response")
+	case private:
+		notes = append(notes, "private: browsers may keep this response, CDNs and shared proxies may not")
+	case !maxAge && !sMaxAge && r.Expires == "":
+		notes = append(notes, "no max-age, s-maxage or Expires: caches guess how long the response stays fresh")
+	}
+	if public && headers.Get("Set-Cookie") != "" {
+		notes = append(notes, "a public response sets a cookie: a shared cache may hand it to other users")
+	}
+	if slices.Contains(r.Vary, "*") {
+		notes = append(notes, "Vary: * makes every request a cache miss")
+	}
+	if r.ETag == "" && r.LastModified == "" && !noStore {
+		notes = append(notes, "no ETag or Last-Modified: stale copies are fetched whole instead of revalidated")
+	}
+	if r.StableETag != nil && !*r.StableETag {
+		notes = append(notes, "the ETag changed between two requests: origins or edges may disagree, defeating revalidation")
+	}
+	if r.Revalidation != "" && (r.ETag != "" || r.LastModified != "") && !strings.HasPrefix(r.Revalidation, "304") {
+		notes = append(notes, "the conditional request got "+r.Revalidation+" instead of 304 Not Modified")
+	}
+	return notes
+}
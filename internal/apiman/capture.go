@@ -0,0 +1,227 @@
+// capture.go
+package apiman
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Capture rules copy response headers and cookies where later requests can
+// use them, complementing extract rules, which mostly read the body:
+//
+//	"capture": [
+//	  {"header": "X-CSRF-Token", "var": "csrf"},
+//	  {"cookie": "session", "jar": "session"}
+//	]
+//
+// "var" stores the value in the environment's variable store, as extract
+// does, and "jar" keeps it as a cookie in the environment's cookie jar,
+// .api-man/cookies/<env>.json, sent with every later request of the
+// environment that doesn't set the cookie itself.
+
+// CaptureRule copies one response header or cookie.
+type CaptureRule struct {
+	// Header or Cookie names what to capture: a response header, or a
+	// cookie set by the response's Set-Cookie headers.
+	Header string `json:"header,omitempty"`
+	Cookie string `json:"cookie,omitempty"`
+	// Var stores the value as {{Var}}.
+	Var string `json:"var,omitempty"`
+	// Jar keeps the value as the cookie Jar. A cookie the response
+	// expires is removed from the jar.
+	Jar string `json:"jar,omitempty"`
+	// Optional skips the rule when the response lacks the header or
+	// cookie instead of reporting it.
+	Optional bool `json:"optional,omitempty"`
+}
+
+func (r CaptureRule) describe() string {
+	if r.Cookie != "" {
+		return "cookie " + r.Cookie
+	}
+	return "header " + r.Header
+}
+
+// JarCookie is a cookie kept in an environment's cookie jar.
+type JarCookie struct {
+	Value string `json:"value"`
+	// Expires is when the cookie stops being sent; zero means never.
+	Expires time.Time `json:"expires,omitempty"`
+}
+
+// expired reports whether the cookie has expired at now.
+func (c JarCookie) expired(now time.Time) bool {
+	return !c.Expires.IsZero() && !now.Before(c.Expires)
+}
+
+// captureValues applies rules to a response, returning the variables to
+// store and the jar cookies to set; a nil jar cookie removes it. The values
+// captured before a failing rule are returned with the error.
+func captureValues(result *ExecutionResult, rules []CaptureRule) (map[string]string, map[string]*JarCookie, error) {
+	vars := make(map[string]string)
+	jar := make(map[string]*JarCookie)
+	cookies := (&http.Response{Header: result.Headers}).Cookies()
+	now := time.Now()
+	for _, rule := range rules {
+		if (rule.Header == "") == (rule.Cookie == "") {
+			return vars, jar, fmt.Errorf("capturing: a rule needs either a header or a cookie")
+		}
+		if rule.Var == "" && rule.Jar == "" {
+			return vars, jar, fmt.Errorf("capturing %s: the rule needs a var or a jar to copy it to", rule.describe())
+		}
+		var value JarCookie
+		found := false
+		if rule.Header != "" {
+			if values := result.Headers.Values(rule.Header); len(values) > 0 {
+				value.Value, found = values[0], true
+			}
+		} else {
+			// The last Set-Cookie for a name wins, as in a browser.
+			for _, cookie := range cookies {
+				if cookie.Name != rule.Cookie {
+					continue
+				}
+				value, found = JarCookie{Value: cookie.Value}, true
+				switch {
+				case cookie.MaxAge < 0:
+					value.Expires = now
+				case cookie.MaxAge > 0:
+					value.Expires = now.Add(time.Duration(cookie.MaxAge) * time.Second)
+				case !cookie.Expires.IsZero():
+					value.Expires = cookie.Expires
+				}
+			}
+		}
+		if !found {
+			if rule.Optional {
+				continue
+			}
+			return vars, jar, fmt.Errorf("capturing %s: the response has none", rule.describe())
+		}
+		if rule.Var != "" {
+			vars[rule.Var] = value.Value
+		}
+		if rule.Jar != "" {
+			if value.expired(now) {
+				jar[rule.Jar] = nil
+			} else {
+				jar[rule.Jar] = &value
+			}
+		}
+	}
+	return vars, jar, nil
+}
+
+func (cm *ConfigManager) cookieJarPath(envName string) string {
+	return filepath.Join(cm.stateDir(), "cookies", sanitizeRequestPathSegment(envName)+".json")
+}
+
+// JarCookies returns the cookies in envName's cookie jar, expired ones
+// included.
+func (cm *ConfigManager) JarCookies(envName string) (map[string]JarCookie, error) {
+	data, err := os.ReadFile(cm.cookieJarPath(envName))
+	if errors.Is(err, os.ErrNotExist) {
+		return map[string]JarCookie{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading cookie jar: %w", err)
+	}
+	cookies := map[string]JarCookie{}
+	if err := json.Unmarshal(data, &cookies); err != nil {
+		return nil, fmt.Errorf("parsing cookie jar: %w", err)
+	}
+	return cookies, nil
+}
+
+// storeJarCookies sets cookies in envName's jar, removing those that are
+// nil and any that have expired.
+func (cm *ConfigManager) storeJarCookies(envName string, cookies map[string]*JarCookie) error {
+	unlock, err := cm.lockState("cookies-" + envName)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	jar, err := cm.JarCookies(envName)
+	if err != nil {
+		return err
+	}
+	for name, cookie := range cookies {
+		if cookie == nil {
+			delete(jar, name)
+		} else {
+			jar[name] = *cookie
+		}
+	}
+	now := time.Now()
+	for name, cookie := range jar {
+		if cookie.expired(now) {
+			delete(jar, name)
+		}
+	}
+	return cm.writeCookieJar(envName, jar)
+}
+
+// ClearJarCookies removes names from envName's cookie jar, or every cookie
+// when no names are given.
+func (cm *ConfigManager) ClearJarCookies(envName string, names ...string) error {
+	if len(names) == 0 {
+		if err := os.Remove(cm.cookieJarPath(envName)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("removing cookie jar: %w", err)
+		}
+		return nil
+	}
+	unlock, err := cm.lockState("cookies-" + envName)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	jar, err := cm.JarCookies(envName)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if _, ok := jar[name]; !ok {
+			return fmt.Errorf("cookie %q is not in the jar for environment %q", name, envName)
+		}
+		delete(jar, name)
+	}
+	return cm.writeCookieJar(envName, jar)
+}
+
+func (cm *ConfigManager) writeCookieJar(envName string, jar map[string]JarCookie) error {
+	path := cm.cookieJarPath(envName)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("creating cookie jar directory: %w", err)
+	}
+	data, err := json.MarshalIndent(jar, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding cookie jar: %w", err)
+	}
+	// Captured cookies are usually sessions, so keep them private.
+	if err := writeFileAtomic(path, data, 0600); err != nil {
+		return fmt.Errorf("writing cookie jar: %w", err)
+	}
+	return nil
+}
+
+// applyJarCookies adds the unexpired cookies of envName's jar to req,
+// except those it already sends.
+func (cm *ConfigManager) applyJarCookies(req *http.Request, envName string) error {
+	jar, err := cm.JarCookies(envName)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, name := range sortedKeys(jar) {
+		if _, err := req.Cookie(name); err == nil || jar[name].expired(now) {
+			continue
+		}
+		req.AddCookie(&http.Cookie{Name: name, Value: jar[name].Value})
+	}
+	return nil
+}
@@ -0,0 +1,193 @@
+// chain.go
+package apiman
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Chain runs several requests in order, threading values extracted from one
+// response into the variables of the following requests. Chains live at
+// chains/<name>.json in the workspace:
+//
+//	{
+//	  "description": "Log in, then create a user with the session token",
+//	  "steps": [
+//	    {"request": "auth/login", "extract": {"token": "$.token"}},
+//	    {"request": "users/create-user", "extract": {"userId": "$.id"}},
+//	    {"request": "users/get-user", "variables": {"expand": "true"}}
+//	  ]
+//	}
+//
+// Extracted variables are referenced as {{token}} in the URL, headers or
+// body of later requests.
+type Chain struct {
+	Name        string            `json:"-"`
+	Description string            `json:"description,omitempty"`
+	Variables   map[string]string `json:"variables,omitempty"`
+	// SharedRequestID sends one correlation ID, generated when the chain
+	// starts, with every step instead of a fresh one per request (see
+	// Environment.RequestIDHeader). RequestID fixes that ID.
+	SharedRequestID bool        `json:"sharedRequestId,omitempty"`
+	RequestID       string      `json:"requestId,omitempty"`
+	Steps           []ChainStep `json:"steps"`
+}
+
+type ChainStep struct {
+	Request string `json:"request"`
+	// Variables are set before this step runs, on top of everything
+	// extracted so far.
+	Variables map[string]string `json:"variables,omitempty"`
+	// Extract maps variable names to extraction rules (see
+	// extractVariables) evaluated against this step's response.
+	Extract map[string]string `json:"extract,omitempty"`
+	// ContinueOnError keeps the chain going after a 4xx/5xx response.
+	ContinueOnError bool `json:"continueOnError,omitempty"`
+}
+
+// ChainResult records the outcome of every executed step.
+type ChainResult struct {
+	Chain     string            `json:"chain"`
+	Passed    bool              `json:"passed"`
+	Steps     []ChainStepResult `json:"steps"`
+	Variables map[string]string `json:"variables"`
+}
+
+type ChainStepResult struct {
+	Request    string            `json:"request"`
+	RequestID  string            `json:"requestId,omitempty"`
+	StatusCode int               `json:"statusCode,omitempty"`
+	DurationMS int64             `json:"durationMs"`
+	Extracted  map[string]string `json:"extracted,omitempty"`
+	Error      string            `json:"error,omitempty"`
+}
+
+func (cm *ConfigManager) chainsDir() string {
+	return filepath.Join(cm.configDir, "chains")
+}
+
+// ListChains returns the names of every chain file in chains/.
+func (cm *ConfigManager) ListChains() ([]string, error) {
+	entries, err := os.ReadDir(cm.chainsDir())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("reading chains directory: %w", err)
+	}
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".json") {
+			names = append(names, strings.TrimSuffix(entry.Name(), ".json"))
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// LoadChain reads chains/<name>.json.
+func (cm *ConfigManager) LoadChain(name string) (*Chain, error) {
+	data, err := os.ReadFile(filepath.Join(cm.chainsDir(), name+".json"))
+	if err != nil {
+		return nil, fmt.Errorf("reading chain file: %w", err)
+	}
+	var chain Chain
+	if err := json.Unmarshal(data, &chain); err != nil {
+		return nil, fmt.Errorf("parsing chain file: %w", err)
+	}
+	if len(chain.Steps) == 0 {
+		return nil, fmt.Errorf("chain %q has no steps", name)
+	}
+	for i, step := range chain.Steps {
+		if step.Request == "" {
+			return nil, fmt.Errorf("chain %q: step %d is missing request", name, i+1)
+		}
+	}
+	chain.Name = name
+	return &chain, nil
+}
+
+// RunChain executes a chain's steps in order against envName. Each step
+// sees the chain's variables plus everything extracted by earlier steps.
+// The chain stops at the first transport error, failed extraction or (unless
+// the step opts out) 4xx/5xx response.
+func (cm *ConfigManager) RunChain(chain *Chain, envName string, out io.Writer) *ChainResult {
+	vars := mergeVariables(chain.Variables)
+	result := &ChainResult{Chain: chain.Name, Passed: true}
+	requestID := chain.RequestID
+	if requestID == "" && chain.SharedRequestID {
+		requestID = newUUID()
+	}
+
+	for _, step := range chain.Steps {
+		stepResult := ChainStepResult{Request: step.Request}
+		maps.Copy(vars, step.Variables)
+
+		exec, err := cm.RunRequest(step.Request, envName, RequestOptions{Variables: vars, RequestID: requestID})
+		if err != nil {
+			stepResult.Error = err.Error()
+		} else {
+			stepResult.RequestID = exec.RequestID
+			stepResult.StatusCode = exec.StatusCode
+			stepResult.DurationMS = exec.DurationMS()
+			if exec.StatusCode >= 400 && !step.ContinueOnError {
+				stepResult.Error = fmt.Sprintf("request returned %s", exec.Status)
+			}
+			// Variables exported by hooks are available to later steps.
+			maps.Copy(vars, exec.Variables)
+			if stepResult.Error == "" && len(step.Extract) > 0 {
+				extracted, err := extractVariables(exec, step.Extract)
+				if err != nil {
+					stepResult.Error = err.Error()
+				}
+				stepResult.Extracted = extracted
+				maps.Copy(vars, extracted)
+			}
+		}
+
+		printChainStep(out, stepResult)
+		result.Steps = append(result.Steps, stepResult)
+		if stepResult.Error != "" {
+			result.Passed = false
+			break
+		}
+	}
+
+	result.Variables = vars
+	return result
+}
+
+func printChainStep(out io.Writer, step ChainStepResult) {
+	marker := "✓"
+	if step.Error != "" {
+		marker = "✗"
+	}
+	if step.StatusCode != 0 {
+		fmt.Fprintf(out, "%s %s %d (%dms)", marker, step.Request, step.StatusCode, step.DurationMS)
+		if step.RequestID != "" {
+			fmt.Fprintf(out, " [%s]", step.RequestID)
+		}
+		fmt.Fprintln(out)
+	} else {
+		fmt.Fprintf(out, "%s %s\n", marker, step.Request)
+	}
+	for _, name := range sortedKeys(step.Extracted) {
+		fmt.Fprintf(out, "    %s = %s\n", name, truncateForDisplay(step.Extracted[name], 60))
+	}
+	if step.Error != "" {
+		fmt.Fprintf(out, "    %s\n", step.Error)
+	}
+}
+
+func truncateForDisplay(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	return s[:max-3] + "..."
+}
@@ -0,0 +1,455 @@
+// cli.go
+package apiman
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/termenv"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+	"google.golang.org/grpc/codes"
+)
+
+// Exit codes: 0 when a command succeeds, 1 when it fails (including failed
+// tests, assertions and diffs), 2 when it is called wrongly and 130 when a
+// request is cancelled with Ctrl+C. api-man run tells apart requests that
+// got no response (3, or 6 when they timed out) and, with --fail, 4xx and
+// 5xx responses (4 and 5) and failed assertions (7).
+const (
+	exitFailure     = 1
+	exitUsage       = 2
+	exitNetwork     = 3
+	exitClientError = 4
+	exitServerError = 5
+	exitTimeout     = 6
+	exitAssertion   = 7
+	exitCancelled   = 130
+)
+
+// globalOptions holds the flags every command accepts besides --workspace
+// and --project, which set workspaceFlag and projectFlag.
+var globalOptions struct {
+	output  string
+	verbose bool
+	noColor bool
+	yes     bool
+}
+
+// exitCode ends a command with a non-zero exit code without printing an
+// error, for commands that have already reported why, such as failed tests.
+type exitCode int
+
+func (c exitCode) Error() string {
+	return fmt.Sprintf("exit status %d", int(c))
+}
+
+// usageError is an error in how a command was called: a missing argument,
+// an unknown flag or flags that don't go together.
+type usageError struct {
+	err error
+}
+
+func (e *usageError) Error() string { return e.err.Error() }
+func (e *usageError) Unwrap() error { return e.err }
+
+func usageErrorf(format string, args ...interface{}) error {
+	return &usageError{fmt.Errorf(format, args...)}
+}
+
+// codedError is an error printed like any other that ends the command with
+// its own exit code.
+type codedError struct {
+	err  error
+	code int
+}
+
+func (e *codedError) Error() string { return e.err.Error() }
+func (e *codedError) Unwrap() error { return e.err }
+
+// requestExitCode is the exit code for a request that failed with err:
+// exitTimeout or exitNetwork when no response came back, else exitFailure.
+func requestExitCode(err error) int {
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return exitTimeout
+	}
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) || errors.As(err, &netErr) {
+		return exitNetwork
+	}
+	return exitFailure
+}
+
+// responseExitCode is the exit code run --fail ends with after result: 0
+// for a 2xx response, exitClientError or exitServerError for 4xx and 5xx
+// and exitFailure for anything else. A gRPC status other than OK counts as
+// a failure, or as a timeout or network error for DEADLINE_EXCEEDED and
+// UNAVAILABLE.
+func responseExitCode(result *ExecutionResult) int {
+	code := result.StatusCode
+	if result.Method == "GRPC" {
+		switch codes.Code(code) {
+		case codes.OK:
+			return 0
+		case codes.DeadlineExceeded:
+			return exitTimeout
+		case codes.Unavailable:
+			return exitNetwork
+		}
+		return exitFailure
+	}
+	switch {
+	case code >= 200 && code < 300:
+		return 0
+	case code >= 400 && code < 500:
+		return exitClientError
+	case code >= 500 && code < 600:
+		return exitServerError
+	}
+	return exitFailure
+}
+
+// Execute runs the api-man command line named by args (without the program
+// name) and returns the process exit code. Errors are printed once here, so
+// commands just return them.
+func Execute(args []string) int {
+	root := newRootCommand()
+	root.SetArgs(args)
+	cmd, err := root.ExecuteC()
+	if err == nil {
+		return 0
+	}
+	var code exitCode
+	if errors.As(err, &code) {
+		return int(code)
+	}
+	fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	var usage *usageError
+	if errors.As(err, &usage) {
+		fmt.Fprintf(os.Stderr, "Run '%s --help' for usage.\n", cmd.CommandPath())
+		return exitUsage
+	}
+	var coded *codedError
+	if errors.As(err, &coded) {
+		return coded.code
+	}
+	return exitFailure
+}
+
+func newRootCommand() *cobra.Command {
+	root := &cobra.Command{
+		Use:   "api-man",
+		Short: "Filesystem-based API request management tool",
+		Long: `API-Man - Filesystem-based API request management tool
+
+Workspace:
+  Commands use the nearest directory at or above the current one containing
+  api-man.json (created by init), falling back to ~/.api-man. Override with
+  --workspace <dir> or APIMAN_WORKSPACE.
+
+Exit codes:
+  0 on success, 1 when a command fails (including failed tests, assertions
+  and diffs) and 2 when it is called wrongly. run exits with 3 when a request
+  gets no response and 6 when it times out; with --fail, also with 4 and 5
+  for 4xx and 5xx responses and 7 when the request's assertions fail.`,
+		Example: `  api-man init
+  api-man generate openapi.yaml
+  api-man run users/get-users dev
+  api-man web 8080
+  api-man body set users/post-user admin`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 {
+				return nil
+			}
+			err := usageErrorf("unknown command %q", args[0])
+			if suggestions := cmd.SuggestionsFor(args[0]); len(suggestions) > 0 {
+				err = usageErrorf("unknown command %q (did you mean %s?)", args[0], strings.Join(suggestions, " or "))
+			}
+			return err
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// Inside a workspace on a terminal, open the TUI instead of usage.
+			if inWorkspace() && term.IsTerminal(int(os.Stdout.Fd())) {
+				return startTUI(cmd, args)
+			}
+			cmd.Help()
+			return exitCode(exitUsage)
+		},
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			return applyGlobalFlags()
+		},
+		SilenceErrors: true,
+		SilenceUsage:  true,
+	}
+	root.SuggestionsMinimumDistance = 2
+	root.SetFlagErrorFunc(func(cmd *cobra.Command, err error) error {
+		return &usageError{err}
+	})
+
+	flags := root.PersistentFlags()
+	flags.StringVarP(&workspaceFlag, "workspace", "w", "", "use the workspace in `dir` (default: found from the current directory)")
+	flags.StringVar(&projectFlag, "project", "", "use the workspace registered as project `name` (see api-man project)")
+	flags.StringVarP(&globalOptions.output, "output", "o", "pretty", "output `format`: "+strings.Join(outputFormats, ", ")+" (listings support pretty and json)")
+	flags.BoolVarP(&globalOptions.verbose, "verbose", "v", false, "print the workspace used and, for run, the request sent")
+	flags.BoolVar(&globalOptions.noColor, "no-color", false, "disable colored output (also set by NO_COLOR)")
+	flags.BoolVarP(&globalOptions.yes, "yes", "y", false, "send requests the environment wants confirmed without asking")
+	root.RegisterFlagCompletionFunc("output", cobra.FixedCompletions(outputFormats, cobra.ShellCompDirectiveNoFileComp))
+	root.RegisterFlagCompletionFunc("workspace", func(cmd *cobra.Command, args []string, toComplete string) ([]cobra.Completion, cobra.ShellCompDirective) {
+		return nil, cobra.ShellCompDirectiveFilterDirs
+	})
+	root.RegisterFlagCompletionFunc("project", completeArgs(argProject))
+
+	root.AddGroup(
+		&cobra.Group{ID: "requests", Title: "Requests:"},
+		&cobra.Group{ID: "testing", Title: "Testing:"},
+		&cobra.Group{ID: "workspace", Title: "Workspace:"},
+	)
+	addCommands(root, "requests",
+		newRunCommand(), newRunAllCommand(), newListCommand(), newSearchCommand(),
+		newRequestFileCommand("rm"), newRequestFileCommand("mv"), newRequestFileCommand("cp"),
+		newEnvsCommand(), newBodyCommand(), newNotesCommand(), newExampleCommand(),
+		newVarsCommand(), newCookiesCommand(), newSecretCommand(),
+		newHistoryCommand(), newCacheCommand(), newGenerateCommand(), newImportCommand(), newExportCommand(),
+		newOpenAPICommand(), newGRPCCommand(), newProxyCommand(),
+	)
+	addCommands(root, "testing",
+		newTestCommand(), newSuiteCommand(), newChainCommand(), newDiffCommand(), newReplayCommand(), newContractCommand(),
+		newLoadCommand(), newWatchCommand(), newMetricsCommand(), newCICommand(),
+	)
+	addCommands(root, "workspace",
+		newInitCommand(), newProjectCommand(), newMigrateCommand(), newConvertCommand(), newSyncCommand(), newRemoteCommand(),
+		newLintCommand(), newDoctorCommand(), newDocsCommand(), newTUICommand(), newWebCommand(),
+	)
+	root.SetCompletionCommandGroupID("workspace")
+	root.SetHelpCommandGroupID("workspace")
+	return root
+}
+
+func addCommands(parent *cobra.Command, group string, commands ...*cobra.Command) {
+	for _, cmd := range commands {
+		cmd.GroupID = group
+		parent.AddCommand(cmd)
+	}
+}
+
+// applyGlobalFlags checks the global flags and applies --no-color.
+func applyGlobalFlags() error {
+	if !slices.Contains(outputFormats, globalOptions.output) {
+		return usageErrorf("unknown output format %q (expected one of %s)", globalOptions.output, strings.Join(outputFormats, ", "))
+	}
+	if projectFlag != "" {
+		if workspaceFlag != "" {
+			return usageErrorf("--workspace and --project cannot be used together")
+		}
+		if _, err := projectWorkspace(false); err != nil {
+			return err
+		}
+	}
+	if globalOptions.noColor || os.Getenv("NO_COLOR") != "" {
+		globalOptions.noColor = true
+		lipgloss.SetColorProfile(termenv.Ascii)
+	}
+	return nil
+}
+
+// groupCommand returns a command that only holds subcommands. Called
+// without one it prints its help; with an unknown one it fails.
+func groupCommand(use, short string, subcommands ...*cobra.Command) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   use,
+		Short: short,
+		Args:  cobra.ArbitraryArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 {
+				cmd.Help()
+				return exitCode(exitUsage)
+			}
+			return usageErrorf("unknown %s command %q", cmd.Name(), args[0])
+		},
+	}
+	cmd.AddCommand(subcommands...)
+	return cmd
+}
+
+// argsBetween accepts min to max positional arguments; max < 0 means no
+// upper limit.
+func argsBetween(min, max int) cobra.PositionalArgs {
+	return func(cmd *cobra.Command, args []string) error {
+		switch {
+		case len(args) < min:
+			return usageErrorf("%s needs %d argument(s), got %d", cmd.CommandPath(), min, len(args))
+		case max >= 0 && len(args) > max:
+			return usageErrorf("%s takes at most %d argument(s), got %d", cmd.CommandPath(), max, len(args))
+		}
+		return nil
+	}
+}
+
+func exactArgs(n int) cobra.PositionalArgs {
+	return argsBetween(n, n)
+}
+
+// openWorkspace opens the workspace a command operates on.
+func openWorkspace() (*ConfigManager, error) {
+	cm, err := NewConfigManager()
+	if err != nil {
+		return nil, fmt.Errorf("initializing config manager: %w", err)
+	}
+	if globalOptions.verbose {
+		fmt.Fprintf(os.Stderr, "Using workspace %s\n", cm.configDir)
+	}
+	cm.assumeYes = globalOptions.yes
+	if term.IsTerminal(int(os.Stdin.Fd())) && term.IsTerminal(int(os.Stderr.Fd())) {
+		cm.confirm = confirmOnTerminal()
+	}
+	return cm, nil
+}
+
+// jsonOutput reports whether a listing command should print JSON, failing
+// for the formats only run supports.
+func jsonOutput() (bool, error) {
+	switch globalOptions.output {
+	case "pretty":
+		return false, nil
+	case "json":
+		return true, nil
+	}
+	return false, usageErrorf("--output %s is only supported by run (use pretty or json)", globalOptions.output)
+}
+
+func writeJSON(out io.Writer, value interface{}) error {
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding output: %w", err)
+	}
+	_, err = fmt.Fprintln(out, string(data))
+	return err
+}
+
+// keyValueFlag collects repeatable key<sep>value flags such as
+// --param page=2.
+type keyValueFlag struct {
+	sep    string
+	values url.Values
+}
+
+func newKeyValueFlag(sep string) *keyValueFlag {
+	return &keyValueFlag{sep: sep, values: url.Values{}}
+}
+
+func (f *keyValueFlag) String() string {
+	if f == nil {
+		return ""
+	}
+	return f.values.Encode()
+}
+
+func (f *keyValueFlag) Type() string {
+	return "key" + f.sep + "value"
+}
+
+// first returns the first value given for each key.
+func (f *keyValueFlag) first() map[string]string {
+	values := make(map[string]string, len(f.values))
+	for key := range f.values {
+		values[key] = f.values.Get(key)
+	}
+	return values
+}
+
+func (f *keyValueFlag) Set(s string) error {
+	key, value, ok := strings.Cut(s, f.sep)
+	key = strings.TrimSpace(key)
+	if !ok || key == "" {
+		return fmt.Errorf("expected key%svalue, got %q", f.sep, s)
+	}
+	f.values.Add(key, value)
+	return nil
+}
+
+// stringListFlag collects a repeatable string flag.
+type stringListFlag []string
+
+func (f *stringListFlag) String() string {
+	if f == nil {
+		return ""
+	}
+	return strings.Join(*f, ",")
+}
+
+func (f *stringListFlag) Set(s string) error {
+	*f = append(*f, s)
+	return nil
+}
+
+func (f *stringListFlag) Type() string {
+	return "string"
+}
+
+// reportFlag collects repeatable --report format[=file] flags.
+type reportFlag []reportTarget
+
+type reportTarget struct {
+	format string
+	path   string
+}
+
+func (f *reportFlag) String() string {
+	if f == nil {
+		return ""
+	}
+	var parts []string
+	for _, target := range *f {
+		parts = append(parts, target.format+"="+target.path)
+	}
+	return strings.Join(parts, ",")
+}
+
+func (f *reportFlag) Set(s string) error {
+	format, path, _ := strings.Cut(s, "=")
+	if !slices.Contains(reportFormats, format) {
+		return fmt.Errorf("unknown report format %q (expected one of %s)", format, strings.Join(reportFormats, ", "))
+	}
+	*f = append(*f, reportTarget{format: format, path: path})
+	return nil
+}
+
+func (f *reportFlag) Type() string {
+	return "format[=file]"
+}
+
+// progressWriter is where human-readable progress goes: stdout, unless a
+// report is being written there.
+func (f reportFlag) progressWriter() io.Writer {
+	for _, target := range f {
+		if target.path == "" {
+			return io.Discard
+		}
+	}
+	return os.Stdout
+}
+
+func (f reportFlag) write(report *TestReport) error {
+	for _, target := range f {
+		var err error
+		if target.path == "" {
+			err = WriteTestReport(os.Stdout, report, target.format)
+		} else {
+			err = WriteTestReportFile(target.path, report, target.format)
+		}
+		if err != nil {
+			return fmt.Errorf("writing report: %w", err)
+		}
+	}
+	return nil
+}
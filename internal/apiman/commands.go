@@ -0,0 +1,4155 @@
+// commands.go
+package apiman
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+func newTUICommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "tui",
+		Short: "Browse and run requests interactively (default in a workspace)",
+		Args:  exactArgs(0),
+		RunE:  startTUI,
+	}
+}
+
+func startTUI(cmd *cobra.Command, args []string) error {
+	cm, err := openWorkspace()
+	if err != nil {
+		return err
+	}
+	if err := runTUI(cm); err != nil {
+		return fmt.Errorf("running TUI: %w", err)
+	}
+	return nil
+}
+
+func newInitCommand() *cobra.Command {
+	var template string
+	var listTemplates bool
+	cmd := &cobra.Command{
+		Use:   "init",
+		Short: "Initialize workspace with default configs",
+		Long: `Initialize a workspace in the --workspace or APIMAN_WORKSPACE directory, or
+else the current directory. The directory is marked with api-man.json so
+commands run from its subdirectories find it.
+
+--template starts it from a template instead of the sample environments and
+request: rest-crud, graphql, microservice, or a template of yours in
+~/.config/api-man/templates/<name>.json.`,
+		Example: `  api-man init
+  api-man init --template rest-crud
+  api-man init --list-templates`,
+		Args: exactArgs(0),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if listTemplates {
+				return printTemplates()
+			}
+			if template != "" {
+				return initializeFromTemplate(template)
+			}
+			return initializeWorkspace(cmd, args)
+		},
+	}
+	cmd.Flags().StringVar(&template, "template", "", "create the workspace from this template `name` (or template file)")
+	cmd.Flags().BoolVar(&listTemplates, "list-templates", false, "list the templates --template accepts")
+	cmd.MarkFlagsMutuallyExclusive("template", "list-templates")
+	cmd.RegisterFlagCompletionFunc("template", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		templates, err := ListWorkspaceTemplates()
+		if err != nil {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		var names []string
+		for _, template := range templates {
+			names = append(names, template.Name+"\t"+template.Description)
+		}
+		return names, cobra.ShellCompDirectiveNoFileComp
+	})
+	return cmd
+}
+
+func printTemplates() error {
+	templates, err := ListWorkspaceTemplates()
+	if err != nil {
+		return err
+	}
+	asJSON, err := jsonOutput()
+	if err != nil {
+		return err
+	}
+	if asJSON {
+		return writeJSON(os.Stdout, templates)
+	}
+	for _, template := range templates {
+		source := "built-in"
+		if template.File != "" {
+			source = template.File
+		}
+		fmt.Printf("%-14s %s\n", template.Name, template.Description)
+		fmt.Printf("%-14s (%s)\n", "", source)
+	}
+	return nil
+}
+
+// initializeFromTemplate creates a workspace like initializeWorkspace, with
+// what the template name has instead of the default files.
+func initializeFromTemplate(name string) error {
+	template, err := LoadWorkspaceTemplate(name)
+	if err != nil {
+		return err
+	}
+	root := explicitWorkspace()
+	if root == "" {
+		root = "."
+	}
+	cm, result, err := InitWorkspaceFromTemplate(root, template)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("✓ Initialized API-Man workspace from template %s\n", name)
+	if len(result.Environments) > 0 {
+		fmt.Printf("✓ Created environments: %s\n", strings.Join(result.Environments, ", "))
+	}
+	if result.Defaults {
+		fmt.Printf("✓ Wrote default headers and settings to %s\n", defaultsFileName)
+	}
+	if len(result.Requests) > 0 {
+		fmt.Printf("✓ Created %d request(s): %s\n", len(result.Requests), strings.Join(result.Requests, ", "))
+	}
+	if len(result.Directories) > 0 {
+		fmt.Printf("✓ Created folders: %s\n", strings.Join(result.Directories, ", "))
+	}
+	if len(result.Suites) > 0 {
+		fmt.Printf("✓ Created suites: %s\n", strings.Join(result.Suites, ", "))
+	}
+	fmt.Println()
+	fmt.Printf("Configuration directory: %s\n", cm.configDir)
+	fmt.Println("Run 'api-man list' to see the requests")
+	return nil
+}
+
+// initializeWorkspace creates a workspace in the --workspace or
+// APIMAN_WORKSPACE directory, or else the current directory, and marks it
+// with api-man.json so commands run from subdirectories find it.
+func initializeWorkspace(cmd *cobra.Command, args []string) error {
+	root := explicitWorkspace()
+	if root == "" {
+		root = "."
+	}
+	cm, err := InitWorkspace(root)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("✓ Initialized API-Man workspace")
+	fmt.Printf("✓ Created directories: %s\n", cm.configDir)
+	fmt.Println("✓ Generated default environments (dev, prod)")
+	fmt.Println("✓ Created sample request")
+	fmt.Println()
+	fmt.Printf("Configuration directory: %s\n", cm.configDir)
+	fmt.Println("You can now:")
+	fmt.Println("  - Edit environment files in environments/")
+	fmt.Println("  - Create request files in requests/")
+	fmt.Println("  - Run: api-man list")
+	return nil
+}
+
+func newProjectCommand() *cobra.Command {
+	var none bool
+	use := &cobra.Command{
+		Use:   "use <name>",
+		Short: "Make a project the workspace used outside any other",
+		Long: `Make a project the current one. Commands run outside a workspace use the
+current project's workspace instead of ~/.api-man; --workspace, --project,
+APIMAN_WORKSPACE and a workspace above the working directory still win.`,
+		Example: `  api-man project use billing
+  api-man project use --none`,
+		Args:              argsBetween(0, 1),
+		ValidArgsFunction: completeArgs(argProject),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			switch {
+			case none && len(args) > 0:
+				return usageErrorf("--none takes no project name")
+			case !none && len(args) != 1:
+				return usageErrorf("use needs a project name, or --none")
+			}
+			name := ""
+			if !none {
+				name = args[0]
+			}
+			if err := UseProject(name); err != nil {
+				return err
+			}
+			if name == "" {
+				fmt.Println("✓ No current project")
+				return nil
+			}
+			fmt.Printf("✓ Using project %s\n", name)
+			return nil
+		},
+	}
+	use.Flags().BoolVar(&none, "none", false, "clear the current project")
+
+	return groupCommand("project", "Name workspaces and switch between them",
+		&cobra.Command{
+			Use:   "add <name> [dir]",
+			Short: "Register a workspace as a project",
+			Long: `Register the workspace in dir as project name, so that --project name
+selects it from any directory. dir defaults to the workspace at or above the
+working directory.`,
+			Example: `  api-man project add billing
+  api-man project add users ~/src/users-api`,
+			Args: argsBetween(1, 2),
+			RunE: addProject,
+		},
+		use,
+		&cobra.Command{
+			Use:   "list",
+			Short: "List the projects",
+			Args:  exactArgs(0),
+			RunE:  listProjects,
+		},
+		&cobra.Command{
+			Use:               "remove <name>",
+			Short:             "Unregister a project, leaving its workspace alone",
+			Args:              exactArgs(1),
+			ValidArgsFunction: completeArgs(argProject),
+			RunE: func(cmd *cobra.Command, args []string) error {
+				if err := RemoveProject(args[0]); err != nil {
+					return err
+				}
+				fmt.Printf("✓ Removed project %s\n", args[0])
+				return nil
+			},
+		},
+	)
+}
+
+func addProject(cmd *cobra.Command, args []string) error {
+	dir := "."
+	if len(args) > 1 {
+		dir = args[1]
+	} else if local, ok := findLocalWorkspace(); ok {
+		dir = local
+	}
+	dir, err := AddProject(args[0], dir)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("✓ Added project %s (%s)\n", args[0], dir)
+	return nil
+}
+
+func listProjects(cmd *cobra.Command, args []string) error {
+	asJSON, err := jsonOutput()
+	if err != nil {
+		return err
+	}
+	registry, err := LoadProjects()
+	if err != nil {
+		return err
+	}
+	projects := registry.List()
+	if asJSON {
+		return writeJSON(os.Stdout, projects)
+	}
+	if len(projects) == 0 {
+		fmt.Println("No projects (add one with api-man project add <name> [dir])")
+		return nil
+	}
+	for _, project := range projects {
+		marker := " "
+		if project.Current {
+			marker = "*"
+		}
+		missing := ""
+		if project.Missing {
+			missing = "  ✗ not a workspace"
+		}
+		fmt.Printf("%s %-20s %s%s\n", marker, project.Name, project.Dir, missing)
+	}
+	return nil
+}
+
+func newGenerateCommand() *cobra.Command {
+	headers := newKeyValueFlag(":")
+	var diff, apply bool
+	cmd := &cobra.Command{
+		Use:   "generate <spec.yaml|spec.json|URL>",
+		Short: "Generate request configs from an OpenAPI, Swagger 2.0 or AsyncAPI spec",
+		Example: `  api-man generate https://api.example.com/openapi.json --header 'Authorization: Bearer {{env.API_TOKEN}}'
+  api-man generate asyncapi.yaml
+  api-man generate openapi.yaml --diff
+  api-man generate openapi.yaml --diff --apply`,
+		Args: exactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if apply && !diff {
+				return usageErrorf("--apply needs --diff")
+			}
+			if diff {
+				return diffOpenAPI(args[0], headers, apply)
+			}
+			return generateFromOpenAPI(args[0], headers)
+		},
+	}
+	cmd.Flags().Var(headers, "header", "header `name:value` sent when fetching the spec from a URL ({{env.NAME}} is expanded)")
+	cmd.Flags().BoolVar(&diff, "diff", false, "compare the spec with the requests generated earlier instead of regenerating them")
+	cmd.Flags().BoolVar(&apply, "apply", false, "with --diff, update the requests, keeping your edits to them")
+	return cmd
+}
+
+// loadSpecWithHeaders loads the spec generate was given, sending headers
+// when it is fetched from a URL. An AsyncAPI spec is returned as the second
+// value.
+func loadSpecWithHeaders(specFile string, headers *keyValueFlag) (*openapi3.T, *AsyncAPISpec, error) {
+	header := http.Header{}
+	for name, value := range headers.first() {
+		header.Set(name, interpolate(strings.TrimSpace(value), nil))
+	}
+	spec, asyncSpec, err := LoadAPISpec(specFile, header)
+	if err != nil {
+		return nil, nil, fmt.Errorf("loading spec: %w", err)
+	}
+	return spec, asyncSpec, nil
+}
+
+func diffOpenAPI(specFile string, headers *keyValueFlag, apply bool) error {
+	asJSON, err := jsonOutput()
+	if err != nil {
+		return err
+	}
+	spec, asyncSpec, err := loadSpecWithHeaders(specFile, headers)
+	if err != nil {
+		return err
+	}
+	if asyncSpec != nil {
+		return usageErrorf("--diff only compares OpenAPI specs; regenerate from an AsyncAPI spec without it")
+	}
+	cm, err := openWorkspace()
+	if err != nil {
+		return err
+	}
+	diff, err := cm.DiffOpenAPI(spec, "")
+	if err != nil {
+		return fmt.Errorf("comparing spec: %w", err)
+	}
+	if apply {
+		if err := cm.ApplyOpenAPIDiff(diff); err != nil {
+			return fmt.Errorf("applying changes: %w", err)
+		}
+	}
+
+	if asJSON {
+		if err := writeJSON(os.Stdout, diff); err != nil {
+			return err
+		}
+	} else {
+		printOpenAPIDiff(diff, apply)
+	}
+	if !apply && !diff.Empty() {
+		return exitCode(exitFailure)
+	}
+	return nil
+}
+
+func printOpenAPIDiff(diff *OpenAPIDiff, applied bool) {
+	if !diff.HasBase {
+		fmt.Printf("⚠️  No record of the last generate into requests/%s/: differences can't be told from your edits, so headers, parameters and bodies are kept\n\n", diff.Collection)
+	}
+	for _, op := range diff.Added {
+		fmt.Printf("+ %-7s %s  (%s)\n", op.Method, op.Path, op.Request)
+	}
+	for _, op := range diff.Removed {
+		switch {
+		case op.DuplicateOf != "" && op.Edited:
+			fmt.Printf("- %-7s %s  (%s duplicates %s; it has your edits and is kept: remove it with api-man rm)\n", op.Method, op.Path, op.Request, op.DuplicateOf)
+		case op.DuplicateOf != "":
+			fmt.Printf("- %-7s %s  (%s, a duplicate of %s)\n", op.Method, op.Path, op.Request, op.DuplicateOf)
+		case op.Edited:
+			fmt.Printf("- %-7s %s  (%s has your edits and is kept: remove it with api-man rm)\n", op.Method, op.Path, op.Request)
+		default:
+			fmt.Printf("- %-7s %s  (%s)\n", op.Method, op.Path, op.Request)
+		}
+	}
+	for _, op := range diff.Changed {
+		fmt.Printf("~ %-7s %s  (%s)\n", op.Method, op.Path, op.Request)
+		if len(op.Fields) > 0 {
+			fmt.Printf("    changed: %s\n", strings.Join(op.Fields, ", "))
+		}
+		if len(op.Kept) > 0 {
+			fmt.Printf("    keeping your %s\n", strings.Join(op.Kept, ", "))
+		}
+		if len(op.Conflicts) > 0 {
+			fmt.Printf("    ⚠️  conflict, keeping yours: %s\n", strings.Join(op.Conflicts, ", "))
+		}
+	}
+	for _, op := range diff.Duplicates {
+		fmt.Printf("= %-7s %s  (already generated as %s, not added)\n", op.Method, op.Path, op.DuplicateOf)
+		if len(op.Fields) > 0 {
+			fmt.Printf("    ⚠️  this spec differs in: %s\n", strings.Join(op.Fields, ", "))
+		}
+	}
+	if diff.Empty() {
+		fmt.Printf("✓ requests/%s/ is up to date with the spec (%d operations)\n", diff.Collection, diff.Unchanged)
+		return
+	}
+	fmt.Printf("\n%d added, %d removed, %d changed, %d unchanged\n", len(diff.Added), len(diff.Removed), len(diff.Changed), diff.Unchanged)
+	if applied {
+		fmt.Printf("✓ Updated requests/%s/\n", diff.Collection)
+	} else {
+		fmt.Println("Run with --apply to update the requests")
+	}
+}
+
+func generateFromOpenAPI(specFile string, headers *keyValueFlag) error {
+	spec, asyncSpec, err := loadSpecWithHeaders(specFile, headers)
+	if err != nil {
+		return err
+	}
+
+	cm, err := openWorkspace()
+	if err != nil {
+		return err
+	}
+
+	var result *OpenAPIImportResult
+	if asyncSpec != nil {
+		result, err = cm.GenerateRequestsFromAsyncAPI(asyncSpec)
+	} else {
+		result, err = cm.GenerateRequestsFromOpenAPI(spec)
+	}
+	if err != nil {
+		return fmt.Errorf("generating requests: %w", err)
+	}
+
+	for _, warning := range result.Warnings {
+		fmt.Printf("⚠️  %s\n", warning)
+	}
+	fmt.Printf("✓ Generated request configurations from %s\n", specFile)
+	fmt.Printf("✓ Requests saved to %s\n", filepath.Join(cm.requestsDir, result.Collection))
+	if result.Pruned > 0 {
+		fmt.Printf("✓ Removed %d request(s) no longer in the spec\n", result.Pruned)
+	}
+	if result.Bodies > 0 {
+		fmt.Printf("✓ Saved %d more message(s) as body templates\n", result.Bodies)
+	}
+	for _, env := range result.Environments {
+		fmt.Printf("✓ Wrote environment %s (fill in its credentials)\n", env)
+	}
+	fmt.Println()
+	fmt.Println("Run 'api-man list' to see all generated requests")
+	return nil
+}
+
+// runFlags holds the flags of api-man run.
+type runFlags struct {
+	stream       bool
+	params       *keyValueFlag
+	pathParams   *keyValueFlag
+	headers      *keyValueFlag
+	vars         *keyValueFlag
+	body         string
+	bodyFile     string
+	timeout      time.Duration
+	proxy        string
+	encoding     string
+	repeat       int
+	interval     time.Duration
+	untilStatus  int
+	save         string
+	validate     bool
+	force        bool
+	dryRun       bool
+	maxBodyPrint int
+	noPrompt     bool
+	query        string
+	xmlToJSON    bool
+	fail         bool
+	data         string
+	requestID    string
+	cache        bool
+}
+
+func newRunCommand() *cobra.Command {
+	f := &runFlags{
+		params:     newKeyValueFlag("="),
+		pathParams: newKeyValueFlag("="),
+		headers:    newKeyValueFlag(":"),
+		vars:       newKeyValueFlag("="),
+	}
+	cmd := &cobra.Command{
+		Use:   "run <request-path> <environment>",
+		Short: "Execute a request",
+		Example: `  api-man run users/get-user dev --path id=123 --header 'X-Debug: 1'
+  api-man run jobs/status dev --repeat 0 --until-status 200 --interval 2s
+  api-man run users/get-users dev --output json | jq .body
+  api-man run users/get-users dev --query '.data.items[0].id'`,
+		Args:              exactArgs(2),
+		ValidArgsFunction: completeArgs(argRequest, argEnvironment),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runRequest(cmd, args[0], args[1], f)
+		},
+	}
+	flags := cmd.Flags()
+	flags.BoolVar(&f.stream, "stream", false, "print the response as it arrives (SSE, NDJSON or raw chunks)")
+	flags.Var(f.params, "param", "query parameter `key=value` (repeat a key for multiple values)")
+	flags.Var(f.pathParams, "path", "path parameter `name=value` filling {name} in the URL")
+	flags.Var(f.headers, "header", "request header `name:value`, over the stored headers")
+	flags.Var(f.vars, "var", "variable `key=value`, over the environment's variables")
+	flags.StringVar(&f.data, "data", "", "fill the body's placeholders from this data `file` in the request's data/ folder")
+	flags.StringVar(&f.body, "body", "", "request body to send instead of the stored one")
+	flags.StringVar(&f.bodyFile, "body-file", "", "read the request body from `file`")
+	flags.DurationVar(&f.timeout, "timeout", 0, "request timeout, e.g. 5s (default: the request's timeout)")
+	flags.StringVar(&f.proxy, "proxy", "", "send the request through this proxy `URL` instead of the environment's")
+	flags.StringVar(&f.requestID, "request-id", "", "send this correlation `id` instead of a fresh UUID (under the environment's requestIdHeader, or X-Request-ID)")
+	flags.StringVar(&f.encoding, "accept-encoding", "", "ask for these `encodings` (gzip, deflate, br, zstd, identity), decode the response and show its compressed size")
+	flags.IntVar(&f.repeat, "repeat", 1, "send the request this many times (0: until stopped or --until-status matches)")
+	flags.DurationVar(&f.interval, "interval", time.Second, "wait between --repeat attempts")
+	flags.IntVar(&f.untilStatus, "until-status", 0, "stop repeating once the response has this `status` (implies --repeat 0 unless set)")
+	flags.StringVar(&f.save, "save", "", "write the response body to `path` ({{request}}, {{env}}, {{timestamp}} and {{status}} are expanded)")
+	flags.BoolVar(&f.validate, "validate", false, "check the response against the OpenAPI schema the request was generated from")
+	flags.BoolVar(&f.force, "force", false, "send the body even if it doesn't match the request's OpenAPI schema")
+	flags.BoolVar(&f.dryRun, "dry-run", false, "show the resolved request without sending it")
+	flags.BoolVar(&f.cache, "cache", false, "revalidate a cached response with If-None-Match/If-Modified-Since and serve it on 304")
+	flags.IntVar(&f.maxBodyPrint, "max-body-print", 0, "show at most this many `bytes` of a text body with --output pretty (0: all)")
+	flags.StringVar(&f.query, "query", "", "print only the result of this jq `expression` on the JSON response body")
+	flags.BoolVar(&f.xmlToJSON, "xml-to-json", false, "convert an XML response body to JSON before printing or --query")
+	flags.BoolVar(&f.noPrompt, "no-prompt", false, "don't ask for the request's prompts; use --var values and defaults")
+	flags.BoolVar(&f.fail, "fail", false, "exit with 4 or 5 on 4xx and 5xx responses, or with 7 when the request's assertions fail")
+	cmd.RegisterFlagCompletionFunc("data", completeRequestData)
+	return cmd
+}
+
+func runRequest(cmd *cobra.Command, requestPath, envName string, f *runFlags) error {
+	output := globalOptions.output
+	opts := RequestOptions{
+		Params:         f.params.values,
+		PathParams:     f.pathParams.first(),
+		Variables:      f.vars.first(),
+		Data:           f.data,
+		Timeout:        f.timeout,
+		Proxy:          f.proxy,
+		Force:          f.force,
+		AcceptEncoding: f.encoding,
+		RequestID:      f.requestID,
+		Cache:          f.cache,
+	}
+	if len(f.headers.values) > 0 {
+		opts.Headers = make(map[string]string, len(f.headers.values))
+		for name, value := range f.headers.first() {
+			opts.Headers[name] = strings.TrimSpace(value)
+		}
+	}
+
+	if f.repeat < 0 {
+		return usageErrorf("--repeat must not be negative")
+	}
+	if f.untilStatus != 0 && !cmd.Flags().Changed("repeat") {
+		f.repeat = 0
+	}
+	switch {
+	case cmd.Flags().Changed("body") && cmd.Flags().Changed("body-file"):
+		return usageErrorf("--body and --body-file cannot be used together")
+	case cmd.Flags().Changed("body"):
+		opts.Body = &f.body
+	case cmd.Flags().Changed("body-file"):
+		data, err := os.ReadFile(f.bodyFile)
+		if err != nil {
+			return fmt.Errorf("reading body file: %w", err)
+		}
+		bodyData := string(data)
+		opts.Body = &bodyData
+	}
+
+	cm, err := openWorkspace()
+	if err != nil {
+		return err
+	}
+
+	var schema *RequestSchema
+	var assertions *Assertions
+	if config, err := cm.LoadRequest(requestPath); err == nil {
+		assertions = config.Assertions
+		if f.save == "" {
+			f.save = config.SaveResponse
+		}
+		f.validate = f.validate || config.ValidateResponse
+		// WebSocket messages are shown as they come unless the output is
+		// for a program, which gets them all as the body.
+		webSocket := config.WebSocket != nil && output == "pretty" && f.query == "" && !f.validate
+		f.stream = f.stream || config.Stream || webSocket
+		schema = config.Schema
+		if !f.noPrompt && term.IsTerminal(int(os.Stdin.Fd())) {
+			if opts.Variables, err = askPrompts(config.Prompts, opts.Variables); err != nil {
+				return err
+			}
+		}
+	}
+	if f.stream && output != "pretty" {
+		return usageErrorf("--output cannot be used with streamed responses")
+	}
+	if f.stream && f.validate {
+		return usageErrorf("--validate cannot be used with streamed responses")
+	}
+	if f.query != "" && (f.stream || output == "headers" || output == "status") {
+		return usageErrorf("--query cannot be used with streamed responses or --output %s", output)
+	}
+	if f.xmlToJSON && f.stream {
+		return usageErrorf("--xml-to-json cannot be used with streamed responses")
+	}
+	if f.query != "" {
+		if err := checkQuery(f.query); err != nil {
+			return &usageError{err}
+		}
+	}
+	if !f.stream && term.IsTerminal(int(os.Stderr.Fd())) {
+		opts.Progress = os.Stderr
+	}
+	polling := f.repeat != 1 || f.untilStatus != 0
+	if f.stream && polling {
+		return usageErrorf("--repeat and --until-status cannot be used with streamed responses")
+	}
+	if f.dryRun {
+		prepared, err := cm.PrepareRequest(requestPath, envName, opts)
+		if err != nil {
+			return fmt.Errorf("preparing request: %w", err)
+		}
+		if err := writeDryRun(os.Stdout, prepared); err != nil {
+			return fmt.Errorf("writing request: %w", err)
+		}
+		return nil
+	}
+	ctx := context.Background()
+	if f.stream || polling {
+		// Ctrl+C closes the stream or stops polling instead of killing the
+		// process mid-write.
+		var stop context.CancelFunc
+		ctx, stop = signal.NotifyContext(ctx, os.Interrupt)
+		defer stop()
+	}
+
+	execute := func() (*ExecutionResult, error) {
+		for {
+			var result *ExecutionResult
+			var err error
+			if f.stream {
+				result, err = cm.StreamRequest(ctx, requestPath, envName, opts, os.Stdout)
+			} else {
+				// Ctrl+C aborts a hung request rather than waiting for
+				// its timeout, but still ends a path parameter prompt.
+				sendCtx, stop := signal.NotifyContext(ctx, os.Interrupt)
+				result, err = cm.RunRequestContext(sendCtx, requestPath, envName, opts)
+				stop()
+			}
+			// On a terminal, ask for missing path parameters and try again.
+			var missing *MissingPathParamsError
+			if !errors.As(err, &missing) || !term.IsTerminal(int(os.Stdin.Fd())) {
+				return result, err
+			}
+			if opts.PathParams, err = promptPathParams(missing.Names, opts.PathParams); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var result *ExecutionResult
+	reached := true
+	if polling {
+		result, reached, err = pollRequest(ctx, execute, f.repeat, f.interval, f.untilStatus)
+	} else {
+		result, err = execute()
+	}
+	var cancelledErr *CancelledError
+	if errors.As(err, &cancelledErr) {
+		fmt.Fprintf(os.Stderr, "✗ Request cancelled after %s\n", cancelledErr.Elapsed.Round(time.Millisecond))
+		return exitCode(exitCancelled)
+	}
+	if errors.Is(err, errNotConfirmed) {
+		fmt.Fprintln(os.Stderr, "✗ Not sent")
+		return exitCode(exitCancelled)
+	}
+	if err != nil {
+		return &codedError{fmt.Errorf("executing request: %w", err), requestExitCode(err)}
+	}
+	if globalOptions.verbose {
+		writeSentRequest(os.Stderr, result)
+	}
+	// --xml-to-json changes what is printed and queried; --save still
+	// writes the body as received.
+	shown := result
+	if f.xmlToJSON {
+		if shown, err = convertXMLResult(result); err != nil {
+			return err
+		}
+	}
+	switch {
+	case f.query != "":
+		values, err := queryBody(shown.Body, f.query)
+		if err != nil {
+			return err
+		}
+		text, err := formatQueryResults(values, output == "json")
+		if err != nil {
+			return fmt.Errorf("writing query result: %w", err)
+		}
+		fmt.Print(text)
+	case !f.stream:
+		if err := writeResult(os.Stdout, shown, output, f.maxBodyPrint); err != nil {
+			return fmt.Errorf("writing response: %w", err)
+		}
+	}
+	if len(result.Extracted) > 0 {
+		fmt.Fprintf(os.Stderr, "✓ Stored %s for %s\n", strings.Join(sortedKeys(result.Extracted), ", "), envName)
+	}
+	if len(result.Jar) > 0 {
+		fmt.Fprintf(os.Stderr, "✓ Updated cookie(s) %s in the jar for %s\n", strings.Join(result.Jar, ", "), envName)
+	}
+	if result.ExtractError != "" {
+		fmt.Fprintf(os.Stderr, "⚠️  %s\n", result.ExtractError)
+	}
+	// Binary bodies aren't printed, so keep them in a file instead.
+	if !f.stream && output == "pretty" && f.save == "" && isBinaryResponse(result) {
+		path, err := DownloadResponse(result)
+		if err != nil {
+			return fmt.Errorf("saving response: %w", err)
+		}
+		fmt.Fprintf(os.Stderr, "✓ Saved response to %s\n", path)
+	}
+	if f.save != "" {
+		path, err := cm.SaveResponse(result, f.save)
+		if err != nil {
+			return fmt.Errorf("saving response: %w", err)
+		}
+		if rel, err := filepath.Rel(cm.configDir, path); err == nil && !strings.HasPrefix(rel, "..") {
+			path = rel
+		}
+		// stderr, so --output raw|json can still be piped.
+		fmt.Fprintf(os.Stderr, "✓ Saved response to %s\n", path)
+	}
+	if f.validate && !reportValidation(schema, result) {
+		return exitCode(exitFailure)
+	}
+	if !reached {
+		fmt.Fprintf(os.Stderr, "✗ Stopped before the request returned status %d\n", f.untilStatus)
+		return exitCode(exitFailure)
+	}
+	if f.fail {
+		return checkRunResult(cm, assertions, result, opts)
+	}
+	return nil
+}
+
+// checkRunResult is run --fail's verdict on result: the request's
+// assertions when it has any, reported on stderr, and otherwise its status.
+// An assertion on the status replaces the check for a 2xx one, so a request
+// expected to return 404 passes.
+func checkRunResult(cm *ConfigManager, assertions *Assertions, result *ExecutionResult, opts RequestOptions) error {
+	if !assertions.IsEmpty() {
+		results := cm.evaluateAssertions(assertions, result, opts)
+		for _, a := range results {
+			if !a.Passed {
+				fmt.Fprintf(os.Stderr, "✗ %s: %s\n", a.Name, a.Message)
+			}
+		}
+		if !assertionsPassed(results) {
+			return exitCode(exitAssertion)
+		}
+		fmt.Fprintf(os.Stderr, "✓ %d assertion(s) passed\n", len(results))
+		if assertions.Status != 0 {
+			return nil
+		}
+	}
+	if code := responseExitCode(result); code != 0 {
+		fmt.Fprintf(os.Stderr, "✗ Request failed with status %s\n", result.Status)
+		return exitCode(code)
+	}
+	return nil
+}
+
+// writeSentRequest prints the request line and headers that were sent, and
+// the status line received, for --verbose.
+func writeSentRequest(out io.Writer, result *ExecutionResult) {
+	fmt.Fprintf(out, "> %s %s\n", result.Method, result.URL)
+	writeHeaders(out, result.RequestHeaders, "> ")
+	fmt.Fprintf(out, "< %s (%dms)\n", result.Status, result.DurationMS())
+}
+
+// reportValidation prints the result of checking result against schema to
+// stderr and reports whether it passed. A request without a schema only
+// gets a warning.
+func reportValidation(schema *RequestSchema, result *ExecutionResult) bool {
+	problems, err := ValidateResponse(schema, result)
+	switch {
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "⚠️  Not validated: %v\n", err)
+		return true
+	case len(problems) > 0:
+		fmt.Fprintln(os.Stderr, "✗ Response does not match the OpenAPI schema:")
+		for _, problem := range problems {
+			fmt.Fprintf(os.Stderr, "    %s\n", problem)
+		}
+		return false
+	}
+	fmt.Fprintln(os.Stderr, "✓ Response matches the OpenAPI schema")
+	return true
+}
+
+// pollRequest calls execute up to repeat times (forever when repeat is 0),
+// waiting interval between attempts and stopping early once the response
+// status is untilStatus. Each attempt is summarised on stderr so the final
+// response can still be piped. It returns the last response and whether
+// untilStatus was seen; failed attempts are reported and retried, and an
+// error is only returned if no attempt succeeded.
+func pollRequest(ctx context.Context, execute func() (*ExecutionResult, error), repeat int, interval time.Duration, untilStatus int) (*ExecutionResult, bool, error) {
+	var last *ExecutionResult
+	var lastErr error
+	for attempt := 1; repeat == 0 || attempt <= repeat; attempt++ {
+		if attempt > 1 {
+			select {
+			case <-ctx.Done():
+				return last, untilStatus == 0, nil
+			case <-time.After(interval):
+			}
+		}
+
+		label := fmt.Sprint(attempt)
+		if repeat > 0 {
+			label = fmt.Sprintf("%d/%d", attempt, repeat)
+		}
+		fmt.Fprintf(os.Stderr, "[%s %s] ", label, time.Now().Format("15:04:05"))
+
+		result, err := execute()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "✗ %v\n", err)
+			lastErr = err
+			if ctx.Err() != nil {
+				break
+			}
+			continue
+		}
+		last = result
+		preview := strings.Join(strings.Fields(string(result.Body)), " ")
+		fmt.Fprintf(os.Stderr, "%s (%dms) %s\n", result.Status, result.DurationMS(), truncateForDisplay(preview, 60))
+		if untilStatus != 0 && result.StatusCode == untilStatus {
+			return last, true, nil
+		}
+	}
+	if last == nil {
+		return nil, false, lastErr
+	}
+	return last, untilStatus == 0, nil
+}
+
+var stdinReader = bufio.NewReader(os.Stdin)
+
+// confirmOnTerminal returns a ConfigManager.confirm asking on the terminal
+// whether to send each request that needs confirmation; answering "a" sends
+// the rest without asking.
+func confirmOnTerminal() func(*ConfirmationRequiredError) (bool, error) {
+	var mu sync.Mutex
+	all := false
+	return func(request *ConfirmationRequiredError) (bool, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if all {
+			return true, nil
+		}
+		fmt.Fprintf(os.Stderr, "⚠️  Send %s %s to %s? [y/N/a] ", request.Method, request.URL, request.Environment)
+		line, err := stdinReader.ReadString('\n')
+		if err != nil && line == "" {
+			return false, fmt.Errorf("reading confirmation: %w", err)
+		}
+		switch strings.ToLower(strings.TrimSpace(line)) {
+		case "y", "yes":
+			return true, nil
+		case "a", "all":
+			all = true
+			return true, nil
+		}
+		return false, nil
+	}
+}
+
+// promptPathParams asks for each named path parameter and returns them
+// added to values.
+func promptPathParams(names []string, values map[string]string) (map[string]string, error) {
+	values = maps.Clone(values)
+	if values == nil {
+		values = make(map[string]string)
+	}
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "{%s}: ", name)
+		line, err := stdinReader.ReadString('\n')
+		if err != nil && line == "" {
+			return nil, fmt.Errorf("reading path parameter: %w", err)
+		}
+		values[name] = strings.TrimSpace(line)
+	}
+	return values, nil
+}
+
+// askPrompts asks for each prompt not already set in values, hiding secret
+// answers, and returns the answers added to values. An empty answer leaves
+// the prompt to its default.
+func askPrompts(prompts []RequestPrompt, values map[string]string) (map[string]string, error) {
+	values = maps.Clone(values)
+	if values == nil {
+		values = make(map[string]string)
+	}
+	for _, prompt := range prompts {
+		if _, ok := values[prompt.Name]; ok {
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "%s: ", prompt.label())
+		var answer string
+		if prompt.Secret {
+			data, err := term.ReadPassword(int(os.Stdin.Fd()))
+			fmt.Fprintln(os.Stderr)
+			if err != nil {
+				return nil, fmt.Errorf("reading %s: %w", prompt.Name, err)
+			}
+			answer = string(data)
+		} else {
+			line, err := stdinReader.ReadString('\n')
+			if err != nil && line == "" {
+				return nil, fmt.Errorf("reading %s: %w", prompt.Name, err)
+			}
+			answer = strings.TrimSpace(line)
+		}
+		if answer != "" {
+			values[prompt.Name] = answer
+		}
+	}
+	return values, nil
+}
+
+func printResponseBody(body []byte, contentType string) {
+	fmt.Println(formatResponseBody(body, contentType))
+}
+
+// newRequestFileCommand returns api-man rm, mv or cp.
+func newRequestFileCommand(command string) *cobra.Command {
+	cmd := &cobra.Command{
+		Args:              exactArgs(2),
+		ValidArgsFunction: completeArgs(argRequest, argRequest),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return manageRequestFiles(command, args)
+		},
+	}
+	switch command {
+	case "rm":
+		cmd.Use = "rm <request>"
+		cmd.Short = "Delete a request with its body templates and hooks"
+		cmd.Args = exactArgs(1)
+	case "mv":
+		cmd.Use = "mv <request> <new-path>"
+		cmd.Short = "Rename or move a request (end new-path with / to keep the name)"
+	case "cp":
+		cmd.Use = "cp <request> <new-path>"
+		cmd.Short = "Copy a request with its body templates and hooks"
+	}
+	return cmd
+}
+
+// manageRequestFiles implements api-man rm, mv and cp.
+func manageRequestFiles(command string, args []string) error {
+	cm, err := openWorkspace()
+	if err != nil {
+		return err
+	}
+
+	switch command {
+	case "rm":
+		if err := cm.DeleteRequest(args[0]); err != nil {
+			return fmt.Errorf("deleting request: %w", err)
+		}
+		fmt.Printf("✓ Deleted %s\n", args[0])
+	case "mv":
+		newPath, err := cm.MoveRequest(args[0], args[1])
+		if err != nil {
+			return fmt.Errorf("moving request: %w", err)
+		}
+		fmt.Printf("✓ Moved %s to %s\n", args[0], newPath)
+	case "cp":
+		newPath, err := cm.CopyRequest(args[0], args[1])
+		if err != nil {
+			return fmt.Errorf("copying request: %w", err)
+		}
+		fmt.Printf("✓ Copied %s to %s\n", args[0], newPath)
+	}
+	return nil
+}
+
+func newListCommand() *cobra.Command {
+	var opts ListOptions
+	var format string
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List all available requests",
+		Long: `List the workspace's requests with their body template count and the
+status of their last run, grouped by folder. --format table prints one
+request per row, and --format json (or -o json) prints them for scripts.`,
+		Example: `  api-man list --method post --filter users
+  api-man list --sort modified --format table
+  api-man list --format json | jq -r '.[] | select(.lastRun.statusCode >= 400) | .path'`,
+		Args: exactArgs(0),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return listRequests(opts, format)
+		},
+	}
+	flags := cmd.Flags()
+	flags.StringVar(&opts.Method, "method", "", "only list requests with this HTTP `method` (or GRPC)")
+	flags.StringVar(&opts.Tag, "tag", "", "only list requests with this `tag`, including tags from _defaults.json")
+	flags.StringVar(&opts.Filter, "filter", "", "only list requests whose path, name, URL or description contains `text`")
+	flags.StringVar(&opts.Sort, "sort", "name", "sort by name, method or modified (newest first)")
+	flags.StringVar(&format, "format", "", "output `format`: tree, table or json (default tree, or json with -o json)")
+	cmd.RegisterFlagCompletionFunc("method", cobra.FixedCompletions(append(slices.Clone(httpMethods), "GRPC"), cobra.ShellCompDirectiveNoFileComp))
+	cmd.RegisterFlagCompletionFunc("sort", cobra.FixedCompletions(listSorts, cobra.ShellCompDirectiveNoFileComp))
+	cmd.RegisterFlagCompletionFunc("format", cobra.FixedCompletions(listFormats, cobra.ShellCompDirectiveNoFileComp))
+	return cmd
+}
+
+func listRequests(opts ListOptions, format string) error {
+	asJSON, err := jsonOutput()
+	if err != nil {
+		return err
+	}
+	switch {
+	case format == "" && asJSON:
+		format = "json"
+	case format == "":
+		format = "tree"
+	case !slices.Contains(listFormats, format):
+		return usageErrorf("unknown format %q (use %s)", format, strings.Join(listFormats, ", "))
+	}
+	if !slices.Contains(listSorts, opts.Sort) {
+		return usageErrorf("unknown sort %q (use %s)", opts.Sort, strings.Join(listSorts, ", "))
+	}
+	cm, err := openWorkspace()
+	if err != nil {
+		return err
+	}
+	entries, err := cm.listRequestEntries(opts)
+	if err != nil {
+		return fmt.Errorf("listing requests: %w", err)
+	}
+
+	switch {
+	case format == "json":
+		return writeJSON(os.Stdout, entries)
+	case len(entries) == 0 && (opts.Method != "" || opts.Tag != "" || opts.Filter != ""):
+		fmt.Println("No requests match the filters")
+		return nil
+	case format == "table":
+		printRequestTable(os.Stdout, entries)
+		return nil
+	}
+
+	fmt.Println("Available requests:")
+	fmt.Println()
+	// Folders keep the order of their first request.
+	var folders []string
+	grouped := make(map[string][]listEntry)
+	for _, entry := range entries {
+		folder, _, found := strings.Cut(entry.Path, "/")
+		if !found {
+			folder = "root"
+		}
+		if _, ok := grouped[folder]; !ok {
+			folders = append(folders, folder)
+		}
+		grouped[folder] = append(grouped[folder], entry)
+	}
+	for _, folder := range folders {
+		fmt.Printf("📁 %s/\n", folder)
+		for _, entry := range grouped[folder] {
+			fmt.Printf("  🌐 %s - %s %s\n", entry.Path, entry.Method, entry.URL)
+			if entry.Description != "" {
+				fmt.Printf("     %s\n", entry.Description)
+			}
+			var details []string
+			if entry.Bodies > 0 {
+				details = append(details, fmt.Sprintf("%d body template(s)", entry.Bodies))
+			}
+			if run := entry.LastRun; run != nil {
+				details = append(details, fmt.Sprintf("last run %s %s", run.Label(), run.Timestamp.Local().Format("2006-01-02 15:04")))
+			}
+			if len(details) > 0 {
+				fmt.Printf("     %s\n", strings.Join(details, " · "))
+			}
+		}
+		fmt.Println()
+	}
+	return nil
+}
+
+// printRequestTable writes entries one per row, with their body template
+// count, last run and modification time.
+func printRequestTable(out io.Writer, entries []listEntry) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "REQUEST\tMETHOD\tURL\tBODIES\tLAST RUN\tMODIFIED")
+	for _, entry := range entries {
+		last := "-"
+		if entry.LastRun != nil {
+			last = entry.LastRun.Label()
+		}
+		modified := "-"
+		if !entry.Modified.IsZero() {
+			modified = entry.Modified.Local().Format("2006-01-02 15:04")
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s\n", entry.Path, entry.Method, truncateForDisplay(entry.URL, 50), entry.Bodies, last, modified)
+	}
+	w.Flush()
+}
+
+func newSearchCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:     "search <term>...",
+		Short:   "Find requests by name, URL, method or description",
+		Example: "  api-man search post user",
+		Args:    argsBetween(1, -1),
+		RunE:    searchRequestsCommand,
+	}
+}
+
+func searchRequestsCommand(cmd *cobra.Command, args []string) error {
+	asJSON, err := jsonOutput()
+	if err != nil {
+		return err
+	}
+	cm, err := openWorkspace()
+	if err != nil {
+		return err
+	}
+	entries, err := cm.requestIndex()
+	if err != nil {
+		return fmt.Errorf("listing requests: %w", err)
+	}
+
+	matches := searchRequests(entries, strings.Join(args, " "))
+	if asJSON {
+		if err := writeJSON(os.Stdout, matches); err != nil {
+			return err
+		}
+	} else if len(matches) == 0 {
+		fmt.Printf("No requests match %q\n", strings.Join(args, " "))
+	}
+	if len(matches) == 0 {
+		return exitCode(exitFailure)
+	}
+	if asJSON {
+		return nil
+	}
+	for _, entry := range matches {
+		fmt.Printf("  🌐 %s - %s %s\n", entry.Path, entry.Method, entry.URL)
+		if entry.Description != "" {
+			fmt.Printf("     %s\n", entry.Description)
+		}
+	}
+	return nil
+}
+
+func newEnvsCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "envs",
+		Short: "List all available environments",
+		Args:  exactArgs(0),
+		RunE:  listEnvironments,
+	}
+}
+
+func listEnvironments(cmd *cobra.Command, args []string) error {
+	asJSON, err := jsonOutput()
+	if err != nil {
+		return err
+	}
+	cm, err := openWorkspace()
+	if err != nil {
+		return err
+	}
+
+	environments, err := cm.ListEnvironments()
+	if err != nil {
+		return fmt.Errorf("listing environments: %w", err)
+	}
+
+	if asJSON {
+		type environmentEntry struct {
+			Name    string `json:"name"`
+			BaseURL string `json:"baseUrl,omitempty"`
+			Error   string `json:"error,omitempty"`
+		}
+		entries := make([]environmentEntry, 0, len(environments))
+		for _, env := range environments {
+			entry := environmentEntry{Name: env}
+			if envConfig, err := cm.LoadEnvironment(env); err != nil {
+				entry.Error = err.Error()
+			} else {
+				entry.BaseURL = envConfig.BaseURL
+			}
+			entries = append(entries, entry)
+		}
+		return writeJSON(os.Stdout, entries)
+	}
+
+	fmt.Println("Available environments:")
+	fmt.Println()
+	for _, env := range environments {
+		envConfig, err := cm.LoadEnvironment(env)
+		if err != nil {
+			fmt.Printf("  ❌ %s (error loading)\n", env)
+			continue
+		}
+		fmt.Printf("  🌍 %s - %s\n", env, envConfig.BaseURL)
+	}
+	return nil
+}
+
+func newBodyCommand() *cobra.Command {
+	return groupCommand("body", "Manage body templates",
+		&cobra.Command{
+			Use:               "list <request-path>",
+			Short:             "List all body templates for a request",
+			Args:              exactArgs(1),
+			ValidArgsFunction: completeArgs(argRequest),
+			RunE:              listBodies,
+		},
+		&cobra.Command{
+			Use:               "set <request-path> <body-name>",
+			Short:             "Set active body template",
+			Args:              exactArgs(2),
+			ValidArgsFunction: completeArgs(argRequest, argBody),
+			RunE:              setActiveBody,
+		},
+		&cobra.Command{
+			Use:               "remove <request-path> <body-name>",
+			Short:             "Remove a body template",
+			Args:              exactArgs(2),
+			ValidArgsFunction: completeArgs(argRequest, argBody),
+			RunE:              removeBody,
+		},
+		newBodyNewCommand(),
+		&cobra.Command{
+			Use:   "edit <request-path> <body-name>",
+			Short: "Edit a body template in $EDITOR",
+			Long: `Open a body template in $VISUAL or $EDITOR (vi by default) and save it
+once it is valid JSON. {{placeholders}} may stand for any value, quoted or
+not. When the saved file doesn't parse, the error's line and column are
+shown and the editor opens again. XML, text and GraphQL bodies are saved
+as they are; binary bodies can't be edited. The name "default" edits the
+body inside the request file.`,
+			Args:              exactArgs(2),
+			ValidArgsFunction: completeArgs(argRequest, argBody),
+			RunE:              editBody,
+		},
+	)
+}
+
+func newBodyNewCommand() *cobra.Command {
+	var from string
+	var fromSchema, edit, activate bool
+	cmd := &cobra.Command{
+		Use:   "new <request-path> <body-name>",
+		Short: "Create a body template",
+		Long: `Create a body template, empty or seeded from another body (--from, where
+"default" is the body inside the request file) or from the OpenAPI schema
+the request was generated from (--schema). Names ending in .xml, .txt,
+.graphql or .bin create bodies of that type, sent with a matching
+Content-Type; any other name is a JSON body.`,
+		Example: `  api-man body new users/create-user admin --from default --edit
+  api-man body new users/create-user minimal --schema --set
+  api-man body new soap/get-quote envelope.xml --edit --set`,
+		Args:              exactArgs(2),
+		ValidArgsFunction: completeArgs(argRequest),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if from != "" && fromSchema {
+				return usageErrorf("--from and --schema cannot be used together")
+			}
+			return newBody(args[0], args[1], from, fromSchema, edit, activate)
+		},
+	}
+	cmd.Flags().StringVar(&from, "from", "", "copy this `body` (\"default\" for the request's own body)")
+	cmd.Flags().BoolVar(&fromSchema, "schema", false, "start from an example built from the request's OpenAPI body schema")
+	cmd.Flags().BoolVar(&edit, "edit", false, "open the new body in $EDITOR before saving it")
+	cmd.Flags().BoolVar(&activate, "set", false, "make the new body the request's active body")
+	cmd.RegisterFlagCompletionFunc("from", func(cmd *cobra.Command, args []string, toComplete string) ([]cobra.Completion, cobra.ShellCompDirective) {
+		return completeArgs(argRequest, argBody)(cmd, args[:min(len(args), 1)], toComplete)
+	})
+	return cmd
+}
+
+func newBody(requestPath, name, from string, fromSchema, edit, activate bool) error {
+	cm, err := openWorkspace()
+	if err != nil {
+		return err
+	}
+	if err := ValidateBodyName(name); err != nil {
+		return &usageError{fmt.Errorf("invalid body name: %w", err)}
+	}
+	bodies, _, err := cm.ListBodies(requestPath)
+	if err != nil {
+		return fmt.Errorf("listing bodies: %w", err)
+	}
+	if slices.Contains(bodies, name) {
+		return &BodyExistsError{Name: name}
+	}
+
+	content := "{}\n"
+	if filepath.Ext(bodyFileName(name)) != ".json" {
+		content = ""
+	}
+	switch {
+	case fromSchema:
+		if content, err = cm.SchemaExampleBody(requestPath); err != nil {
+			return err
+		}
+	case from != "":
+		if content, err = cm.LoadBodyContent(requestPath, from); err != nil {
+			return fmt.Errorf("loading body %q: %w", from, err)
+		}
+	}
+	if edit {
+		if content, err = editBodyContent(name, content); err != nil {
+			return err
+		}
+	}
+	if err := cm.SaveBodyContent(requestPath, name, content); err != nil {
+		return fmt.Errorf("saving body: %w", err)
+	}
+	fmt.Printf("✓ Created body template '%s' for %s\n", name, requestPath)
+	if activate {
+		if err := cm.SetActiveBody(requestPath, name); err != nil {
+			return fmt.Errorf("setting active body: %w", err)
+		}
+		fmt.Printf("✓ Set active body to '%s'\n", name)
+	}
+	return nil
+}
+
+func editBody(cmd *cobra.Command, args []string) error {
+	cm, err := openWorkspace()
+	if err != nil {
+		return err
+	}
+	requestPath, name := args[0], args[1]
+	if name != defaultBodyName {
+		bodies, _, err := cm.ListBodies(requestPath)
+		if err != nil {
+			return fmt.Errorf("listing bodies: %w", err)
+		}
+		if !slices.Contains(bodies, name) {
+			return fmt.Errorf("body %q not found for %s (create it with api-man body new)", name, requestPath)
+		}
+	}
+	if isBinaryBodyFile(bodyFileName(name)) {
+		return usageErrorf("body %q is binary and can't be edited as text", name)
+	}
+	content, err := cm.LoadBodyContent(requestPath, name)
+	if err != nil {
+		return fmt.Errorf("loading body: %w", err)
+	}
+	edited, err := editBodyContent(name, content)
+	if err != nil {
+		return err
+	}
+	if edited == content {
+		fmt.Printf("No changes to body '%s' of %s\n", name, requestPath)
+		return nil
+	}
+	if err := cm.SaveBodyContent(requestPath, name, edited); err != nil {
+		return fmt.Errorf("saving body: %w", err)
+	}
+	fmt.Printf("✓ Saved body '%s' of %s\n", name, requestPath)
+	return nil
+}
+
+// editBodyContent opens the content of body name in the editor until it is
+// saved as valid JSON (see checkBodyJSON), reporting each error, or the
+// user gives up. Non-JSON bodies are saved as they are.
+func editBodyContent(name, content string) (string, error) {
+	ext := filepath.Ext(bodyFileName(name))
+	for {
+		edited, err := editText(content, "api-man-body-*"+ext)
+		if err != nil {
+			return "", err
+		}
+		if ext != ".json" {
+			return edited, nil
+		}
+		err = checkBodyJSON(edited)
+		if err == nil {
+			return edited, nil
+		}
+		fmt.Fprintf(os.Stderr, "✗ %v\n", err)
+		if !term.IsTerminal(int(os.Stdin.Fd())) {
+			return "", errors.New("body not saved")
+		}
+		fmt.Fprint(os.Stderr, "Edit again? [Y/n] ")
+		line, _ := stdinReader.ReadString('\n')
+		if answer := strings.ToLower(strings.TrimSpace(line)); answer == "n" || answer == "no" {
+			return "", errors.New("body not saved")
+		}
+		content = edited
+	}
+}
+
+func listBodies(cmd *cobra.Command, args []string) error {
+	cm, err := openWorkspace()
+	if err != nil {
+		return err
+	}
+	requestPath := args[0]
+	bodyFiles, activeBody, err := cm.ListBodies(requestPath)
+	if err != nil {
+		return fmt.Errorf("listing bodies: %w", err)
+	}
+
+	fmt.Printf("Body templates for %s:\n\n", requestPath)
+
+	if len(bodyFiles) == 0 {
+		fmt.Println("No body templates found.")
+		fmt.Println("You can create body files like 'admin.json', 'envelope.xml', etc. in this directory.")
+		return nil
+	}
+
+	for _, name := range bodyFiles {
+		marker := " "
+		if name == activeBody {
+			marker = "●"
+		}
+		fmt.Printf("%s %s\n", marker, bodyFileName(name))
+
+		// Show first line of content as preview
+		if content, file, err := cm.readBodyFile(requestPath, name); err == nil {
+			lines := strings.Split(strings.TrimSpace(bodyPreview(file, content)), "\n")
+			if len(lines) > 0 {
+				preview := lines[0]
+				if len(preview) > 80 {
+					preview = preview[:77] + "..."
+				}
+				fmt.Printf("  %s\n", preview)
+			}
+		}
+		fmt.Println()
+	}
+
+	if activeBody != "" {
+		fmt.Printf("Active body file: %s\n", bodyFileName(activeBody))
+	} else {
+		fmt.Printf("Using default body from request.json\n")
+	}
+	if data, err := cm.ListRequestData(requestPath); err == nil && len(data) > 0 {
+		fmt.Printf("Data files (run with --data <name>): %s\n", strings.Join(data, ", "))
+	}
+	return nil
+}
+
+func setActiveBody(cmd *cobra.Command, args []string) error {
+	cm, err := openWorkspace()
+	if err != nil {
+		return err
+	}
+	requestPath, bodyName := args[0], args[1]
+	if err := cm.SetActiveBody(requestPath, bodyName); err != nil {
+		return fmt.Errorf("setting active body: %w", err)
+	}
+
+	fmt.Printf("✓ Set '%s' as active body template for %s\n", bodyName, requestPath)
+	return nil
+}
+
+func removeBody(cmd *cobra.Command, args []string) error {
+	cm, err := openWorkspace()
+	if err != nil {
+		return err
+	}
+	requestPath, bodyName := args[0], args[1]
+	if err := cm.RemoveBody(requestPath, bodyName); err != nil {
+		return fmt.Errorf("removing body: %w", err)
+	}
+
+	fmt.Printf("✓ Removed body template '%s' from %s\n", bodyName, requestPath)
+	return nil
+}
+
+func newNotesCommand() *cobra.Command {
+	return groupCommand("notes", "Read and write a request's notes",
+		&cobra.Command{
+			Use:               "show <request-path>",
+			Short:             "Print a request's notes",
+			Args:              exactArgs(1),
+			ValidArgsFunction: completeArgs(argRequest),
+			RunE:              showNotes,
+		},
+		&cobra.Command{
+			Use:   "edit <request-path>",
+			Short: "Edit a request's notes in $EDITOR",
+			Long: `Open a request's notes, requests/<path>/notes.md, in $VISUAL or $EDITOR
+(vi by default). Notes are Markdown for whatever the request file can't say:
+quirks, owners, the error a misconfigured tenant gets. They are shown in the
+TUI and by api-man docs generate. Saving empty notes removes the file.`,
+			Args:              exactArgs(1),
+			ValidArgsFunction: completeArgs(argRequest),
+			RunE:              editNotes,
+		},
+	)
+}
+
+func showNotes(cmd *cobra.Command, args []string) error {
+	cm, err := openWorkspace()
+	if err != nil {
+		return err
+	}
+	notes, err := cm.LoadNotes(args[0])
+	if err != nil {
+		return err
+	}
+	if notes == "" {
+		fmt.Printf("No notes for %s (add some with api-man notes edit %s)\n", args[0], args[0])
+		return nil
+	}
+	fmt.Print(notes)
+	return nil
+}
+
+func editNotes(cmd *cobra.Command, args []string) error {
+	cm, err := openWorkspace()
+	if err != nil {
+		return err
+	}
+	requestPath := args[0]
+	notes, err := cm.LoadNotes(requestPath)
+	if err != nil {
+		return err
+	}
+	edited, err := editText(notes, "api-man-notes-*.md")
+	if err != nil {
+		return err
+	}
+	if edited == notes {
+		fmt.Printf("No changes to the notes of %s\n", requestPath)
+		return nil
+	}
+	if err := cm.SaveNotes(requestPath, edited); err != nil {
+		return err
+	}
+	if strings.TrimSpace(edited) == "" {
+		fmt.Printf("✓ Removed the notes of %s\n", requestPath)
+	} else {
+		fmt.Printf("✓ Saved the notes of %s\n", requestPath)
+	}
+	return nil
+}
+
+func newExampleCommand() *cobra.Command {
+	var from, envName string
+	save := &cobra.Command{
+		Use:   "save <request-path> <name>",
+		Short: "Save the last response of a request as a named example",
+		Long: `Save a response from the history as an example of the request, in
+requests/<path>/examples/<name>.json: by default the latest response to the
+request (in --env, when given), or the history entry --from names. Examples
+are committed with the request and shown by api-man docs generate instead of
+the latest response. Request headers and Set-Cookie aren't saved.`,
+		Example: `  api-man run users/get-user dev && api-man example save users/get-user found
+  api-man example save users/get-user not-found --from 3`,
+		Args:              exactArgs(2),
+		ValidArgsFunction: completeArgs(argRequest, argExample),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return saveExample(args[0], args[1], from, envName)
+		},
+	}
+	save.Flags().StringVar(&from, "from", "", "save this history `entry` (an ID or a number from history list)")
+	save.Flags().StringVarP(&envName, "env", "e", "", "save the latest response in this `environment`")
+	save.RegisterFlagCompletionFunc("env", completeArgs(argEnvironment))
+
+	return groupCommand("example", "Manage a request's saved example responses",
+		save,
+		&cobra.Command{
+			Use:               "list <request-path>",
+			Short:             "List the examples of a request",
+			Args:              exactArgs(1),
+			ValidArgsFunction: completeArgs(argRequest),
+			RunE:              listExamples,
+		},
+		&cobra.Command{
+			Use:               "show <request-path> <name>",
+			Short:             "Show an example",
+			Args:              exactArgs(2),
+			ValidArgsFunction: completeArgs(argRequest, argExample),
+			RunE:              showExample,
+		},
+		&cobra.Command{
+			Use:               "remove <request-path> <name>",
+			Short:             "Remove an example",
+			Args:              exactArgs(2),
+			ValidArgsFunction: completeArgs(argRequest, argExample),
+			RunE:              removeExample,
+		},
+	)
+}
+
+func saveExample(requestPath, name, from, envName string) error {
+	cm, err := openWorkspace()
+	if err != nil {
+		return err
+	}
+	if from != "" && envName != "" {
+		return usageErrorf("--from and --env cannot be used together")
+	}
+	if err := ValidateBodyName(strings.TrimSuffix(name, ".json")); err != nil {
+		return &usageError{fmt.Errorf("invalid example name: %w", err)}
+	}
+	var entry *HistoryEntry
+	if from != "" {
+		if entry, err = cm.LoadHistory(from); err != nil {
+			return fmt.Errorf("loading history entry: %w", err)
+		}
+		if entry.Request != requestPath {
+			return fmt.Errorf("history entry %s is a run of %s, not %s", entry.ID, entry.Label(), requestPath)
+		}
+	} else if entry, err = cm.latestResponse(requestPath, envName); err != nil {
+		return err
+	}
+	example, err := cm.SaveExample(requestPath, name, entry)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("✓ Saved example '%s' of %s (%s, %s)\n", example.Name, requestPath, example.Status, example.Timestamp.Local().Format("2006-01-02 15:04"))
+	return nil
+}
+
+func listExamples(cmd *cobra.Command, args []string) error {
+	asJSON, err := jsonOutput()
+	if err != nil {
+		return err
+	}
+	cm, err := openWorkspace()
+	if err != nil {
+		return err
+	}
+	examples, err := cm.ListExamples(args[0])
+	if err != nil {
+		return err
+	}
+	if asJSON {
+		return writeJSON(os.Stdout, examples)
+	}
+	if len(examples) == 0 {
+		fmt.Printf("No examples for %s (save one with api-man example save %s <name>)\n", args[0], args[0])
+		return nil
+	}
+	fmt.Printf("Examples for %s:\n\n", args[0])
+	for _, example := range examples {
+		env := ""
+		if example.Environment != "" {
+			env = " in " + example.Environment
+		}
+		fmt.Printf("  %-20s %s (%s%s)\n", example.Name, example.Status, example.Timestamp.Local().Format("2006-01-02"), env)
+	}
+	return nil
+}
+
+func showExample(cmd *cobra.Command, args []string) error {
+	asJSON, err := jsonOutput()
+	if err != nil {
+		return err
+	}
+	cm, err := openWorkspace()
+	if err != nil {
+		return err
+	}
+	example, err := cm.LoadExample(args[0], args[1])
+	if err != nil {
+		return err
+	}
+	if asJSON {
+		return writeJSON(os.Stdout, example)
+	}
+	fmt.Printf("Example: %s\n", example.Name)
+	fmt.Printf("Saved from: %s", example.Timestamp.Local().Format(time.RFC3339))
+	if example.Environment != "" {
+		fmt.Printf(" in %s", example.Environment)
+	}
+	fmt.Printf("\n%s %s\n", example.Method, example.URL)
+	if example.RequestBody != "" {
+		fmt.Printf("\nRequest Body:\n")
+		printResponseBody([]byte(example.RequestBody), "")
+	}
+	fmt.Printf("\nStatus: %s (%dms)\n", example.Status, example.DurationMS)
+	fmt.Printf("Headers:\n")
+	for _, key := range sortedKeys(example.Headers) {
+		for _, value := range example.Headers[key] {
+			fmt.Printf("  %s: %s\n", key, value)
+		}
+	}
+	fmt.Printf("\nResponse Body:\n")
+	printResponseBody([]byte(example.Body), example.Headers.Get("Content-Type"))
+	return nil
+}
+
+func removeExample(cmd *cobra.Command, args []string) error {
+	cm, err := openWorkspace()
+	if err != nil {
+		return err
+	}
+	if err := cm.RemoveExample(args[0], args[1]); err != nil {
+		return err
+	}
+	fmt.Printf("✓ Removed example '%s' from %s\n", args[1], args[0])
+	return nil
+}
+
+func newImportCommand() *cobra.Command {
+	var options ImportOptions
+	postman := &cobra.Command{
+		Use:   "postman <collection.json> [environment.json...]",
+		Short: "Import a Postman collection and its environments",
+		Args:  argsBetween(1, -1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return importPostman(args, options)
+		},
+	}
+	postman.Flags().StringVar(&options.OverrideName, "name", "", "collection folder name (defaults to the collection name)")
+	postman.Flags().BoolVar(&options.Overwrite, "overwrite", false, "replace an existing collection folder and environments")
+
+	insomnia := &cobra.Command{
+		Use:   "insomnia <export.json>",
+		Short: "Import an Insomnia export",
+		Args:  exactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return importInsomnia(args[0], options)
+		},
+	}
+	insomnia.Flags().StringVar(&options.OverrideName, "name", "", "collection folder name (defaults to the workspace name)")
+	insomnia.Flags().BoolVar(&options.Overwrite, "overwrite", false, "replace an existing collection folder and environments")
+
+	curl := &cobra.Command{
+		Use:   `curl [--name <request>] [--overwrite] "curl ..."`,
+		Short: "Import a curl command (- or no command reads it from stdin)",
+		Example: `  api-man import curl --name users/create "curl -X POST https://api.example.com/users -d '{}'"
+  pbpaste | api-man import curl -`,
+		// The curl command carries its own flags, so importCurl parses only
+		// the arguments before it.
+		DisableFlagParsing: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return importCurl(cmd, args, &options)
+		},
+	}
+	curl.Flags().StringVar(&options.OverrideName, "name", "", "request path to create (defaults to curl/<method>-<path>)")
+	curl.Flags().BoolVar(&options.Overwrite, "overwrite", false, "replace an existing request at --name")
+
+	httpFile := &cobra.Command{
+		Use:   "http <file.http>",
+		Short: "Import the requests of a .http or .rest file",
+		Args:  exactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return importHTTPFile(args[0], options)
+		},
+	}
+	httpFile.Flags().StringVar(&options.OverrideName, "name", "", "collection folder name (defaults to the file name)")
+	httpFile.Flags().BoolVar(&options.Overwrite, "overwrite", false, "replace an existing collection folder and environments")
+
+	return groupCommand("import", "Import requests from another tool", postman, insomnia, curl, httpFile)
+}
+
+func importPostman(files []string, options ImportOptions) error {
+	data, err := os.ReadFile(files[0])
+	if err != nil {
+		return fmt.Errorf("reading collection: %w", err)
+	}
+	var envExports [][]byte
+	for _, envFile := range files[1:] {
+		envData, err := os.ReadFile(envFile)
+		if err != nil {
+			return fmt.Errorf("reading environment: %w", err)
+		}
+		envExports = append(envExports, envData)
+	}
+
+	cm, err := openWorkspace()
+	if err != nil {
+		return err
+	}
+
+	result, err := cm.ImportPostmanCollection(data, envExports, options)
+	if err != nil {
+		return fmt.Errorf("importing Postman collection: %w", err)
+	}
+	printImportResult(result)
+	return nil
+}
+
+func importInsomnia(file string, options ImportOptions) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("reading export: %w", err)
+	}
+
+	cm, err := openWorkspace()
+	if err != nil {
+		return err
+	}
+
+	result, err := cm.ImportInsomniaExport(data, options)
+	if err != nil {
+		return fmt.Errorf("importing Insomnia export: %w", err)
+	}
+	printImportResult(result)
+	return nil
+}
+
+func importHTTPFile(file string, options ImportOptions) error {
+	cm, err := openWorkspace()
+	if err != nil {
+		return err
+	}
+
+	result, err := cm.ImportHTTPFile(file, options)
+	if err != nil {
+		return fmt.Errorf("importing .http file: %w", err)
+	}
+	printImportResult(result)
+	return nil
+}
+
+func importCurl(cmd *cobra.Command, args []string, options *ImportOptions) error {
+	start := slices.IndexFunc(args, func(arg string) bool {
+		return arg == "-" || arg == "curl" || strings.HasPrefix(strings.TrimSpace(arg), "curl ")
+	})
+	if start < 0 {
+		start = len(args)
+	}
+	cmd.DisableFlagParsing = false
+	if err := cmd.ParseFlags(args[:start]); err != nil {
+		return &usageError{err}
+	}
+	if help, _ := cmd.Flags().GetBool("help"); help {
+		return cmd.Help()
+	}
+	if err := applyGlobalFlags(); err != nil {
+		return err
+	}
+	if extra := cmd.Flags().Args(); len(extra) > 0 {
+		return usageErrorf("unexpected argument %q before the curl command", extra[0])
+	}
+	args = args[start:]
+
+	command := strings.Join(args, " ")
+	if command == "" || command == "-" {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return fmt.Errorf("reading curl command: %w", err)
+		}
+		command = string(data)
+	}
+	if strings.TrimSpace(command) == "" {
+		return usageErrorf("no curl command given")
+	}
+
+	cm, err := openWorkspace()
+	if err != nil {
+		return err
+	}
+
+	result, err := cm.ImportCurl(strings.TrimSpace(command), options.OverrideName, options.Overwrite)
+	if err != nil {
+		return fmt.Errorf("importing curl command: %w", err)
+	}
+	for _, warning := range result.Warnings {
+		fmt.Printf("⚠️  %s\n", warning)
+	}
+	fmt.Printf("✓ Created request %s (%s %s)\n", result.Path, result.Config.Method, result.Config.URL)
+	return nil
+}
+
+func newExportCommand() *cobra.Command {
+	return groupCommand("export", "Export requests for other tools",
+		&cobra.Command{
+			Use:               "curl <request> <environment>",
+			Short:             "Print a request as a curl command",
+			Args:              exactArgs(2),
+			ValidArgsFunction: completeArgs(argRequest, argEnvironment),
+			RunE:              exportCurl,
+		},
+		newExportCodeCommand(),
+		&cobra.Command{
+			Use:   "http [request-or-folder] [environment]",
+			Short: "Print requests as a .http file",
+			Long: `Print requests as a .http file for the JetBrains HTTP Client or the VS Code
+REST Client: a single request, every request in a folder, or the whole
+workspace. URLs start with {{baseUrl}}; with an environment, its baseURL and
+non-secret variables are written as file variables.`,
+			Example:           "  api-man export http users dev > users.http",
+			Args:              argsBetween(0, 2),
+			ValidArgsFunction: completeArgs(argRequest, argEnvironment),
+			RunE:              exportHTTPFile,
+		},
+	)
+}
+
+func exportHTTPFile(cmd *cobra.Command, args []string) error {
+	cm, err := openWorkspace()
+	if err != nil {
+		return err
+	}
+	target, envName := "", ""
+	if len(args) > 0 {
+		target = args[0]
+	}
+	if len(args) > 1 {
+		envName = args[1]
+	}
+	text, err := cm.ExportHTTPFile(target, envName)
+	if err != nil {
+		return fmt.Errorf("exporting requests: %w", err)
+	}
+	fmt.Print(text)
+	return nil
+}
+
+func newExportCodeCommand() *cobra.Command {
+	var lang string
+	cmd := &cobra.Command{
+		Use:   "code <request> <environment> --lang go|python|js|java",
+		Short: "Print a request as a ready-to-run client snippet",
+		Example: `  api-man export code users/create-user dev --lang python
+  api-man export code users/get-user staging --lang go > main.go`,
+		Args:              exactArgs(2),
+		ValidArgsFunction: completeArgs(argRequest, argEnvironment),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if !slices.Contains(codeLanguages, lang) {
+				return usageErrorf("--lang must be one of %s", strings.Join(codeLanguages, ", "))
+			}
+			cm, err := openWorkspace()
+			if err != nil {
+				return err
+			}
+			snippet, err := cm.ExportCode(args[0], args[1], lang)
+			if err != nil {
+				return fmt.Errorf("exporting request: %w", err)
+			}
+			fmt.Print(snippet)
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&lang, "lang", "", "snippet `language`: "+strings.Join(codeLanguages, ", "))
+	cmd.RegisterFlagCompletionFunc("lang", cobra.FixedCompletions(codeLanguages, cobra.ShellCompDirectiveNoFileComp))
+	return cmd
+}
+
+func exportCurl(cmd *cobra.Command, args []string) error {
+	cm, err := openWorkspace()
+	if err != nil {
+		return err
+	}
+	command, err := cm.ExportCurl(args[0], args[1])
+	if err != nil {
+		return fmt.Errorf("exporting request: %w", err)
+	}
+	fmt.Println(command)
+	return nil
+}
+
+func newOpenAPICommand() *cobra.Command {
+	var opts OpenAPIExportOptions
+	export := &cobra.Command{
+		Use:   "export [file]",
+		Short: "Write an OpenAPI 3 document describing the workspace's requests",
+		Long: `Write an OpenAPI 3 document describing the workspace's requests, the
+reverse of generate. Body schemas are inferred from the inline body and body
+templates, response schemas from the responses recorded in the history. The
+document is YAML, or JSON when file ends in .json.`,
+		Example: `  api-man openapi export openapi.yaml
+  api-man openapi export --requests users --title "Users API" users.json`,
+		Args: argsBetween(0, 1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return exportOpenAPI(args, opts)
+		},
+	}
+	export.Flags().StringVar(&opts.Target, "requests", "", "only describe this request or `directory` of requests")
+	export.Flags().StringVar(&opts.Title, "title", "", "document title (default: \"<workspace directory> API\")")
+	export.Flags().StringVar(&opts.Version, "version", "", "API version in the document (default: 1.0.0)")
+	return groupCommand("openapi", "Work with OpenAPI documents", export)
+}
+
+func exportOpenAPI(args []string, opts OpenAPIExportOptions) error {
+	cm, err := openWorkspace()
+	if err != nil {
+		return err
+	}
+	result, err := cm.ExportOpenAPI(opts)
+	if err != nil {
+		return fmt.Errorf("exporting OpenAPI: %w", err)
+	}
+	for _, warning := range result.Warnings {
+		fmt.Fprintf(os.Stderr, "⚠️  %s\n", warning)
+	}
+
+	asJSON := len(args) == 1 && strings.EqualFold(filepath.Ext(args[0]), ".json")
+	data, err := EncodeOpenAPI(result.Spec, asJSON)
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(args[0]), 0755); err != nil {
+		return fmt.Errorf("creating output directory: %w", err)
+	}
+	if err := os.WriteFile(args[0], data, 0644); err != nil {
+		return fmt.Errorf("writing OpenAPI document: %w", err)
+	}
+	fmt.Printf("✓ Described %d operation(s) in %s\n", result.Operations, args[0])
+	return nil
+}
+
+func newDocsCommand() *cobra.Command {
+	var format, title string
+	generate := &cobra.Command{
+		Use:   "generate [file]",
+		Short: "Render the workspace's requests as Markdown or HTML documentation",
+		Example: `  api-man docs generate API.md
+  api-man docs generate --format html --title "Billing API" public/index.html`,
+		Args: argsBetween(0, 1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return generateDocs(args, format, title)
+		},
+	}
+	generate.Flags().StringVar(&format, "format", "markdown", "documentation `format`: "+strings.Join(docsFormats, " or "))
+	generate.Flags().StringVar(&title, "title", "", "documentation title (default: \"<workspace directory> API\")")
+	generate.RegisterFlagCompletionFunc("format", cobra.FixedCompletions(docsFormats, cobra.ShellCompDirectiveNoFileComp))
+	return groupCommand("docs", "Generate documentation from the workspace", generate)
+}
+
+func generateDocs(args []string, format, title string) error {
+	if !slices.Contains(docsFormats, format) {
+		return usageErrorf("unknown docs format %q (expected one of %s)", format, strings.Join(docsFormats, ", "))
+	}
+	cm, err := openWorkspace()
+	if err != nil {
+		return err
+	}
+	docs, err := cm.BuildDocs(title)
+	if err != nil {
+		return fmt.Errorf("generating docs: %w", err)
+	}
+	if len(args) == 0 {
+		return WriteDocs(os.Stdout, docs, format)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(args[0]), 0755); err != nil {
+		return fmt.Errorf("creating docs directory: %w", err)
+	}
+	f, err := os.Create(args[0])
+	if err != nil {
+		return fmt.Errorf("creating docs: %w", err)
+	}
+	if err := WriteDocs(f, docs, format); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("writing docs: %w", err)
+	}
+	count := 0
+	for _, section := range docs.Sections {
+		count += len(section.Requests)
+	}
+	fmt.Printf("✓ Documented %d request(s) in %s\n", count, args[0])
+	return nil
+}
+
+func printImportResult(result *OpenAPIImportResult) {
+	for _, warning := range result.Warnings {
+		fmt.Printf("⚠️  %s\n", warning)
+	}
+	fmt.Printf("✓ Imported %d request(s) into requests/%s/\n", result.Imported, result.Collection)
+	if result.Bodies > 0 {
+		fmt.Printf("✓ Saved %d body template(s)\n", result.Bodies)
+	}
+	for _, env := range result.Environments {
+		fmt.Printf("✓ Wrote environment %s\n", env)
+	}
+}
+
+func newChainCommand() *cobra.Command {
+	return groupCommand("chain", "Run request chains from chains/",
+		&cobra.Command{
+			Use:   "list",
+			Short: "List all chains",
+			Args:  exactArgs(0),
+			RunE:  listChains,
+		},
+		newChainRunCommand(),
+	)
+}
+
+func newChainRunCommand() *cobra.Command {
+	var requestID string
+	var shared bool
+	cmd := &cobra.Command{
+		Use:               "run <chain-name> <environment>",
+		Short:             "Run a chain, passing extracted values between steps",
+		Args:              exactArgs(2),
+		ValidArgsFunction: completeArgs(argChain, argEnvironment),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runChain(args[0], args[1], requestID, shared)
+		},
+	}
+	cmd.Flags().StringVar(&requestID, "request-id", "", "send this correlation `id` with every step")
+	cmd.Flags().BoolVar(&shared, "shared-request-id", false, "send one fresh correlation ID with every step (like sharedRequestId in the chain)")
+	return cmd
+}
+
+func listChains(cmd *cobra.Command, args []string) error {
+	cm, err := openWorkspace()
+	if err != nil {
+		return err
+	}
+	names, err := cm.ListChains()
+	if err != nil {
+		return fmt.Errorf("listing chains: %w", err)
+	}
+	if len(names) == 0 {
+		fmt.Println("No chains found. Create chains/<name>.json to define one.")
+		return nil
+	}
+	fmt.Println("Available chains:")
+	fmt.Println()
+	for _, name := range names {
+		chain, err := cm.LoadChain(name)
+		if err != nil {
+			fmt.Printf("  ❌ %s (%v)\n", name, err)
+			continue
+		}
+		fmt.Printf("  🔗 %s - %d step(s)\n", name, len(chain.Steps))
+		if chain.Description != "" {
+			fmt.Printf("     %s\n", chain.Description)
+		}
+	}
+	return nil
+}
+
+func runChain(name, envName, requestID string, shared bool) error {
+	cm, err := openWorkspace()
+	if err != nil {
+		return err
+	}
+	chain, err := cm.LoadChain(name)
+	if err != nil {
+		return fmt.Errorf("loading chain: %w", err)
+	}
+	chain.RequestID = cmp.Or(requestID, chain.RequestID)
+	chain.SharedRequestID = chain.SharedRequestID || shared
+	result := cm.RunChain(chain, envName, os.Stdout)
+	if !result.Passed {
+		return exitCode(exitFailure)
+	}
+	return nil
+}
+
+func newRunAllCommand() *cobra.Command {
+	var parallel int
+	cmd := &cobra.Command{
+		Use:   "run-all <directory|glob> <environment>",
+		Short: "Execute every request under a directory at once and summarise them",
+		Example: `  api-man run-all users dev --parallel 8
+  api-man run-all '*/get-*' staging --output json`,
+		Args:              exactArgs(2),
+		ValidArgsFunction: completeArgs(argRequest, argEnvironment),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runAll(args[0], args[1], parallel)
+		},
+	}
+	cmd.Flags().IntVarP(&parallel, "parallel", "p", 4, "number of requests to run at once")
+	return cmd
+}
+
+func runAll(target, envName string, parallel int) error {
+	asJSON, err := jsonOutput()
+	if err != nil {
+		return err
+	}
+	if parallel < 1 {
+		return usageErrorf("--parallel must be at least 1")
+	}
+	cm, err := openWorkspace()
+	if err != nil {
+		return err
+	}
+	paths, err := cm.ResolveRequestPattern(target)
+	if err != nil {
+		return fmt.Errorf("resolving requests: %w", err)
+	}
+
+	// Ctrl+C aborts the requests in flight and skips the rest, and the
+	// summary is still printed.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	var progress func(BatchResult)
+	if !asJSON {
+		progress = func(result BatchResult) { printBatchResult(os.Stdout, result) }
+	}
+	results := cm.RunBatch(ctx, paths, envName, parallel, progress)
+
+	if asJSON {
+		if err := writeJSON(os.Stdout, results); err != nil {
+			return err
+		}
+	} else {
+		fmt.Println()
+		printBatchSummary(os.Stdout, results)
+	}
+	if ctx.Err() != nil {
+		return exitCode(exitCancelled)
+	}
+	for _, result := range results {
+		if !result.OK() {
+			return exitCode(exitFailure)
+		}
+	}
+	return nil
+}
+
+func newWatchCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:               "watch <request-path> <environment>",
+		Short:             "Re-run a request whenever its files change",
+		Args:              exactArgs(2),
+		ValidArgsFunction: completeArgs(argRequest, argEnvironment),
+		RunE:              watchRequest,
+	}
+}
+
+func watchRequest(cmd *cobra.Command, args []string) error {
+	cm, err := openWorkspace()
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if err := cm.WatchRequest(ctx, args[0], args[1], RequestOptions{}, os.Stdout); err != nil {
+		return fmt.Errorf("watching request: %w", err)
+	}
+	return nil
+}
+
+func newDiffCommand() *cobra.Command {
+	var options DiffOptions
+	cmd := &cobra.Command{
+		Use:               "diff <request-path> <env-a> <env-b>",
+		Short:             "Compare a request's responses from two environments",
+		Example:           "  api-man diff users/get-user staging prod --ignore updatedAt --ignore '$.items[*].id'",
+		Args:              exactArgs(3),
+		ValidArgsFunction: completeArgs(argRequest, argEnvironment, argEnvironment),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return diffEnvironments(args, options)
+		},
+	}
+	cmd.Flags().Var((*stringListFlag)(&options.Ignore), "ignore", "body `field` to ignore: a member name or a path like $.meta.id (repeatable)")
+	cmd.Flags().Var((*stringListFlag)(&options.IgnoreHeaders), "ignore-header", "response `header` to ignore (repeatable; Date is always ignored)")
+	cmd.Flags().BoolVar(&options.XMLToJSON, "xml-to-json", false, "compare XML bodies field by field by converting them to JSON")
+	return cmd
+}
+
+func diffEnvironments(args []string, options DiffOptions) error {
+	cm, err := openWorkspace()
+	if err != nil {
+		return err
+	}
+
+	diff, err := cm.DiffEnvironments(args[0], args[1], args[2], options)
+	if err != nil {
+		return fmt.Errorf("diffing environments: %w", err)
+	}
+	PrintEnvironmentDiff(os.Stdout, diff)
+	if !diff.Equal() {
+		return exitCode(exitFailure)
+	}
+	return nil
+}
+
+func newContractCommand() *cobra.Command {
+	var opts PactExportOptions
+	export := &cobra.Command{
+		Use:   "export <consumer> <provider> [file]",
+		Short: "Write a Pact contract from the requests in the history",
+		Long: `Write a Pact (specification v2) contract between consumer and provider with
+an interaction for every request that has a response in the history: the
+latest execution's method, path, query, Content-Type and Accept headers and
+body, and the response's status, Content-Type and body. Paths are relative to
+the environment's base URL. Requests never run are skipped with a warning.
+
+Response bodies are matched by value; --match-types only checks the JSON
+types, for responses whose values change between runs. The contract is
+printed, or written to file.`,
+		Example: `  api-man contract export web-app users-api --requests users pacts/web-app-users-api.json
+  api-man contract export web-app users-api --env staging --match-types`,
+		Args: argsBetween(2, 3),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts.Consumer, opts.Provider = args[0], args[1]
+			return exportContract(args[2:], opts)
+		},
+	}
+	export.Flags().StringVar(&opts.Target, "requests", "", "only include this request or `directory` of requests")
+	export.Flags().StringVarP(&opts.Environment, "env", "e", "", "only use executions in this environment")
+	export.Flags().BoolVar(&opts.MatchTypes, "match-types", false, "match response bodies by type instead of by value")
+
+	verify := &cobra.Command{
+		Use:   "verify <pact.json> <environment>",
+		Short: "Verify a provider environment against a Pact contract",
+		Long: `Send the request of every interaction in a Pact contract to environment, with
+its headers, cookies and auth added, and check each response meets the
+consumer's expectation: the same status, the listed headers with the same
+values, and a body containing the expected one (extra object members are
+allowed; arrays must match unless a type rule applies). Pact v2 type and
+regex matching rules are honoured. Provider states are shown but not set up.
+
+Exits 1 if any interaction fails. Use -o json for machine-readable output.`,
+		Example: "  api-man contract verify pacts/web-app-users-api.json staging",
+		Args:    exactArgs(2),
+		ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]cobra.Completion, cobra.ShellCompDirective) {
+			if len(args) == 0 {
+				return nil, cobra.ShellCompDirectiveDefault
+			}
+			return completeArgs(argNone, argEnvironment)(cmd, args, toComplete)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return verifyContract(args[0], args[1])
+		},
+	}
+	return groupCommand("contract", "Export and verify Pact consumer contracts", export, verify)
+}
+
+func exportContract(args []string, opts PactExportOptions) error {
+	cm, err := openWorkspace()
+	if err != nil {
+		return err
+	}
+	pact, warnings, err := cm.ExportPact(opts)
+	if err != nil {
+		return fmt.Errorf("exporting contract: %w", err)
+	}
+	for _, warning := range warnings {
+		fmt.Fprintf(os.Stderr, "⚠️  %s\n", warning)
+	}
+	if len(args) == 0 {
+		return writeJSON(os.Stdout, pact)
+	}
+	if err := os.MkdirAll(filepath.Dir(args[0]), 0755); err != nil {
+		return fmt.Errorf("creating output directory: %w", err)
+	}
+	if err := writeJSONFile(args[0], pact); err != nil {
+		return fmt.Errorf("writing contract: %w", err)
+	}
+	fmt.Printf("✓ Wrote %d interaction(s) to %s\n", len(pact.Interactions), args[0])
+	return nil
+}
+
+func verifyContract(path, envName string) error {
+	asJSON, err := jsonOutput()
+	if err != nil {
+		return err
+	}
+	cm, err := openWorkspace()
+	if err != nil {
+		return err
+	}
+	pact, err := LoadPact(path)
+	if err != nil {
+		return err
+	}
+
+	if !asJSON {
+		fmt.Printf("Verifying %d interaction(s) of %s against %s\n\n", len(pact.Interactions), contractParties(pact), envName)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	verifications, err := cm.VerifyPact(ctx, pact, envName, func(v *PactVerification) {
+		if !asJSON {
+			printPactVerification(v)
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("verifying contract: %w", err)
+	}
+
+	failed := 0
+	for _, v := range verifications {
+		if !v.OK() {
+			failed++
+		}
+	}
+	if asJSON {
+		if err := writeJSON(os.Stdout, verifications); err != nil {
+			return err
+		}
+	} else {
+		fmt.Println()
+		if failed == 0 {
+			fmt.Printf("✓ %s meets all %d interaction(s)\n", envName, len(verifications))
+		} else {
+			fmt.Printf("✗ %d of %d interaction(s) failed\n", failed, len(verifications))
+		}
+	}
+	if ctx.Err() != nil {
+		return exitCode(exitCancelled)
+	}
+	if failed > 0 {
+		return exitCode(exitFailure)
+	}
+	return nil
+}
+
+// contractParties describes who a contract is between.
+func contractParties(pact *PactFile) string {
+	return fmt.Sprintf("%s → %s", cmp.Or(pact.Consumer.Name, "consumer"), cmp.Or(pact.Provider.Name, "provider"))
+}
+
+func printPactVerification(v *PactVerification) {
+	label := v.Interaction.Description
+	if v.Interaction.ProviderState != "" {
+		label += " (given " + v.Interaction.ProviderState + ")"
+	}
+	switch {
+	case v.Error != "":
+		fmt.Printf("✗ %s: %s\n", label, v.Error)
+	case v.OK():
+		fmt.Printf("✓ %s (%s, %dms)\n", label, v.Result.Status, v.Result.DurationMS())
+	default:
+		fmt.Printf("✗ %s (%s)\n", label, v.Result.Status)
+		for _, mismatch := range v.Mismatches {
+			fmt.Printf("    %s\n", mismatch)
+		}
+	}
+}
+
+func newReplayCommand() *cobra.Command {
+	var options DiffOptions
+	cmd := &cobra.Command{
+		Use:   "replay <session> <environment>",
+		Short: "Replay a recorded session against an environment and compare responses",
+		Long: `Send the requests of a session recorded with api-man proxy --record again,
+in their original order and with their original bodies, against another
+environment, and report where its responses differ from the recorded ones.`,
+		Example:           "  api-man replay legacy rewrite --ignore updatedAt --ignore-header X-Request-Id",
+		Args:              exactArgs(2),
+		ValidArgsFunction: completeArgs(argSession, argEnvironment),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return replaySession(args[0], args[1], options)
+		},
+	}
+	cmd.Flags().Var((*stringListFlag)(&options.Ignore), "ignore", "body `field` to ignore: a member name or a path like $.meta.id (repeatable)")
+	cmd.Flags().Var((*stringListFlag)(&options.IgnoreHeaders), "ignore-header", "response `header` to ignore (repeatable; Date, Content-Length and Content-Encoding are always ignored)")
+	cmd.Flags().BoolVar(&options.XMLToJSON, "xml-to-json", false, "compare XML bodies field by field by converting them to JSON")
+	return cmd
+}
+
+func replaySession(name, envName string, options DiffOptions) error {
+	cm, err := openWorkspace()
+	if err != nil {
+		return err
+	}
+
+	entries, err := cm.LoadSession(name)
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		fmt.Printf("⚠️  Session %s has no requests\n", name)
+		return nil
+	}
+
+	fmt.Printf("Replaying %d request(s) from session %s against %s\n\n", len(entries), name, envName)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	steps, err := cm.ReplaySession(ctx, entries, envName, options, func(step *ReplayStep) {
+		printReplayStep(os.Stdout, step)
+	})
+	if err != nil {
+		return fmt.Errorf("replaying session: %w", err)
+	}
+
+	failed := 0
+	for _, step := range steps {
+		if !step.OK() {
+			failed++
+		}
+	}
+	fmt.Println()
+	if failed == 0 {
+		fmt.Printf("✓ All %d response(s) match the recording\n", len(steps))
+	} else {
+		fmt.Printf("✗ %d of %d response(s) differ from the recording\n", failed, len(steps))
+	}
+	if ctx.Err() != nil {
+		return exitCode(exitCancelled)
+	}
+	if failed > 0 {
+		return exitCode(exitFailure)
+	}
+	return nil
+}
+
+func printReplayStep(out io.Writer, step *ReplayStep) {
+	target := step.Recorded.URL
+	if u, err := url.Parse(target); err == nil {
+		target = u.RequestURI()
+	}
+	label := fmt.Sprintf("%d. %s %s", step.Index, step.Recorded.Method, target)
+	switch {
+	case step.Err != nil:
+		fmt.Fprintf(out, "✗ %s: %v\n", label, step.Err)
+	case step.OK():
+		fmt.Fprintf(out, "✓ %s (%s, %dms)\n", label, step.Diff.B.Status, step.Diff.B.DurationMS())
+	default:
+		fmt.Fprintf(out, "✗ %s\n", label)
+		var diff strings.Builder
+		PrintEnvironmentDiff(&diff, step.Diff)
+		for _, line := range strings.Split(strings.TrimRight(diff.String(), "\n"), "\n") {
+			if line == "" {
+				fmt.Fprintln(out)
+				continue
+			}
+			fmt.Fprintf(out, "    %s\n", line)
+		}
+	}
+}
+
+func newSuiteCommand() *cobra.Command {
+	var parallel int
+	var enforceBudgets bool
+	var reports reportFlag
+	run := &cobra.Command{
+		Use:               "run <suite-name> <environment>",
+		Short:             "Run a suite's requests and summarise them",
+		Example:           "  api-man suite run smoke staging --parallel 4 --report junit=report.xml",
+		Args:              exactArgs(2),
+		ValidArgsFunction: completeArgs(argSuite, argEnvironment),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runSuite(args[0], args[1], parallel, enforceBudgets, reports)
+		},
+	}
+	run.Flags().IntVar(&parallel, "parallel", 0, "number of requests to run at once (default: the suite's parallel setting)")
+	run.Flags().BoolVar(&enforceBudgets, "enforce-budgets", false, "fail requests that take longer than their latencyBudgetMs")
+	run.Flags().Var(&reports, "report", "also write a `format[=file]` report: junit or tap (stdout when no file is given)")
+	run.RegisterFlagCompletionFunc("report", cobra.FixedCompletions(reportFormats, cobra.ShellCompDirectiveNoFileComp))
+
+	return groupCommand("suite", "Run request suites from suites/",
+		&cobra.Command{
+			Use:   "list",
+			Short: "List all suites",
+			Args:  exactArgs(0),
+			RunE:  listSuites,
+		},
+		run,
+	)
+}
+
+func listSuites(cmd *cobra.Command, args []string) error {
+	cm, err := openWorkspace()
+	if err != nil {
+		return err
+	}
+	names, err := cm.ListSuites()
+	if err != nil {
+		return fmt.Errorf("listing suites: %w", err)
+	}
+	if len(names) == 0 {
+		fmt.Println("No suites found. Create suites/<name>.json to define one.")
+		return nil
+	}
+	fmt.Println("Available suites:")
+	fmt.Println()
+	for _, name := range names {
+		suite, err := cm.LoadSuite(name)
+		if err != nil {
+			fmt.Printf("  ❌ %s (%v)\n", name, err)
+			continue
+		}
+		fmt.Printf("  🧪 %s - %d request(s)\n", name, len(suite.Requests))
+		if suite.Description != "" {
+			fmt.Printf("     %s\n", suite.Description)
+		}
+	}
+	return nil
+}
+
+func runSuite(name, envName string, parallel int, enforceBudgets bool, reports reportFlag) error {
+	cm, err := openWorkspace()
+	if err != nil {
+		return err
+	}
+	suite, err := cm.LoadSuite(name)
+	if err != nil {
+		return fmt.Errorf("loading suite: %w", err)
+	}
+	if parallel > 0 {
+		suite.Parallel = parallel
+	}
+	if enforceBudgets {
+		suite.EnforceBudgets = true
+	}
+	report, err := cm.RunSuite(suite, envName, reports.progressWriter())
+	if err != nil {
+		return fmt.Errorf("running suite: %w", err)
+	}
+	if err := reports.write(report); err != nil {
+		return err
+	}
+	if !report.OK() {
+		return exitCode(exitFailure)
+	}
+	return nil
+}
+
+func newTestCommand() *cobra.Command {
+	var reports reportFlag
+	cmd := &cobra.Command{
+		Use:               "test <request|directory> <environment>",
+		Short:             "Run requests and check their assertions",
+		Example:           "  api-man test users dev --report junit=report.xml --report tap",
+		Args:              exactArgs(2),
+		ValidArgsFunction: completeArgs(argRequest, argEnvironment),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runTests(args[0], args[1], reports)
+		},
+	}
+	cmd.Flags().Var(&reports, "report", "also write a `format[=file]` report: junit or tap (stdout when no file is given)")
+	cmd.RegisterFlagCompletionFunc("report", cobra.FixedCompletions(reportFormats, cobra.ShellCompDirectiveNoFileComp))
+	return cmd
+}
+
+func runTests(target, envName string, reports reportFlag) error {
+	cm, err := openWorkspace()
+	if err != nil {
+		return err
+	}
+
+	paths, err := cm.ResolveRequestTargets(target)
+	if err != nil {
+		return fmt.Errorf("resolving requests: %w", err)
+	}
+
+	report := cm.RunTests(paths, envName, reports.progressWriter())
+	if err := reports.write(report); err != nil {
+		return err
+	}
+	if !report.OK() {
+		return exitCode(exitFailure)
+	}
+	return nil
+}
+
+func newLoadCommand() *cobra.Command {
+	var options LoadTestOptions
+	cmd := &cobra.Command{
+		Use:               "load <request-path> <environment>",
+		Short:             "Load test a request",
+		Example:           "  api-man load users/get-users dev --concurrency 50 --duration 30s",
+		Args:              exactArgs(2),
+		ValidArgsFunction: completeArgs(argRequest, argEnvironment),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runLoadTest(args[0], args[1], options)
+		},
+	}
+	cmd.Flags().IntVar(&options.Concurrency, "concurrency", 10, "number of concurrent workers")
+	cmd.Flags().DurationVar(&options.Duration, "duration", 10*time.Second, "how long to run")
+	cmd.Flags().IntVar(&options.Requests, "requests", 0, "stop after this many requests (0 = no limit)")
+	return cmd
+}
+
+func runLoadTest(requestPath, envName string, options LoadTestOptions) error {
+	cm, err := openWorkspace()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Load testing %s (%s) with %d workers for %s\n\n", requestPath, envName, options.Concurrency, options.Duration)
+	report, err := cm.RunLoadTest(requestPath, envName, options)
+	if err != nil {
+		return fmt.Errorf("running load test: %w", err)
+	}
+	PrintLoadTestReport(os.Stdout, report)
+	return nil
+}
+
+func newProxyCommand() *cobra.Command {
+	var options RecordOptions
+	var port int
+	var host string
+	cmd := &cobra.Command{
+		Use:   "proxy",
+		Short: "Run a proxy that records traffic into requests",
+		Long: `Run an HTTP proxy that logs the traffic passing through it. With --record,
+each exchange is saved to the named session and every new method and path
+becomes a request in the collection of that name, with an environment of
+the same name pointing at the API.
+
+Without --target, point clients at the proxy with HTTP_PROXY; HTTPS
+traffic is tunnelled without being recorded. With --target, the proxy is
+a reverse proxy: send requests to it instead of the API.
+
+The proxy only accepts connections from this machine unless --listen names
+another address, such as 0.0.0.0 for every interface.`,
+		Example: "  api-man proxy --port 8888 --record myapi\n  api-man proxy --target https://api.example.com --record myapi",
+		Args:    exactArgs(0),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runProxy(host, port, options)
+		},
+	}
+	cmd.Flags().IntVar(&port, "port", 8888, "port to listen on")
+	cmd.Flags().StringVar(&host, "listen", "127.0.0.1", "`address` to listen on")
+	cmd.Flags().StringVar(&options.Name, "record", "", "record traffic as session and collection `name`")
+	cmd.Flags().StringVar(&options.Target, "target", "", "act as a reverse proxy for `url`")
+	return cmd
+}
+
+func runProxy(host string, port int, options RecordOptions) error {
+	cm, err := openWorkspace()
+	if err != nil {
+		return err
+	}
+	options.Log = os.Stdout
+	recorder, err := cm.NewRecorder(options)
+	if err != nil {
+		return fmt.Errorf("starting proxy: %w", err)
+	}
+	defer recorder.Close()
+
+	listener, err := net.Listen("tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+	if err != nil {
+		return fmt.Errorf("starting proxy: %w", err)
+	}
+	address := listenURL(host, port)
+	if options.Target != "" {
+		fmt.Printf("✓ Forwarding %s to %s\n", address, options.Target)
+	} else {
+		fmt.Printf("✓ Proxying on %s (set HTTP_PROXY=%s)\n", address, address)
+	}
+	if options.Name != "" {
+		fmt.Printf("Recording session %s into requests/%s/ (Ctrl+C to stop)\n", options.Name, options.Name)
+	}
+	fmt.Println()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	server := &http.Server{Handler: recorder}
+	go func() {
+		<-ctx.Done()
+		server.Shutdown(context.Background())
+	}()
+	if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("running proxy: %w", err)
+	}
+
+	fmt.Println()
+	if options.Name == "" {
+		fmt.Printf("✓ Proxied %d exchange(s)\n", recorder.Exchanges)
+		return nil
+	}
+	fmt.Printf("✓ Recorded %d exchange(s) to session %s; %d new request(s) in requests/%s/\n", recorder.Exchanges, options.Name, len(recorder.Created), options.Name)
+	return nil
+}
+
+func newGRPCCommand() *cobra.Command {
+	return groupCommand("grpc", "Inspect gRPC services",
+		&cobra.Command{
+			Use:               "list <environment>",
+			Short:             "List gRPC services via server reflection",
+			Args:              exactArgs(1),
+			ValidArgsFunction: completeArgs(argEnvironment),
+			RunE:              listGRPCServices,
+		},
+	)
+}
+
+func listGRPCServices(cmd *cobra.Command, args []string) error {
+	cm, err := openWorkspace()
+	if err != nil {
+		return err
+	}
+
+	services, err := cm.ListGRPCServices(args[0])
+	if err != nil {
+		return fmt.Errorf("listing gRPC services: %w", err)
+	}
+	if len(services) == 0 {
+		fmt.Println("No services found.")
+		return nil
+	}
+	for _, service := range services {
+		fmt.Printf("📦 %s\n", service.Name)
+		for _, method := range service.Methods {
+			input, output := method.Input, method.Output
+			if method.ClientStream {
+				input = "stream " + input
+			}
+			if method.ServerStream {
+				output = "stream " + output
+			}
+			fmt.Printf("  %s(%s) returns (%s)\n", method.Name, input, output)
+		}
+		fmt.Println()
+	}
+	return nil
+}
+
+func newHistoryCommand() *cobra.Command {
+	var count int
+	list := &cobra.Command{
+		Use:   "list",
+		Short: "List recent executions, newest first",
+		Args:  exactArgs(0),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return listHistory(count)
+		},
+	}
+	list.Flags().IntVarP(&count, "count", "n", 20, "number of entries to show (0 for all)")
+
+	var query HistoryQuery
+	var since string
+	search := &cobra.Command{
+		Use:   "search",
+		Short: "Find executions by request, status, environment and time",
+		Long: `List the stored executions matching every filter given, newest first.
+--path is a glob matched against the request path, where * also matches
+across slashes; --status takes a code (500), a class (5xx) or error for
+requests that got no response; --since takes a duration (30m, 24h, 7d), a
+date or an RFC 3339 time. Entries are listed by ID for history show.`,
+		Example: `  api-man history search --status 500 --since 24h --path 'users/*'
+  api-man history search --env prod --status 5xx -o json`,
+		Args: exactArgs(0),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if since != "" {
+				t, err := parseHistorySince(since, time.Now())
+				if err != nil {
+					return usageErrorf("%v", err)
+				}
+				query.Since = t
+			}
+			if _, _, err := query.where(); err != nil {
+				return usageErrorf("%v", err)
+			}
+			return searchHistory(query)
+		},
+	}
+	search.Flags().StringVar(&query.Request, "path", "", "request path glob, e.g. users/*")
+	search.Flags().StringVarP(&query.Environment, "env", "e", "", "environment name")
+	search.Flags().StringVar(&query.Method, "method", "", "HTTP method")
+	search.Flags().StringVar(&query.Status, "status", "", "status code, class (5xx) or error")
+	search.Flags().StringVar(&since, "since", "", "only executions since this duration ago, date or time")
+	search.Flags().IntVarP(&query.Limit, "count", "n", 50, "number of entries to show (0 for all)")
+
+	return groupCommand("history", "Browse previously executed requests",
+		list,
+		search,
+		&cobra.Command{
+			Use:   "show <id|n>",
+			Short: "Show a stored request and response (1 = latest)",
+			Args:  exactArgs(1),
+			RunE:  showHistory,
+		},
+		&cobra.Command{
+			Use:   "clear",
+			Short: "Delete all stored history",
+			Args:  exactArgs(0),
+			RunE:  clearHistory,
+		},
+	)
+}
+
+func listHistory(count int) error {
+	asJSON, err := jsonOutput()
+	if err != nil {
+		return err
+	}
+	cm, err := openWorkspace()
+	if err != nil {
+		return err
+	}
+	entries, err := cm.ListHistory(count)
+	if err != nil {
+		return fmt.Errorf("listing history: %w", err)
+	}
+	if asJSON {
+		return writeJSON(os.Stdout, entries)
+	}
+	if len(entries) == 0 {
+		fmt.Println("No history yet. Executed requests are recorded in .api-man/history.db.")
+		return nil
+	}
+	for i, entry := range entries {
+		printHistoryLine(fmt.Sprintf("%3d", i+1), entry)
+	}
+	return nil
+}
+
+func searchHistory(query HistoryQuery) error {
+	asJSON, err := jsonOutput()
+	if err != nil {
+		return err
+	}
+	cm, err := openWorkspace()
+	if err != nil {
+		return err
+	}
+	entries, err := cm.SearchHistory(query)
+	if err != nil {
+		return fmt.Errorf("searching history: %w", err)
+	}
+	if asJSON {
+		return writeJSON(os.Stdout, entries)
+	}
+	if len(entries) == 0 {
+		fmt.Println("No matching executions.")
+		return nil
+	}
+	for _, entry := range entries {
+		printHistoryLine(entry.ID, entry)
+	}
+	return nil
+}
+
+// printHistoryLine prints one entry of a history listing, led by key.
+func printHistoryLine(key string, entry *HistoryEntry) {
+	status := entry.Status
+	if entry.Error != "" {
+		status = "error"
+	}
+	budget := ""
+	if entry.OverBudget {
+		budget = " ⚠️"
+	}
+	fmt.Printf("%s  %s  %-6s %-40s %s (%dms%s) [%s]\n",
+		key, entry.Timestamp.Local().Format("2006-01-02 15:04:05"), entry.Method,
+		truncateForDisplay(entry.Label(), 40), status, entry.DurationMS, budget, entry.Environment)
+}
+
+func showHistory(cmd *cobra.Command, args []string) error {
+	asJSON, err := jsonOutput()
+	if err != nil {
+		return err
+	}
+	cm, err := openWorkspace()
+	if err != nil {
+		return err
+	}
+	entry, err := cm.LoadHistory(args[0])
+	if err != nil {
+		return fmt.Errorf("loading history entry: %w", err)
+	}
+	if asJSON {
+		return writeJSON(os.Stdout, entry)
+	}
+	fmt.Printf("ID: %s\n", entry.ID)
+	fmt.Printf("Time: %s\n", entry.Timestamp.Local().Format(time.RFC3339))
+	if entry.Request != "" {
+		fmt.Printf("Request: %s\n", entry.Request)
+	}
+	if entry.Environment != "" {
+		fmt.Printf("Environment: %s\n", entry.Environment)
+	}
+	if entry.RequestID != "" {
+		fmt.Printf("Request ID: %s\n", entry.RequestID)
+	}
+	if entry.TraceID != "" {
+		fmt.Printf("Trace ID: %s\n", entry.TraceID)
+	}
+	fmt.Printf("%s %s\n", entry.Method, entry.URL)
+	for _, key := range sortedKeys(entry.RequestHeaders) {
+		for _, value := range entry.RequestHeaders[key] {
+			fmt.Printf("  %s: %s\n", key, value)
+		}
+	}
+	if entry.RequestBody != "" {
+		fmt.Printf("\nRequest Body:\n")
+		printResponseBody([]byte(entry.RequestBody), entry.RequestHeaders.Get("Content-Type"))
+	}
+	fmt.Println()
+	if entry.Error != "" {
+		fmt.Printf("Error: %s\n", entry.Error)
+		return nil
+	}
+	if entry.OverBudget {
+		fmt.Printf("Status: %s (%dms, over the %dms budget)\n", entry.Status, entry.DurationMS, entry.BudgetMS)
+	} else {
+		fmt.Printf("Status: %s (%dms)\n", entry.Status, entry.DurationMS)
+	}
+	fmt.Printf("Headers:\n")
+	for _, key := range sortedKeys(entry.Headers) {
+		for _, value := range entry.Headers[key] {
+			fmt.Printf("  %s: %s\n", key, value)
+		}
+	}
+	fmt.Printf("\nResponse Body:\n")
+	printResponseBody([]byte(entry.Body), entry.Headers.Get("Content-Type"))
+	return nil
+}
+
+func clearHistory(cmd *cobra.Command, args []string) error {
+	cm, err := openWorkspace()
+	if err != nil {
+		return err
+	}
+	n, err := cm.ClearHistory()
+	if err != nil {
+		return fmt.Errorf("clearing history: %w", err)
+	}
+	fmt.Printf("✓ Removed %d history entries\n", n)
+	return nil
+}
+
+func newCacheCommand() *cobra.Command {
+	return groupCommand("cache", "Manage cached responses and check caching headers",
+		&cobra.Command{
+			Use:   "check <request-path> <environment>",
+			Short: "Summarise how a response may be cached",
+			Long: `Send a request, then for GET and HEAD send it again with its ETag and
+Last-Modified as If-None-Match and If-Modified-Since, and summarise its
+Cache-Control directives, Age, Vary, validators and CDN cache status, whether
+the ETag stayed the same and how the server answered the conditional
+request, with notes on likely mistakes. The request's caching assertions are
+checked too, exiting with 7 when one fails.`,
+			Example:           "  api-man cache check assets/logo cdn",
+			Args:              exactArgs(2),
+			ValidArgsFunction: completeArgs(argRequest, argEnvironment),
+			RunE: func(cmd *cobra.Command, args []string) error {
+				return checkCaching(args[0], args[1])
+			},
+		},
+		&cobra.Command{
+			Use:   "list",
+			Short: "List cached responses",
+			Args:  exactArgs(0),
+			RunE: func(cmd *cobra.Command, args []string) error {
+				return listCache()
+			},
+		},
+		&cobra.Command{
+			Use:               "clear [request-path]",
+			Short:             "Delete cached responses, all or a request's",
+			Args:              argsBetween(0, 1),
+			ValidArgsFunction: completeArgs(argRequest),
+			RunE: func(cmd *cobra.Command, args []string) error {
+				requestPath := ""
+				if len(args) > 0 {
+					requestPath = args[0]
+				}
+				return clearCache(requestPath)
+			},
+		},
+	)
+}
+
+func listCache() error {
+	asJSON, err := jsonOutput()
+	if err != nil {
+		return err
+	}
+	cm, err := openWorkspace()
+	if err != nil {
+		return err
+	}
+	responses, err := cm.CachedResponses()
+	if err != nil {
+		return fmt.Errorf("listing cache: %w", err)
+	}
+	if asJSON {
+		return writeJSON(os.Stdout, responses)
+	}
+	if len(responses) == 0 {
+		fmt.Println("No cached responses. Run a request with --cache or \"cache\": true to keep its response.")
+		return nil
+	}
+	for _, cached := range responses {
+		validator := cached.Headers.Get("ETag")
+		if validator == "" {
+			validator = cached.Headers.Get("Last-Modified")
+		}
+		fmt.Printf("%s [%s] %s %s\n", cached.Request, cached.Environment, cached.Method, cached.URL)
+		fmt.Printf("    %s, %s, stored %s\n", validator, formatSize(int64(len(cached.Body))), cached.Stored.Local().Format("2006-01-02 15:04:05"))
+	}
+	return nil
+}
+
+func checkCaching(requestPath, envName string) error {
+	asJSON, err := jsonOutput()
+	if err != nil {
+		return err
+	}
+	cm, err := openWorkspace()
+	if err != nil {
+		return err
+	}
+	report, err := cm.CheckCaching(requestPath, envName, RequestOptions{})
+	if err != nil {
+		return fmt.Errorf("checking caching: %w", err)
+	}
+	if asJSON {
+		if err := writeJSON(os.Stdout, report); err != nil {
+			return err
+		}
+	} else {
+		printCachingReport(report)
+	}
+	if !assertionsPassed(report.Assertions) {
+		return exitCode(exitAssertion)
+	}
+	return nil
+}
+
+func printCachingReport(report *CachingReport) {
+	fmt.Printf("%s %s → %s\n", report.Method, report.URL, report.Status)
+	row := func(label, value string) {
+		if value != "" {
+			fmt.Printf("  %-15s %s\n", label, value)
+		}
+	}
+	row("Cache-Control", cmp.Or(report.CacheControl, "none"))
+	if report.Age >= 0 {
+		row("Age", fmt.Sprintf("%ds", report.Age))
+	}
+	row("Vary", strings.Join(report.Vary, ", "))
+	row("ETag", report.ETag)
+	row("Last-Modified", report.LastModified)
+	row("Expires", report.Expires)
+	for _, name := range sortedKeys(report.CacheStatus) {
+		row(name, report.CacheStatus[name])
+	}
+	if report.StableETag != nil {
+		stable := "✓ same on both requests"
+		if !*report.StableETag {
+			stable = "✗ changed between requests"
+		}
+		row("ETag stability", stable)
+	}
+	row("Revalidation", report.Revalidation)
+	for _, note := range report.Notes {
+		fmt.Printf("⚠️  %s\n", note)
+	}
+	for _, a := range report.Assertions {
+		if a.Passed {
+			fmt.Printf("✓ %s\n", a.Name)
+		} else {
+			fmt.Printf("✗ %s: %s\n", a.Name, a.Message)
+		}
+	}
+}
+
+func clearCache(requestPath string) error {
+	cm, err := openWorkspace()
+	if err != nil {
+		return err
+	}
+	n, err := cm.ClearCache(requestPath)
+	if err != nil {
+		return fmt.Errorf("clearing cache: %w", err)
+	}
+	fmt.Printf("✓ Removed %d cached response(s)\n", n)
+	return nil
+}
+
+// listenURL is the http:// URL of a server listening on host and port,
+// naming it localhost when it listens on a loopback or every address.
+func listenURL(host string, port int) string {
+	if ip := net.ParseIP(host); host == "" || ip != nil && (ip.IsLoopback() || ip.IsUnspecified()) {
+		host = "localhost"
+	}
+	return "http://" + net.JoinHostPort(host, strconv.Itoa(port))
+}
+
+func newMetricsCommand() *cobra.Command {
+	var port int
+	var host string
+	serve := &cobra.Command{
+		Use:   "serve",
+		Short: "Expose request metrics to Prometheus",
+		Long: `Serve the metrics of every request api-man has executed in this workspace
+at /metrics, in the Prometheus text format: request counts by status,
+durations as a histogram and request and response sizes, labelled by
+request, environment, method and source (run, load or web). Records are
+appended to .api-man/metrics.jsonl as requests run, so a watch or load
+session running alongside shows up on the next scrape. Only this machine
+can scrape them unless --listen names another address, such as 0.0.0.0.`,
+		Example: "  api-man metrics serve --port 9464",
+		Args:    exactArgs(0),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return serveMetrics(host, port)
+		},
+	}
+	serve.Flags().IntVar(&port, "port", 9464, "port to listen on")
+	serve.Flags().StringVar(&host, "listen", "127.0.0.1", "`address` to listen on")
+
+	return groupCommand("metrics", "Export request duration and size metrics",
+		serve,
+		&cobra.Command{
+			Use:   "clear",
+			Short: "Delete all recorded metrics",
+			Args:  exactArgs(0),
+			RunE:  clearMetrics,
+		},
+	)
+}
+
+func serveMetrics(host string, port int) error {
+	cm, err := openWorkspace()
+	if err != nil {
+		return err
+	}
+	listener, err := net.Listen("tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+	if err != nil {
+		return fmt.Errorf("starting metrics server: %w", err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", cm.NewMetricsCollector())
+	fmt.Printf("✓ Serving metrics on %s/metrics (Ctrl+C to stop)\n", listenURL(host, port))
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	server := &http.Server{Handler: mux}
+	go func() {
+		<-ctx.Done()
+		server.Shutdown(context.Background())
+	}()
+	if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("serving metrics: %w", err)
+	}
+	return nil
+}
+
+func clearMetrics(cmd *cobra.Command, args []string) error {
+	cm, err := openWorkspace()
+	if err != nil {
+		return err
+	}
+	n, err := cm.ClearMetrics()
+	if err != nil {
+		return fmt.Errorf("clearing metrics: %w", err)
+	}
+	fmt.Printf("✓ Removed %d metric records\n", n)
+	return nil
+}
+
+func newSecretCommand() *cobra.Command {
+	return groupCommand("secret", "Manage {{secret.NAME}} values",
+		&cobra.Command{
+			Use:   "set <name> [value]",
+			Short: "Store a secret (prompts when value is omitted)",
+			Args:  argsBetween(1, 2),
+			RunE:  setSecret,
+		},
+		&cobra.Command{
+			Use:   "get <name>",
+			Short: "Print a secret",
+			Args:  exactArgs(1),
+			RunE:  getSecret,
+		},
+		&cobra.Command{
+			Use:   "list",
+			Short: "List secret names",
+			Args:  exactArgs(0),
+			RunE:  listSecrets,
+		},
+		&cobra.Command{
+			Use:   "rm <name>",
+			Short: "Delete a secret",
+			Args:  exactArgs(1),
+			RunE:  deleteSecret,
+		},
+	)
+}
+
+// openSecretStore opens the workspace's secret store.
+func openSecretStore() (SecretStore, error) {
+	cm, err := openWorkspace()
+	if err != nil {
+		return nil, err
+	}
+	store, err := cm.Secrets()
+	if err != nil {
+		return nil, fmt.Errorf("opening secret store: %w", err)
+	}
+	return store, nil
+}
+
+func setSecret(cmd *cobra.Command, args []string) error {
+	store, err := openSecretStore()
+	if err != nil {
+		return err
+	}
+	name := args[0]
+	var value string
+	if len(args) > 1 {
+		value = args[1]
+	} else {
+		value, err = readSecretValue(name)
+		if err != nil {
+			return fmt.Errorf("reading secret: %w", err)
+		}
+	}
+	if err := store.Set(name, value); err != nil {
+		return fmt.Errorf("storing secret: %w", err)
+	}
+	fmt.Printf("✓ Stored secret %s in %s\n", name, store.Describe())
+	fmt.Printf("  Reference it as {{secret.%s}}\n", name)
+	return nil
+}
+
+func getSecret(cmd *cobra.Command, args []string) error {
+	store, err := openSecretStore()
+	if err != nil {
+		return err
+	}
+	value, err := store.Get(args[0])
+	if err != nil {
+		return fmt.Errorf("reading secret: %w", err)
+	}
+	fmt.Println(value)
+	return nil
+}
+
+func listSecrets(cmd *cobra.Command, args []string) error {
+	store, err := openSecretStore()
+	if err != nil {
+		return err
+	}
+	names, err := store.List()
+	if err != nil {
+		return fmt.Errorf("listing secrets: %w", err)
+	}
+	if len(names) == 0 {
+		fmt.Printf("No secrets stored in %s\n", store.Describe())
+		return nil
+	}
+	fmt.Printf("Secrets in %s:\n", store.Describe())
+	for _, name := range names {
+		fmt.Printf("  🔑 %s\n", name)
+	}
+	return nil
+}
+
+func deleteSecret(cmd *cobra.Command, args []string) error {
+	store, err := openSecretStore()
+	if err != nil {
+		return err
+	}
+	if err := store.Delete(args[0]); err != nil {
+		return fmt.Errorf("deleting secret: %w", err)
+	}
+	fmt.Printf("✓ Deleted secret %s\n", args[0])
+	return nil
+}
+
+// readSecretValue prompts for a value without echo on a terminal, or reads
+// it from stdin when piped.
+func readSecretValue(name string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if term.IsTerminal(fd) {
+		fmt.Fprintf(os.Stderr, "Value for %s: ", name)
+		value, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		return string(value), err
+	}
+	data, err := io.ReadAll(os.Stdin)
+	return strings.TrimRight(string(data), "\r\n"), err
+}
+
+func newVarsCommand() *cobra.Command {
+	return groupCommand("vars", "Manage variables stored by extract rules",
+		&cobra.Command{
+			Use:               "list <env>",
+			Short:             "List the variables stored for an environment",
+			Args:              exactArgs(1),
+			ValidArgsFunction: completeArgs(argEnvironment),
+			RunE:              listStoredVariables,
+		},
+		&cobra.Command{
+			Use:               "set <env> <key=value>...",
+			Short:             "Store variables by hand",
+			Args:              argsBetween(2, -1),
+			ValidArgsFunction: completeArgs(argEnvironment, argNone),
+			RunE:              setStoredVariables,
+		},
+		&cobra.Command{
+			Use:               "clear <env> [name...]",
+			Short:             "Forget stored variables (all when no names are given)",
+			Args:              argsBetween(1, -1),
+			ValidArgsFunction: completeArgs(argEnvironment, argWord),
+			RunE:              clearStoredVariables,
+		},
+	)
+}
+
+func listStoredVariables(cmd *cobra.Command, args []string) error {
+	asJSON, err := jsonOutput()
+	if err != nil {
+		return err
+	}
+	cm, err := openWorkspace()
+	if err != nil {
+		return err
+	}
+	envName := args[0]
+	values, err := cm.StoredVariables(envName)
+	if err != nil {
+		return fmt.Errorf("reading stored variables: %w", err)
+	}
+	if asJSON {
+		if values == nil {
+			values = map[string]string{}
+		}
+		return writeJSON(os.Stdout, values)
+	}
+	if len(values) == 0 {
+		fmt.Printf("No variables stored for %s. Add an \"extract\" section to a request to store some.\n", envName)
+		return nil
+	}
+	fmt.Printf("Variables stored for %s:\n", envName)
+	for _, name := range sortedKeys(values) {
+		fmt.Printf("  %s = %s\n", name, truncateForDisplay(values[name], 60))
+	}
+	return nil
+}
+
+func setStoredVariables(cmd *cobra.Command, args []string) error {
+	envName := args[0]
+	values := make(map[string]string, len(args)-1)
+	for _, arg := range args[1:] {
+		name, value, ok := strings.Cut(arg, "=")
+		if !ok || name == "" {
+			return usageErrorf("expected key=value, got %q", arg)
+		}
+		values[name] = value
+	}
+	cm, err := openWorkspace()
+	if err != nil {
+		return err
+	}
+	if err := cm.StoreVariables(envName, values); err != nil {
+		return fmt.Errorf("storing variables: %w", err)
+	}
+	fmt.Printf("✓ Stored %s for %s\n", strings.Join(sortedKeys(values), ", "), envName)
+	return nil
+}
+
+func clearStoredVariables(cmd *cobra.Command, args []string) error {
+	cm, err := openWorkspace()
+	if err != nil {
+		return err
+	}
+	envName, names := args[0], args[1:]
+	if err := cm.ClearStoredVariables(envName, names...); err != nil {
+		return fmt.Errorf("clearing stored variables: %w", err)
+	}
+	if len(names) == 0 {
+		fmt.Printf("✓ Cleared the variables stored for %s\n", envName)
+	} else {
+		fmt.Printf("✓ Cleared %s for %s\n", strings.Join(names, ", "), envName)
+	}
+	return nil
+}
+
+func newCookiesCommand() *cobra.Command {
+	return groupCommand("cookies", "Manage cookies kept by capture rules",
+		&cobra.Command{
+			Use:               "list <env>",
+			Short:             "List the cookies in an environment's jar",
+			Args:              exactArgs(1),
+			ValidArgsFunction: completeArgs(argEnvironment),
+			RunE:              listJarCookies,
+		},
+		&cobra.Command{
+			Use:               "clear <env> [name...]",
+			Short:             "Remove cookies from the jar (all when no names are given)",
+			Args:              argsBetween(1, -1),
+			ValidArgsFunction: completeArgs(argEnvironment, argWord),
+			RunE:              clearJarCookies,
+		},
+	)
+}
+
+func listJarCookies(cmd *cobra.Command, args []string) error {
+	asJSON, err := jsonOutput()
+	if err != nil {
+		return err
+	}
+	cm, err := openWorkspace()
+	if err != nil {
+		return err
+	}
+	envName := args[0]
+	cookies, err := cm.JarCookies(envName)
+	if err != nil {
+		return fmt.Errorf("reading cookie jar: %w", err)
+	}
+	if asJSON {
+		return writeJSON(os.Stdout, cookies)
+	}
+	if len(cookies) == 0 {
+		fmt.Printf("No cookies in the jar for %s. Add a \"capture\" rule with a \"jar\" to a request to keep some.\n", envName)
+		return nil
+	}
+	fmt.Printf("Cookies in the jar for %s:\n", envName)
+	now := time.Now()
+	for _, name := range sortedKeys(cookies) {
+		cookie := cookies[name]
+		note := ""
+		switch {
+		case cookie.expired(now):
+			note = " (expired)"
+		case !cookie.Expires.IsZero():
+			note = " (expires " + cookie.Expires.Local().Format("2006-01-02 15:04") + ")"
+		}
+		fmt.Printf("  %s = %s%s\n", name, truncateForDisplay(cookie.Value, 60), note)
+	}
+	return nil
+}
+
+func clearJarCookies(cmd *cobra.Command, args []string) error {
+	cm, err := openWorkspace()
+	if err != nil {
+		return err
+	}
+	envName, names := args[0], args[1:]
+	if err := cm.ClearJarCookies(envName, names...); err != nil {
+		return fmt.Errorf("clearing cookie jar: %w", err)
+	}
+	if len(names) == 0 {
+		fmt.Printf("✓ Cleared the cookie jar for %s\n", envName)
+	} else {
+		fmt.Printf("✓ Cleared %s for %s\n", strings.Join(names, ", "), envName)
+	}
+	return nil
+}
+
+func newCICommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "ci <pipeline.yaml>",
+		Short: "Run a declarative CI pipeline of requests",
+		Args:  exactArgs(1),
+		RunE:  runPipeline,
+	}
+}
+
+func runPipeline(cmd *cobra.Command, args []string) error {
+	pipeline, err := LoadPipeline(args[0])
+	if err != nil {
+		return fmt.Errorf("loading pipeline: %w", err)
+	}
+
+	cm, err := openWorkspace()
+	if err != nil {
+		return err
+	}
+
+	summary, err := cm.RunPipeline(pipeline, os.Stdout)
+	if err != nil {
+		return fmt.Errorf("running pipeline: %w", err)
+	}
+
+	fmt.Println()
+	fmt.Printf("%d stage run(s), %d failed, %d skipped in %dms\n", summary.Total, summary.Failed, summary.Skipped, summary.DurationMS)
+	fmt.Printf("Summary: %s\n", filepath.Join(pipeline.Artifacts.Dir, "summary.json"))
+	fmt.Printf("Report:  %s\n", filepath.Join(pipeline.Artifacts.Dir, "report.md"))
+	if !summary.Passed {
+		return exitCode(exitFailure)
+	}
+	return nil
+}
+
+func newMigrateCommand() *cobra.Command {
+	var dryRun bool
+	cmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "Upgrade workspace files to the current schema",
+		Args:  exactArgs(0),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return migrateWorkspace(dryRun)
+		},
+	}
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "list the changes without making them")
+	return cmd
+}
+
+func migrateWorkspace(dryRun bool) error {
+	cm, err := openWorkspace()
+	if err != nil {
+		return err
+	}
+
+	report, err := cm.MigrateWorkspace(dryRun)
+	if err != nil {
+		return fmt.Errorf("migrating workspace: %w", err)
+	}
+	for _, warning := range report.Warnings {
+		fmt.Printf("⚠️  %s\n", warning)
+	}
+
+	if len(report.Actions) == 0 {
+		fmt.Printf("✓ Workspace already at schema version %d\n", CurrentSchemaVersion)
+		return nil
+	}
+
+	for _, action := range report.Actions {
+		fmt.Printf("  %s\n", action)
+	}
+	fmt.Println()
+	if dryRun {
+		fmt.Printf("%d change(s) would be made. Run without --dry-run to apply.\n", len(report.Actions))
+		return nil
+	}
+	fmt.Printf("✓ Migrated workspace to schema version %d (%d change(s))\n", CurrentSchemaVersion, len(report.Actions))
+	fmt.Printf("✓ Backup saved to %s\n", report.BackupDir)
+	return nil
+}
+
+func newConvertCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:       "convert json|yaml",
+		Short:     "Rewrite request and environment files as JSON or YAML",
+		Args:      exactArgs(1),
+		ValidArgs: configFormats,
+		RunE:      convertWorkspace,
+	}
+}
+
+func convertWorkspace(cmd *cobra.Command, args []string) error {
+	format := args[0]
+	cm, err := openWorkspace()
+	if err != nil {
+		return err
+	}
+
+	result, err := cm.ConvertWorkspace(format)
+	if result != nil {
+		for _, converted := range result.Converted {
+			fmt.Printf("  %s\n", converted)
+		}
+		for _, skipped := range result.Skipped {
+			fmt.Printf("⚠️  %s\n", skipped)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("converting workspace: %w", err)
+	}
+	if len(result.Converted) == 0 {
+		fmt.Printf("✓ All request and environment files are already %s\n", strings.ToUpper(format))
+		return nil
+	}
+	fmt.Printf("✓ Converted %d file(s) to %s\n", len(result.Converted), strings.ToUpper(format))
+	return nil
+}
+
+func newSyncCommand() *cobra.Command {
+	var check bool
+	cmd := &cobra.Command{
+		Use:   "sync",
+		Short: "Format workspace files and move secrets out of them",
+		Long: `Validate every request and environment file, rewrite it in the format
+api-man writes (stable key order, two-space indentation, trailing newline)
+and move literal secrets - auth credentials and headers, cookies and
+variables named like tokens, passwords or keys - to the secret store,
+leaving {{secret.NAME}} references behind. The result can be committed and
+reviewed cleanly.
+
+With --check nothing is written; the command exits 1 if any file would
+change or is invalid, for use in CI.`,
+		Args: exactArgs(0),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return syncWorkspace(check)
+		},
+	}
+	cmd.Flags().BoolVar(&check, "check", false, "report what would change without writing, exiting 1 if anything would")
+	return cmd
+}
+
+func syncWorkspace(check bool) error {
+	asJSON, err := jsonOutput()
+	if err != nil {
+		return err
+	}
+	cm, err := openWorkspace()
+	if err != nil {
+		return err
+	}
+
+	report, err := cm.SyncWorkspace(SyncOptions{Check: check})
+	if err != nil {
+		return fmt.Errorf("syncing workspace: %w", err)
+	}
+	failed := len(report.Invalid) > 0 || (check && !report.Clean())
+
+	if asJSON {
+		if err := writeJSON(os.Stdout, report); err != nil {
+			return err
+		}
+		if failed {
+			return exitCode(exitFailure)
+		}
+		return nil
+	}
+
+	for _, invalid := range report.Invalid {
+		fmt.Printf("✗ %s\n", invalid)
+	}
+	for _, secret := range report.Secrets {
+		fmt.Printf("  secret  %s\n", secret)
+	}
+	for _, file := range report.Formatted {
+		fmt.Printf("  format  %s\n", file)
+	}
+	switch {
+	case len(report.Formatted) == 0 && len(report.Secrets) == 0:
+		if len(report.Invalid) == 0 {
+			fmt.Println("✓ Workspace is in sync")
+		}
+	case check:
+		fmt.Printf("⚠️  %d file(s) out of sync, %d secret(s) to move. Run api-man sync to fix.\n", len(report.Formatted), len(report.Secrets))
+	default:
+		fmt.Printf("✓ Synced %d file(s), moved %d secret(s) to the secret store\n", len(report.Formatted), len(report.Secrets))
+	}
+	if len(report.Invalid) > 0 {
+		fmt.Printf("✗ %d invalid file(s) left unchanged\n", len(report.Invalid))
+	}
+	if failed {
+		return exitCode(exitFailure)
+	}
+	return nil
+}
+
+func newRemoteCommand() *cobra.Command {
+	var ours, theirs, force bool
+	var message string
+	pull := &cobra.Command{
+		Use:   "pull",
+		Short: "Copy the remote's changes into the workspace",
+		Long: `Copy files changed on the remote since the last pull or push into
+requests/, environments/ and suites/, including deletions. Files changed
+differently on both sides are conflicts: they are left alone, the remote's
+version is saved in .api-man/remote/conflicts/ and the command exits 1.
+Settle them with --theirs (take the remote's versions) or --ours (keep
+yours and push them next).`,
+		Example: `  api-man remote pull
+  api-man remote pull --theirs`,
+		Args: exactArgs(0),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			resolve := ""
+			switch {
+			case ours:
+				resolve = "ours"
+			case theirs:
+				resolve = "theirs"
+			}
+			return pullRemote(resolve)
+		},
+	}
+	pull.Flags().BoolVar(&ours, "ours", false, "settle conflicts by keeping the local files")
+	pull.Flags().BoolVar(&theirs, "theirs", false, "settle conflicts by taking the remote's files")
+	pull.MarkFlagsMutuallyExclusive("ours", "theirs")
+
+	push := &cobra.Command{
+		Use:   "push",
+		Short: "Copy the workspace's changes to the remote",
+		Long: `Copy files changed in requests/, environments/ and suites/ since the last
+pull or push to the remote, including deletions. Nothing is pushed when a
+file also changed on the remote (pull first, or --force to overwrite the
+remote's version), or when a request or environment holds a literal secret
+(run api-man sync to move secrets to the local secret store).`,
+		Example: `  api-man remote push
+  api-man remote push --message "Add the billing requests"`,
+		Args: exactArgs(0),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return pushRemote(PushOptions{Message: message, Force: force})
+		},
+	}
+	push.Flags().StringVarP(&message, "message", "m", "", "describe the change (the commit message on git remotes)")
+	push.Flags().BoolVar(&force, "force", false, "overwrite files that also changed on the remote")
+
+	return groupCommand("remote", "Share the workspace through a git repository or S3 bucket",
+		&cobra.Command{
+			Use:   "add <git-url|s3-url>",
+			Short: "Set the remote the workspace syncs with",
+			Long: `Set the git repository or s3://bucket/prefix that api-man remote pull and
+push sync requests/, environments/ and suites/ with. Git remotes use the git
+command and its credentials; S3 remotes use the AWS credentials and region
+from the environment or ~/.aws/credentials.`,
+			Example: `  api-man remote add git@github.com:acme/api-requests.git
+  api-man remote add s3://acme-api-man/billing`,
+			Args: exactArgs(1),
+			RunE: func(cmd *cobra.Command, args []string) error {
+				cm, err := openWorkspace()
+				if err != nil {
+					return err
+				}
+				if err := cm.AddRemote(args[0]); err != nil {
+					return err
+				}
+				fmt.Printf("✓ Remote set to %s\n", args[0])
+				fmt.Println("Run 'api-man remote pull' to fetch it or 'api-man remote push' to fill it")
+				return nil
+			},
+		},
+		&cobra.Command{
+			Use:   "status",
+			Short: "Show the changes waiting on each side",
+			Args:  exactArgs(0),
+			RunE:  remoteStatus,
+		},
+		pull,
+		push,
+		&cobra.Command{
+			Use:   "remove",
+			Short: "Stop syncing with the remote, leaving it alone",
+			Args:  exactArgs(0),
+			RunE: func(cmd *cobra.Command, args []string) error {
+				cm, err := openWorkspace()
+				if err != nil {
+					return err
+				}
+				if err := cm.RemoveRemote(); err != nil {
+					return err
+				}
+				fmt.Println("✓ Removed remote")
+				return nil
+			},
+		},
+	)
+}
+
+func remoteStatus(cmd *cobra.Command, args []string) error {
+	asJSON, err := jsonOutput()
+	if err != nil {
+		return err
+	}
+	cm, err := openWorkspace()
+	if err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	report, err := cm.RemoteStatus(ctx)
+	if err != nil {
+		return err
+	}
+	if asJSON {
+		return writeJSON(os.Stdout, report)
+	}
+
+	fmt.Printf("Remote: %s\n", report.URL)
+	if len(report.Incoming) == 0 && len(report.Outgoing) == 0 && len(report.Conflicts) == 0 {
+		fmt.Println("✓ Up to date")
+		return nil
+	}
+	printRemoteChanges("To pull", report.Incoming)
+	printRemoteChanges("To push", report.Outgoing)
+	printRemoteConflicts(report.Conflicts)
+	return nil
+}
+
+func pullRemote(resolve string) error {
+	asJSON, err := jsonOutput()
+	if err != nil {
+		return err
+	}
+	cm, err := openWorkspace()
+	if err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	report, err := cm.PullRemote(ctx, resolve)
+	if err != nil {
+		return err
+	}
+	if asJSON {
+		if err := writeJSON(os.Stdout, report); err != nil {
+			return err
+		}
+	} else {
+		printRemoteChanges("Pulled", report.Incoming)
+		for _, p := range report.Resolved {
+			fmt.Printf("  resolved  %s (%s)\n", p, resolve)
+		}
+		printRemoteConflicts(report.Conflicts)
+		switch {
+		case len(report.Conflicts) > 0:
+			fmt.Printf("✗ %d conflict(s): the remote's versions are in %s (pull again with --ours or --theirs)\n",
+				len(report.Conflicts), cm.relativePath(cm.remoteConflictsDir()))
+		case len(report.Incoming) == 0 && len(report.Resolved) == 0:
+			fmt.Println("✓ Already up to date")
+		case len(report.Incoming) == 0:
+			fmt.Printf("✓ Settled %d conflict(s)\n", len(report.Resolved))
+		default:
+			fmt.Printf("✓ Pulled %d change(s) from %s\n", len(report.Incoming), report.URL)
+		}
+		if len(report.Outgoing) > 0 {
+			fmt.Printf("%d local change(s) to push (api-man remote push)\n", len(report.Outgoing))
+		}
+	}
+	if len(report.Conflicts) > 0 {
+		return exitCode(exitFailure)
+	}
+	return nil
+}
+
+func pushRemote(opts PushOptions) error {
+	asJSON, err := jsonOutput()
+	if err != nil {
+		return err
+	}
+	cm, err := openWorkspace()
+	if err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	report, err := cm.PushRemote(ctx, opts)
+	if err != nil {
+		return err
+	}
+	failed := len(report.Conflicts) > 0 || len(report.Secrets) > 0
+	if asJSON {
+		if err := writeJSON(os.Stdout, report); err != nil {
+			return err
+		}
+		if failed {
+			return exitCode(exitFailure)
+		}
+		return nil
+	}
+
+	switch {
+	case len(report.Conflicts) > 0:
+		printRemoteConflicts(report.Conflicts)
+		fmt.Printf("✗ Nothing pushed: %d file(s) also changed on the remote (run api-man remote pull, or push --force to overwrite them)\n", len(report.Conflicts))
+	case len(report.Secrets) > 0:
+		for _, secret := range report.Secrets {
+			fmt.Printf("✗ %s is a literal secret\n", secret)
+		}
+		fmt.Printf("✗ Nothing pushed: %d secret(s) would be shared (run api-man sync to move them to the secret store)\n", len(report.Secrets))
+	case len(report.Outgoing) == 0:
+		fmt.Println("✓ Nothing to push")
+	default:
+		printRemoteChanges("Pushed", report.Outgoing)
+		fmt.Printf("✓ Pushed %d change(s) to %s\n", len(report.Outgoing), report.URL)
+	}
+	if len(report.Incoming) > 0 {
+		fmt.Printf("%d remote change(s) to pull (api-man remote pull)\n", len(report.Incoming))
+	}
+	if failed {
+		return exitCode(exitFailure)
+	}
+	return nil
+}
+
+func printRemoteChanges(title string, changes []RemoteChange) {
+	if len(changes) == 0 {
+		return
+	}
+	fmt.Printf("%s:\n", title)
+	for _, change := range changes {
+		fmt.Printf("  %-7s %s\n", change.Action, change.Path)
+	}
+}
+
+func printRemoteConflicts(conflicts []string) {
+	if len(conflicts) == 0 {
+		return
+	}
+	fmt.Println("Conflicts (changed on both sides):")
+	for _, p := range conflicts {
+		fmt.Printf("  ✗ %s\n", p)
+	}
+}
+
+func newLintCommand() *cobra.Command {
+	var strict bool
+	cmd := &cobra.Command{
+		Use:   "lint",
+		Short: "Check request and environment files for mistakes",
+		Long: `Check every request, environment and collection environments file without
+sending anything: files that don't parse or have unknown fields, request
+files shadowing each other, activeBody values naming missing body templates,
+environments whose extends or envFile can't be found (errors), and body
+templates no request selects, duplicate request names and {{variables}}
+nothing defines (warnings).
+
+Exits 1 if there are errors, or with --strict any issue at all. Use -o json
+for machine-readable output.`,
+		Args: exactArgs(0),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return lintWorkspace(strict)
+		},
+	}
+	cmd.Flags().BoolVar(&strict, "strict", false, "exit 1 on warnings too")
+	return cmd
+}
+
+func lintWorkspace(strict bool) error {
+	asJSON, err := jsonOutput()
+	if err != nil {
+		return err
+	}
+	cm, err := openWorkspace()
+	if err != nil {
+		return err
+	}
+
+	report, err := cm.LintWorkspace()
+	if err != nil {
+		return fmt.Errorf("linting workspace: %w", err)
+	}
+	errors, warnings := report.Count(LintError), report.Count(LintWarning)
+	failed := errors > 0 || (strict && warnings > 0)
+
+	if asJSON {
+		if err := writeJSON(os.Stdout, report); err != nil {
+			return err
+		}
+	} else {
+		for _, issue := range report.Issues {
+			marker := "✗"
+			if issue.Severity == LintWarning {
+				marker = "⚠️ "
+			}
+			fmt.Printf("%s %s: %s [%s]\n", marker, issue.File, issue.Message, issue.Check)
+		}
+		if len(report.Issues) == 0 {
+			fmt.Printf("✓ Checked %d file(s), no problems found\n", report.Files)
+		} else {
+			fmt.Printf("\nChecked %d file(s): %d error(s), %d warning(s)\n", report.Files, errors, warnings)
+		}
+	}
+	if failed {
+		return exitCode(exitFailure)
+	}
+	return nil
+}
+
+func newDoctorCommand() *cobra.Command {
+	var fix bool
+	cmd := &cobra.Command{
+		Use:   "doctor",
+		Short: "Check api-man's state files for corruption and repair them",
+		Long: `Check the files api-man keeps in .api-man/ (history, stored variables,
+OAuth2 token caches, the secret index and metrics) for damage a crash or
+processes writing at once can leave, along with temporary and lock files
+left behind by processes that died.
+
+With --fix, corrupt files are moved to .api-man/backups/doctor-<time>/,
+metrics lines that aren't records are dropped and leftovers removed. Run it
+while no other api-man process uses the workspace. Use lint to check request
+and environment files.
+
+Exits 1 if problems remain. Use -o json for machine-readable output.`,
+		Args: exactArgs(0),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runDoctor(fix)
+		},
+	}
+	cmd.Flags().BoolVar(&fix, "fix", false, "repair the problems found")
+	return cmd
+}
+
+func runDoctor(fix bool) error {
+	asJSON, err := jsonOutput()
+	if err != nil {
+		return err
+	}
+	cm, err := openWorkspace()
+	if err != nil {
+		return err
+	}
+
+	report, err := cm.Doctor(fix)
+	if report == nil {
+		return fmt.Errorf("checking workspace state: %w", err)
+	}
+	if asJSON {
+		if writeErr := writeJSON(os.Stdout, report); writeErr != nil {
+			return writeErr
+		}
+	} else {
+		for _, issue := range report.Issues {
+			if issue.Fixed {
+				fmt.Printf("✓ %s: %s (fixed)\n", issue.File, issue.Problem)
+			} else {
+				fmt.Printf("✗ %s: %s (--fix would %s)\n", issue.File, issue.Problem, issue.Fix)
+			}
+		}
+		switch {
+		case len(report.Issues) == 0:
+			fmt.Printf("✓ Checked %d file(s), no problems found\n", report.Files)
+		case report.Unfixed() == 0:
+			fmt.Printf("\nRepaired %d problem(s)\n", len(report.Issues))
+			if report.BackupDir != "" {
+				fmt.Printf("Corrupt files were moved to %s\n", report.BackupDir)
+			}
+		default:
+			fmt.Printf("\nChecked %d file(s): %d problem(s). Run with --fix to repair them.\n", report.Files, report.Unfixed())
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("checking workspace state: %w", err)
+	}
+	if report.Unfixed() > 0 {
+		return exitCode(exitFailure)
+	}
+	return nil
+}
+
+func newWebCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "web [port] [static-dir]",
+		Short: "Start web server (default: port 3000, ./frontend/dist)",
+		Args:  argsBetween(0, 2),
+		RunE:  runWebServer,
+	}
+}
+
+func runWebServer(cmd *cobra.Command, args []string) error {
+	port, staticDir := "3000", "./frontend/dist"
+	if len(args) > 0 {
+		port = args[0]
+	}
+	if len(args) > 1 {
+		staticDir = args[1]
+	}
+	server, err := NewWebServer(port, staticDir)
+	if err != nil {
+		return fmt.Errorf("creating web server: %w", err)
+	}
+
+	if err := server.Start(); err != nil {
+		return fmt.Errorf("starting web server: %w", err)
+	}
+	return nil
+}
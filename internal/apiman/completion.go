@@ -0,0 +1,105 @@
+// completion.go
+package apiman
+
+import (
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// Shell completion comes from cobra: api-man completion <shell> prints a
+// script that calls the hidden api-man __complete on every TAB. Commands
+// complete their positional arguments with completeArgs, which reads the
+// workspace, so new requests and environments complete straight away.
+
+// argKind is what a positional argument of a command names.
+type argKind int
+
+const (
+	argNone argKind = iota
+	argRequest
+	argEnvironment
+	argBody
+	argExample
+	argChain
+	argSuite
+	argSession
+	argProject
+	argWord
+)
+
+// completeArgs completes positional arguments of the given kinds, in order.
+// A trailing argWord applies to any further arguments too.
+func completeArgs(kinds ...argKind) cobra.CompletionFunc {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]cobra.Completion, cobra.ShellCompDirective) {
+		var kind argKind
+		switch {
+		case len(args) < len(kinds):
+			kind = kinds[len(args)]
+		case len(kinds) > 0 && kinds[len(kinds)-1] == argWord:
+			kind = argWord
+		}
+		// Projects are completed from anywhere.
+		if kind == argProject {
+			registry, err := LoadProjects()
+			if err != nil {
+				return nil, cobra.ShellCompDirectiveNoFileComp
+			}
+			return filterPrefix(sortedKeys(registry.Projects), toComplete), cobra.ShellCompDirectiveNoFileComp
+		}
+		// Errors just mean no candidates.
+		cm, err := NewConfigManager()
+		if kind == argNone || err != nil {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+
+		var candidates []string
+		switch kind {
+		case argRequest:
+			candidates, _ = cm.RequestPaths()
+		case argEnvironment:
+			candidates, _ = cm.ListEnvironments()
+		case argBody:
+			candidates, _, _ = cm.ListBodies(args[0])
+		case argExample:
+			examples, _ := cm.ListExamples(args[0])
+			for _, example := range examples {
+				candidates = append(candidates, example.Name)
+			}
+		case argChain:
+			candidates, _ = cm.ListChains()
+		case argSuite:
+			candidates, _ = cm.ListSuites()
+		case argSession:
+			candidates, _ = cm.ListSessions()
+		case argWord:
+			// The only free-form words completed are stored variable names.
+			if len(args) > 0 {
+				stored, _ := cm.StoredVariables(args[0])
+				candidates = sortedKeys(stored)
+			}
+		}
+		return filterPrefix(candidates, toComplete), cobra.ShellCompDirectiveNoFileComp
+	}
+}
+
+func filterPrefix(candidates []string, prefix string) []string {
+	var matches []string
+	for _, candidate := range candidates {
+		if strings.HasPrefix(candidate, prefix) {
+			matches = append(matches, candidate)
+		}
+	}
+	return matches
+}
+
+// completeRequestData completes --data with the data files of the request
+// named by the first argument.
+func completeRequestData(cmd *cobra.Command, args []string, toComplete string) ([]cobra.Completion, cobra.ShellCompDirective) {
+	cm, err := NewConfigManager()
+	if len(args) == 0 || err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	names, _ := cm.ListRequestData(args[0])
+	return filterPrefix(names, toComplete), cobra.ShellCompDirectiveNoFileComp
+}
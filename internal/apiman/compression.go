@@ -0,0 +1,132 @@
+// compression.go
+package apiman
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// contentEncodings are the Content-Encoding values api-man decodes.
+var contentEncodings = map[string]func(io.Reader) (io.Reader, error){
+	"gzip":    gzipReader,
+	"x-gzip":  gzipReader,
+	"deflate": deflateReader,
+	"br": func(r io.Reader) (io.Reader, error) {
+		return brotli.NewReader(r), nil
+	},
+	"zstd": func(r io.Reader) (io.Reader, error) {
+		decoder, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return decoder.IOReadCloser(), nil
+	},
+}
+
+func gzipReader(r io.Reader) (io.Reader, error) {
+	return gzip.NewReader(r)
+}
+
+// deflateReader reads "deflate" bodies, which are meant to be zlib streams
+// but are raw DEFLATE from some servers.
+func deflateReader(r io.Reader) (io.Reader, error) {
+	buffered := bufio.NewReader(r)
+	header, _ := buffered.Peek(2)
+	if len(header) == 2 && header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+		return zlib.NewReader(buffered)
+	}
+	return flate.NewReader(buffered), nil
+}
+
+// validAcceptEncoding reports the first coding in an Accept-Encoding value
+// that api-man can't decode, if any.
+func validAcceptEncoding(value string) error {
+	for _, part := range strings.Split(value, ",") {
+		coding, _, _ := strings.Cut(part, ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if _, ok := contentEncodings[coding]; ok || coding == "identity" || coding == "*" {
+			continue
+		}
+		return fmt.Errorf("unsupported encoding %q in acceptEncoding (expected gzip, deflate, br, zstd or identity)", coding)
+	}
+	return nil
+}
+
+// decodingReader returns a reader undoing encoding, a Content-Encoding
+// listing codings in the order they were applied.
+func decodingReader(encoding string, r io.Reader) (io.Reader, error) {
+	codings := strings.Split(encoding, ",")
+	for i := len(codings) - 1; i >= 0; i-- {
+		coding := strings.ToLower(strings.TrimSpace(codings[i]))
+		if coding == "" || coding == "identity" {
+			continue
+		}
+		newReader, ok := contentEncodings[coding]
+		if !ok {
+			return nil, fmt.Errorf("unsupported Content-Encoding %q", coding)
+		}
+		var err error
+		if r, err = newReader(r); err != nil {
+			return nil, fmt.Errorf("decoding %s response body: %w", coding, err)
+		}
+	}
+	return r, nil
+}
+
+// isEncoded reports whether a Content-Encoding header needs decoding.
+func isEncoded(encoding string) bool {
+	return encoding != "" && !strings.EqualFold(encoding, "identity")
+}
+
+// decodeResponse replaces a compressed response body with its decoded form,
+// recording the encoding and the size received. Bodies Go already decoded
+// have no Content-Encoding left and are untouched.
+func decodeResponse(result *ExecutionResult) error {
+	encoding := result.Headers.Get("Content-Encoding")
+	if !isEncoded(encoding) {
+		return nil
+	}
+	r, err := decodingReader(encoding, bytes.NewReader(result.Body))
+	if err != nil {
+		return err
+	}
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("decoding %s response body: %w", encoding, err)
+	}
+	result.ContentEncoding = encoding
+	result.EncodedSize = len(result.Body)
+	result.Body = body
+	return nil
+}
+
+// compressionNote describes a decoded response's sizes, e.g. "br, 1.2 KB
+// of 8.4 KB (85.7% smaller)".
+func (r *ExecutionResult) compressionNote() string {
+	note := fmt.Sprintf("%s, %s of %s", r.ContentEncoding, formatSize(int64(r.EncodedSize)), formatSize(int64(len(r.Body))))
+	if r.EncodedSize < len(r.Body) {
+		note += fmt.Sprintf(" (%.1f%% smaller)", 100-float64(r.EncodedSize)*100/float64(len(r.Body)))
+	}
+	return note
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += n
+	return n, err
+}
@@ -0,0 +1,1856 @@
+// config.go
+package apiman
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+type RequestConfig struct {
+	SchemaVersion int                    `json:"schemaVersion,omitempty"`
+	Name          string                 `json:"name"`
+	Description   string                 `json:"description"`
+	Method        string                 `json:"method"`
+	URL           string                 `json:"url"`
+	Headers       map[string]string      `json:"headers"`
+	Cookies       map[string]string      `json:"cookies"`
+	Body          string                 `json:"body"`
+	ActiveBody    string                 `json:"activeBody,omitempty"`
+	Params        map[string]interface{} `json:"params"`
+	PathParams    map[string]string      `json:"pathParams,omitempty"`
+	Timeout       int                    `json:"timeout"`
+	// LatencyBudgetMS is how long a response is expected to take; slower
+	// ones are flagged in output and history, and fail suites run with
+	// --enforce-budgets.
+	LatencyBudgetMS int           `json:"latencyBudgetMs,omitempty"`
+	Assertions      *Assertions   `json:"assertions,omitempty"`
+	Hooks           *RequestHooks `json:"hooks,omitempty"`
+	GRPC            *GRPCConfig   `json:"grpc,omitempty"`
+	// WebSocket opens the URL as a WebSocket session instead of sending an
+	// HTTP request.
+	WebSocket *WebSocketConfig `json:"websocket,omitempty"`
+	Stream    bool             `json:"stream,omitempty"`
+	// SaveResponse is a file path template the response body is written to
+	// by api-man run, e.g. "out/{{request}}-{{status}}.json".
+	SaveResponse string `json:"saveResponse,omitempty"`
+	// Schema holds the body and response schemas of the OpenAPI operation
+	// the request was generated from.
+	Schema *RequestSchema `json:"schema,omitempty"`
+	// ValidateResponse checks every response against Schema, as with
+	// api-man run --validate, and makes it part of api-man test.
+	ValidateResponse bool `json:"validateResponse,omitempty"`
+	// Extract maps variable names to extraction rules (see
+	// extractVariables). Extracted values are kept in the environment's
+	// variable store for later runs.
+	Extract map[string]string `json:"extract,omitempty"`
+	// Capture copies response headers and cookies into the variable store
+	// or the environment's cookie jar (see capture.go).
+	Capture []CaptureRule `json:"capture,omitempty"`
+	// Prompts are variables api-man run asks for before sending the
+	// request.
+	Prompts []RequestPrompt `json:"prompts,omitempty"`
+	// AcceptEncoding is sent as the Accept-Encoding header, e.g. "br",
+	// "zstd, gzip" or "identity". Without it Go asks for gzip and decodes
+	// it unseen; with it the response is decoded by decodeResponse, which
+	// keeps its Content-Encoding and records the size received.
+	AcceptEncoding string `json:"acceptEncoding,omitempty"`
+	// Tags group related requests, e.g. for api-man list --tag.
+	Tags []string `json:"tags,omitempty"`
+	// Retry resends the request when it gets no response or a retryable
+	// status.
+	Retry *RetryPolicy `json:"retry,omitempty"`
+	// Cache keeps responses with an ETag or Last-Modified and revalidates
+	// them on later runs (see cache.go).
+	Cache bool `json:"cache,omitempty"`
+	// EnvOverrides change the request when it runs against the environment
+	// named by the key, e.g. a header only sent in prod.
+	EnvOverrides map[string]*RequestOverride `json:"envOverrides,omitempty"`
+}
+
+// RequestOverride replaces parts of a request in one environment. Fields
+// that are set replace the request's own; headers, cookies, params and path
+// params are merged over the request's, and an empty header or cookie value
+// leaves it out.
+type RequestOverride struct {
+	Method     string                 `json:"method,omitempty"`
+	URL        string                 `json:"url,omitempty"`
+	Headers    map[string]string      `json:"headers,omitempty"`
+	Cookies    map[string]string      `json:"cookies,omitempty"`
+	Body       string                 `json:"body,omitempty"`
+	ActiveBody string                 `json:"activeBody,omitempty"`
+	Params     map[string]interface{} `json:"params,omitempty"`
+	PathParams map[string]string      `json:"pathParams,omitempty"`
+	Timeout    int                    `json:"timeout,omitempty"`
+}
+
+// applyEnvOverride merges the request's override for envName, if any, into
+// the request. A body replaces the active body template.
+func (c *RequestConfig) applyEnvOverride(envName string) {
+	override := c.EnvOverrides[envName]
+	if override == nil {
+		return
+	}
+	if override.Method != "" {
+		c.Method = override.Method
+	}
+	if override.URL != "" {
+		c.URL = override.URL
+	}
+	if override.Body != "" {
+		c.Body = override.Body
+		c.ActiveBody = ""
+	}
+	if override.ActiveBody != "" {
+		c.ActiveBody = override.ActiveBody
+	}
+	if override.Timeout != 0 {
+		c.Timeout = override.Timeout
+	}
+	c.Headers = mergeVariables(c.Headers, override.Headers)
+	c.Cookies = mergeVariables(c.Cookies, override.Cookies)
+	c.PathParams = mergeVariables(c.PathParams, override.PathParams)
+	if len(override.Params) > 0 {
+		params := maps.Clone(c.Params)
+		if params == nil {
+			params = make(map[string]interface{})
+		}
+		maps.Copy(params, override.Params)
+		c.Params = params
+	}
+}
+
+type Environment struct {
+	SchemaVersion int               `json:"schemaVersion,omitempty"`
+	BaseURL       string            `json:"baseURL"`
+	Headers       map[string]string `json:"headers"`
+	Cookies       map[string]string `json:"cookies"`
+	Auth          map[string]string `json:"auth"`
+	Variables     map[string]string `json:"variables"`
+	// Params are query parameters added to every request, overriding the
+	// request's own params with the same name.
+	Params map[string]interface{} `json:"params,omitempty"`
+	// HTTPProxy and HTTPSProxy route requests for that scheme through a
+	// proxy, except for hosts matched by NoProxy.
+	HTTPProxy  string `json:"httpProxy,omitempty"`
+	HTTPSProxy string `json:"httpsProxy,omitempty"`
+	NoProxy    string `json:"noProxy,omitempty"`
+	// TLS settings for HTTPS and grpcs:// requests. Certificate files are
+	// PEM encoded; minVersion is one of "1.0" to "1.3".
+	CACertFile         string `json:"caCertFile,omitempty"`
+	ClientCertFile     string `json:"clientCertFile,omitempty"`
+	ClientKeyFile      string `json:"clientKeyFile,omitempty"`
+	InsecureSkipVerify bool   `json:"insecureSkipVerify,omitempty"`
+	MinVersion         string `json:"minVersion,omitempty"`
+	// Extends names an environment this one is layered over; see
+	// mergeEnvironments.
+	Extends string `json:"extends,omitempty"`
+	// EnvFile is a .env file, relative to the workspace, whose KEY=VALUE
+	// pairs are added to Variables when a request is executed.
+	EnvFile string `json:"envFile,omitempty"`
+	// ConnectTo sends every connection to this "host:port" or
+	// unix:///path/to.sock instead of the host in the URL, which is still
+	// used for the Host header and TLS. A baseURL of unix:///path/to.sock
+	// does the same for requests to http://localhost.
+	ConnectTo string `json:"connectTo,omitempty"`
+	// Tracing sends a traceparent header with every request and reports
+	// each execution to an OpenTelemetry collector; see TracingConfig.
+	Tracing *TracingConfig `json:"tracing,omitempty"`
+	// RequestIDHeader, such as X-Request-ID, is sent with a fresh UUID on
+	// every execution, unless the request sets it itself, so the request
+	// can be found in the server's logs.
+	RequestIDHeader string `json:"requestIdHeader,omitempty"`
+	// Confirm makes requests that change data need confirmation before
+	// they are sent to this environment; see ConfirmConfig.
+	Confirm *ConfirmConfig `json:"confirm,omitempty"`
+
+	// vars are the variables a resolved environment was interpolated
+	// with (see interpolateEnvironment), for files its auth reads.
+	vars map[string]string
+}
+
+type ConfigManager struct {
+	configDir       string
+	requestsDir     string
+	environmentsDir string
+	secrets         SecretStore
+
+	// assumeYes sends requests needing confirmation without asking, and
+	// confirm, when set, asks the user about them; see confirmSend.
+	assumeYes bool
+	confirm   func(*ConfirmationRequiredError) (bool, error)
+
+	// history is opened on first use; see historyDB.
+	historyOnce sync.Once
+	history     *sql.DB
+	historyErr  error
+}
+
+type OpenAPIImportResult struct {
+	Collection   string   `json:"collection"`
+	Imported     int      `json:"imported"`
+	Bodies       int      `json:"bodies,omitempty"`
+	Pruned       int      `json:"pruned,omitempty"`
+	SpecPath     string   `json:"specPath,omitempty"`
+	Environments []string `json:"environments,omitempty"`
+	Warnings     []string `json:"warnings,omitempty"`
+}
+
+// OpenAPIPreview describes what would happen if a spec were imported,
+// without writing anything to disk.
+type OpenAPIPreview struct {
+	SuggestedCollection string `json:"suggestedCollection"`
+	Exists              bool   `json:"exists"`
+	OwnedBySpec         bool   `json:"ownedBySpec"`
+	Operations          int    `json:"operations"`
+	Requests            int    `json:"requests,omitempty"`
+	Bodies              int    `json:"bodies,omitempty"`
+	Type                string `json:"type,omitempty"`
+}
+
+// ImportOptions controls OpenAPI import behavior.
+type ImportOptions struct {
+	// OverrideName replaces the auto-derived collection folder name when non-empty.
+	OverrideName string
+	// Overwrite permits importing into an existing collection folder.
+	// When false, attempts to import into an existing folder return CollectionExistsError.
+	Overwrite bool
+}
+
+// CollectionExistsError is returned when the target collection folder already
+// exists and the caller did not request overwrite.
+type CollectionExistsError struct {
+	Name string
+}
+
+func (e *CollectionExistsError) Error() string {
+	return fmt.Sprintf("collection %q already exists", e.Name)
+}
+
+// NewConfigManager opens the workspace found by FindWorkspace.
+func NewConfigManager() (*ConfigManager, error) {
+	root, err := FindWorkspace()
+	if err != nil {
+		return nil, err
+	}
+	return newConfigManagerAt(root)
+}
+
+// newConfigManagerAt opens the workspace rooted at root, creating its
+// directories and default files if needed.
+func newConfigManagerAt(root string) (*ConfigManager, error) {
+	requestsDir := filepath.Join(root, "requests")
+	environmentsDir := filepath.Join(root, "environments")
+
+	// Create directory structure
+	dirs := []string{requestsDir, environmentsDir}
+	for _, dir := range dirs {
+		err := os.MkdirAll(dir, 0755)
+		if err != nil {
+			return nil, fmt.Errorf("creating directory %s: %w", dir, err)
+		}
+	}
+
+	cm := &ConfigManager{
+		configDir:       root,
+		requestsDir:     requestsDir,
+		environmentsDir: environmentsDir,
+	}
+
+	if err := cm.initializeDefaultFiles(); err != nil {
+		return nil, fmt.Errorf("initializing default files: %w", err)
+	}
+
+	return cm, nil
+}
+
+func (cm *ConfigManager) initializeDefaultFiles() error {
+	// Create default environment files if they don't exist
+	defaultEnvs := map[string]Environment{
+		"dev": {
+			BaseURL: "http://localhost:3000",
+			Headers: map[string]string{
+				"Content-Type": "application/json",
+			},
+			Cookies: make(map[string]string),
+			Auth:    make(map[string]string),
+			Variables: map[string]string{
+				"host": "localhost:3000",
+			},
+		},
+		"prod": {
+			BaseURL: "https://api.example.com",
+			Headers: map[string]string{
+				"Content-Type": "application/json",
+			},
+			Cookies: make(map[string]string),
+			Auth:    make(map[string]string),
+			Variables: map[string]string{
+				"host": "api.example.com",
+			},
+		},
+	}
+
+	for name, env := range defaultEnvs {
+		if _, exists := cm.environmentFile(name); !exists {
+			if err := cm.SaveEnvironment(name, env); err != nil {
+				return fmt.Errorf("creating environment %s: %w", name, err)
+			}
+		}
+	}
+
+	// Create sample request if requests directory is empty
+	entries, err := os.ReadDir(cm.requestsDir)
+	if err != nil {
+		return fmt.Errorf("reading requests directory: %w", err)
+	}
+
+	if len(entries) == 0 {
+		sampleRequest := RequestConfig{
+			Name:        "Get Users (this is a sample request so you wont think this is a dead project)",
+			Description: "Fetch all users from the API",
+			Method:      "GET",
+			URL:         "/users",
+			Headers:     make(map[string]string),
+			Cookies:     make(map[string]string),
+			Body:        "",
+			Params:      make(map[string]interface{}),
+			Timeout:     30,
+		}
+
+		return cm.SaveRequest("users/get-users", sampleRequest)
+	}
+
+	return nil
+}
+
+// requestFile returns the file holding a request: <path>.json or
+// <path>/request.json, or their .yaml and .yml equivalents.
+func (cm *ConfigManager) requestFile(path string) (string, bool) {
+	if file, ok := findConfigFile(filepath.Join(cm.requestsDir, path)); ok {
+		return file, true
+	}
+	return findConfigFile(filepath.Join(cm.requestsDir, path, "request"))
+}
+
+// SaveRequest saves a request config to requests/<path>/request.json, or to
+// the file already holding the request.
+func (cm *ConfigManager) SaveRequest(path string, config RequestConfig) error {
+	filePath := filepath.Join(cm.requestsDir, path, "request.json")
+	if existing, ok := cm.requestFile(path); ok {
+		// Keep the file's current location and format
+		filePath = existing
+	}
+
+	dir := filepath.Dir(filePath)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("creating directory %s: %w", dir, err)
+	}
+
+	config.SchemaVersion = CurrentSchemaVersion
+	data, err := encodeConfig(filePath, config)
+	if err != nil {
+		return fmt.Errorf("marshaling config: %w", err)
+	}
+
+	err = os.WriteFile(filePath, data, 0644)
+	if err != nil {
+		return fmt.Errorf("writing config file: %w", err)
+	}
+
+	return nil
+}
+
+// LoadRequest loads a request config from a file. A path such as
+// "api.http#get-user" names a request in a .http file instead.
+func (cm *ConfigManager) LoadRequest(path string) (*RequestConfig, error) {
+	if file, ref, ok := httpFileReference(path); ok {
+		return cm.loadHTTPFileRequest(file, ref)
+	}
+
+	// Try both layouts: direct .json file and subdirectory/request.json
+	filePath, ok := cm.requestFile(path)
+	if !ok {
+		filePath = filepath.Join(cm.requestsDir, path, "request.json")
+	}
+
+	data, err := readConfigFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("reading config file: %w", err)
+	}
+
+	var config RequestConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		// Only files written before schemaVersion existed may use the
+		// older body and timeout shapes; anything newer is an error.
+		var version struct {
+			SchemaVersion int `json:"schemaVersion"`
+		}
+		if json.Unmarshal(data, &version) == nil {
+			if err := checkSchemaVersion(path, version.SchemaVersion); err != nil {
+				return nil, err
+			}
+		}
+		if version.SchemaVersion != 0 {
+			return nil, fmt.Errorf("parsing config file: %w", err)
+		}
+		legacy, legacyErr := parseLegacyRequest(data)
+		if legacyErr != nil {
+			return nil, fmt.Errorf("parsing config file: %w", err)
+		}
+		config = *legacy
+	}
+	if err := checkSchemaVersion(path, config.SchemaVersion); err != nil {
+		return nil, err
+	}
+
+	return &config, nil
+}
+
+// ListRequests returns all request configs organized by directory
+func (cm *ConfigManager) ListRequests() (map[string][]string, error) {
+	requests := make(map[string][]string)
+
+	err := filepath.WalkDir(cm.requestsDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			if isRequestFolder(path) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		ext := configFileExt(d.Name())
+		if ext == "" {
+			return nil
+		}
+
+		switch d.Name() {
+		case "environments.json", "openapi.json", "openapi.yaml", "openapi.yml", defaultsFileName:
+			return nil
+		}
+
+		// Get relative path from requests directory
+		relPath, err := filepath.Rel(cm.requestsDir, path)
+		if err != nil {
+			return err
+		}
+
+		// Remove the .json, .yaml or .yml extension
+		relPath = strings.TrimSuffix(relPath, ext)
+
+		// Group by top-level folder (the yaml-spec folder)
+		parts := strings.Split(relPath, string(filepath.Separator))
+		var topLevel string
+		if len(parts) <= 1 {
+			topLevel = "root"
+		} else {
+			topLevel = parts[0]
+		}
+
+		requests[topLevel] = append(requests[topLevel], relPath)
+
+		return nil
+	})
+
+	return requests, err
+}
+
+// RequestPaths returns every request in the workspace as the path accepted
+// by LoadRequest, sorted. Directory-layout requests are reported without
+// their trailing /request segment, and body templates, data files and
+// examples are left out.
+func (cm *ConfigManager) RequestPaths() ([]string, error) {
+	grouped, err := cm.ListRequests()
+	if err != nil {
+		return nil, err
+	}
+
+	var all []string
+	for _, paths := range grouped {
+		all = append(all, paths...)
+	}
+
+	// A directory holding request.json keeps its body templates beside it.
+	requestDirs := make(map[string]bool)
+	for _, p := range all {
+		if filepath.Base(p) == "request" {
+			requestDirs[filepath.Dir(p)] = true
+		}
+	}
+
+	var paths []string
+	for _, p := range all {
+		switch {
+		case filepath.Base(p) == "request":
+			paths = append(paths, filepath.ToSlash(filepath.Dir(p)))
+		case requestDirs[filepath.Dir(p)]:
+			continue
+		default:
+			paths = append(paths, filepath.ToSlash(p))
+		}
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// ResolveRequestTargets expands target into request paths. A target naming a
+// single request resolves to itself; a directory resolves to every request
+// beneath it.
+func (cm *ConfigManager) ResolveRequestTargets(target string) ([]string, error) {
+	target = strings.Trim(filepath.ToSlash(target), "/")
+	paths, err := cm.RequestPaths()
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []string
+	for _, p := range paths {
+		if p == target {
+			return []string{p}, nil
+		}
+		if target == "" || strings.HasPrefix(p, target+"/") {
+			matches = append(matches, p)
+		}
+	}
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("no requests found at %s", target)
+	}
+	return matches, nil
+}
+
+// environmentFile returns the file holding an environment:
+// environments/<name>.json, .yaml or .yml.
+func (cm *ConfigManager) environmentFile(name string) (string, bool) {
+	return findConfigFile(filepath.Join(cm.environmentsDir, name))
+}
+
+// LoadEnvironment loads an environment configuration, merged over the
+// environments it extends.
+func (cm *ConfigManager) LoadEnvironment(name string) (*Environment, error) {
+	return cm.loadEnvironment(name, nil)
+}
+
+// loadEnvironment loads name; chain holds the environments that led to it
+// through extends, to report cycles.
+func (cm *ConfigManager) loadEnvironment(name string, chain []string) (*Environment, error) {
+	if slices.Contains(chain, name) {
+		return nil, fmt.Errorf("environment %s extends itself: %s", name, strings.Join(append(chain, name), " -> "))
+	}
+	env, err := cm.loadEnvironmentFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return cm.resolveExtends(env, append(chain, name))
+}
+
+// loadEnvironmentFile reads a single environment file, without applying
+// extends.
+func (cm *ConfigManager) loadEnvironmentFile(name string) (*Environment, error) {
+	filePath, ok := cm.environmentFile(name)
+	if !ok {
+		filePath = filepath.Join(cm.environmentsDir, name+".json")
+	}
+
+	data, err := readConfigFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("reading environment file: %w", err)
+	}
+
+	var env Environment
+	err = json.Unmarshal(data, &env)
+	if err != nil {
+		return nil, fmt.Errorf("parsing environment file: %w", err)
+	}
+	if err := checkSchemaVersion("environment "+name, env.SchemaVersion); err != nil {
+		return nil, err
+	}
+
+	return &env, nil
+}
+
+// SaveEnvironment saves an environment configuration
+func (cm *ConfigManager) SaveEnvironment(name string, env Environment) error {
+	filePath, ok := cm.environmentFile(name)
+	if !ok {
+		filePath = filepath.Join(cm.environmentsDir, name+".json")
+	}
+
+	env.SchemaVersion = CurrentSchemaVersion
+	data, err := encodeConfig(filePath, env)
+	if err != nil {
+		return fmt.Errorf("marshaling environment: %w", err)
+	}
+
+	err = os.WriteFile(filePath, data, 0644)
+	if err != nil {
+		return fmt.Errorf("writing environment file: %w", err)
+	}
+
+	return nil
+}
+
+// ListEnvironments returns all available environments
+func (cm *ConfigManager) ListEnvironments() ([]string, error) {
+	entries, err := os.ReadDir(cm.environmentsDir)
+	if err != nil {
+		return nil, fmt.Errorf("reading environments directory: %w", err)
+	}
+
+	var environments []string
+	for _, entry := range entries {
+		if ext := configFileExt(entry.Name()); !entry.IsDir() && ext != "" {
+			name := strings.TrimSuffix(entry.Name(), ext)
+			if !slices.Contains(environments, name) {
+				environments = append(environments, name)
+			}
+		}
+	}
+
+	return environments, nil
+}
+
+var environmentNamePattern = regexp.MustCompile(`^[a-z0-9._-]+$`)
+
+// ValidateEnvironmentName enforces the on-disk naming rule for environment files.
+// Names map directly to environments/<name>.json so they must be filesystem-safe.
+func ValidateEnvironmentName(name string) error {
+	if name == "" {
+		return fmt.Errorf("name required")
+	}
+	if len(name) > 64 {
+		return fmt.Errorf("name must be 64 characters or fewer")
+	}
+	if !environmentNamePattern.MatchString(name) {
+		return fmt.Errorf("name must be lowercase letters, numbers, dot, dash, or underscore")
+	}
+	return nil
+}
+
+// EnvironmentExistsError signals an attempt to create an env that already exists on disk.
+type EnvironmentExistsError struct {
+	Name string
+}
+
+func (e *EnvironmentExistsError) Error() string {
+	return fmt.Sprintf("environment %q already exists", e.Name)
+}
+
+// CreateEnvironment writes a new environment file. When source is non-empty,
+// values are cloned from that existing environment; otherwise a minimal default
+// with Content-Type: application/json is seeded.
+func (cm *ConfigManager) CreateEnvironment(name, source string) (*Environment, error) {
+	if err := ValidateEnvironmentName(name); err != nil {
+		return nil, err
+	}
+
+	if _, exists := cm.environmentFile(name); exists {
+		return nil, &EnvironmentExistsError{Name: name}
+	}
+
+	var env Environment
+	if source != "" {
+		src, err := cm.LoadEnvironment(source)
+		if err != nil {
+			return nil, fmt.Errorf("loading source environment %q: %w", source, err)
+		}
+		env = cloneEnvironment(src)
+	} else {
+		env = Environment{
+			BaseURL:   "",
+			Headers:   map[string]string{"Content-Type": "application/json"},
+			Cookies:   map[string]string{},
+			Auth:      map[string]string{},
+			Variables: map[string]string{},
+		}
+	}
+
+	if err := cm.SaveEnvironment(name, env); err != nil {
+		return nil, err
+	}
+	return &env, nil
+}
+
+// cloneEnvironment returns a deep copy of src, sharing no maps, slices or
+// pointers with it. Headers, cookies, auth and variables are never nil, so
+// the copy saves them as empty objects.
+func cloneEnvironment(src *Environment) Environment {
+	dst := *src
+	dst.Headers = cloneStringMap(src.Headers)
+	dst.Cookies = cloneStringMap(src.Cookies)
+	dst.Auth = cloneStringMap(src.Auth)
+	dst.Variables = cloneStringMap(src.Variables)
+	if src.Params != nil {
+		dst.Params = cloneJSONValue(src.Params).(map[string]interface{})
+	}
+	if src.Tracing != nil {
+		tracing := *src.Tracing
+		tracing.Headers = maps.Clone(src.Tracing.Headers)
+		dst.Tracing = &tracing
+	}
+	if src.Confirm != nil {
+		confirm := ConfirmConfig{
+			Environments: slices.Clone(src.Confirm.Environments),
+			Methods:      slices.Clone(src.Confirm.Methods),
+			Allow:        slices.Clone(src.Confirm.Allow),
+		}
+		dst.Confirm = &confirm
+	}
+	dst.vars = maps.Clone(src.vars)
+	return dst
+}
+
+// cloneJSONValue deep-copies a decoded JSON value.
+func cloneJSONValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		clone := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			clone[key] = cloneJSONValue(item)
+		}
+		return clone
+	case []interface{}:
+		clone := make([]interface{}, len(v))
+		for i, item := range v {
+			clone[i] = cloneJSONValue(item)
+		}
+		return clone
+	}
+	return value
+}
+
+func cloneStringMap(m map[string]string) map[string]string {
+	clone := make(map[string]string, len(m))
+	maps.Copy(clone, m)
+	return clone
+}
+
+// Body templates are named *.json files that live next to a request's
+// request.json file (path: requests/<col>/<req>/<name>.json), or .xml, .txt,
+// .graphql and .bin files named with their extension (see bodyContentTypes).
+// The reserved name "default" refers to the inline RequestConfig.Body field,
+// not a file. The regex below matches the env naming rule for consistency.
+var bodyNamePattern = regexp.MustCompile(`^[a-z0-9._-]+$`)
+
+const defaultBodyName = "default"
+
+// ValidateBodyName enforces the on-disk naming rule for body templates.
+// "default" is reserved for the inline body field on RequestConfig.
+func ValidateBodyName(name string) error {
+	if name == "" {
+		return fmt.Errorf("name required")
+	}
+	if name == defaultBodyName {
+		return fmt.Errorf("name %q is reserved", defaultBodyName)
+	}
+	if len(name) > 64 {
+		return fmt.Errorf("name must be 64 characters or fewer")
+	}
+	if !bodyNamePattern.MatchString(name) {
+		return fmt.Errorf("name must be lowercase letters, numbers, dot, dash, or underscore")
+	}
+	return nil
+}
+
+// BodyExistsError signals an attempt to create a body template that already exists.
+type BodyExistsError struct {
+	Name string
+}
+
+func (e *BodyExistsError) Error() string {
+	return fmt.Sprintf("body %q already exists", e.Name)
+}
+
+// LoadBodyContent reads the raw content of a named body template. The reserved
+// name "default" returns the inline RequestConfig.Body value.
+func (cm *ConfigManager) LoadBodyContent(requestPath, name string) (string, error) {
+	if name == defaultBodyName || name == "" {
+		config, err := cm.LoadRequest(requestPath)
+		if err != nil {
+			return "", err
+		}
+		return config.Body, nil
+	}
+	if err := ValidateBodyName(name); err != nil {
+		return "", err
+	}
+	content, _, err := cm.readBodyFile(requestPath, name)
+	return content, err
+}
+
+// SaveBodyContent writes the content for a named body template. Saving the
+// reserved name "default" updates the inline RequestConfig.Body field.
+func (cm *ConfigManager) SaveBodyContent(requestPath, name, content string) error {
+	if name == defaultBodyName || name == "" {
+		config, err := cm.LoadRequest(requestPath)
+		if err != nil {
+			return err
+		}
+		config.Body = content
+		return cm.SaveRequest(requestPath, *config)
+	}
+	if err := ValidateBodyName(name); err != nil {
+		return err
+	}
+	requestDir := filepath.Join(cm.requestsDir, requestPath)
+	if err := os.MkdirAll(requestDir, 0755); err != nil {
+		return fmt.Errorf("creating request directory: %w", err)
+	}
+	bodyFilePath := filepath.Join(requestDir, bodyFileName(name))
+	if err := os.WriteFile(bodyFilePath, []byte(content), 0644); err != nil {
+		return fmt.Errorf("writing body file: %w", err)
+	}
+	return nil
+}
+
+// activeBody returns the body config sends before interpolation, with the
+// body template file it was read from: the active body template, or the
+// inline body and "" when there is none. Running, previewing and exporting
+// a request all read its body here, so they read the same file wherever
+// api-man runs from.
+func (cm *ConfigManager) activeBody(requestPath string, config *RequestConfig) (string, string, error) {
+	if config.ActiveBody == "" || config.ActiveBody == defaultBodyName {
+		return config.Body, "", nil
+	}
+	content, file, err := cm.readBodyFile(requestPath, config.ActiveBody)
+	if err != nil {
+		return "", "", fmt.Errorf("active body of %s: %w", requestPath, err)
+	}
+	return content, file, nil
+}
+
+// hasBinaryBody reports whether config's active body is a .bin template.
+func hasBinaryBody(config *RequestConfig) bool {
+	return config.ActiveBody != "" && config.ActiveBody != defaultBodyName && isBinaryBodyFile(bodyFileName(config.ActiveBody))
+}
+
+// GetBodyContent returns the body requestPath sends, before its
+// {{placeholders}} are filled: its active body template or, when it has
+// none, the inline body.
+func (cm *ConfigManager) GetBodyContent(requestPath string) (string, error) {
+	config, err := cm.LoadRequest(requestPath)
+	if err != nil {
+		return "", fmt.Errorf("loading request: %w", err)
+	}
+	content, _, err := cm.activeBody(requestPath, config)
+	return content, err
+}
+
+// SaveBody writes content as the body requestPath sends: to its active body
+// template or, when it has none, inline in the request file.
+func (cm *ConfigManager) SaveBody(requestPath, content string) error {
+	config, err := cm.LoadRequest(requestPath)
+	if err != nil {
+		return fmt.Errorf("loading request: %w", err)
+	}
+	if hasBinaryBody(config) {
+		return fmt.Errorf("the active body %s is binary and can't be saved as text", bodyFileName(config.ActiveBody))
+	}
+	return cm.SaveBodyContent(requestPath, config.ActiveBody, content)
+}
+
+// CreateBody creates a new body template file. When source is non-empty its
+// content is cloned; "default" or "" clones the inline body. Returns
+// BodyExistsError if the named template already exists.
+func (cm *ConfigManager) CreateBody(requestPath, name, source string) (string, error) {
+	if err := ValidateBodyName(name); err != nil {
+		return "", err
+	}
+	if _, exists := cm.bodyFile(requestPath, name); exists {
+		return "", &BodyExistsError{Name: name}
+	}
+
+	var content string
+	if source != "" {
+		seed, err := cm.LoadBodyContent(requestPath, source)
+		if err != nil {
+			return "", fmt.Errorf("loading source body %q: %w", source, err)
+		}
+		content = seed
+	}
+
+	if err := cm.SaveBodyContent(requestPath, name, content); err != nil {
+		return "", err
+	}
+	return content, nil
+}
+
+// SetActiveBodyByName sets which body to use for a request. The reserved name
+// "default" or an empty string clears ActiveBody so the inline body is used.
+func (cm *ConfigManager) SetActiveBodyByName(requestPath, name string) error {
+	config, err := cm.LoadRequest(requestPath)
+	if err != nil {
+		return fmt.Errorf("loading request: %w", err)
+	}
+	if name == "" || name == defaultBodyName {
+		config.ActiveBody = ""
+		return cm.SaveRequest(requestPath, *config)
+	}
+	if err := ValidateBodyName(name); err != nil {
+		return err
+	}
+	if _, exists := cm.bodyFile(requestPath, name); !exists {
+		return fmt.Errorf("body file %q does not exist", name)
+	}
+	config.ActiveBody = name
+	return cm.SaveRequest(requestPath, *config)
+}
+
+// RequestOptions adjusts a single execution without changing files on disk.
+type RequestOptions struct {
+	// Variables are layered over the environment's variables, e.g. values
+	// extracted by an earlier step of a chain.
+	Variables map[string]string
+	// Data names a data file of the request (see LoadRequestData) whose
+	// values are layered between the environment's variables and
+	// Variables.
+	Data string
+	// Method, URL and Body replace the stored values when set.
+	Method string
+	URL    string
+	Body   *string
+	// BodyFile is the body template Body was edited from, if any, which
+	// decides how Body is encoded and its Content-Type as it would for the
+	// stored body.
+	BodyFile string
+	// Headers are applied over the stored request headers.
+	Headers map[string]string
+	// Params replace the stored and environment query parameters with the
+	// same name.
+	Params url.Values
+	// PathParams fill {name} placeholders in the URL path, over the stored
+	// pathParams.
+	PathParams map[string]string
+	// Timeout replaces the stored timeout when non-zero.
+	Timeout time.Duration
+	// Proxy sends the request through this proxy instead of the
+	// environment's.
+	Proxy string
+	// Force sends a body that doesn't match the request's schema.
+	Force bool
+	// Progress, when set, shows a progress bar for large response bodies
+	// while they download.
+	Progress io.Writer
+	// AcceptEncoding replaces the stored acceptEncoding when set.
+	AcceptEncoding string
+	// RequestID is sent as the correlation ID instead of a fresh one, under
+	// the environment's requestIdHeader or else defaultRequestIDHeader;
+	// chains use it to send one ID with every step.
+	RequestID string
+	// Confirmed sends the request even if the environment asks for
+	// confirmation, e.g. once the TUI's user has given it.
+	Confirmed bool
+	// Cache goes through the response cache as if the request had
+	// "cache": true.
+	Cache bool
+}
+
+// ExecuteRequest executes a request with an environment
+func (cm *ConfigManager) ExecuteRequest(requestPath, envName string) (*http.Response, error) {
+	return cm.ExecuteRequestWithOptions(requestPath, envName, RequestOptions{})
+}
+
+// ExecuteRequestWithOptions executes a request with an environment and
+// per-execution overrides.
+func (cm *ConfigManager) ExecuteRequestWithOptions(requestPath, envName string, opts RequestOptions) (*http.Response, error) {
+	return cm.ExecuteRequestContext(context.Background(), requestPath, envName, opts)
+}
+
+// ExecuteRequestContext is ExecuteRequestWithOptions with a context that
+// aborts the request, including reading the response body, when cancelled.
+func (cm *ConfigManager) ExecuteRequestContext(ctx context.Context, requestPath, envName string, opts RequestOptions) (*http.Response, error) {
+	prepared, err := cm.PrepareRequest(requestPath, envName, opts)
+	if err != nil {
+		return nil, err
+	}
+	if prepared.Config.GRPC != nil {
+		return nil, errGRPCRequest(requestPath)
+	}
+	if prepared.Config.WebSocket != nil {
+		return nil, errWebSocketRequest(requestPath)
+	}
+	if err := cm.confirmPrepared(prepared, opts.Confirmed); err != nil {
+		return nil, err
+	}
+	resp, _, err := prepared.send(ctx)
+	return resp, err
+}
+
+// PrepareRequest resolves a stored request against an environment into an
+// *http.Request ready to send, without sending it. The pre-request hook, if
+// any, has already been applied.
+func (cm *ConfigManager) PrepareRequest(requestPath, envName string, opts RequestOptions) (*PreparedRequest, error) {
+	// Load request config
+	config, err := cm.LoadRequest(requestPath)
+	if err != nil {
+		return nil, fmt.Errorf("loading request: %w", err)
+	}
+
+	// Load environment
+	env, err := cm.LoadEnvironment(envName)
+	if err != nil {
+		return nil, fmt.Errorf("loading environment: %w", err)
+	}
+
+	// Apply inherited defaults, the environment's override, then
+	// per-execution overrides
+	defaults, err := cm.requestDefaults(requestPath)
+	if err != nil {
+		return nil, err
+	}
+	config.applyDefaults(defaults)
+	config.applyEnvOverride(envName)
+	if opts.Method != "" {
+		config.Method = opts.Method
+	}
+	if opts.URL != "" {
+		config.URL = opts.URL
+	}
+	if len(opts.Headers) > 0 {
+		config.Headers = mergeVariables(config.Headers, opts.Headers)
+	}
+	if opts.AcceptEncoding != "" {
+		config.AcceptEncoding = opts.AcceptEncoding
+	}
+	if config.AcceptEncoding != "" {
+		if err := validAcceptEncoding(config.AcceptEncoding); err != nil {
+			return nil, err
+		}
+	}
+
+	// Determine which body to use. bodyFile, the template it was read from,
+	// decides how it is encoded and its Content-Type.
+	var bodyToUse, bodyName, bodyFile string
+	if opts.Body != nil {
+		bodyToUse, bodyFile = *opts.Body, opts.BodyFile
+		if bodyFile != "" {
+			bodyName = config.ActiveBody
+		}
+	} else {
+		if bodyToUse, bodyFile, err = cm.activeBody(requestPath, config); err != nil {
+			return nil, err
+		}
+		if bodyFile != "" {
+			bodyName = config.ActiveBody
+		}
+	}
+
+	// Resolve {{variables}} and {{secret.NAME}} references, then apply them
+	// to environment headers, cookies and auth
+	envVars, err := cm.environmentVariables(envName, env)
+	if err != nil {
+		return nil, err
+	}
+	var dataVars map[string]string
+	if opts.Data != "" {
+		if dataVars, err = cm.LoadRequestData(requestPath, opts.Data); err != nil {
+			return nil, err
+		}
+	}
+	vars := mergeVariables(envVars, dataVars, opts.Variables)
+	if err := applyPromptDefaults(config.Prompts, vars); err != nil {
+		return nil, err
+	}
+	secrets, err := cm.resolveSecrets(env, config, bodyToUse)
+	if err != nil {
+		return nil, err
+	}
+	maps.Copy(vars, secrets)
+	env = interpolateEnvironment(env, vars)
+
+	// Build full URL
+	baseURL := requestBaseURL(env.BaseURL)
+	if baseURL != "" && baseURL[len(baseURL)-1] == '/' {
+		baseURL = baseURL[:len(baseURL)-1]
+	}
+
+	// Replace variables in the path and query string. Absolute URLs, such
+	// as requests imported from curl, ignore the environment's base URL.
+	fullURL := interpolate(config.URL, vars)
+	if !isAbsoluteURL(fullURL) {
+		fullURL = baseURL + fullURL
+	}
+
+	fullURL, err = applyPathParams(fullURL, vars, config.PathParams, opts.PathParams)
+	if err != nil {
+		return nil, err
+	}
+
+	// Query parameters layer request < environment < per-execution
+	fullURL, err = applyQueryParams(fullURL,
+		queryParamValues(config.Params, vars),
+		queryParamValues(env.Params, vars),
+		opts.Params)
+	if err != nil {
+		return nil, err
+	}
+
+	// Binary bodies are sent byte for byte, and only JSON bodies can be
+	// checked against the request's schema.
+	if !isBinaryBodyFile(bodyFile) {
+		bodyToUse = interpolate(bodyToUse, vars)
+	}
+	if !opts.Force && isJSONBody(bodyFile) {
+		if err := validateRequestBody(config.Schema, bodyToUse); err != nil {
+			return nil, err
+		}
+	}
+	if bodyToUse, err = encodeBody(bodyFile, bodyToUse); err != nil {
+		return nil, err
+	}
+
+	// Create request
+	var req *http.Request
+	if bodyToUse != "" {
+		req, err = http.NewRequest(config.Method, fullURL, strings.NewReader(bodyToUse))
+	} else {
+		req, err = http.NewRequest(config.Method, fullURL, nil)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+
+	// Apply environment headers
+	for key, value := range env.Headers {
+		if value != "" {
+			req.Header.Set(key, value)
+		}
+	}
+
+	// Apply request-specific headers (override environment headers)
+	for key, value := range config.Headers {
+		if value != "" {
+			req.Header.Set(key, interpolate(value, vars))
+		}
+	}
+
+	// Non-JSON body templates bring their own Content-Type, over the
+	// environment's but not the request's
+	if contentType := bodyContentType(bodyFile); contentType != "" && !hasHeader(config.Headers, "Content-Type") {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if config.AcceptEncoding != "" {
+		req.Header.Set("Accept-Encoding", config.AcceptEncoding)
+	}
+
+	// Apply environment cookies
+	for name, value := range env.Cookies {
+		if value != "" {
+			cookie := &http.Cookie{
+				Name:  name,
+				Value: value,
+			}
+			req.AddCookie(cookie)
+		}
+	}
+
+	// Apply request-specific cookies (override environment cookies)
+	for name, value := range config.Cookies {
+		if value != "" {
+			cookie := &http.Cookie{
+				Name:  name,
+				Value: interpolate(value, vars),
+			}
+			req.AddCookie(cookie)
+		}
+	}
+
+	// Apply cookies captured into the environment's jar that aren't set
+	// above
+	if err := cm.applyJarCookies(req, envName); err != nil {
+		return nil, err
+	}
+
+	// Apply authentication from environment
+	if err := cm.applyAuth(req, envName, env); err != nil {
+		return nil, err
+	}
+
+	transport, err := cm.httpTransport(env, opts.Proxy)
+	if err != nil {
+		return nil, err
+	}
+
+	// Add the correlation ID, unless the request sends its own
+	requestIDHeader := env.RequestIDHeader
+	if requestIDHeader == "" && opts.RequestID != "" {
+		requestIDHeader = defaultRequestIDHeader
+	}
+	if requestIDHeader != "" && req.Header.Get(requestIDHeader) == "" {
+		req.Header.Set(requestIDHeader, cmp.Or(opts.RequestID, newUUID()))
+	}
+
+	prepared := &PreparedRequest{
+		Path:        requestPath,
+		Environment: envName,
+		Request:     req,
+		Config:      config,
+		Variables:   vars,
+		BodyName:    bodyName,
+		Timeout:     opts.Timeout,
+		Transport:   transport,
+	}
+	if err := cm.runPreRequestHook(prepared); err != nil {
+		return nil, err
+	}
+	if requestIDHeader != "" {
+		prepared.RequestID = req.Header.Get(requestIDHeader)
+	}
+
+	// Start the request's span last, so a traceparent the request or its
+	// pre-request hook set becomes the parent
+	if env.Tracing != nil {
+		prepared.Trace = newTraceContext(req.Header.Get("traceparent"))
+		prepared.Tracing = env.Tracing
+		req.Header.Set("traceparent", prepared.Trace.Header())
+	}
+	return prepared, nil
+}
+
+func isAbsoluteURL(s string) bool {
+	for _, scheme := range []string{"http://", "https://", "grpc://", "grpcs://", "ws://", "wss://"} {
+		if strings.HasPrefix(s, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// SetActiveBody sets which body template file to use for a request
+func (cm *ConfigManager) SetActiveBody(requestPath, bodyName string) error {
+	config, err := cm.LoadRequest(requestPath)
+	if err != nil {
+		return fmt.Errorf("loading request: %w", err)
+	}
+
+	// Check if the body file exists
+	if _, exists := cm.bodyFile(requestPath, bodyName); !exists {
+		return fmt.Errorf("body file '%s' does not exist in %s", bodyFileName(bodyName), requestPath)
+	}
+
+	config.ActiveBody = bodyName
+	return cm.SaveRequest(requestPath, *config)
+}
+
+// ListBodies returns the body templates of a request and its active body
+func (cm *ConfigManager) ListBodies(requestPath string) ([]string, string, error) {
+	config, err := cm.LoadRequest(requestPath)
+	if err != nil {
+		return nil, "", fmt.Errorf("loading request: %w", err)
+	}
+
+	// Look for body files in the request directory (excluding request.json)
+	requestDir := filepath.Join(cm.requestsDir, requestPath)
+	var bodyFiles []string
+
+	if entries, err := os.ReadDir(requestDir); err == nil {
+		for _, entry := range entries {
+			if bodyName, ok := bodyTemplateName(entry.Name()); ok && !entry.IsDir() {
+				bodyFiles = append(bodyFiles, bodyName)
+			}
+		}
+	}
+
+	return bodyFiles, config.ActiveBody, nil
+}
+
+// RemoveBody removes a body template file from a request directory
+func (cm *ConfigManager) RemoveBody(requestPath, bodyName string) error {
+	bodyFilePath, exists := cm.bodyFile(requestPath, bodyName)
+	if !exists {
+		return fmt.Errorf("body file '%s' does not exist", bodyFileName(bodyName))
+	}
+
+	err := os.Remove(bodyFilePath)
+	if err != nil {
+		return fmt.Errorf("removing body file: %w", err)
+	}
+
+	// If we're removing the active body, clear it
+	config, err := cm.LoadRequest(requestPath)
+	if err != nil {
+		return fmt.Errorf("loading request: %w", err)
+	}
+
+	if config.ActiveBody == bodyName {
+		config.ActiveBody = ""
+		return cm.SaveRequest(requestPath, *config)
+	}
+
+	return nil
+}
+
+// CollectionEnvironments holds per-collection environment overrides.
+// Stored as requests/<collection>/environments.json
+type CollectionEnvironments struct {
+	SchemaVersion int                    `json:"schemaVersion,omitempty"`
+	Environments  map[string]Environment `json:"environments"`
+}
+
+// LoadCollectionEnvironments loads the per-collection environments file.
+// Returns an empty map (not an error) if the file doesn't exist yet.
+func (cm *ConfigManager) LoadCollectionEnvironments(collection string) (*CollectionEnvironments, error) {
+	filePath := filepath.Join(cm.requestsDir, collection, "environments.json")
+
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &CollectionEnvironments{Environments: make(map[string]Environment)}, nil
+		}
+		return nil, fmt.Errorf("reading collection environments: %w", err)
+	}
+
+	var ce CollectionEnvironments
+	if err := json.Unmarshal(data, &ce); err != nil {
+		return nil, fmt.Errorf("parsing collection environments: %w", err)
+	}
+	if err := checkSchemaVersion(filePath, ce.SchemaVersion); err != nil {
+		return nil, err
+	}
+	if ce.Environments == nil {
+		ce.Environments = make(map[string]Environment)
+	}
+	return &ce, nil
+}
+
+// SaveCollectionEnvironments persists the per-collection environments file.
+func (cm *ConfigManager) SaveCollectionEnvironments(collection string, ce *CollectionEnvironments) error {
+	dir := filepath.Join(cm.requestsDir, collection)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("creating collection directory: %w", err)
+	}
+
+	filePath := filepath.Join(dir, "environments.json")
+	ce.SchemaVersion = CurrentSchemaVersion
+	data, err := encodeConfig(filePath, ce)
+	if err != nil {
+		return fmt.Errorf("marshaling collection environments: %w", err)
+	}
+
+	if err := os.WriteFile(filePath, data, 0644); err != nil {
+		return fmt.Errorf("writing collection environments: %w", err)
+	}
+	return nil
+}
+
+// SaveCollectionSpec writes the source OpenAPI spec into the collection
+// folder so the generated request files have a visible, on-disk origin.
+// The ext argument should be "yaml" or "json"; the file lands at
+// requests/<collection>/openapi.<ext>. Any previous spec file in either
+// format is removed so re-imports don't leave stale variants behind.
+func (cm *ConfigManager) SaveCollectionSpec(collection string, data []byte, ext string) (string, error) {
+	if collection == "" {
+		return "", fmt.Errorf("collection name is required")
+	}
+	ext = strings.ToLower(strings.TrimPrefix(ext, "."))
+	if ext != "yaml" && ext != "yml" && ext != "json" {
+		ext = "yaml"
+	}
+
+	dir := filepath.Join(cm.requestsDir, collection)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("creating collection directory: %w", err)
+	}
+
+	// Remove any prior spec variants so the collection holds exactly one canonical source.
+	for _, variant := range []string{"openapi.yaml", "openapi.yml", "openapi.json"} {
+		_ = os.Remove(filepath.Join(dir, variant))
+	}
+
+	filename := "openapi." + ext
+	filePath := filepath.Join(dir, filename)
+	if err := os.WriteFile(filePath, data, 0644); err != nil {
+		return "", fmt.Errorf("writing spec file: %w", err)
+	}
+
+	rel, err := filepath.Rel(cm.configDir, filePath)
+	if err != nil {
+		return filePath, nil
+	}
+	return rel, nil
+}
+
+const collectionExportFormat = "api-man.collection.v1"
+
+// CollectionExport is the portable API-Man collection bundle format. It
+// captures request.json files plus sibling named body template files.
+type CollectionExport struct {
+	Format       string                  `json:"format"`
+	Collection   string                  `json:"collection"`
+	ExportedAt   string                  `json:"exportedAt"`
+	Requests     []CollectionExportItem  `json:"requests"`
+	Environments *CollectionEnvironments `json:"environments,omitempty"`
+	SourceSpec   *CollectionExportFile   `json:"sourceSpec,omitempty"`
+}
+
+// CollectionExportItem is a request of an exported collection. Bodies maps
+// body template names to their content; binary (.bin) bodies are base64.
+type CollectionExportItem struct {
+	Path   string            `json:"path"`
+	Config RequestConfig     `json:"config"`
+	Bodies map[string]string `json:"bodies,omitempty"`
+}
+
+type CollectionExportFile struct {
+	Name    string `json:"name"`
+	Content string `json:"content"`
+}
+
+// IsCollectionExport reports whether raw JSON looks like an API-Man collection
+// bundle. It intentionally checks only the format marker so callers can fall
+// back to OpenAPI parsing for ordinary JSON specs.
+func IsCollectionExport(data []byte) bool {
+	var probe struct {
+		Format string `json:"format"`
+	}
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return false
+	}
+	return probe.Format == collectionExportFormat
+}
+
+func ParseCollectionExport(data []byte) (*CollectionExport, error) {
+	var bundle CollectionExport
+	if err := json.Unmarshal(data, &bundle); err != nil {
+		return nil, fmt.Errorf("parsing collection bundle: %w", err)
+	}
+	if bundle.Format != collectionExportFormat {
+		return nil, fmt.Errorf("unsupported collection bundle format %q", bundle.Format)
+	}
+	if strings.TrimSpace(bundle.Collection) == "" {
+		return nil, fmt.Errorf("collection bundle is missing collection")
+	}
+	return &bundle, nil
+}
+
+// ExportCollection builds a portable collection bundle from requests/<collection>.
+func (cm *ConfigManager) ExportCollection(collection string) (*CollectionExport, error) {
+	if err := validateCollectionName(collection); err != nil {
+		return nil, err
+	}
+
+	collectionDir := filepath.Join(cm.requestsDir, collection)
+	info, err := os.Stat(collectionDir)
+	if err != nil {
+		return nil, fmt.Errorf("reading collection: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("collection %q is not a directory", collection)
+	}
+
+	bundle := &CollectionExport{
+		Format:     collectionExportFormat,
+		Collection: collection,
+		ExportedAt: time.Now().UTC().Format(time.RFC3339),
+		Requests:   []CollectionExportItem{},
+	}
+
+	if ce, err := cm.LoadCollectionEnvironments(collection); err == nil && len(ce.Environments) > 0 {
+		bundle.Environments = ce
+	}
+
+	for _, specName := range []string{"openapi.yaml", "openapi.yml", "openapi.json"} {
+		specPath := filepath.Join(collectionDir, specName)
+		data, err := os.ReadFile(specPath)
+		if err == nil {
+			bundle.SourceSpec = &CollectionExportFile{Name: specName, Content: string(data)}
+			break
+		}
+	}
+
+	err = filepath.WalkDir(collectionDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || d.Name() != "request.json" {
+			return nil
+		}
+
+		requestDir := filepath.Dir(path)
+		rel, err := filepath.Rel(collectionDir, requestDir)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("reading request %s: %w", path, err)
+		}
+		var config RequestConfig
+		if err := json.Unmarshal(data, &config); err != nil {
+			return fmt.Errorf("parsing request %s: %w", path, err)
+		}
+
+		item := CollectionExportItem{
+			Path:   filepath.ToSlash(rel),
+			Config: config,
+			Bodies: map[string]string{},
+		}
+
+		entries, err := os.ReadDir(requestDir)
+		if err != nil {
+			return fmt.Errorf("reading request directory %s: %w", requestDir, err)
+		}
+		for _, entry := range entries {
+			name, ok := bodyTemplateName(entry.Name())
+			if entry.IsDir() || !ok {
+				continue
+			}
+			content, err := os.ReadFile(filepath.Join(requestDir, entry.Name()))
+			if err != nil {
+				return fmt.Errorf("reading body %s/%s: %w", item.Path, entry.Name(), err)
+			}
+			item.Bodies[name] = exportBodyContent(name, content)
+		}
+		if len(item.Bodies) == 0 {
+			item.Bodies = nil
+		}
+		bundle.Requests = append(bundle.Requests, item)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(bundle.Requests, func(i, j int) bool {
+		return bundle.Requests[i].Path < bundle.Requests[j].Path
+	})
+
+	return bundle, nil
+}
+
+func (cm *ConfigManager) PreviewCollectionExport(bundle *CollectionExport, overrideName string) *OpenAPIPreview {
+	name := sanitizeRequestPathSegment(bundle.Collection)
+	if strings.TrimSpace(overrideName) != "" {
+		name = sanitizeRequestPathSegment(overrideName)
+	}
+	exists, ownedBySpec := inspectCollectionDir(filepath.Join(cm.requestsDir, name))
+
+	bodyCount := 0
+	for _, request := range bundle.Requests {
+		bodyCount += len(request.Bodies)
+	}
+
+	return &OpenAPIPreview{
+		SuggestedCollection: name,
+		Exists:              exists,
+		OwnedBySpec:         ownedBySpec,
+		Operations:          len(bundle.Requests),
+		Requests:            len(bundle.Requests),
+		Bodies:              bodyCount,
+		Type:                "collection",
+	}
+}
+
+// ImportCollectionExport restores a portable API-Man collection bundle.
+func (cm *ConfigManager) ImportCollectionExport(bundle *CollectionExport, opts ImportOptions) (*OpenAPIImportResult, error) {
+	if bundle == nil {
+		return nil, fmt.Errorf("collection bundle is required")
+	}
+	if bundle.Format != collectionExportFormat {
+		return nil, fmt.Errorf("unsupported collection bundle format %q", bundle.Format)
+	}
+
+	collection := sanitizeRequestPathSegment(bundle.Collection)
+	if strings.TrimSpace(opts.OverrideName) != "" {
+		collection = sanitizeRequestPathSegment(opts.OverrideName)
+	}
+	if err := validateCollectionName(collection); err != nil {
+		return nil, err
+	}
+
+	collectionDir := filepath.Join(cm.requestsDir, collection)
+	exists, _ := inspectCollectionDir(collectionDir)
+	if exists {
+		if !opts.Overwrite {
+			return nil, &CollectionExistsError{Name: collection}
+		}
+		if err := os.RemoveAll(collectionDir); err != nil {
+			return nil, fmt.Errorf("removing existing collection: %w", err)
+		}
+	}
+	if err := os.MkdirAll(collectionDir, 0755); err != nil {
+		return nil, fmt.Errorf("creating collection directory: %w", err)
+	}
+
+	if bundle.Environments != nil {
+		if err := cm.SaveCollectionEnvironments(collection, bundle.Environments); err != nil {
+			return nil, err
+		}
+	}
+
+	specPath := ""
+	if bundle.SourceSpec != nil && bundle.SourceSpec.Name != "" {
+		name := filepath.Base(bundle.SourceSpec.Name)
+		switch name {
+		case "openapi.yaml", "openapi.yml", "openapi.json":
+			path := filepath.Join(collectionDir, name)
+			if err := os.WriteFile(path, []byte(bundle.SourceSpec.Content), 0644); err != nil {
+				return nil, fmt.Errorf("writing source spec: %w", err)
+			}
+			if rel, err := filepath.Rel(cm.configDir, path); err == nil {
+				specPath = rel
+			} else {
+				specPath = path
+			}
+		}
+	}
+
+	imported := 0
+	bodyCount := 0
+	for _, request := range bundle.Requests {
+		relPath, err := cleanBundleRequestPath(request.Path)
+		if err != nil {
+			return nil, fmt.Errorf("invalid request path %q: %w", request.Path, err)
+		}
+
+		requestDir := filepath.Join(collectionDir, filepath.FromSlash(relPath))
+		if err := os.MkdirAll(requestDir, 0755); err != nil {
+			return nil, fmt.Errorf("creating request directory: %w", err)
+		}
+
+		request.Config.SchemaVersion = CurrentSchemaVersion
+		requestFile := filepath.Join(requestDir, "request.json")
+		data, err := encodeConfig(requestFile, request.Config)
+		if err != nil {
+			return nil, fmt.Errorf("marshaling request %s: %w", request.Path, err)
+		}
+		if err := os.WriteFile(requestFile, data, 0644); err != nil {
+			return nil, fmt.Errorf("writing request %s: %w", request.Path, err)
+		}
+
+		for name, content := range request.Bodies {
+			if err := ValidateBodyName(name); err != nil {
+				return nil, fmt.Errorf("invalid body name %q for %s: %w", name, request.Path, err)
+			}
+			data, err := importBodyContent(name, content)
+			if err != nil {
+				return nil, fmt.Errorf("reading body %q for %s: %w", name, request.Path, err)
+			}
+			if err := os.WriteFile(filepath.Join(requestDir, bodyFileName(name)), data, 0644); err != nil {
+				return nil, fmt.Errorf("writing body %s/%s: %w", request.Path, bodyFileName(name), err)
+			}
+			bodyCount++
+		}
+		imported++
+	}
+
+	return &OpenAPIImportResult{
+		Collection: collection,
+		Imported:   imported,
+		Bodies:     bodyCount,
+		SpecPath:   specPath,
+	}, nil
+}
+
+func validateCollectionName(collection string) error {
+	if strings.TrimSpace(collection) == "" {
+		return fmt.Errorf("collection name is required")
+	}
+	if filepath.Base(collection) != collection || collection == "." || collection == ".." {
+		return fmt.Errorf("collection name must be a single folder name")
+	}
+	return nil
+}
+
+func cleanBundleRequestPath(path string) (string, error) {
+	cleaned := filepath.Clean(filepath.FromSlash(strings.TrimSpace(path)))
+	if cleaned == "." || cleaned == "" {
+		return "", fmt.Errorf("path is required")
+	}
+	if filepath.IsAbs(cleaned) {
+		return "", fmt.Errorf("path must be relative")
+	}
+	for _, part := range strings.Split(cleaned, string(filepath.Separator)) {
+		if part == ".." {
+			return "", fmt.Errorf("path cannot contain '..'")
+		}
+	}
+	return filepath.ToSlash(cleaned), nil
+}
+
+// ResolveEnvironment returns the collection-specific environment if it exists,
+// otherwise falls back to the global environment.
+func (cm *ConfigManager) ResolveEnvironment(collection, envName string) (*Environment, error) {
+	if collection != "" {
+		ce, err := cm.LoadCollectionEnvironments(collection)
+		if err == nil {
+			if env, ok := ce.Environments[envName]; ok {
+				return cm.resolveExtends(&env, nil)
+			}
+		}
+	}
+	return cm.LoadEnvironment(envName)
+}
+
+// GenerateRequestsFromOpenAPI generates request configs from OpenAPI spec.
+// CLI semantics: regenerate-on-spec-change, so existing folders are overwritten.
+func (cm *ConfigManager) GenerateRequestsFromOpenAPI(spec *openapi3.T) (*OpenAPIImportResult, error) {
+	return cm.ImportRequestsFromOpenAPI(spec, ImportOptions{Overwrite: true})
+}
+
+// ImportRequestsFromOpenAPI creates or updates a collection folder from an
+// OpenAPI spec. The folder name defaults to the sanitized spec title; supply
+// opts.OverrideName to choose a different folder.
+//
+// Conflict policy: a folder containing an openapi.{yaml,yml,json} file is
+// considered "spec-owned" and is merged in place silently. A folder without
+// such a file is treated as foreign; the import returns CollectionExistsError
+// unless opts.Overwrite is true.
+//
+// Merge policy: the spec is applied as by generate --diff --apply (see
+// DiffOpenAPI): requests are merged with the user's edits, operations whose
+// name changed update their existing request, operations generated into
+// another collection aren't copied, and operation folders no longer in the
+// spec are pruned unless they were edited. What needs the user's attention
+// is returned as warnings.
+func (cm *ConfigManager) ImportRequestsFromOpenAPI(spec *openapi3.T, opts ImportOptions) (*OpenAPIImportResult, error) {
+	specTitle := OpenAPICollectionName(spec)
+	if strings.TrimSpace(opts.OverrideName) != "" {
+		specTitle = sanitizeRequestPathSegment(opts.OverrideName)
+	}
+
+	specDir := filepath.Join(cm.requestsDir, specTitle)
+	exists, ownedBySpec := inspectCollectionDir(specDir)
+	if exists && !ownedBySpec && !opts.Overwrite {
+		return nil, &CollectionExistsError{Name: specTitle}
+	}
+
+	err := os.MkdirAll(specDir, 0755)
+	if err != nil {
+		return nil, fmt.Errorf("creating spec directory %s: %w", specDir, err)
+	}
+
+	diff, err := cm.diffOpenAPI(spec, specTitle)
+	if err != nil {
+		return nil, err
+	}
+	if err := cm.ApplyOpenAPIDiff(diff); err != nil {
+		return nil, err
+	}
+
+	result := &OpenAPIImportResult{
+		Collection: specTitle,
+		Imported:   len(diff.spec),
+		Pruned:     len(diff.prune),
+		Warnings:   diff.Warnings(),
+	}
+
+	// The spec's server and security scheme seed an environment named after
+	// the collection. An existing one is never overwritten, since it holds
+	// the user's credentials.
+	if env, ok := openAPIEnvironment(spec); ok && ValidateEnvironmentName(specTitle) == nil {
+		if _, exists := cm.environmentFile(specTitle); !exists {
+			if err := cm.SaveEnvironment(specTitle, env); err != nil {
+				return nil, err
+			}
+			result.Environments = append(result.Environments, specTitle)
+		}
+	}
+
+	return result, nil
+}
+
+// inspectCollectionDir reports whether the directory exists and, if so,
+// whether it carries a sibling openapi.{yaml,yml,json} file marking it as
+// spec-owned.
+func inspectCollectionDir(dir string) (exists bool, ownedBySpec bool) {
+	info, err := os.Stat(dir)
+	if err != nil || !info.IsDir() {
+		return false, false
+	}
+	for _, variant := range []string{"openapi.yaml", "openapi.yml", "openapi.json"} {
+		if _, err := os.Stat(filepath.Join(dir, variant)); err == nil {
+			return true, true
+		}
+	}
+	return true, false
+}
+
+// PreviewOpenAPI parses an OpenAPI document and reports what an import would
+// do, without touching disk. overrideName, when non-empty, replaces the
+// default folder name derived from spec.info.title.
+func (cm *ConfigManager) PreviewOpenAPI(spec *openapi3.T, overrideName string) *OpenAPIPreview {
+	name := OpenAPICollectionName(spec)
+	if strings.TrimSpace(overrideName) != "" {
+		name = sanitizeRequestPathSegment(overrideName)
+	}
+
+	exists, ownedBySpec := inspectCollectionDir(filepath.Join(cm.requestsDir, name))
+
+	operations := 0
+	if spec.Paths != nil {
+		for _, pathItem := range spec.Paths.Map() {
+			if pathItem == nil {
+				continue
+			}
+			operations += len(pathOperations(pathItem))
+		}
+	}
+
+	return &OpenAPIPreview{
+		SuggestedCollection: name,
+		Exists:              exists,
+		OwnedBySpec:         ownedBySpec,
+		Operations:          operations,
+	}
+}
+
+func defaultParameterValue(parameter *openapi3.Parameter) string {
+	if parameter.Example != nil {
+		return fmt.Sprint(parameter.Example)
+	}
+	for _, name := range sortedKeys(parameter.Examples) {
+		if ref := parameter.Examples[name]; ref != nil && ref.Value != nil && ref.Value.Value != nil {
+			return fmt.Sprint(ref.Value.Value)
+		}
+	}
+	if parameter.Schema != nil && parameter.Schema.Value != nil {
+		schema := parameter.Schema.Value
+		switch {
+		case schema.Example != nil:
+			return fmt.Sprint(schema.Example)
+		case schema.Default != nil:
+			return fmt.Sprint(schema.Default)
+		case len(schema.Enum) > 0:
+			return fmt.Sprint(schema.Enum[0])
+		}
+	}
+	return ""
+}
+
+var requestPathSegmentPattern = regexp.MustCompile(`[^a-z0-9._{}-]+`)
+
+func sanitizeRequestPathSegment(value string) string {
+	sanitized := strings.ToLower(strings.TrimSpace(value))
+	sanitized = strings.ReplaceAll(sanitized, "/", "-")
+	sanitized = requestPathSegmentPattern.ReplaceAllString(sanitized, "-")
+	sanitized = strings.Trim(sanitized, "-")
+	if sanitized == "" {
+		return "api"
+	}
+	return sanitized
+}
@@ -0,0 +1,81 @@
+package apiman
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCloneEnvironmentCopiesEveryField(t *testing.T) {
+	src := Environment{
+		SchemaVersion:      1,
+		BaseURL:            "https://api.example.com",
+		Headers:            map[string]string{"Accept": "application/json"},
+		Cookies:            map[string]string{"locale": "en"},
+		Auth:               map[string]string{"type": "bearer", "token": "{{secret.token}}"},
+		Variables:          map[string]string{"tenant": "acme"},
+		Params:             map[string]interface{}{"version": "2", "ids": []interface{}{"1", "2"}, "filter": map[string]interface{}{"a": "b"}},
+		HTTPProxy:          "http://proxy:3128",
+		HTTPSProxy:         "http://proxy:3129",
+		NoProxy:            "localhost",
+		CACertFile:         "certs/ca.pem",
+		ClientCertFile:     "certs/client.pem",
+		ClientKeyFile:      "certs/client-key.pem",
+		InsecureSkipVerify: true,
+		MinVersion:         "1.2",
+		Extends:            "base",
+		EnvFile:            ".env.staging",
+		ConnectTo:          "127.0.0.1:8443",
+		Tracing:            &TracingConfig{Endpoint: "http://localhost:4318", Headers: map[string]string{"X-Key": "k"}, ServiceName: "svc"},
+		RequestIDHeader:    "X-Request-ID",
+		Confirm:            &ConfirmConfig{Environments: []string{"prod"}, Methods: []string{"DELETE"}, Allow: []string{"/health"}},
+	}
+	// A field added to Environment must be set above, so that this test
+	// checks cloneEnvironment copies it.
+	fields := reflect.ValueOf(src)
+	for i := range fields.NumField() {
+		if field := fields.Type().Field(i); field.IsExported() && fields.Field(i).IsZero() {
+			t.Errorf("fixture doesn't set %s", field.Name)
+		}
+	}
+
+	clone := cloneEnvironment(&src)
+	if !reflect.DeepEqual(clone, src) {
+		t.Fatalf("clone differs:\n got %+v\nwant %+v", clone, src)
+	}
+
+	// The clone shares nothing with its source.
+	src.Headers["Accept"] = "text/plain"
+	src.Params["ids"].([]interface{})[0] = "9"
+	src.Params["filter"].(map[string]interface{})["a"] = "z"
+	src.Tracing.Headers["X-Key"] = "changed"
+	src.Confirm.Allow[0] = "/changed"
+	if clone.Headers["Accept"] != "application/json" || clone.Params["ids"].([]interface{})[0] != "1" ||
+		clone.Params["filter"].(map[string]interface{})["a"] != "b" || clone.Tracing.Headers["X-Key"] != "k" ||
+		clone.Confirm.Allow[0] != "/health" {
+		t.Errorf("clone changed with its source: %+v", clone)
+	}
+
+	// An environment created from another one is saved with every field.
+	cm, err := InitWorkspace(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	src.Extends = "" // loading would need the base environment
+	if err := cm.SaveEnvironment("staging", src); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cm.CreateEnvironment("staging-copy", "staging"); err != nil {
+		t.Fatal(err)
+	}
+	original, err := cm.LoadEnvironment("staging")
+	if err != nil {
+		t.Fatal(err)
+	}
+	copied, err := cm.LoadEnvironment("staging-copy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(copied, original) {
+		t.Errorf("created environment differs:\n got %+v\nwant %+v", copied, original)
+	}
+}
@@ -0,0 +1,237 @@
+// configfile.go
+package apiman
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// configExtensions are the extensions a request or environment file may
+// have, in the order they are looked up. YAML files use the same schema as
+// JSON ones.
+var configExtensions = []string{".json", ".yaml", ".yml"}
+
+// configFormats are the formats accepted by api-man convert.
+var configFormats = []string{"json", "yaml"}
+
+func isYAMLFile(path string) bool {
+	ext := filepath.Ext(path)
+	return ext == ".yaml" || ext == ".yml"
+}
+
+// configFileExt returns the config extension of name, or "" when name isn't
+// a config file.
+func configFileExt(name string) string {
+	ext := filepath.Ext(name)
+	for _, candidate := range configExtensions {
+		if ext == candidate {
+			return ext
+		}
+	}
+	return ""
+}
+
+// findConfigFile returns base with the first config extension that exists.
+func findConfigFile(base string) (string, bool) {
+	for _, ext := range configExtensions {
+		if fileExists(base + ext) {
+			return base + ext, true
+		}
+	}
+	return "", false
+}
+
+// readConfigFile reads a JSON or YAML config file, returning its content as
+// JSON.
+func readConfigFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if !isYAMLFile(path) {
+		return data, nil
+	}
+	converted, err := yamlToJSON(data)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", filepath.Base(path), err)
+	}
+	return converted, nil
+}
+
+// encodeConfig marshals v for writing to path: YAML for .yaml and .yml
+// files, JSON indented by two spaces and ending in a newline otherwise. This
+// is the canonical format api-man sync rewrites workspace files in.
+func encodeConfig(path string, v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		return nil, err
+	}
+	if !isYAMLFile(path) {
+		return buf.Bytes(), nil
+	}
+	return jsonToYAML(buf.Bytes())
+}
+
+func yamlToJSON(data []byte) ([]byte, error) {
+	var doc interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	return json.Marshal(jsonCompatible(doc))
+}
+
+// jsonCompatible converts the map[interface{}]interface{} values YAML
+// produces for non-string keys into maps encoding/json accepts.
+func jsonCompatible(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, child := range v {
+			v[k] = jsonCompatible(child)
+		}
+		return v
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, child := range v {
+			m[fmt.Sprint(k)] = jsonCompatible(child)
+		}
+		return m
+	case []interface{}:
+		for i, child := range v {
+			v[i] = jsonCompatible(child)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// jsonToYAML re-encodes a JSON document as block-style YAML, keeping the
+// order of object members.
+func jsonToYAML(data []byte) ([]byte, error) {
+	var node yaml.Node
+	if err := yaml.Unmarshal(data, &node); err != nil {
+		return nil, err
+	}
+	// JSON parses as flow-style YAML; clear the styles so the encoder picks
+	// block style and quotes strings only where needed. Multi-line strings
+	// read better as literal blocks.
+	var restyle func(n *yaml.Node)
+	restyle = func(n *yaml.Node) {
+		n.Style = 0
+		if n.Kind == yaml.ScalarNode && n.Tag == "!!str" && strings.Contains(strings.TrimSuffix(n.Value, "\n"), "\n") {
+			n.Style = yaml.LiteralStyle
+		}
+		for _, child := range n.Content {
+			restyle(child)
+		}
+	}
+	restyle(&node)
+
+	var out bytes.Buffer
+	encoder := yaml.NewEncoder(&out)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&node); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// ConvertResult lists the files rewritten by ConvertWorkspace.
+type ConvertResult struct {
+	Converted []string
+	Skipped   []string
+}
+
+// ConvertWorkspace rewrites every request and environment file in another
+// format as format ("json" or "yaml"), replacing the original. Body
+// templates, collection files and OpenAPI specs are left alone. Comments in
+// YAML files are lost when converting to JSON.
+func (cm *ConfigManager) ConvertWorkspace(format string) (*ConvertResult, error) {
+	var ext string
+	switch format {
+	case "json":
+		ext = ".json"
+	case "yaml":
+		ext = ".yaml"
+	default:
+		return nil, fmt.Errorf("unknown format %q (expected one of %s)", format, strings.Join(configFormats, ", "))
+	}
+
+	files, err := cm.configFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ConvertResult{}
+	for _, path := range files {
+		if isYAMLFile(path) == (format == "yaml") {
+			continue
+		}
+		target := strings.TrimSuffix(path, filepath.Ext(path)) + ext
+		rel := cm.relativePath(path)
+		if fileExists(target) {
+			result.Skipped = append(result.Skipped, fmt.Sprintf("%s: %s already exists", rel, cm.relativePath(target)))
+			continue
+		}
+		data, err := readConfigFile(path)
+		if err != nil {
+			result.Skipped = append(result.Skipped, fmt.Sprintf("%s: %v", rel, err))
+			continue
+		}
+		if format == "yaml" {
+			data, err = jsonToYAML(data)
+		} else {
+			var indented bytes.Buffer
+			err = json.Indent(&indented, data, "", "  ")
+			data = indented.Bytes()
+		}
+		if err != nil {
+			result.Skipped = append(result.Skipped, fmt.Sprintf("%s: %v", rel, err))
+			continue
+		}
+		if err := os.WriteFile(target, data, 0644); err != nil {
+			return result, fmt.Errorf("writing %s: %w", cm.relativePath(target), err)
+		}
+		if err := os.Remove(path); err != nil {
+			return result, fmt.Errorf("removing %s: %w", rel, err)
+		}
+		result.Converted = append(result.Converted, fmt.Sprintf("%s -> %s", rel, cm.relativePath(target)))
+	}
+	return result, nil
+}
+
+// configFiles returns the request and environment files in the workspace.
+func (cm *ConfigManager) configFiles() ([]string, error) {
+	var files []string
+	paths, err := cm.RequestPaths()
+	if err != nil {
+		return nil, fmt.Errorf("listing requests: %w", err)
+	}
+	for _, path := range paths {
+		if file, ok := cm.requestFile(path); ok {
+			files = append(files, file)
+		}
+	}
+	envs, err := cm.ListEnvironments()
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range envs {
+		if file, ok := cm.environmentFile(name); ok {
+			files = append(files, file)
+		}
+	}
+	return files, nil
+}
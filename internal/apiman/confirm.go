@@ -0,0 +1,152 @@
+// confirm.go
+package apiman
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+)
+
+// Requests that change data can be made to need confirmation before they
+// are sent, so a DELETE meant for dev doesn't reach prod by accident:
+//
+//	"confirm": {
+//	  "methods": ["DELETE", "PUT", "PATCH", "POST"],
+//	  "allow": ["/search", "POST /graphql", "/auth/**"]
+//	}
+//
+// in an environment file applies to that environment; in api-man.json it
+// applies to every environment, or to those listed in "environments",
+// unless the environment has its own. On a terminal api-man asks before
+// sending; elsewhere the request fails with a *ConfirmationRequiredError
+// unless --yes is given.
+
+// defaultConfirmMethods are the methods needing confirmation when a
+// ConfirmConfig lists none. gRPC calls are POSTs.
+var defaultConfirmMethods = []string{"POST", "PUT", "PATCH", "DELETE"}
+
+// errNotConfirmed is returned when the user declines to send a request.
+var errNotConfirmed = errors.New("not sent: confirmation declined")
+
+// ConfirmConfig makes requests need confirmation before they are sent.
+type ConfirmConfig struct {
+	// Environments limits the workspace's setting to these environments;
+	// empty means all of them. Only used in api-man.json.
+	Environments []string `json:"environments,omitempty"`
+	// Methods need confirmation; empty means defaultConfirmMethods.
+	Methods []string `json:"methods,omitempty"`
+	// Allow are URL paths sent without confirmation. A * matches within
+	// one path segment, a trailing /** anything below the path, and a
+	// method before the path limits the entry to that method.
+	Allow []string `json:"allow,omitempty"`
+}
+
+// ConfirmationRequiredError is returned instead of sending a request that
+// needs confirmation when no one can be asked.
+type ConfirmationRequiredError struct {
+	Method      string
+	URL         string
+	Environment string
+}
+
+func (e *ConfirmationRequiredError) Error() string {
+	return fmt.Sprintf("%s %s in %s needs confirmation: pass --yes to send it", e.Method, e.URL, e.Environment)
+}
+
+// requires reports whether method to rawURL needs confirmation.
+func (c *ConfirmConfig) requires(method, rawURL string) bool {
+	methods := c.Methods
+	if len(methods) == 0 {
+		methods = defaultConfirmMethods
+	}
+	if !slices.ContainsFunc(methods, func(m string) bool { return strings.EqualFold(m, method) }) {
+		return false
+	}
+	requestPath := rawURL
+	if u, err := url.Parse(rawURL); err == nil {
+		requestPath = u.Path
+	}
+	// Cleaned, so /auth/../users isn't let through by /auth/**.
+	requestPath = path.Clean("/" + requestPath)
+	for _, entry := range c.Allow {
+		pattern := entry
+		if allowMethod, rest, ok := strings.Cut(strings.TrimSpace(entry), " "); ok {
+			if !strings.EqualFold(allowMethod, method) {
+				continue
+			}
+			pattern = rest
+		}
+		if matchAllowedPath(strings.TrimSpace(pattern), requestPath) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchAllowedPath matches a path against an allow entry's pattern.
+func matchAllowedPath(pattern, requestPath string) bool {
+	pattern = "/" + strings.Trim(pattern, "/")
+	if prefix, ok := strings.CutSuffix(pattern, "/**"); ok {
+		if requestPath == prefix || strings.HasPrefix(requestPath, prefix+"/") {
+			return true
+		}
+		pattern = prefix
+	}
+	matched, err := path.Match(pattern, requestPath)
+	return err == nil && matched
+}
+
+// confirmPolicy returns the confirmation settings of envName, whose merged
+// environment is env: its own, else the workspace's when they cover it.
+func (cm *ConfigManager) confirmPolicy(envName string, env *Environment) (*ConfirmConfig, error) {
+	if env != nil && env.Confirm != nil {
+		return env.Confirm, nil
+	}
+	config, err := cm.workspaceConfig()
+	if err != nil {
+		return nil, err
+	}
+	policy := config.Confirm
+	if policy == nil || (len(policy.Environments) > 0 && !slices.Contains(policy.Environments, envName)) {
+		return nil, nil
+	}
+	return policy, nil
+}
+
+// confirmSend checks that method to rawURL may be sent in envName. When it
+// needs confirmation and confirmed is false, the user is asked through
+// cm.confirm, or a *ConfirmationRequiredError returned when no one can be.
+// env may be nil to load the environment.
+func (cm *ConfigManager) confirmSend(envName string, env *Environment, method, rawURL string, confirmed bool) error {
+	if confirmed || cm.assumeYes || envName == "" {
+		return nil
+	}
+	if env == nil {
+		// A missing environment is reported by whatever sends the request.
+		env, _ = cm.LoadEnvironment(envName)
+	}
+	policy, err := cm.confirmPolicy(envName, env)
+	if err != nil || policy == nil || !policy.requires(method, rawURL) {
+		return err
+	}
+	request := &ConfirmationRequiredError{Method: strings.ToUpper(method), URL: rawURL, Environment: envName}
+	if cm.confirm == nil {
+		return request
+	}
+	ok, err := cm.confirm(request)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errNotConfirmed
+	}
+	return nil
+}
+
+// confirmPrepared is confirmSend for a prepared request.
+func (cm *ConfigManager) confirmPrepared(prepared *PreparedRequest, confirmed bool) error {
+	return cm.confirmSend(prepared.Environment, nil, prepared.Request.Method, prepared.Request.URL.String(), confirmed)
+}
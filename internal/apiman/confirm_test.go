@@ -0,0 +1,34 @@
+package apiman
+
+import "testing"
+
+func TestConfirmRequires(t *testing.T) {
+	confirm := &ConfirmConfig{Allow: []string{"/search", "POST /graphql", "/auth/**", "/items/*/views"}}
+	tests := []struct {
+		method, url string
+		want        bool
+	}{
+		{"GET", "https://api.example.com/users/1", false},
+		{"DELETE", "https://api.example.com/users/1", true},
+		{"POST", "https://api.example.com/search?q=a", false},
+		{"POST", "/search/", false},
+		{"POST", "/graphql", false},
+		{"PUT", "/graphql", true},
+		{"POST", "/auth", false},
+		{"POST", "/auth/token/refresh", false},
+		{"POST", "/authors", true},
+		{"POST", "/items/7/views", false},
+		{"POST", "/items/7/8/views", true},
+		// Dot segments are resolved before matching.
+		{"DELETE", "https://api.example.com/auth/../users/1", true},
+		{"DELETE", "/auth/%2e%2e/users/1", true},
+		{"DELETE", "/search/../users", true},
+		{"POST", "/users/../search", false},
+		{"DELETE", "/auth/./token", false},
+	}
+	for _, tt := range tests {
+		if got := confirm.requires(tt.method, tt.url); got != tt.want {
+			t.Errorf("%s %s: requires = %v, want %v", tt.method, tt.url, got, tt.want)
+		}
+	}
+}
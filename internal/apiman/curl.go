@@ -0,0 +1,417 @@
+// curl.go
+package apiman
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// CurlImportResult describes a request created from a curl command.
+type CurlImportResult struct {
+	Path     string
+	Config   RequestConfig
+	Warnings []string
+}
+
+// ExportCurl renders a stored request, resolved against envName, as an
+// equivalent curl command.
+func (cm *ConfigManager) ExportCurl(requestPath, envName string) (string, error) {
+	prepared, err := cm.PrepareRequest(requestPath, envName, RequestOptions{})
+	if err != nil {
+		return "", err
+	}
+	if prepared.Config.GRPC != nil {
+		return "", errGRPCRequest(requestPath)
+	}
+	if prepared.Config.WebSocket != nil {
+		return "", errWebSocketRequest(requestPath)
+	}
+	return buildCurlCommand(prepared.Request), nil
+}
+
+// ImportCurl parses a curl command line and saves it as a request. path is
+// the request path to create; when empty one is derived from the method and
+// URL under requests/curl/. A URL starting with an environment's baseURL is
+// stored relative to it so the request works across environments.
+func (cm *ConfigManager) ImportCurl(command, path string, overwrite bool) (*CurlImportResult, error) {
+	config, warnings, err := ParseCurlCommand(command)
+	if err != nil {
+		return nil, err
+	}
+	result := &CurlImportResult{Config: *config, Warnings: warnings}
+
+	if envName, relative := cm.relativeToEnvironment(config.URL); envName != "" {
+		result.Config.URL = relative
+		result.Warnings = append(result.Warnings, fmt.Sprintf("URL stored relative to the baseURL of environment %q", envName))
+	}
+
+	if path == "" {
+		path = "curl/" + curlRequestName(config)
+		for i := 2; cm.requestExists(path); i++ {
+			path = fmt.Sprintf("curl/%s-%d", curlRequestName(config), i)
+		}
+	} else if cm.requestExists(path) && !overwrite {
+		return nil, fmt.Errorf("request %s already exists (use --overwrite to replace it)", path)
+	}
+	path = strings.Trim(filepath.ToSlash(path), "/")
+	result.Path = path
+
+	if err := os.MkdirAll(filepath.Join(cm.requestsDir, path), 0755); err != nil {
+		return nil, fmt.Errorf("creating request directory: %w", err)
+	}
+	if err := cm.SaveRequest(path, result.Config); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (cm *ConfigManager) requestExists(path string) bool {
+	_, err := cm.LoadRequest(path)
+	return err == nil
+}
+
+// relativeToEnvironment strips the longest environment baseURL that prefixes
+// rawURL, returning the environment name and the remaining path.
+func (cm *ConfigManager) relativeToEnvironment(rawURL string) (string, string) {
+	names, err := cm.ListEnvironments()
+	if err != nil {
+		return "", rawURL
+	}
+	bestName, bestBase := "", ""
+	for _, name := range names {
+		env, err := cm.LoadEnvironment(name)
+		if err != nil {
+			continue
+		}
+		base := strings.TrimSuffix(env.BaseURL, "/")
+		if base == "" || !strings.HasPrefix(rawURL, base) || len(base) <= len(bestBase) {
+			continue
+		}
+		if rest := rawURL[len(base):]; rest == "" || rest[0] == '/' || rest[0] == '?' {
+			bestName, bestBase = name, base
+		}
+	}
+	if bestName == "" {
+		return "", rawURL
+	}
+	relative := rawURL[len(bestBase):]
+	if relative == "" || relative[0] == '?' {
+		relative = "/" + relative
+	}
+	return bestName, relative
+}
+
+func curlRequestName(config *RequestConfig) string {
+	name := "request"
+	if u, err := url.Parse(config.URL); err == nil {
+		segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+		if last := segments[len(segments)-1]; last != "" {
+			name = last
+		} else if u.Hostname() != "" {
+			name = u.Hostname()
+		}
+	}
+	return sanitizeRequestPathSegment(strings.ToLower(config.Method) + "-" + name)
+}
+
+// curlValueFlags lists options that consume the following argument. Options
+// api-man has no equivalent for are accepted and ignored.
+var curlValueFlags = make(map[string]bool)
+
+func init() {
+	for _, flag := range strings.Fields(`
+		-X --request -H --header -u --user -b --cookie -A --user-agent -e --referer
+		-d --data --data-raw --data-binary --data-ascii --data-urlencode --json
+		-F --form -T --upload-file --url -m --max-time --connect-timeout
+		-o --output -x --proxy -w --write-out -c --cookie-jar --cert --key --cacert
+	`) {
+		curlValueFlags[flag] = true
+	}
+}
+
+// ParseCurlCommand converts a curl command line into a RequestConfig. The
+// returned warnings list options that could not be carried over.
+func ParseCurlCommand(command string) (*RequestConfig, []string, error) {
+	args, err := splitShellWords(command)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(args) == 0 || args[0] != "curl" {
+		return nil, nil, fmt.Errorf("expected a command starting with curl")
+	}
+
+	config := &RequestConfig{
+		Headers: make(map[string]string),
+		Cookies: make(map[string]string),
+		Params:  make(map[string]interface{}),
+	}
+	var warnings []string
+	var data []string
+	method := ""
+	getMode := false
+	timeout := 0
+
+	for i := 1; i < len(args); i++ {
+		arg := args[i]
+		flag, value, hasValue := arg, "", false
+
+		switch {
+		case strings.HasPrefix(arg, "--") && strings.Contains(arg, "="):
+			flag, value, _ = strings.Cut(arg, "=")
+			hasValue = true
+		case len(arg) > 2 && arg[0] == '-' && arg[1] != '-' && curlValueFlags[arg[:2]]:
+			flag, value, hasValue = arg[:2], arg[2:], true
+		}
+
+		if !strings.HasPrefix(flag, "-") || flag == "-" {
+			if config.URL != "" {
+				warnings = append(warnings, fmt.Sprintf("ignored extra argument %q", arg))
+				continue
+			}
+			config.URL = arg
+			continue
+		}
+
+		if curlValueFlags[flag] && !hasValue {
+			if i+1 >= len(args) {
+				return nil, nil, fmt.Errorf("option %s requires a value", flag)
+			}
+			i++
+			value = args[i]
+		}
+
+		switch flag {
+		case "-X", "--request":
+			method = strings.ToUpper(value)
+		case "-H", "--header":
+			name, headerValue, ok := strings.Cut(value, ":")
+			if !ok {
+				warnings = append(warnings, fmt.Sprintf("ignored malformed header %q", value))
+				continue
+			}
+			name, headerValue = strings.TrimSpace(name), strings.TrimSpace(headerValue)
+			if strings.EqualFold(name, "Cookie") {
+				parseCookieString(headerValue, config.Cookies)
+				continue
+			}
+			config.Headers[name] = headerValue
+		case "-d", "--data", "--data-ascii", "--data-binary", "--data-raw":
+			if strings.HasPrefix(value, "@") && flag != "--data-raw" {
+				content, err := os.ReadFile(value[1:])
+				if err != nil {
+					return nil, nil, fmt.Errorf("reading %s: %w", value, err)
+				}
+				value = string(content)
+				if flag != "--data-binary" {
+					value = strings.ReplaceAll(strings.ReplaceAll(value, "\r", ""), "\n", "")
+				}
+			}
+			data = append(data, value)
+		case "--data-urlencode":
+			if name, content, ok := strings.Cut(value, "="); ok {
+				data = append(data, name+"="+url.QueryEscape(content))
+			} else {
+				data = append(data, url.QueryEscape(value))
+			}
+		case "--json":
+			data = append(data, value)
+			setDefaultHeader(config.Headers, "Content-Type", "application/json")
+			setDefaultHeader(config.Headers, "Accept", "application/json")
+		case "-u", "--user":
+			config.Headers["Authorization"] = "Basic " + base64.StdEncoding.EncodeToString([]byte(value))
+		case "-b", "--cookie":
+			if strings.Contains(value, "=") {
+				parseCookieString(value, config.Cookies)
+			} else {
+				warnings = append(warnings, fmt.Sprintf("ignored cookie file %q", value))
+			}
+		case "-A", "--user-agent":
+			config.Headers["User-Agent"] = value
+		case "-e", "--referer":
+			config.Headers["Referer"] = value
+		case "--url":
+			config.URL = value
+		case "-G", "--get":
+			getMode = true
+		case "-I", "--head":
+			method = "HEAD"
+		case "-m", "--max-time":
+			fmt.Sscanf(value, "%d", &timeout)
+		case "-F", "--form", "-T", "--upload-file":
+			warnings = append(warnings, fmt.Sprintf("%s %q is not supported; the request body was not imported", flag, value))
+		default:
+			if !curlValueFlags[flag] && !isCurlBooleanFlag(flag) {
+				warnings = append(warnings, fmt.Sprintf("ignored unknown option %s", flag))
+			}
+		}
+	}
+
+	if config.URL == "" {
+		return nil, nil, fmt.Errorf("no URL found in curl command")
+	}
+	if !strings.Contains(config.URL, "://") {
+		config.URL = "http://" + config.URL
+	}
+
+	if len(data) > 0 {
+		joined := strings.Join(data, "&")
+		if getMode {
+			separator := "?"
+			if strings.Contains(config.URL, "?") {
+				separator = "&"
+			}
+			config.URL += separator + joined
+		} else {
+			config.Body = joined
+			if method == "" {
+				method = "POST"
+			}
+			if _, ok := headerLookup(config.Headers, "Content-Type"); !ok {
+				config.Headers["Content-Type"] = "application/x-www-form-urlencoded"
+			}
+		}
+	}
+	if method == "" {
+		method = "GET"
+	}
+	config.Method = method
+	config.Timeout = timeout
+	config.Name = strings.TrimSpace(method + " " + curlDisplayPath(config.URL))
+	return config, warnings, nil
+}
+
+func curlDisplayPath(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Path == "" {
+		return rawURL
+	}
+	return u.Path
+}
+
+// isCurlBooleanFlag accepts switches that take no value, including bundles
+// of short switches such as -sSL.
+func isCurlBooleanFlag(flag string) bool {
+	if strings.HasPrefix(flag, "--") {
+		return true
+	}
+	for _, c := range flag[1:] {
+		if !strings.ContainsRune("sSLkivfgNnZ0123#", c) {
+			return false
+		}
+	}
+	return true
+}
+
+func parseCookieString(s string, cookies map[string]string) {
+	for _, part := range strings.Split(s, ";") {
+		name, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if ok && name != "" {
+			cookies[name] = value
+		}
+	}
+}
+
+func headerLookup(headers map[string]string, name string) (string, bool) {
+	for key, value := range headers {
+		if strings.EqualFold(key, name) {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+func setDefaultHeader(headers map[string]string, name, value string) {
+	if _, ok := headerLookup(headers, name); !ok {
+		headers[name] = value
+	}
+}
+
+// splitShellWords splits a command line the way a POSIX shell would for the
+// quoting styles browsers and docs use in curl snippets: single quotes,
+// double quotes, $'...' strings and backslash line continuations.
+func splitShellWords(s string) ([]string, error) {
+	var words []string
+	var current strings.Builder
+	inWord := false
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\\':
+			if i+1 < len(s) {
+				i++
+				if s[i] == '\n' || s[i] == '\r' {
+					if s[i] == '\r' && i+1 < len(s) && s[i+1] == '\n' {
+						i++
+					}
+					continue
+				}
+				current.WriteByte(s[i])
+				inWord = true
+			}
+		case c == '\'':
+			end := strings.IndexByte(s[i+1:], '\'')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated single quote")
+			}
+			current.WriteString(s[i+1 : i+1+end])
+			i += end + 1
+			inWord = true
+		case c == '$' && i+1 < len(s) && s[i+1] == '\'':
+			i += 2
+			for ; i < len(s) && s[i] != '\''; i++ {
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+					switch s[i] {
+					case 'n':
+						current.WriteByte('\n')
+					case 't':
+						current.WriteByte('\t')
+					case 'r':
+						current.WriteByte('\r')
+					default:
+						current.WriteByte(s[i])
+					}
+					continue
+				}
+				current.WriteByte(s[i])
+			}
+			if i >= len(s) {
+				return nil, fmt.Errorf("unterminated $' quote")
+			}
+			inWord = true
+		case c == '"':
+			i++
+			for ; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) && strings.IndexByte("\"\\$`\n", s[i+1]) >= 0 {
+					i++
+					if s[i] == '\n' {
+						continue
+					}
+				}
+				current.WriteByte(s[i])
+			}
+			if i >= len(s) {
+				return nil, fmt.Errorf("unterminated double quote")
+			}
+			inWord = true
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			if inWord {
+				words = append(words, current.String())
+				current.Reset()
+				inWord = false
+			}
+		default:
+			current.WriteByte(c)
+			inWord = true
+		}
+	}
+	if inWord {
+		words = append(words, current.String())
+	}
+	return words, nil
+}
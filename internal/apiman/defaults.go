@@ -0,0 +1,112 @@
+// defaults.go
+package apiman
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// defaultsFileName holds the settings every request below its directory
+// inherits. It may sit at the workspace root or in any directory under
+// requests/.
+const defaultsFileName = "_defaults.json"
+
+// RequestDefaults are the settings of a _defaults.json file. Files deeper in
+// the tree override shallower ones and a request's own values override
+// both: headers are merged by name (an empty value leaves a header out),
+// tags are added together and timeout and retry apply when the request
+// doesn't set them.
+type RequestDefaults struct {
+	Headers map[string]string `json:"headers,omitempty"`
+	Timeout int               `json:"timeout,omitempty"`
+	Tags    []string          `json:"tags,omitempty"`
+	Retry   *RetryPolicy      `json:"retry,omitempty"`
+}
+
+// defaultsFiles returns the _defaults.json files that may apply to
+// requestPath, shallowest first: the workspace root's, then those of
+// requests/ and each directory down to the one holding the request.
+// Requests in .http files only inherit the workspace root's.
+func (cm *ConfigManager) defaultsFiles(requestPath string) []string {
+	files := []string{filepath.Join(cm.configDir, defaultsFileName)}
+	if _, _, ok := httpFileReference(requestPath); ok {
+		return files
+	}
+	dir := cm.requestsDir
+	files = append(files, filepath.Join(dir, defaultsFileName))
+	parts := strings.Split(filepath.ToSlash(requestPath), "/")
+	for _, part := range parts[:len(parts)-1] {
+		dir = filepath.Join(dir, part)
+		files = append(files, filepath.Join(dir, defaultsFileName))
+	}
+	return files
+}
+
+// loadDefaultsFile reads one _defaults.json file.
+func loadDefaultsFile(path string) (*RequestDefaults, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var defaults RequestDefaults
+	if err := json.Unmarshal(data, &defaults); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return &defaults, nil
+}
+
+// requestDefaults merges the _defaults.json files that apply to requestPath
+// (see defaultsFiles). It returns nil when there are none.
+func (cm *ConfigManager) requestDefaults(requestPath string) (*RequestDefaults, error) {
+	var merged *RequestDefaults
+	for _, path := range cm.defaultsFiles(requestPath) {
+		defaults, err := loadDefaultsFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading defaults: %w", err)
+		}
+		if merged == nil {
+			merged = &RequestDefaults{}
+		}
+		merged.Headers = mergeVariables(merged.Headers, defaults.Headers)
+		merged.Tags = appendTags(merged.Tags, defaults.Tags...)
+		if defaults.Timeout != 0 {
+			merged.Timeout = defaults.Timeout
+		}
+		if defaults.Retry != nil {
+			merged.Retry = defaults.Retry
+		}
+	}
+	return merged, nil
+}
+
+// applyDefaults fills in the settings the request inherits from defaults.
+func (c *RequestConfig) applyDefaults(defaults *RequestDefaults) {
+	if defaults == nil {
+		return
+	}
+	c.Headers = mergeVariables(defaults.Headers, c.Headers)
+	c.Tags = appendTags(slices.Clone(defaults.Tags), c.Tags...)
+	if c.Timeout == 0 {
+		c.Timeout = defaults.Timeout
+	}
+	if c.Retry == nil {
+		c.Retry = defaults.Retry
+	}
+}
+
+// appendTags adds the tags not already in tags.
+func appendTags(tags []string, more ...string) []string {
+	for _, tag := range more {
+		if !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
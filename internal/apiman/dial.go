@@ -0,0 +1,55 @@
+// dial.go
+package apiman
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// unixSocketScheme starts a baseURL or connectTo naming a Unix domain
+// socket, e.g. unix:///var/run/docker.sock.
+const unixSocketScheme = "unix://"
+
+// socketBaseURL is what requests to a unix:// baseURL are addressed to. As
+// with curl --unix-socket, the connection goes to the socket whatever the
+// host, which only ends up in the Host header.
+const socketBaseURL = "http://localhost"
+
+// requestBaseURL returns the base URL requests are built on: baseURL
+// itself, or http://localhost for a Unix socket.
+func requestBaseURL(baseURL string) string {
+	if strings.HasPrefix(baseURL, unixSocketScheme) {
+		return socketBaseURL
+	}
+	return baseURL
+}
+
+// dialTarget returns where env's connections are made instead of the host
+// in the request URL: connectTo when set, else the socket of a unix://
+// baseURL. network is empty when connections go to the URL's host as usual.
+// Relative socket paths are relative to the workspace.
+func (cm *ConfigManager) dialTarget(env *Environment) (network, address string) {
+	target := env.ConnectTo
+	if target == "" && strings.HasPrefix(env.BaseURL, unixSocketScheme) {
+		target = env.BaseURL
+	}
+	if target == "" {
+		return "", ""
+	}
+	if socket, ok := strings.CutPrefix(target, unixSocketScheme); ok {
+		return "unix", cm.workspacePath(socket)
+	}
+	return "tcp", target
+}
+
+// dialTo makes transport connect to network/address for every request,
+// bypassing proxies, which would be dialed the same way.
+func dialTo(transport *http.Transport, network, address string) {
+	var dialer net.Dialer
+	transport.Proxy = nil
+	transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+		return dialer.DialContext(ctx, network, address)
+	}
+}
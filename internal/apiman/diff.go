@@ -0,0 +1,215 @@
+// diff.go
+package apiman
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// maxDiffLines bounds the line diff, which is quadratic in the number of
+// lines.
+const maxDiffLines = 5000
+
+// diffContext is how many unchanged lines surround each change.
+const diffContext = 2
+
+type diffOp struct {
+	kind byte // ' ', '-' or '+'
+	line string
+}
+
+// diffLines returns the edit script turning a into b, based on their
+// longest common subsequence of lines.
+func diffLines(a, b []string) []diffOp {
+	// lcs[i][j] is the LCS length of a[i:] and b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var ops []diffOp
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, diffOp{' ', a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, diffOp{'-', a[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		ops = append(ops, diffOp{'-', a[i]})
+	}
+	for ; j < len(b); j++ {
+		ops = append(ops, diffOp{'+', b[j]})
+	}
+	return ops
+}
+
+// writeLineDiff prints the changed lines between before and after with a
+// little context, like a unified diff without line numbers. It reports
+// whether anything differed.
+func writeLineDiff(out io.Writer, before, after string) bool {
+	if before == after {
+		return false
+	}
+	a := strings.Split(before, "\n")
+	b := strings.Split(after, "\n")
+	if len(a) > maxDiffLines || len(b) > maxDiffLines {
+		fmt.Fprintf(out, "  (changed: %d lines -> %d lines, too large to diff)\n", len(a), len(b))
+		return true
+	}
+
+	ops := diffLines(a, b)
+	// Keep changes and the context around them.
+	keep := make([]bool, len(ops))
+	for i, op := range ops {
+		if op.kind == ' ' {
+			continue
+		}
+		for k := max(i-diffContext, 0); k <= min(i+diffContext, len(ops)-1); k++ {
+			keep[k] = true
+		}
+	}
+	skipped := false
+	for i, op := range ops {
+		if !keep[i] {
+			skipped = true
+			continue
+		}
+		if skipped {
+			fmt.Fprintln(out, "  ...")
+			skipped = false
+		}
+		fmt.Fprintf(out, "%c %s\n", op.kind, op.line)
+	}
+	return true
+}
+
+// jsonDifference is one place where two JSON documents differ. Before is
+// unset for added values and After for removed ones.
+type jsonDifference struct {
+	Path      string
+	Before    interface{}
+	After     interface{}
+	HasBefore bool
+	HasAfter  bool
+}
+
+// diffIgnore decides which fields a structural diff skips. Entries
+// starting with "$" are JSONPath-style paths, where [*] matches any array
+// index; anything else is a member name ignored at any depth.
+type diffIgnore []string
+
+func (ig diffIgnore) skip(path, key string) bool {
+	generic := arrayIndexPattern.ReplaceAllString(path, "[*]")
+	for _, entry := range ig {
+		if strings.HasPrefix(entry, "$") {
+			if entry == path || entry == generic {
+				return true
+			}
+		} else if key != "" && entry == key {
+			return true
+		}
+	}
+	return false
+}
+
+var arrayIndexPattern = regexp.MustCompile(`\[\d+\]`)
+
+// diffJSON compares two decoded JSON documents member by member and element
+// by element.
+func diffJSON(before, after interface{}, ignore diffIgnore) []jsonDifference {
+	var diffs []jsonDifference
+	var walk func(path, key string, a, b interface{})
+	walk = func(path, key string, a, b interface{}) {
+		if ignore.skip(path, key) {
+			return
+		}
+		switch av := a.(type) {
+		case map[string]interface{}:
+			if bv, ok := b.(map[string]interface{}); ok {
+				keys := sortedKeys(av)
+				for _, k := range sortedKeys(bv) {
+					if _, ok := av[k]; !ok {
+						keys = append(keys, k)
+					}
+				}
+				for _, k := range keys {
+					childPath := jsonPathChild(path, k)
+					aChild, inA := av[k]
+					bChild, inB := bv[k]
+					switch {
+					case inA && inB:
+						walk(childPath, k, aChild, bChild)
+					case ignore.skip(childPath, k):
+					case inA:
+						diffs = append(diffs, jsonDifference{Path: childPath, Before: aChild, HasBefore: true})
+					default:
+						diffs = append(diffs, jsonDifference{Path: childPath, After: bChild, HasAfter: true})
+					}
+				}
+				return
+			}
+		case []interface{}:
+			if bv, ok := b.([]interface{}); ok {
+				for i := 0; i < max(len(av), len(bv)); i++ {
+					childPath := fmt.Sprintf("%s[%d]", path, i)
+					switch {
+					case i < len(av) && i < len(bv):
+						walk(childPath, "", av[i], bv[i])
+					case ignore.skip(childPath, ""):
+					case i < len(av):
+						diffs = append(diffs, jsonDifference{Path: childPath, Before: av[i], HasBefore: true})
+					default:
+						diffs = append(diffs, jsonDifference{Path: childPath, After: bv[i], HasAfter: true})
+					}
+				}
+				return
+			}
+		}
+		if !reflect.DeepEqual(a, b) {
+			diffs = append(diffs, jsonDifference{Path: path, Before: a, After: b, HasBefore: true, HasAfter: true})
+		}
+	}
+	walk("$", "", before, after)
+	return diffs
+}
+
+var simpleMemberPattern = regexp.MustCompile(`^[A-Za-z_$][\w$]*$`)
+
+func jsonPathChild(path, key string) string {
+	if simpleMemberPattern.MatchString(key) {
+		return path + "." + key
+	}
+	quoted, _ := json.Marshal(key)
+	return path + "[" + string(quoted) + "]"
+}
+
+// compactJSON renders a decoded JSON value on one line for diff output.
+func compactJSON(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return truncateForDisplay(string(data), 120)
+}
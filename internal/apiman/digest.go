@@ -0,0 +1,267 @@
+// digest.go
+package apiman
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// An environment with
+//
+//	"auth": {"type": "digest", "username": "admin", "password": "{{env.DEVICE_PASSWORD}}"}
+//
+// uses HTTP Digest authentication (RFC 7616). Digest needs the server's
+// challenge, so it is done by the transport rather than applyAuth: the first
+// request goes out unauthenticated, and a 401 with a Digest challenge is
+// answered by resending it with credentials. Later requests through the same
+// transport reuse the nonce with an increasing nonce count.
+type digestTransport struct {
+	base     http.RoundTripper
+	username string
+	password string
+
+	mu        sync.Mutex
+	challenge *digestChallenge
+	count     int
+}
+
+// digestChallenge is the parsed WWW-Authenticate: Digest header.
+type digestChallenge struct {
+	realm     string
+	nonce     string
+	opaque    string
+	algorithm string
+	qop       string
+	stale     bool
+}
+
+func newDigestTransport(base http.RoundTripper, username, password string) *digestTransport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &digestTransport{base: base, username: username, password: password}
+}
+
+func (t *digestTransport) unwrap() http.RoundTripper {
+	return t.base
+}
+
+func (t *digestTransport) withBase(base http.RoundTripper) http.RoundTripper {
+	return newDigestTransport(base, t.username, t.password)
+}
+
+func (t *digestTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	t.mu.Lock()
+	challenge := t.challenge
+	t.mu.Unlock()
+
+	for attempt := 0; ; attempt++ {
+		out := req.Clone(req.Context())
+		if body != "" {
+			out.Body = io.NopCloser(strings.NewReader(body))
+		}
+		if challenge != nil {
+			authorization, err := t.authorization(out, body, challenge)
+			if err != nil {
+				return nil, err
+			}
+			out.Header.Set("Authorization", authorization)
+		}
+
+		resp, err := t.base.RoundTrip(out)
+		if err != nil || resp.StatusCode != http.StatusUnauthorized || attempt > 0 {
+			return resp, err
+		}
+		fresh := parseDigestChallenge(resp.Header.Values("WWW-Authenticate"))
+		if fresh == nil || (challenge != nil && !fresh.stale && fresh.nonce == challenge.nonce) {
+			// Not a Digest server, or the credentials were rejected.
+			return resp, nil
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+
+		t.mu.Lock()
+		t.challenge, t.count = fresh, 0
+		t.mu.Unlock()
+		challenge = fresh
+	}
+}
+
+// authorization builds the Authorization header answering challenge.
+func (t *digestTransport) authorization(req *http.Request, body string, challenge *digestChallenge) (string, error) {
+	cnonce, err := digestCnonce()
+	if err != nil {
+		return "", err
+	}
+	t.mu.Lock()
+	t.count++
+	nc := fmt.Sprintf("%08x", t.count)
+	t.mu.Unlock()
+	return digestAuthorization(challenge, t.username, t.password, req.Method, req.URL.RequestURI(), body, nc, cnonce)
+}
+
+// digestAuthorization answers challenge for a request to uri with the
+// nonce count nc and client nonce cnonce.
+func digestAuthorization(challenge *digestChallenge, username, password, method, uri, body, nc, cnonce string) (string, error) {
+	newHash := md5.New
+	algorithm := strings.ToUpper(challenge.algorithm)
+	switch strings.TrimSuffix(algorithm, "-SESS") {
+	case "", "MD5":
+	case "SHA-256":
+		newHash = sha256.New
+	default:
+		return "", fmt.Errorf("unsupported digest algorithm %q", challenge.algorithm)
+	}
+	h := func(parts ...string) string {
+		return digestHash(newHash, strings.Join(parts, ":"))
+	}
+
+	ha1 := h(username, challenge.realm, password)
+	if strings.HasSuffix(algorithm, "-SESS") {
+		ha1 = h(ha1, challenge.nonce, cnonce)
+	}
+	qop := chooseDigestQop(challenge.qop)
+	ha2 := h(method, uri)
+	if qop == "auth-int" {
+		ha2 = h(method, uri, h(body))
+	}
+
+	fields := []string{
+		fmt.Sprintf("username=%q", username),
+		fmt.Sprintf("realm=%q", challenge.realm),
+		fmt.Sprintf("nonce=%q", challenge.nonce),
+		fmt.Sprintf("uri=%q", uri),
+	}
+	if qop == "" {
+		fields = append(fields, fmt.Sprintf("response=%q", h(ha1, challenge.nonce, ha2)))
+	} else {
+		fields = append(fields,
+			fmt.Sprintf("response=%q", h(ha1, challenge.nonce, nc, cnonce, qop, ha2)),
+			"qop="+qop,
+			"nc="+nc,
+			fmt.Sprintf("cnonce=%q", cnonce),
+		)
+	}
+	if challenge.algorithm != "" {
+		fields = append(fields, "algorithm="+challenge.algorithm)
+	}
+	if challenge.opaque != "" {
+		fields = append(fields, fmt.Sprintf("opaque=%q", challenge.opaque))
+	}
+	return "Digest " + strings.Join(fields, ", "), nil
+}
+
+func digestHash(newHash func() hash.Hash, s string) string {
+	sum := newHash()
+	io.WriteString(sum, s)
+	return hex.EncodeToString(sum.Sum(nil))
+}
+
+func digestCnonce() (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generating digest cnonce: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// chooseDigestQop picks auth over auth-int from the offered qop options,
+// or "" for servers that offer none (RFC 2069).
+func chooseDigestQop(offered string) string {
+	var qop string
+	for _, option := range strings.Split(offered, ",") {
+		switch strings.TrimSpace(option) {
+		case "auth":
+			return "auth"
+		case "auth-int":
+			qop = "auth-int"
+		}
+	}
+	return qop
+}
+
+// parseDigestChallenge returns the first Digest challenge among the
+// WWW-Authenticate headers whose algorithm api-man supports, preferring
+// SHA-256 when the server offers several.
+func parseDigestChallenge(headers []string) *digestChallenge {
+	var chosen *digestChallenge
+	for _, header := range headers {
+		scheme, params, _ := strings.Cut(strings.TrimSpace(header), " ")
+		if !strings.EqualFold(scheme, "Digest") {
+			continue
+		}
+		challenge := &digestChallenge{}
+		for key, value := range parseAuthParams(params) {
+			switch strings.ToLower(key) {
+			case "realm":
+				challenge.realm = value
+			case "nonce":
+				challenge.nonce = value
+			case "opaque":
+				challenge.opaque = value
+			case "algorithm":
+				challenge.algorithm = value
+			case "qop":
+				challenge.qop = value
+			case "stale":
+				challenge.stale = strings.EqualFold(value, "true")
+			}
+		}
+		switch strings.TrimSuffix(strings.ToUpper(challenge.algorithm), "-SESS") {
+		case "SHA-256":
+			return challenge
+		case "", "MD5":
+			if chosen == nil {
+				chosen = challenge
+			}
+		}
+	}
+	return chosen
+}
+
+// parseAuthParams splits the comma-separated key=value pairs of an
+// authentication header, where values may be quoted and contain commas.
+func parseAuthParams(s string) map[string]string {
+	params := map[string]string{}
+	for s = strings.TrimSpace(s); s != ""; s = strings.TrimSpace(s) {
+		key, rest, ok := strings.Cut(s, "=")
+		if !ok {
+			break
+		}
+		key = strings.TrimSpace(key)
+		rest = strings.TrimSpace(rest)
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			var b strings.Builder
+			i := 1
+			for ; i < len(rest) && rest[i] != '"'; i++ {
+				if rest[i] == '\\' && i+1 < len(rest) {
+					i++
+				}
+				b.WriteByte(rest[i])
+			}
+			value = b.String()
+			rest = rest[min(i+1, len(rest)):]
+		} else {
+			value, rest, _ = strings.Cut(rest, ",")
+			value = strings.TrimSpace(value)
+			rest = "," + rest
+		}
+		params[key] = value
+		_, s, _ = strings.Cut(rest, ",")
+	}
+	return params
+}
@@ -0,0 +1,123 @@
+package apiman
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestDigestAuthorization checks the examples of RFC 7616 section 3.9.1,
+// RFC 2617 section 3.5 and RFC 2069 section 2.4.
+func TestDigestAuthorization(t *testing.T) {
+	rfc7616 := digestChallenge{
+		realm:  "http-auth@example.org",
+		nonce:  "7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v",
+		opaque: "FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS",
+		qop:    "auth, auth-int",
+	}
+	rfc7616SHA256, rfc7616MD5 := rfc7616, rfc7616
+	rfc7616SHA256.algorithm, rfc7616MD5.algorithm = "SHA-256", "MD5"
+	rfc2617 := digestChallenge{realm: "testrealm@host.com", nonce: "dcd98b7102dd2f0e8b11d0f600bfb0c093", opaque: "5ccc069c403ebaf9f0171e9517f40e41", qop: "auth,auth-int"}
+	rfc2069 := digestChallenge{realm: "testrealm@host.com", nonce: "dcd98b7102dd2f0e8b11d0f600bfb0c093", opaque: "5ccc069c403ebaf9f0171e9517f40e41"}
+
+	tests := []struct {
+		challenge          digestChallenge
+		password, cnonce   string
+		response, trailing string
+	}{
+		{rfc7616SHA256, "Circle of Life", "f2/wE4q74E6zIJEtWaHKaf5wv/H5QzzpXusqGemxURZJ", "753927fa0e85d155564e2e272a28d1802ca10daf4496794697cf8db5856cb6c1",
+			`qop=auth, nc=00000001, cnonce="f2/wE4q74E6zIJEtWaHKaf5wv/H5QzzpXusqGemxURZJ", algorithm=SHA-256, opaque="FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS"`},
+		{rfc7616MD5, "Circle of Life", "f2/wE4q74E6zIJEtWaHKaf5wv/H5QzzpXusqGemxURZJ", "8ca523f5e9506fed4657c9700eebdbec",
+			`qop=auth, nc=00000001, cnonce="f2/wE4q74E6zIJEtWaHKaf5wv/H5QzzpXusqGemxURZJ", algorithm=MD5, opaque="FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS"`},
+		{rfc2617, "Circle Of Life", "0a4f113b", "6629fae49393a05397450978507c4ef1",
+			`qop=auth, nc=00000001, cnonce="0a4f113b", opaque="5ccc069c403ebaf9f0171e9517f40e41"`},
+		{rfc2069, "CircleOfLife", "unused", "1949323746fe6a43ef61f9606e7febea",
+			`opaque="5ccc069c403ebaf9f0171e9517f40e41"`},
+	}
+	for _, tt := range tests {
+		got, err := digestAuthorization(&tt.challenge, "Mufasa", tt.password, "GET", "/dir/index.html", "", "00000001", tt.cnonce)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := `Digest username="Mufasa", realm="` + tt.challenge.realm + `", nonce="` + tt.challenge.nonce + `", uri="/dir/index.html", response="` + tt.response + `", ` + tt.trailing
+		if got != want {
+			t.Errorf("%s %s:\n got %s\nwant %s", tt.challenge.realm, tt.challenge.algorithm, got, want)
+		}
+	}
+
+	unsupported := digestChallenge{realm: "r", nonce: "n", algorithm: "SHA-512-256"}
+	if _, err := digestAuthorization(&unsupported, "u", "p", "GET", "/", "", "00000001", "c"); err == nil {
+		t.Error("unsupported algorithm accepted")
+	}
+}
+
+func TestParseDigestChallenge(t *testing.T) {
+	challenge := parseDigestChallenge([]string{
+		`Basic realm="api"`,
+		`Digest realm="http-auth@example.org", qop="auth, auth-int", algorithm=MD5, nonce="a,b", opaque="o"`,
+		`Digest realm="http-auth@example.org", qop="auth, auth-int", algorithm=SHA-256, nonce="c\"d", stale=TRUE`,
+	})
+	want := digestChallenge{realm: "http-auth@example.org", nonce: `c"d`, algorithm: "SHA-256", qop: "auth, auth-int", stale: true}
+	if challenge == nil || *challenge != want {
+		t.Errorf("got %+v, want %+v", challenge, want)
+	}
+	if challenge := parseDigestChallenge([]string{`Digest realm="r", nonce="n", algorithm=SHA-512-256`}); challenge != nil {
+		t.Errorf("unsupported algorithm chosen: %+v", challenge)
+	}
+	for offered, want := range map[string]string{"": "", "auth-int": "auth-int", "auth-int, auth": "auth", "token": ""} {
+		if got := chooseDigestQop(offered); got != want {
+			t.Errorf("qop %q chose %q, want %q", offered, got, want)
+		}
+	}
+}
+
+func TestDigestTransport(t *testing.T) {
+	nonce := "first"
+	var counts []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		params := parseAuthParams(strings.TrimPrefix(r.Header.Get("Authorization"), "Digest "))
+		challenge := &digestChallenge{realm: "api", nonce: nonce, qop: "auth"}
+		want, _ := digestAuthorization(challenge, "admin", "secret", r.Method, r.URL.RequestURI(), "", params["nc"], params["cnonce"])
+		if r.Header.Get("Authorization") != want {
+			stale := ""
+			if params["nonce"] != "" && params["nonce"] != nonce {
+				stale = ", stale=true"
+			}
+			w.Header().Set("WWW-Authenticate", `Digest realm="api", qop="auth", nonce="`+nonce+`"`+stale)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		counts = append(counts, params["nc"])
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: newDigestTransport(nil, "admin", "secret")}
+	get := func() int {
+		t.Helper()
+		resp, err := client.Get(server.URL + "/status?verbose=1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	for range 2 {
+		if status := get(); status != http.StatusOK {
+			t.Fatalf("status %d", status)
+		}
+	}
+	// A stale nonce is replaced and the count starts over.
+	nonce = "second"
+	if status := get(); status != http.StatusOK {
+		t.Fatalf("status %d after the nonce changed", status)
+	}
+	if got := strings.Join(counts, ","); got != "00000001,00000002,00000001" {
+		t.Errorf("nonce counts %s", got)
+	}
+
+	client.Transport = newDigestTransport(nil, "admin", "wrong")
+	if status := get(); status != http.StatusUnauthorized {
+		t.Errorf("wrong password: status %d", status)
+	}
+}
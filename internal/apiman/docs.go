@@ -0,0 +1,401 @@
+// docs.go
+package apiman
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"maps"
+	"net/http"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// docsFormats are the formats accepted by api-man docs generate.
+var docsFormats = []string{"markdown", "html"}
+
+// maxDocsExample caps how much of a sample response is included in the
+// generated documentation.
+const maxDocsExample = 8 * 1024
+
+// Docs is the documentation of a workspace: its requests grouped by
+// directory, each with its notes and its saved examples or, when it has
+// none, the latest successful response from the history as an example.
+type Docs struct {
+	Title    string
+	Sections []DocsSection
+}
+
+// DocsSection holds the requests of one directory.
+type DocsSection struct {
+	Name     string
+	Requests []DocsRequest
+}
+
+// DocsRequest describes one request as stored in the workspace.
+type DocsRequest struct {
+	Path        string
+	Name        string
+	Description string
+	Method      string
+	URL         string
+	Headers     map[string]string
+	Params      map[string]string
+	PathParams  map[string]string
+	Notes       string
+	Bodies      []DocsBody
+	Examples    []*RequestExample
+	Example     *HistoryEntry
+}
+
+// DocsBody is an example request body: the inline body or a body template.
+type DocsBody struct {
+	Name    string
+	Content string
+	Active  bool
+}
+
+// Anchor is the request's link target in the generated documentation.
+func (r *DocsRequest) Anchor() string {
+	return strings.NewReplacer("/", "-", ".", "-", "_", "-").Replace(strings.ToLower(r.Path))
+}
+
+// BuildDocs collects the documentation of every request in the workspace.
+// Only the request definitions are read: variables are shown unresolved, so
+// the documentation holds no environment's secrets. Sample responses are the
+// request's saved examples, or else come from the history, and are left out
+// when there is none.
+func (cm *ConfigManager) BuildDocs(title string) (*Docs, error) {
+	paths, err := cm.RequestPaths()
+	if err != nil {
+		return nil, fmt.Errorf("listing requests: %w", err)
+	}
+	if title == "" {
+		title = filepath.Base(cm.configDir) + " API"
+	}
+
+	// The history is newest first, so the first successful entry of a
+	// request is its latest.
+	history, err := cm.ListHistory(0)
+	if err != nil {
+		return nil, err
+	}
+	examples := make(map[string]*HistoryEntry)
+	for _, entry := range history {
+		if entry.Request == "" || entry.Error != "" || entry.StatusCode >= 400 {
+			continue
+		}
+		if _, ok := examples[entry.Request]; !ok {
+			examples[entry.Request] = entry
+		}
+	}
+
+	docs := &Docs{Title: title}
+	for _, requestPath := range paths {
+		config, err := cm.LoadRequest(requestPath)
+		if err != nil {
+			return nil, fmt.Errorf("loading %s: %w", requestPath, err)
+		}
+		request := DocsRequest{
+			Path:        requestPath,
+			Name:        config.Name,
+			Description: config.Description,
+			Method:      strings.ToUpper(config.Method),
+			URL:         config.URL,
+			Headers:     config.Headers,
+			Params:      docsParams(config.Params),
+			PathParams:  config.PathParams,
+			Example:     examples[requestPath],
+		}
+		if request.Name == "" {
+			request.Name = path.Base(requestPath)
+		}
+		if config.GRPC != nil {
+			request.Method = "GRPC"
+			request.URL = strings.TrimSuffix(config.URL, "/") + config.GRPC.FullMethod()
+		}
+		request.Bodies = cm.docsBodies(requestPath, config)
+		if request.Notes, err = cm.LoadNotes(requestPath); err != nil {
+			return nil, err
+		}
+		if request.Examples, err = cm.ListExamples(requestPath); err != nil {
+			return nil, fmt.Errorf("loading examples of %s: %w", requestPath, err)
+		}
+		if len(request.Examples) > 0 {
+			request.Example = nil
+		}
+
+		section := path.Dir(requestPath)
+		if section == "." {
+			section = "root"
+		}
+		if n := len(docs.Sections); n == 0 || docs.Sections[n-1].Name != section {
+			docs.Sections = append(docs.Sections, DocsSection{Name: section})
+		}
+		last := &docs.Sections[len(docs.Sections)-1]
+		last.Requests = append(last.Requests, request)
+	}
+	return docs, nil
+}
+
+// docsBodies returns the inline body followed by the body templates, the
+// active one marked.
+func (cm *ConfigManager) docsBodies(requestPath string, config *RequestConfig) []DocsBody {
+	var bodies []DocsBody
+	if strings.TrimSpace(config.Body) != "" {
+		bodies = append(bodies, DocsBody{Name: defaultBodyName, Content: config.Body, Active: config.ActiveBody == "" || config.ActiveBody == defaultBodyName})
+	}
+	names, active, err := cm.ListBodies(requestPath)
+	if err != nil {
+		return bodies
+	}
+	for _, name := range names {
+		content, file, err := cm.readBodyFile(requestPath, name)
+		if err != nil {
+			continue
+		}
+		bodies = append(bodies, DocsBody{Name: name, Content: bodyPreview(file, content), Active: name == active})
+	}
+	return bodies
+}
+
+// docsParams flattens query parameters, joining repeated values.
+func docsParams(params map[string]interface{}) map[string]string {
+	if len(params) == 0 {
+		return nil
+	}
+	flat := make(map[string]string, len(params))
+	for key, value := range params {
+		switch v := value.(type) {
+		case []interface{}:
+			values := make([]string, len(v))
+			for i, item := range v {
+				values[i] = fmt.Sprint(item)
+			}
+			flat[key] = strings.Join(values, ", ")
+		default:
+			flat[key] = fmt.Sprint(v)
+		}
+	}
+	return flat
+}
+
+// exampleBody returns a sample response body formatted for reading and cut
+// to maxDocsExample.
+func exampleBody(body string, headers http.Header) string {
+	body = formatResponseBody([]byte(body), headers.Get("Content-Type"))
+	if len(body) > maxDocsExample {
+		body = body[:maxDocsExample] + "\n… (truncated)"
+	}
+	return body
+}
+
+// codeLanguage guesses the fence language of a body for syntax
+// highlighting.
+func codeLanguage(body, contentType string) string {
+	trimmed := strings.TrimSpace(body)
+	if strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[") {
+		return "json"
+	}
+	if kind := bodyKind([]byte(body), contentType); kind != "" {
+		return kind
+	}
+	return ""
+}
+
+// WriteDocs renders docs to out as Markdown or a self-contained HTML page.
+func WriteDocs(out io.Writer, docs *Docs, format string) error {
+	switch format {
+	case "markdown", "md":
+		return writeMarkdownDocs(out, docs)
+	case "html":
+		return docsTemplate.Execute(out, docs)
+	default:
+		return fmt.Errorf("unknown docs format %q (expected one of %s)", format, strings.Join(docsFormats, ", "))
+	}
+}
+
+func writeMarkdownDocs(out io.Writer, docs *Docs) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n", docs.Title)
+	for _, section := range docs.Sections {
+		fmt.Fprintf(&b, "- **%s**\n", section.Name)
+		for _, request := range section.Requests {
+			fmt.Fprintf(&b, "  - [%s %s](#%s)\n", request.Method, request.Name, request.Anchor())
+		}
+	}
+
+	for _, section := range docs.Sections {
+		fmt.Fprintf(&b, "\n## %s\n", section.Name)
+		for _, request := range section.Requests {
+			fmt.Fprintf(&b, "\n<a id=\"%s\"></a>\n### %s\n\n", request.Anchor(), request.Name)
+			fmt.Fprintf(&b, "`%s %s`\n\n", request.Method, request.URL)
+			fmt.Fprintf(&b, "Request: `%s`\n", request.Path)
+			if request.Description != "" {
+				fmt.Fprintf(&b, "\n%s\n", request.Description)
+			}
+			if request.Notes != "" {
+				fmt.Fprintf(&b, "\n%s\n", nestHeadings(strings.TrimRight(request.Notes, "\n"), 3))
+			}
+			writeMarkdownTable(&b, "Path parameters", request.PathParams)
+			writeMarkdownTable(&b, "Query parameters", request.Params)
+			writeMarkdownTable(&b, "Headers", request.Headers)
+			for _, body := range request.Bodies {
+				label := "Body"
+				if body.Name != defaultBodyName {
+					label = "Body `" + body.Name + "`"
+				}
+				if body.Active {
+					label += " (active)"
+				}
+				contentType := request.Headers["Content-Type"]
+				fmt.Fprintf(&b, "\n**%s**\n\n```%s\n%s\n```\n", label, codeLanguage(body.Content, contentType), strings.TrimRight(body.Content, "\n"))
+			}
+			for _, example := range request.Examples {
+				fmt.Fprintf(&b, "\n**Example `%s`** `%s` (%s, %dms)\n", example.Name, example.Status, example.Timestamp.Format("2006-01-02"), example.DurationMS)
+				writeMarkdownExample(&b, example.Body, example.Headers)
+			}
+			if entry := request.Example; entry != nil {
+				fmt.Fprintf(&b, "\n**Example response** `%s` (%s, %dms)\n", entry.Status, entry.Timestamp.Format("2006-01-02"), entry.DurationMS)
+				writeMarkdownExample(&b, entry.Body, entry.Headers)
+			}
+		}
+	}
+	_, err := io.WriteString(out, b.String())
+	return err
+}
+
+// nestHeadings moves the Markdown headings of notes levels deeper, so the
+// notes' own headings sit below the request's. Code blocks are left alone.
+func nestHeadings(notes string, levels int) string {
+	lines := strings.Split(notes, "\n")
+	inCode := false
+	for i, line := range lines {
+		if strings.HasPrefix(line, "```") || strings.HasPrefix(line, "~~~") {
+			inCode = !inCode
+		}
+		if !inCode && strings.HasPrefix(line, "#") {
+			lines[i] = strings.Repeat("#", levels) + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// writeMarkdownExample writes a sample response body as a code block,
+// nothing when it is empty.
+func writeMarkdownExample(b *strings.Builder, body string, headers http.Header) {
+	body = exampleBody(body, headers)
+	if strings.TrimSpace(body) != "" {
+		fmt.Fprintf(b, "\n```%s\n%s\n```\n", codeLanguage(body, headers.Get("Content-Type")), strings.TrimRight(body, "\n"))
+	}
+}
+
+// writeMarkdownTable writes values as a name/value table under title,
+// nothing when there are none.
+func writeMarkdownTable(b *strings.Builder, title string, values map[string]string) {
+	if len(values) == 0 {
+		return
+	}
+	fmt.Fprintf(b, "\n**%s**\n\n| Name | Value |\n| --- | --- |\n", title)
+	for _, name := range slices.Sorted(maps.Keys(values)) {
+		fmt.Fprintf(b, "| `%s` | `%s` |\n", markdownCell(name), markdownCell(values[name]))
+	}
+}
+
+func markdownCell(s string) string {
+	return strings.NewReplacer("|", `\|`, "\n", " ", "`", "'").Replace(s)
+}
+
+// docsTable is a titled name/value table in the HTML documentation.
+type docsTable struct {
+	Title  string
+	Values map[string]string
+}
+
+var docsTemplate = template.Must(template.New("docs").Funcs(template.FuncMap{
+	"sorted":  func(m map[string]string) []string { return slices.Sorted(maps.Keys(m)) },
+	"lower":   strings.ToLower,
+	"example": exampleBody,
+	"table": func(title string, values map[string]string) docsTable {
+		return docsTable{Title: title, Values: values}
+	},
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+<style>
+body { margin: 0; font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", sans-serif; color: #1f2328; display: flex; }
+nav { width: 280px; height: 100vh; position: sticky; top: 0; overflow-y: auto; background: #f6f8fa; border-right: 1px solid #d0d7de; padding: 16px; box-sizing: border-box; font-size: 14px; }
+nav h2 { font-size: 12px; text-transform: uppercase; color: #656d76; margin: 16px 0 4px; }
+nav a { display: block; padding: 2px 0; color: inherit; text-decoration: none; }
+main { flex: 1; padding: 24px 40px; max-width: 960px; }
+section.request { border-top: 1px solid #d0d7de; padding: 8px 0 16px; }
+.method { display: inline-block; min-width: 52px; font: bold 12px monospace; padding: 2px 6px; border-radius: 4px; color: #fff; background: #656d76; text-align: center; }
+.method.get { background: #1f883d; } .method.post { background: #0969da; } .method.put, .method.patch { background: #9a6700; } .method.delete { background: #cf222e; }
+code, pre { font-family: ui-monospace, SFMono-Regular, Menlo, monospace; font-size: 13px; }
+pre { background: #f6f8fa; border: 1px solid #d0d7de; border-radius: 6px; padding: 12px; overflow-x: auto; }
+table { border-collapse: collapse; margin: 4px 0 12px; }
+td, th { border: 1px solid #d0d7de; padding: 4px 10px; text-align: left; font-size: 13px; }
+.dim { color: #656d76; font-size: 13px; }
+.notes { white-space: pre-wrap; border-left: 4px solid #d0d7de; padding: 4px 12px; margin: 12px 0; }
+</style>
+</head>
+<body>
+<nav>
+<strong>{{.Title}}</strong>
+{{- range .Sections}}
+<h2>{{.Name}}</h2>
+{{- range .Requests}}
+<a href="#{{.Anchor}}"><span class="method {{lower .Method}}">{{.Method}}</span> {{.Name}}</a>
+{{- end}}
+{{- end}}
+</nav>
+<main>
+<h1>{{.Title}}</h1>
+{{- range .Sections}}
+<h2>{{.Name}}</h2>
+{{- range .Requests}}
+<section class="request" id="{{.Anchor}}">
+<h3>{{.Name}}</h3>
+<p><span class="method {{lower .Method}}">{{.Method}}</span> <code>{{.URL}}</code></p>
+<p class="dim">Request: <code>{{.Path}}</code></p>
+{{- if .Description}}
+<p>{{.Description}}</p>
+{{- end}}
+{{- if .Notes}}
+<div class="notes">{{.Notes}}</div>
+{{- end}}
+{{- template "table" (table "Path parameters" .PathParams)}}
+{{- template "table" (table "Query parameters" .Params)}}
+{{- template "table" (table "Headers" .Headers)}}
+{{- range .Bodies}}
+<h4>Body{{if ne .Name "default"}} <code>{{.Name}}</code>{{end}}{{if .Active}} <span class="dim">(active)</span>{{end}}</h4>
+<pre>{{.Content}}</pre>
+{{- end}}
+{{- range .Examples}}
+<h4>Example <code>{{.Name}}</code> <code>{{.Status}}</code> <span class="dim">{{.Timestamp.Format "2006-01-02"}}, {{.DurationMS}}ms</span></h4>
+<pre>{{example .Body .Headers}}</pre>
+{{- end}}
+{{- with .Example}}
+<h4>Example response <code>{{.Status}}</code> <span class="dim">{{.Timestamp.Format "2006-01-02"}}, {{.DurationMS}}ms</span></h4>
+<pre>{{example .Body .Headers}}</pre>
+{{- end}}
+</section>
+{{- end}}
+{{- end}}
+</main>
+</body>
+</html>
+{{define "table"}}{{if .Values}}
+<h4>{{.Title}}</h4>
+<table>
+{{- $values := .Values}}
+{{- range sorted $values}}
+<tr><td><code>{{.}}</code></td><td><code>{{index $values .}}</code></td></tr>
+{{- end}}
+</table>
+{{- end}}{{end}}`))
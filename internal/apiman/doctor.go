@@ -0,0 +1,239 @@
+// doctor.go
+package apiman
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DoctorIssue is a problem api-man doctor found in the state directory.
+type DoctorIssue struct {
+	File    string `json:"file"`
+	Problem string `json:"problem"`
+	// Fix is what --fix does, or did when Fixed is set.
+	Fix   string `json:"fix"`
+	Fixed bool   `json:"fixed"`
+
+	repair func() error
+}
+
+// DoctorReport is the result of Doctor.
+type DoctorReport struct {
+	Files  int           `json:"files"`
+	Issues []DoctorIssue `json:"issues"`
+	// BackupDir holds the corrupt files --fix moved aside, if any.
+	BackupDir string `json:"backupDir,omitempty"`
+}
+
+// Unfixed returns the number of issues that haven't been repaired.
+func (r *DoctorReport) Unfixed() int {
+	n := 0
+	for _, issue := range r.Issues {
+		if !issue.Fixed {
+			n++
+		}
+	}
+	return n
+}
+
+// Doctor checks the files api-man keeps in .api-man/ for damage a crash or
+// two processes writing at once can leave: a history database failing
+// SQLite's integrity check, variable stores, token caches and the secret
+// index that aren't valid JSON, metrics lines that aren't records, and
+// temporary and lock files left behind.
+// With fix, corrupt files are moved to .api-man/backups/doctor-<time>/,
+// corrupt metrics lines dropped (the original file is backed up too), and
+// leftover temporary and lock files removed.
+func (cm *ConfigManager) Doctor(fix bool) (*DoctorReport, error) {
+	report := &DoctorReport{Issues: []DoctorIssue{}}
+	backupDir := filepath.Join(cm.stateDir(), "backups", "doctor-"+time.Now().UTC().Format("20060102T150405Z"))
+	quarantine := func(path string) func() error {
+		return func() error {
+			rel, err := filepath.Rel(cm.stateDir(), path)
+			if err != nil {
+				return err
+			}
+			dest := filepath.Join(backupDir, rel)
+			if err := os.MkdirAll(filepath.Dir(dest), 0700); err != nil {
+				return err
+			}
+			report.BackupDir = cm.relativePath(backupDir)
+			return os.Rename(path, dest)
+		}
+	}
+	remove := func(path string) func() error {
+		return func() error { return os.Remove(path) }
+	}
+
+	checkJSON := func(pattern string, v func() interface{}, fix string, repair func(string) func() error) error {
+		files, err := filepath.Glob(filepath.Join(cm.stateDir(), pattern))
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			report.Files++
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return fmt.Errorf("reading %s: %w", file, err)
+			}
+			if err := json.Unmarshal(data, v()); err != nil {
+				report.add(cm.relativePath(file), "invalid JSON: "+err.Error(), fix, repair(file))
+			}
+		}
+		return nil
+	}
+	checks := []struct {
+		pattern string
+		value   func() interface{}
+		fix     string
+		repair  func(string) func() error
+	}{
+		{"variables/*.json", func() interface{} { return &map[string]string{} }, "move to backups", quarantine},
+		{"cookies/*.json", func() interface{} { return &map[string]JarCookie{} }, "move to backups", quarantine},
+		{"tokens/*.json", func() interface{} { return &cachedOAuth2Token{} }, "remove (a new token is fetched on next use)", remove},
+		{"secret-names.json", func() interface{} { return &[]string{} }, "move to backups (secret set re-adds a name)", quarantine},
+		{"cache/*.json", func() interface{} { return &CachedResponse{} }, "remove (the response is fetched again)", remove},
+	}
+	for _, check := range checks {
+		if err := checkJSON(check.pattern, check.value, check.fix, check.repair); err != nil {
+			return nil, err
+		}
+	}
+
+	cm.checkHistory(report, quarantine)
+	if err := cm.checkMetrics(report, quarantine); err != nil {
+		return nil, err
+	}
+	if err := cm.checkLeftovers(report); err != nil {
+		return nil, err
+	}
+
+	if fix {
+		for i := range report.Issues {
+			issue := &report.Issues[i]
+			if err := issue.repair(); err != nil && !os.IsNotExist(err) {
+				return report, fmt.Errorf("repairing %s: %w", issue.File, err)
+			}
+			issue.Fixed = true
+		}
+	}
+	return report, nil
+}
+
+func (r *DoctorReport) add(file, problem, fix string, repair func() error) {
+	r.Issues = append(r.Issues, DoctorIssue{File: file, Problem: problem, Fix: fix, repair: repair})
+}
+
+// checkHistory runs SQLite's integrity check on the history database.
+func (cm *ConfigManager) checkHistory(report *DoctorReport, quarantine func(string) func() error) {
+	path := cm.historyFile()
+	// Without cgo the database can't be read, which isn't corruption.
+	if !fileExists(path) || errHistoryUnavailable != nil {
+		return
+	}
+	report.Files++
+	db, err := sql.Open("sqlite3", "file:"+path+"?mode=ro&_busy_timeout=10000")
+	result := ""
+	if err == nil {
+		err = db.QueryRow("PRAGMA quick_check").Scan(&result)
+		db.Close()
+	}
+	if err == nil && result == "ok" {
+		return
+	}
+	problem := "corrupt database: " + result
+	if err != nil {
+		problem = "corrupt database: " + err.Error()
+	}
+	report.add(cm.relativePath(path), problem, "move to backups, starting an empty history", func() error {
+		for _, suffix := range []string{"-wal", "-shm"} {
+			if err := quarantine(path + suffix)(); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+		return quarantine(path)()
+	})
+}
+
+// checkMetrics reports metrics lines that aren't records, such as a line
+// cut short by a crash that later records were appended to.
+func (cm *ConfigManager) checkMetrics(report *DoctorReport, quarantine func(string) func() error) error {
+	path := cm.metricsFile()
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("reading metrics: %w", err)
+	}
+	report.Files++
+	var kept [][]byte
+	bad := 0
+	for _, line := range bytes.SplitAfter(data, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var record MetricRecord
+		if json.Unmarshal(line, &record) != nil || !bytes.HasSuffix(line, []byte("\n")) {
+			bad++
+			continue
+		}
+		kept = append(kept, line)
+	}
+	if bad == 0 {
+		return nil
+	}
+	report.add(cm.relativePath(path), fmt.Sprintf("%d line(s) aren't metric records", bad), "drop them, backing up the original", func() error {
+		if err := quarantine(path)(); err != nil {
+			return err
+		}
+		return writeFileAtomic(path, bytes.Join(kept, nil), 0644)
+	})
+	return nil
+}
+
+// checkLeftovers reports temporary files writeFileAtomic didn't get to
+// rename and locks older than staleLockAge, both left by processes that
+// died. Newer ones may belong to a process still running.
+func (cm *ConfigManager) checkLeftovers(report *DoctorReport) error {
+	err := filepath.WalkDir(cm.stateDir(), func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			if path == filepath.Join(cm.stateDir(), "backups") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		var problem string
+		switch {
+		case strings.HasPrefix(d.Name(), ".") && strings.Contains(d.Name(), tempFileMarker):
+			problem = "temporary file left by an interrupted write"
+		case filepath.Dir(path) == cm.locksDir() && strings.HasSuffix(d.Name(), ".lock"):
+			problem = "stale lock"
+		default:
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil || time.Since(info.ModTime()) <= staleLockAge {
+			return nil
+		}
+		report.add(cm.relativePath(path), problem, "remove", func() error { return os.Remove(path) })
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("scanning state directory: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+// dotenv.go
+package apiman
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// environmentVariables returns env's variables with the values from its
+// envFile and then the variable store layered over them. Both are read on
+// every call so changes apply to the next execution.
+func (cm *ConfigManager) environmentVariables(envName string, env *Environment) (map[string]string, error) {
+	var dotenv map[string]string
+	if env.EnvFile != "" {
+		var err error
+		dotenv, err = readDotenv(cm.workspacePath(env.EnvFile))
+		if err != nil {
+			return nil, fmt.Errorf("reading envFile: %w", err)
+		}
+	}
+	stored, err := cm.StoredVariables(envName)
+	if err != nil {
+		return nil, err
+	}
+	return mergeVariables(env.Variables, dotenv, stored), nil
+}
+
+// readDotenv parses a .env file of KEY=VALUE lines. Blank lines, # comments
+// and a leading "export " are ignored. Values may be single-quoted (taken
+// literally) or double-quoted (\n, \t, \" and \\ are unescaped); unquoted
+// values end at " #".
+func readDotenv(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		key, value, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("%s:%d: expected KEY=VALUE", path, lineNumber)
+		}
+		value, err := dotenvValue(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, lineNumber, err)
+		}
+		values[key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+func dotenvValue(raw string) (string, error) {
+	if raw == "" {
+		return "", nil
+	}
+	switch quote := raw[0]; quote {
+	case '\'', '"':
+		end := strings.LastIndexByte(raw, quote)
+		if end == 0 {
+			return "", fmt.Errorf("unterminated %c quote", quote)
+		}
+		value := raw[1:end]
+		if quote == '"' {
+			value = strings.NewReplacer(`\n`, "\n", `\t`, "\t", `\"`, `"`, `\\`, `\`).Replace(value)
+		}
+		return value, nil
+	default:
+		if i := strings.Index(raw, " #"); i >= 0 {
+			raw = strings.TrimSpace(raw[:i])
+		}
+		return raw, nil
+	}
+}
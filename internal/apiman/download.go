@@ -0,0 +1,165 @@
+// download.go
+package apiman
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// progressThreshold is how much of a response must arrive before a progress
+// bar is drawn, so small responses don't flicker one.
+const progressThreshold = 1 << 20
+
+// isBinaryResponse reports whether a response shouldn't be printed to a
+// terminal: its body looks binary or its Content-Type isn't a text type.
+func isBinaryResponse(result *ExecutionResult) bool {
+	if isBinaryBody(result.Body) {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(result.Headers.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+	return !isTextMediaType(mediaType)
+}
+
+func isTextMediaType(mediaType string) bool {
+	if strings.HasPrefix(mediaType, "text/") {
+		return true
+	}
+	for _, suffix := range []string{"json", "xml", "yaml"} {
+		if strings.HasSuffix(mediaType, "/"+suffix) || strings.HasSuffix(mediaType, "+"+suffix) {
+			return true
+		}
+	}
+	switch mediaType {
+	case "application/javascript", "application/ecmascript", "application/graphql",
+		"application/x-www-form-urlencoded", "application/x-ndjson", "application/x-yaml":
+		return true
+	}
+	return false
+}
+
+// attachmentName returns the file name suggested by a Content-Disposition
+// header, reduced to its base name so a server can't pick the directory.
+func attachmentName(result *ExecutionResult) string {
+	_, params, err := mime.ParseMediaType(result.Headers.Get("Content-Disposition"))
+	if err != nil {
+		return ""
+	}
+	name := filepath.Base(filepath.FromSlash(params["filename"]))
+	if name == "." || name == ".." || name == string(filepath.Separator) {
+		return ""
+	}
+	return name
+}
+
+// DownloadResponse writes a binary response to the working directory under
+// the name from its Content-Disposition header, or a generated one, without
+// overwriting an existing file. It returns the path written.
+func DownloadResponse(result *ExecutionResult) (string, error) {
+	name := attachmentName(result)
+	if name == "" {
+		name = expandSaveTemplate(defaultSaveName, result, time.Now()) + responseExtension(result)
+	}
+	path := uniquePath(name)
+	if err := os.WriteFile(path, result.Body, 0644); err != nil {
+		return "", fmt.Errorf("writing response: %w", err)
+	}
+	return path, nil
+}
+
+// uniquePath returns path, or path with " (n)" before its extension when
+// path already exists.
+func uniquePath(path string) string {
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+	for n := 1; fileExists(path); n++ {
+		path = fmt.Sprintf("%s (%d)%s", base, n, ext)
+	}
+	return path
+}
+
+// truncateBody shortens body to at most limit bytes (on a character
+// boundary) and returns a note saying how much was left out, or "" if
+// nothing was. A limit of 0 means no limit.
+func truncateBody(body string, limit int) (string, string) {
+	if limit <= 0 || len(body) <= limit {
+		return body, ""
+	}
+	cut := limit
+	for cut > 0 && !utf8.RuneStart(body[cut]) {
+		cut--
+	}
+	return body[:cut], fmt.Sprintf("\n... truncated, showing %s of %s (use --save or --max-body-print 0 for all of it)",
+		formatSize(int64(cut)), formatSize(int64(len(body))))
+}
+
+// formatSize formats n bytes for people, e.g. "512 B" or "4.2 MB".
+func formatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// progressReader draws a progress bar on out while a response body is read,
+// once more than progressThreshold bytes have arrived. total is the
+// Content-Length, or -1 when unknown.
+type progressReader struct {
+	r      io.Reader
+	out    io.Writer
+	total  int64
+	read   int64
+	drawn  time.Time
+	active bool
+}
+
+func newProgressReader(r io.Reader, total int64, out io.Writer) *progressReader {
+	return &progressReader{r: r, out: out, total: total}
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.read += int64(n)
+	if p.read >= progressThreshold && time.Since(p.drawn) >= 100*time.Millisecond {
+		p.draw()
+	}
+	return n, err
+}
+
+func (p *progressReader) draw() {
+	p.active = true
+	p.drawn = time.Now()
+	if p.total <= 0 {
+		fmt.Fprintf(p.out, "\rDownloading %s", formatSize(p.read))
+		return
+	}
+	const width = 30
+	percent := min(p.read*100/p.total, 100)
+	filled := int(percent * width / 100)
+	fmt.Fprintf(p.out, "\rDownloading [%s%s] %3d%% %s / %s",
+		strings.Repeat("#", filled), strings.Repeat("-", width-filled),
+		percent, formatSize(p.read), formatSize(p.total))
+}
+
+// finish draws the final state and ends the progress line, if one was
+// started.
+func (p *progressReader) finish() {
+	if p.active {
+		p.draw()
+		fmt.Fprintln(p.out)
+	}
+}
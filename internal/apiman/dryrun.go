@@ -0,0 +1,76 @@
+// dryrun.go
+package apiman
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// writeDryRun describes a prepared request without sending it: the final
+// URL, headers, cookies, variables, body and timeout. Values that came from
+// {{secret.NAME}} or external {{provider:reference}} references or secret
+// prompts are shown as the reference, not the secret.
+func writeDryRun(out io.Writer, prepared *PreparedRequest) error {
+	req := prepared.Request
+	body, err := readRequestBody(req)
+	if err != nil {
+		return err
+	}
+	vars := mergeVariables(prepared.Variables, prepared.HookVariables)
+	secret := func(name string) bool {
+		return strings.HasPrefix(name, "secret.") || isExternalSecret(name) || slices.ContainsFunc(prepared.Config.Prompts, func(p RequestPrompt) bool {
+			return p.Secret && p.Name == name
+		})
+	}
+	var pairs []string
+	for _, name := range sortedKeys(vars) {
+		if secret(name) && vars[name] != "" {
+			pairs = append(pairs, vars[name], "{{"+name+"}}")
+		}
+	}
+	hide := strings.NewReplacer(pairs...).Replace
+
+	fmt.Fprintln(out, "Dry run: the request was not sent")
+	fmt.Fprintf(out, "%s %s\n", req.Method, hide(req.URL.String()))
+	if grpc := prepared.Config.GRPC; grpc != nil {
+		fmt.Fprintf(out, "gRPC method: %s\n", grpc.FullMethod())
+	}
+	fmt.Fprintf(out, "Timeout: %s\n", prepared.timeout())
+
+	fmt.Fprintln(out, "\nHeaders:")
+	headers := req.Header.Clone()
+	headers.Del("Cookie")
+	for _, key := range sortedKeys(headers) {
+		for _, value := range headers[key] {
+			fmt.Fprintf(out, "  %s: %s\n", key, hide(value))
+		}
+	}
+	if cookies := req.Cookies(); len(cookies) > 0 {
+		fmt.Fprintln(out, "\nCookies:")
+		for _, cookie := range cookies {
+			fmt.Fprintf(out, "  %s=%s\n", cookie.Name, hide(cookie.Value))
+		}
+	}
+	if len(vars) > 0 {
+		fmt.Fprintln(out, "\nVariables:")
+		for _, name := range sortedKeys(vars) {
+			value := vars[name]
+			if secret(name) {
+				value = "(hidden)"
+			}
+			fmt.Fprintf(out, "  %s = %s\n", name, value)
+		}
+	}
+
+	switch {
+	case body == "":
+		fmt.Fprintln(out, "\nBody: (none)")
+	case prepared.BodyName != "":
+		fmt.Fprintf(out, "\nBody (%s):\n%s\n", prepared.BodyName, hide(formatResponseBody([]byte(body), req.Header.Get("Content-Type"))))
+	default:
+		fmt.Fprintf(out, "\nBody:\n%s\n", hide(formatResponseBody([]byte(body), req.Header.Get("Content-Type"))))
+	}
+	return nil
+}
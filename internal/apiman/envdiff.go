@@ -0,0 +1,164 @@
+// envdiff.go
+package apiman
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// defaultIgnoredHeaders differ between any two responses.
+var defaultIgnoredHeaders = []string{"Date"}
+
+// DiffOptions controls what DiffEnvironments treats as a difference.
+type DiffOptions struct {
+	// Ignore lists body fields to skip: member names anywhere ("updatedAt")
+	// or paths ("$.meta.requestId", "$.items[*].id").
+	Ignore []string
+	// IgnoreHeaders lists response headers to skip in addition to
+	// defaultIgnoredHeaders.
+	IgnoreHeaders []string
+	// XMLToJSON converts XML bodies to JSON so they are compared field by
+	// field like JSON bodies.
+	XMLToJSON bool
+}
+
+// EnvironmentDiff is the comparison of one request executed against two
+// environments.
+type EnvironmentDiff struct {
+	Request string
+	A, B    *ExecutionResult
+	Headers []headerDifference
+	// Body holds structural differences when both bodies are JSON.
+	Body       []jsonDifference
+	BodyIsJSON bool
+}
+
+type headerDifference struct {
+	Name   string
+	Before []string
+	After  []string
+}
+
+// Equal reports whether the responses matched once ignored fields were
+// skipped.
+func (d *EnvironmentDiff) Equal() bool {
+	if d.A.StatusCode != d.B.StatusCode || len(d.Headers) > 0 {
+		return false
+	}
+	if d.BodyIsJSON {
+		return len(d.Body) == 0
+	}
+	return string(d.A.Body) == string(d.B.Body)
+}
+
+// DiffEnvironments executes a request against envA and then envB and
+// compares the status, headers and body of the two responses.
+func (cm *ConfigManager) DiffEnvironments(requestPath, envA, envB string, opts DiffOptions) (*EnvironmentDiff, error) {
+	a, err := cm.RunRequest(requestPath, envA, RequestOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("executing against %s: %w", envA, err)
+	}
+	b, err := cm.RunRequest(requestPath, envB, RequestOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("executing against %s: %w", envB, err)
+	}
+
+	return compareResults(requestPath, a, b, opts), nil
+}
+
+// compareResults compares the status, headers and body of two responses to
+// the same request.
+func compareResults(requestPath string, a, b *ExecutionResult, opts DiffOptions) *EnvironmentDiff {
+	diff := &EnvironmentDiff{Request: requestPath, A: a, B: b}
+	ignoredHeaders := append(slices.Clone(defaultIgnoredHeaders), opts.IgnoreHeaders...)
+	diff.Headers = diffHeaders(a.Headers, b.Headers, ignoredHeaders)
+
+	bodyA, bodyB := a.Body, b.Body
+	if opts.XMLToJSON {
+		if converted, err := xmlToJSON(bodyA); err == nil {
+			bodyA = converted
+		}
+		if converted, err := xmlToJSON(bodyB); err == nil {
+			bodyB = converted
+		}
+	}
+	var docA, docB interface{}
+	if json.Unmarshal(bodyA, &docA) == nil && json.Unmarshal(bodyB, &docB) == nil {
+		diff.BodyIsJSON = true
+		diff.Body = diffJSON(docA, docB, diffIgnore(opts.Ignore))
+	}
+	return diff
+}
+
+func diffHeaders(a, b http.Header, ignore []string) []headerDifference {
+	var diffs []headerDifference
+	names := sortedKeys(a)
+	for _, name := range sortedKeys(b) {
+		if _, ok := a[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	for _, name := range names {
+		if slices.ContainsFunc(ignore, func(h string) bool { return strings.EqualFold(h, name) }) {
+			continue
+		}
+		if !slices.Equal(a[name], b[name]) {
+			diffs = append(diffs, headerDifference{Name: name, Before: a[name], After: b[name]})
+		}
+	}
+	return diffs
+}
+
+// PrintEnvironmentDiff writes d to out: "-" lines come from the first
+// environment, "+" lines from the second and "~" marks a changed value.
+func PrintEnvironmentDiff(out io.Writer, d *EnvironmentDiff) {
+	envA, envB := d.A.Environment, d.B.Environment
+	fmt.Fprintf(out, "--- %s (%s, %dms)\n", envA, d.A.Status, d.A.DurationMS())
+	fmt.Fprintf(out, "+++ %s (%s, %dms)\n", envB, d.B.Status, d.B.DurationMS())
+
+	if d.A.StatusCode != d.B.StatusCode {
+		fmt.Fprintf(out, "\nStatus:\n  ~ %s → %s\n", d.A.Status, d.B.Status)
+	}
+
+	if len(d.Headers) > 0 {
+		fmt.Fprintln(out, "\nHeaders:")
+		for _, h := range d.Headers {
+			switch {
+			case h.Before == nil:
+				fmt.Fprintf(out, "  + %s: %s\n", h.Name, strings.Join(h.After, ", "))
+			case h.After == nil:
+				fmt.Fprintf(out, "  - %s: %s\n", h.Name, strings.Join(h.Before, ", "))
+			default:
+				fmt.Fprintf(out, "  ~ %s: %s → %s\n", h.Name, strings.Join(h.Before, ", "), strings.Join(h.After, ", "))
+			}
+		}
+	}
+
+	switch {
+	case d.BodyIsJSON && len(d.Body) > 0:
+		fmt.Fprintln(out, "\nBody:")
+		for _, diff := range d.Body {
+			switch {
+			case !diff.HasBefore:
+				fmt.Fprintf(out, "  + %s: %s\n", diff.Path, compactJSON(diff.After))
+			case !diff.HasAfter:
+				fmt.Fprintf(out, "  - %s: %s\n", diff.Path, compactJSON(diff.Before))
+			default:
+				fmt.Fprintf(out, "  ~ %s: %s → %s\n", diff.Path, compactJSON(diff.Before), compactJSON(diff.After))
+			}
+		}
+	case !d.BodyIsJSON:
+		var body strings.Builder
+		if writeLineDiff(&body, formatResponseBody(d.A.Body, d.A.Headers.Get("Content-Type")), formatResponseBody(d.B.Body, d.B.Headers.Get("Content-Type"))) {
+			fmt.Fprintf(out, "\nBody:\n%s", body.String())
+		}
+	}
+
+	if d.Equal() {
+		fmt.Fprintln(out, "\n✓ Responses match")
+	}
+}
@@ -0,0 +1,381 @@
+// execution.go
+package apiman
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"time"
+)
+
+// PreparedRequest is a stored request resolved against an environment and
+// ready to send.
+type PreparedRequest struct {
+	Path        string
+	Environment string
+	Request     *http.Request
+	Config      *RequestConfig
+	// Variables are the values placeholders were resolved with.
+	Variables map[string]string
+	// HookVariables are the variables set by the pre-request hook.
+	HookVariables map[string]string
+	// BodyName is the body file the body was read from, or "" for the
+	// request's own body.
+	BodyName string
+	// Timeout overrides the stored timeout when non-zero.
+	Timeout time.Duration
+	// Transport applies the environment's proxy and TLS settings; nil means
+	// http.DefaultTransport.
+	Transport http.RoundTripper
+	// Trace is the request's span when the environment's Tracing, which
+	// says where to report it, is set.
+	Trace   *TraceContext
+	Tracing *TracingConfig
+	// RequestID is the correlation ID sent with the request, if any.
+	RequestID string
+}
+
+// defaultRequestIDHeader carries a correlation ID given with
+// RequestOptions.RequestID when the environment names no header.
+const defaultRequestIDHeader = "X-Request-ID"
+
+// timeout returns how long the request may take, defaulting to 30 seconds.
+func (p *PreparedRequest) timeout() time.Duration {
+	if p.Timeout > 0 {
+		return p.Timeout
+	}
+	if p.Config.Timeout > 0 {
+		return time.Duration(p.Config.Timeout) * time.Second
+	}
+	return 30 * time.Second
+}
+
+// Client returns an HTTP client honouring the request's timeout and proxy.
+func (p *PreparedRequest) Client() *http.Client {
+	return &http.Client{
+		Transport: p.Transport,
+		Timeout:   p.timeout(),
+	}
+}
+
+// retryStatuses are the statuses a RetryPolicy without statuses retries.
+var retryStatuses = []int{http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout}
+
+// RetryPolicy resends a request that got no response or a retryable status.
+type RetryPolicy struct {
+	// Attempts is how many times the request is sent at most, the first
+	// time included.
+	Attempts int `json:"attempts"`
+	// DelayMS is the wait before the first retry, doubled before each
+	// further one. It defaults to 500ms.
+	DelayMS int `json:"delayMs,omitempty"`
+	// Statuses are the status codes retried, by default retryStatuses.
+	Statuses []int `json:"statuses,omitempty"`
+	// Unsafe retries methods that aren't idempotent, such as POST and
+	// PATCH, which may have taken effect even though no response arrived.
+	Unsafe bool `json:"unsafe,omitempty"`
+}
+
+// validate reports settings that can't be used.
+func (r *RetryPolicy) validate() error {
+	if r.Attempts < 1 {
+		return errors.New("retry attempts must be at least 1")
+	}
+	if r.DelayMS < 0 {
+		return errors.New("retry delayMs is negative")
+	}
+	return nil
+}
+
+// idempotentMethods are the methods a RetryPolicy retries unless Unsafe is
+// set.
+var idempotentMethods = []string{http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete, http.MethodOptions, http.MethodTrace}
+
+// retries reports whether a method request whose response had status (0
+// for none) is retried.
+func (r *RetryPolicy) retries(method string, status int) bool {
+	if !r.Unsafe && !slices.Contains(idempotentMethods, method) {
+		return false
+	}
+	if status == 0 {
+		return true
+	}
+	if len(r.Statuses) == 0 {
+		return slices.Contains(retryStatuses, status)
+	}
+	return slices.Contains(r.Statuses, status)
+}
+
+// delay is the wait before retry number n, starting at 1.
+func (r *RetryPolicy) delay(n int) time.Duration {
+	delay := 500 * time.Millisecond
+	if r.DelayMS > 0 {
+		delay = time.Duration(r.DelayMS) * time.Millisecond
+	}
+	return delay << (n - 1)
+}
+
+// send sends the request, and again as its retry policy allows, returning
+// the last response and when its attempt started. Retries are reported on
+// stderr.
+func (p *PreparedRequest) send(ctx context.Context) (*http.Response, time.Time, error) {
+	client := p.Client()
+	policy := p.Config.Retry
+	for attempt := 1; ; attempt++ {
+		req := p.Request.WithContext(ctx)
+		if attempt > 1 && p.Request.GetBody != nil {
+			body, err := p.Request.GetBody()
+			if err != nil {
+				return nil, time.Time{}, fmt.Errorf("reading request body: %w", err)
+			}
+			req.Body = body
+		}
+		startedAt := time.Now()
+		resp, err := client.Do(req)
+		status := 0
+		if err == nil {
+			status = resp.StatusCode
+		}
+		if policy == nil || attempt >= policy.Attempts || ctx.Err() != nil || !policy.retries(p.Request.Method, status) {
+			return resp, startedAt, err
+		}
+
+		reason := fmt.Sprint(err)
+		if err == nil {
+			reason = resp.Status
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		delay := policy.delay(attempt)
+		fmt.Fprintf(os.Stderr, "⚠️  %s (attempt %d of %d), retrying in %s\n", reason, attempt, policy.Attempts, delay)
+		select {
+		case <-ctx.Done():
+			return nil, startedAt, ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// ExecutionResult is a fully-read response from executing a workspace
+// request, suitable for assertions, reports and persistence.
+type ExecutionResult struct {
+	Request     string        `json:"request"`
+	Environment string        `json:"environment"`
+	Method      string        `json:"method"`
+	URL         string        `json:"url"`
+	Status      string        `json:"status"`
+	StatusCode  int           `json:"statusCode"`
+	Headers     http.Header   `json:"headers"`
+	Body        []byte        `json:"-"`
+	Duration    time.Duration `json:"-"`
+	StartedAt   time.Time     `json:"startedAt"`
+	// Variables holds values exported by the request's hooks and its
+	// extract rules, which chains pass on to later steps.
+	Variables map[string]string `json:"variables,omitempty"`
+	// Extracted holds the values the request's extract and capture rules
+	// stored, and ExtractError why extraction stopped early, if it did.
+	Extracted    map[string]string `json:"extracted,omitempty"`
+	ExtractError string            `json:"extractError,omitempty"`
+	// Jar names the cookies capture rules set in the environment's cookie
+	// jar.
+	Jar []string `json:"jar,omitempty"`
+	// BudgetMS is the request's latency budget, or 0 when it has none.
+	BudgetMS int64 `json:"budgetMs,omitempty"`
+	// TraceID is the OpenTelemetry trace the request was sent in, when
+	// the environment has tracing on.
+	TraceID string `json:"traceId,omitempty"`
+	// RequestID is the correlation ID the request was sent with, if any.
+	RequestID string `json:"requestId,omitempty"`
+	// RequestHeaders and RequestBody are what was sent, for test reports.
+	RequestHeaders http.Header `json:"-"`
+	RequestBody    string      `json:"-"`
+	// ResolvedVariables are the values the request's placeholders were
+	// resolved with, for script assertions and extract rules.
+	ResolvedVariables map[string]string `json:"-"`
+	// ContentEncoding and EncodedSize describe a compressed response that
+	// was decoded into Body: its Content-Encoding and the bytes received.
+	ContentEncoding string `json:"contentEncoding,omitempty"`
+	EncodedSize     int    `json:"encodedSize,omitempty"`
+	// Cached is set when the server answered 304 Not Modified and Headers
+	// and Body are those of the cached response.
+	Cached bool `json:"cached,omitempty"`
+}
+
+// DurationMS reports the round-trip time in whole milliseconds.
+func (r *ExecutionResult) DurationMS() int64 {
+	return r.Duration.Milliseconds()
+}
+
+// OverBudget reports whether the response took longer than the request's
+// latency budget.
+func (r *ExecutionResult) OverBudget() bool {
+	return r.BudgetMS > 0 && r.DurationMS() > r.BudgetMS
+}
+
+// budgetNote describes a budget overrun, e.g. "512ms, over the 300ms
+// budget".
+func (r *ExecutionResult) budgetNote() string {
+	return fmt.Sprintf("%dms, over the %dms budget", r.DurationMS(), r.BudgetMS)
+}
+
+// CancelledError reports a request aborted through its context before the
+// response was read. It unwraps to context.Canceled.
+type CancelledError struct {
+	Elapsed time.Duration
+}
+
+func (e *CancelledError) Error() string {
+	return fmt.Sprintf("request cancelled after %s", e.Elapsed.Round(time.Millisecond))
+}
+
+func (e *CancelledError) Unwrap() error {
+	return context.Canceled
+}
+
+// cancelled turns err into a *CancelledError when ctx was cancelled.
+func cancelled(ctx context.Context, err error, startedAt time.Time) error {
+	if errors.Is(ctx.Err(), context.Canceled) {
+		return &CancelledError{Elapsed: time.Since(startedAt)}
+	}
+	return err
+}
+
+// RunRequest executes a request like ExecuteRequest but reads the whole
+// response body and records timing, so callers don't have to manage the
+// response lifecycle themselves. The post-response hook runs once the body
+// has been read, and every completed execution is added to the workspace
+// history. gRPC requests are dispatched to runGRPC and WebSocket requests to
+// runWebSocket.
+func (cm *ConfigManager) RunRequest(requestPath, envName string, opts RequestOptions) (*ExecutionResult, error) {
+	return cm.RunRequestContext(context.Background(), requestPath, envName, opts)
+}
+
+// RunRequestContext is RunRequest with a context: cancelling ctx aborts the
+// request at once, whether it is connecting, waiting for the response or
+// reading the body, and returns a *CancelledError.
+func (cm *ConfigManager) RunRequestContext(ctx context.Context, requestPath, envName string, opts RequestOptions) (*ExecutionResult, error) {
+	prepared, err := cm.PrepareRequest(requestPath, envName, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := cm.confirmPrepared(prepared, opts.Confirmed); err != nil {
+		return nil, err
+	}
+	if prepared.Config.GRPC != nil {
+		return cm.runGRPC(ctx, prepared)
+	}
+	if prepared.Config.WebSocket != nil {
+		return cm.runWebSocket(ctx, prepared, nil)
+	}
+	caching := usesCache(prepared, opts)
+	var cached *CachedResponse
+	if caching {
+		cached = cm.revalidate(prepared)
+	}
+	resp, startedAt, err := prepared.send(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			cm.recordFailedMetric(prepared, envName, startedAt, err)
+			exportSpan(prepared, nil, err, startedAt)
+		}
+		if prepared.RequestID != "" {
+			err = fmt.Errorf("%w (request ID %s)", err, prepared.RequestID)
+		}
+		if prepared.Trace != nil {
+			err = fmt.Errorf("%w (trace ID %s)", err, prepared.Trace.TraceID)
+		}
+		return nil, cancelled(ctx, err, startedAt)
+	}
+	defer resp.Body.Close()
+
+	var reader io.Reader = resp.Body
+	if opts.Progress != nil {
+		progress := newProgressReader(resp.Body, resp.ContentLength, opts.Progress)
+		defer progress.finish()
+		reader = progress
+	}
+	body, err := io.ReadAll(reader)
+	duration := time.Since(startedAt)
+	if err != nil {
+		return nil, cancelled(ctx, fmt.Errorf("reading response body: %w", err), startedAt)
+	}
+
+	result := &ExecutionResult{
+		Request:     requestPath,
+		Environment: envName,
+		Method:      resp.Request.Method,
+		URL:         resp.Request.URL.String(),
+		Status:      resp.Status,
+		StatusCode:  resp.StatusCode,
+		Headers:     resp.Header,
+		Body:        body,
+		Duration:    duration,
+		StartedAt:   startedAt,
+	}
+	if caching {
+		cm.applyCache(prepared, cached, result)
+	}
+	if err := decodeResponse(result); err != nil {
+		return nil, err
+	}
+	return cm.finishExecution(prepared, result, resp.Request.Header)
+}
+
+// finishExecution records a completed execution in the history, runs the
+// post-response hook and applies the request's extract rules, collecting
+// the variables the hooks exported and storing the extracted ones.
+func (cm *ConfigManager) finishExecution(prepared *PreparedRequest, result *ExecutionResult, requestHeaders http.Header) (*ExecutionResult, error) {
+	result.RequestHeaders = requestHeaders
+	result.RequestBody, _ = readRequestBody(prepared.Request)
+	result.ResolvedVariables = prepared.Variables
+	result.BudgetMS = int64(prepared.Config.LatencyBudgetMS)
+	if prepared.Trace != nil {
+		result.TraceID = prepared.Trace.TraceID
+	}
+	result.RequestID = prepared.RequestID
+	cm.recordExecution(result, requestHeaders)
+	exportSpan(prepared, result, nil, result.StartedAt)
+
+	postVars, err := cm.runPostResponseHook(prepared, result)
+	if err != nil {
+		return nil, err
+	}
+	if len(prepared.Config.Extract) > 0 {
+		extracted, err := extractVariables(result, prepared.Config.Extract)
+		if err != nil {
+			result.ExtractError = err.Error()
+		}
+		if len(extracted) > 0 {
+			if err := cm.StoreVariables(prepared.Environment, extracted); err != nil {
+				return nil, err
+			}
+			result.Extracted = extracted
+		}
+	}
+	if len(prepared.Config.Capture) > 0 {
+		captured, jar, err := captureValues(result, prepared.Config.Capture)
+		if err != nil && result.ExtractError == "" {
+			result.ExtractError = err.Error()
+		}
+		if len(captured) > 0 {
+			if err := cm.StoreVariables(prepared.Environment, captured); err != nil {
+				return nil, err
+			}
+			result.Extracted = mergeVariables(result.Extracted, captured)
+		}
+		if len(jar) > 0 {
+			if err := cm.storeJarCookies(prepared.Environment, jar); err != nil {
+				return nil, err
+			}
+			result.Jar = sortedKeys(jar)
+		}
+	}
+	if vars := mergeVariables(prepared.HookVariables, postVars, result.Extracted); len(vars) > 0 {
+		result.Variables = vars
+	}
+	return result, nil
+}
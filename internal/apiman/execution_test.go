@@ -0,0 +1,50 @@
+package apiman
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestRetryPolicyOnlyRetriesIdempotentMethods(t *testing.T) {
+	var hits atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	cm, err := InitWorkspace(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cm.SaveEnvironment("dev", Environment{BaseURL: server.URL}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		method string
+		unsafe bool
+		sent   int32
+	}{
+		{"GET", false, 3},
+		{"PUT", false, 3},
+		{"POST", false, 1},
+		{"PATCH", false, 1},
+		{"POST", true, 3},
+	}
+	for _, tt := range tests {
+		retry := &RetryPolicy{Attempts: 3, DelayMS: 1, Unsafe: tt.unsafe}
+		if err := cm.SaveRequest("flaky", RequestConfig{Method: tt.method, URL: "/", Retry: retry}); err != nil {
+			t.Fatal(err)
+		}
+		hits.Store(0)
+		if _, err := cm.RunRequest("flaky", "dev", RequestOptions{Confirmed: true}); err != nil {
+			t.Fatal(err)
+		}
+		if got := hits.Load(); got != tt.sent {
+			t.Errorf("%s with unsafe %v sent %d times, want %d", tt.method, tt.unsafe, got, tt.sent)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+// extends.go
+package apiman
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+)
+
+// resolveExtends merges env over the environment it extends, if any. chain
+// lists the environments already visited.
+func (cm *ConfigManager) resolveExtends(env *Environment, chain []string) (*Environment, error) {
+	if env.Extends == "" {
+		return env, nil
+	}
+	base, err := cm.loadEnvironment(env.Extends, chain)
+	if err != nil {
+		return nil, fmt.Errorf("loading extended environment %s: %w", env.Extends, err)
+	}
+	merged := mergeEnvironments(base, env)
+	return &merged, nil
+}
+
+// mergeEnvironments layers env over base. Headers, cookies, auth, variables
+// and params are merged key by key with env's values winning; other
+// settings are taken from env when set there. insecureSkipVerify can be
+// turned on but not off by env.
+func mergeEnvironments(base, env *Environment) Environment {
+	merged := *env
+	merged.Headers = mergeVariables(base.Headers, env.Headers)
+	merged.Cookies = mergeVariables(base.Cookies, env.Cookies)
+	merged.Auth = mergeVariables(base.Auth, env.Auth)
+	merged.Variables = mergeVariables(base.Variables, env.Variables)
+	if base.Params != nil || env.Params != nil {
+		merged.Params = make(map[string]interface{})
+		maps.Copy(merged.Params, base.Params)
+		maps.Copy(merged.Params, env.Params)
+	}
+
+	merged.BaseURL = cmp.Or(env.BaseURL, base.BaseURL)
+	merged.HTTPProxy = cmp.Or(env.HTTPProxy, base.HTTPProxy)
+	merged.HTTPSProxy = cmp.Or(env.HTTPSProxy, base.HTTPSProxy)
+	merged.NoProxy = cmp.Or(env.NoProxy, base.NoProxy)
+	merged.CACertFile = cmp.Or(env.CACertFile, base.CACertFile)
+	merged.ClientCertFile = cmp.Or(env.ClientCertFile, base.ClientCertFile)
+	merged.ClientKeyFile = cmp.Or(env.ClientKeyFile, base.ClientKeyFile)
+	merged.MinVersion = cmp.Or(env.MinVersion, base.MinVersion)
+	merged.EnvFile = cmp.Or(env.EnvFile, base.EnvFile)
+	merged.ConnectTo = cmp.Or(env.ConnectTo, base.ConnectTo)
+	merged.RequestIDHeader = cmp.Or(env.RequestIDHeader, base.RequestIDHeader)
+	merged.InsecureSkipVerify = base.InsecureSkipVerify || env.InsecureSkipVerify
+	if merged.Tracing == nil {
+		merged.Tracing = base.Tracing
+	}
+	if merged.Confirm == nil {
+		merged.Confirm = base.Confirm
+	}
+	return merged
+}
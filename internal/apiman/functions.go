@@ -0,0 +1,197 @@
+// functions.go
+package apiman
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// templateFunctions are the dynamic values placeholders can call, evaluated
+// each time a request is prepared:
+//
+//	{{uuid}}                  random UUID
+//	{{now}}                   current time, RFC 3339
+//	{{now "2006-01-02"}}      current time in a Go layout
+//	{{timestamp}}             current Unix time in seconds
+//	{{randomInt 1 100}}       random integer between 1 and 100 inclusive
+//	{{randomString 12}}       random letters and digits (default 16)
+//	{{randomBool}}            true or false
+//	{{randomFirstName}}       a first name
+//	{{randomLastName}}        a last name
+//	{{randomName}}            a first and last name
+//	{{randomEmail}}           a unique address at example.com
+//	{{base64 "user:pass"}}    base64 encoding of its argument
+//
+// A variable with the same name as a function wins over it.
+var templateFunctions = map[string]func(args []string) (string, error){
+	"uuid": func(args []string) (string, error) {
+		return newUUID(), checkArgCount(args, 0)
+	},
+	"now": func(args []string) (string, error) {
+		if len(args) == 0 {
+			return time.Now().Format(time.RFC3339), nil
+		}
+		return time.Now().Format(args[0]), checkArgCount(args, 1)
+	},
+	"timestamp": func(args []string) (string, error) {
+		return strconv.FormatInt(time.Now().Unix(), 10), checkArgCount(args, 0)
+	},
+	"randomInt": func(args []string) (string, error) {
+		low, high := int64(0), int64(1000)
+		if len(args) > 0 {
+			if len(args) != 2 {
+				return "", fmt.Errorf("randomInt takes a minimum and a maximum")
+			}
+			var err error
+			if low, err = strconv.ParseInt(args[0], 10, 64); err != nil {
+				return "", fmt.Errorf("randomInt minimum: %w", err)
+			}
+			if high, err = strconv.ParseInt(args[1], 10, 64); err != nil {
+				return "", fmt.Errorf("randomInt maximum: %w", err)
+			}
+		}
+		if high < low {
+			return "", fmt.Errorf("randomInt maximum is less than its minimum")
+		}
+		n, err := randomIntBetween(low, high)
+		if err != nil {
+			return "", fmt.Errorf("randomInt: %w", err)
+		}
+		return strconv.FormatInt(n, 10), nil
+	},
+	"randomString": func(args []string) (string, error) {
+		n := 16
+		if len(args) > 0 {
+			var err error
+			if n, err = strconv.Atoi(args[0]); err != nil || n < 0 {
+				return "", fmt.Errorf("randomString length must be a non-negative integer")
+			}
+		}
+		return randomString(n), checkArgCount(args, 1)
+	},
+	"randomBool": func(args []string) (string, error) {
+		return strconv.FormatBool(randomInt64(2) == 1), checkArgCount(args, 0)
+	},
+	"randomFirstName": func(args []string) (string, error) {
+		return randomChoice(fakeFirstNames), checkArgCount(args, 0)
+	},
+	"randomLastName": func(args []string) (string, error) {
+		return randomChoice(fakeLastNames), checkArgCount(args, 0)
+	},
+	"randomName": func(args []string) (string, error) {
+		return randomChoice(fakeFirstNames) + " " + randomChoice(fakeLastNames), checkArgCount(args, 0)
+	},
+	"randomEmail": func(args []string) (string, error) {
+		local := strings.ToLower(randomChoice(fakeFirstNames)) + "." + strings.ToLower(randomString(8))
+		return local + "@example.com", checkArgCount(args, 0)
+	},
+	"base64": func(args []string) (string, error) {
+		if len(args) != 1 {
+			return "", fmt.Errorf("base64 takes one argument")
+		}
+		return base64.StdEncoding.EncodeToString([]byte(args[0])), nil
+	},
+}
+
+var (
+	fakeFirstNames = []string{"Alice", "Bob", "Carol", "Dave", "Erin", "Frank", "Grace", "Heidi", "Ivan", "Judy", "Mallory", "Niaj", "Olivia", "Peggy", "Rupert", "Sybil", "Trent", "Victor", "Walter", "Yusuf"}
+	fakeLastNames  = []string{"Anderson", "Brown", "Chen", "Davis", "Evans", "Garcia", "Hughes", "Ibrahim", "Johnson", "Kim", "Lopez", "Martin", "Nguyen", "Okafor", "Patel", "Rossi", "Smith", "Tanaka", "Walker", "Zhang"}
+)
+
+// functionPattern matches a call of one of templateFunctions: its name and
+// arguments, which are separated by spaces and may be double-quoted.
+var functionPattern = func() *regexp.Regexp {
+	names := make([]string, 0, len(templateFunctions))
+	for name := range templateFunctions {
+		names = append(names, regexp.QuoteMeta(name))
+	}
+	slices.Sort(names)
+	return regexp.MustCompile(`\{\{\s*(` + strings.Join(names, "|") + `)((?:\s+(?:"(?:[^"\\]|\\.)*"|[^\s{}"]+))*)\s*\}\}`)
+}()
+
+var functionArgPattern = regexp.MustCompile(`"(?:[^"\\]|\\.)*"|[^\s"]+`)
+
+// expandFunctions replaces every template function call in s with its
+// result. Calls with invalid arguments are left untouched so they stay
+// visible.
+func expandFunctions(s string) string {
+	if !strings.Contains(s, "{{") {
+		return s
+	}
+	return functionPattern.ReplaceAllStringFunc(s, func(match string) string {
+		parts := functionPattern.FindStringSubmatch(match)
+		var args []string
+		for _, arg := range functionArgPattern.FindAllString(parts[2], -1) {
+			if strings.HasPrefix(arg, `"`) {
+				unquoted, err := strconv.Unquote(arg)
+				if err != nil {
+					return match
+				}
+				arg = unquoted
+			}
+			args = append(args, arg)
+		}
+		value, err := templateFunctions[parts[1]](args)
+		if err != nil {
+			return match
+		}
+		return value
+	})
+}
+
+func checkArgCount(args []string, max int) error {
+	if len(args) > max {
+		return fmt.Errorf("too many arguments")
+	}
+	return nil
+}
+
+// randomInt64 returns a uniformly random integer in [0, n).
+func randomInt64(n int64) int64 {
+	v, err := rand.Int(rand.Reader, big.NewInt(n))
+	if err != nil {
+		panic(err)
+	}
+	return v.Int64()
+}
+
+// randomIntBetween returns a uniformly random integer in [low, high], which
+// may span all of int64.
+func randomIntBetween(low, high int64) (int64, error) {
+	span := new(big.Int).Sub(big.NewInt(high), big.NewInt(low))
+	span.Add(span, big.NewInt(1))
+	v, err := rand.Int(rand.Reader, span)
+	if err != nil {
+		return 0, err
+	}
+	return v.Add(v, big.NewInt(low)).Int64(), nil
+}
+
+func randomChoice(options []string) string {
+	return options[randomInt64(int64(len(options)))]
+}
+
+func randomString(n int) string {
+	const alphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = alphabet[randomInt64(int64(len(alphabet)))]
+	}
+	return string(b)
+}
+
+// newUUID returns a random (version 4) UUID.
+func newUUID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
@@ -0,0 +1,38 @@
+package apiman
+
+import (
+	"math"
+	"strconv"
+	"testing"
+)
+
+func TestRandomIntBounds(t *testing.T) {
+	randomInt := templateFunctions["randomInt"]
+	tests := []struct {
+		low, high int64
+	}{
+		{1, 100},
+		{7, 7},
+		{-5, 5},
+		{math.MinInt64, math.MaxInt64},
+		{math.MaxInt64 - 1, math.MaxInt64},
+	}
+	for _, tt := range tests {
+		for range 20 {
+			value, err := randomInt([]string{strconv.FormatInt(tt.low, 10), strconv.FormatInt(tt.high, 10)})
+			if err != nil {
+				t.Fatalf("randomInt %d %d: %v", tt.low, tt.high, err)
+			}
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || n < tt.low || n > tt.high {
+				t.Fatalf("randomInt %d %d gave %s", tt.low, tt.high, value)
+			}
+		}
+	}
+
+	for _, args := range [][]string{{"10", "1"}, {"1"}, {"a", "2"}, {"1", "99999999999999999999"}} {
+		if value, err := randomInt(args); err == nil {
+			t.Errorf("randomInt %v gave %s, want an error", args, value)
+		}
+	}
+}
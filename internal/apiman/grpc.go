@@ -0,0 +1,459 @@
+// grpc.go
+package apiman
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	// Well-known types, for servers whose reflection omits them.
+	_ "google.golang.org/protobuf/types/known/anypb"
+	_ "google.golang.org/protobuf/types/known/durationpb"
+	_ "google.golang.org/protobuf/types/known/emptypb"
+	_ "google.golang.org/protobuf/types/known/fieldmaskpb"
+	_ "google.golang.org/protobuf/types/known/structpb"
+	_ "google.golang.org/protobuf/types/known/timestamppb"
+	_ "google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// GRPCConfig turns a request into a unary gRPC call. The target is the
+// request URL resolved against the environment's baseURL, e.g.
+// "grpc://localhost:50051" (plaintext) or "grpcs://api.internal:443" (TLS).
+// The body is the request message as JSON and headers are sent as metadata.
+// Message types come from server reflection unless protoset files
+// (protoc --include_imports --descriptor_set_out) are listed.
+type GRPCConfig struct {
+	Service  string   `json:"service"`
+	Method   string   `json:"method"`
+	ProtoSet []string `json:"protoset,omitempty"`
+}
+
+// FullMethod returns the method in "/package.Service/Method" form.
+func (g *GRPCConfig) FullMethod() string {
+	return "/" + g.Service + "/" + g.Method
+}
+
+// errGRPCRequest reports that a gRPC request was used where only HTTP
+// requests are supported.
+func errGRPCRequest(requestPath string) error {
+	return fmt.Errorf("%s is a gRPC request; run it with api-man run", requestPath)
+}
+
+// grpcTarget splits a resolved request URL into a dial address and whether
+// to use TLS. grpcs:// and https:// use TLS; grpc://, http:// and bare
+// host:port targets are plaintext.
+func grpcTarget(rawURL string) (string, bool) {
+	scheme, rest, found := strings.Cut(rawURL, "://")
+	if !found {
+		return strings.TrimSuffix(rawURL, "/"), false
+	}
+	host, _, _ := strings.Cut(rest, "/")
+	return host, scheme == "grpcs" || scheme == "https"
+}
+
+// dialGRPC connects to target, using tlsConfig (which may be nil) for
+// grpcs:// and https:// targets.
+func dialGRPC(target string, tlsConfig *tls.Config) (*grpc.ClientConn, error) {
+	address, useTLS := grpcTarget(target)
+	if address == "" {
+		return nil, fmt.Errorf("no gRPC target: set the environment's baseURL or the request url")
+	}
+	creds := insecure.NewCredentials()
+	if useTLS {
+		if tlsConfig == nil {
+			tlsConfig = &tls.Config{}
+		}
+		creds = credentials.NewTLS(tlsConfig)
+	}
+	conn, err := grpc.NewClient(address, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, fmt.Errorf("connecting to %s: %w", address, err)
+	}
+	return conn, nil
+}
+
+// runGRPC sends a prepared gRPC request. Variables, secrets, auth and the
+// pre-request hook have already been applied to prepared.Request, whose
+// headers become metadata. A non-OK gRPC status is reported through the
+// result's Status and StatusCode (the numeric gRPC code), not as an error.
+func (cm *ConfigManager) runGRPC(ctx context.Context, prepared *PreparedRequest) (*ExecutionResult, error) {
+	g := prepared.Config.GRPC
+	if g.Service == "" || g.Method == "" {
+		return nil, fmt.Errorf("grpc.service and grpc.method are required")
+	}
+	body, err := readRequestBody(prepared.Request)
+	if err != nil {
+		return nil, err
+	}
+	target := prepared.Request.URL.String()
+
+	var tlsConfig *tls.Config
+	if transport, ok := unwrapTransport(prepared.Transport); ok {
+		tlsConfig = transport.TLSClientConfig
+	}
+	conn, err := dialGRPC(target, tlsConfig)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	parent := ctx
+	ctx, cancel := context.WithTimeout(ctx, prepared.timeout())
+	defer cancel()
+
+	var files *protoregistry.Files
+	if len(g.ProtoSet) > 0 {
+		files, err = loadProtoSets(cm.requestDir(prepared.Path), g.ProtoSet)
+	} else {
+		files, err = reflectFiles(ctx, conn, g.Service)
+	}
+	if err != nil {
+		return nil, err
+	}
+	method, err := findGRPCMethod(files, g.Service, g.Method)
+	if err != nil {
+		return nil, err
+	}
+	if method.IsStreamingClient() || method.IsStreamingServer() {
+		return nil, fmt.Errorf("%s is a streaming method; only unary calls are supported", g.FullMethod())
+	}
+
+	types := dynamicpb.NewTypes(files)
+	reqMsg := dynamicpb.NewMessage(method.Input())
+	if strings.TrimSpace(body) != "" {
+		if err := (protojson.UnmarshalOptions{Resolver: types}).Unmarshal([]byte(body), reqMsg); err != nil {
+			return nil, fmt.Errorf("encoding %s from body: %w", method.Input().FullName(), err)
+		}
+	}
+	respMsg := dynamicpb.NewMessage(method.Output())
+
+	md := metadata.MD{}
+	for key, values := range prepared.Request.Header {
+		if key == "Content-Type" || key == "Content-Length" {
+			continue
+		}
+		md.Append(key, values...)
+	}
+	ctx = metadata.NewOutgoingContext(ctx, md)
+
+	var header, trailer metadata.MD
+	startedAt := time.Now()
+	callErr := conn.Invoke(ctx, g.FullMethod(), reqMsg, respMsg, grpc.Header(&header), grpc.Trailer(&trailer))
+	duration := time.Since(startedAt)
+	if errors.Is(parent.Err(), context.Canceled) {
+		return nil, &CancelledError{Elapsed: duration}
+	}
+
+	st := status.Convert(callErr)
+	var respBody []byte
+	if callErr == nil {
+		respBody, err = protojson.MarshalOptions{Resolver: types, EmitUnpopulated: true}.Marshal(respMsg)
+		if err != nil {
+			return nil, fmt.Errorf("decoding response: %w", err)
+		}
+	} else {
+		respBody, _ = json.Marshal(map[string]string{"code": st.Code().String(), "message": st.Message()})
+	}
+
+	result := &ExecutionResult{
+		Request:     prepared.Path,
+		Environment: prepared.Environment,
+		Method:      "GRPC",
+		URL:         strings.TrimSuffix(target, "/") + g.FullMethod(),
+		Status:      st.Code().String(),
+		StatusCode:  int(st.Code()),
+		Headers:     metadataHeaders(header, trailer),
+		Body:        respBody,
+		Duration:    duration,
+		StartedAt:   startedAt,
+	}
+	return cm.finishExecution(prepared, result, http.Header(md))
+}
+
+// metadataHeaders merges response headers and trailers into an http.Header
+// so results print and persist like HTTP responses.
+func metadataHeaders(mds ...metadata.MD) http.Header {
+	h := http.Header{}
+	for _, md := range mds {
+		for key, values := range md {
+			for _, value := range values {
+				h.Add(key, value)
+			}
+		}
+	}
+	return h
+}
+
+func findGRPCMethod(files *protoregistry.Files, service, method string) (protoreflect.MethodDescriptor, error) {
+	desc, err := files.FindDescriptorByName(protoreflect.FullName(service))
+	if err != nil {
+		return nil, fmt.Errorf("service %s not found", service)
+	}
+	svc, ok := desc.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a service", service)
+	}
+	m := svc.Methods().ByName(protoreflect.Name(method))
+	if m == nil {
+		return nil, fmt.Errorf("method %s not found in %s", method, service)
+	}
+	return m, nil
+}
+
+// loadProtoSets reads FileDescriptorSet files, relative to the request
+// directory unless absolute.
+func loadProtoSets(dir string, paths []string) (*protoregistry.Files, error) {
+	set := &descriptorpb.FileDescriptorSet{}
+	for _, path := range paths {
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading protoset: %w", err)
+		}
+		var fds descriptorpb.FileDescriptorSet
+		if err := proto.Unmarshal(data, &fds); err != nil {
+			return nil, fmt.Errorf("parsing protoset %s: %w", filepath.Base(path), err)
+		}
+		set.File = append(set.File, fds.File...)
+	}
+	files, err := protodesc.NewFiles(withWellKnownTypes(set))
+	if err != nil {
+		return nil, fmt.Errorf("loading protoset: %w", err)
+	}
+	return files, nil
+}
+
+// withWellKnownTypes adds any google/protobuf/*.proto dependency missing
+// from set, so descriptor sets built without --include_imports still load.
+func withWellKnownTypes(set *descriptorpb.FileDescriptorSet) *descriptorpb.FileDescriptorSet {
+	have := make(map[string]bool, len(set.File))
+	for _, file := range set.File {
+		have[file.GetName()] = true
+	}
+	for i := 0; i < len(set.File); i++ {
+		for _, dep := range set.File[i].GetDependency() {
+			if have[dep] {
+				continue
+			}
+			if fd, err := protoregistry.GlobalFiles.FindFileByPath(dep); err == nil {
+				set.File = append(set.File, protodesc.ToFileDescriptorProto(fd))
+				have[dep] = true
+			}
+		}
+	}
+	return set
+}
+
+// reflectionClient fetches file descriptors over the server reflection
+// service.
+type reflectionClient struct {
+	stream grpc.BidiStreamingClient[reflectionpb.ServerReflectionRequest, reflectionpb.ServerReflectionResponse]
+}
+
+func newReflectionClient(ctx context.Context, conn *grpc.ClientConn) (*reflectionClient, error) {
+	stream, err := reflectionpb.NewServerReflectionClient(conn).ServerReflectionInfo(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("starting server reflection: %w", err)
+	}
+	return &reflectionClient{stream: stream}, nil
+}
+
+func (c *reflectionClient) close() {
+	c.stream.CloseSend()
+}
+
+func (c *reflectionClient) send(req *reflectionpb.ServerReflectionRequest) (*reflectionpb.ServerReflectionResponse, error) {
+	if err := c.stream.Send(req); err != nil {
+		return nil, fmt.Errorf("server reflection: %w", err)
+	}
+	resp, err := c.stream.Recv()
+	if err != nil {
+		return nil, fmt.Errorf("server reflection (is reflection enabled on the server?): %w", err)
+	}
+	if errResp := resp.GetErrorResponse(); errResp != nil {
+		return nil, fmt.Errorf("server reflection: %s", errResp.GetErrorMessage())
+	}
+	return resp, nil
+}
+
+func (c *reflectionClient) listServices() ([]string, error) {
+	resp, err := c.send(&reflectionpb.ServerReflectionRequest{
+		MessageRequest: &reflectionpb.ServerReflectionRequest_ListServices{},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var services []string
+	for _, svc := range resp.GetListServicesResponse().GetService() {
+		services = append(services, svc.GetName())
+	}
+	sort.Strings(services)
+	return services, nil
+}
+
+// files resolves the files defining symbols, plus their dependencies, into
+// a registry.
+func (c *reflectionClient) files(symbols ...string) (*protoregistry.Files, error) {
+	set := &descriptorpb.FileDescriptorSet{}
+	have := map[string]bool{}
+	add := func(resp *reflectionpb.ServerReflectionResponse) error {
+		for _, raw := range resp.GetFileDescriptorResponse().GetFileDescriptorProto() {
+			var file descriptorpb.FileDescriptorProto
+			if err := proto.Unmarshal(raw, &file); err != nil {
+				return fmt.Errorf("parsing reflected descriptor: %w", err)
+			}
+			if !have[file.GetName()] {
+				have[file.GetName()] = true
+				set.File = append(set.File, &file)
+			}
+		}
+		return nil
+	}
+
+	for _, symbol := range symbols {
+		resp, err := c.send(&reflectionpb.ServerReflectionRequest{
+			MessageRequest: &reflectionpb.ServerReflectionRequest_FileContainingSymbol{FileContainingSymbol: symbol},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := add(resp); err != nil {
+			return nil, err
+		}
+	}
+	// Servers usually send dependencies along, but fetch any that are
+	// missing, leaving well-known types to withWellKnownTypes.
+	for i := 0; i < len(set.File); i++ {
+		for _, dep := range set.File[i].GetDependency() {
+			if have[dep] || strings.HasPrefix(dep, "google/protobuf/") {
+				continue
+			}
+			resp, err := c.send(&reflectionpb.ServerReflectionRequest{
+				MessageRequest: &reflectionpb.ServerReflectionRequest_FileByFilename{FileByFilename: dep},
+			})
+			if err != nil {
+				return nil, err
+			}
+			if err := add(resp); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	files, err := protodesc.NewFiles(withWellKnownTypes(set))
+	if err != nil {
+		return nil, fmt.Errorf("loading reflected descriptors: %w", err)
+	}
+	return files, nil
+}
+
+func reflectFiles(ctx context.Context, conn *grpc.ClientConn, symbols ...string) (*protoregistry.Files, error) {
+	client, err := newReflectionClient(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	defer client.close()
+	return client.files(symbols...)
+}
+
+// GRPCService describes a service found through server reflection.
+type GRPCService struct {
+	Name    string
+	Methods []GRPCMethod
+}
+
+type GRPCMethod struct {
+	Name         string
+	Input        string
+	Output       string
+	ClientStream bool
+	ServerStream bool
+}
+
+// ListGRPCServices enumerates the services exposed by the environment's
+// gRPC server through server reflection.
+func (cm *ConfigManager) ListGRPCServices(envName string) ([]GRPCService, error) {
+	env, err := cm.LoadEnvironment(envName)
+	if err != nil {
+		return nil, fmt.Errorf("loading environment: %w", err)
+	}
+	vars, err := cm.environmentVariables(envName, env)
+	if err != nil {
+		return nil, err
+	}
+	env = interpolateEnvironment(env, vars)
+
+	tlsConfig, err := cm.tlsConfig(env)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := dialGRPC(env.BaseURL, tlsConfig)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	client, err := newReflectionClient(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	defer client.close()
+
+	names, err := client.listServices()
+	if err != nil {
+		return nil, err
+	}
+	var services []GRPCService
+	for _, name := range names {
+		if strings.HasPrefix(name, "grpc.reflection.") {
+			continue
+		}
+		service := GRPCService{Name: name}
+		files, err := client.files(name)
+		if err != nil {
+			return nil, err
+		}
+		if desc, err := files.FindDescriptorByName(protoreflect.FullName(name)); err == nil {
+			if svc, ok := desc.(protoreflect.ServiceDescriptor); ok {
+				for i := 0; i < svc.Methods().Len(); i++ {
+					m := svc.Methods().Get(i)
+					service.Methods = append(service.Methods, GRPCMethod{
+						Name:         string(m.Name()),
+						Input:        string(m.Input().FullName()),
+						Output:       string(m.Output().FullName()),
+						ClientStream: m.IsStreamingClient(),
+						ServerStream: m.IsStreamingServer(),
+					})
+				}
+			}
+		}
+		services = append(services, service)
+	}
+	return services, nil
+}
@@ -0,0 +1,133 @@
+// highlight.go
+package apiman
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/termenv"
+)
+
+// Syntax highlighting for response bodies. lipgloss renders plain text when
+// stdout is not a terminal or --no-color / NO_COLOR is set, and the
+// highlighters return their input unchanged in that case.
+var (
+	highlightKeyStyle     = lipgloss.NewStyle().Foreground(lipgloss.Color("12"))
+	highlightStringStyle  = lipgloss.NewStyle().Foreground(lipgloss.Color("10"))
+	highlightNumberStyle  = lipgloss.NewStyle().Foreground(lipgloss.Color("14"))
+	highlightLiteralStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("13"))
+	highlightCommentStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("8"))
+	headerNameStyle       = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("14"))
+	budgetStyle           = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("11"))
+)
+
+// colorEnabled reports whether output is styled at all.
+func colorEnabled() bool {
+	return lipgloss.ColorProfile() != termenv.Ascii
+}
+
+// highlightBody colors a formatted response body according to its content
+// type, falling back to sniffing it. Bodies that are neither JSON nor
+// markup are returned as is.
+func highlightBody(body, contentType string) string {
+	if !colorEnabled() || body == "" {
+		return body
+	}
+	trimmed := strings.TrimSpace(body)
+	contentType = strings.ToLower(contentType)
+	switch {
+	case strings.Contains(contentType, "json"),
+		contentType == "" && (strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[")):
+		return highlightJSON(body)
+	case strings.Contains(contentType, "xml"), strings.Contains(contentType, "html"),
+		contentType == "" && strings.HasPrefix(trimmed, "<"):
+		return highlightMarkup(body)
+	}
+	return body
+}
+
+// highlightJSON colors keys, strings, numbers and literals. It works on a
+// token level so bodies cut short by --max-body-print still highlight.
+func highlightJSON(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == '"':
+			end := i + 1
+			for end < len(s) && s[end] != '"' {
+				if s[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			end = min(end+1, len(s))
+			style := highlightStringStyle
+			if isJSONKey(s[end:]) {
+				style = highlightKeyStyle
+			}
+			b.WriteString(paint(style, s[i:end]))
+			i = end
+		case c == '-' || (c >= '0' && c <= '9'):
+			end := i + 1
+			for end < len(s) && strings.IndexByte("0123456789.eE+-", s[end]) >= 0 {
+				end++
+			}
+			b.WriteString(paint(highlightNumberStyle, s[i:end]))
+			i = end
+		case strings.HasPrefix(s[i:], "true"), strings.HasPrefix(s[i:], "null"):
+			b.WriteString(paint(highlightLiteralStyle, s[i:i+4]))
+			i += 4
+		case strings.HasPrefix(s[i:], "false"):
+			b.WriteString(paint(highlightLiteralStyle, s[i:i+5]))
+			i += 5
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+	return b.String()
+}
+
+// paint renders s line by line, as lipgloss pads multi-line blocks to a
+// common width.
+func paint(style lipgloss.Style, s string) string {
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = style.Render(line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// isJSONKey reports whether the string just before rest is an object key.
+func isJSONKey(rest string) bool {
+	return strings.HasPrefix(strings.TrimLeft(rest, " \t\r\n"), ":")
+}
+
+var (
+	markupTokenPattern = regexp.MustCompile(`(?s)<!--.*?-->|<[!?/]?[A-Za-z][^>]*>?`)
+	markupAttrPattern  = regexp.MustCompile(`([\w:.-]+)(\s*=\s*)("[^"]*"|'[^']*'|[^\s>]+)?`)
+	markupNamePattern  = regexp.MustCompile(`^(<[!?/]?)([\w:.-]+)`)
+)
+
+// highlightMarkup colors the tags, attributes and comments of XML and HTML.
+func highlightMarkup(s string) string {
+	return markupTokenPattern.ReplaceAllStringFunc(s, func(token string) string {
+		if strings.HasPrefix(token, "<!--") {
+			return paint(highlightCommentStyle, token)
+		}
+		name := markupNamePattern.FindStringSubmatch(token)
+		if name == nil {
+			return token
+		}
+		rest := token[len(name[0]):]
+		rest = markupAttrPattern.ReplaceAllStringFunc(rest, func(attr string) string {
+			parts := markupAttrPattern.FindStringSubmatch(attr)
+			return paint(highlightNumberStyle, parts[1]) + parts[2] + paint(highlightStringStyle, parts[3])
+		})
+		return name[1] + paint(highlightKeyStyle, name[2]) + rest
+	})
+}
@@ -0,0 +1,622 @@
+// history.go
+package apiman
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// historyLimit is the number of entries kept in .api-man/history.db; older
+// entries are pruned whenever a new one is recorded.
+const historyLimit = 100000
+
+// redactedValue replaces the credentials left out of stored history.
+const redactedValue = "[redacted]"
+
+// redactedHeaders carry credentials, so their values are never stored in
+// the history, like those of headers named as secrets (see secretMarkers).
+var redactedHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+
+// HistoryEntry is one executed request and its response, stored as a row
+// of .api-man/history.db.
+type HistoryEntry struct {
+	ID             string      `json:"id"`
+	Request        string      `json:"request,omitempty"`
+	Environment    string      `json:"environment,omitempty"`
+	Method         string      `json:"method"`
+	URL            string      `json:"url"`
+	RequestHeaders http.Header `json:"requestHeaders,omitempty"`
+	RequestBody    string      `json:"requestBody,omitempty"`
+	Status         string      `json:"status,omitempty"`
+	StatusCode     int         `json:"statusCode,omitempty"`
+	Headers        http.Header `json:"headers,omitempty"`
+	Body           string      `json:"body,omitempty"`
+	DurationMS     int64       `json:"durationMs"`
+	BudgetMS       int64       `json:"budgetMs,omitempty"`
+	OverBudget     bool        `json:"overBudget,omitempty"`
+	TraceID        string      `json:"traceId,omitempty"`
+	RequestID      string      `json:"requestId,omitempty"`
+	Timestamp      time.Time   `json:"timestamp"`
+	Error          string      `json:"error,omitempty"`
+}
+
+// Label names the entry by its request path, falling back to method and URL
+// for ad-hoc requests sent from the web UI.
+func (e *HistoryEntry) Label() string {
+	if e.Request != "" {
+		return e.Request
+	}
+	return e.Method + " " + e.URL
+}
+
+// stateDir is the workspace-local directory for files api-man manages
+// itself (history, backups) rather than the user.
+func (cm *ConfigManager) stateDir() string {
+	return filepath.Join(cm.configDir, ".api-man")
+}
+
+func (cm *ConfigManager) historyFile() string {
+	return filepath.Join(cm.stateDir(), "history.db")
+}
+
+// legacyHistoryDir is where history entries were stored, one JSON file
+// each, before the history moved to SQLite.
+func (cm *ConfigManager) legacyHistoryDir() string {
+	return filepath.Join(cm.stateDir(), "history")
+}
+
+// historySchema creates the history table. Each entry is stored whole as
+// JSON, with the fields history search filters on copied into indexed
+// columns. IDs start with a UTC timestamp, so ordering by ID is
+// chronological.
+const historySchema = `
+CREATE TABLE IF NOT EXISTS history (
+	id          TEXT PRIMARY KEY,
+	request     TEXT NOT NULL,
+	environment TEXT NOT NULL,
+	method      TEXT NOT NULL,
+	status_code INTEGER NOT NULL,
+	failed      INTEGER NOT NULL,
+	timestamp   INTEGER NOT NULL,
+	entry       TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS history_request ON history (request);
+CREATE INDEX IF NOT EXISTS history_environment ON history (environment);
+CREATE INDEX IF NOT EXISTS history_status ON history (status_code);
+CREATE INDEX IF NOT EXISTS history_timestamp ON history (timestamp);
+`
+
+// historyDB opens the history database on first use, creating it and
+// importing any history stored in the old one-file-per-entry layout. WAL
+// mode and a busy timeout let several api-man processes record at once.
+func (cm *ConfigManager) historyDB() (*sql.DB, error) {
+	cm.historyOnce.Do(func() {
+		if errHistoryUnavailable != nil {
+			cm.historyErr = errHistoryUnavailable
+			return
+		}
+		if err := os.MkdirAll(cm.stateDir(), 0755); err != nil {
+			cm.historyErr = fmt.Errorf("creating state directory: %w", err)
+			return
+		}
+		// The history holds responses, which may carry credentials, so the
+		// database is only readable by its owner. SQLite gives its WAL and
+		// shared-memory files the database's permissions.
+		if err := createPrivateFile(cm.historyFile()); err != nil {
+			cm.historyErr = fmt.Errorf("creating history: %w", err)
+			return
+		}
+		db, err := sql.Open("sqlite3", "file:"+cm.historyFile()+"?_busy_timeout=10000&_journal_mode=WAL&_txlock=immediate")
+		if err != nil {
+			cm.historyErr = fmt.Errorf("opening history: %w", err)
+			return
+		}
+		if _, err := db.Exec(historySchema); err != nil {
+			db.Close()
+			cm.historyErr = fmt.Errorf("opening history %s (api-man doctor can check it): %w", cm.relativePath(cm.historyFile()), err)
+			return
+		}
+		if err := cm.importLegacyHistory(db); err != nil {
+			db.Close()
+			cm.historyErr = err
+			return
+		}
+		cm.history = db
+	})
+	return cm.history, cm.historyErr
+}
+
+// createPrivateFile creates path if needed and makes it readable only by
+// its owner.
+func createPrivateFile(path string) error {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Chmod(path, 0600)
+}
+
+// importLegacyHistory moves the entries of the old history directory into
+// db and removes the directory. Files that don't parse are left in place.
+func (cm *ConfigManager) importLegacyHistory(db *sql.DB) error {
+	files, err := filepath.Glob(filepath.Join(cm.legacyHistoryDir(), "*.json"))
+	if err != nil || len(files) == 0 {
+		return err
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("importing history: %w", err)
+	}
+	defer tx.Rollback()
+	var imported []string
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		var entry HistoryEntry
+		if json.Unmarshal(data, &entry) != nil || entry.ID == "" {
+			continue
+		}
+		if err := insertHistory(tx, &entry, "INSERT OR IGNORE"); err != nil {
+			return fmt.Errorf("importing history: %w", err)
+		}
+		imported = append(imported, file)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("importing history: %w", err)
+	}
+	for _, file := range imported {
+		os.Remove(file)
+	}
+	// Only succeeds once every file was imported.
+	os.Remove(cm.legacyHistoryDir())
+	return nil
+}
+
+// sqlExecer is what insertHistory needs of a *sql.DB or *sql.Tx.
+type sqlExecer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// insertHistory stores entry with verb, INSERT or INSERT OR IGNORE.
+func insertHistory(db sqlExecer, entry *HistoryEntry, verb string) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("encoding history entry: %w", err)
+	}
+	_, err = db.Exec(verb+` INTO history (id, request, environment, method, status_code, failed, timestamp, entry)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		entry.ID, entry.Request, entry.Environment, entry.Method, entry.StatusCode, entry.Error != "",
+		entry.Timestamp.UnixNano(), string(data))
+	return err
+}
+
+// RecordHistory stores entry, assigning its ID and timestamp when unset.
+func (cm *ConfigManager) RecordHistory(entry *HistoryEntry) error {
+	if err := cm.redactHistory(entry, nil); err != nil {
+		return err
+	}
+	if entry.Timestamp.IsZero() {
+		entry.Timestamp = time.Now()
+	}
+	if entry.ID == "" {
+		name := entry.Request
+		if name == "" {
+			name = entry.Method
+		}
+		entry.ID = entry.Timestamp.UTC().Format("20060102T150405.000000Z") + "-" + sanitizeRequestPathSegment(name)
+	}
+
+	db, err := cm.historyDB()
+	if err != nil {
+		return err
+	}
+	if err := insertHistory(db, entry, "INSERT OR REPLACE"); err != nil {
+		return fmt.Errorf("writing history entry: %w", err)
+	}
+	_, err = db.Exec(`DELETE FROM history WHERE id <= (SELECT id FROM history ORDER BY id DESC LIMIT 1 OFFSET ?)`, historyLimit)
+	if err != nil {
+		return fmt.Errorf("pruning history: %w", err)
+	}
+	return nil
+}
+
+// recordExecution stores a completed execution in the history and the
+// metrics. Failures to write history never fail the request itself, so
+// errors are only reported.
+func (cm *ConfigManager) recordExecution(result *ExecutionResult, requestHeaders http.Header) {
+	entry := &HistoryEntry{
+		Request:        result.Request,
+		Environment:    result.Environment,
+		Method:         result.Method,
+		URL:            result.URL,
+		RequestHeaders: requestHeaders,
+		RequestBody:    result.RequestBody,
+		Status:         result.Status,
+		StatusCode:     result.StatusCode,
+		Headers:        result.Headers,
+		Body:           string(result.Body),
+		DurationMS:     result.DurationMS(),
+		BudgetMS:       result.BudgetMS,
+		OverBudget:     result.OverBudget(),
+		TraceID:        result.TraceID,
+		RequestID:      result.RequestID,
+		Timestamp:      result.StartedAt,
+	}
+	err := cm.redactHistory(entry, secretVariables(result.ResolvedVariables))
+	if err == nil {
+		err = cm.RecordHistory(entry)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+	cm.recordMetric(executionMetric(result, metricSourceRun))
+}
+
+// redactHistory removes credentials from entry before it is stored: the
+// values of credential headers are replaced with redactedValue, and the
+// values secrets resolved to (keyed as resolveSecrets returns them) with
+// their references wherever they appear.
+func (cm *ConfigManager) redactHistory(entry *HistoryEntry, secrets map[string]string) error {
+	markers, err := cm.secretMarkers()
+	if err != nil {
+		return err
+	}
+	entry.URL = redactSecretValues(entry.URL, secrets)
+	entry.RequestBody = redactSecretValues(entry.RequestBody, secrets)
+	entry.Body = redactSecretValues(entry.Body, secrets)
+	entry.RequestHeaders = redactHeaders(entry.RequestHeaders, markers, secrets)
+	entry.Headers = redactHeaders(entry.Headers, markers, secrets)
+	return nil
+}
+
+// redactHeaders returns a copy of header with credentials redacted (see
+// redactHistory).
+func redactHeaders(header http.Header, markers []string, secrets map[string]string) http.Header {
+	if header == nil {
+		return nil
+	}
+	redacted := make(http.Header, len(header))
+	for key, values := range header {
+		credential := isSecretKey(key, markers) || slices.ContainsFunc(redactedHeaders, func(name string) bool {
+			return strings.EqualFold(name, key)
+		})
+		for _, value := range values {
+			if credential {
+				value = redactedValue
+			} else {
+				value = redactSecretValues(value, secrets)
+			}
+			redacted[key] = append(redacted[key], value)
+		}
+	}
+	return redacted
+}
+
+// secretVariables returns the {{secret.NAME}} and provider references among
+// vars.
+func secretVariables(vars map[string]string) map[string]string {
+	secrets := make(map[string]string)
+	for key, value := range vars {
+		if strings.HasPrefix(key, "secret.") || isExternalSecret(key) {
+			secrets[key] = value
+		}
+	}
+	return secrets
+}
+
+// unredactedRequest builds the request of entry, sent to target, undoing
+// redactHistory where it can: secret references are resolved again, while
+// the credential headers that were redacted are left out, reporting whether
+// there were any so the environment's credentials can take their place.
+func (cm *ConfigManager) unredactedRequest(ctx context.Context, entry *HistoryEntry, target string) (*http.Request, bool, error) {
+	secrets, err := cm.resolveSecrets(target, entry.RequestBody, entry.RequestHeaders)
+	if err != nil {
+		return nil, false, err
+	}
+	restore := func(s string) string {
+		for ref, value := range secrets {
+			s = strings.ReplaceAll(s, "{{"+ref+"}}", value)
+		}
+		return s
+	}
+	req, err := http.NewRequestWithContext(ctx, entry.Method, restore(target), strings.NewReader(restore(entry.RequestBody)))
+	if err != nil {
+		return nil, false, fmt.Errorf("creating request: %w", err)
+	}
+	redacted := false
+	for key, values := range entry.RequestHeaders {
+		for _, value := range values {
+			if strings.Contains(value, redactedValue) {
+				redacted = true
+				continue
+			}
+			req.Header.Add(key, restore(value))
+		}
+	}
+	return req, redacted, nil
+}
+
+// queryHistory returns the entries query selects, decoding the entry
+// column, which must come first.
+func (cm *ConfigManager) queryHistory(query string, args ...interface{}) ([]*HistoryEntry, error) {
+	db, err := cm.historyDB()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("reading history: %w", err)
+	}
+	defer rows.Close()
+	entries := []*HistoryEntry{}
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, fmt.Errorf("reading history: %w", err)
+		}
+		var entry HistoryEntry
+		if err := json.Unmarshal([]byte(data), &entry); err != nil {
+			return nil, fmt.Errorf("parsing history entry: %w", err)
+		}
+		entries = append(entries, &entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("reading history: %w", err)
+	}
+	return entries, nil
+}
+
+// ListHistory returns up to limit entries, newest first. A limit of zero
+// returns everything.
+func (cm *ConfigManager) ListHistory(limit int) ([]*HistoryEntry, error) {
+	return cm.SearchHistory(HistoryQuery{Limit: limit})
+}
+
+// HistoryQuery selects history entries. Zero fields match everything.
+type HistoryQuery struct {
+	// Request is a glob matched against the request path, where * also
+	// matches across slashes: users/* matches users/a/b.
+	Request     string
+	Environment string
+	Method      string
+	// Status is a status code (404), a class (5xx) or "error" for
+	// requests that got no response.
+	Status string
+	Since  time.Time
+	// Limit caps the number of entries returned, newest first.
+	Limit int
+}
+
+var statusClassPattern = regexp.MustCompile(`^([1-5])xx$`)
+
+// where returns the query's SQL conditions and their arguments.
+func (q HistoryQuery) where() (string, []interface{}, error) {
+	var conditions []string
+	var args []interface{}
+	add := func(condition string, values ...interface{}) {
+		conditions = append(conditions, condition)
+		args = append(args, values...)
+	}
+	if q.Request != "" {
+		add("request GLOB ?", q.Request)
+	}
+	if q.Environment != "" {
+		add("environment = ?", q.Environment)
+	}
+	if q.Method != "" {
+		add("method = ?", strings.ToUpper(q.Method))
+	}
+	if status := strings.ToLower(q.Status); status != "" {
+		if status == "error" {
+			add("failed = 1")
+		} else if match := statusClassPattern.FindStringSubmatch(status); match != nil {
+			class, _ := strconv.Atoi(match[1])
+			add("failed = 0 AND status_code BETWEEN ? AND ?", class*100, class*100+99)
+		} else if code, err := strconv.Atoi(status); err == nil && code >= 100 && code <= 599 {
+			add("failed = 0 AND status_code = ?", code)
+		} else {
+			return "", nil, fmt.Errorf("invalid status %q (expected a code such as 404, a class such as 5xx, or error)", q.Status)
+		}
+	}
+	if !q.Since.IsZero() {
+		add("timestamp >= ?", q.Since.UnixNano())
+	}
+	if len(conditions) == 0 {
+		return "", nil, nil
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args, nil
+}
+
+// SearchHistory returns the entries matching q, newest first.
+func (cm *ConfigManager) SearchHistory(q HistoryQuery) ([]*HistoryEntry, error) {
+	where, args, err := q.where()
+	if err != nil {
+		return nil, err
+	}
+	limit := q.Limit
+	if limit <= 0 {
+		limit = -1
+	}
+	return cm.queryHistory("SELECT entry FROM history"+where+" ORDER BY id DESC LIMIT ?", append(args, limit)...)
+}
+
+// parseHistorySince reads the --since of history search: a duration back
+// from now such as 30m, 24h or 7d, a date (2006-01-02) or an RFC 3339 time.
+func parseHistorySince(value string, now time.Time) (time.Time, error) {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil && n >= 0 {
+			return now.AddDate(0, 0, -n), nil
+		}
+	}
+	if d, err := time.ParseDuration(value); err == nil && d >= 0 {
+		return now.Add(-d), nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid --since %q (expected a duration such as 24h or 7d, a date or an RFC 3339 time)", value)
+}
+
+// LoadHistory reads one entry. id may be a full ID, a unique prefix, or a
+// 1-based index into the newest-first listing ("1" is the latest).
+func (cm *ConfigManager) LoadHistory(id string) (*HistoryEntry, error) {
+	var entries []*HistoryEntry
+	var err error
+	if n, convErr := strconv.Atoi(id); convErr == nil && n > 0 {
+		entries, err = cm.queryHistory("SELECT entry FROM history ORDER BY id DESC LIMIT 1 OFFSET ?", n-1)
+	}
+	if err == nil && len(entries) == 0 {
+		entries, err = cm.queryHistory("SELECT entry FROM history WHERE id = ?", id)
+	}
+	if err == nil && len(entries) == 0 {
+		entries, err = cm.queryHistory("SELECT entry FROM history WHERE substr(id, 1, ?) = ? LIMIT 2", len(id), id)
+		if len(entries) > 1 {
+			return nil, fmt.Errorf("history id %q is ambiguous", id)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("history entry %q not found", id)
+	}
+	return entries[0], nil
+}
+
+// latestRuns returns the newest entry matching q of every request that
+// has one. q.Limit is ignored.
+func (cm *ConfigManager) latestRuns(q HistoryQuery) ([]*HistoryEntry, error) {
+	where, args, err := q.where()
+	if err != nil {
+		return nil, err
+	}
+	if where == "" {
+		where = " WHERE request != ''"
+	} else {
+		where += " AND request != ''"
+	}
+	return cm.queryHistory("SELECT entry FROM history WHERE id IN (SELECT max(id) FROM history"+where+" GROUP BY request) ORDER BY request", args...)
+}
+
+// latestResponse returns the newest entry of requestPath that got a
+// response, in envName when it isn't "".
+func (cm *ConfigManager) latestResponse(requestPath, envName string) (*HistoryEntry, error) {
+	query := "SELECT entry FROM history WHERE request = ? AND failed = 0"
+	args := []interface{}{requestPath}
+	if envName != "" {
+		query += " AND environment = ?"
+		args = append(args, envName)
+	}
+	entries, err := cm.queryHistory(query+" ORDER BY id DESC LIMIT 1", args...)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		if envName != "" {
+			return nil, fmt.Errorf("no response to %s in %s in the history", requestPath, envName)
+		}
+		return nil, fmt.Errorf("no response to %s in the history", requestPath)
+	}
+	return entries[0], nil
+}
+
+// ReplayHistory sends the request of entry again as it was sent, through
+// its environment's proxy and TLS settings when the environment still
+// exists, and records the new execution. Credentials redacted from the
+// history are taken from the environment again. Hooks and extract rules are
+// not run, as the stored request may have changed since. confirmed is
+// RequestOptions.Confirmed.
+func (cm *ConfigManager) ReplayHistory(ctx context.Context, entry *HistoryEntry, confirmed bool) (*ExecutionResult, error) {
+	if err := cm.confirmSend(entry.Environment, nil, entry.Method, entry.URL, confirmed); err != nil {
+		return nil, err
+	}
+	req, redacted, err := cm.unredactedRequest(ctx, entry, entry.URL)
+	if err != nil {
+		return nil, err
+	}
+	client := &http.Client{Timeout: 30 * time.Second}
+	if entry.Environment != "" {
+		if env, err := cm.LoadEnvironment(entry.Environment); err == nil {
+			if env, err = cm.resolveEnvironment(entry.Environment, env); err != nil {
+				return nil, err
+			}
+			if client.Transport, err = cm.httpTransport(env, ""); err != nil {
+				return nil, err
+			}
+			if redacted {
+				if err := cm.applyEnvironmentCredentials(req, entry.Environment, env); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	startedAt := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, cancelled(ctx, err, startedAt)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, cancelled(ctx, fmt.Errorf("reading response body: %w", err), startedAt)
+	}
+	result := &ExecutionResult{
+		Request:        entry.Request,
+		Environment:    entry.Environment,
+		Method:         entry.Method,
+		URL:            entry.URL,
+		Status:         resp.Status,
+		StatusCode:     resp.StatusCode,
+		Headers:        resp.Header,
+		Body:           body,
+		Duration:       time.Since(startedAt),
+		StartedAt:      startedAt,
+		RequestHeaders: req.Header,
+		RequestBody:    entry.RequestBody,
+	}
+	if err := decodeResponse(result); err != nil {
+		return nil, err
+	}
+	cm.recordExecution(result, req.Header)
+	return result, nil
+}
+
+// ClearHistory removes every stored entry and reports how many there were.
+func (cm *ConfigManager) ClearHistory() (int, error) {
+	db, err := cm.historyDB()
+	if err != nil {
+		return 0, err
+	}
+	result, err := db.Exec("DELETE FROM history")
+	if err != nil {
+		return 0, fmt.Errorf("clearing history: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("clearing history: %w", err)
+	}
+	if _, err := db.Exec("VACUUM"); err != nil {
+		return int(n), fmt.Errorf("compacting history: %w", err)
+	}
+	return int(n), nil
+}
@@ -0,0 +1,6 @@
+//go:build cgo
+
+package apiman
+
+// errHistoryUnavailable is set when the history database can't be used.
+var errHistoryUnavailable error
@@ -0,0 +1,9 @@
+//go:build !cgo
+
+package apiman
+
+import "errors"
+
+// errHistoryUnavailable is set when the history database can't be used:
+// go-sqlite3 is a stub that fails on every query without cgo.
+var errHistoryUnavailable = errors.New("history needs api-man built with CGO_ENABLED=1")
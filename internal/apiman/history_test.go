@@ -0,0 +1,101 @@
+package apiman
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestHistoryRedactsCredentials(t *testing.T) {
+	if errHistoryUnavailable != nil {
+		t.Skip(errHistoryUnavailable)
+	}
+	t.Setenv(secretsBackendEnv, "file")
+	t.Setenv(secretsPassphraseEnv, "test passphrase")
+
+	var received *http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Clone(context.Background())
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "s3cr3t-session"})
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer server.Close()
+
+	cm, err := InitWorkspace(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := cm.Secrets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Set("api_token", "s3cr3t-token"); err != nil {
+		t.Fatal(err)
+	}
+	env := Environment{
+		BaseURL: server.URL,
+		Headers: map[string]string{"X-Api-Key": "s3cr3t-key"},
+		Cookies: map[string]string{"sid": "s3cr3t-cookie"},
+		Auth:    map[string]string{"type": "bearer", "token": "{{secret.api_token}}"},
+	}
+	if err := cm.SaveEnvironment("dev", env); err != nil {
+		t.Fatal(err)
+	}
+	request := RequestConfig{Method: "GET", URL: "/items?key={{secret.api_token}}", Headers: map[string]string{"X-Trace": "t-{{secret.api_token}}"}}
+	if err := cm.SaveRequest("items", request); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cm.RunRequest("items", "dev", RequestOptions{Confirmed: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := cm.ListHistory(1)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("history: %v, %d entries", err, len(entries))
+	}
+	data, err := json.Marshal(entries[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "s3cr3t") {
+		t.Errorf("credentials stored in the history:\n%s", data)
+	}
+	if got := entries[0].RequestHeaders.Get("X-Trace"); got != "t-{{secret.api_token}}" {
+		t.Errorf("secret in X-Trace stored as %q", got)
+	}
+	info, err := os.Stat(cm.historyFile())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != 0600 {
+		t.Errorf("history created with mode %o", mode)
+	}
+
+	// Replaying takes the redacted credentials from the environment again.
+	received = nil
+	if _, err := cm.ReplayHistory(context.Background(), entries[0], true); err != nil {
+		t.Fatal(err)
+	}
+	if received == nil {
+		t.Fatal("replay not sent")
+	}
+	if got := received.Header.Get("Authorization"); got != "Bearer s3cr3t-token" {
+		t.Errorf("replayed Authorization %q", got)
+	}
+	if got := received.Header.Get("X-Api-Key"); got != "s3cr3t-key" {
+		t.Errorf("replayed X-Api-Key %q", got)
+	}
+	if cookie, err := received.Cookie("sid"); err != nil || cookie.Value != "s3cr3t-cookie" {
+		t.Errorf("replayed cookie %v, %v", cookie, err)
+	}
+	if got := received.URL.Query().Get("key"); got != "s3cr3t-token" {
+		t.Errorf("replayed key %q", got)
+	}
+	if got := received.Header.Get("X-Trace"); got != "t-s3cr3t-token" {
+		t.Errorf("replayed X-Trace %q", got)
+	}
+}
@@ -0,0 +1,289 @@
+// hooks.go
+package apiman
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// hookTimeout bounds how long a single hook script may run.
+const hookTimeout = 30 * time.Second
+
+// RequestHooks names the scripts run around a request. Each value is a
+// shell command executed in the request directory, or JavaScript after a
+// "js:" prefix (see runScriptHook). When unset, pre.sh and post.sh, or
+// pre.js and post.js, in the request directory are used if present.
+type RequestHooks struct {
+	Pre  string `json:"pre,omitempty"`
+	Post string `json:"post,omitempty"`
+}
+
+// HookInput is written to a hook's stdin as JSON. Response is only set for
+// the post-response hook.
+type HookInput struct {
+	Hook        string            `json:"hook"`
+	Request     string            `json:"request"`
+	Environment string            `json:"environment"`
+	Method      string            `json:"method"`
+	URL         string            `json:"url"`
+	Headers     map[string]string `json:"headers"`
+	Body        string            `json:"body"`
+	Variables   map[string]string `json:"variables"`
+	Response    *HookResponse     `json:"response,omitempty"`
+}
+
+type HookResponse struct {
+	Status     string            `json:"status"`
+	StatusCode int               `json:"statusCode"`
+	Headers    map[string]string `json:"headers"`
+	Body       string            `json:"body"`
+	DurationMS int64             `json:"durationMs"`
+}
+
+// HookOutput is what a hook may print on stdout. Every field is optional and
+// an empty stdout changes nothing. Headers set to "" are removed. Variables
+// resolve {{placeholders}} still left in the request; the post-response hook
+// can only set variables, which chains pass to later steps.
+type HookOutput struct {
+	Method    *string           `json:"method,omitempty"`
+	URL       *string           `json:"url,omitempty"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	Body      *string           `json:"body,omitempty"`
+	Variables map[string]string `json:"variables,omitempty"`
+}
+
+// requestDir returns the directory a request's hooks run in: the request's
+// own directory, or the directory holding a flat request file.
+func (cm *ConfigManager) requestDir(requestPath string) string {
+	dir := filepath.Join(cm.requestsDir, requestPath)
+	if info, err := os.Stat(dir); err == nil && info.IsDir() {
+		return dir
+	}
+	return filepath.Dir(dir)
+}
+
+// hookCommand returns the shell command for the given hook, or "" when the
+// request has none.
+func (cm *ConfigManager) hookCommand(requestPath string, config *RequestConfig, hook string) string {
+	if config.Hooks != nil {
+		switch {
+		case hook == "pre" && config.Hooks.Pre != "":
+			return config.Hooks.Pre
+		case hook == "post" && config.Hooks.Post != "":
+			return config.Hooks.Post
+		}
+	}
+	dir := filepath.Join(cm.requestsDir, requestPath)
+	if fileExists(filepath.Join(dir, hook+".sh")) {
+		return "sh ./" + hook + ".sh"
+	}
+	if script, err := os.ReadFile(filepath.Join(dir, hook+".js")); err == nil {
+		return scriptPrefix + string(script)
+	}
+	return ""
+}
+
+func (cm *ConfigManager) runPreRequestHook(prepared *PreparedRequest) error {
+	command := cm.hookCommand(prepared.Path, prepared.Config, "pre")
+	if command == "" {
+		return nil
+	}
+
+	req := prepared.Request
+	body, err := readRequestBody(req)
+	if err != nil {
+		return err
+	}
+	input := HookInput{
+		Hook:        "pre",
+		Request:     prepared.Path,
+		Environment: prepared.Environment,
+		Method:      req.Method,
+		URL:         req.URL.String(),
+		Headers:     flattenHeaders(req.Header),
+		Body:        body,
+		Variables:   prepared.Variables,
+	}
+	output, err := cm.runHook(prepared.Path, command, input)
+	if err != nil {
+		return fmt.Errorf("pre-request hook: %w", err)
+	}
+
+	vars := mergeVariables(prepared.Variables, output.Variables)
+	if output.Method != nil {
+		req.Method = strings.ToUpper(*output.Method)
+	}
+	if output.URL != nil || len(output.Variables) > 0 {
+		newURL := req.URL.String()
+		if output.URL != nil {
+			newURL = *output.URL
+		}
+		// Placeholders in an already-parsed URL come back percent-encoded.
+		newURL = strings.NewReplacer("%7B", "{", "%7D", "}").Replace(newURL)
+		parsed, err := url.Parse(interpolate(newURL, vars))
+		if err != nil {
+			return fmt.Errorf("pre-request hook returned an invalid url: %w", err)
+		}
+		req.URL = parsed
+		req.Host = parsed.Host
+	}
+	for key, value := range output.Headers {
+		if value == "" {
+			req.Header.Del(key)
+		} else {
+			req.Header.Set(key, value)
+		}
+	}
+	for key, values := range req.Header {
+		for i, value := range values {
+			values[i] = interpolate(value, vars)
+		}
+		req.Header[key] = values
+	}
+	if output.Body != nil {
+		body = *output.Body
+	}
+	setRequestBody(req, interpolate(body, vars))
+
+	prepared.Variables = vars
+	prepared.HookVariables = output.Variables
+	return nil
+}
+
+func (cm *ConfigManager) runPostResponseHook(prepared *PreparedRequest, result *ExecutionResult) (map[string]string, error) {
+	command := cm.hookCommand(prepared.Path, prepared.Config, "post")
+	if command == "" {
+		return nil, nil
+	}
+
+	body, err := readRequestBody(prepared.Request)
+	if err != nil {
+		return nil, err
+	}
+	input := HookInput{
+		Hook:        "post",
+		Request:     prepared.Path,
+		Environment: prepared.Environment,
+		Method:      result.Method,
+		URL:         result.URL,
+		Headers:     flattenHeaders(prepared.Request.Header),
+		Body:        body,
+		Variables:   prepared.Variables,
+		Response: &HookResponse{
+			Status:     result.Status,
+			StatusCode: result.StatusCode,
+			Headers:    flattenHeaders(result.Headers),
+			Body:       string(result.Body),
+			DurationMS: result.DurationMS(),
+		},
+	}
+	output, err := cm.runHook(prepared.Path, command, input)
+	if err != nil {
+		return nil, fmt.Errorf("post-response hook: %w", err)
+	}
+	return output.Variables, nil
+}
+
+// runHook executes command with input as JSON on stdin. The hook's stderr is
+// passed through so scripts can log; stdout must be empty or a HookOutput.
+func (cm *ConfigManager) runHook(requestPath, command string, input HookInput) (*HookOutput, error) {
+	if source, ok := strings.CutPrefix(command, scriptPrefix); ok {
+		output, err := runScriptHook(source, input)
+		if err != nil {
+			return nil, fmt.Errorf("running script: %w", err)
+		}
+		return output, nil
+	}
+	payload, err := json.Marshal(input)
+	if err != nil {
+		return nil, fmt.Errorf("encoding hook input: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), hookTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Dir = cm.requestDir(requestPath)
+	cmd.Stdin = bytes.NewReader(payload)
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(),
+		"API_MAN_HOOK="+input.Hook,
+		"API_MAN_REQUEST="+input.Request,
+		"API_MAN_ENVIRONMENT="+input.Environment,
+		"API_MAN_WORKSPACE="+cm.configDir,
+	)
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("running %q: %w", command, err)
+	}
+
+	var output HookOutput
+	if trimmed := bytes.TrimSpace(stdout.Bytes()); len(trimmed) > 0 {
+		if err := json.Unmarshal(trimmed, &output); err != nil {
+			return nil, fmt.Errorf("parsing output of %q: %w", command, err)
+		}
+	}
+	return &output, nil
+}
+
+// readRequestBody returns req's body without consuming it, so it works both
+// before and after the request has been sent.
+func readRequestBody(req *http.Request) (string, error) {
+	if req.GetBody != nil {
+		rc, err := req.GetBody()
+		if err != nil {
+			return "", fmt.Errorf("reading request body: %w", err)
+		}
+		defer rc.Close()
+		data, err := io.ReadAll(rc)
+		if err != nil {
+			return "", fmt.Errorf("reading request body: %w", err)
+		}
+		return string(data), nil
+	}
+	if req.Body == nil {
+		return "", nil
+	}
+	data, err := io.ReadAll(req.Body)
+	if err != nil {
+		return "", fmt.Errorf("reading request body: %w", err)
+	}
+	setRequestBody(req, string(data))
+	return string(data), nil
+}
+
+// setRequestBody replaces req's body, keeping ContentLength and GetBody
+// consistent for redirects and retries.
+func setRequestBody(req *http.Request, body string) {
+	if body == "" {
+		req.Body = nil
+		req.GetBody = nil
+		req.ContentLength = 0
+		return
+	}
+	req.Body = io.NopCloser(strings.NewReader(body))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(strings.NewReader(body)), nil
+	}
+	req.ContentLength = int64(len(body))
+}
+
+func flattenHeaders(h http.Header) map[string]string {
+	flat := make(map[string]string, len(h))
+	for key, values := range h {
+		flat[key] = strings.Join(values, ", ")
+	}
+	return flat
+}
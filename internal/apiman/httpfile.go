@@ -0,0 +1,546 @@
+// httpfile.go
+package apiman
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// The .http format (also .rest) of the JetBrains HTTP Client and the VS Code
+// REST Client: requests separated by ### lines, each a request line
+// ("METHOD URL [HTTP/1.1]"), headers, a blank line and the body. Lines
+// starting with # or // are comments, and "# @name x" or the text after ###
+// names a request. "@name = value" lines define file variables, used as
+// {{name}} like api-man's own variables.
+
+// httpBaseURLVariable is the variable exported .http files start relative
+// URLs with. When a file doesn't define it, a URL starting with it is
+// relative to the environment's baseURL.
+const httpBaseURLVariable = "baseUrl"
+
+var (
+	httpRequestLinePattern  = regexp.MustCompile(`^([A-Z][A-Z-]*)\s+(\S.*?)(?:\s+HTTP/[0-9.]+)?$`)
+	httpFileVariablePattern = regexp.MustCompile(`^@([A-Za-z_][\w.-]*)\s*=\s*(.*)$`)
+	httpNameDirective       = regexp.MustCompile(`^(?:#|//)\s*@name\s+(\S+)`)
+	// httpDynamicPattern matches the clients' {{$name args}} dynamic values.
+	httpDynamicPattern = regexp.MustCompile(`\{\{\s*\$([\w.]+)((?:\s+[^}]*)?)\}\}`)
+)
+
+// httpDynamicValues maps the clients' dynamic values to api-man functions.
+var httpDynamicValues = map[string]string{
+	"uuid":                "uuid",
+	"guid":                "uuid",
+	"random.uuid":         "uuid",
+	"timestamp":           "timestamp",
+	"isoTimestamp":        "now",
+	"datetime":            "now",
+	"randomInt":           "randomInt",
+	"random.integer":      "randomInt",
+	"random.email":        "randomEmail",
+	"random.alphanumeric": "randomString",
+}
+
+// httpFile is a parsed .http file.
+type httpFile struct {
+	// Variables are the file variables, in the order they are defined.
+	Variables []httpFileVariable
+	Requests  []httpFileRequest
+	Warnings  []string
+}
+
+type httpFileVariable struct {
+	Name, Value string
+}
+
+type httpFileRequest struct {
+	// Name is the request's @name, or the text after its ### separator.
+	Name   string
+	Config RequestConfig
+}
+
+// label names the request for warnings and references: its name, or its
+// 1-based position in the file.
+func (r *httpFileRequest) label(index int) string {
+	if r.Name != "" {
+		return r.Name
+	}
+	return "#" + strconv.Itoa(index+1)
+}
+
+// parseHTTPFile parses a .http file. Bodies given as "< path" are read
+// relative to dir. Response handler scripts and output redirects have no
+// api-man equivalent and are dropped with a warning.
+func parseHTTPFile(data []byte, dir string) (*httpFile, error) {
+	file := &httpFile{}
+	var blocks [][]string
+	var titles []string
+	current, title := []string{}, ""
+	for _, line := range strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n") {
+		if strings.HasPrefix(line, "###") {
+			blocks, titles = append(blocks, current), append(titles, title)
+			current, title = []string{}, strings.TrimSpace(strings.TrimLeft(line, "#"))
+			continue
+		}
+		current = append(current, line)
+	}
+	blocks, titles = append(blocks, current), append(titles, title)
+
+	for i, block := range blocks {
+		request, err := file.parseBlock(block, titles[i], dir)
+		if err != nil {
+			return nil, err
+		}
+		if request != nil {
+			file.Requests = append(file.Requests, *request)
+		}
+	}
+	return file, nil
+}
+
+// parseBlock parses the lines between two ### separators, returning nil
+// when they hold no request.
+func (f *httpFile) parseBlock(lines []string, title, dir string) (*httpFileRequest, error) {
+	request := &httpFileRequest{Name: title}
+	config := &request.Config
+	var description []string
+	i := 0
+preamble:
+	for ; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		switch {
+		case line == "":
+		case httpNameDirective.MatchString(line):
+			request.Name = httpNameDirective.FindStringSubmatch(line)[1]
+		case strings.HasPrefix(line, "#") || strings.HasPrefix(line, "//"):
+			comment := strings.TrimSpace(strings.TrimLeft(line, "#/"))
+			if !strings.HasPrefix(comment, "@") {
+				description = append(description, comment)
+			}
+		case httpFileVariablePattern.MatchString(line):
+			m := httpFileVariablePattern.FindStringSubmatch(line)
+			f.Variables = append(f.Variables, httpFileVariable{Name: m[1], Value: f.dynamicValues(strings.TrimSpace(m[2]))})
+		default:
+			break preamble
+		}
+	}
+	if i == len(lines) {
+		return nil, nil
+	}
+
+	line := strings.TrimSpace(lines[i])
+	if m := httpRequestLinePattern.FindStringSubmatch(line); m != nil {
+		config.Method, config.URL = m[1], m[2]
+	} else {
+		config.Method, config.URL = http.MethodGet, line
+	}
+	// Query strings may continue on lines starting with ? or &.
+	for i++; i < len(lines); i++ {
+		part := strings.TrimSpace(lines[i])
+		if !strings.HasPrefix(part, "?") && !strings.HasPrefix(part, "&") {
+			break
+		}
+		config.URL += part
+	}
+	config.URL = f.dynamicValues(config.URL)
+	config.Description = strings.Join(description, "\n")
+	config.Headers = map[string]string{}
+	config.Cookies = map[string]string{}
+	config.Timeout = 30
+	label := request.label(len(f.Requests))
+
+	for ; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		if line == "" {
+			i++
+			break
+		}
+		if strings.HasPrefix(line, "#") || strings.HasPrefix(line, "//") {
+			continue
+		}
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("request %s: expected a header, got %q", label, line)
+		}
+		config.Headers[strings.TrimSpace(name)] = f.dynamicValues(strings.TrimSpace(value))
+	}
+
+	var body []string
+	for ; i < len(lines); i++ {
+		line := lines[i]
+		if strings.HasPrefix(line, ">") {
+			f.Warnings = append(f.Warnings, fmt.Sprintf("request %s: response handlers and redirects (%s) are not supported and were dropped", label, strings.TrimSpace(line)))
+			break
+		}
+		if path, ok := strings.CutPrefix(line, "<"); ok && len(body) == 0 {
+			path = strings.TrimSpace(strings.TrimPrefix(path, "@"))
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(dir, path)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("request %s: reading body: %w", label, err)
+			}
+			body = append(body, strings.TrimSuffix(string(data), "\n"))
+			continue
+		}
+		body = append(body, line)
+	}
+	config.Body = f.dynamicValues(strings.TrimRight(strings.Join(body, "\n"), " \t\n"))
+	return request, nil
+}
+
+// dynamicValues rewrites the clients' {{$name}} dynamic values as api-man
+// functions, warning about those it has no equivalent for.
+func (f *httpFile) dynamicValues(s string) string {
+	return httpDynamicPattern.ReplaceAllStringFunc(s, func(match string) string {
+		m := httpDynamicPattern.FindStringSubmatch(match)
+		name, args := m[1], strings.TrimSpace(m[2])
+		switch name {
+		case "processEnv":
+			return "{{env." + args + "}}"
+		case "dotenv":
+			return "{{" + args + "}}"
+		}
+		function, ok := httpDynamicValues[name]
+		if !ok {
+			f.Warnings = append(f.Warnings, fmt.Sprintf("dynamic value {{$%s}} is not supported and was kept as-is", name))
+			return match
+		}
+		if function == "now" {
+			// Date formats are the clients' own; use the default.
+			args = ""
+		}
+		return "{{" + strings.TrimSpace(function+" "+args) + "}}"
+	})
+}
+
+// request finds a request by name, or by its 1-based position. An empty
+// reference selects the only request of a file that has just one.
+func (f *httpFile) request(ref string) (*httpFileRequest, error) {
+	if ref == "" {
+		if len(f.Requests) == 1 {
+			return &f.Requests[0], nil
+		}
+		return nil, fmt.Errorf("the file has %d requests; name one as file.http#name (%s)", len(f.Requests), strings.Join(f.requestLabels(), ", "))
+	}
+	for i := range f.Requests {
+		if f.Requests[i].Name == ref {
+			return &f.Requests[i], nil
+		}
+	}
+	if n, err := strconv.Atoi(ref); err == nil && n >= 1 && n <= len(f.Requests) {
+		return &f.Requests[n-1], nil
+	}
+	return nil, fmt.Errorf("no request named %q in the file (%s)", ref, strings.Join(f.requestLabels(), ", "))
+}
+
+func (f *httpFile) requestLabels() []string {
+	labels := make([]string, len(f.Requests))
+	for i := range f.Requests {
+		labels[i] = f.Requests[i].label(i)
+	}
+	return labels
+}
+
+// httpFileReference splits a request path such as "api.http#get-user" into
+// the .http or .rest file and the request named in it.
+func httpFileReference(path string) (file, ref string, ok bool) {
+	file, ref, _ = strings.Cut(path, "#")
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".http", ".rest":
+		return file, ref, true
+	}
+	return "", "", false
+}
+
+// loadHTTPFileRequest loads a request from a .http file, found relative to
+// the current directory or else the workspace, with the file's variables
+// filled in.
+func (cm *ConfigManager) loadHTTPFileRequest(path, ref string) (*RequestConfig, error) {
+	if _, err := os.Stat(path); err != nil {
+		path = cm.workspacePath(path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading .http file: %w", err)
+	}
+	file, err := parseHTTPFile(data, filepath.Dir(path))
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", filepath.Base(path), err)
+	}
+	request, err := file.request(ref)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filepath.Base(path), err)
+	}
+
+	// File variables may refer to those defined before them.
+	vars := map[string]string{}
+	for _, v := range file.Variables {
+		vars[v.Name] = substitute(v.Value, vars)
+	}
+	config := request.Config
+	config.Name = request.Name
+	config.URL = substitute(config.URL, vars)
+	if _, ok := vars[httpBaseURLVariable]; !ok {
+		config.URL = strings.TrimPrefix(config.URL, "{{"+httpBaseURLVariable+"}}")
+	}
+	for name, value := range config.Headers {
+		config.Headers[name] = substitute(value, vars)
+	}
+	config.Body = substitute(config.Body, vars)
+	return &config, nil
+}
+
+// ImportHTTPFile imports the requests of a .http file into a collection
+// named after the file, by mapping it onto a Postman collection: file
+// variables become the collection's environment and each environment of a
+// JetBrains http-client.env.json beside the file its own environment file.
+func (cm *ConfigManager) ImportHTTPFile(path string, opts ImportOptions) (*OpenAPIImportResult, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading .http file: %w", err)
+	}
+	file, err := parseHTTPFile(data, filepath.Dir(path))
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", filepath.Base(path), err)
+	}
+	if len(file.Requests) == 0 {
+		return nil, fmt.Errorf("no requests found in %s", filepath.Base(path))
+	}
+
+	collection := &postmanCollection{}
+	collection.Info.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	for _, v := range file.Variables {
+		collection.Variable = append(collection.Variable, postmanKV(v.Name, v.Value))
+	}
+	for _, request := range file.Requests {
+		config := request.Config
+		name := request.Name
+		if name == "" {
+			name = curlRequestName(&config)
+		}
+		item := postmanItem{
+			Name:        name,
+			Description: postmanDescription(config.Description),
+			Request: &postmanRequest{
+				Method: config.Method,
+				URL:    postmanURL{Raw: file.expandBase(config.URL)},
+			},
+		}
+		for _, header := range sortedKeys(config.Headers) {
+			item.Request.Header = append(item.Request.Header, postmanKV(header, config.Headers[header]))
+		}
+		if config.Body != "" {
+			item.Request.Body = &postmanBody{Mode: "raw", Raw: config.Body}
+		}
+		collection.Item = append(collection.Item, item)
+	}
+
+	envs, err := readHTTPClientEnvironments(filepath.Join(filepath.Dir(path), "http-client.env.json"))
+	if err != nil {
+		return nil, err
+	}
+	return cm.importPostman(collection, envs, opts, file.Warnings)
+}
+
+// expandBase fills in the file variables a URL starts with, so URLs built
+// on variables such as {{host}}/users share the base the environment's
+// baseURL is taken from.
+func (f *httpFile) expandBase(rawURL string) string {
+	for range len(f.Variables) {
+		m := postmanLeadingVar.FindStringSubmatch(rawURL)
+		if m == nil {
+			break
+		}
+		defined := false
+		for _, v := range f.Variables {
+			if v.Name == m[1] {
+				rawURL = v.Value + rawURL[len(m[0]):]
+				defined = true
+			}
+		}
+		if !defined {
+			break
+		}
+	}
+	return rawURL
+}
+
+// readHTTPClientEnvironments reads a JetBrains http-client.env.json, which
+// maps environment names to their variables. A missing file has none.
+func readHTTPClientEnvironments(path string) ([]postmanEnvironment, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", filepath.Base(path), err)
+	}
+	var environments map[string]map[string]interface{}
+	if err := json.Unmarshal(data, &environments); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", filepath.Base(path), err)
+	}
+	var envs []postmanEnvironment
+	for _, name := range sortedKeys(environments) {
+		env := postmanEnvironment{Name: name}
+		for _, key := range sortedKeys(environments[name]) {
+			env.Values = append(env.Values, postmanKV(key, jsonValueString(environments[name][key])))
+		}
+		envs = append(envs, env)
+	}
+	return envs, nil
+}
+
+// ExportHTTPFile writes the requests at target (a request, a folder, or ""
+// for the whole workspace) as a .http file. URLs start with {{baseUrl}};
+// with envName, the environment's baseURL and variables are written as file
+// variables, leaving out secrets. Hooks, assertions and extract rules have
+// no .http equivalent and are not exported.
+func (cm *ConfigManager) ExportHTTPFile(target, envName string) (string, error) {
+	paths, err := cm.ResolveRequestTargets(target)
+	if err != nil {
+		return "", err
+	}
+
+	var out strings.Builder
+	if envName != "" {
+		env, err := cm.LoadEnvironment(envName)
+		if err != nil {
+			return "", fmt.Errorf("loading environment: %w", err)
+		}
+		markers, err := cm.secretMarkers()
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&out, "@%s = %s\n", httpBaseURLVariable, strings.TrimSuffix(env.BaseURL, "/"))
+		for _, name := range sortedKeys(env.Variables) {
+			if !isSecretKey(name, markers) {
+				fmt.Fprintf(&out, "@%s = %s\n", name, httpExportValue(env.Variables[name]))
+			}
+		}
+		out.WriteString("\n")
+	}
+
+	used := map[string]int{}
+	for i, path := range paths {
+		config, err := cm.LoadRequest(path)
+		if err != nil {
+			return "", fmt.Errorf("loading %s: %w", path, err)
+		}
+		if config.GRPC != nil || config.WebSocket != nil {
+			continue
+		}
+		if i > 0 {
+			out.WriteString("\n")
+		}
+		fmt.Fprintf(&out, "### %s\n", path)
+		for _, line := range strings.Split(strings.TrimSpace(config.Description), "\n") {
+			if line != "" {
+				fmt.Fprintf(&out, "# %s\n", line)
+			}
+		}
+		fmt.Fprintf(&out, "# @name %s\n", uniqueSegment(used, sanitizeRequestPathSegment(path)))
+		fmt.Fprintf(&out, "%s %s\n", config.Method, httpExportValue(cm.httpExportURL(config)))
+
+		for _, name := range sortedKeys(config.Headers) {
+			if config.Headers[name] != "" {
+				fmt.Fprintf(&out, "%s: %s\n", name, httpExportValue(config.Headers[name]))
+			}
+		}
+		if config.AcceptEncoding != "" {
+			fmt.Fprintf(&out, "Accept-Encoding: %s\n", config.AcceptEncoding)
+		}
+		var cookies []string
+		for _, name := range sortedKeys(config.Cookies) {
+			if config.Cookies[name] != "" {
+				cookies = append(cookies, name+"="+config.Cookies[name])
+			}
+		}
+		if len(cookies) > 0 {
+			fmt.Fprintf(&out, "Cookie: %s\n", httpExportValue(strings.Join(cookies, "; ")))
+		}
+
+		body, file, err := cm.activeBody(path, config)
+		if err != nil {
+			return "", err
+		}
+		if isBinaryBodyFile(file) {
+			body = ""
+		} else if body, err = encodeBody(file, body); err != nil {
+			return "", err
+		}
+		if contentType := bodyContentType(file); contentType != "" && body != "" && !hasHeader(config.Headers, "Content-Type") {
+			fmt.Fprintf(&out, "Content-Type: %s\n", contentType)
+		}
+		if body = strings.TrimSpace(body); body != "" {
+			fmt.Fprintf(&out, "\n%s\n", httpExportValue(body))
+		}
+	}
+	return out.String(), nil
+}
+
+// httpExportURL returns config's URL for a .http file: relative URLs start
+// with {{baseUrl}}, {id} path params take their default or become {{id}}
+// and params are added to the query string.
+func (cm *ConfigManager) httpExportURL(config *RequestConfig) string {
+	rawURL := config.URL
+	if !isAbsoluteURL(rawURL) && !strings.HasPrefix(rawURL, "{{") {
+		rawURL = "{{" + httpBaseURLVariable + "}}" + rawURL
+	}
+	path, query, hasQuery := strings.Cut(rawURL, "?")
+	path = pathParamPattern.ReplaceAllStringFunc(path, func(match string) string {
+		if strings.HasPrefix(match, "{{") {
+			return match
+		}
+		name := match[1 : len(match)-1]
+		if value := config.PathParams[name]; value != "" {
+			return value
+		}
+		return "{{" + name + "}}"
+	})
+	// Params are written unencoded so {{placeholders}} stay readable.
+	var pairs []string
+	if hasQuery && query != "" {
+		pairs = append(pairs, query)
+	}
+	for _, key := range sortedKeys(config.Params) {
+		items, ok := config.Params[key].([]interface{})
+		if !ok {
+			items = []interface{}{config.Params[key]}
+		}
+		for _, item := range items {
+			if value := jsonValueString(item); value != "" {
+				pairs = append(pairs, key+"="+value)
+			}
+		}
+	}
+	if len(pairs) == 0 {
+		return path
+	}
+	return path + "?" + strings.Join(pairs, "&")
+}
+
+// httpExportValue rewrites api-man functions the clients also have as
+// their {{$name}} dynamic values.
+func httpExportValue(s string) string {
+	s = functionPattern.ReplaceAllStringFunc(s, func(match string) string {
+		parts := functionPattern.FindStringSubmatch(match)
+		switch parts[1] {
+		case "uuid", "timestamp", "randomInt":
+			return "{{$" + parts[1] + parts[2] + "}}"
+		}
+		return match
+	})
+	return placeholderPattern.ReplaceAllStringFunc(s, func(match string) string {
+		if name, ok := strings.CutPrefix(placeholderPattern.FindStringSubmatch(match)[1], "env."); ok {
+			return "{{$processEnv " + name + "}}"
+		}
+		return match
+	})
+}
@@ -0,0 +1,216 @@
+package apiman
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testHTTPFile = `@host = https://api.example.com
+@users = {{host}}/users
+
+### List users
+# Lists every user.
+GET {{users}}
+    ?page=2
+    &limit={{$randomInt 1 10}}
+Accept: application/json
+// a commented header line
+# X-Skipped: 1
+
+###
+# @name create-user
+POST {{users}} HTTP/1.1
+Content-Type: application/json
+X-Request-Id: {{$uuid}}
+Authorization: Bearer {{$processEnv API_TOKEN}}
+
+{
+  "name": "{{$dotenv NAME}}",
+  "at": "{{$isoTimestamp}}"
+}
+
+> {% client.global.set("id", response.body.id) %}
+
+### Upload
+PUT /files/1
+Content-Type: application/json
+
+< ./payload.json
+
+### Comments only
+# nothing to send here
+
+###
+DELETE {{host}}/users/1 {{$localDatetime iso8601}}
+`
+
+func TestParseHTTPFile(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "payload.json"), []byte(`{"size":1}`+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	file, err := parseHTTPFile([]byte(strings.ReplaceAll(testHTTPFile, "\n", "\r\n")), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(file.Variables) != 2 || file.Variables[0] != (httpFileVariable{"host", "https://api.example.com"}) || file.Variables[1] != (httpFileVariable{"users", "{{host}}/users"}) {
+		t.Errorf("variables %+v", file.Variables)
+	}
+	if got := strings.Join(file.requestLabels(), ","); got != "List users,create-user,Upload,#4" {
+		t.Fatalf("requests %s", got)
+	}
+
+	list := file.Requests[0].Config
+	if list.Method != "GET" || list.URL != "{{users}}?page=2&limit={{randomInt 1 10}}" || list.Description != "Lists every user." {
+		t.Errorf("list: %s %s %q", list.Method, list.URL, list.Description)
+	}
+	if len(list.Headers) != 1 || list.Headers["Accept"] != "application/json" || list.Body != "" {
+		t.Errorf("list: headers %v, body %q", list.Headers, list.Body)
+	}
+
+	create := file.Requests[1].Config
+	if create.Method != "POST" || create.URL != "{{users}}" {
+		t.Errorf("create: %s %s", create.Method, create.URL)
+	}
+	if create.Headers["X-Request-Id"] != "{{uuid}}" || create.Headers["Authorization"] != "Bearer {{env.API_TOKEN}}" {
+		t.Errorf("create: headers %v", create.Headers)
+	}
+	if want := "{\n  \"name\": \"{{NAME}}\",\n  \"at\": \"{{now}}\"\n}"; create.Body != want {
+		t.Errorf("create: body %q, want %q", create.Body, want)
+	}
+
+	if upload := file.Requests[2].Config; upload.URL != "/files/1" || upload.Body != `{"size":1}` {
+		t.Errorf("upload: %s with body %q", upload.URL, upload.Body)
+	}
+
+	warnings := strings.Join(file.Warnings, "\n")
+	for _, want := range []string{"request create-user: response handlers", "{{$localDatetime}} is not supported"} {
+		if !strings.Contains(warnings, want) {
+			t.Errorf("no warning about %q in:\n%s", want, warnings)
+		}
+	}
+
+	for ref, want := range map[string]string{"create-user": "create-user", "3": "Upload", "4": ""} {
+		request, err := file.request(ref)
+		if err != nil || request.Name != want {
+			t.Errorf("request(%q) = %+v, %v", ref, request, err)
+		}
+	}
+	for _, ref := range []string{"", "missing", "5"} {
+		if _, err := file.request(ref); err == nil {
+			t.Errorf("request(%q) found a request", ref)
+		}
+	}
+
+	if _, err := parseHTTPFile([]byte("GET /a\nnot a header\n"), dir); err == nil {
+		t.Error("malformed header accepted")
+	}
+	if _, err := parseHTTPFile([]byte("POST /a\n\n< missing.json\n"), dir); err == nil {
+		t.Error("missing body file accepted")
+	}
+}
+
+func TestRunHTTPFileRequest(t *testing.T) {
+	var method, path, auth, body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		method, path, auth, body = r.Method, r.URL.RequestURI(), r.Header.Get("Authorization"), string(data)
+	}))
+	defer server.Close()
+
+	root := t.TempDir()
+	cm, err := InitWorkspace(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cm.SaveEnvironment("dev", Environment{BaseURL: server.URL, Variables: map[string]string{"token": "dev-token"}}); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(root, "api.http")
+	content := "@id = 7\n\n### get\nGET {{baseUrl}}/users/{{id}}?q=1\nAuthorization: Bearer {{token}}\n\n### update\nPATCH /users/{{id}}\n\n{\"id\": {{id}}}\n"
+	if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := cm.RunRequest(file+"#get", "dev", RequestOptions{Confirmed: true}); err != nil {
+		t.Fatal(err)
+	}
+	if method != "GET" || path != "/users/7?q=1" || auth != "Bearer dev-token" {
+		t.Errorf("sent %s %s with Authorization %q", method, path, auth)
+	}
+
+	if _, err := cm.RunRequest(file+"#2", "dev", RequestOptions{Confirmed: true}); err != nil {
+		t.Fatal(err)
+	}
+	if method != "PATCH" || path != "/users/7" || body != `{"id": 7}` {
+		t.Errorf("sent %s %s with body %q", method, path, body)
+	}
+
+	if _, err := cm.RunRequest(file, "dev", RequestOptions{Confirmed: true}); err == nil || !strings.Contains(err.Error(), "get, update") {
+		t.Errorf("running a file of two requests without naming one: %v", err)
+	}
+}
+
+func TestExportHTTPFileRoundTrips(t *testing.T) {
+	cm, err := InitWorkspace(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := Environment{BaseURL: "https://api.example.com/", Variables: map[string]string{"tenant": "acme", "api_token": "s3cr3t"}}
+	if err := cm.SaveEnvironment("dev", env); err != nil {
+		t.Fatal(err)
+	}
+	request := RequestConfig{
+		Method:      "POST",
+		URL:         "/tenants/{{tenant}}/users/{id}",
+		Description: "Creates a user.",
+		Headers:     map[string]string{"X-Request-Id": "{{uuid}}", "X-Home": "{{env.HOME}}"},
+		Cookies:     map[string]string{"sid": "abc"},
+		Params:      map[string]interface{}{"tag": []interface{}{"a", "b"}},
+		PathParams:  map[string]string{"id": "42"},
+		Body:        `{"name": "a"}`,
+	}
+	if err := cm.SaveRequest("users/create", request); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := cm.ExportHTTPFile("users/create", "dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out, "s3cr3t") {
+		t.Errorf("secret exported:\n%s", out)
+	}
+	file, err := parseHTTPFile([]byte(out), "")
+	if err != nil {
+		t.Fatalf("parsing the export: %v\n%s", err, out)
+	}
+	if len(file.Requests) != 1 {
+		t.Fatalf("export has %d requests:\n%s", len(file.Requests), out)
+	}
+	got := file.Requests[0].Config
+	if want := "{{baseUrl}}/tenants/{{tenant}}/users/42?tag=a&tag=b"; got.Method != "POST" || got.URL != want {
+		t.Errorf("exported %s %s, want POST %s", got.Method, got.URL, want)
+	}
+	if got.Description != "Creates a user." || got.Body != request.Body {
+		t.Errorf("exported description %q and body %q", got.Description, got.Body)
+	}
+	for name, want := range map[string]string{"X-Request-Id": "{{uuid}}", "X-Home": "{{env.HOME}}", "Cookie": "sid=abc"} {
+		if got.Headers[name] != want {
+			t.Errorf("exported %s: %q, want %q", name, got.Headers[name], want)
+		}
+	}
+	vars := map[string]string{}
+	for _, v := range file.Variables {
+		vars[v.Name] = v.Value
+	}
+	if vars["baseUrl"] != "https://api.example.com" || vars["tenant"] != "acme" || len(vars) != 2 {
+		t.Errorf("exported variables %v", vars)
+	}
+}
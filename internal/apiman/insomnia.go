@@ -0,0 +1,373 @@
+// insomnia.go
+package apiman
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Insomnia v4 export format, limited to the fields api-man maps. Every
+// workspace, folder, request and environment is a flat resource linked to
+// its parent by parentId.
+type insomniaExport struct {
+	Type         string             `json:"_type"`
+	ExportFormat int                `json:"__export_format"`
+	Resources    []insomniaResource `json:"resources"`
+}
+
+type insomniaResource struct {
+	ID          string                 `json:"_id"`
+	Type        string                 `json:"_type"`
+	ParentID    string                 `json:"parentId"`
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	SortKey     float64                `json:"metaSortKey"`
+	Method      string                 `json:"method"`
+	URL         string                 `json:"url"`
+	Body        insomniaBody           `json:"body"`
+	Headers     []insomniaParam        `json:"headers"`
+	Parameters  []insomniaParam        `json:"parameters"`
+	Auth        map[string]interface{} `json:"authentication"`
+	Data        map[string]interface{} `json:"data"`
+	Environment map[string]interface{} `json:"environment"`
+}
+
+type insomniaBody struct {
+	MimeType string          `json:"mimeType"`
+	Text     string          `json:"text"`
+	Params   []insomniaParam `json:"params"`
+	FileName string          `json:"fileName"`
+}
+
+type insomniaParam struct {
+	Name     string `json:"name"`
+	Value    string `json:"value"`
+	Disabled bool   `json:"disabled"`
+	Type     string `json:"type"`
+}
+
+var (
+	insomniaVariable = regexp.MustCompile(`\{\{\s*_\.([^{}\s]+)\s*\}\}`)
+	insomniaTag      = regexp.MustCompile(`\{%.*?%\}`)
+)
+
+// IsInsomniaExport reports whether data looks like an Insomnia v4 export.
+func IsInsomniaExport(data []byte) bool {
+	var probe insomniaExport
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return false
+	}
+	return probe.Type == "export" && probe.ExportFormat == 4
+}
+
+// PreviewInsomniaExport reports what ImportInsomniaExport would do without
+// touching disk.
+func (cm *ConfigManager) PreviewInsomniaExport(data []byte, overrideName string) (*OpenAPIPreview, error) {
+	var export insomniaExport
+	if err := json.Unmarshal(data, &export); err != nil {
+		return nil, fmt.Errorf("parsing Insomnia export: %w", err)
+	}
+	name := "insomnia"
+	requests, workspaces := 0, 0
+	for _, res := range export.Resources {
+		switch res.Type {
+		case "workspace":
+			workspaces++
+			if workspaces == 1 {
+				name = res.Name
+			} else {
+				name = "insomnia"
+			}
+		case "request":
+			requests++
+		}
+	}
+	name = sanitizeRequestPathSegment(name)
+	if strings.TrimSpace(overrideName) != "" {
+		name = sanitizeRequestPathSegment(overrideName)
+	}
+	exists, ownedBySpec := inspectCollectionDir(filepath.Join(cm.requestsDir, name))
+
+	return &OpenAPIPreview{
+		SuggestedCollection: name,
+		Exists:              exists,
+		OwnedBySpec:         ownedBySpec,
+		Operations:          requests,
+		Requests:            requests,
+		Type:                "insomnia",
+	}, nil
+}
+
+// ImportInsomniaExport converts an Insomnia v4 export into the workspace by
+// mapping it onto a Postman collection: folders become subdirectories,
+// requests become request.json files, the base environment becomes the
+// collection's variables and each sub-environment its own environment file.
+// {{ _.name }} references become {{name}}.
+func (cm *ConfigManager) ImportInsomniaExport(data []byte, opts ImportOptions) (*OpenAPIImportResult, error) {
+	var export insomniaExport
+	if err := json.Unmarshal(data, &export); err != nil {
+		return nil, fmt.Errorf("parsing Insomnia export: %w", err)
+	}
+	if export.Type != "export" || export.ExportFormat != 4 {
+		return nil, fmt.Errorf("unsupported Insomnia export (export as Insomnia v4 JSON)")
+	}
+
+	conv := &insomniaConverter{children: map[string][]insomniaResource{}}
+	var workspaces []insomniaResource
+	for _, res := range export.Resources {
+		if res.Type == "workspace" {
+			workspaces = append(workspaces, res)
+		}
+		conv.children[res.ParentID] = append(conv.children[res.ParentID], res)
+	}
+	for id := range conv.children {
+		sort.SliceStable(conv.children[id], func(i, j int) bool {
+			return conv.children[id][i].SortKey < conv.children[id][j].SortKey
+		})
+	}
+	if len(workspaces) == 0 {
+		return nil, fmt.Errorf("no workspace found in Insomnia export")
+	}
+
+	collection := &postmanCollection{}
+	collection.Info.Name = workspaces[0].Name
+	var envs []postmanEnvironment
+	for _, ws := range workspaces {
+		items := conv.items(ws.ID, ws.Name)
+		if len(workspaces) > 1 {
+			// Several workspaces share one collection, one folder each.
+			collection.Info.Name = "insomnia"
+			items = []postmanItem{{Name: ws.Name, Item: items}}
+		}
+		collection.Item = append(collection.Item, items...)
+
+		base, subEnvs := conv.environments(ws.ID)
+		collection.Variable = append(collection.Variable, base...)
+		envs = append(envs, subEnvs...)
+	}
+	collection.Variable = append(collection.Variable, conv.folderVars...)
+
+	return cm.importPostman(collection, envs, opts, conv.warnings)
+}
+
+type insomniaConverter struct {
+	children   map[string][]insomniaResource
+	folderVars []postmanKeyValue
+	warnings   []string
+}
+
+func (c *insomniaConverter) warn(format string, args ...interface{}) {
+	c.warnings = append(c.warnings, fmt.Sprintf(format, args...))
+}
+
+// template converts Insomnia's {{ _.name }} syntax and flags template tags
+// such as response chaining, which have no api-man equivalent.
+func (c *insomniaConverter) template(s, where string) string {
+	if insomniaTag.MatchString(s) {
+		c.warn("%s: template tags like %q were left as-is", where, insomniaTag.FindString(s))
+	}
+	return insomniaVariable.ReplaceAllString(s, "{{$1}}")
+}
+
+func (c *insomniaConverter) items(parentID, path string) []postmanItem {
+	var items []postmanItem
+	for _, res := range c.children[parentID] {
+		where := path + "/" + res.Name
+		switch res.Type {
+		case "request_group":
+			if len(res.Environment) > 0 {
+				c.folderVars = append(c.folderVars, c.keyValues(res.Environment, where)...)
+				c.warn("%s: folder environment merged into the collection variables", where)
+			}
+			items = append(items, postmanItem{
+				Name:        res.Name,
+				Description: postmanDescription(res.Description),
+				Item:        c.items(res.ID, where),
+				Auth:        c.auth(res.Auth, where),
+			})
+		case "request":
+			items = append(items, postmanItem{Name: res.Name, Request: c.request(res, where)})
+		case "grpc_request", "websocket_request":
+			c.warn("%s: %s skipped (not supported)", where, strings.ReplaceAll(res.Type, "_", " "))
+		}
+	}
+	return items
+}
+
+func (c *insomniaConverter) request(res insomniaResource, where string) *postmanRequest {
+	req := &postmanRequest{
+		Method:      res.Method,
+		Description: postmanDescription(res.Description),
+		URL:         postmanURL{Raw: c.template(res.URL, where)},
+		Auth:        c.auth(res.Auth, where),
+	}
+
+	var query []string
+	for _, p := range res.Parameters {
+		if !p.Disabled && p.Name != "" {
+			query = append(query, c.template(p.Name, where)+"="+c.template(p.Value, where))
+		}
+	}
+	if len(query) > 0 {
+		sep := "?"
+		if strings.Contains(req.URL.Raw, "?") {
+			sep = "&"
+		}
+		req.URL.Raw += sep + strings.Join(query, "&")
+	}
+
+	hasContentType := false
+	for _, h := range res.Headers {
+		if h.Disabled || h.Name == "" {
+			continue
+		}
+		hasContentType = hasContentType || strings.EqualFold(h.Name, "Content-Type")
+		req.Header = append(req.Header, postmanKV(h.Name, c.template(h.Value, where)))
+	}
+
+	req.Body = c.body(res.Body, where)
+	if req.Body != nil && req.Body.Mode == "raw" && req.Body.Options.Raw.Language == "" && res.Body.MimeType != "" && !hasContentType {
+		req.Header = append(req.Header, postmanKV("Content-Type", res.Body.MimeType))
+	}
+	return req
+}
+
+func (c *insomniaConverter) body(body insomniaBody, where string) *postmanBody {
+	mediaType, _, _ := mime.ParseMediaType(body.MimeType)
+	switch {
+	case body.MimeType == "" && body.Text == "":
+		return nil
+	case mediaType == "application/x-www-form-urlencoded":
+		pb := &postmanBody{Mode: "urlencoded"}
+		for _, p := range body.Params {
+			if !p.Disabled {
+				pb.URLEncoded = append(pb.URLEncoded, postmanKV(c.template(p.Name, where), c.template(p.Value, where)))
+			}
+		}
+		return pb
+	case mediaType == "multipart/form-data":
+		return &postmanBody{Mode: "formdata"}
+	case body.FileName != "":
+		return &postmanBody{Mode: "file"}
+	case mediaType == "application/graphql":
+		var gql struct {
+			Query     string          `json:"query"`
+			Variables json.RawMessage `json:"variables"`
+		}
+		if err := json.Unmarshal([]byte(body.Text), &gql); err != nil {
+			c.warn("%s: GraphQL body could not be parsed; body left empty", where)
+			return nil
+		}
+		pb := &postmanBody{Mode: "graphql"}
+		pb.GraphQL = &struct {
+			Query     string `json:"query"`
+			Variables string `json:"variables"`
+		}{Query: c.template(gql.Query, where), Variables: c.template(string(gql.Variables), where)}
+		return pb
+	}
+
+	pb := &postmanBody{Mode: "raw", Raw: c.template(body.Text, where)}
+	switch {
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		pb.Options.Raw.Language = "json"
+	case strings.HasSuffix(mediaType, "xml"):
+		pb.Options.Raw.Language = "xml"
+	case mediaType == "text/plain":
+		pb.Options.Raw.Language = "text"
+	}
+	return pb
+}
+
+// auth maps Insomnia authentication onto the Postman auth block; types the
+// Postman importer does not handle produce its "not supported" warning.
+func (c *insomniaConverter) auth(auth map[string]interface{}, where string) *postmanAuth {
+	if len(auth) == 0 || auth["disabled"] == true {
+		return nil
+	}
+	str := func(key string) string {
+		value, _ := auth[key].(string)
+		return c.template(value, where)
+	}
+	authType := str("type")
+	switch authType {
+	case "", "inherit":
+		return nil
+	case "none":
+		return &postmanAuth{Type: "noauth"}
+	case "bearer":
+		if prefix := str("prefix"); prefix != "" && prefix != "Bearer" {
+			c.warn("%s: bearer prefix %q replaced with Bearer", where, prefix)
+		}
+		return &postmanAuth{Type: "bearer", Bearer: []postmanKeyValue{postmanKV("token", str("token"))}}
+	case "basic":
+		return &postmanAuth{Type: "basic", Basic: []postmanKeyValue{
+			postmanKV("username", str("username")),
+			postmanKV("password", str("password")),
+		}}
+	case "apikey":
+		in := "header"
+		if str("addTo") == "queryParams" {
+			in = "query"
+		}
+		return &postmanAuth{Type: "apikey", APIKey: []postmanKeyValue{
+			postmanKV("key", str("key")),
+			postmanKV("value", str("value")),
+			postmanKV("in", in),
+		}}
+	default:
+		return &postmanAuth{Type: authType}
+	}
+}
+
+// environments returns the workspace's base environment as variables and
+// each sub-environment, which inherits from the base, as its own export.
+func (c *insomniaConverter) environments(workspaceID string) ([]postmanKeyValue, []postmanEnvironment) {
+	var base []postmanKeyValue
+	var envs []postmanEnvironment
+	for _, res := range c.children[workspaceID] {
+		if res.Type != "environment" {
+			continue
+		}
+		base = append(base, c.keyValues(res.Data, res.Name)...)
+		for _, sub := range c.children[res.ID] {
+			if sub.Type == "environment" {
+				envs = append(envs, postmanEnvironment{Name: sub.Name, Values: c.keyValues(sub.Data, sub.Name)})
+			}
+		}
+	}
+	return base, envs
+}
+
+// keyValues flattens environment data; nested objects become dotted names,
+// which is how Insomnia templates refer to them.
+func (c *insomniaConverter) keyValues(data map[string]interface{}, where string) []postmanKeyValue {
+	var kvs []postmanKeyValue
+	var walk func(prefix string, value interface{})
+	walk = func(prefix string, value interface{}) {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			for _, key := range sortedKeys(v) {
+				walk(prefix+key+".", v[key])
+			}
+		case string:
+			kvs = append(kvs, postmanKV(strings.TrimSuffix(prefix, "."), c.template(v, where)))
+		default:
+			raw, _ := json.Marshal(v)
+			kvs = append(kvs, postmanKV(strings.TrimSuffix(prefix, "."), string(raw)))
+		}
+	}
+	for _, key := range sortedKeys(data) {
+		walk(key+".", data[key])
+	}
+	return kvs
+}
+
+func postmanKV(key, value string) postmanKeyValue {
+	raw, _ := json.Marshal(value)
+	return postmanKeyValue{Key: key, Value: raw}
+}
@@ -0,0 +1,95 @@
+// jq.go
+package apiman
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/itchyny/gojq"
+)
+
+// EvalQuery runs a jq query (e.g. ".data.items[0].id" or
+// ".items | map(.name)") against a decoded JSON document and returns every
+// value it produces.
+func EvalQuery(doc interface{}, query string) ([]interface{}, error) {
+	parsed, err := gojq.Parse(query)
+	if err != nil {
+		return nil, fmt.Errorf("parsing query %q: %w", query, err)
+	}
+	code, err := gojq.Compile(parsed)
+	if err != nil {
+		return nil, fmt.Errorf("compiling query %q: %w", query, err)
+	}
+	var values []interface{}
+	iter := code.Run(doc)
+	for {
+		value, ok := iter.Next()
+		if !ok {
+			break
+		}
+		if err, ok := value.(error); ok {
+			if err, ok := err.(*gojq.HaltError); ok && err.Value() == nil {
+				break
+			}
+			return nil, fmt.Errorf("query %q: %w", query, err)
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+// checkQuery reports whether query is a valid jq expression, so mistakes
+// are caught before a request is sent.
+func checkQuery(query string) error {
+	if _, err := gojq.Parse(query); err != nil {
+		return fmt.Errorf("parsing query %q: %w", query, err)
+	}
+	return nil
+}
+
+// queryBody runs query against a JSON response body.
+func queryBody(body []byte, query string) ([]interface{}, error) {
+	var doc interface{}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return nil, fmt.Errorf("response body is not JSON: %w", err)
+	}
+	return EvalQuery(doc, query)
+}
+
+// querySingle returns the one value a query is expected to produce for
+// extraction and assertions; several values are returned as an array.
+func querySingle(doc interface{}, query string) (interface{}, error) {
+	values, err := EvalQuery(doc, query)
+	switch {
+	case err != nil:
+		return nil, err
+	case len(values) == 0:
+		return nil, fmt.Errorf("query %q produced no value", query)
+	case len(values) == 1:
+		return values[0], nil
+	}
+	return values, nil
+}
+
+// formatQueryResults formats the values of a --query one per line like
+// jq -r: strings as is and anything else as indented JSON, or every value as
+// compact JSON when compact is set.
+func formatQueryResults(values []interface{}, compact bool) (string, error) {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	if !compact {
+		enc.SetIndent("", "  ")
+	}
+	for _, value := range values {
+		if s, ok := value.(string); ok && !compact {
+			b.WriteString(s + "\n")
+			continue
+		}
+		if err := enc.Encode(value); err != nil {
+			return "", err
+		}
+	}
+	return b.String(), nil
+}
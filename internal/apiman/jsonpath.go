@@ -0,0 +1,313 @@
+// jsonpath.go
+package apiman
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// EvalJSONPath evaluates a JSONPath expression against a decoded JSON
+// document. The supported subset covers what request chaining and
+// assertions need:
+//
+//	$                 the document root
+//	.name / ['name']  object member
+//	[0] / [-1]        array index (negative counts from the end)
+//	[*] / .*          every element or member value
+//	..name            recursive descent
+//	.length()         length of an array, object or string
+//
+// Wildcards and recursive descent return a []interface{} of all matches.
+func EvalJSONPath(doc interface{}, path string) (interface{}, error) {
+	tokens, err := tokenizeJSONPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	current := []interface{}{doc}
+	multi := false
+	for _, tok := range tokens {
+		var next []interface{}
+		switch tok.kind {
+		case jsonPathMember:
+			for _, node := range current {
+				if obj, ok := node.(map[string]interface{}); ok {
+					if v, ok := obj[tok.name]; ok {
+						next = append(next, v)
+					}
+				}
+			}
+		case jsonPathIndex:
+			for _, node := range current {
+				if arr, ok := node.([]interface{}); ok {
+					i := tok.index
+					if i < 0 {
+						i += len(arr)
+					}
+					if i >= 0 && i < len(arr) {
+						next = append(next, arr[i])
+					}
+				}
+			}
+		case jsonPathWildcard:
+			multi = true
+			for _, node := range current {
+				next = append(next, childValues(node)...)
+			}
+		case jsonPathRecursive:
+			multi = true
+			for _, node := range current {
+				next = append(next, recursiveMembers(node, tok.name)...)
+			}
+		case jsonPathLength:
+			for _, node := range current {
+				switch v := node.(type) {
+				case []interface{}:
+					next = append(next, json.Number(strconv.Itoa(len(v))))
+				case map[string]interface{}:
+					next = append(next, json.Number(strconv.Itoa(len(v))))
+				case string:
+					next = append(next, json.Number(strconv.Itoa(len(v))))
+				}
+			}
+		}
+		current = next
+		if len(current) == 0 && !multi {
+			return nil, fmt.Errorf("path %s: no match at %s", path, tok.raw)
+		}
+	}
+
+	if multi {
+		if current == nil {
+			current = []interface{}{}
+		}
+		return current, nil
+	}
+	return current[0], nil
+}
+
+// EvalJSONPathBytes decodes body as JSON and evaluates path against it.
+// Numbers are json.Number values (see decodeJSON).
+func EvalJSONPathBytes(body []byte, path string) (interface{}, error) {
+	doc, err := decodeJSON(body)
+	if err != nil {
+		return nil, fmt.Errorf("response body is not JSON: %w", err)
+	}
+	return EvalJSONPath(doc, path)
+}
+
+// decodeJSON decodes a JSON document like json.Unmarshal, but keeps numbers
+// as json.Number so that IDs beyond 2^53 aren't rounded to the nearest
+// float64.
+func decodeJSON(data []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("invalid data after the top-level value")
+	}
+	return doc, nil
+}
+
+// jsonValuesEqual reports whether a and b encode the same JSON value, with
+// numbers compared by value and exactly: 1, 1.0 and 1e0 are equal, while
+// 9007199254740993 and 9007199254740992 are not.
+func jsonValuesEqual(a, b interface{}) bool {
+	docs := make([]interface{}, 2)
+	for i, v := range []interface{}{a, b} {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return false
+		}
+		if docs[i], err = decodeJSON(data); err != nil {
+			return false
+		}
+	}
+	return equalJSONDocs(docs[0], docs[1])
+}
+
+func equalJSONDocs(a, b interface{}) bool {
+	switch x := a.(type) {
+	case json.Number:
+		y, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		rx, okx := new(big.Rat).SetString(x.String())
+		ry, oky := new(big.Rat).SetString(y.String())
+		return okx && oky && rx.Cmp(ry) == 0
+	case []interface{}:
+		y, ok := b.([]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for i := range x {
+			if !equalJSONDocs(x[i], y[i]) {
+				return false
+			}
+		}
+		return true
+	case map[string]interface{}:
+		y, ok := b.(map[string]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for k, v := range x {
+			if w, ok := y[k]; !ok || !equalJSONDocs(v, w) {
+				return false
+			}
+		}
+		return true
+	}
+	return a == b
+}
+
+// jsonValueString renders an extracted value as a variable: strings are
+// used verbatim, everything else as compact JSON.
+func jsonValueString(v interface{}) string {
+	switch t := v.(type) {
+	case string:
+		return t
+	case nil:
+		return ""
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
+
+type jsonPathKind int
+
+const (
+	jsonPathMember jsonPathKind = iota
+	jsonPathIndex
+	jsonPathWildcard
+	jsonPathRecursive
+	jsonPathLength
+)
+
+type jsonPathToken struct {
+	kind  jsonPathKind
+	name  string
+	index int
+	raw   string
+}
+
+func tokenizeJSONPath(path string) ([]jsonPathToken, error) {
+	p := strings.TrimSpace(path)
+	if !strings.HasPrefix(p, "$") {
+		return nil, fmt.Errorf("path %q must start with $", path)
+	}
+	p = p[1:]
+
+	var tokens []jsonPathToken
+	for len(p) > 0 {
+		switch {
+		case strings.HasPrefix(p, ".."):
+			name, rest := readJSONPathName(p[2:])
+			if name == "" {
+				return nil, fmt.Errorf("path %q: expected name after ..", path)
+			}
+			tokens = append(tokens, jsonPathToken{kind: jsonPathRecursive, name: name, raw: ".." + name})
+			p = rest
+		case strings.HasPrefix(p, ".length()"):
+			tokens = append(tokens, jsonPathToken{kind: jsonPathLength, raw: ".length()"})
+			p = p[len(".length()"):]
+		case strings.HasPrefix(p, ".*"):
+			tokens = append(tokens, jsonPathToken{kind: jsonPathWildcard, raw: ".*"})
+			p = p[2:]
+		case strings.HasPrefix(p, "."):
+			name, rest := readJSONPathName(p[1:])
+			if name == "" {
+				return nil, fmt.Errorf("path %q: expected name after .", path)
+			}
+			tokens = append(tokens, jsonPathToken{kind: jsonPathMember, name: name, raw: "." + name})
+			p = rest
+		case strings.HasPrefix(p, "["):
+			end := strings.Index(p, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("path %q: unterminated [", path)
+			}
+			inner := strings.TrimSpace(p[1:end])
+			raw := p[:end+1]
+			p = p[end+1:]
+			switch {
+			case inner == "*":
+				tokens = append(tokens, jsonPathToken{kind: jsonPathWildcard, raw: raw})
+			case len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0]:
+				tokens = append(tokens, jsonPathToken{kind: jsonPathMember, name: inner[1 : len(inner)-1], raw: raw})
+			default:
+				i, err := strconv.Atoi(inner)
+				if err != nil {
+					return nil, fmt.Errorf("path %q: unsupported selector %s", path, raw)
+				}
+				tokens = append(tokens, jsonPathToken{kind: jsonPathIndex, index: i, raw: raw})
+			}
+		default:
+			return nil, fmt.Errorf("path %q: unexpected %q", path, p)
+		}
+	}
+	return tokens, nil
+}
+
+func readJSONPathName(s string) (string, string) {
+	i := 0
+	for i < len(s) && s[i] != '.' && s[i] != '[' {
+		i++
+	}
+	return s[:i], s[i:]
+}
+
+func childValues(node interface{}) []interface{} {
+	switch v := node.(type) {
+	case []interface{}:
+		return v
+	case map[string]interface{}:
+		keys := sortedKeys(v)
+		out := make([]interface{}, 0, len(keys))
+		for _, k := range keys {
+			out = append(out, v[k])
+		}
+		return out
+	}
+	return nil
+}
+
+func recursiveMembers(node interface{}, name string) []interface{} {
+	var out []interface{}
+	switch v := node.(type) {
+	case map[string]interface{}:
+		if match, ok := v[name]; ok {
+			out = append(out, match)
+		}
+		for _, k := range sortedKeys(v) {
+			out = append(out, recursiveMembers(v[k], name)...)
+		}
+	case []interface{}:
+		for _, child := range v {
+			out = append(out, recursiveMembers(child, name)...)
+		}
+	}
+	return out
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,54 @@
+package apiman
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestEvalJSONPathKeepsLargeNumbers(t *testing.T) {
+	body := []byte(`{"id": 9007199254740993, "price": 12.50, "tags": ["a", "b"]}`)
+	tests := []struct {
+		path, want string
+	}{
+		{"$.id", "9007199254740993"},
+		{"$.price", "12.50"},
+		{"$.tags.length()", "2"},
+	}
+	for _, tt := range tests {
+		value, err := EvalJSONPathBytes(body, tt.path)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.path, err)
+		}
+		if got := jsonValueString(value); got != tt.want {
+			t.Errorf("%s = %s, want %s", tt.path, got, tt.want)
+		}
+	}
+	if _, err := EvalJSONPathBytes([]byte(`{"id": 1} x`), "$.id"); err == nil {
+		t.Error("trailing data accepted")
+	}
+}
+
+func TestJSONPathEqualsComparesNumbersExactly(t *testing.T) {
+	var assertions Assertions
+	data := `{"jsonPath": [
+		{"path": "$.id", "equals": 9007199254740993},
+		{"path": "$.id", "equals": 9007199254740992},
+		{"path": "$.price", "equals": 12.5},
+		{"path": "$.items", "equals": [1, {"n": 2.0}]}
+	]}`
+	if err := json.Unmarshal([]byte(data), &assertions); err != nil {
+		t.Fatal(err)
+	}
+	result := &ExecutionResult{StatusCode: 200, Body: []byte(`{"id": 9007199254740993, "price": 12.50, "items": [1.0, {"n": 2}]}`)}
+	results := assertions.Evaluate(result)
+	want := []bool{true, false, true, true}
+	for i, r := range results {
+		if r.Passed != want[i] {
+			t.Errorf("%s: passed %v, want %v (%s)", r.Name, r.Passed, want[i], r.Message)
+		}
+	}
+
+	if err := json.Unmarshal([]byte(`{"jsonPath": [{"path": "$.id", "equal": 1}]}`), &assertions); err == nil {
+		t.Error("unknown assertion field accepted")
+	}
+}
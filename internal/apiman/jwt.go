@@ -0,0 +1,280 @@
+// jwt.go
+package apiman
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"hash"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// An environment with auth type "jwt" signs a fresh JWT for every request
+// and sends it as a Bearer token:
+//
+//	"auth": {
+//	  "type": "jwt",
+//	  "algorithm": "RS256",
+//	  "keyFile": "keys/service.pem",
+//	  "claims": "{\"iss\": \"api-man\", \"sub\": \"{{serviceId}}\", \"exp\": \"{{now+5m}}\"}",
+//	  "kid": "2024-06"
+//	}
+//
+// The key is a PEM private key (RSA, EC or Ed25519) in keyFile, or for the
+// HS algorithms a shared secret in secret or keyFile. algorithm defaults to
+// HS256 with a secret and otherwise follows the key type. Claims come from
+// claims or claimsFile (a JSON object), both with {{variables}} and
+// {{secret.NAME}} references resolved; iat and exp default to now and five
+// minutes from now. header sends the token in another header, without the
+// "Bearer " prefix.
+const jwtDefaultLifetime = 5 * time.Minute
+
+// jwtHelperPattern matches the claim helpers {{now}}, {{now+5m}},
+// {{exp-30s}} and {{uuid}}.
+var jwtHelperPattern = regexp.MustCompile(`\{\{\s*(?:(now|exp)\s*(?:([+-])\s*(\d+)([smhd]))?|uuid)\s*\}\}`)
+
+// applyJWTAuth signs a JWT from env's auth settings and attaches it to req.
+func (cm *ConfigManager) applyJWTAuth(req *http.Request, env *Environment) error {
+	token, err := cm.signJWT(env.Auth, env.vars, time.Now())
+	if err != nil {
+		return fmt.Errorf("signing jwt: %w", err)
+	}
+	if header := env.Auth["header"]; header != "" && !strings.EqualFold(header, "Authorization") {
+		req.Header.Set(header, token)
+		return nil
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return nil
+}
+
+func (cm *ConfigManager) signJWT(auth, vars map[string]string, now time.Time) (string, error) {
+	claims, err := cm.jwtClaims(auth, vars, now)
+	if err != nil {
+		return "", err
+	}
+
+	var secret []byte
+	var key crypto.Signer
+	switch {
+	case auth["secret"] != "":
+		secret = []byte(auth["secret"])
+	case auth["keyFile"] != "":
+		data, err := os.ReadFile(cm.workspacePath(auth["keyFile"]))
+		if err != nil {
+			return "", fmt.Errorf("reading key file: %w", err)
+		}
+		if block, _ := pem.Decode(data); block != nil {
+			if key, err = parsePrivateKey(block.Bytes); err != nil {
+				return "", fmt.Errorf("parsing key file: %w", err)
+			}
+		} else {
+			secret = []byte(strings.TrimSpace(string(data)))
+		}
+	default:
+		return "", fmt.Errorf("set secret or keyFile")
+	}
+
+	algorithm := auth["algorithm"]
+	if algorithm == "" {
+		algorithm = defaultJWTAlgorithm(key)
+	}
+	header := map[string]string{"alg": algorithm, "typ": "JWT"}
+	if kid := auth["kid"]; kid != "" {
+		header["kid"] = kid
+	}
+
+	headerJSON, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+	claimsJSON, err := json.Marshal(claims)
+	if err != nil {
+		return "", fmt.Errorf("encoding claims: %w", err)
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString(headerJSON) + "." + base64.RawURLEncoding.EncodeToString(claimsJSON)
+	signature, err := jwtSignature(algorithm, signingInput, secret, key)
+	if err != nil {
+		return "", err
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// jwtClaims reads the claims template and expands its helpers. The inline
+// claims were resolved with the environment; a claims file is resolved
+// here against vars and the secrets it references. A string that is a
+// single time helper becomes a number, as JWT dates are.
+func (cm *ConfigManager) jwtClaims(auth, vars map[string]string, now time.Time) (map[string]interface{}, error) {
+	template := auth["claims"]
+	if file := auth["claimsFile"]; file != "" {
+		data, err := os.ReadFile(cm.workspacePath(file))
+		if err != nil {
+			return nil, fmt.Errorf("reading claims file: %w", err)
+		}
+		secrets, err := cm.resolveSecrets(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("claims file: %w", err)
+		}
+		template = substitute(string(data), mergeVariables(vars, secrets))
+	}
+	claims := map[string]interface{}{}
+	if strings.TrimSpace(template) != "" {
+		if err := json.Unmarshal([]byte(template), &claims); err != nil {
+			return nil, fmt.Errorf("parsing claims: %w", err)
+		}
+	}
+	expandJWTHelpers(claims, now)
+	if _, ok := claims["iat"]; !ok {
+		claims["iat"] = now.Unix()
+	}
+	if _, ok := claims["exp"]; !ok {
+		claims["exp"] = now.Add(jwtDefaultLifetime).Unix()
+	}
+	return claims, nil
+}
+
+func expandJWTHelpers(value interface{}, now time.Time) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = expandJWTHelpers(item, now)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = expandJWTHelpers(item, now)
+		}
+	case string:
+		if parts := jwtHelperPattern.FindStringSubmatch(v); parts != nil && parts[0] == v && parts[1] != "" {
+			n, _ := strconv.ParseInt(jwtHelperValue(v, now), 10, 64)
+			return n
+		}
+		return jwtHelperPattern.ReplaceAllStringFunc(v, func(match string) string {
+			return jwtHelperValue(match, now)
+		})
+	}
+	return value
+}
+
+// jwtHelperValue evaluates one helper match.
+func jwtHelperValue(match string, now time.Time) string {
+	parts := jwtHelperPattern.FindStringSubmatch(match)
+	if parts[1] == "" {
+		return newUUID()
+	}
+	t := now
+	if parts[2] != "" {
+		n, _ := strconv.Atoi(parts[3])
+		unit := map[string]time.Duration{"s": time.Second, "m": time.Minute, "h": time.Hour, "d": 24 * time.Hour}[parts[4]]
+		offset := time.Duration(n) * unit
+		if parts[2] == "-" {
+			offset = -offset
+		}
+		t = t.Add(offset)
+	}
+	return strconv.FormatInt(t.Unix(), 10)
+}
+
+func parsePrivateKey(der []byte) (crypto.Signer, error) {
+	if key, err := x509.ParsePKCS8PrivateKey(der); err == nil {
+		if signer, ok := key.(crypto.Signer); ok {
+			return signer, nil
+		}
+		return nil, fmt.Errorf("unsupported key type %T", key)
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(der); err == nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("not a PKCS#8, PKCS#1 or EC private key")
+}
+
+func defaultJWTAlgorithm(key crypto.Signer) string {
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return "RS256"
+	case *ecdsa.PrivateKey:
+		switch k.Curve.Params().BitSize {
+		case 384:
+			return "ES384"
+		case 521:
+			return "ES512"
+		}
+		return "ES256"
+	case ed25519.PrivateKey:
+		return "EdDSA"
+	}
+	return "HS256"
+}
+
+// jwtSignature signs input with the JWS algorithm named alg.
+func jwtSignature(alg, input string, secret []byte, key crypto.Signer) ([]byte, error) {
+	hashes := map[string]crypto.Hash{"256": crypto.SHA256, "384": crypto.SHA384, "512": crypto.SHA512}
+	family, size := alg[:min(2, len(alg))], alg[min(2, len(alg)):]
+	hashFunc, knownSize := hashes[size]
+
+	switch {
+	case family == "HS" && knownSize:
+		if secret == nil {
+			return nil, fmt.Errorf("%s needs a shared secret, not a private key", alg)
+		}
+		newHash := map[crypto.Hash]func() hash.Hash{crypto.SHA256: sha256.New, crypto.SHA384: sha512.New384, crypto.SHA512: sha512.New}[hashFunc]
+		mac := hmac.New(newHash, secret)
+		mac.Write([]byte(input))
+		return mac.Sum(nil), nil
+	case alg == "EdDSA":
+		k, ok := key.(ed25519.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("EdDSA needs an Ed25519 private key")
+		}
+		return ed25519.Sign(k, []byte(input)), nil
+	case !knownSize:
+		return nil, fmt.Errorf("unsupported algorithm %q", alg)
+	}
+
+	digest := hashFunc.New()
+	digest.Write([]byte(input))
+	sum := digest.Sum(nil)
+	switch family {
+	case "RS", "PS":
+		k, ok := key.(*rsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("%s needs an RSA private key", alg)
+		}
+		if family == "PS" {
+			return rsa.SignPSS(rand.Reader, k, hashFunc, sum, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+		}
+		return rsa.SignPKCS1v15(rand.Reader, k, hashFunc, sum)
+	case "ES":
+		k, ok := key.(*ecdsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("%s needs an EC private key", alg)
+		}
+		r, s, err := ecdsa.Sign(rand.Reader, k, sum)
+		if err != nil {
+			return nil, err
+		}
+		// JWS uses the fixed-size concatenation of r and s, not ASN.1.
+		n := (k.Curve.Params().BitSize + 7) / 8
+		signature := make([]byte, 2*n)
+		r.FillBytes(signature[:n])
+		s.FillBytes(signature[n:])
+		return signature, nil
+	}
+	return nil, fmt.Errorf("unsupported algorithm %q", alg)
+}
@@ -0,0 +1,82 @@
+package apiman
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestJWTClaimsResolveVariables(t *testing.T) {
+	t.Setenv(secretsBackendEnv, "file")
+	t.Setenv(secretsPassphraseEnv, "test passphrase")
+
+	var token string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token = strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	}))
+	defer server.Close()
+
+	root := t.TempDir()
+	cm, err := InitWorkspace(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := cm.Secrets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Set("audience", "billing"); err != nil {
+		t.Fatal(err)
+	}
+	claimsFile := `{"sub": "{{serviceId}}", "aud": "{{secret.audience}}", "exp": "{{now+1m}}"}`
+	if err := os.WriteFile(filepath.Join(root, "claims.json"), []byte(claimsFile), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := cm.SaveRequest("me", RequestConfig{Method: "GET", URL: "/me"}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		auth map[string]string
+	}{
+		{"inline", map[string]string{"claims": `{"sub": "{{serviceId}}", "aud": "{{secret.audience}}", "exp": "{{now+1m}}"}`}},
+		{"file", map[string]string{"claimsFile": "claims.json"}},
+	}
+	for _, tt := range tests {
+		auth := map[string]string{"type": "jwt", "secret": "shared"}
+		for key, value := range tt.auth {
+			auth[key] = value
+		}
+		env := Environment{BaseURL: server.URL, Variables: map[string]string{"serviceId": "svc-42"}, Auth: auth}
+		if err := cm.SaveEnvironment("dev", env); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := cm.RunRequest("me", "dev", RequestOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		parts := strings.Split(token, ".")
+		if len(parts) != 3 {
+			t.Fatalf("%s: not a JWT: %q", tt.name, token)
+		}
+		payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		var claims map[string]interface{}
+		if err := json.Unmarshal(payload, &claims); err != nil {
+			t.Fatal(err)
+		}
+		if claims["sub"] != "svc-42" || claims["aud"] != "billing" {
+			t.Errorf("%s: claims %s", tt.name, payload)
+		}
+		if _, ok := claims["exp"].(float64); !ok {
+			t.Errorf("%s: exp %v is not a number", tt.name, claims["exp"])
+		}
+	}
+}
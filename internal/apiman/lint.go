@@ -0,0 +1,468 @@
+// lint.go
+package apiman
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Lint issue severities. Errors break requests when they run; warnings are
+// likely mistakes.
+const (
+	LintError   = "error"
+	LintWarning = "warning"
+)
+
+// LintIssue is one problem found by LintWorkspace.
+type LintIssue struct {
+	File     string `json:"file"`
+	Severity string `json:"severity"`
+	// Check names the rule that failed: schema, shadowed, active-body,
+	// unused-body, duplicate-name, variables, extends or files.
+	Check   string `json:"check"`
+	Message string `json:"message"`
+}
+
+// LintReport is the result of LintWorkspace.
+type LintReport struct {
+	Files  int         `json:"files"`
+	Issues []LintIssue `json:"issues"`
+}
+
+// Count returns the number of issues with the given severity.
+func (r *LintReport) Count(severity string) int {
+	n := 0
+	for _, issue := range r.Issues {
+		if issue.Severity == severity {
+			n++
+		}
+	}
+	return n
+}
+
+func (r *LintReport) add(file, severity, check, format string, args ...interface{}) {
+	r.Issues = append(r.Issues, LintIssue{File: file, Severity: severity, Check: check, Message: fmt.Sprintf(format, args...)})
+}
+
+// LintWorkspace checks every request, environment and collection
+// environments file without sending anything. Files that don't parse, have
+// unknown fields or a newer schema version are errors, as are request files
+// shadowed by another file for the same request, an activeBody naming a
+// missing body template, and environments whose extends or envFile can't be
+// resolved. Body templates no request selects, requests sharing a name in
+// one directory, and {{variables}} no environment, .env file, data file,
+// stored or extracted variable, prompt or template function provides are
+// warnings.
+func (cm *ConfigManager) LintWorkspace() (*LintReport, error) {
+	report := &LintReport{Issues: []LintIssue{}}
+	files, err := cm.workspaceFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	var parsed []lintFile
+	var requests []lintRequest
+	var environments []*Environment
+	for _, file := range files {
+		rel := cm.relativePath(file.path)
+		report.Files++
+		_, value, err := file.read(rel)
+		if err != nil {
+			report.add(rel, LintError, "schema", "%v", err)
+			continue
+		}
+		parsed = append(parsed, lintFile{file: file, rel: rel, value: value})
+		switch v := value.(type) {
+		case *RequestConfig:
+			requests = append(requests, lintRequest{file: file, rel: rel, config: v})
+			cm.lintRequestFile(report, file, rel, v)
+		case *Environment:
+			environments = append(environments, v)
+			cm.lintEnvironmentFile(report, file, rel, v)
+		case *RequestDefaults:
+			lintDefaultsFile(report, rel, v)
+		case *CollectionEnvironments:
+			for _, name := range sortedKeys(v.Environments) {
+				env := v.Environments[name]
+				environments = append(environments, &env)
+			}
+		}
+	}
+	lintDuplicateNames(report, requests)
+
+	known, err := cm.knownVariables(files, environments, requests)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range parsed {
+		switch v := f.value.(type) {
+		case *RequestConfig:
+			cm.lintRequestVariables(report, f.file, f.rel, v, known)
+		case *Environment:
+			lintUnknownVariables(report, f.rel, "", environmentText(v), known)
+		case *RequestDefaults:
+			for _, name := range sortedKeys(v.Headers) {
+				lintUnknownVariables(report, f.rel, "", v.Headers[name], known)
+			}
+		case *CollectionEnvironments:
+			for _, name := range sortedKeys(v.Environments) {
+				env := v.Environments[name]
+				lintUnknownVariables(report, f.rel, name+": ", environmentText(&env), known)
+			}
+		}
+	}
+	sort.SliceStable(report.Issues, func(i, j int) bool { return report.Issues[i].File < report.Issues[j].File })
+	return report, nil
+}
+
+type lintFile struct {
+	file  workspaceFile
+	rel   string
+	value interface{}
+}
+
+type lintRequest struct {
+	file   workspaceFile
+	rel    string
+	config *RequestConfig
+}
+
+// lintRequestFile checks a request's own file and its body templates.
+func (cm *ConfigManager) lintRequestFile(report *LintReport, file workspaceFile, rel string, config *RequestConfig) {
+	for _, other := range cm.requestFileCandidates(file.name) {
+		if other != file.path {
+			report.add(cm.relativePath(other), LintError, "shadowed", "ignored: %s is used for request %s", rel, file.name)
+		}
+	}
+	if config.Method != "" && !validMethod(config.Method) {
+		report.add(rel, LintError, "schema", "invalid method %q", config.Method)
+	}
+	if config.Timeout < 0 {
+		report.add(rel, LintError, "schema", "timeout is negative")
+	}
+	if config.Retry != nil {
+		if err := config.Retry.validate(); err != nil {
+			report.add(rel, LintError, "schema", "%v", err)
+		}
+	}
+	if config.AcceptEncoding != "" {
+		if err := validAcceptEncoding(config.AcceptEncoding); err != nil {
+			report.add(rel, LintError, "schema", "%v", err)
+		}
+	}
+	for _, script := range requestScripts(config) {
+		if err := checkScript(script.source); err != nil {
+			report.add(rel, LintError, "script", "%s: %v", script.field, err)
+		}
+	}
+
+	bodies, err := cm.requestBodies(file.name)
+	if err != nil {
+		report.add(rel, LintError, "schema", "listing body templates: %v", err)
+		return
+	}
+	active := []string{config.ActiveBody}
+	for _, name := range sortedKeys(config.EnvOverrides) {
+		if _, err := cm.LoadEnvironment(name); err != nil {
+			report.add(rel, LintWarning, "env-override", "envOverrides has no environment %q to apply to", name)
+		}
+		if override := config.EnvOverrides[name]; override != nil {
+			active = append(active, override.ActiveBody)
+			if override.Timeout < 0 {
+				report.add(rel, LintError, "schema", "envOverrides.%s: timeout is negative", name)
+			}
+		}
+	}
+	for _, name := range active {
+		if name != "" && name != defaultBodyName && !slices.Contains(bodies, name) {
+			report.add(rel, LintError, "active-body", "activeBody %q has no body template (%s)", name,
+				cm.relativePath(filepath.Join(cm.requestsDir, file.name, bodyFileName(name))))
+		}
+	}
+	for _, body := range bodies {
+		if slices.Contains(active, body) {
+			continue
+		}
+		bodyRel := cm.relativePath(filepath.Join(cm.requestsDir, file.name, bodyFileName(body)))
+		if err := ValidateBodyName(body); err != nil {
+			report.add(bodyRel, LintWarning, "unused-body", "body template can't be selected: %v", err)
+			continue
+		}
+		report.add(bodyRel, LintWarning, "unused-body", "body template is not the activeBody of %s", file.name)
+	}
+}
+
+// lintDefaultsFile checks a _defaults.json file.
+func lintDefaultsFile(report *LintReport, rel string, defaults *RequestDefaults) {
+	if defaults.Timeout < 0 {
+		report.add(rel, LintError, "schema", "timeout is negative")
+	}
+	if defaults.Retry != nil {
+		if err := defaults.Retry.validate(); err != nil {
+			report.add(rel, LintError, "schema", "%v", err)
+		}
+	}
+}
+
+// inlineScript is a piece of a request's inline JavaScript and the field
+// holding it.
+type inlineScript struct {
+	field, source string
+}
+
+// requestScripts returns the inline JavaScript of a request.
+func requestScripts(config *RequestConfig) []inlineScript {
+	var scripts []inlineScript
+	if config.Assertions != nil {
+		for i, expression := range config.Assertions.Expect {
+			scripts = append(scripts, inlineScript{fmt.Sprintf("assertions.expect[%d]", i), expression})
+		}
+	}
+	for _, name := range sortedKeys(config.Extract) {
+		if source, ok := strings.CutPrefix(config.Extract[name], scriptPrefix); ok {
+			scripts = append(scripts, inlineScript{"extract." + name, source})
+		}
+	}
+	if config.Hooks != nil {
+		for _, hook := range []struct{ field, command string }{{"hooks.pre", config.Hooks.Pre}, {"hooks.post", config.Hooks.Post}} {
+			if source, ok := strings.CutPrefix(hook.command, scriptPrefix); ok {
+				scripts = append(scripts, inlineScript{hook.field, source})
+			}
+		}
+	}
+	return scripts
+}
+
+// requestFileCandidates returns every existing file that could hold the
+// request at requestPath; requestFile uses the first.
+func (cm *ConfigManager) requestFileCandidates(requestPath string) []string {
+	var files []string
+	for _, base := range []string{
+		filepath.Join(cm.requestsDir, requestPath),
+		filepath.Join(cm.requestsDir, requestPath, "request"),
+	} {
+		for _, ext := range configExtensions {
+			if fileExists(base + ext) {
+				files = append(files, base+ext)
+			}
+		}
+	}
+	return files
+}
+
+// requestBodies returns the names of a request's body templates, as listed
+// by ListBodies.
+func (cm *ConfigManager) requestBodies(requestPath string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(cm.requestsDir, requestPath))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var bodies []string
+	for _, entry := range entries {
+		if name, ok := bodyTemplateName(entry.Name()); ok && !entry.IsDir() {
+			bodies = append(bodies, name)
+		}
+	}
+	return bodies, nil
+}
+
+// lintEnvironmentFile checks that an environment's extends chain and the
+// files it names can be found.
+func (cm *ConfigManager) lintEnvironmentFile(report *LintReport, file workspaceFile, rel string, env *Environment) {
+	if env.Extends != "" {
+		if _, err := cm.LoadEnvironment(file.name); err != nil {
+			report.add(rel, LintError, "extends", "%v", err)
+		}
+	}
+	for _, ref := range []struct{ field, path string }{
+		{"envFile", env.EnvFile},
+		{"caCertFile", env.CACertFile},
+		{"clientCertFile", env.ClientCertFile},
+		{"clientKeyFile", env.ClientKeyFile},
+	} {
+		if ref.path == "" || strings.Contains(ref.path, "{{") {
+			continue
+		}
+		if _, err := os.Stat(cm.workspacePath(ref.path)); err != nil {
+			report.add(rel, LintError, "files", "%s %s not found", ref.field, ref.path)
+		}
+	}
+}
+
+// lintDuplicateNames warns about requests in the same directory sharing a
+// name, which list, the TUI and the web UI can't tell apart.
+func lintDuplicateNames(report *LintReport, requests []lintRequest) {
+	seen := make(map[string]lintRequest)
+	for _, request := range requests {
+		name := strings.TrimSpace(request.config.Name)
+		if name == "" {
+			continue
+		}
+		key := path.Dir(request.file.name) + "\x00" + strings.ToLower(name)
+		if first, ok := seen[key]; ok {
+			report.add(request.rel, LintWarning, "duplicate-name", "name %q is also used by %s", name, first.file.name)
+			continue
+		}
+		seen[key] = request
+	}
+}
+
+// knownVariables returns every variable a request could be run with: the
+// variables of each environment and its .env file, stored and extracted
+// variables, and the variables set by chains.
+func (cm *ConfigManager) knownVariables(files []workspaceFile, environments []*Environment, requests []lintRequest) (map[string]bool, error) {
+	known := make(map[string]bool)
+	addKeys := func(values map[string]string) {
+		for key := range values {
+			known[key] = true
+		}
+	}
+	for _, env := range environments {
+		addKeys(env.Variables)
+		if env.EnvFile != "" {
+			if dotenv, err := readDotenv(cm.workspacePath(env.EnvFile)); err == nil {
+				addKeys(dotenv)
+			}
+		}
+	}
+	for _, file := range files {
+		if file.kind != configEnvironment {
+			continue
+		}
+		stored, err := cm.StoredVariables(file.name)
+		if err != nil {
+			return nil, err
+		}
+		addKeys(stored)
+	}
+	for _, request := range requests {
+		addKeys(request.config.Extract)
+		for _, rule := range request.config.Capture {
+			if rule.Var != "" {
+				known[rule.Var] = true
+			}
+		}
+		datasets, _ := cm.ListRequestData(request.file.name)
+		for _, name := range datasets {
+			if data, err := cm.LoadRequestData(request.file.name, name); err == nil {
+				addKeys(data)
+			}
+		}
+	}
+
+	chains, err := cm.ListChains()
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range chains {
+		chain, err := cm.LoadChain(name)
+		if err != nil {
+			continue
+		}
+		addKeys(chain.Variables)
+		for _, step := range chain.Steps {
+			addKeys(step.Variables)
+			addKeys(step.Extract)
+		}
+	}
+	return known, nil
+}
+
+// lintRequestVariables warns about placeholders in a request and its body
+// templates that nothing defines. Requests with a pre-request hook are
+// skipped, since the hook may set any variable.
+func (cm *ConfigManager) lintRequestVariables(report *LintReport, file workspaceFile, rel string, config *RequestConfig, known map[string]bool) {
+	if config.Hooks != nil && config.Hooks.Pre != "" {
+		return
+	}
+	withPrompts := known
+	if len(config.Prompts) > 0 {
+		withPrompts = make(map[string]bool, len(known)+len(config.Prompts))
+		for key := range known {
+			withPrompts[key] = true
+		}
+		for _, prompt := range config.Prompts {
+			withPrompts[prompt.Name] = true
+		}
+	}
+
+	lintUnknownVariables(report, rel, "", requestText(config), withPrompts)
+	bodies, _ := cm.requestBodies(file.name)
+	for _, body := range bodies {
+		bodyPath := filepath.Join(cm.requestsDir, file.name, bodyFileName(body))
+		content, err := os.ReadFile(bodyPath)
+		if err != nil || isBinaryBodyFile(bodyPath) {
+			continue
+		}
+		lintUnknownVariables(report, cm.relativePath(bodyPath), "", string(content), withPrompts)
+	}
+}
+
+// lintUnknownVariables adds a warning for each distinct placeholder in text
+// that isn't known, a template function, a secret, an external secret or a
+// process environment variable.
+func lintUnknownVariables(report *LintReport, rel, prefix, text string, known map[string]bool) {
+	var reported []string
+	for _, match := range placeholderPattern.FindAllStringSubmatch(text, -1) {
+		name := match[1]
+		if known[name] || templateFunctions[name] != nil || slices.Contains(reported, name) ||
+			strings.HasPrefix(name, "secret.") || strings.HasPrefix(name, "env.") || isExternalSecret(name) {
+			continue
+		}
+		reported = append(reported, name)
+		report.add(rel, LintWarning, "variables", "%s{{%s}} is not defined in any environment", prefix, name)
+	}
+}
+
+// requestText returns the parts of a request, including its environment
+// overrides, that are interpolated.
+func requestText(config *RequestConfig) string {
+	params, _ := json.Marshal(config.Params)
+	parts := []string{config.URL, config.Body, string(params)}
+	for _, values := range []map[string]string{config.Headers, config.Cookies, config.PathParams} {
+		for _, key := range sortedKeys(values) {
+			parts = append(parts, values[key])
+		}
+	}
+	for _, name := range sortedKeys(config.EnvOverrides) {
+		if override := config.EnvOverrides[name]; override != nil {
+			parts = append(parts, requestText(&RequestConfig{
+				URL:        override.URL,
+				Body:       override.Body,
+				Headers:    override.Headers,
+				Cookies:    override.Cookies,
+				Params:     override.Params,
+				PathParams: override.PathParams,
+			}))
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// environmentText returns the parts of an environment that are
+// interpolated. JWT claims are left out: they use helpers of their own such
+// as {{now+5m}}.
+func environmentText(env *Environment) string {
+	params, _ := json.Marshal(env.Params)
+	parts := []string{env.BaseURL, env.HTTPProxy, env.HTTPSProxy, env.CACertFile, env.ClientCertFile, env.ClientKeyFile, env.ConnectTo, string(params)}
+	for _, values := range []map[string]string{env.Headers, env.Cookies, env.Variables} {
+		for _, key := range sortedKeys(values) {
+			parts = append(parts, values[key])
+		}
+	}
+	for _, key := range sortedKeys(env.Auth) {
+		if key != "claims" {
+			parts = append(parts, env.Auth[key])
+		}
+	}
+	return strings.Join(parts, "\n")
+}
@@ -0,0 +1,132 @@
+// list.go
+package apiman
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// listFormats are the formats of api-man list: the grouped tree, a table
+// with one request per row, or JSON.
+var listFormats = []string{"tree", "table", "json"}
+
+// listSorts are the orders of api-man list.
+var listSorts = []string{"name", "method", "modified"}
+
+// ListOptions narrows and orders the requests api-man list shows.
+type ListOptions struct {
+	// Method keeps only requests with this method, in any case.
+	Method string
+	// Tag keeps only requests with this tag.
+	Tag string
+	// Filter keeps only requests whose path, name, URL or description
+	// contains it, in any case.
+	Filter string
+	// Sort is one of listSorts; "" sorts by name (path). "modified" puts
+	// the most recently changed request first.
+	Sort string
+}
+
+// listEntry is a request as api-man list shows it.
+type listEntry struct {
+	requestEntry
+	Bodies   int       `json:"bodies"`
+	Modified time.Time `json:"modified"`
+	LastRun  *lastRun  `json:"lastRun,omitempty"`
+}
+
+// lastRun is the most recent history entry of a request.
+type lastRun struct {
+	Environment string    `json:"environment,omitempty"`
+	Status      string    `json:"status,omitempty"`
+	StatusCode  int       `json:"statusCode,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	Timestamp   time.Time `json:"timestamp"`
+}
+
+// Label is the outcome of the run: its status, or "error", and the
+// environment it ran against.
+func (r *lastRun) Label() string {
+	label := r.Status
+	if r.Error != "" || label == "" {
+		label = "error"
+	}
+	if r.Environment != "" {
+		label += " [" + r.Environment + "]"
+	}
+	return label
+}
+
+// listRequestEntries returns the requests matching opts in opts.Sort order,
+// with their body template counts, modification times and last runs.
+func (cm *ConfigManager) listRequestEntries(opts ListOptions) ([]listEntry, error) {
+	index, err := cm.requestIndex()
+	if err != nil {
+		return nil, err
+	}
+	lastRuns, err := cm.lastRuns()
+	if err != nil {
+		return nil, err
+	}
+
+	filter := strings.ToLower(opts.Filter)
+	entries := make([]listEntry, 0, len(index))
+	for _, request := range index {
+		if opts.Method != "" && !strings.EqualFold(request.Method, opts.Method) {
+			continue
+		}
+		if opts.Tag != "" && !slices.Contains(request.Tags, opts.Tag) {
+			continue
+		}
+		if filter != "" && !slices.ContainsFunc([]string{request.Path, request.Name, request.URL, request.Description}, func(field string) bool {
+			return strings.Contains(strings.ToLower(field), filter)
+		}) {
+			continue
+		}
+		entry := listEntry{requestEntry: request, LastRun: lastRuns[request.Path]}
+		if bodies, err := cm.requestBodies(request.Path); err == nil {
+			entry.Bodies = len(bodies)
+		}
+		if file, ok := cm.requestFile(request.Path); ok {
+			if info, err := os.Stat(file); err == nil {
+				entry.Modified = info.ModTime()
+			}
+		}
+		entries = append(entries, entry)
+	}
+
+	switch opts.Sort {
+	case "method":
+		slices.SortStableFunc(entries, func(a, b listEntry) int {
+			return strings.Compare(a.Method, b.Method)
+		})
+	case "modified":
+		slices.SortStableFunc(entries, func(a, b listEntry) int {
+			return b.Modified.Compare(a.Modified)
+		})
+	}
+	return entries, nil
+}
+
+// lastRuns returns the newest history entry of every request that has one,
+// by request path.
+func (cm *ConfigManager) lastRuns() (map[string]*lastRun, error) {
+	history, err := cm.latestRuns(HistoryQuery{})
+	if err != nil {
+		return nil, fmt.Errorf("reading history: %w", err)
+	}
+	runs := make(map[string]*lastRun)
+	for _, entry := range history {
+		runs[entry.Request] = &lastRun{
+			Environment: entry.Environment,
+			Status:      entry.Status,
+			StatusCode:  entry.StatusCode,
+			Error:       entry.Error,
+			Timestamp:   entry.Timestamp,
+		}
+	}
+	return runs, nil
+}
@@ -0,0 +1,266 @@
+// loadtest.go
+package apiman
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// LoadTestOptions controls how hard and how long RunLoadTest drives a
+// request. The run stops at Duration or, when Requests is set, after that
+// many requests, whichever comes first.
+type LoadTestOptions struct {
+	Concurrency int
+	Duration    time.Duration
+	Requests    int
+}
+
+// LoadTestReport summarises a load test run.
+type LoadTestReport struct {
+	Request     string         `json:"request"`
+	Environment string         `json:"environment"`
+	Concurrency int            `json:"concurrency"`
+	Elapsed     time.Duration  `json:"elapsed"`
+	Total       int            `json:"total"`
+	Failed      int            `json:"failed"`
+	StatusCodes map[int]int    `json:"statusCodes"`
+	Errors      map[string]int `json:"errors,omitempty"`
+	Min         time.Duration  `json:"min"`
+	Mean        time.Duration  `json:"mean"`
+	P50         time.Duration  `json:"p50"`
+	P95         time.Duration  `json:"p95"`
+	P99         time.Duration  `json:"p99"`
+	Max         time.Duration  `json:"max"`
+}
+
+// Throughput reports completed requests per second.
+func (r *LoadTestReport) Throughput() float64 {
+	if r.Elapsed <= 0 {
+		return 0
+	}
+	return float64(r.Total) / r.Elapsed.Seconds()
+}
+
+// ErrorRate reports the fraction of requests that failed to complete or
+// returned a 4xx/5xx status.
+func (r *LoadTestReport) ErrorRate() float64 {
+	if r.Total == 0 {
+		return 0
+	}
+	return float64(r.Failed) / float64(r.Total)
+}
+
+type loadSample struct {
+	startedAt     time.Time
+	latency       time.Duration
+	statusCode    int
+	responseBytes int64
+	err           error
+}
+
+// RunLoadTest resolves the request once, exactly as ExecuteRequest would
+// (variables, secrets, auth and the pre-request hook), then replays it from
+// a pool of workers sharing one keep-alive transport. Individual executions
+// are not added to the history and post-response hooks do not run, but each
+// is recorded in the metrics.
+func (cm *ConfigManager) RunLoadTest(requestPath, envName string, opts LoadTestOptions) (*LoadTestReport, error) {
+	if opts.Concurrency < 1 {
+		return nil, fmt.Errorf("concurrency must be at least 1")
+	}
+	if opts.Duration <= 0 {
+		return nil, fmt.Errorf("duration must be positive")
+	}
+
+	prepared, err := cm.PrepareRequest(requestPath, envName, RequestOptions{})
+	if err != nil {
+		return nil, err
+	}
+	if prepared.Config.GRPC != nil {
+		return nil, errGRPCRequest(requestPath)
+	}
+	if prepared.Config.WebSocket != nil {
+		return nil, errWebSocketRequest(requestPath)
+	}
+	if err := cm.confirmPrepared(prepared, false); err != nil {
+		return nil, err
+	}
+	body, err := readRequestBody(prepared.Request)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if proxied, ok := unwrapTransport(prepared.Transport); ok {
+		transport = proxied.Clone()
+	}
+	transport.MaxIdleConns = opts.Concurrency
+	transport.MaxIdleConnsPerHost = opts.Concurrency
+	client := prepared.Client()
+	client.Transport = transport
+	if auth, ok := prepared.Transport.(authTransport); ok {
+		client.Transport = auth.withBase(transport)
+	}
+	defer transport.CloseIdleConnections()
+
+	metrics, err := cm.openMetricsLog()
+	if err != nil {
+		return nil, err
+	}
+	defer metrics.Close()
+	var metricsErr sync.Once
+
+	ctx, cancel := context.WithTimeout(context.Background(), opts.Duration)
+	defer cancel()
+
+	var issued atomic.Int64
+	samples := make([][]loadSample, opts.Concurrency)
+	var wg sync.WaitGroup
+	start := time.Now()
+	for worker := range opts.Concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				if opts.Requests > 0 && issued.Add(1) > int64(opts.Requests) {
+					return
+				}
+				sample := sendLoadRequest(ctx, client, prepared, body)
+				// Requests cut off by the end of the run are not failures.
+				if ctx.Err() != nil && errors.Is(sample.err, context.DeadlineExceeded) {
+					return
+				}
+				samples[worker] = append(samples[worker], sample)
+				if err := metrics.add(sample.metric(prepared, envName, len(body))); err != nil {
+					metricsErr.Do(func() { fmt.Fprintf(os.Stderr, "Warning: %v\n", err) })
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	report := &LoadTestReport{
+		Request:     requestPath,
+		Environment: envName,
+		Concurrency: opts.Concurrency,
+		Elapsed:     time.Since(start),
+		StatusCodes: make(map[int]int),
+		Errors:      make(map[string]int),
+	}
+	var latencies []time.Duration
+	var sum time.Duration
+	for _, workerSamples := range samples {
+		for _, sample := range workerSamples {
+			report.Total++
+			if sample.err != nil {
+				report.Failed++
+				report.Errors[sample.err.Error()]++
+				continue
+			}
+			report.StatusCodes[sample.statusCode]++
+			if sample.statusCode >= 400 {
+				report.Failed++
+			}
+			latencies = append(latencies, sample.latency)
+			sum += sample.latency
+		}
+	}
+	if len(latencies) > 0 {
+		sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+		report.Min = latencies[0]
+		report.Max = latencies[len(latencies)-1]
+		report.Mean = sum / time.Duration(len(latencies))
+		report.P50 = percentile(latencies, 50)
+		report.P95 = percentile(latencies, 95)
+		report.P99 = percentile(latencies, 99)
+	}
+	return report, nil
+}
+
+func sendLoadRequest(ctx context.Context, client *http.Client, prepared *PreparedRequest, body string) loadSample {
+	req := prepared.Request.Clone(ctx)
+	setRequestBody(req, body)
+	// Each sample is its own span; they aren't exported.
+	if prepared.Trace != nil {
+		req.Header.Set("traceparent", prepared.Trace.child().Header())
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return loadSample{startedAt: start, latency: time.Since(start), err: err}
+	}
+	n, err := io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return loadSample{startedAt: start, latency: time.Since(start), err: fmt.Errorf("reading response body: %w", err)}
+	}
+	return loadSample{startedAt: start, latency: time.Since(start), statusCode: resp.StatusCode, responseBytes: n}
+}
+
+// metric returns the metric record of a sample of prepared.
+func (s loadSample) metric(prepared *PreparedRequest, envName string, requestBytes int) *MetricRecord {
+	record := &MetricRecord{
+		Timestamp:     s.startedAt,
+		Request:       prepared.Path,
+		Environment:   envName,
+		Method:        prepared.Request.Method,
+		Source:        metricSourceLoad,
+		StatusCode:    s.statusCode,
+		DurationMS:    durationMS(s.latency),
+		RequestBytes:  requestBytes,
+		ResponseBytes: int(s.responseBytes),
+	}
+	if s.err != nil {
+		record.Error = s.err.Error()
+	}
+	return record
+}
+
+// percentile returns the nearest-rank percentile of sorted latencies.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	return sorted[max(rank-1, 0)]
+}
+
+// PrintLoadTestReport writes a human-readable summary of report to out.
+func PrintLoadTestReport(out io.Writer, report *LoadTestReport) {
+	fmt.Fprintf(out, "Requests:    %d in %s (%.1f req/s)\n", report.Total, report.Elapsed.Round(time.Millisecond), report.Throughput())
+	fmt.Fprintf(out, "Errors:      %d (%.2f%%)\n", report.Failed, report.ErrorRate()*100)
+	if len(report.StatusCodes) > 0 {
+		fmt.Fprintf(out, "Latency:     min %s  p50 %s  p95 %s  p99 %s  max %s  mean %s\n",
+			formatLatency(report.Min), formatLatency(report.P50), formatLatency(report.P95),
+			formatLatency(report.P99), formatLatency(report.Max), formatLatency(report.Mean))
+
+		fmt.Fprintln(out, "Status codes:")
+		codes := make([]int, 0, len(report.StatusCodes))
+		for code := range report.StatusCodes {
+			codes = append(codes, code)
+		}
+		sort.Ints(codes)
+		for _, code := range codes {
+			fmt.Fprintf(out, "  %d  %d\n", code, report.StatusCodes[code])
+		}
+	}
+	if len(report.Errors) > 0 {
+		fmt.Fprintln(out, "Request errors:")
+		for _, message := range sortedKeys(report.Errors) {
+			fmt.Fprintf(out, "  %d  %s\n", report.Errors[message], message)
+		}
+	}
+}
+
+func formatLatency(d time.Duration) string {
+	if d < time.Millisecond {
+		return d.Round(time.Microsecond).String()
+	}
+	return d.Round(100 * time.Microsecond).String()
+}
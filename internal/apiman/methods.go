@@ -0,0 +1,92 @@
+// methods.go
+package apiman
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// Requests may use any method, not just the ones OpenAPI has fields for:
+// WebDAV's PROPFIND and REPORT, a CDN's PURGE. OpenAPI 3.2 describes those
+// in a path's additionalOperations, which generate reads and openapi export
+// writes.
+
+// additionalOperationsKey is the path item member holding the operations of
+// methods other than the standard ones, keyed by method.
+const additionalOperationsKey = "additionalOperations"
+
+// isStandardMethod reports whether method has its own field in an OpenAPI
+// path item.
+func isStandardMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+// validMethod reports whether method is an HTTP token (RFC 9110), which
+// is all a method has to be.
+func validMethod(method string) bool {
+	if method == "" {
+		return false
+	}
+	for _, c := range method {
+		if c > 0x7e || c <= ' ' || strings.ContainsRune(`"(),/:;<=>?@[\]{}`, c) {
+			return false
+		}
+	}
+	return true
+}
+
+// pathOperations returns the operations of pathItem by method, including
+// those in its additionalOperations.
+func pathOperations(pathItem *openapi3.PathItem) map[string]*openapi3.Operation {
+	operations := pathItem.Operations()
+	raw, ok := pathItem.Extensions[additionalOperationsKey]
+	if !ok {
+		return operations
+	}
+	// Extensions hold decoded JSON, so go through JSON to get operations.
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return operations
+	}
+	var additional map[string]*openapi3.Operation
+	if json.Unmarshal(data, &additional) != nil {
+		return operations
+	}
+	for method, operation := range additional {
+		if operation != nil && validMethod(method) && !isStandardMethod(method) {
+			operations[method] = operation
+		}
+	}
+	return operations
+}
+
+// addOperation adds operation to spec under path and method, putting
+// methods without their own field in additionalOperations.
+func addOperation(spec *openapi3.T, path, method string, operation *openapi3.Operation) {
+	if isStandardMethod(method) {
+		spec.AddOperation(path, method, operation)
+		return
+	}
+	pathItem := spec.Paths.Value(path)
+	if pathItem == nil {
+		pathItem = &openapi3.PathItem{}
+		spec.Paths.Set(path, pathItem)
+	}
+	if pathItem.Extensions == nil {
+		pathItem.Extensions = make(map[string]interface{})
+	}
+	additional, _ := pathItem.Extensions[additionalOperationsKey].(map[string]*openapi3.Operation)
+	if additional == nil {
+		additional = make(map[string]*openapi3.Operation)
+		pathItem.Extensions[additionalOperationsKey] = additional
+	}
+	additional[method] = operation
+}
@@ -0,0 +1,325 @@
+// metrics.go
+package apiman
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metric sources: what sent a request.
+const (
+	metricSourceRun  = "run"
+	metricSourceLoad = "load"
+	metricSourceWeb  = "web"
+)
+
+// metricBuckets are the upper bounds, in seconds, of the request duration
+// histogram api-man metrics serve exposes.
+var metricBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// MetricRecord is one request execution as stored, one JSON object per line,
+// in .api-man/metrics.jsonl. Unlike the history it keeps no headers or
+// bodies and is never pruned, so long watch and load sessions can be
+// graphed; api-man metrics clear empties it.
+type MetricRecord struct {
+	Timestamp   time.Time `json:"timestamp"`
+	Request     string    `json:"request,omitempty"`
+	Environment string    `json:"environment,omitempty"`
+	Method      string    `json:"method"`
+	// Source is what sent the request: run (any CLI command), load (a
+	// load test sample) or web (the web UI).
+	Source     string `json:"source"`
+	StatusCode int    `json:"statusCode,omitempty"`
+	// Error is why no response was received.
+	Error         string  `json:"error,omitempty"`
+	DurationMS    float64 `json:"durationMs"`
+	RequestBytes  int     `json:"requestBytes"`
+	ResponseBytes int     `json:"responseBytes"`
+}
+
+// Status is the record's status code, or "error" when no response was
+// received.
+func (r *MetricRecord) Status() string {
+	if r.Error != "" || r.StatusCode == 0 {
+		return "error"
+	}
+	return strconv.Itoa(r.StatusCode)
+}
+
+func (cm *ConfigManager) metricsFile() string {
+	return filepath.Join(cm.stateDir(), "metrics.jsonl")
+}
+
+// executionMetric returns the metric record of a completed execution.
+func executionMetric(result *ExecutionResult, source string) *MetricRecord {
+	return &MetricRecord{
+		Timestamp:     result.StartedAt,
+		Request:       result.Request,
+		Environment:   result.Environment,
+		Method:        result.Method,
+		Source:        source,
+		StatusCode:    result.StatusCode,
+		DurationMS:    durationMS(result.Duration),
+		RequestBytes:  len(result.RequestBody),
+		ResponseBytes: len(result.Body),
+	}
+}
+
+// recordFailedMetric records a request that got no response.
+func (cm *ConfigManager) recordFailedMetric(prepared *PreparedRequest, envName string, startedAt time.Time, err error) {
+	body, _ := readRequestBody(prepared.Request)
+	cm.recordMetric(&MetricRecord{
+		Timestamp:    startedAt,
+		Request:      prepared.Path,
+		Environment:  envName,
+		Method:       prepared.Request.Method,
+		Source:       metricSourceRun,
+		Error:        err.Error(),
+		DurationMS:   durationMS(time.Since(startedAt)),
+		RequestBytes: len(body),
+	})
+}
+
+// durationMS returns d in milliseconds, keeping fractions.
+func durationMS(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// metricsLog appends records to the metrics file. It is safe for use by
+// concurrent goroutines: each record is written in one call.
+type metricsLog struct {
+	file *os.File
+}
+
+// openMetricsLog opens the metrics file for appending, creating it if
+// needed.
+func (cm *ConfigManager) openMetricsLog() (*metricsLog, error) {
+	if err := os.MkdirAll(cm.stateDir(), 0755); err != nil {
+		return nil, fmt.Errorf("creating state directory: %w", err)
+	}
+	file, err := os.OpenFile(cm.metricsFile(), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("opening metrics file: %w", err)
+	}
+	return &metricsLog{file: file}, nil
+}
+
+func (l *metricsLog) add(record *MetricRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if _, err := l.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("writing metrics: %w", err)
+	}
+	return nil
+}
+
+func (l *metricsLog) Close() error {
+	return l.file.Close()
+}
+
+// recordMetric appends record to the metrics file. Like the history, a
+// failure to write metrics never fails the request itself, so errors are
+// only reported.
+func (cm *ConfigManager) recordMetric(record *MetricRecord) {
+	metrics, err := cm.openMetricsLog()
+	if err == nil {
+		err = metrics.add(record)
+		metrics.Close()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+}
+
+// ClearMetrics empties the metrics file and reports how many records it
+// held.
+func (cm *ConfigManager) ClearMetrics() (int, error) {
+	count := 0
+	_, err := readMetrics(cm.metricsFile(), 0, func(*MetricRecord) { count++ })
+	if err != nil && !os.IsNotExist(err) {
+		return 0, err
+	}
+	if err := os.Remove(cm.metricsFile()); err != nil && !os.IsNotExist(err) {
+		return 0, fmt.Errorf("clearing metrics: %w", err)
+	}
+	return count, nil
+}
+
+// readMetrics calls fn with each complete record of the metrics file path
+// from byte offset on and returns the offset after the last one, where
+// the next read picks up. Lines that aren't records are skipped.
+func readMetrics(path string, offset int64, fn func(*MetricRecord)) (int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return offset, err
+	}
+	defer file.Close()
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return offset, fmt.Errorf("reading metrics: %w", err)
+	}
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			// A partial line is still being written; read it next time.
+			return offset, nil
+		}
+		if err != nil {
+			return offset, fmt.Errorf("reading metrics: %w", err)
+		}
+		offset += int64(len(line))
+		var record MetricRecord
+		if json.Unmarshal(line, &record) == nil {
+			fn(&record)
+		}
+	}
+}
+
+// metricSeries identifies one time series: the labels of a record.
+type metricSeries struct {
+	request, environment, method, source, status string
+}
+
+// metricStats accumulates the records of one series.
+type metricStats struct {
+	count         int
+	buckets       []int
+	durationSum   float64
+	requestBytes  int64
+	responseBytes int64
+	last          time.Time
+}
+
+// MetricsCollector aggregates the metrics file for Prometheus. Each scrape
+// reads only the records added since the last one, so counters keep
+// growing as Prometheus expects; they start over when the file is cleared.
+type MetricsCollector struct {
+	path   string
+	mu     sync.Mutex
+	offset int64
+	series map[metricSeries]*metricStats
+}
+
+// NewMetricsCollector returns a collector for the workspace's metrics file.
+func (cm *ConfigManager) NewMetricsCollector() *MetricsCollector {
+	return &MetricsCollector{path: cm.metricsFile(), series: make(map[metricSeries]*metricStats)}
+}
+
+// update reads the records added since the last call.
+func (c *MetricsCollector) update() error {
+	if info, err := os.Stat(c.path); err != nil || info.Size() < c.offset {
+		c.offset = 0
+		clear(c.series)
+	}
+	offset, err := readMetrics(c.path, c.offset, c.add)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	c.offset = offset
+	return nil
+}
+
+func (c *MetricsCollector) add(record *MetricRecord) {
+	key := metricSeries{record.Request, record.Environment, record.Method, record.Source, record.Status()}
+	stats := c.series[key]
+	if stats == nil {
+		stats = &metricStats{buckets: make([]int, len(metricBuckets))}
+		c.series[key] = stats
+	}
+	seconds := record.DurationMS / 1000
+	stats.count++
+	stats.durationSum += seconds
+	for i, bound := range metricBuckets {
+		if seconds <= bound {
+			stats.buckets[i]++
+		}
+	}
+	stats.requestBytes += int64(record.RequestBytes)
+	stats.responseBytes += int64(record.ResponseBytes)
+	if record.Timestamp.After(stats.last) {
+		stats.last = record.Timestamp
+	}
+}
+
+// WriteTo writes the metrics in the Prometheus text exposition format.
+func (c *MetricsCollector) WriteTo(w io.Writer) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.update(); err != nil {
+		return 0, err
+	}
+	keys := make([]metricSeries, 0, len(c.series))
+	for key := range c.series {
+		keys = append(keys, key)
+	}
+	slices.SortFunc(keys, func(a, b metricSeries) int {
+		return strings.Compare(a.labels(), b.labels())
+	})
+
+	var out strings.Builder
+	family := func(name, kind, help string, write func(key metricSeries, stats *metricStats)) {
+		fmt.Fprintf(&out, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+		for _, key := range keys {
+			write(key, c.series[key])
+		}
+	}
+	family("apiman_requests_total", "counter", "Requests executed.", func(key metricSeries, stats *metricStats) {
+		fmt.Fprintf(&out, "apiman_requests_total{%s} %d\n", key.labels(), stats.count)
+	})
+	family("apiman_request_duration_seconds", "histogram", "Time from sending a request to reading its whole response.", func(key metricSeries, stats *metricStats) {
+		for i, bound := range metricBuckets {
+			fmt.Fprintf(&out, "apiman_request_duration_seconds_bucket{%s,le=\"%s\"} %d\n", key.labels(), strconv.FormatFloat(bound, 'g', -1, 64), stats.buckets[i])
+		}
+		fmt.Fprintf(&out, "apiman_request_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", key.labels(), stats.count)
+		fmt.Fprintf(&out, "apiman_request_duration_seconds_sum{%s} %s\n", key.labels(), strconv.FormatFloat(stats.durationSum, 'g', -1, 64))
+		fmt.Fprintf(&out, "apiman_request_duration_seconds_count{%s} %d\n", key.labels(), stats.count)
+	})
+	family("apiman_request_size_bytes_total", "counter", "Request body bytes sent.", func(key metricSeries, stats *metricStats) {
+		fmt.Fprintf(&out, "apiman_request_size_bytes_total{%s} %d\n", key.labels(), stats.requestBytes)
+	})
+	family("apiman_response_size_bytes_total", "counter", "Response body bytes received.", func(key metricSeries, stats *metricStats) {
+		fmt.Fprintf(&out, "apiman_response_size_bytes_total{%s} %d\n", key.labels(), stats.responseBytes)
+	})
+	family("apiman_last_request_timestamp_seconds", "gauge", "When the latest request started, in Unix time.", func(key metricSeries, stats *metricStats) {
+		fmt.Fprintf(&out, "apiman_last_request_timestamp_seconds{%s} %d\n", key.labels(), stats.last.Unix())
+	})
+	n, err := io.WriteString(w, out.String())
+	return int64(n), err
+}
+
+// labelEscaper escapes label values as the exposition format requires.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// labels formats the series' labels for the exposition format.
+func (s metricSeries) labels() string {
+	pairs := [][2]string{
+		{"request", s.request}, {"environment", s.environment}, {"method", s.method},
+		{"source", s.source}, {"status", s.status},
+	}
+	parts := make([]string, len(pairs))
+	for i, pair := range pairs {
+		parts[i] = pair[0] + `="` + labelEscaper.Replace(pair[1]) + `"`
+	}
+	return strings.Join(parts, ",")
+}
+
+// ServeHTTP serves the metrics to a Prometheus scrape.
+func (c *MetricsCollector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if _, err := c.WriteTo(w); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,478 @@
+// migrate.go
+package apiman
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CurrentSchemaVersion is stamped into every request, environment and
+// collection environments file written by this build. Files without a
+// schemaVersion are treated as version 0 and upgraded by `api-man migrate`.
+//
+// Version history:
+//
+//	0: unversioned; flat requests/<path>.json files allowed, body templates
+//	   sometimes stored as a wrapped RequestConfig instead of raw content.
+//	1: schemaVersion field; every request lives at requests/<path>/request.json.
+const CurrentSchemaVersion = 1
+
+// SchemaVersionError is returned when a file was written by a newer api-man
+// than the one reading it.
+type SchemaVersionError struct {
+	Path    string
+	Version int
+}
+
+func (e *SchemaVersionError) Error() string {
+	return fmt.Sprintf("%s uses schema version %d; this api-man supports up to %d", e.Path, e.Version, CurrentSchemaVersion)
+}
+
+func checkSchemaVersion(path string, version int) error {
+	if version > CurrentSchemaVersion {
+		return &SchemaVersionError{Path: path, Version: version}
+	}
+	return nil
+}
+
+// requestConfigFields is RequestConfig without its methods, so that
+// LegacyRequestConfig can embed it and override some of its fields.
+type requestConfigFields RequestConfig
+
+// LegacyRequestConfig is the permissive shape used to read request files
+// written before schemaVersion existed. Older hand-written files stored the
+// body as a JSON object rather than a string and the timeout as a duration
+// string ("30s") rather than seconds. Every other field is read as it is in
+// RequestConfig, so upgrading keeps assertions, retries and the like.
+type LegacyRequestConfig struct {
+	requestConfigFields
+	Body    json.RawMessage `json:"body"`
+	Timeout json.RawMessage `json:"timeout"`
+}
+
+// Upgrade converts a legacy request into the current RequestConfig shape.
+func (l *LegacyRequestConfig) Upgrade() (RequestConfig, error) {
+	config := RequestConfig(l.requestConfigFields)
+	config.SchemaVersion = CurrentSchemaVersion
+	config.Method = strings.ToUpper(config.Method)
+	if config.Headers == nil {
+		config.Headers = make(map[string]string)
+	}
+	if config.Cookies == nil {
+		config.Cookies = make(map[string]string)
+	}
+
+	body, err := legacyBodyString(l.Body)
+	if err != nil {
+		return RequestConfig{}, err
+	}
+	config.Body = body
+
+	timeout, err := legacyTimeoutSeconds(l.Timeout)
+	if err != nil {
+		return RequestConfig{}, err
+	}
+	config.Timeout = timeout
+
+	return config, nil
+}
+
+func legacyBodyString(raw json.RawMessage) (string, error) {
+	trimmed := strings.TrimSpace(string(raw))
+	if trimmed == "" || trimmed == "null" {
+		return "", nil
+	}
+	if trimmed[0] == '"' {
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return "", fmt.Errorf("parsing body: %w", err)
+		}
+		return s, nil
+	}
+	// Object or array bodies are re-indented and stored as a string.
+	var v interface{}
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return "", fmt.Errorf("parsing body: %w", err)
+	}
+	pretty, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("formatting body: %w", err)
+	}
+	return string(pretty), nil
+}
+
+func legacyTimeoutSeconds(raw json.RawMessage) (int, error) {
+	trimmed := strings.TrimSpace(string(raw))
+	if trimmed == "" || trimmed == "null" {
+		return 0, nil
+	}
+	if trimmed[0] != '"' {
+		var n float64
+		if err := json.Unmarshal(raw, &n); err != nil {
+			return 0, fmt.Errorf("parsing timeout: %w", err)
+		}
+		return int(n), nil
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return 0, fmt.Errorf("parsing timeout: %w", err)
+	}
+	if n, err := strconv.Atoi(s); err == nil {
+		return n, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("parsing timeout %q: %w", s, err)
+	}
+	return int(d.Seconds()), nil
+}
+
+// parseLegacyRequest decodes unversioned request file contents that failed
+// strict parsing, upgrading them in memory so older workspaces keep working
+// before `api-man migrate` has been run.
+func parseLegacyRequest(data []byte) (*RequestConfig, error) {
+	var legacy LegacyRequestConfig
+	if err := json.Unmarshal(data, &legacy); err != nil {
+		return nil, err
+	}
+	config, err := legacy.Upgrade()
+	if err != nil {
+		return nil, err
+	}
+	config.SchemaVersion = legacy.SchemaVersion
+	return &config, nil
+}
+
+// MigrationReport lists the changes made (or planned, for dry runs) by
+// MigrateWorkspace.
+type MigrationReport struct {
+	BackupDir string   `json:"backupDir,omitempty"`
+	Actions   []string `json:"actions"`
+	Warnings  []string `json:"warnings,omitempty"`
+}
+
+type migrationStep struct {
+	description string
+	apply       func() error
+}
+
+// MigrateWorkspace upgrades every request, environment and collection
+// environments file to CurrentSchemaVersion. Flat requests/<path>.json files
+// move to requests/<path>/request.json, wrapped body templates are unwrapped
+// to their raw content, and every file is rewritten with a schemaVersion.
+// Unless dryRun is set, requests/ and environments/ are copied into
+// .api-man/backups/<timestamp>/ before anything is modified.
+func (cm *ConfigManager) MigrateWorkspace(dryRun bool) (*MigrationReport, error) {
+	report := &MigrationReport{Actions: []string{}}
+
+	steps, warnings, err := cm.planMigration()
+	if err != nil {
+		return nil, err
+	}
+	report.Warnings = warnings
+
+	for _, step := range steps {
+		report.Actions = append(report.Actions, step.description)
+	}
+	if dryRun || len(steps) == 0 {
+		return report, nil
+	}
+
+	backupDir := filepath.Join(cm.stateDir(), "backups", "migrate-"+time.Now().UTC().Format("20060102T150405Z"))
+	for _, dir := range []string{cm.requestsDir, cm.environmentsDir} {
+		if err := copyTree(dir, filepath.Join(backupDir, filepath.Base(dir))); err != nil {
+			return nil, fmt.Errorf("backing up %s: %w", dir, err)
+		}
+	}
+	report.BackupDir = cm.relativePath(backupDir)
+
+	for _, step := range steps {
+		if err := step.apply(); err != nil {
+			return report, fmt.Errorf("%s: %w", step.description, err)
+		}
+	}
+	return report, nil
+}
+
+func (cm *ConfigManager) planMigration() ([]migrationStep, []string, error) {
+	var steps []migrationStep
+	var warnings []string
+
+	var files []string
+	err := filepath.WalkDir(cm.requestsDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && strings.HasSuffix(d.Name(), ".json") {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("scanning requests: %w", err)
+	}
+	sort.Strings(files)
+
+	for _, path := range files {
+		dir := filepath.Dir(path)
+		name := filepath.Base(path)
+		rel := cm.relativePath(path)
+
+		switch {
+		case name == "environments.json":
+			step, err := planCollectionEnvironmentsMigration(path, rel)
+			if err != nil {
+				warnings = append(warnings, err.Error())
+			} else if step != nil {
+				steps = append(steps, *step)
+			}
+
+		case name == "openapi.json", name == defaultsFileName, isRequestFolder(dir):
+			continue
+
+		case name == "request.json":
+			step, err := planRequestMigration(path, path, rel)
+			if err != nil {
+				warnings = append(warnings, err.Error())
+			} else if step != nil {
+				steps = append(steps, *step)
+			}
+
+		case fileExists(filepath.Join(dir, "request.json")):
+			step, err := planBodyMigration(path, rel)
+			if err != nil {
+				warnings = append(warnings, err.Error())
+			} else if step != nil {
+				steps = append(steps, *step)
+			}
+
+		default:
+			// Flat layout: requests/<path>.json becomes requests/<path>/request.json.
+			target := filepath.Join(strings.TrimSuffix(path, ".json"), "request.json")
+			if fileExists(target) {
+				warnings = append(warnings, fmt.Sprintf("%s: skipped, %s already exists", rel, cm.relativePath(target)))
+				continue
+			}
+			step, err := planRequestMigration(path, target, rel)
+			if err != nil {
+				warnings = append(warnings, err.Error())
+				continue
+			}
+			rewrite := step.apply
+			step.description = fmt.Sprintf("move %s -> %s", rel, cm.relativePath(target))
+			step.apply = func() error {
+				if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+					return err
+				}
+				if err := rewrite(); err != nil {
+					return err
+				}
+				return os.Remove(path)
+			}
+			steps = append(steps, *step)
+		}
+	}
+
+	envFiles, err := os.ReadDir(cm.environmentsDir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading environments directory: %w", err)
+	}
+	for _, entry := range envFiles {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		path := filepath.Join(cm.environmentsDir, entry.Name())
+		step, err := planEnvironmentMigration(path, cm.relativePath(path))
+		if err != nil {
+			warnings = append(warnings, err.Error())
+		} else if step != nil {
+			steps = append(steps, *step)
+		}
+	}
+
+	return steps, warnings, nil
+}
+
+// planRequestMigration reads a request file at src and, when it needs an
+// upgrade or a move, returns a step that writes the current format to dst.
+// The returned step is nil only when src == dst and nothing needs changing.
+func planRequestMigration(src, dst, rel string) (*migrationStep, error) {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", rel, err)
+	}
+	var legacy LegacyRequestConfig
+	if err := json.Unmarshal(data, &legacy); err != nil {
+		return nil, fmt.Errorf("%s: not a request file: %w", rel, err)
+	}
+	if err := checkSchemaVersion(rel, legacy.SchemaVersion); err != nil {
+		return nil, err
+	}
+	if legacy.SchemaVersion == CurrentSchemaVersion && src == dst {
+		return nil, nil
+	}
+	config, err := legacy.Upgrade()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", rel, err)
+	}
+	return &migrationStep{
+		description: fmt.Sprintf("upgrade %s to schema version %d", rel, CurrentSchemaVersion),
+		apply: func() error {
+			return writeJSONFile(dst, config)
+		},
+	}, nil
+}
+
+// planBodyMigration unwraps body templates that were saved as a whole
+// RequestConfig (an empty request with only "body" set) into raw content.
+func planBodyMigration(path, rel string) (*migrationStep, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", rel, err)
+	}
+	var wrapped map[string]json.RawMessage
+	if err := json.Unmarshal(data, &wrapped); err != nil {
+		// Not JSON or not an object: leave raw body templates untouched.
+		return nil, nil
+	}
+	if !isWrappedBodyTemplate(wrapped) {
+		return nil, nil
+	}
+	body, err := legacyBodyString(wrapped["body"])
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", rel, err)
+	}
+	return &migrationStep{
+		description: fmt.Sprintf("unwrap body template %s", rel),
+		apply: func() error {
+			return os.WriteFile(path, []byte(body), 0644)
+		},
+	}, nil
+}
+
+// isWrappedBodyTemplate reports whether a decoded body file is really an
+// empty RequestConfig carrying the template in its "body" field.
+func isWrappedBodyTemplate(fields map[string]json.RawMessage) bool {
+	if _, ok := fields["body"]; !ok {
+		return false
+	}
+	for _, key := range []string{"method", "url"} {
+		raw, ok := fields[key]
+		if !ok {
+			return false
+		}
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil || s != "" {
+			return false
+		}
+	}
+	return true
+}
+
+func planEnvironmentMigration(path, rel string) (*migrationStep, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", rel, err)
+	}
+	var env Environment
+	if err := json.Unmarshal(data, &env); err != nil {
+		return nil, fmt.Errorf("%s: parsing environment: %w", rel, err)
+	}
+	if err := checkSchemaVersion(rel, env.SchemaVersion); err != nil {
+		return nil, err
+	}
+	if env.SchemaVersion == CurrentSchemaVersion {
+		return nil, nil
+	}
+	env.SchemaVersion = CurrentSchemaVersion
+	return &migrationStep{
+		description: fmt.Sprintf("upgrade %s to schema version %d", rel, CurrentSchemaVersion),
+		apply: func() error {
+			return writeJSONFile(path, env)
+		},
+	}, nil
+}
+
+func planCollectionEnvironmentsMigration(path, rel string) (*migrationStep, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", rel, err)
+	}
+	var ce CollectionEnvironments
+	if err := json.Unmarshal(data, &ce); err != nil {
+		return nil, fmt.Errorf("%s: parsing collection environments: %w", rel, err)
+	}
+	if err := checkSchemaVersion(rel, ce.SchemaVersion); err != nil {
+		return nil, err
+	}
+	if ce.SchemaVersion == CurrentSchemaVersion {
+		return nil, nil
+	}
+	ce.SchemaVersion = CurrentSchemaVersion
+	return &migrationStep{
+		description: fmt.Sprintf("upgrade %s to schema version %d", rel, CurrentSchemaVersion),
+		apply: func() error {
+			return writeJSONFile(path, ce)
+		},
+	}, nil
+}
+
+func writeJSONFile(path string, v interface{}) error {
+	data, err := encodeConfig(path, v)
+	if err != nil {
+		return fmt.Errorf("marshaling %s: %w", filepath.Base(path), err)
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+func fileExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
+
+func dirExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// copyTree copies every regular file under src into dst, preserving the
+// relative layout.
+func copyTree(src, dst string) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if d.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(target, data, 0644)
+	})
+}
+
+// relativePath renders a workspace path relative to the workspace root for
+// display, falling back to the absolute path.
+func (cm *ConfigManager) relativePath(path string) string {
+	if rel, err := filepath.Rel(cm.configDir, path); err == nil {
+		return rel
+	}
+	return path
+}
@@ -0,0 +1,123 @@
+package apiman
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const legacyRequest = `{
+  "name": "Create user",
+  "method": "post",
+  "url": "/users",
+  "body": {"name": "ada"},
+  "timeout": "5",
+  "assertions": {"status": 201},
+  "retry": {"attempts": 3}
+}`
+
+func writeRequestFile(t *testing.T, cm *ConfigManager, rel, contents string) {
+	t.Helper()
+	file := filepath.Join(cm.requestsDir, rel)
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestInitWorkspaceNeedsNoMigration(t *testing.T) {
+	cm, err := InitWorkspace(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := cm.MigrateWorkspace(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Actions) != 0 || len(report.Warnings) != 0 {
+		t.Errorf("fresh workspace needs migrating: %v %v", report.Actions, report.Warnings)
+	}
+	if !fileExists(filepath.Join(cm.requestsDir, "users", "get-users", "request.json")) {
+		t.Error("sample request not saved as users/get-users/request.json")
+	}
+}
+
+func TestLoadRequestUpgradesLegacyFields(t *testing.T) {
+	cm, err := InitWorkspace(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeRequestFile(t, cm, "legacy.json", legacyRequest)
+
+	config, err := cm.LoadRequest("legacy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Method != "POST" || config.Timeout != 5 {
+		t.Errorf("method %q, timeout %d; want POST, 5", config.Method, config.Timeout)
+	}
+	var body map[string]string
+	if err := json.Unmarshal([]byte(config.Body), &body); err != nil || body["name"] != "ada" {
+		t.Errorf("body %q not upgraded to a string", config.Body)
+	}
+	if config.Assertions == nil || config.Assertions.Status != 201 {
+		t.Errorf("assertions dropped: %+v", config.Assertions)
+	}
+	if config.Retry == nil || config.Retry.Attempts != 3 {
+		t.Errorf("retry dropped: %+v", config.Retry)
+	}
+}
+
+func TestLoadRequestRejectsLegacyShapesWhenVersioned(t *testing.T) {
+	cm, err := InitWorkspace(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeRequestFile(t, cm, "versioned/request.json", `{"schemaVersion": 1, "method": "GET", "url": "/", "timeout": "5"}`)
+	if _, err := cm.LoadRequest("versioned"); err == nil {
+		t.Error("versioned request with a string timeout loaded without error")
+	}
+
+	writeRequestFile(t, cm, "newer/request.json", `{"schemaVersion": 99, "method": "GET", "url": "/", "timeout": "5"}`)
+	_, err = cm.LoadRequest("newer")
+	if _, ok := err.(*SchemaVersionError); !ok {
+		t.Errorf("got %v, want a SchemaVersionError", err)
+	}
+}
+
+func TestMigrateKeepsRequestFields(t *testing.T) {
+	cm, err := InitWorkspace(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeRequestFile(t, cm, "legacy.json", legacyRequest)
+
+	report, err := cm.MigrateWorkspace(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Actions) != 1 {
+		t.Fatalf("actions %v, want one move", report.Actions)
+	}
+	if fileExists(filepath.Join(cm.requestsDir, "legacy.json")) {
+		t.Error("flat file left behind")
+	}
+
+	data, err := os.ReadFile(filepath.Join(cm.requestsDir, "legacy", "request.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var config RequestConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		t.Fatalf("migrated request doesn't parse strictly: %v", err)
+	}
+	if config.SchemaVersion != CurrentSchemaVersion || config.Timeout != 5 {
+		t.Errorf("schemaVersion %d, timeout %d", config.SchemaVersion, config.Timeout)
+	}
+	if config.Assertions == nil || config.Assertions.Status != 201 || config.Retry == nil {
+		t.Errorf("migration dropped fields: %s", data)
+	}
+}
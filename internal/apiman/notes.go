@@ -0,0 +1,192 @@
+// notes.go
+package apiman
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// What a request's definition can't say lives beside it in
+// requests/<path>/: notes.md, free-form Markdown about the endpoint's quirks,
+// and examples/, responses saved from the history under a name. Both are
+// versioned with the request, travel with it on mv and cp, and are shown by
+// api-man docs generate.
+
+const (
+	// requestNotesFile holds a request's notes.
+	requestNotesFile = "notes.md"
+	// requestExamplesDir is the folder of a request's saved examples, one
+	// JSON file per example.
+	requestExamplesDir = "examples"
+)
+
+// RequestExample is a response saved under a name to document a request.
+// Request headers aren't kept, and neither is Set-Cookie, so an example
+// holds no credentials beyond what the response body has.
+type RequestExample struct {
+	Name        string      `json:"name"`
+	Environment string      `json:"environment,omitempty"`
+	Method      string      `json:"method"`
+	URL         string      `json:"url"`
+	RequestBody string      `json:"requestBody,omitempty"`
+	Status      string      `json:"status"`
+	StatusCode  int         `json:"statusCode"`
+	Headers     http.Header `json:"headers,omitempty"`
+	Body        string      `json:"body,omitempty"`
+	DurationMS  int64       `json:"durationMs"`
+	// Timestamp is when the response was received, and HistoryID the
+	// history entry it was saved from.
+	Timestamp time.Time `json:"timestamp"`
+	HistoryID string    `json:"historyId,omitempty"`
+}
+
+func (cm *ConfigManager) notesFile(requestPath string) string {
+	return filepath.Join(cm.requestsDir, requestPath, requestNotesFile)
+}
+
+func (cm *ConfigManager) examplesPath(requestPath string) string {
+	return filepath.Join(cm.requestsDir, requestPath, requestExamplesDir)
+}
+
+// LoadNotes returns the notes of requestPath, "" when it has none.
+func (cm *ConfigManager) LoadNotes(requestPath string) (string, error) {
+	if _, ok := cm.requestFile(requestPath); !ok {
+		return "", fmt.Errorf("request %s not found", requestPath)
+	}
+	data, err := os.ReadFile(cm.notesFile(requestPath))
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("reading notes: %w", err)
+	}
+	return string(data), nil
+}
+
+// SaveNotes replaces the notes of requestPath. Blank notes remove the
+// notes file.
+func (cm *ConfigManager) SaveNotes(requestPath, notes string) error {
+	if _, ok := cm.requestFile(requestPath); !ok {
+		return fmt.Errorf("request %s not found", requestPath)
+	}
+	file := cm.notesFile(requestPath)
+	if strings.TrimSpace(notes) == "" {
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("removing notes: %w", err)
+		}
+		cm.removeEmptyDirs(filepath.Dir(file))
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return fmt.Errorf("creating request directory: %w", err)
+	}
+	if !strings.HasSuffix(notes, "\n") {
+		notes += "\n"
+	}
+	if err := os.WriteFile(file, []byte(notes), 0644); err != nil {
+		return fmt.Errorf("writing notes: %w", err)
+	}
+	return nil
+}
+
+// SaveExample saves the response of a history entry as the example name of
+// requestPath, replacing an example of that name. The entry must have a
+// response.
+func (cm *ConfigManager) SaveExample(requestPath, name string, entry *HistoryEntry) (*RequestExample, error) {
+	name = strings.TrimSuffix(name, ".json")
+	if err := ValidateBodyName(name); err != nil {
+		return nil, fmt.Errorf("invalid example name: %w", err)
+	}
+	if _, ok := cm.requestFile(requestPath); !ok {
+		return nil, fmt.Errorf("request %s not found", requestPath)
+	}
+	if entry.Error != "" {
+		return nil, fmt.Errorf("history entry %s has no response: %s", entry.ID, entry.Error)
+	}
+	headers := entry.Headers.Clone()
+	headers.Del("Set-Cookie")
+	example := &RequestExample{
+		Name:        name,
+		Environment: entry.Environment,
+		Method:      entry.Method,
+		URL:         entry.URL,
+		RequestBody: entry.RequestBody,
+		Status:      entry.Status,
+		StatusCode:  entry.StatusCode,
+		Headers:     headers,
+		Body:        entry.Body,
+		DurationMS:  entry.DurationMS,
+		Timestamp:   entry.Timestamp,
+		HistoryID:   entry.ID,
+	}
+	dir := cm.examplesPath(requestPath)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("creating examples folder: %w", err)
+	}
+	if err := writeJSONFile(filepath.Join(dir, name+".json"), example); err != nil {
+		return nil, fmt.Errorf("writing example: %w", err)
+	}
+	return example, nil
+}
+
+// ListExamples returns the saved examples of requestPath, sorted by name.
+func (cm *ConfigManager) ListExamples(requestPath string) ([]*RequestExample, error) {
+	files, err := filepath.Glob(filepath.Join(cm.examplesPath(requestPath), "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	examples := make([]*RequestExample, 0, len(files))
+	for _, file := range files {
+		example, err := readExample(file)
+		if err != nil {
+			return nil, err
+		}
+		examples = append(examples, example)
+	}
+	return examples, nil
+}
+
+// LoadExample reads the example name of requestPath.
+func (cm *ConfigManager) LoadExample(requestPath, name string) (*RequestExample, error) {
+	file := filepath.Join(cm.examplesPath(requestPath), strings.TrimSuffix(name, ".json")+".json")
+	if !fileExists(file) {
+		return nil, fmt.Errorf("example %q not found for %s", name, requestPath)
+	}
+	return readExample(file)
+}
+
+// RemoveExample deletes the example name of requestPath.
+func (cm *ConfigManager) RemoveExample(requestPath, name string) error {
+	dir := cm.examplesPath(requestPath)
+	file := filepath.Join(dir, strings.TrimSuffix(name, ".json")+".json")
+	if err := os.Remove(file); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("example %q not found for %s", name, requestPath)
+		}
+		return fmt.Errorf("removing example: %w", err)
+	}
+	cm.removeEmptyDirs(dir)
+	return nil
+}
+
+// readExample reads an example file, named after the file whatever its
+// name field says, so a renamed file keeps working.
+func readExample(file string) (*RequestExample, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("reading example: %w", err)
+	}
+	var example RequestExample
+	if err := json.Unmarshal(data, &example); err != nil {
+		return nil, fmt.Errorf("parsing example %s: %w", filepath.Base(file), err)
+	}
+	example.Name = strings.TrimSuffix(filepath.Base(file), ".json")
+	return &example, nil
+}
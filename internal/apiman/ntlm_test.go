@@ -0,0 +1,103 @@
+package apiman
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"testing"
+)
+
+// TestMD4Sum checks the test suite of RFC 1320, appendix A.5.
+func TestMD4Sum(t *testing.T) {
+	tests := []struct {
+		msg, sum string
+	}{
+		{"", "31d6cfe0d16ae931b73c59d7e0c089c0"},
+		{"a", "bde52cb31de33e46245e05fbdbd6fb24"},
+		{"abc", "a448017aaf21d8525fc10ae87aa6729d"},
+		{"message digest", "d9130a8164549fe818874806e1c7014b"},
+		{"abcdefghijklmnopqrstuvwxyz", "d79e1c308aa5bbcdeea8ed63df412da9"},
+		{"ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789", "043f8582f241db351ce627e153e7f0e4"},
+		{"12345678901234567890123456789012345678901234567890123456789012345678901234567890", "e33b4ddc9c38f2199c3e7b164fcc0536"},
+	}
+	for _, tt := range tests {
+		sum := md4Sum([]byte(tt.msg))
+		if got := hex.EncodeToString(sum[:]); got != tt.sum {
+			t.Errorf("MD4(%q) = %s, want %s", tt.msg, got, tt.sum)
+		}
+	}
+}
+
+func mustDecodeHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// TestNTLMv2Responses checks the NTLMv2 example of MS-NLMP 4.2.4.
+func TestNTLMv2Responses(t *testing.T) {
+	ntHash := md4Sum(utf16LE("Password"))
+	if got := hex.EncodeToString(ntHash[:]); got != "a4f49c406510bdcab6824ee7c30fd852" {
+		t.Errorf("NTOWFv1 = %s", got)
+	}
+
+	serverChallenge := mustDecodeHex(t, "0123456789abcdef")
+	clientChallenge := mustDecodeHex(t, "aaaaaaaaaaaaaaaa")
+	timestamp := make([]byte, 8)
+	// MsvAvNbDomainName "Domain", MsvAvNbComputerName "Server", MsvAvEOL.
+	targetInfo := mustDecodeHex(t, "02000c0044006f006d00610069006e0001000c0053006500720076006500720000000000")
+
+	ntResponse, lmResponse := ntlmv2Responses("User", "Domain", "Password", serverChallenge, clientChallenge, timestamp, targetInfo)
+	if got := hex.EncodeToString(ntResponse[:16]); got != "68cd0ab851e51c96aabc927bebef6a1c" {
+		t.Errorf("NTProofStr = %s", got)
+	}
+	if got := hex.EncodeToString(lmResponse); got != "86c35097ac9cec102554764a57cccc19aaaaaaaaaaaaaaaa" {
+		t.Errorf("LMv2 response = %s", got)
+	}
+}
+
+func TestAuthenticateMessage(t *testing.T) {
+	transport := newNTLMTransport(nil, "NTLM", map[string]string{"username": `Domain\User`, "password": "Password", "workstation": "COMPUTER"})
+
+	// A challenge with target info holding a server timestamp.
+	targetInfo := mustDecodeHex(t, "070008000102030405060708"+"00000000")
+	challenge := append([]byte{}, ntlmSignature...)
+	challenge = binary.LittleEndian.AppendUint32(challenge, 2)
+	challenge = append(challenge, make([]byte, 8)...) // target name
+	challenge = binary.LittleEndian.AppendUint32(challenge, ntlmNegotiateFlags)
+	challenge = append(challenge, mustDecodeHex(t, "0123456789abcdef")...)
+	challenge = append(challenge, make([]byte, 8)...) // reserved
+	challenge = binary.LittleEndian.AppendUint16(challenge, uint16(len(targetInfo)))
+	challenge = binary.LittleEndian.AppendUint16(challenge, uint16(len(targetInfo)))
+	challenge = binary.LittleEndian.AppendUint32(challenge, 48)
+	challenge = append(challenge, targetInfo...)
+
+	msg, err := transport.authenticateMessage(challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(msg[:8], ntlmSignature) || binary.LittleEndian.Uint32(msg[8:]) != 3 {
+		t.Fatalf("not an authenticate message: %x", msg[:12])
+	}
+	field := func(offset int) []byte {
+		b, err := ntlmField(msg, offset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	if lm := field(12); !bytes.Equal(lm, make([]byte, 24)) {
+		t.Errorf("LMv2 response %x not zeroed despite the server timestamp", lm)
+	}
+	if nt := field(20); !bytes.Contains(nt, mustDecodeHex(t, "0102030405060708")) || !bytes.Contains(nt, targetInfo) {
+		t.Errorf("NTLMv2 response %x lacks the server's timestamp or target info", nt)
+	}
+	for offset, want := range map[int]string{28: "Domain", 36: "User", 44: "COMPUTER"} {
+		if got := field(offset); !bytes.Equal(got, utf16LE(want)) {
+			t.Errorf("field at %d = %x, want %q in UTF-16", offset, got, want)
+		}
+	}
+}
@@ -0,0 +1,277 @@
+// oauth2.go
+package apiman
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+// An environment opts into OAuth2 with auth type "oauth2":
+//
+//	"auth": {
+//	  "type": "oauth2",
+//	  "grantType": "client_credentials",
+//	  "tokenURL": "https://auth.example.com/oauth/token",
+//	  "clientId": "{{env.CLIENT_ID}}",
+//	  "clientSecret": "{{env.CLIENT_SECRET}}",
+//	  "scope": "read write"
+//	}
+//
+// grantType is one of client_credentials (the default), password (which also
+// reads username and password) or authorization_code (which also reads
+// authURL and optionally redirectPort, default 8765). Tokens are cached per
+// environment in .api-man/tokens/ and refreshed once they expire.
+const (
+	oauth2DefaultRedirectPort = "8765"
+	oauth2LoginTimeout        = 5 * time.Minute
+)
+
+// cachedOAuth2Token is the on-disk form of a cached token. Fingerprint ties
+// the token to the auth settings it was issued for, so editing the
+// environment invalidates it.
+type cachedOAuth2Token struct {
+	Fingerprint string        `json:"fingerprint"`
+	Token       *oauth2.Token `json:"token"`
+}
+
+// applyAuth attaches env's credentials to req, obtaining an OAuth2 token
+// first when the environment uses one and running an auth plugin for types
+// that aren't built in.
+func (cm *ConfigManager) applyAuth(req *http.Request, envName string, env *Environment) error {
+	switch authType := env.Auth["type"]; {
+	case !slices.Contains(builtinAuthTypes, authType):
+		return cm.applyAuthPlugin(req, envName, env)
+	case authType == "jwt":
+		return cm.applyJWTAuth(req, env)
+	case authType != "oauth2":
+		applyEnvironmentAuth(req, env)
+		return nil
+	}
+	token, err := cm.oauth2Token(req.Context(), envName, env.Auth)
+	if err != nil {
+		return fmt.Errorf("obtaining oauth2 token: %w", err)
+	}
+	token.SetAuthHeader(req)
+	return nil
+}
+
+func (cm *ConfigManager) oauth2TokenPath(envName string) string {
+	return filepath.Join(cm.stateDir(), "tokens", sanitizeRequestPathSegment(envName)+".json")
+}
+
+// oauth2Token returns a valid token for envName, preferring the cache, then
+// a refresh, then a new grant.
+func (cm *ConfigManager) oauth2Token(ctx context.Context, envName string, auth map[string]string) (*oauth2.Token, error) {
+	if auth["tokenURL"] == "" {
+		return nil, fmt.Errorf("auth.tokenURL is required")
+	}
+	conf := oauth2ConfigFromAuth(auth)
+	fingerprint := oauth2Fingerprint(auth)
+	path := cm.oauth2TokenPath(envName)
+
+	token, err := cm.reuseOAuth2Token(ctx, envName, conf, path, fingerprint)
+	if err != nil || token != nil {
+		return token, err
+	}
+
+	// A new grant may wait minutes for the user to log in, so it is
+	// fetched without the lock, which would otherwise be taken as stale.
+	token, err = fetchOAuth2Token(ctx, conf, auth)
+	if err != nil {
+		return nil, err
+	}
+	unlock, err := cm.lockState("token-" + envName)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	if err := storeOAuth2Token(path, fingerprint, token); err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// reuseOAuth2Token returns the cached token at path if it is still valid or
+// can be refreshed, and nil otherwise. It holds the token's lock throughout:
+// another process refreshing the same token at once could invalidate the
+// refresh token this one is about to use.
+func (cm *ConfigManager) reuseOAuth2Token(ctx context.Context, envName string, conf *oauth2.Config, path, fingerprint string) (*oauth2.Token, error) {
+	unlock, err := cm.lockState("token-" + envName)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	cached := loadCachedOAuth2Token(path, fingerprint)
+	if cached == nil || cached.Valid() {
+		return cached, nil
+	}
+	if cached.RefreshToken == "" {
+		return nil, nil
+	}
+	token, err := conf.TokenSource(ctx, cached).Token()
+	if err != nil {
+		// A refresh token that no longer works falls back to a new grant.
+		return nil, nil
+	}
+	if err := storeOAuth2Token(path, fingerprint, token); err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+func storeOAuth2Token(path, fingerprint string, token *oauth2.Token) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("creating token cache directory: %w", err)
+	}
+	data, err := json.MarshalIndent(cachedOAuth2Token{Fingerprint: fingerprint, Token: token}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding token cache: %w", err)
+	}
+	if err := writeFileAtomic(path, data, 0600); err != nil {
+		return fmt.Errorf("writing token cache: %w", err)
+	}
+	return nil
+}
+
+func loadCachedOAuth2Token(path, fingerprint string) *oauth2.Token {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var cached cachedOAuth2Token
+	if err := json.Unmarshal(data, &cached); err != nil || cached.Fingerprint != fingerprint {
+		return nil
+	}
+	return cached.Token
+}
+
+func oauth2ConfigFromAuth(auth map[string]string) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     auth["clientId"],
+		ClientSecret: auth["clientSecret"],
+		Scopes:       strings.Fields(auth["scope"]),
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  auth["authURL"],
+			TokenURL: auth["tokenURL"],
+		},
+	}
+}
+
+func oauth2Fingerprint(auth map[string]string) string {
+	h := sha256.New()
+	for _, key := range []string{"grantType", "tokenURL", "authURL", "clientId", "scope", "audience", "username"} {
+		fmt.Fprintf(h, "%s=%s\n", key, auth[key])
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func fetchOAuth2Token(ctx context.Context, conf *oauth2.Config, auth map[string]string) (*oauth2.Token, error) {
+	switch grant := auth["grantType"]; grant {
+	case "", "client_credentials":
+		cc := clientcredentials.Config{
+			ClientID:     conf.ClientID,
+			ClientSecret: conf.ClientSecret,
+			TokenURL:     conf.Endpoint.TokenURL,
+			Scopes:       conf.Scopes,
+		}
+		if audience := auth["audience"]; audience != "" {
+			cc.EndpointParams = url.Values{"audience": {audience}}
+		}
+		return cc.Token(ctx)
+	case "password":
+		return conf.PasswordCredentialsToken(ctx, auth["username"], auth["password"])
+	case "authorization_code":
+		return authorizationCodeLogin(ctx, conf, auth["redirectPort"])
+	default:
+		return nil, fmt.Errorf("unsupported grantType %q", grant)
+	}
+}
+
+// authorizationCodeLogin runs the authorization code flow with PKCE: it
+// listens on localhost for the redirect, asks the user to open the
+// authorization URL and exchanges the returned code.
+func authorizationCodeLogin(ctx context.Context, conf *oauth2.Config, port string) (*oauth2.Token, error) {
+	if conf.Endpoint.AuthURL == "" {
+		return nil, fmt.Errorf("auth.authURL is required for the authorization_code grant")
+	}
+	if port == "" {
+		port = oauth2DefaultRedirectPort
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:"+port)
+	if err != nil {
+		return nil, fmt.Errorf("starting callback listener: %w", err)
+	}
+	defer listener.Close()
+	conf.RedirectURL = fmt.Sprintf("http://127.0.0.1:%s/callback", port)
+
+	stateBytes := make([]byte, 16)
+	if _, err := rand.Read(stateBytes); err != nil {
+		return nil, fmt.Errorf("generating state: %w", err)
+	}
+	state := hex.EncodeToString(stateBytes)
+	verifier := oauth2.GenerateVerifier()
+
+	type callbackResult struct {
+		code string
+		err  error
+	}
+	results := make(chan callbackResult, 1)
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/callback" {
+			http.NotFound(w, r)
+			return
+		}
+		query := r.URL.Query()
+		var result callbackResult
+		switch {
+		case query.Get("error") != "":
+			result.err = fmt.Errorf("authorization failed: %s %s", query.Get("error"), query.Get("error_description"))
+		case query.Get("state") != state:
+			result.err = fmt.Errorf("authorization failed: state mismatch")
+		default:
+			result.code = query.Get("code")
+		}
+		if result.err != nil {
+			http.Error(w, result.err.Error(), http.StatusBadRequest)
+		} else {
+			fmt.Fprintln(w, "Login complete. You can close this window and return to api-man.")
+		}
+		select {
+		case results <- result:
+		default:
+		}
+	})}
+	go server.Serve(listener)
+	defer server.Close()
+
+	authURL := conf.AuthCodeURL(state, oauth2.AccessTypeOffline, oauth2.S256ChallengeOption(verifier))
+	fmt.Fprintf(os.Stderr, "Open this URL in your browser to log in:\n\n  %s\n\nWaiting for the OAuth2 callback on %s ...\n", authURL, conf.RedirectURL)
+
+	ctx, cancel := context.WithTimeout(ctx, oauth2LoginTimeout)
+	defer cancel()
+	select {
+	case result := <-results:
+		if result.err != nil {
+			return nil, result.err
+		}
+		return conf.Exchange(ctx, result.code, oauth2.VerifierOption(verifier))
+	case <-ctx.Done():
+		return nil, fmt.Errorf("waiting for authorization: %w", ctx.Err())
+	}
+}
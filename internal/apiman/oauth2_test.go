@@ -0,0 +1,54 @@
+package apiman
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+func TestOAuth2TokenIsCachedAndFetchedWithoutTheLock(t *testing.T) {
+	cm, err := InitWorkspace(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	lock := filepath.Join(cm.locksDir(), "token-dev.lock")
+
+	var grants atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		grants.Add(1)
+		if fileExists(lock) {
+			t.Error("token lock held while fetching a new grant")
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token": "abc", "token_type": "Bearer", "expires_in": 3600}`))
+	}))
+	defer server.Close()
+
+	auth := map[string]string{"type": "oauth2", "tokenURL": server.URL, "clientId": "id", "clientSecret": "secret"}
+	for range 2 {
+		token, err := cm.oauth2Token(context.Background(), "dev", auth)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token.AccessToken != "abc" {
+			t.Errorf("access token %q", token.AccessToken)
+		}
+	}
+	if got := grants.Load(); got != 1 {
+		t.Errorf("%d grants fetched, want 1 then the cached token", got)
+	}
+	if fileExists(lock) {
+		t.Error("token lock left behind")
+	}
+
+	auth["scope"] = "admin"
+	if _, err := cm.oauth2Token(context.Background(), "dev", auth); err != nil {
+		t.Fatal(err)
+	}
+	if got := grants.Load(); got != 2 {
+		t.Errorf("cached token reused after the auth settings changed")
+	}
+}
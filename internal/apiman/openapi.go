@@ -0,0 +1,170 @@
+// openapi.go
+package apiman
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi2"
+	"github.com/getkin/kin-openapi/openapi2conv"
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// specFetchTimeout bounds downloading a spec and each file it references.
+const specFetchTimeout = 30 * time.Second
+
+// LoadOpenAPISpec loads a YAML or JSON spec from a file or an http(s) URL,
+// following $refs into other files relative to it. header is sent when
+// fetching from the spec's own host, e.g. to authenticate. Swagger 2.0 specs
+// are converted to OpenAPI 3.
+func LoadOpenAPISpec(location string, header http.Header) (*openapi3.T, error) {
+	loader, data, uri, err := readSpec(location, header)
+	if err != nil {
+		return nil, err
+	}
+	return loadOpenAPISpec(loader, data, uri)
+}
+
+// LoadAPISpec is LoadOpenAPISpec, except that an AsyncAPI document is
+// returned as such instead.
+func LoadAPISpec(location string, header http.Header) (*openapi3.T, *AsyncAPISpec, error) {
+	loader, data, uri, err := readSpec(location, header)
+	if err != nil {
+		return nil, nil, err
+	}
+	if isAsyncAPI(data) {
+		spec, err := ParseAsyncAPISpec(data)
+		return nil, spec, err
+	}
+	spec, err := loadOpenAPISpec(loader, data, uri)
+	return spec, nil, err
+}
+
+// readSpec reads the spec at location with a loader for the files it
+// references.
+func readSpec(location string, header http.Header) (*openapi3.Loader, []byte, *url.URL, error) {
+	loader := newSpecLoader(location, header)
+
+	var uri *url.URL
+	if isRemoteSpec(location) {
+		parsed, err := url.Parse(location)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("parsing spec URL: %w", err)
+		}
+		uri = parsed
+	} else {
+		abs, err := filepath.Abs(location)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("resolving spec path: %w", err)
+		}
+		uri = &url.URL{Path: filepath.ToSlash(abs)}
+	}
+
+	data, err := loader.ReadFromURIFunc(loader, uri)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("reading spec: %w", err)
+	}
+	return loader, data, uri, nil
+}
+
+func LoadOpenAPISpecFromData(data []byte) (*openapi3.T, error) {
+	return loadOpenAPISpec(openapi3.NewLoader(), data, nil)
+}
+
+func loadOpenAPISpec(loader *openapi3.Loader, data []byte, location *url.URL) (*openapi3.T, error) {
+	var doc *openapi3.T
+	var err error
+	if isSwagger2(data) {
+		doc, err = convertSwagger2(data)
+		if err == nil && location != nil {
+			err = loader.ResolveRefsIn(doc, location)
+		}
+	} else if location != nil {
+		doc, err = loader.LoadFromDataWithPath(data, location)
+	} else {
+		doc, err = loader.LoadFromData(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parsing OpenAPI spec: %w", err)
+	}
+
+	// Validate but don't fail on errors — kin-openapi is OpenAPI 3.0 only,
+	// so 3.1 features like `type: "null"` trigger spurious errors.
+	if err := doc.Validate(context.Background(), openapi3.AllowExtraSiblingFields(additionalOperationsKey)); err != nil {
+		fmt.Printf("⚠️  OpenAPI validation warning (continuing anyway): %v\n", err)
+	}
+
+	return doc, nil
+}
+
+func isRemoteSpec(location string) bool {
+	return strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://")
+}
+
+// newSpecLoader returns a loader that may follow references to other files
+// and URLs. header is only sent to the host the spec itself is fetched
+// from, so credentials don't leak to third-party schema hosts.
+func newSpecLoader(location string, header http.Header) *openapi3.Loader {
+	loader := openapi3.NewLoader()
+	loader.IsExternalRefsAllowed = true
+
+	var transport http.RoundTripper = http.DefaultTransport
+	if u, err := url.Parse(location); err == nil && isRemoteSpec(location) && len(header) > 0 {
+		transport = specHeaderTransport{host: u.Host, header: header}
+	}
+	client := &http.Client{Timeout: specFetchTimeout, Transport: transport}
+	loader.ReadFromURIFunc = openapi3.URIMapCache(openapi3.ReadFromURIs(openapi3.ReadFromHTTP(client), openapi3.ReadFromFile))
+	return loader
+}
+
+type specHeaderTransport struct {
+	host   string
+	header http.Header
+}
+
+func (t specHeaderTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Host == t.host {
+		req = req.Clone(req.Context())
+		for name, values := range t.header {
+			req.Header[name] = values
+		}
+	}
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// isSwagger2 reports whether data is a Swagger 2.0 document.
+func isSwagger2(data []byte) bool {
+	converted, err := yamlToJSON(data)
+	if err != nil {
+		return false
+	}
+	var probe struct {
+		Swagger string `json:"swagger"`
+	}
+	return json.Unmarshal(converted, &probe) == nil && strings.HasPrefix(probe.Swagger, "2.")
+}
+
+func convertSwagger2(data []byte) (*openapi3.T, error) {
+	converted, err := yamlToJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	var doc openapi2.T
+	if err := json.Unmarshal(converted, &doc); err != nil {
+		return nil, err
+	}
+	return openapi2conv.ToV3(&doc)
+}
+
+func OpenAPICollectionName(spec *openapi3.T) string {
+	if spec != nil && spec.Info != nil && strings.TrimSpace(spec.Info.Title) != "" {
+		return sanitizeRequestPathSegment(spec.Info.Title)
+	}
+	return "api"
+}
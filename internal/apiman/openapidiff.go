@@ -0,0 +1,635 @@
+// openapidiff.go
+package apiman
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// generatedRequest is the request.json generate writes for an operation.
+type generatedRequest struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	URL           string            `json:"url"`
+	Headers       map[string]string `json:"headers"`
+	Body          string            `json:"body"`
+	Method        string            `json:"method"`
+	Name          string            `json:"name"`
+	Params        map[string]string `json:"params,omitempty"`
+	PathParams    map[string]string `json:"pathParams,omitempty"`
+	Schema        *RequestSchema    `json:"schema,omitempty"`
+}
+
+// generatedOperation is one operation of a spec and the request generated
+// for it, stored as requests/<collection>/<Name>/request.json.
+type generatedOperation struct {
+	Name    string
+	Path    string
+	Request generatedRequest
+}
+
+// generateOperations builds the request of every operation in spec, sorted
+// by name.
+func generateOperations(spec *openapi3.T) []generatedOperation {
+	var operations []generatedOperation
+	for path, pathItem := range spec.Paths.Map() {
+		for method, operation := range pathOperations(pathItem) {
+
+			// Generate request name
+			requestName := method + "-" + strings.ReplaceAll(strings.Trim(path, "/"), "/", "-")
+			if operation.OperationID != "" {
+				requestName = operation.OperationID
+			}
+			requestName = sanitizeRequestPathSegment(requestName)
+
+			requestInfo := generatedRequest{
+				SchemaVersion: CurrentSchemaVersion,
+				URL:           path,
+				Headers:       make(map[string]string),
+				Body:          "",
+				Method:        method,
+				Name:          requestName,
+				Params:        make(map[string]string),
+				PathParams:    make(map[string]string),
+				Schema:        requestSchema(operation),
+			}
+
+			// Add default headers based on operation
+			if contentType, body := exampleRequestBody(operation.RequestBody); contentType != "" {
+				requestInfo.Headers["Content-Type"] = contentType
+				requestInfo.Body = body
+			} else if method == "POST" || method == "PUT" || method == "PATCH" {
+				requestInfo.Headers["Content-Type"] = "application/json"
+			}
+
+			// Path-level parameters apply to every operation; the operation's
+			// own definitions come last so they win.
+			parameters := append(append(openapi3.Parameters{}, pathItem.Parameters...), operation.Parameters...)
+			for _, parameterRef := range parameters {
+				if parameterRef == nil || parameterRef.Value == nil {
+					continue
+				}
+				parameter := parameterRef.Value
+				if parameter.Name == "" {
+					continue
+				}
+				switch parameter.In {
+				case "query":
+					requestInfo.Params[parameter.Name] = parameterValue(parameter)
+				case "path":
+					requestInfo.PathParams[parameter.Name] = parameterValue(parameter)
+				case "header":
+					if value := parameterValue(parameter); value != "" {
+						requestInfo.Headers[parameter.Name] = value
+					}
+				}
+			}
+
+			if len(requestInfo.Params) == 0 {
+				requestInfo.Params = nil
+			}
+			if len(requestInfo.PathParams) == 0 {
+				requestInfo.PathParams = nil
+			}
+			operations = append(operations, generatedOperation{Name: requestName, Path: path, Request: requestInfo})
+		}
+	}
+	sort.Slice(operations, func(i, j int) bool { return operations[i].Name < operations[j].Name })
+	return operations
+}
+
+// The requests of the last generate are kept in
+// .api-man/generated/<collection>.json. They are the common ancestor that
+// lets generate --diff tell the spec's changes from the user's edits.
+
+func (cm *ConfigManager) generatedSnapshotPath(collection string) string {
+	return filepath.Join(cm.stateDir(), "generated", collection+".json")
+}
+
+func (cm *ConfigManager) saveGeneratedSnapshot(collection string, operations []generatedOperation) error {
+	snapshot := make(map[string]generatedRequest, len(operations))
+	for _, op := range operations {
+		snapshot[op.Name] = op.Request
+	}
+	data, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding generated requests: %w", err)
+	}
+	path := cm.generatedSnapshotPath(collection)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("creating state directory: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("writing generated requests: %w", err)
+	}
+	return nil
+}
+
+// loadGeneratedSnapshot returns the requests of the last generate into
+// collection, or nil when it predates snapshots.
+func (cm *ConfigManager) loadGeneratedSnapshot(collection string) (map[string]generatedRequest, error) {
+	data, err := os.ReadFile(cm.generatedSnapshotPath(collection))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("reading generated requests: %w", err)
+	}
+	var snapshot map[string]generatedRequest
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, fmt.Errorf("parsing generated requests: %w", err)
+	}
+	return snapshot, nil
+}
+
+// OpenAPIDiff compares a spec with the requests generated from an earlier
+// version of it.
+type OpenAPIDiff struct {
+	Collection string                 `json:"collection"`
+	Added      []OpenAPIOperationDiff `json:"added,omitempty"`
+	Removed    []OpenAPIOperationDiff `json:"removed,omitempty"`
+	Changed    []OpenAPIOperationDiff `json:"changed,omitempty"`
+	// Duplicates are operations already generated into another collection,
+	// which are left there rather than copied into this one.
+	Duplicates []OpenAPIOperationDiff `json:"duplicates,omitempty"`
+	Unchanged  int                    `json:"unchanged"`
+	// HasBase reports whether the requests of the last generate were
+	// known. Without them an edit can't be told from a spec change, so
+	// every difference to the spec counts as changed and the requests'
+	// headers, parameters and bodies are kept as they are.
+	HasBase bool `json:"hasBase"`
+
+	merged map[string]*RequestConfig
+	added  []generatedOperation
+	prune  []string
+	spec   []generatedOperation
+}
+
+// OpenAPIOperationDiff describes one added, removed or changed operation.
+// Fields name what changed: "method", "url", "body", "schema", "name",
+// "header <name>", "query <name>" and "path <name>".
+type OpenAPIOperationDiff struct {
+	Request string   `json:"request"`
+	Method  string   `json:"method"`
+	Path    string   `json:"path"`
+	Fields  []string `json:"fields,omitempty"`
+	// Kept lists the fields edited in the workspace that applying leaves
+	// alone; Conflicts those the spec changed too, where the edit wins.
+	Kept      []string `json:"kept,omitempty"`
+	Conflicts []string `json:"conflicts,omitempty"`
+	// Edited marks a removed request that was changed after it was
+	// generated, which applying keeps.
+	Edited bool `json:"edited,omitempty"`
+	// DuplicateOf is the request already covering the same method and
+	// path: for a removed request, the one the spec's operation now
+	// updates; for a duplicate, the one in the other collection, Fields
+	// then listing where the spec differs from it.
+	DuplicateOf string `json:"duplicateOf,omitempty"`
+}
+
+// Empty reports whether the spec matches the workspace. Duplicates don't
+// count: they stay in their own collection.
+func (d *OpenAPIDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// Warnings describes what applying the diff leaves for the user to sort
+// out: operations generated elsewhere, conflicting edits and removed
+// requests kept for their edits.
+func (d *OpenAPIDiff) Warnings() []string {
+	var warnings []string
+	for _, op := range d.Duplicates {
+		warning := fmt.Sprintf("%s %s is already generated as %s, so it was not added to %s/", op.Method, op.Path, op.DuplicateOf, d.Collection)
+		if len(op.Fields) > 0 {
+			warning += fmt.Sprintf(" (this spec differs in %s)", strings.Join(op.Fields, ", "))
+		}
+		warnings = append(warnings, warning)
+	}
+	for _, op := range d.Changed {
+		if len(op.Conflicts) > 0 {
+			warnings = append(warnings, fmt.Sprintf("%s: kept your %s, which the spec changed too", op.Request, strings.Join(op.Conflicts, ", ")))
+		}
+	}
+	for _, op := range d.Removed {
+		switch {
+		case !op.Edited:
+		case op.DuplicateOf != "":
+			warnings = append(warnings, fmt.Sprintf("%s duplicates %s but has your edits, so it was kept: remove it with api-man rm", op.Request, op.DuplicateOf))
+		default:
+			warnings = append(warnings, fmt.Sprintf("%s is no longer in the spec but has your edits, so it was kept: remove it with api-man rm", op.Request))
+		}
+	}
+	return warnings
+}
+
+// operationKey identifies an operation by method and path, whatever its
+// path parameters are called, so a request is recognised when its
+// operationId, and with it its name, changes.
+func operationKey(method, path string) string {
+	path = pathParamPattern.ReplaceAllString(strings.TrimSuffix(path, "/"), "{}")
+	return strings.ToUpper(method) + " " + path
+}
+
+// DiffOpenAPI compares spec with the requests generated into its collection
+// (named after the spec title, or overrideName). Requests are matched by
+// name, then by method and path, so an operation whose name changed updates
+// its existing request instead of adding a second one; operations another
+// collection was already generated with are reported as duplicates and not
+// added. Each changed request is merged field by field with the user's
+// edits, as ApplyOpenAPIDiff will write it.
+func (cm *ConfigManager) DiffOpenAPI(spec *openapi3.T, overrideName string) (*OpenAPIDiff, error) {
+	collection := OpenAPICollectionName(spec)
+	if strings.TrimSpace(overrideName) != "" {
+		collection = sanitizeRequestPathSegment(overrideName)
+	}
+	return cm.diffOpenAPI(spec, collection)
+}
+
+func (cm *ConfigManager) diffOpenAPI(spec *openapi3.T, collection string) (*OpenAPIDiff, error) {
+	base, err := cm.loadGeneratedSnapshot(collection)
+	if err != nil {
+		return nil, err
+	}
+	elsewhere, err := cm.generatedElsewhere(collection)
+	if err != nil {
+		return nil, err
+	}
+	diff := &OpenAPIDiff{
+		Collection: collection,
+		HasBase:    base != nil,
+		merged:     make(map[string]*RequestConfig),
+	}
+
+	entries, err := os.ReadDir(filepath.Join(cm.requestsDir, collection))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("reading collection directory: %w", err)
+	}
+	existing := make(map[string]*RequestConfig)
+	var names []string
+	for _, entry := range entries {
+		if _, ok := cm.requestFile(collection + "/" + entry.Name()); entry.IsDir() && ok {
+			names = append(names, entry.Name())
+			existing[entry.Name()], _ = cm.LoadRequest(collection + "/" + entry.Name())
+		}
+	}
+
+	operations := generateOperations(spec)
+	inSpec := make(map[string]bool)
+	for _, op := range operations {
+		inSpec[op.Name] = true
+	}
+	// Requests the spec has no operation of that name for, by operation,
+	// to be matched to an operation whose name changed.
+	byOperation := make(map[string][]string)
+	for _, name := range names {
+		if config := existing[name]; config != nil && !inSpec[name] {
+			key := operationKey(config.Method, config.URL)
+			byOperation[key] = append(byOperation[key], name)
+		}
+	}
+
+	matched := make(map[string]bool)
+	specRequests := make(map[string]string)
+	for _, op := range operations {
+		key := operationKey(op.Request.Method, op.Path)
+		if _, ok := existing[op.Name]; !ok && len(byOperation[key]) > 0 {
+			op.Name, byOperation[key] = byOperation[key][0], byOperation[key][1:]
+		}
+		requestPath := collection + "/" + op.Name
+		entry := OpenAPIOperationDiff{Request: requestPath, Method: op.Request.Method, Path: op.Path}
+		current, ok := existing[op.Name]
+		if !ok {
+			if other, ok := elsewhere[key]; ok {
+				entry.DuplicateOf = other.path
+				entry.Fields = differingFields(requestFields(other.config), generatedFields(&op.Request))
+				diff.Duplicates = append(diff.Duplicates, entry)
+				continue
+			}
+			diff.Added = append(diff.Added, entry)
+			diff.added = append(diff.added, op)
+			diff.spec = append(diff.spec, op)
+			specRequests[key] = requestPath
+			continue
+		}
+		if current == nil {
+			_, err := cm.LoadRequest(requestPath)
+			return nil, fmt.Errorf("loading %s: %w", requestPath, err)
+		}
+		matched[op.Name] = true
+		diff.spec = append(diff.spec, op)
+		specRequests[key] = requestPath
+
+		var baseFields map[string]string
+		if b, ok := base[op.Name]; ok {
+			baseFields = generatedFields(&b)
+		}
+		merged, changed := mergeGeneratedRequest(current, baseFields, generatedFields(&op.Request), &entry)
+		if !changed && len(entry.Fields) == 0 {
+			diff.Unchanged++
+			continue
+		}
+		diff.Changed = append(diff.Changed, entry)
+		if changed {
+			diff.merged[requestPath] = merged
+		}
+	}
+
+	for _, name := range names {
+		if matched[name] {
+			continue
+		}
+		requestPath := collection + "/" + name
+		removed := OpenAPIOperationDiff{Request: requestPath, Edited: true}
+		if config := existing[name]; config != nil {
+			removed.Method, removed.Path = config.Method, config.URL
+			removed.DuplicateOf = specRequests[operationKey(config.Method, config.URL)]
+			if b, ok := base[name]; ok && cm.untouchedGenerated(requestPath, config, &b) {
+				removed.Edited = false
+				diff.prune = append(diff.prune, requestPath)
+			}
+		}
+		diff.Removed = append(diff.Removed, removed)
+	}
+	return diff, nil
+}
+
+// generatedRequestRef is a request generate wrote into a collection.
+type generatedRequestRef struct {
+	path   string
+	config *RequestConfig
+}
+
+// generatedElsewhere indexes the requests generated into collections other
+// than collection by operation, so a spec covering the same endpoints as
+// another doesn't add a second copy of them.
+func (cm *ConfigManager) generatedElsewhere(collection string) (map[string]generatedRequestRef, error) {
+	files, err := filepath.Glob(filepath.Join(cm.stateDir(), "generated", "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	index := make(map[string]generatedRequestRef)
+	for _, file := range files {
+		other := strings.TrimSuffix(filepath.Base(file), ".json")
+		if other == collection {
+			continue
+		}
+		snapshot, err := cm.loadGeneratedSnapshot(other)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range slices.Sorted(maps.Keys(snapshot)) {
+			requestPath := other + "/" + name
+			config, err := cm.LoadRequest(requestPath)
+			if err != nil {
+				continue
+			}
+			key := operationKey(config.Method, config.URL)
+			if _, ok := index[key]; !ok {
+				index[key] = generatedRequestRef{path: requestPath, config: config}
+			}
+		}
+	}
+	return index, nil
+}
+
+// differingFields lists the generated fields of spec that a request has a
+// different value for, leaving out its name.
+func differingFields(current, spec map[string]string) []string {
+	var fields []string
+	for _, key := range slices.Sorted(maps.Keys(spec)) {
+		if value, ok := current[key]; key != "name" && (!ok || value != spec[key]) {
+			fields = append(fields, key)
+		}
+	}
+	return fields
+}
+
+// untouchedGenerated reports whether a request is still exactly as generate
+// wrote it: the generated fields match and nothing was added to it or its
+// directory.
+func (cm *ConfigManager) untouchedGenerated(requestPath string, config *RequestConfig, base *generatedRequest) bool {
+	if !maps.Equal(requestFields(config), generatedFields(base)) {
+		return false
+	}
+	if config.Assertions != nil || config.Hooks != nil || config.Extract != nil || config.Prompts != nil ||
+		config.Description != "" || config.ActiveBody != "" || config.SaveResponse != "" {
+		return false
+	}
+	files, err := os.ReadDir(filepath.Join(cm.requestsDir, requestPath))
+	return err == nil && len(files) == 1
+}
+
+// ApplyOpenAPIDiff writes the added requests and the merged changed ones,
+// deletes removed requests nobody edited, and records the spec's requests as
+// the base of the next diff. Removed requests with edits, body templates or
+// hooks are left in place; remove them with api-man rm.
+func (cm *ConfigManager) ApplyOpenAPIDiff(diff *OpenAPIDiff) error {
+	for _, requestPath := range diff.prune {
+		if err := cm.DeleteRequest(requestPath); err != nil {
+			return fmt.Errorf("removing %s: %w", requestPath, err)
+		}
+	}
+	for _, op := range diff.added {
+		dir := filepath.Join(cm.requestsDir, diff.Collection, op.Name)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("creating request directory %s: %w", dir, err)
+		}
+		data, err := json.MarshalIndent(op.Request, "", "  ")
+		if err != nil {
+			return fmt.Errorf("marshaling request info: %w", err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "request.json"), data, 0644); err != nil {
+			return fmt.Errorf("writing request file: %w", err)
+		}
+	}
+	for _, requestPath := range slices.Sorted(maps.Keys(diff.merged)) {
+		if err := cm.SaveRequest(requestPath, *diff.merged[requestPath]); err != nil {
+			return fmt.Errorf("saving %s: %w", requestPath, err)
+		}
+	}
+	return cm.saveGeneratedSnapshot(diff.Collection, diff.spec)
+}
+
+// specOwnedFields are taken from the spec when there is no base to tell
+// whether the user changed them.
+var specOwnedFields = []string{"method", "url", "schema"}
+
+// generatedFields flattens the fields generate writes into comparable
+// strings keyed as in OpenAPIOperationDiff.Fields.
+func generatedFields(r *generatedRequest) map[string]string {
+	fields := map[string]string{
+		"method": strings.ToUpper(r.Method),
+		"url":    r.URL,
+		"body":   r.Body,
+		"name":   r.Name,
+	}
+	for name, value := range r.Headers {
+		fields["header "+name] = value
+	}
+	for name, value := range r.Params {
+		fields["query "+name] = jsonField(value)
+	}
+	for name, value := range r.PathParams {
+		fields["path "+name] = value
+	}
+	if r.Schema != nil {
+		fields["schema"] = jsonField(r.Schema)
+	}
+	return fields
+}
+
+// requestFields flattens the same fields of a request in the workspace.
+func requestFields(c *RequestConfig) map[string]string {
+	fields := map[string]string{
+		"method": strings.ToUpper(c.Method),
+		"url":    c.URL,
+		"body":   c.Body,
+		"name":   c.Name,
+	}
+	for name, value := range c.Headers {
+		fields["header "+name] = value
+	}
+	for name, value := range c.Params {
+		fields["query "+name] = jsonField(value)
+	}
+	for name, value := range c.PathParams {
+		fields["path "+name] = value
+	}
+	if c.Schema != nil {
+		fields["schema"] = jsonField(c.Schema)
+	}
+	return fields
+}
+
+func jsonField(v interface{}) string {
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+// mergeGeneratedRequest three-way merges a request in the workspace with the
+// request generated from the new spec, base being the one generated last
+// time (nil when unknown). A field the user didn't touch follows the spec;
+// a field the spec didn't change keeps the user's value; a field both
+// changed keeps the user's value and is reported as a conflict. Fields outside
+// what generate writes (assertions, hooks, extract rules...) are never
+// touched. It reports whether the merge changes the request.
+func mergeGeneratedRequest(current *RequestConfig, base, spec map[string]string, entry *OpenAPIOperationDiff) (*RequestConfig, bool) {
+	mine := requestFields(current)
+	merged := maps.Clone(mine)
+
+	keys := make(map[string]bool)
+	for _, m := range []map[string]string{base, spec, mine} {
+		for key := range m {
+			keys[key] = true
+		}
+	}
+	for _, key := range slices.Sorted(maps.Keys(keys)) {
+		b, inBase := base[key]
+		n, inSpec := spec[key]
+		c, inMine := mine[key]
+		same := func(v1 string, ok1 bool, v2 string, ok2 bool) bool { return ok1 == ok2 && v1 == v2 }
+
+		if base == nil {
+			// Without a base: follow the spec for what only it defines and
+			// for new keys, keep the user's headers, parameters and body.
+			if same(c, inMine, n, inSpec) {
+				continue
+			}
+			entry.Fields = append(entry.Fields, key)
+			switch {
+			case slices.Contains(specOwnedFields, key):
+				setField(merged, key, n, inSpec)
+			case !inMine:
+				merged[key] = n
+			default:
+				entry.Kept = append(entry.Kept, key)
+			}
+			continue
+		}
+
+		specChanged := !same(b, inBase, n, inSpec)
+		userChanged := !same(b, inBase, c, inMine)
+		if specChanged {
+			entry.Fields = append(entry.Fields, key)
+		}
+		switch {
+		case specChanged && !userChanged:
+			setField(merged, key, n, inSpec)
+		case specChanged && same(c, inMine, n, inSpec):
+			// Both made the same change.
+		case specChanged:
+			entry.Conflicts = append(entry.Conflicts, key)
+		case userChanged:
+			entry.Kept = append(entry.Kept, key)
+		}
+	}
+
+	if maps.Equal(merged, mine) {
+		return current, false
+	}
+	return applyFields(current, merged), true
+}
+
+func setField(fields map[string]string, key, value string, present bool) {
+	if present {
+		fields[key] = value
+	} else {
+		delete(fields, key)
+	}
+}
+
+// applyFields returns a copy of config with the generated fields replaced
+// by fields.
+func applyFields(config *RequestConfig, fields map[string]string) *RequestConfig {
+	out := *config
+	out.Method = fields["method"]
+	out.URL = fields["url"]
+	out.Body = fields["body"]
+	out.Name = fields["name"]
+	// Maps stay empty rather than nil when the request had them.
+	out.Headers, out.Params, out.PathParams, out.Schema = nil, nil, nil, nil
+	if config.Headers != nil {
+		out.Headers = make(map[string]string)
+	}
+	if config.Params != nil {
+		out.Params = make(map[string]interface{})
+	}
+	if config.PathParams != nil {
+		out.PathParams = make(map[string]string)
+	}
+	for key, value := range fields {
+		kind, name, _ := strings.Cut(key, " ")
+		switch kind {
+		case "header":
+			if out.Headers == nil {
+				out.Headers = make(map[string]string)
+			}
+			out.Headers[name] = value
+		case "query":
+			if out.Params == nil {
+				out.Params = make(map[string]interface{})
+			}
+			var v interface{}
+			json.Unmarshal([]byte(value), &v)
+			out.Params[name] = v
+		case "path":
+			if out.PathParams == nil {
+				out.PathParams = make(map[string]string)
+			}
+			out.PathParams[name] = value
+		case "schema":
+			var schema RequestSchema
+			if json.Unmarshal([]byte(value), &schema) == nil {
+				out.Schema = &schema
+			}
+		}
+	}
+	return &out
+}
@@ -0,0 +1,205 @@
+package apiman
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMergeGeneratedRequest(t *testing.T) {
+	base := map[string]string{"method": "GET", "url": "/users", "body": "", "name": "list", "query limit": `"10"`, "header Accept": "application/json"}
+	current := &RequestConfig{
+		Method:  "GET",
+		URL:     "/users",
+		Name:    "list",
+		Headers: map[string]string{"Accept": "application/json", "X-Custom": "mine"},
+		Params:  map[string]interface{}{"limit": "50"},
+		Hooks:   &RequestHooks{Pre: "echo hi"},
+	}
+
+	// The spec renames the path, adds a parameter, drops Accept and changes
+	// the limit the user changed too.
+	spec := map[string]string{"method": "GET", "url": "/v2/users", "body": "", "name": "list", "query limit": `"20"`, "query page": `"1"`}
+	entry := &OpenAPIOperationDiff{}
+	merged, changed := mergeGeneratedRequest(current, base, spec, entry)
+	if !changed {
+		t.Fatal("merge reported no change")
+	}
+	if merged.URL != "/v2/users" || merged.Params["page"] != "1" || merged.Params["limit"] != "50" {
+		t.Errorf("merged %s with params %v", merged.URL, merged.Params)
+	}
+	if !reflect.DeepEqual(merged.Headers, map[string]string{"X-Custom": "mine"}) {
+		t.Errorf("merged headers %v", merged.Headers)
+	}
+	if merged.Hooks != current.Hooks || current.URL != "/users" {
+		t.Error("merge touched fields generate doesn't own, or the current request")
+	}
+	if want := []string{"header Accept", "query limit", "query page", "url"}; !reflect.DeepEqual(entry.Fields, want) {
+		t.Errorf("fields %q, want %q", entry.Fields, want)
+	}
+	if !reflect.DeepEqual(entry.Conflicts, []string{"query limit"}) || !reflect.DeepEqual(entry.Kept, []string{"header X-Custom"}) {
+		t.Errorf("conflicts %q, kept %q", entry.Conflicts, entry.Kept)
+	}
+
+	// Both making the same change is no conflict, and nothing to write.
+	spec = map[string]string{"method": "GET", "url": "/users", "body": "", "name": "list", "query limit": `"50"`, "header Accept": "application/json"}
+	entry = &OpenAPIOperationDiff{}
+	if _, changed := mergeGeneratedRequest(current, base, spec, entry); changed || len(entry.Conflicts) != 0 {
+		t.Errorf("same change: changed %v, conflicts %q", changed, entry.Conflicts)
+	}
+
+	// Without a base the spec owns the method, URL and schema; the user's
+	// values win elsewhere and only new keys are added.
+	spec = map[string]string{"method": "POST", "url": "/v2/users", "body": "{}", "name": "list", "query limit": `"20"`, "query page": `"1"`}
+	entry = &OpenAPIOperationDiff{}
+	merged, _ = mergeGeneratedRequest(current, nil, spec, entry)
+	if merged.Method != "POST" || merged.URL != "/v2/users" || merged.Body != "" || merged.Params["limit"] != "50" || merged.Params["page"] != "1" {
+		t.Errorf("merged without a base: %s %s %q %v", merged.Method, merged.URL, merged.Body, merged.Params)
+	}
+	if len(entry.Conflicts) != 0 || !reflect.DeepEqual(entry.Kept, []string{"body", "header Accept", "header X-Custom", "query limit"}) {
+		t.Errorf("without a base: conflicts %q, kept %q", entry.Conflicts, entry.Kept)
+	}
+}
+
+const testSpecV1 = `{
+  "openapi": "3.0.3",
+  "info": {"title": "Shop", "version": "1"},
+  "paths": {
+    "/users": {
+      "get": {"operationId": "listUsers", "parameters": [{"name": "limit", "in": "query", "schema": {"type": "string"}, "example": "10"}], "responses": {"200": {"description": "ok"}}},
+      "post": {"operationId": "createUser", "requestBody": {"content": {"application/json": {"example": {"name": "a"}}}}, "responses": {"201": {"description": "ok"}}}
+    },
+    "/users/{id}": {
+      "get": {"operationId": "getUser", "parameters": [{"name": "id", "in": "path", "required": true, "schema": {"type": "string"}, "example": "1"}], "responses": {"200": {"description": "ok"}}},
+      "delete": {"operationId": "deleteUser", "parameters": [{"name": "id", "in": "path", "required": true, "schema": {"type": "string"}, "example": "1"}], "responses": {"204": {"description": "ok"}}}
+    },
+    "/orders": {
+      "get": {"operationId": "listOrders", "responses": {"200": {"description": "ok"}}}
+    }
+  }
+}`
+
+const testSpecV2 = `{
+  "openapi": "3.0.3",
+  "info": {"title": "Shop", "version": "2"},
+  "paths": {
+    "/users": {
+      "get": {"operationId": "listUsers", "parameters": [{"name": "limit", "in": "query", "schema": {"type": "string"}, "example": "20"}, {"name": "page", "in": "query", "schema": {"type": "string"}, "example": "1"}], "responses": {"200": {"description": "ok"}}},
+      "post": {"operationId": "createUser", "requestBody": {"content": {"application/json": {"example": {"name": "b"}}}}, "responses": {"201": {"description": "ok"}}}
+    },
+    "/users/{userId}": {
+      "get": {"operationId": "fetchUser", "parameters": [{"name": "userId", "in": "path", "required": true, "schema": {"type": "string"}, "example": "2"}], "responses": {"200": {"description": "ok"}}}
+    },
+    "/health": {
+      "get": {"operationId": "health", "responses": {"200": {"description": "ok"}}}
+    }
+  }
+}`
+
+func TestApplyOpenAPIDiffKeepsEdits(t *testing.T) {
+	cm, err := InitWorkspace(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	v1, err := LoadOpenAPISpecFromData([]byte(testSpecV1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cm.GenerateRequestsFromOpenAPI(v1); err != nil {
+		t.Fatal(err)
+	}
+
+	// Edit two requests: a custom header and body, a changed limit and a
+	// description on a request the spec then drops.
+	edit := func(path string, change func(*RequestConfig)) {
+		t.Helper()
+		config, err := cm.LoadRequest(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		change(config)
+		if err := cm.SaveRequest(path, *config); err != nil {
+			t.Fatal(err)
+		}
+	}
+	edit("shop/createuser", func(c *RequestConfig) {
+		c.Headers["X-Custom"] = "mine"
+		c.Body = `{"name": "mine"}`
+	})
+	edit("shop/listusers", func(c *RequestConfig) { c.Params["limit"] = "50" })
+	edit("shop/deleteuser", func(c *RequestConfig) { c.Description = "Careful." })
+
+	v2, err := LoadOpenAPISpecFromData([]byte(testSpecV2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	diff, err := cm.DiffOpenAPI(v2, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !diff.HasBase || diff.Collection != "shop" {
+		t.Fatalf("diff of %s, has base %v", diff.Collection, diff.HasBase)
+	}
+	requests := func(ops []OpenAPIOperationDiff) string {
+		var names []string
+		for _, op := range ops {
+			names = append(names, op.Request)
+		}
+		return strings.Join(names, ",")
+	}
+	if got := requests(diff.Added); got != "shop/health" {
+		t.Errorf("added %s", got)
+	}
+	if got := requests(diff.Removed); got != "shop/deleteuser,shop/listorders" {
+		t.Errorf("removed %s", got)
+	}
+	if got := requests(diff.Changed); got != "shop/createuser,shop/getuser,shop/listusers" {
+		t.Errorf("changed %s", got)
+	}
+	warnings := strings.Join(diff.Warnings(), "\n")
+	for _, want := range []string{"shop/createuser: kept your body", "shop/listusers: kept your query limit", "shop/deleteuser is no longer in the spec but has your edits"} {
+		if !strings.Contains(warnings, want) {
+			t.Errorf("no warning %q in:\n%s", want, warnings)
+		}
+	}
+
+	if err := cm.ApplyOpenAPIDiff(diff); err != nil {
+		t.Fatal(err)
+	}
+	create, err := cm.LoadRequest("shop/createuser")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if create.Body != `{"name": "mine"}` || create.Headers["X-Custom"] != "mine" {
+		t.Errorf("createUser lost its edits: %q %v", create.Body, create.Headers)
+	}
+	list, err := cm.LoadRequest("shop/listusers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list.Params["limit"] != "50" || list.Params["page"] != "1" {
+		t.Errorf("listUsers params %v", list.Params)
+	}
+	// The renamed operation updated its request rather than adding one.
+	get, err := cm.LoadRequest("shop/getuser")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if get.URL != "/users/{userId}" || get.PathParams["userId"] != "2" {
+		t.Errorf("getUser: %s %v", get.URL, get.PathParams)
+	}
+	for path, want := range map[string]bool{"shop/fetchuser": false, "shop/health": true, "shop/deleteuser": true, "shop/listorders": false} {
+		if _, got := cm.requestFile(path); got != want {
+			t.Errorf("%s exists: %v, want %v", path, got, want)
+		}
+	}
+
+	// Applied, the spec matches the workspace.
+	diff, err = cm.DiffOpenAPI(v2, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diff.Added) != 0 || len(diff.Changed) != 0 || requests(diff.Removed) != "shop/deleteuser" {
+		t.Errorf("second diff: added %s, changed %s, removed %s", requests(diff.Added), requests(diff.Changed), requests(diff.Removed))
+	}
+}
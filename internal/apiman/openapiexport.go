@@ -0,0 +1,448 @@
+// openapiexport.go
+package apiman
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// maxSchemaSamples caps how many history entries of one request and status
+// are merged into a response schema.
+const maxSchemaSamples = 20
+
+// templateVarPattern matches {{name}} placeholders.
+var templateVarPattern = regexp.MustCompile(`\{\{\s*([^{}\s]+)\s*\}\}`)
+
+// OpenAPIExportOptions configure ExportOpenAPI.
+type OpenAPIExportOptions struct {
+	// Target limits the export to a request or a directory of requests.
+	Target  string
+	Title   string
+	Version string
+}
+
+// OpenAPIExportResult is the document ExportOpenAPI built, with the
+// requests it had to leave out or could only partly describe.
+type OpenAPIExportResult struct {
+	Spec       *openapi3.T
+	Operations int
+	Warnings   []string
+}
+
+// ExportOpenAPI is the reverse of generate: it describes the workspace's
+// requests as an OpenAPI 3 document. Every request becomes an operation with
+// its path, query, header and cookie parameters; request body schemas are
+// inferred from the inline body and body templates, and response schemas
+// from the responses recorded in the history. Environments whose baseURL
+// needs no variables become servers.
+func (cm *ConfigManager) ExportOpenAPI(opts OpenAPIExportOptions) (*OpenAPIExportResult, error) {
+	var paths []string
+	var err error
+	if opts.Target == "" {
+		paths, err = cm.RequestPaths()
+	} else {
+		paths, err = cm.ResolveRequestTargets(opts.Target)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("resolving requests: %w", err)
+	}
+
+	title := opts.Title
+	if title == "" {
+		title = filepath.Base(cm.configDir) + " API"
+	}
+	version := opts.Version
+	if version == "" {
+		version = "1.0.0"
+	}
+	spec := &openapi3.T{
+		OpenAPI: "3.0.3",
+		Info:    &openapi3.Info{Title: title, Version: version},
+		Paths:   openapi3.NewPaths(),
+		Servers: cm.openAPIServers(),
+	}
+	result := &OpenAPIExportResult{Spec: spec}
+
+	history, err := cm.ListHistory(0)
+	if err != nil {
+		return nil, err
+	}
+	samples := make(map[string][]*HistoryEntry)
+	for _, entry := range history {
+		if entry.Request != "" && entry.Error == "" && entry.StatusCode > 0 {
+			samples[entry.Request] = append(samples[entry.Request], entry)
+		}
+	}
+
+	owners := make(map[string]string)
+	operationIDs := make(map[string]bool)
+	for _, requestPath := range paths {
+		config, err := cm.LoadRequest(requestPath)
+		if err != nil {
+			return nil, fmt.Errorf("loading %s: %w", requestPath, err)
+		}
+		if config.GRPC != nil {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("%s: gRPC requests can't be described in OpenAPI; skipped", requestPath))
+			continue
+		}
+		if config.WebSocket != nil {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("%s: WebSocket requests can't be described in OpenAPI; skipped", requestPath))
+			continue
+		}
+		method := strings.ToUpper(config.Method)
+		if method == "" {
+			method = http.MethodGet
+		}
+		specPath, query := openAPIPath(config.URL)
+		key := method + " " + specPath
+		if owner, ok := owners[key]; ok {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("%s: %s is already described by %s; skipped", requestPath, key, owner))
+			continue
+		}
+		owners[key] = requestPath
+
+		operation, warnings := cm.openAPIOperation(requestPath, config, specPath, query, samples[requestPath])
+		result.Warnings = append(result.Warnings, warnings...)
+		operation.OperationID = uniqueOperationID(path.Base(requestPath), operationIDs)
+		addOperation(spec, specPath, method, operation)
+		result.Operations++
+	}
+	return result, nil
+}
+
+// openAPIServers lists the baseURL of every environment that doesn't depend
+// on variables, described by the environment's name.
+func (cm *ConfigManager) openAPIServers() openapi3.Servers {
+	names, err := cm.ListEnvironments()
+	if err != nil {
+		return nil
+	}
+	var servers openapi3.Servers
+	seen := make(map[string]bool)
+	for _, name := range names {
+		env, err := cm.LoadEnvironment(name)
+		if err != nil || !strings.HasPrefix(env.BaseURL, "http") || strings.Contains(env.BaseURL, "{{") || seen[env.BaseURL] {
+			continue
+		}
+		seen[env.BaseURL] = true
+		servers = append(servers, &openapi3.Server{URL: strings.TrimSuffix(env.BaseURL, "/"), Description: name})
+	}
+	return servers
+}
+
+// openAPIPath turns a request URL into an OpenAPI path and its query
+// parameters: the scheme and host of an absolute URL are dropped, and
+// {{name}} placeholders in the path become {name} path parameters.
+func openAPIPath(rawURL string) (string, url.Values) {
+	rest := rawURL
+	if _, after, ok := strings.Cut(rest, "://"); ok {
+		rest = after
+		if i := strings.Index(rest, "/"); i >= 0 {
+			rest = rest[i:]
+		} else {
+			rest = "/"
+		}
+	}
+	p, rawQuery, _ := strings.Cut(rest, "?")
+	// A leading {{baseURL}}-style variable stands for the server.
+	if loc := templateVarPattern.FindStringIndex(p); loc != nil && loc[0] == 0 {
+		p = p[loc[1]:]
+	}
+	p = templateVarPattern.ReplaceAllString(p, "{$1}")
+	if !strings.HasPrefix(p, "/") {
+		p = "/" + p
+	}
+	query, _ := url.ParseQuery(rawQuery)
+	return p, query
+}
+
+// openAPIOperation describes one request.
+func (cm *ConfigManager) openAPIOperation(requestPath string, config *RequestConfig, specPath string, query url.Values, history []*HistoryEntry) (*openapi3.Operation, []string) {
+	var warnings []string
+	operation := openapi3.NewOperation()
+	operation.Summary = config.Name
+	operation.Description = config.Description
+	if dir := path.Dir(requestPath); dir != "." {
+		operation.Tags = []string{dir}
+	}
+
+	for _, match := range pathParamPattern.FindAllStringSubmatch(specPath, -1) {
+		parameter := openapi3.NewPathParameter(match[1]).WithSchema(openapi3.NewStringSchema())
+		if value := config.PathParams[match[1]]; value != "" && !strings.Contains(value, "{{") {
+			parameter.Example = value
+		}
+		operation.AddParameter(parameter)
+	}
+
+	params := make(map[string][]string)
+	for name, values := range query {
+		params[name] = values
+	}
+	for name, value := range docsParams(config.Params) {
+		params[name] = []string{value}
+	}
+	for _, name := range sortedKeys(params) {
+		parameter := openapi3.NewQueryParameter(name).WithSchema(openapi3.NewStringSchema())
+		if value := params[name][0]; value != "" && !strings.Contains(value, "{{") {
+			parameter.Example = value
+		}
+		operation.AddParameter(parameter)
+	}
+
+	contentType := "application/json"
+	for _, name := range sortedKeys(config.Headers) {
+		switch http.CanonicalHeaderKey(name) {
+		case "Content-Type":
+			contentType = config.Headers[name]
+			continue
+		case "Accept", "Authorization":
+			// Described by the responses and by the server's security
+			// scheme, which OpenAPI doesn't allow as header parameters.
+			continue
+		}
+		parameter := openapi3.NewHeaderParameter(name).WithSchema(openapi3.NewStringSchema())
+		if value := config.Headers[name]; !strings.Contains(value, "{{") {
+			parameter.Example = value
+		}
+		operation.AddParameter(parameter)
+	}
+	for _, name := range sortedKeys(config.Cookies) {
+		operation.AddParameter(openapi3.NewCookieParameter(name).WithSchema(openapi3.NewStringSchema()))
+	}
+
+	if body, warning := cm.openAPIRequestBody(requestPath, config, contentType); body != nil {
+		operation.RequestBody = &openapi3.RequestBodyRef{Value: body}
+	} else if warning != "" {
+		warnings = append(warnings, warning)
+	}
+
+	operation.Responses = openAPIResponses(history)
+	return operation, warnings
+}
+
+// openAPIRequestBody describes the request body from the inline body and
+// the body templates. JSON bodies contribute one merged schema; the active
+// body is the example.
+func (cm *ConfigManager) openAPIRequestBody(requestPath string, config *RequestConfig, contentType string) (*openapi3.RequestBody, string) {
+	bodies := cm.docsBodies(requestPath, config)
+	if len(bodies) == 0 {
+		return nil, ""
+	}
+	mediaType := openapi3.NewMediaType()
+	var schema *openapi3.Schema
+	for _, body := range bodies {
+		value, ok := parseTemplateJSON(body.Content)
+		if !ok {
+			continue
+		}
+		schema = mergeSchemas(schema, inferSchema(value))
+		if body.Active || mediaType.Example == nil {
+			mediaType.Example = value
+		}
+	}
+	if schema == nil {
+		if isJSONContentType(contentType) {
+			return nil, fmt.Sprintf("%s: body is not JSON; no request body schema", requestPath)
+		}
+		schema = openapi3.NewStringSchema()
+		mediaType.Example = bodies[0].Content
+	}
+	mediaType.Schema = schema.NewRef()
+	return openapi3.NewRequestBody().WithRequired(true).WithContent(openapi3.Content{contentType: mediaType}), ""
+}
+
+// parseTemplateJSON parses a body that may hold {{variables}}: placeholders
+// outside strings, like {"id": {{id}}}, are read as 0 so the body's shape
+// can still be inferred.
+func parseTemplateJSON(body string) (interface{}, bool) {
+	var value interface{}
+	if json.Unmarshal([]byte(body), &value) == nil {
+		return value, true
+	}
+	if !strings.Contains(body, "{{") {
+		return nil, false
+	}
+	if json.Unmarshal([]byte(templateVarPattern.ReplaceAllString(body, "0")), &value) == nil {
+		return value, true
+	}
+	return nil, false
+}
+
+// openAPIResponses describes the responses recorded for a request, one per
+// status code, with a schema merged from up to maxSchemaSamples JSON bodies.
+// Without history the operation gets a bare default response, since
+// OpenAPI requires at least one.
+func openAPIResponses(history []*HistoryEntry) *openapi3.Responses {
+	responses := openapi3.NewResponsesWithCapacity(1)
+	if len(history) == 0 {
+		responses.Set("default", &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("No response recorded")})
+		return responses
+	}
+
+	byStatus := make(map[int][]*HistoryEntry)
+	for _, entry := range history {
+		if len(byStatus[entry.StatusCode]) < maxSchemaSamples {
+			byStatus[entry.StatusCode] = append(byStatus[entry.StatusCode], entry)
+		}
+	}
+	for status, entries := range byStatus {
+		description := http.StatusText(status)
+		if description == "" {
+			description = "Status " + strconv.Itoa(status)
+		}
+		response := openapi3.NewResponse().WithDescription(description)
+
+		// The history is newest first: the latest response is the example.
+		contentType, _, _ := strings.Cut(entries[0].Headers.Get("Content-Type"), ";")
+		if contentType = strings.TrimSpace(contentType); contentType != "" {
+			mediaType := openapi3.NewMediaType()
+			var schema *openapi3.Schema
+			for _, entry := range entries {
+				var value interface{}
+				if json.Unmarshal([]byte(entry.Body), &value) != nil {
+					continue
+				}
+				schema = mergeSchemas(schema, inferSchema(value))
+				if mediaType.Example == nil {
+					mediaType.Example = value
+				}
+			}
+			if schema == nil {
+				schema = openapi3.NewStringSchema()
+			}
+			mediaType.Schema = schema.NewRef()
+			response.Content = openapi3.Content{contentType: mediaType}
+		}
+		responses.Set(strconv.Itoa(status), &openapi3.ResponseRef{Value: response})
+	}
+	return responses
+}
+
+// inferSchema describes a decoded JSON value. Every member of an object is
+// required until another sample lacks it (see mergeSchemas).
+func inferSchema(value interface{}) *openapi3.Schema {
+	switch v := value.(type) {
+	case nil:
+		schema := openapi3.NewSchema()
+		schema.Nullable = true
+		return schema
+	case bool:
+		return openapi3.NewBoolSchema()
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+			return openapi3.NewIntegerSchema()
+		}
+		return openapi3.NewFloat64Schema()
+	case string:
+		schema := openapi3.NewStringSchema()
+		if _, err := time.Parse(time.RFC3339, v); err == nil {
+			schema.Format = "date-time"
+		}
+		return schema
+	case []interface{}:
+		var items *openapi3.Schema
+		for _, item := range v {
+			items = mergeSchemas(items, inferSchema(item))
+		}
+		if items == nil {
+			items = openapi3.NewSchema()
+		}
+		return openapi3.NewArraySchema().WithItems(items)
+	case map[string]interface{}:
+		schema := openapi3.NewObjectSchema()
+		for _, name := range sortedKeys(v) {
+			schema.WithProperty(name, inferSchema(v[name]))
+			schema.Required = append(schema.Required, name)
+		}
+		return schema
+	}
+	return openapi3.NewSchema()
+}
+
+// mergeSchemas widens a to also describe the values b describes: object
+// properties are united and only those in both stay required, array items
+// are merged, null makes the other side nullable and an integer widens to a
+// number. Otherwise differing types keep a's.
+func mergeSchemas(a, b *openapi3.Schema) *openapi3.Schema {
+	switch {
+	case a == nil:
+		return b
+	case b == nil:
+		return a
+	}
+	if a.Type == nil || len(a.Type.Slice()) == 0 {
+		b.Nullable = b.Nullable || a.Nullable
+		return b
+	}
+	if b.Type == nil || len(b.Type.Slice()) == 0 {
+		a.Nullable = a.Nullable || b.Nullable
+		return a
+	}
+	a.Nullable = a.Nullable || b.Nullable
+	switch {
+	case a.Type.Is(openapi3.TypeObject) && b.Type.Is(openapi3.TypeObject):
+		for name, property := range b.Properties {
+			if existing, ok := a.Properties[name]; ok {
+				a.Properties[name] = mergeSchemas(existing.Value, property.Value).NewRef()
+			} else {
+				a.WithProperty(name, property.Value)
+			}
+		}
+		a.Required = slices.DeleteFunc(a.Required, func(name string) bool {
+			return !slices.Contains(b.Required, name)
+		})
+		if len(a.Required) == 0 {
+			a.Required = nil
+		}
+	case a.Type.Is(openapi3.TypeArray) && b.Type.Is(openapi3.TypeArray):
+		if a.Items != nil && b.Items != nil {
+			a.Items = mergeSchemas(a.Items.Value, b.Items.Value).NewRef()
+		} else if a.Items == nil {
+			a.Items = b.Items
+		}
+	case a.Type.Is(openapi3.TypeInteger) && b.Type.Is(openapi3.TypeNumber):
+		a.Type = b.Type
+		a.Format = b.Format
+	case a.Type.Is(openapi3.TypeString) && b.Type.Is(openapi3.TypeString) && a.Format != b.Format:
+		a.Format = ""
+	}
+	return a
+}
+
+// EncodeOpenAPI encodes spec as YAML, or as indented JSON when asJSON is
+// set.
+func EncodeOpenAPI(spec *openapi3.T, asJSON bool) ([]byte, error) {
+	data, err := json.MarshalIndent(spec, "", "  ")
+	if err == nil && !asJSON {
+		data, err = jsonToYAML(data)
+	} else {
+		data = append(data, '\n')
+	}
+	if err != nil {
+		return nil, fmt.Errorf("encoding OpenAPI document: %w", err)
+	}
+	return data, nil
+}
+
+// uniqueOperationID returns name, suffixed with a number when another
+// operation already uses it.
+func uniqueOperationID(name string, used map[string]bool) string {
+	id := name
+	for i := 2; used[id]; i++ {
+		id = fmt.Sprintf("%s-%d", name, i)
+	}
+	used[id] = true
+	return id
+}
@@ -0,0 +1,426 @@
+// openapigen.go
+package apiman
+
+import (
+	"encoding/json"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// maxSchemaDepth stops example generation and schema inlining from
+// following recursive schemas forever.
+const maxSchemaDepth = 8
+
+// RequestSchema is the part of an OpenAPI operation a generated request
+// keeps for validation: JSON Schemas for the request body and for the
+// response of each status code ("200", "4XX", "default").
+type RequestSchema struct {
+	Body      map[string]interface{}    `json:"body,omitempty"`
+	Responses map[string]ResponseSchema `json:"responses,omitempty"`
+}
+
+// ResponseSchema describes one documented response.
+type ResponseSchema struct {
+	ContentTypes []string               `json:"contentTypes,omitempty"`
+	Body         map[string]interface{} `json:"body,omitempty"`
+}
+
+// jsonMediaType returns the JSON media type of content, if it has one.
+func jsonMediaType(content openapi3.Content) (string, *openapi3.MediaType) {
+	for _, name := range sortedKeys(content) {
+		if isJSONContentType(name) {
+			return name, content[name]
+		}
+	}
+	return "", nil
+}
+
+func isJSONContentType(contentType string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.TrimSpace(strings.ToLower(mediaType))
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// exampleRequestBody returns the content type and an example body for an
+// operation's request body: the spec's own example when it has one,
+// otherwise a value built from the schema.
+func exampleRequestBody(body *openapi3.RequestBodyRef) (string, string) {
+	if body == nil || body.Value == nil || len(body.Value.Content) == 0 {
+		return "", ""
+	}
+	contentType, media := jsonMediaType(body.Value.Content)
+	if media == nil {
+		// Only JSON bodies can be generated; keep the declared type.
+		return sortedKeys(body.Value.Content)[0], ""
+	}
+
+	example := media.Example
+	if example == nil {
+		for _, name := range sortedKeys(media.Examples) {
+			if ref := media.Examples[name]; ref != nil && ref.Value != nil && ref.Value.Value != nil {
+				example = ref.Value.Value
+				break
+			}
+		}
+	}
+	if example == nil && media.Schema != nil {
+		example = exampleValue(media.Schema, 0)
+	}
+	if example == nil {
+		return contentType, ""
+	}
+	data, err := json.MarshalIndent(example, "", "  ")
+	if err != nil {
+		return contentType, ""
+	}
+	return contentType, string(data)
+}
+
+// exampleValue builds a value matching schema, preferring its example,
+// default and first enum value. Objects include their required properties,
+// or every property when none are required; read-only properties are left
+// out since they aren't sent.
+func exampleValue(ref *openapi3.SchemaRef, depth int) interface{} {
+	if ref == nil || ref.Value == nil || depth > maxSchemaDepth {
+		return nil
+	}
+	schema := ref.Value
+	switch {
+	case schema.Example != nil:
+		return schema.Example
+	case schema.Default != nil:
+		return schema.Default
+	case len(schema.Enum) > 0:
+		return schema.Enum[0]
+	case len(schema.AllOf) > 0:
+		merged := map[string]interface{}{}
+		for _, part := range schema.AllOf {
+			if object, ok := exampleValue(part, depth+1).(map[string]interface{}); ok {
+				maps.Copy(merged, object)
+			}
+		}
+		maps.Copy(merged, exampleObject(schema, depth))
+		return merged
+	case len(schema.OneOf) > 0:
+		return exampleValue(schema.OneOf[0], depth+1)
+	case len(schema.AnyOf) > 0:
+		return exampleValue(schema.AnyOf[0], depth+1)
+	}
+
+	switch {
+	case schema.Type.Is("object") || (schema.Type == nil && len(schema.Properties) > 0):
+		return exampleObject(schema, depth)
+	case schema.Type.Is("array"):
+		if item := exampleValue(schema.Items, depth+1); item != nil {
+			return []interface{}{item}
+		}
+		return []interface{}{}
+	case schema.Type.Is("string"):
+		return exampleString(schema.Format)
+	case schema.Type.Is("integer"):
+		if schema.Min != nil {
+			return int64(*schema.Min)
+		}
+		return 0
+	case schema.Type.Is("number"):
+		if schema.Min != nil {
+			return *schema.Min
+		}
+		return 0
+	case schema.Type.Is("boolean"):
+		return false
+	}
+	return nil
+}
+
+func exampleObject(schema *openapi3.Schema, depth int) map[string]interface{} {
+	names := schema.Required
+	if len(names) == 0 {
+		names = sortedKeys(schema.Properties)
+	}
+	object := map[string]interface{}{}
+	for _, name := range names {
+		property := schema.Properties[name]
+		if property == nil || property.Value == nil || property.Value.ReadOnly {
+			continue
+		}
+		object[name] = exampleValue(property, depth+1)
+	}
+	return object
+}
+
+func exampleString(format string) string {
+	switch format {
+	case "date-time":
+		return "2024-01-01T00:00:00Z"
+	case "date":
+		return "2024-01-01"
+	case "email":
+		return "user@example.com"
+	case "uuid":
+		return "00000000-0000-0000-0000-000000000000"
+	case "uri", "url":
+		return "https://example.com"
+	case "hostname":
+		return "example.com"
+	case "ipv4":
+		return "192.0.2.1"
+	case "byte":
+		return "ZXhhbXBsZQ=="
+	case "password":
+		return "********"
+	default:
+		return "string"
+	}
+}
+
+// parameterValue returns the value a generated request starts with for a
+// parameter: its example, default or first enum value, or a {{name}}
+// placeholder for a required parameter without one. Optional parameters
+// without a value are left empty, which leaves them out of the request.
+func parameterValue(parameter *openapi3.Parameter) string {
+	if value := defaultParameterValue(parameter); value != "" {
+		return value
+	}
+	if parameter.Required && parameter.In != "path" {
+		return "{{" + parameter.Name + "}}"
+	}
+	return ""
+}
+
+// requestSchema returns the schemas a generated request records for
+// operation, or nil when the spec documents none.
+func requestSchema(operation *openapi3.Operation) *RequestSchema {
+	schema := &RequestSchema{}
+	if body := operation.RequestBody; body != nil && body.Value != nil {
+		if _, media := jsonMediaType(body.Value.Content); media != nil && media.Schema != nil {
+			schema.Body = jsonSchema(media.Schema, nil)
+		}
+	}
+	if operation.Responses != nil {
+		for status, ref := range operation.Responses.Map() {
+			if ref == nil || ref.Value == nil {
+				continue
+			}
+			response := ResponseSchema{ContentTypes: sortedKeys(ref.Value.Content)}
+			if _, media := jsonMediaType(ref.Value.Content); media != nil && media.Schema != nil {
+				response.Body = jsonSchema(media.Schema, nil)
+			}
+			if schema.Responses == nil {
+				schema.Responses = make(map[string]ResponseSchema)
+			}
+			schema.Responses[status] = response
+		}
+	}
+	if schema.Body == nil && schema.Responses == nil {
+		return nil
+	}
+	return schema
+}
+
+// jsonSchema converts an OpenAPI schema into a self-contained JSON Schema
+// document, inlining $refs. A $ref back to a schema being converted, as in
+// recursive schemas, is replaced by {} (anything); refs lists the ones in
+// progress.
+func jsonSchema(ref *openapi3.SchemaRef, refs []string) map[string]interface{} {
+	out := map[string]interface{}{}
+	if ref == nil || ref.Value == nil || len(refs) > maxSchemaDepth {
+		return out
+	}
+	if ref.Ref != "" {
+		if slices.Contains(refs, ref.Ref) {
+			return out
+		}
+		refs = append(refs, ref.Ref)
+	}
+	schema := ref.Value
+
+	if schema.Type != nil && len(schema.Type.Slice()) > 0 {
+		types := slices.Clone(schema.Type.Slice())
+		if schema.Nullable && !slices.Contains(types, "null") {
+			types = append(types, "null")
+		}
+		if len(types) == 1 {
+			out["type"] = types[0]
+		} else {
+			out["type"] = types
+		}
+	}
+	if schema.Format != "" {
+		out["format"] = schema.Format
+	}
+	if len(schema.Enum) > 0 {
+		out["enum"] = schema.Enum
+	}
+	if schema.Pattern != "" {
+		out["pattern"] = schema.Pattern
+	}
+	if schema.MinLength > 0 {
+		out["minLength"] = schema.MinLength
+	}
+	if schema.MaxLength != nil {
+		out["maxLength"] = *schema.MaxLength
+	}
+	if schema.Min != nil {
+		out["minimum"] = *schema.Min
+		if schema.ExclusiveMin {
+			out["exclusiveMinimum"] = true
+		}
+	}
+	if schema.Max != nil {
+		out["maximum"] = *schema.Max
+		if schema.ExclusiveMax {
+			out["exclusiveMaximum"] = true
+		}
+	}
+	if schema.MinItems > 0 {
+		out["minItems"] = schema.MinItems
+	}
+	if schema.MaxItems != nil {
+		out["maxItems"] = *schema.MaxItems
+	}
+	if schema.Items != nil {
+		out["items"] = jsonSchema(schema.Items, refs)
+	}
+	if len(schema.Required) > 0 {
+		out["required"] = schema.Required
+	}
+	if len(schema.Properties) > 0 {
+		properties := map[string]interface{}{}
+		for name, property := range schema.Properties {
+			properties[name] = jsonSchema(property, refs)
+		}
+		out["properties"] = properties
+	}
+	if has := schema.AdditionalProperties.Has; has != nil && !*has {
+		out["additionalProperties"] = false
+	} else if schema.AdditionalProperties.Schema != nil {
+		out["additionalProperties"] = jsonSchema(schema.AdditionalProperties.Schema, refs)
+	}
+	for keyword, parts := range map[string]openapi3.SchemaRefs{"allOf": schema.AllOf, "oneOf": schema.OneOf, "anyOf": schema.AnyOf} {
+		if len(parts) == 0 {
+			continue
+		}
+		var schemas []interface{}
+		for _, part := range parts {
+			schemas = append(schemas, jsonSchema(part, refs))
+		}
+		out[keyword] = schemas
+	}
+	if schema.ReadOnly {
+		out["readOnly"] = true
+	}
+	if schema.WriteOnly {
+		out["writeOnly"] = true
+	}
+	return out
+}
+
+// openAPIEnvironment builds an environment for a spec from its first server
+// and its security scheme, with empty credentials to fill in. It reports
+// false when the spec declares neither.
+func openAPIEnvironment(spec *openapi3.T) (Environment, bool) {
+	env := Environment{
+		Headers:   map[string]string{"Content-Type": "application/json"},
+		Cookies:   map[string]string{},
+		Auth:      map[string]string{},
+		Variables: map[string]string{},
+	}
+	found := false
+	if len(spec.Servers) > 0 && spec.Servers[0] != nil {
+		server := spec.Servers[0]
+		env.BaseURL = server.URL
+		for name, variable := range server.Variables {
+			if variable != nil {
+				env.BaseURL = strings.ReplaceAll(env.BaseURL, "{"+name+"}", variable.Default)
+			}
+		}
+		env.BaseURL = strings.TrimSuffix(env.BaseURL, "/")
+		found = true
+	}
+	if scheme := primarySecurityScheme(spec); scheme != nil {
+		applySecurityScheme(&env, scheme)
+		found = true
+	}
+	return env, found
+}
+
+// primarySecurityScheme returns the scheme named first by the spec's
+// top-level security requirements, or its only scheme.
+func primarySecurityScheme(spec *openapi3.T) *openapi3.SecurityScheme {
+	if spec.Components == nil || len(spec.Components.SecuritySchemes) == 0 {
+		return nil
+	}
+	schemes := spec.Components.SecuritySchemes
+	for _, requirement := range spec.Security {
+		for _, name := range sortedKeys(requirement) {
+			if ref := schemes[name]; ref != nil && ref.Value != nil {
+				return ref.Value
+			}
+		}
+	}
+	if len(schemes) == 1 {
+		for _, ref := range schemes {
+			if ref != nil {
+				return ref.Value
+			}
+		}
+	}
+	return nil
+}
+
+// applySecurityScheme stubs out env's auth for scheme.
+func applySecurityScheme(env *Environment, scheme *openapi3.SecurityScheme) {
+	switch scheme.Type {
+	case "http":
+		switch strings.ToLower(scheme.Scheme) {
+		case "bearer":
+			env.Auth["type"] = "bearer"
+			env.Auth["token"] = ""
+		case "basic":
+			env.Auth["type"] = "basic"
+			env.Auth["username"] = ""
+			env.Auth["password"] = ""
+		}
+	case "apiKey":
+		switch scheme.In {
+		case "header":
+			env.Auth["type"] = "api-key"
+			env.Auth["header"] = scheme.Name
+			env.Auth["key"] = ""
+		case "query":
+			env.Params = map[string]interface{}{scheme.Name: ""}
+		case "cookie":
+			env.Cookies[scheme.Name] = ""
+		}
+	case "oauth2":
+		if scheme.Flows == nil {
+			return
+		}
+		env.Auth["type"] = "oauth2"
+		env.Auth["clientId"] = ""
+		env.Auth["clientSecret"] = ""
+		for _, flow := range []struct {
+			grant string
+			flow  *openapi3.OAuthFlow
+		}{
+			{"client_credentials", scheme.Flows.ClientCredentials},
+			{"authorization_code", scheme.Flows.AuthorizationCode},
+			{"password", scheme.Flows.Password},
+		} {
+			if flow.flow == nil {
+				continue
+			}
+			env.Auth["grantType"] = flow.grant
+			env.Auth["tokenURL"] = flow.flow.TokenURL
+			if flow.flow.AuthorizationURL != "" {
+				env.Auth["authURL"] = flow.flow.AuthorizationURL
+			}
+			env.Auth["scope"] = strings.Join(sortedKeys(flow.flow.Scopes), " ")
+			break
+		}
+	}
+}
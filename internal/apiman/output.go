@@ -0,0 +1,234 @@
+// output.go
+package apiman
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// outputFormats are the values accepted by api-man run --output.
+var outputFormats = []string{"pretty", "json", "raw", "headers", "status", "table"}
+
+// responseEnvelope is the --output json form of an execution, meant to be
+// piped into jq and other tools.
+type responseEnvelope struct {
+	Request     string      `json:"request"`
+	Environment string      `json:"environment"`
+	Method      string      `json:"method"`
+	URL         string      `json:"url"`
+	Status      string      `json:"status"`
+	StatusCode  int         `json:"statusCode"`
+	Headers     http.Header `json:"headers"`
+	DurationMS  int64       `json:"durationMs"`
+	BudgetMS    int64       `json:"budgetMs,omitempty"`
+	OverBudget  bool        `json:"overBudget,omitempty"`
+	TraceID     string      `json:"traceId,omitempty"`
+	RequestID   string      `json:"requestId,omitempty"`
+	Size        int         `json:"size"`
+	// ContentEncoding and EncodedSize are set when a compressed body was
+	// decoded; Size is then the decoded size.
+	ContentEncoding string `json:"contentEncoding,omitempty"`
+	EncodedSize     int    `json:"encodedSize,omitempty"`
+	// Cached is set when the body was served from the response cache
+	// after a 304 Not Modified.
+	Cached bool `json:"cached,omitempty"`
+	// Body is embedded as JSON when the response is JSON and as a string
+	// otherwise.
+	Body interface{} `json:"body"`
+}
+
+// writeResult writes result to out in the given format:
+//
+//	pretty   status, headers and a pretty-printed body (the default);
+//	         binary bodies are summarised rather than printed and text
+//	         bodies are cut to maxBody bytes when it is positive
+//	json     a responseEnvelope
+//	raw      the body exactly as received
+//	headers  the response headers, one per line
+//	status   the status code
+//	table    a JSON array of objects (or a single object) as columns
+func writeResult(out io.Writer, result *ExecutionResult, format string, maxBody int) error {
+	switch format {
+	case "", "pretty":
+		fmt.Fprintf(out, "Status: %s", statusStyle(result.StatusCode).Render(result.Status))
+		if result.OverBudget() {
+			fmt.Fprint(out, "  "+budgetStyle.Render("⚠️  "+result.budgetNote()))
+		}
+		fmt.Fprintln(out)
+		if result.ContentEncoding != "" {
+			fmt.Fprintf(out, "Size: %s\n", result.compressionNote())
+		}
+		if result.RequestID != "" {
+			fmt.Fprintf(out, "Request ID: %s\n", result.RequestID)
+		}
+		if result.TraceID != "" {
+			fmt.Fprintf(out, "Trace ID: %s\n", result.TraceID)
+		}
+		fmt.Fprintf(out, "Headers:\n")
+		writeHeaders(out, result.Headers, "  ")
+		fmt.Fprintf(out, "\nResponse Body:\n")
+		if isBinaryResponse(result) {
+			fmt.Fprintf(out, "(binary data, %s)\n", formatSize(int64(len(result.Body))))
+			return nil
+		}
+		body, note := truncateBody(formatResponseBody(result.Body, result.Headers.Get("Content-Type")), maxBody)
+		fmt.Fprintln(out, highlightBody(body, result.Headers.Get("Content-Type"))+note)
+		return nil
+	case "json":
+		envelope := responseEnvelope{
+			Request:         result.Request,
+			Environment:     result.Environment,
+			Method:          result.Method,
+			URL:             result.URL,
+			Status:          result.Status,
+			StatusCode:      result.StatusCode,
+			Headers:         result.Headers,
+			DurationMS:      result.DurationMS(),
+			BudgetMS:        result.BudgetMS,
+			OverBudget:      result.OverBudget(),
+			TraceID:         result.TraceID,
+			RequestID:       result.RequestID,
+			Size:            len(result.Body),
+			Body:            string(result.Body),
+			ContentEncoding: result.ContentEncoding,
+			EncodedSize:     result.EncodedSize,
+			Cached:          result.Cached,
+		}
+		if json.Valid(result.Body) {
+			envelope.Body = json.RawMessage(result.Body)
+		}
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(envelope)
+	case "raw":
+		_, err := out.Write(result.Body)
+		return err
+	case "headers":
+		writeHeaders(out, result.Headers, "")
+		return nil
+	case "status":
+		fmt.Fprintln(out, result.StatusCode)
+		return nil
+	case "table":
+		return writeTable(out, result.Body)
+	default:
+		return fmt.Errorf("unknown output format %q (expected one of %s)", format, strings.Join(outputFormats, ", "))
+	}
+}
+
+func writeHeaders(out io.Writer, headers http.Header, indent string) {
+	for _, key := range sortedKeys(headers) {
+		for _, value := range headers[key] {
+			fmt.Fprintf(out, "%s%s: %s\n", indent, headerNameStyle.Render(key), value)
+		}
+	}
+}
+
+// writeTable renders a JSON array of objects with one column per key. A
+// single object is shown as a two-column field/value table.
+func writeTable(out io.Writer, body []byte) error {
+	var data interface{}
+	if err := json.Unmarshal(body, &data); err != nil {
+		return fmt.Errorf("table output needs a JSON response: %w", err)
+	}
+
+	var rows []map[string]interface{}
+	switch v := data.(type) {
+	case []interface{}:
+		for i, item := range v {
+			row, ok := item.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("table output needs an array of objects, item %d is %s", i, jsonTypeName(item))
+			}
+			rows = append(rows, row)
+		}
+	case map[string]interface{}:
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "FIELD\tVALUE")
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fmt.Fprintf(w, "%s\t%s\n", key, tableCell(v[key]))
+		}
+		return w.Flush()
+	default:
+		return fmt.Errorf("table output needs a JSON object or array, got %s", jsonTypeName(data))
+	}
+
+	// encoding/json doesn't keep key order, so columns follow the sorted
+	// keys of each row in turn.
+	var columns []string
+	seen := map[string]bool{}
+	for _, row := range rows {
+		keys := make([]string, 0, len(row))
+		for key := range row {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if !seen[key] {
+				seen[key] = true
+				columns = append(columns, key)
+			}
+		}
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, strings.ToUpper(strings.Join(columns, "\t")))
+	for _, row := range rows {
+		cells := make([]string, len(columns))
+		for i, column := range columns {
+			if value, ok := row[column]; ok {
+				cells[i] = tableCell(value)
+			}
+		}
+		fmt.Fprintln(w, strings.Join(cells, "\t"))
+	}
+	return w.Flush()
+}
+
+// tableCell formats a JSON value for one table cell; nested values are
+// shown as compact JSON.
+func tableCell(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return strings.ReplaceAll(v, "\n", " ")
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case map[string]interface{}, []interface{}:
+		data, _ := json.Marshal(v)
+		return string(data)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func jsonTypeName(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case map[string]interface{}:
+		return "an object"
+	case []interface{}:
+		return "an array"
+	case string:
+		return "a string"
+	case float64:
+		return "a number"
+	case bool:
+		return "a boolean"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
@@ -0,0 +1,557 @@
+// pact.go
+package apiman
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Contracts are Pact files (specification v2): the interactions a consumer
+// expects of a provider. api-man writes them from the history, so the
+// requests a consumer team runs become its contract, and verifies a
+// provider environment against them by sending each request and checking
+// the response meets the expectation.
+
+// PactFile is a Pact contract between one consumer and one provider.
+type PactFile struct {
+	Consumer     PactParticipant        `json:"consumer"`
+	Provider     PactParticipant        `json:"provider"`
+	Interactions []PactInteraction      `json:"interactions"`
+	Metadata     map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// PactParticipant names a consumer or provider.
+type PactParticipant struct {
+	Name string `json:"name"`
+}
+
+// PactInteraction is one request the consumer sends and the response it
+// expects.
+type PactInteraction struct {
+	Description string `json:"description"`
+	// ProviderState is the state the provider must be in, which api-man
+	// can't set up: verification only reports it.
+	ProviderState string       `json:"providerState,omitempty"`
+	Request       PactRequest  `json:"request"`
+	Response      PactResponse `json:"response"`
+}
+
+// PactRequest is the request of an interaction. Query is a query string in
+// v2 pacts and a map of values in v3 ones; both are read.
+type PactRequest struct {
+	Method  string            `json:"method"`
+	Path    string            `json:"path"`
+	Query   interface{}       `json:"query,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    interface{}       `json:"body,omitempty"`
+}
+
+// PactResponse is the response a consumer expects. Only the headers listed
+// are checked, and extra members in response objects are allowed.
+type PactResponse struct {
+	Status        int                         `json:"status"`
+	Headers       map[string]string           `json:"headers,omitempty"`
+	Body          interface{}                 `json:"body,omitempty"`
+	MatchingRules map[string]PactMatchingRule `json:"matchingRules,omitempty"`
+}
+
+// PactMatchingRule relaxes the check of the values at a path such as
+// $.body.items[*].id: "type" only requires the same JSON type (and applies
+// to everything beneath the path), "regex" a string matching Regex. Min and
+// Max bound the length of arrays matched by type.
+type PactMatchingRule struct {
+	Match string `json:"match,omitempty"`
+	Regex string `json:"regex,omitempty"`
+	Min   *int   `json:"min,omitempty"`
+	Max   *int   `json:"max,omitempty"`
+}
+
+// pactHeaders are the request and response headers contracts keep; others,
+// such as auth, belong to the environment rather than the contract.
+var pactHeaders = []string{"Content-Type", "Accept"}
+
+// PactExportOptions selects what ExportPact writes.
+type PactExportOptions struct {
+	Consumer, Provider string
+	// Target limits the contract to a request or a directory of requests.
+	Target string
+	// Environment takes the interactions from executions in this
+	// environment only.
+	Environment string
+	// MatchTypes checks response bodies by type instead of by value, for
+	// responses with values that differ between runs, such as IDs.
+	MatchTypes bool
+}
+
+// ExportPact writes a contract with an interaction for every request with a
+// response in the history: the latest execution's request and response.
+// Requests that have never been run are returned as warnings.
+func (cm *ConfigManager) ExportPact(opts PactExportOptions) (*PactFile, []string, error) {
+	var paths []string
+	var err error
+	if opts.Target == "" {
+		paths, err = cm.RequestPaths()
+	} else {
+		paths, err = cm.ResolveRequestTargets(opts.Target)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("resolving requests: %w", err)
+	}
+	runs, err := cm.latestRuns(HistoryQuery{Environment: opts.Environment})
+	if err != nil {
+		return nil, nil, err
+	}
+	latest := make(map[string]*HistoryEntry)
+	for _, entry := range runs {
+		if entry.Error == "" && entry.StatusCode > 0 {
+			latest[entry.Request] = entry
+		}
+	}
+
+	pact := &PactFile{
+		Consumer:     PactParticipant{Name: opts.Consumer},
+		Provider:     PactParticipant{Name: opts.Provider},
+		Interactions: []PactInteraction{},
+		Metadata:     map[string]interface{}{"pactSpecification": map[string]string{"version": "2.0.0"}},
+	}
+	var warnings []string
+	for _, requestPath := range paths {
+		entry, ok := latest[requestPath]
+		if !ok {
+			warnings = append(warnings, fmt.Sprintf("%s has no response in the history; run it first", requestPath))
+			continue
+		}
+		description := requestPath
+		if config, err := cm.LoadRequest(requestPath); err == nil && config.Name != "" {
+			description = config.Name + " (" + requestPath + ")"
+		}
+		interaction, err := cm.pactInteraction(description, entry, opts.MatchTypes)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", requestPath, err)
+		}
+		pact.Interactions = append(pact.Interactions, *interaction)
+	}
+	return pact, warnings, nil
+}
+
+// pactInteraction describes the exchange recorded in entry.
+func (cm *ConfigManager) pactInteraction(description string, entry *HistoryEntry, matchTypes bool) (*PactInteraction, error) {
+	target, err := url.Parse(entry.URL)
+	if err != nil {
+		return nil, fmt.Errorf("parsing recorded URL: %w", err)
+	}
+	// The provider's base URL comes from the environment verifying the
+	// contract, so paths are relative to the recorded one.
+	path := target.EscapedPath()
+	if base, err := url.Parse(cm.recordedBaseURL(entry)); err == nil && base.Host == target.Host {
+		path = "/" + strings.TrimPrefix(strings.TrimPrefix(path, strings.TrimSuffix(base.EscapedPath(), "/")), "/")
+	}
+	interaction := &PactInteraction{
+		Description: description,
+		Request: PactRequest{
+			Method:  entry.Method,
+			Path:    path,
+			Headers: pactHeaderValues(entry.RequestHeaders),
+			Body:    pactBody(entry.RequestBody, entry.RequestHeaders.Get("Content-Type")),
+		},
+		Response: PactResponse{
+			Status:  entry.StatusCode,
+			Headers: pactHeaderValues(entry.Headers),
+			Body:    pactBody(entry.Body, entry.Headers.Get("Content-Type")),
+		},
+	}
+	if target.RawQuery != "" {
+		interaction.Request.Query = target.RawQuery
+	}
+	if matchTypes && interaction.Response.Body != nil {
+		interaction.Response.MatchingRules = map[string]PactMatchingRule{"$.body": {Match: "type"}}
+	}
+	return interaction, nil
+}
+
+func pactHeaderValues(headers http.Header) map[string]string {
+	values := make(map[string]string)
+	for _, name := range pactHeaders {
+		if value := headers.Get(name); value != "" {
+			values[name] = value
+		}
+	}
+	if len(values) == 0 {
+		return nil
+	}
+	return values
+}
+
+// pactBody returns body as a JSON value when it is JSON, as a string
+// otherwise, or nil when it is empty.
+func pactBody(body, contentType string) interface{} {
+	if body == "" {
+		return nil
+	}
+	var value interface{}
+	if strings.Contains(contentType, "json") && json.Unmarshal([]byte(body), &value) == nil {
+		return value
+	}
+	return body
+}
+
+// LoadPact reads a contract file.
+func LoadPact(path string) (*PactFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading contract: %w", err)
+	}
+	var pact PactFile
+	if err := json.Unmarshal(data, &pact); err != nil {
+		return nil, fmt.Errorf("parsing contract %s: %w", path, err)
+	}
+	return &pact, nil
+}
+
+// PactVerification is the outcome of one interaction.
+type PactVerification struct {
+	Interaction *PactInteraction `json:"interaction"`
+	// Mismatches describe how the response differs from the expectation.
+	Mismatches []string         `json:"mismatches,omitempty"`
+	Result     *ExecutionResult `json:"-"`
+	Error      string           `json:"error,omitempty"`
+}
+
+// OK reports whether the provider met the expectation.
+func (v *PactVerification) OK() bool {
+	return v.Error == "" && len(v.Mismatches) == 0
+}
+
+// VerifyPact sends the request of every interaction in pact to envName, in
+// order, with the environment's headers, cookies and auth added, and checks
+// each response against the expected one. progress, if not nil, is called
+// after each interaction; Ctrl+C (ctx) stops after the request in flight.
+func (cm *ConfigManager) VerifyPact(ctx context.Context, pact *PactFile, envName string, progress func(*PactVerification)) ([]*PactVerification, error) {
+	env, client, err := cm.environmentClient(envName)
+	if err != nil {
+		return nil, err
+	}
+	var verifications []*PactVerification
+	for i := range pact.Interactions {
+		if ctx.Err() != nil {
+			break
+		}
+		interaction := &pact.Interactions[i]
+		verification := &PactVerification{Interaction: interaction}
+		result, err := cm.sendPactRequest(ctx, client, &interaction.Request, envName, env)
+		if err != nil {
+			verification.Error = err.Error()
+		} else {
+			verification.Result = result
+			verification.Mismatches = matchPactResponse(&interaction.Response, result)
+		}
+		verifications = append(verifications, verification)
+		if progress != nil {
+			progress(verification)
+		}
+	}
+	return verifications, nil
+}
+
+// sendPactRequest sends request to env and records the execution.
+func (cm *ConfigManager) sendPactRequest(ctx context.Context, client *http.Client, request *PactRequest, envName string, env *Environment) (*ExecutionResult, error) {
+	target := strings.TrimSuffix(requestBaseURL(env.BaseURL), "/") + request.Path
+	query, err := pactQuery(request.Query)
+	if err != nil {
+		return nil, err
+	}
+	if query != "" {
+		target += "?" + query
+	}
+	var body string
+	switch value := request.Body.(type) {
+	case nil:
+	case string:
+		body = value
+	default:
+		data, err := json.Marshal(value)
+		if err != nil {
+			return nil, fmt.Errorf("encoding request body: %w", err)
+		}
+		body = string(data)
+	}
+	if err := cm.confirmSend(envName, env, request.Method, target, false); err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, request.Method, target, strings.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+	// The contract's own headers win over the environment's, then auth is
+	// applied to the finished request.
+	for key, value := range env.Headers {
+		if value != "" && !hasHeader(request.Headers, key) {
+			req.Header.Set(key, value)
+		}
+	}
+	for key, value := range request.Headers {
+		req.Header.Set(key, value)
+	}
+	if body != "" && req.Header.Get("Content-Type") == "" {
+		if _, ok := request.Body.(string); !ok {
+			req.Header.Set("Content-Type", "application/json")
+		}
+	}
+	for name, value := range env.Cookies {
+		if value != "" {
+			req.AddCookie(&http.Cookie{Name: name, Value: value})
+		}
+	}
+	if err := cm.applyAuth(req, envName, env); err != nil {
+		return nil, err
+	}
+
+	startedAt := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, cancelled(ctx, err, startedAt)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, cancelled(ctx, fmt.Errorf("reading response body: %w", err), startedAt)
+	}
+	result := &ExecutionResult{
+		Environment:    envName,
+		Method:         request.Method,
+		URL:            target,
+		Status:         resp.Status,
+		StatusCode:     resp.StatusCode,
+		Headers:        resp.Header,
+		Body:           data,
+		Duration:       time.Since(startedAt),
+		StartedAt:      startedAt,
+		RequestHeaders: req.Header,
+		RequestBody:    body,
+	}
+	if err := decodeResponse(result); err != nil {
+		return nil, err
+	}
+	cm.recordExecution(result, req.Header)
+	return result, nil
+}
+
+// pactQuery encodes an interaction's query: a v2 query string as it is, a
+// v3 map of values sorted by name.
+func pactQuery(query interface{}) (string, error) {
+	switch query := query.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return query, nil
+	case map[string]interface{}:
+		values := url.Values{}
+		for name, value := range query {
+			switch value := value.(type) {
+			case []interface{}:
+				for _, item := range value {
+					values.Add(name, fmt.Sprint(item))
+				}
+			default:
+				values.Add(name, fmt.Sprint(value))
+			}
+		}
+		return values.Encode(), nil
+	}
+	return "", fmt.Errorf("unsupported query %v (expected a string or an object)", query)
+}
+
+// matchPactResponse checks result against expected the way Pact providers
+// are verified: the status must be equal, listed headers present with the
+// same value, and the body must contain the expected one.
+func matchPactResponse(expected *PactResponse, result *ExecutionResult) []string {
+	m := &pactMatcher{rules: compilePactRules(expected.MatchingRules)}
+	if result.StatusCode != expected.Status {
+		m.fail("$.status", "expected status %d, got %d", expected.Status, result.StatusCode)
+	}
+	for _, name := range sortedKeys(expected.Headers) {
+		want := expected.Headers[name]
+		got := result.Headers.Get(name)
+		path := "$.headers." + name
+		if rule, ok := m.rule(path); ok && rule.Regex != "" {
+			m.matchRegex(path, rule.Regex, got)
+			continue
+		}
+		if normalizeHeaderValue(got) != normalizeHeaderValue(want) {
+			m.fail(path, "expected header %s %q, got %q", name, want, got)
+		}
+	}
+	if expected.Body == nil {
+		return m.mismatches
+	}
+	var actual interface{}
+	if text, ok := expected.Body.(string); ok {
+		if string(result.Body) != text {
+			m.fail("$.body", "expected body %q, got %q", truncateForDisplay(text, 60), truncateForDisplay(string(result.Body), 60))
+		}
+		return m.mismatches
+	}
+	if err := json.Unmarshal(result.Body, &actual); err != nil {
+		m.fail("$.body", "expected a JSON body: %v", err)
+		return m.mismatches
+	}
+	m.match("$.body", expected.Body, actual, false)
+	return m.mismatches
+}
+
+// normalizeHeaderValue ignores the whitespace around commas Pact allows in
+// header values.
+func normalizeHeaderValue(value string) string {
+	parts := strings.Split(value, ",")
+	for i, part := range parts {
+		parts[i] = strings.TrimSpace(part)
+	}
+	return strings.Join(parts, ",")
+}
+
+type pactRule struct {
+	pattern *regexp.Regexp
+	PactMatchingRule
+}
+
+// compilePactRules turns the paths of rules into patterns matching the
+// concrete paths of values, where [*] stands for any index and .* for any
+// member.
+func compilePactRules(rules map[string]PactMatchingRule) []pactRule {
+	compiled := make([]pactRule, 0, len(rules))
+	for _, path := range sortedKeys(rules) {
+		pattern := regexp.QuoteMeta(path)
+		pattern = strings.ReplaceAll(pattern, `\[\*\]`, `\[\d+\]`)
+		pattern = strings.ReplaceAll(pattern, `\.\*`, `\.[^.\[]+`)
+		compiled = append(compiled, pactRule{regexp.MustCompile("^" + pattern + "$"), rules[path]})
+	}
+	return compiled
+}
+
+type pactMatcher struct {
+	rules      []pactRule
+	mismatches []string
+}
+
+func (m *pactMatcher) fail(path, format string, args ...interface{}) {
+	m.mismatches = append(m.mismatches, path+": "+fmt.Sprintf(format, args...))
+}
+
+// rule returns the rule for path, preferring the one with the most
+// specific (longest) path.
+func (m *pactMatcher) rule(path string) (PactMatchingRule, bool) {
+	best, found := -1, false
+	var match PactMatchingRule
+	for _, rule := range m.rules {
+		if rule.pattern.MatchString(path) && len(rule.pattern.String()) > best {
+			best, match, found = len(rule.pattern.String()), rule.PactMatchingRule, true
+		}
+	}
+	return match, found
+}
+
+func (m *pactMatcher) matchRegex(path, pattern, value string) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		m.fail(path, "invalid regex %q: %v", pattern, err)
+		return
+	}
+	if !re.MatchString(value) {
+		m.fail(path, "expected %q to match /%s/", value, pattern)
+	}
+}
+
+// match compares actual with expected at path. byType is set beneath a
+// type rule, which applies to everything under its path.
+func (m *pactMatcher) match(path string, expected, actual interface{}, byType bool) {
+	rule, ok := m.rule(path)
+	if ok {
+		switch rule.Match {
+		case "regex":
+			text, isString := actual.(string)
+			if !isString {
+				text = jsonValueString(actual)
+			}
+			m.matchRegex(path, rule.Regex, text)
+			return
+		case "type":
+			byType = true
+		}
+		if rule.Regex != "" && rule.Match == "" {
+			m.matchRegex(path, rule.Regex, jsonValueString(actual))
+			return
+		}
+	}
+
+	switch want := expected.(type) {
+	case map[string]interface{}:
+		got, isObject := actual.(map[string]interface{})
+		if !isObject {
+			m.fail(path, "expected an object, got %s", jsonTypeName(actual))
+			return
+		}
+		keys := make([]string, 0, len(want))
+		for key := range want {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			value, present := got[key]
+			if !present {
+				m.fail(path+"."+key, "missing")
+				continue
+			}
+			m.match(path+"."+key, want[key], value, byType)
+		}
+	case []interface{}:
+		got, isArray := actual.([]interface{})
+		if !isArray {
+			m.fail(path, "expected an array, got %s", jsonTypeName(actual))
+			return
+		}
+		if byType {
+			if ok && rule.Min != nil && len(got) < *rule.Min {
+				m.fail(path, "expected at least %d item(s), got %d", *rule.Min, len(got))
+			}
+			if ok && rule.Max != nil && len(got) > *rule.Max {
+				m.fail(path, "expected at most %d item(s), got %d", *rule.Max, len(got))
+			}
+			if len(want) == 0 {
+				return
+			}
+			// Every item has the shape of the first expected one.
+			for i, item := range got {
+				m.match(path+"["+strconv.Itoa(i)+"]", want[min(i, len(want)-1)], item, true)
+			}
+			return
+		}
+		if len(got) != len(want) {
+			m.fail(path, "expected %d item(s), got %d", len(want), len(got))
+			return
+		}
+		for i := range want {
+			m.match(path+"["+strconv.Itoa(i)+"]", want[i], got[i], false)
+		}
+	default:
+		if byType {
+			if jsonTypeName(expected) != jsonTypeName(actual) {
+				m.fail(path, "expected %s, got %s", jsonTypeName(expected), jsonTypeName(actual))
+			}
+			return
+		}
+		if !reflect.DeepEqual(expected, actual) {
+			m.fail(path, "expected %s, got %s", jsonValueString(expected), jsonValueString(actual))
+		}
+	}
+}
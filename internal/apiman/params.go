@@ -0,0 +1,132 @@
+// params.go
+package apiman
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// queryParamValues converts a params block into query values. Arrays become
+// repeated keys, numbers and booleans are formatted as written, and strings
+// have {{variables}} resolved. Empty and null values are left out, like
+// empty headers, so generated requests don't send blank parameters.
+func queryParamValues(params map[string]interface{}, vars map[string]string) url.Values {
+	values := url.Values{}
+	for key, value := range params {
+		items, ok := value.([]interface{})
+		if !ok {
+			items = []interface{}{value}
+		}
+		for _, item := range items {
+			if s := formatParamValue(item, vars); s != "" {
+				values.Add(key, s)
+			}
+		}
+	}
+	return values
+}
+
+func formatParamValue(value interface{}, vars map[string]string) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return interpolate(v, vars)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return interpolate(string(data), vars)
+	}
+}
+
+// applyQueryParams merges layers of query parameters into rawURL's query
+// string. A key in a later layer replaces all of that key's earlier values,
+// including ones written directly in the URL. The URL is returned untouched
+// when there is nothing to merge.
+func applyQueryParams(rawURL string, layers ...url.Values) (string, error) {
+	merged := url.Values{}
+	for _, layer := range layers {
+		for key, values := range layer {
+			merged[key] = values
+		}
+	}
+	if len(merged) == 0 {
+		return rawURL, nil
+	}
+
+	// Split by hand rather than url.Parse so {placeholders} in the path are
+	// kept as written.
+	rest, fragment, hasFragment := strings.Cut(rawURL, "#")
+	base, rawQuery, _ := strings.Cut(rest, "?")
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return "", fmt.Errorf("parsing query string: %w", err)
+	}
+	for key, values := range merged {
+		query[key] = values
+	}
+
+	result := base + "?" + query.Encode()
+	if hasFragment {
+		result += "#" + fragment
+	}
+	return result, nil
+}
+
+// pathParamPattern matches {name} segments as written in OpenAPI paths; runs
+// of braces are matched whole so {{variables}} are not mistaken for them.
+var pathParamPattern = regexp.MustCompile(`\{+([A-Za-z_][\w.-]*)\}+`)
+
+// MissingPathParamsError lists {name} placeholders left in a request's path
+// after applying its pathParams.
+type MissingPathParamsError struct {
+	Names []string
+}
+
+func (e *MissingPathParamsError) Error() string {
+	return fmt.Sprintf("missing path parameter(s) %s: set pathParams in the request or pass --path %s=<value>",
+		strings.Join(e.Names, ", "), e.Names[0])
+}
+
+// applyPathParams replaces {name} placeholders in the path of rawURL with
+// escaped values, later layers winning. Placeholders without a value are
+// reported in a *MissingPathParamsError.
+func applyPathParams(rawURL string, vars map[string]string, layers ...map[string]string) (string, error) {
+	values := mergeVariables(layers...)
+	path, query, hasQuery := strings.Cut(rawURL, "?")
+
+	var missing []string
+	path = pathParamPattern.ReplaceAllStringFunc(path, func(match string) string {
+		if strings.HasPrefix(match, "{{") || strings.HasSuffix(match, "}}") {
+			return match
+		}
+		name := match[1 : len(match)-1]
+		value, ok := values[name]
+		if !ok || value == "" {
+			if !slices.Contains(missing, name) {
+				missing = append(missing, name)
+			}
+			return match
+		}
+		return url.PathEscape(interpolate(value, vars))
+	})
+	if len(missing) > 0 {
+		return "", &MissingPathParamsError{Names: missing}
+	}
+
+	if hasQuery {
+		return path + "?" + query, nil
+	}
+	return path, nil
+}
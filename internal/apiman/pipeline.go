@@ -0,0 +1,401 @@
+// pipeline.go
+package apiman
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Pipeline is a declarative CI run over the workspace: every stage is
+// executed once per environment and the results are written as a
+// machine-readable summary plus a human-readable report.
+//
+//	name: smoke
+//	environments: [dev, staging]
+//	failFast: false
+//	artifacts:
+//	  dir: api-man-artifacts
+//	  responses: failed   # all | failed | none
+//	  publish: [openapi.yaml]
+//	stages:
+//	  - name: health
+//	    request: users/get-users
+//	    assert: {status: 200, maxLatencyMs: 500}
+//	  - name: login
+//	    flow:
+//	      - request: auth/login
+//	        assert: {status: 200}
+//	      - request: users/me
+//	  - name: signup
+//	    chain: signup-flow   # chains/signup-flow.json
+type Pipeline struct {
+	Name         string            `yaml:"name"`
+	Environments []string          `yaml:"environments"`
+	FailFast     bool              `yaml:"failFast"`
+	Artifacts    PipelineArtifacts `yaml:"artifacts"`
+	Stages       []PipelineStage   `yaml:"stages"`
+}
+
+type PipelineArtifacts struct {
+	// Dir receives summary.json, report.md and saved responses.
+	Dir string `yaml:"dir"`
+	// Responses selects which response bodies are saved: all, failed or none.
+	Responses string `yaml:"responses"`
+	// Publish lists extra files (globs allowed) copied into Dir/files.
+	Publish []string `yaml:"publish"`
+}
+
+// PipelineStage runs a single request, an ordered flow of requests or a
+// workspace chain. A flow or chain stops at its first failing step.
+type PipelineStage struct {
+	Name         string         `yaml:"name"`
+	Request      string         `yaml:"request"`
+	Chain        string         `yaml:"chain"`
+	Assert       *Assertions    `yaml:"assert"`
+	Flow         []PipelineStep `yaml:"flow"`
+	Environments []string       `yaml:"environments"`
+}
+
+type PipelineStep struct {
+	Request string      `yaml:"request"`
+	Assert  *Assertions `yaml:"assert"`
+}
+
+const defaultArtifactsDir = "api-man-artifacts"
+
+// LoadPipeline reads and validates a pipeline YAML file.
+func LoadPipeline(path string) (*Pipeline, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading pipeline: %w", err)
+	}
+
+	var p Pipeline
+	if err := yaml.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("parsing pipeline: %w", err)
+	}
+	if p.Name == "" {
+		p.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	if p.Artifacts.Dir == "" {
+		p.Artifacts.Dir = defaultArtifactsDir
+	}
+	switch p.Artifacts.Responses {
+	case "":
+		p.Artifacts.Responses = "failed"
+	case "all", "failed", "none":
+	default:
+		return nil, fmt.Errorf("artifacts.responses must be all, failed or none, got %q", p.Artifacts.Responses)
+	}
+
+	if len(p.Environments) == 0 {
+		return nil, fmt.Errorf("pipeline must list at least one environment")
+	}
+	if len(p.Stages) == 0 {
+		return nil, fmt.Errorf("pipeline must define at least one stage")
+	}
+	for i := range p.Stages {
+		stage := &p.Stages[i]
+		if stage.Name == "" {
+			stage.Name = fmt.Sprintf("stage-%d", i+1)
+		}
+		kinds := 0
+		for _, set := range []bool{stage.Request != "", len(stage.Flow) > 0, stage.Chain != ""} {
+			if set {
+				kinds++
+			}
+		}
+		switch {
+		case kinds > 1:
+			return nil, fmt.Errorf("stage %q: use only one of request, flow or chain", stage.Name)
+		case kinds == 0:
+			return nil, fmt.Errorf("stage %q: request, flow or chain is required", stage.Name)
+		case stage.Request != "":
+			stage.Flow = []PipelineStep{{Request: stage.Request, Assert: stage.Assert}}
+		}
+		for j, step := range stage.Flow {
+			if step.Request == "" {
+				return nil, fmt.Errorf("stage %q: flow step %d is missing request", stage.Name, j+1)
+			}
+		}
+	}
+
+	return &p, nil
+}
+
+// PipelineSummary is the machine-readable outcome of a pipeline run,
+// written to <artifacts>/summary.json.
+type PipelineSummary struct {
+	Pipeline   string        `json:"pipeline"`
+	StartedAt  time.Time     `json:"startedAt"`
+	DurationMS int64         `json:"durationMs"`
+	Passed     bool          `json:"passed"`
+	Total      int           `json:"total"`
+	Failed     int           `json:"failed"`
+	Skipped    int           `json:"skipped"`
+	Stages     []StageResult `json:"stages"`
+}
+
+type StageResult struct {
+	Environment string       `json:"environment"`
+	Stage       string       `json:"stage"`
+	Passed      bool         `json:"passed"`
+	Skipped     bool         `json:"skipped,omitempty"`
+	DurationMS  int64        `json:"durationMs"`
+	Steps       []StepResult `json:"steps"`
+}
+
+type StepResult struct {
+	Request    string            `json:"request"`
+	Method     string            `json:"method,omitempty"`
+	URL        string            `json:"url,omitempty"`
+	StatusCode int               `json:"statusCode,omitempty"`
+	DurationMS int64             `json:"durationMs"`
+	Passed     bool              `json:"passed"`
+	Error      string            `json:"error,omitempty"`
+	Assertions []AssertionResult `json:"assertions,omitempty"`
+	Artifact   string            `json:"artifact,omitempty"`
+}
+
+// RunPipeline executes every stage for every environment, writing progress
+// to out and artifacts to p.Artifacts.Dir. The returned summary reports
+// failures; the error is reserved for problems writing artifacts.
+func (cm *ConfigManager) RunPipeline(p *Pipeline, out io.Writer) (*PipelineSummary, error) {
+	summary := &PipelineSummary{
+		Pipeline:  p.Name,
+		StartedAt: time.Now().UTC(),
+		Passed:    true,
+		Stages:    []StageResult{},
+	}
+
+	if err := os.MkdirAll(p.Artifacts.Dir, 0755); err != nil {
+		return nil, fmt.Errorf("creating artifacts directory: %w", err)
+	}
+
+	halted := false
+	for _, envName := range p.Environments {
+		fmt.Fprintf(out, "🌍 %s\n", envName)
+		for _, stage := range p.Stages {
+			if len(stage.Environments) > 0 && !slices.Contains(stage.Environments, envName) {
+				continue
+			}
+			if halted {
+				summary.Stages = append(summary.Stages, StageResult{Environment: envName, Stage: stage.Name, Skipped: true})
+				summary.Skipped++
+				continue
+			}
+
+			result, err := cm.runPipelineStage(p, envName, stage, out)
+			if err != nil {
+				return nil, err
+			}
+			summary.Stages = append(summary.Stages, *result)
+			summary.Total++
+			if !result.Passed {
+				summary.Failed++
+				summary.Passed = false
+				if p.FailFast {
+					halted = true
+				}
+			}
+		}
+	}
+	summary.DurationMS = time.Since(summary.StartedAt).Milliseconds()
+
+	if err := publishPipelineFiles(p); err != nil {
+		return nil, err
+	}
+	if err := writePipelineReports(p, summary); err != nil {
+		return nil, err
+	}
+	return summary, nil
+}
+
+func (cm *ConfigManager) runPipelineStage(p *Pipeline, envName string, stage PipelineStage, out io.Writer) (*StageResult, error) {
+	started := time.Now()
+	result := &StageResult{Environment: envName, Stage: stage.Name, Passed: true}
+
+	if stage.Chain != "" {
+		chain, err := cm.LoadChain(stage.Chain)
+		if err != nil {
+			result.Passed = false
+			result.Steps = []StepResult{{Request: "chain " + stage.Chain, Error: err.Error()}}
+			printStepResult(out, stage.Name, result.Steps[0])
+		} else {
+			chainResult := cm.RunChain(chain, envName, io.Discard)
+			result.Passed = chainResult.Passed
+			for _, step := range chainResult.Steps {
+				stepResult := StepResult{
+					Request:    step.Request,
+					StatusCode: step.StatusCode,
+					DurationMS: step.DurationMS,
+					Passed:     step.Error == "",
+					Error:      step.Error,
+				}
+				printStepResult(out, stage.Name, stepResult)
+				result.Steps = append(result.Steps, stepResult)
+			}
+		}
+		result.DurationMS = time.Since(started).Milliseconds()
+		return result, nil
+	}
+
+	for i, step := range stage.Flow {
+		stepResult := StepResult{Request: step.Request}
+		exec, err := cm.RunRequest(step.Request, envName, RequestOptions{})
+		if err != nil {
+			stepResult.Error = err.Error()
+		} else {
+			stepResult.Method = exec.Method
+			stepResult.URL = exec.URL
+			stepResult.StatusCode = exec.StatusCode
+			stepResult.DurationMS = exec.DurationMS()
+			assert := step.Assert
+			if assert == nil {
+				// Fall back to the assertions saved with the request.
+				if config, err := cm.LoadRequest(step.Request); err == nil {
+					assert = config.Assertions
+				}
+			}
+			stepResult.Assertions = cm.evaluateAssertions(assert, exec, RequestOptions{})
+			stepResult.Passed = assertionsPassed(stepResult.Assertions)
+		}
+
+		if exec != nil && (p.Artifacts.Responses == "all" || (p.Artifacts.Responses == "failed" && !stepResult.Passed)) {
+			name := fmt.Sprintf("%02d-%s.json", i+1, sanitizeRequestPathSegment(step.Request))
+			path := filepath.Join(p.Artifacts.Dir, "responses", sanitizeRequestPathSegment(envName), sanitizeRequestPathSegment(stage.Name), name)
+			if err := writeResponseArtifact(path, exec); err != nil {
+				return nil, err
+			}
+			stepResult.Artifact = path
+		}
+
+		printStepResult(out, stage.Name, stepResult)
+		result.Steps = append(result.Steps, stepResult)
+		if !stepResult.Passed {
+			result.Passed = false
+			break
+		}
+	}
+
+	result.DurationMS = time.Since(started).Milliseconds()
+	return result, nil
+}
+
+func printStepResult(out io.Writer, stage string, step StepResult) {
+	marker := "✓"
+	if !step.Passed {
+		marker = "✗"
+	}
+	if step.Error != "" {
+		fmt.Fprintf(out, "  %s %s › %s: %s\n", marker, stage, step.Request, step.Error)
+		return
+	}
+	fmt.Fprintf(out, "  %s %s › %s %d (%dms)\n", marker, stage, step.Request, step.StatusCode, step.DurationMS)
+	for _, a := range step.Assertions {
+		if !a.Passed {
+			fmt.Fprintf(out, "      ✗ %s: %s\n", a.Name, a.Message)
+		}
+	}
+}
+
+type responseArtifact struct {
+	Request    string              `json:"request"`
+	Method     string              `json:"method"`
+	URL        string              `json:"url"`
+	Status     string              `json:"status"`
+	Headers    map[string][]string `json:"headers"`
+	DurationMS int64               `json:"durationMs"`
+	Body       string              `json:"body"`
+}
+
+func writeResponseArtifact(path string, exec *ExecutionResult) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("creating artifact directory: %w", err)
+	}
+	return writeJSONFile(path, responseArtifact{
+		Request:    exec.Request,
+		Method:     exec.Method,
+		URL:        exec.URL,
+		Status:     exec.Status,
+		Headers:    exec.Headers,
+		DurationMS: exec.DurationMS(),
+		Body:       string(exec.Body),
+	})
+}
+
+func publishPipelineFiles(p *Pipeline) error {
+	for _, pattern := range p.Artifacts.Publish {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return fmt.Errorf("artifact pattern %q: %w", pattern, err)
+		}
+		for _, match := range matches {
+			data, err := os.ReadFile(match)
+			if err != nil {
+				return fmt.Errorf("reading artifact %s: %w", match, err)
+			}
+			target := filepath.Join(p.Artifacts.Dir, "files", filepath.Clean(match))
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return fmt.Errorf("creating artifact directory: %w", err)
+			}
+			if err := os.WriteFile(target, data, 0644); err != nil {
+				return fmt.Errorf("writing artifact %s: %w", target, err)
+			}
+		}
+	}
+	return nil
+}
+
+func writePipelineReports(p *Pipeline, summary *PipelineSummary) error {
+	data, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshaling summary: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(p.Artifacts.Dir, "summary.json"), data, 0644); err != nil {
+		return fmt.Errorf("writing summary: %w", err)
+	}
+
+	var b strings.Builder
+	status := "passed"
+	if !summary.Passed {
+		status = "failed"
+	}
+	fmt.Fprintf(&b, "# Pipeline %s: %s\n\n", summary.Pipeline, status)
+	fmt.Fprintf(&b, "%d stage run(s), %d failed, %d skipped, %dms\n\n", summary.Total, summary.Failed, summary.Skipped, summary.DurationMS)
+	b.WriteString("| Environment | Stage | Request | Status | Time | Result |\n")
+	b.WriteString("|---|---|---|---|---|---|\n")
+	for _, stage := range summary.Stages {
+		if stage.Skipped {
+			fmt.Fprintf(&b, "| %s | %s | | | | skipped |\n", stage.Environment, stage.Stage)
+			continue
+		}
+		for _, step := range stage.Steps {
+			result := "pass"
+			if !step.Passed {
+				result = "fail"
+				if step.Error != "" {
+					result += ": " + step.Error
+				}
+				for _, a := range step.Assertions {
+					if !a.Passed {
+						result += fmt.Sprintf("<br>%s (%s)", a.Name, a.Message)
+					}
+				}
+			}
+			fmt.Fprintf(&b, "| %s | %s | %s | %d | %dms | %s |\n", stage.Environment, stage.Stage, step.Request, step.StatusCode, step.DurationMS, strings.ReplaceAll(result, "|", "\\|"))
+		}
+	}
+	if err := os.WriteFile(filepath.Join(p.Artifacts.Dir, "report.md"), []byte(b.String()), 0644); err != nil {
+		return fmt.Errorf("writing report: %w", err)
+	}
+	return nil
+}
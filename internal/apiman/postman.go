@@ -0,0 +1,615 @@
+// postman.go
+package apiman
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Postman v2.1 collection format, limited to the fields api-man maps.
+// See https://schema.getpostman.com/json/collection/v2.1.0/collection.json.
+type postmanCollection struct {
+	Info struct {
+		Name        string             `json:"name"`
+		Schema      string             `json:"schema"`
+		Description postmanDescription `json:"description"`
+	} `json:"info"`
+	Item     []postmanItem     `json:"item"`
+	Variable []postmanKeyValue `json:"variable"`
+	Auth     *postmanAuth      `json:"auth"`
+}
+
+type postmanItem struct {
+	Name        string             `json:"name"`
+	Description postmanDescription `json:"description"`
+	Item        []postmanItem      `json:"item"`
+	Request     *postmanRequest    `json:"request"`
+	Response    []postmanResponse  `json:"response"`
+	Auth        *postmanAuth       `json:"auth"`
+}
+
+type postmanRequest struct {
+	Method      string             `json:"method"`
+	Header      []postmanKeyValue  `json:"header"`
+	URL         postmanURL         `json:"url"`
+	Body        *postmanBody       `json:"body"`
+	Auth        *postmanAuth       `json:"auth"`
+	Description postmanDescription `json:"description"`
+}
+
+// UnmarshalJSON accepts the short form where a request is just its URL.
+func (r *postmanRequest) UnmarshalJSON(data []byte) error {
+	var raw string
+	if err := json.Unmarshal(data, &raw); err == nil {
+		*r = postmanRequest{Method: "GET", URL: postmanURL{Raw: raw}}
+		return nil
+	}
+	type plain postmanRequest
+	return json.Unmarshal(data, (*plain)(r))
+}
+
+type postmanURL struct {
+	Raw string `json:"raw"`
+}
+
+// UnmarshalJSON accepts both the string and the structured URL forms.
+func (u *postmanURL) UnmarshalJSON(data []byte) error {
+	var raw string
+	if err := json.Unmarshal(data, &raw); err == nil {
+		u.Raw = raw
+		return nil
+	}
+	var structured struct {
+		Raw   string            `json:"raw"`
+		Host  []string          `json:"host"`
+		Path  []string          `json:"path"`
+		Query []postmanKeyValue `json:"query"`
+	}
+	if err := json.Unmarshal(data, &structured); err != nil {
+		return err
+	}
+	u.Raw = structured.Raw
+	if u.Raw == "" {
+		u.Raw = strings.Join(structured.Host, ".") + "/" + strings.Join(structured.Path, "/")
+	}
+	return nil
+}
+
+type postmanDescription string
+
+// UnmarshalJSON accepts a plain string or a {"content": "..."} object.
+func (d *postmanDescription) UnmarshalJSON(data []byte) error {
+	var raw string
+	if err := json.Unmarshal(data, &raw); err == nil {
+		*d = postmanDescription(raw)
+		return nil
+	}
+	var obj struct {
+		Content string `json:"content"`
+	}
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return err
+	}
+	*d = postmanDescription(obj.Content)
+	return nil
+}
+
+type postmanBody struct {
+	Mode       string            `json:"mode"`
+	Raw        string            `json:"raw"`
+	URLEncoded []postmanKeyValue `json:"urlencoded"`
+	FormData   []postmanKeyValue `json:"formdata"`
+	GraphQL    *struct {
+		Query     string `json:"query"`
+		Variables string `json:"variables"`
+	} `json:"graphql"`
+	Options struct {
+		Raw struct {
+			Language string `json:"language"`
+		} `json:"raw"`
+	} `json:"options"`
+}
+
+type postmanAuth struct {
+	Type   string            `json:"type"`
+	Bearer []postmanKeyValue `json:"bearer"`
+	Basic  []postmanKeyValue `json:"basic"`
+	APIKey []postmanKeyValue `json:"apikey"`
+}
+
+func (a *postmanAuth) value(list []postmanKeyValue, key string) string {
+	for _, kv := range list {
+		if kv.Key == key {
+			return kv.stringValue()
+		}
+	}
+	return ""
+}
+
+type postmanKeyValue struct {
+	Key      string          `json:"key"`
+	Value    json.RawMessage `json:"value"`
+	Disabled bool            `json:"disabled"`
+	Enabled  *bool           `json:"enabled"`
+	Type     string          `json:"type"`
+}
+
+func (kv postmanKeyValue) stringValue() string {
+	if len(kv.Value) == 0 {
+		return ""
+	}
+	var s string
+	if err := json.Unmarshal(kv.Value, &s); err == nil {
+		return s
+	}
+	return string(kv.Value)
+}
+
+func (kv postmanKeyValue) active() bool {
+	if kv.Disabled {
+		return false
+	}
+	return kv.Enabled == nil || *kv.Enabled
+}
+
+type postmanResponse struct {
+	Name            string          `json:"name"`
+	OriginalRequest *postmanRequest `json:"originalRequest"`
+}
+
+// postmanEnvironment is a Postman environment export.
+type postmanEnvironment struct {
+	Name   string            `json:"name"`
+	Values []postmanKeyValue `json:"values"`
+}
+
+// IsPostmanCollection reports whether data looks like a Postman v2.x collection.
+func IsPostmanCollection(data []byte) bool {
+	var probe struct {
+		Info struct {
+			Schema string `json:"schema"`
+		} `json:"info"`
+	}
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return false
+	}
+	return strings.Contains(probe.Info.Schema, "schema.getpostman.com/json/collection/v2")
+}
+
+// PreviewPostmanCollection reports what ImportPostmanCollection would do
+// without touching disk.
+func (cm *ConfigManager) PreviewPostmanCollection(data []byte, overrideName string) (*OpenAPIPreview, error) {
+	var collection postmanCollection
+	if err := json.Unmarshal(data, &collection); err != nil {
+		return nil, fmt.Errorf("parsing Postman collection: %w", err)
+	}
+	name := sanitizeRequestPathSegment(collection.Info.Name)
+	if strings.TrimSpace(overrideName) != "" {
+		name = sanitizeRequestPathSegment(overrideName)
+	}
+	exists, ownedBySpec := inspectCollectionDir(filepath.Join(cm.requestsDir, name))
+
+	requests := 0
+	var count func([]postmanItem)
+	count = func(items []postmanItem) {
+		for _, item := range items {
+			if item.Request != nil {
+				requests++
+			}
+			count(item.Item)
+		}
+	}
+	count(collection.Item)
+
+	return &OpenAPIPreview{
+		SuggestedCollection: name,
+		Exists:              exists,
+		OwnedBySpec:         ownedBySpec,
+		Operations:          requests,
+		Requests:            requests,
+		Type:                "postman",
+	}, nil
+}
+
+// postmanImport accumulates state while walking a collection.
+type postmanImport struct {
+	collectionDir string
+	baseToken     string
+	imported      int
+	bodies        int
+	warnings      []string
+}
+
+var postmanLeadingVar = regexp.MustCompile(`^\{\{\s*([^}]+?)\s*\}\}`)
+
+// ImportPostmanCollection converts a Postman v2.1 collection into
+// requests/<collection>/: folders become subdirectories, requests become
+// request.json files, saved example bodies become body templates, and
+// collection variables plus any supplied Postman environment exports become
+// environment files.
+func (cm *ConfigManager) ImportPostmanCollection(data []byte, envExports [][]byte, opts ImportOptions) (*OpenAPIImportResult, error) {
+	var collection postmanCollection
+	if err := json.Unmarshal(data, &collection); err != nil {
+		return nil, fmt.Errorf("parsing Postman collection: %w", err)
+	}
+	if !strings.Contains(collection.Info.Schema, "v2.1") && !strings.Contains(collection.Info.Schema, "v2.0") {
+		return nil, fmt.Errorf("unsupported Postman schema %q (export as Collection v2.1)", collection.Info.Schema)
+	}
+
+	var envs []postmanEnvironment
+	for _, raw := range envExports {
+		var export postmanEnvironment
+		if err := json.Unmarshal(raw, &export); err != nil {
+			return nil, fmt.Errorf("parsing Postman environment: %w", err)
+		}
+		envs = append(envs, export)
+	}
+	return cm.importPostman(&collection, envs, opts, nil)
+}
+
+// importPostman writes a parsed collection and its environments into the
+// workspace. warnings are carried over from converting another format.
+func (cm *ConfigManager) importPostman(collection *postmanCollection, envExports []postmanEnvironment, opts ImportOptions, warnings []string) (*OpenAPIImportResult, error) {
+	name := sanitizeRequestPathSegment(collection.Info.Name)
+	if strings.TrimSpace(opts.OverrideName) != "" {
+		name = sanitizeRequestPathSegment(opts.OverrideName)
+	}
+	collectionDir := filepath.Join(cm.requestsDir, name)
+	if exists, _ := inspectCollectionDir(collectionDir); exists {
+		if !opts.Overwrite {
+			return nil, &CollectionExistsError{Name: name}
+		}
+		if err := os.RemoveAll(collectionDir); err != nil {
+			return nil, fmt.Errorf("removing existing collection: %w", err)
+		}
+	}
+
+	imp := &postmanImport{
+		collectionDir: collectionDir,
+		baseToken:     detectPostmanBase(collection.Item),
+		warnings:      warnings,
+	}
+	if err := imp.writeItems(collectionDir, collection.Item, nil); err != nil {
+		return nil, err
+	}
+
+	result := &OpenAPIImportResult{
+		Collection: name,
+		Imported:   imp.imported,
+		Bodies:     imp.bodies,
+	}
+
+	// Collection variables become an environment named after the collection;
+	// each Postman environment export becomes its own environment file.
+	envs := map[string]Environment{}
+	if len(collection.Variable) > 0 || collection.Auth != nil {
+		envs[name] = imp.environment(collection.Variable, collection.Auth)
+	}
+	for _, export := range envExports {
+		envName := sanitizeRequestPathSegment(export.Name)
+		envs[envName] = imp.environment(append(append([]postmanKeyValue{}, collection.Variable...), export.Values...), collection.Auth)
+	}
+
+	envNames := make([]string, 0, len(envs))
+	for envName := range envs {
+		envNames = append(envNames, envName)
+	}
+	sort.Strings(envNames)
+	for _, envName := range envNames {
+		if err := ValidateEnvironmentName(envName); err != nil {
+			imp.warnings = append(imp.warnings, fmt.Sprintf("environment %q skipped: %v", envName, err))
+			continue
+		}
+		if _, err := cm.LoadEnvironment(envName); err == nil && !opts.Overwrite {
+			imp.warnings = append(imp.warnings, fmt.Sprintf("environment %q already exists, not overwritten", envName))
+			continue
+		}
+		if err := cm.SaveEnvironment(envName, envs[envName]); err != nil {
+			return nil, err
+		}
+		result.Environments = append(result.Environments, envName)
+	}
+
+	result.Warnings = imp.warnings
+	return result, nil
+}
+
+// detectPostmanBase picks the most common URL prefix, either a leading
+// {{variable}} or a literal scheme://host, to become the environment baseURL.
+func detectPostmanBase(items []postmanItem) string {
+	counts := map[string]int{}
+	var walk func([]postmanItem)
+	walk = func(items []postmanItem) {
+		for _, item := range items {
+			walk(item.Item)
+			if item.Request != nil {
+				if token := postmanBaseToken(item.Request.URL.Raw); token != "" {
+					counts[token]++
+				}
+			}
+		}
+	}
+	walk(items)
+
+	best := ""
+	for token, n := range counts {
+		if n > counts[best] || (n == counts[best] && token < best) {
+			best = token
+		}
+	}
+	return best
+}
+
+func postmanBaseToken(raw string) string {
+	if m := postmanLeadingVar.FindString(raw); m != "" {
+		return m
+	}
+	if u, err := url.Parse(raw); err == nil && u.Scheme != "" && u.Host != "" {
+		return u.Scheme + "://" + u.Host
+	}
+	return ""
+}
+
+// writeItems walks a folder level. folderAuth is the nearest folder-level
+// auth block; collection-level auth lives on the environment instead.
+func (imp *postmanImport) writeItems(dir string, items []postmanItem, folderAuth *postmanAuth) error {
+	used := map[string]int{}
+	for _, item := range items {
+		segment := uniqueSegment(used, sanitizeRequestPathSegment(item.Name))
+		if item.Request == nil {
+			auth := folderAuth
+			if item.Auth != nil {
+				auth = item.Auth
+			}
+			if err := imp.writeItems(filepath.Join(dir, segment), item.Item, auth); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := imp.writeRequest(filepath.Join(dir, segment), item, folderAuth); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func uniqueSegment(used map[string]int, segment string) string {
+	used[segment]++
+	if used[segment] == 1 {
+		return segment
+	}
+	return fmt.Sprintf("%s-%d", segment, used[segment])
+}
+
+func (imp *postmanImport) writeRequest(requestDir string, item postmanItem, folderAuth *postmanAuth) error {
+	req := item.Request
+	relPath := strings.TrimPrefix(filepath.ToSlash(strings.TrimPrefix(requestDir, imp.collectionDir)), "/")
+
+	description := string(req.Description)
+	if description == "" {
+		description = string(item.Description)
+	}
+	config := RequestConfig{
+		Name:        item.Name,
+		Description: description,
+		Method:      strings.ToUpper(req.Method),
+		URL:         imp.requestURL(req.URL.Raw, relPath),
+		Headers:     map[string]string{},
+		Cookies:     map[string]string{},
+		Timeout:     30,
+	}
+	if config.Method == "" {
+		config.Method = "GET"
+	}
+	for _, h := range req.Header {
+		if h.active() && h.Key != "" {
+			config.Headers[h.Key] = h.stringValue()
+		}
+	}
+
+	// Request and folder auth override the collection's and are folded into
+	// headers, since request configs have no auth block of their own.
+	auth := req.Auth
+	if auth == nil {
+		auth = folderAuth
+	}
+	if auth != nil {
+		imp.applyRequestAuth(&config, auth, relPath)
+	}
+
+	body, contentType, err := imp.bodyContent(req.Body, relPath)
+	if err != nil {
+		return err
+	}
+	config.Body = body
+	if contentType != "" && config.Headers["Content-Type"] == "" {
+		config.Headers["Content-Type"] = contentType
+	}
+
+	if err := os.MkdirAll(requestDir, 0755); err != nil {
+		return fmt.Errorf("creating request directory: %w", err)
+	}
+	config.SchemaVersion = CurrentSchemaVersion
+	if err := writeJSONFile(filepath.Join(requestDir, "request.json"), config); err != nil {
+		return fmt.Errorf("writing request %s: %w", relPath, err)
+	}
+	imp.imported++
+
+	// Saved examples carry the request body used for that example; keep
+	// each distinct one as a named body template.
+	used := map[string]int{defaultBodyName: 1, "request": 1}
+	for _, example := range item.Response {
+		if example.OriginalRequest == nil {
+			continue
+		}
+		exampleBody, _, err := imp.bodyContent(example.OriginalRequest.Body, relPath)
+		if err != nil || exampleBody == "" || exampleBody == config.Body {
+			continue
+		}
+		bodyName := uniqueSegment(used, sanitizeRequestPathSegment(example.Name))
+		if err := ValidateBodyName(bodyName); err != nil {
+			imp.warnings = append(imp.warnings, fmt.Sprintf("%s: example %q skipped: %v", relPath, example.Name, err))
+			continue
+		}
+		if err := os.WriteFile(filepath.Join(requestDir, bodyName+".json"), []byte(exampleBody), 0644); err != nil {
+			return fmt.Errorf("writing body %s/%s.json: %w", relPath, bodyName, err)
+		}
+		imp.bodies++
+	}
+	return nil
+}
+
+// requestURL strips the detected base prefix so the environment baseURL
+// can be prepended at execution time. Postman :param path segments become
+// {param} placeholders, matching generated OpenAPI requests.
+func (imp *postmanImport) requestURL(raw, relPath string) string {
+	path := raw
+	if imp.baseToken != "" && strings.HasPrefix(raw, imp.baseToken) {
+		path = strings.TrimPrefix(raw, imp.baseToken)
+	} else if token := postmanBaseToken(raw); token != "" {
+		imp.warnings = append(imp.warnings, fmt.Sprintf("%s: URL uses a different base (%s) than the collection; kept as-is", relPath, token))
+	}
+
+	query := ""
+	if i := strings.Index(path, "?"); i >= 0 {
+		path, query = path[:i], path[i:]
+	}
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") && len(segment) > 1 {
+			segments[i] = "{" + segment[1:] + "}"
+		}
+	}
+	path = strings.Join(segments, "/")
+	if path != "" && !strings.HasPrefix(path, "/") && !strings.HasPrefix(path, "{{") && !strings.Contains(path, "://") {
+		path = "/" + path
+	}
+	return path + query
+}
+
+func (imp *postmanImport) bodyContent(body *postmanBody, relPath string) (string, string, error) {
+	if body == nil {
+		return "", "", nil
+	}
+	switch body.Mode {
+	case "", "none":
+		return "", "", nil
+	case "raw":
+		contentType := ""
+		switch body.Options.Raw.Language {
+		case "json":
+			contentType = "application/json"
+		case "xml":
+			contentType = "application/xml"
+		case "text":
+			contentType = "text/plain"
+		}
+		return body.Raw, contentType, nil
+	case "urlencoded":
+		values := url.Values{}
+		for _, kv := range body.URLEncoded {
+			if kv.active() {
+				values.Add(kv.Key, kv.stringValue())
+			}
+		}
+		return values.Encode(), "application/x-www-form-urlencoded", nil
+	case "graphql":
+		if body.GraphQL == nil {
+			return "", "", nil
+		}
+		payload := map[string]interface{}{"query": body.GraphQL.Query}
+		if strings.TrimSpace(body.GraphQL.Variables) != "" {
+			var vars interface{}
+			if err := json.Unmarshal([]byte(body.GraphQL.Variables), &vars); err == nil {
+				payload["variables"] = vars
+			}
+		}
+		data, err := json.MarshalIndent(payload, "", "  ")
+		if err != nil {
+			return "", "", fmt.Errorf("encoding GraphQL body for %s: %w", relPath, err)
+		}
+		return string(data), "application/json", nil
+	default:
+		imp.warnings = append(imp.warnings, fmt.Sprintf("%s: %s body mode is not supported; body left empty", relPath, body.Mode))
+		return "", "", nil
+	}
+}
+
+func (imp *postmanImport) applyRequestAuth(config *RequestConfig, auth *postmanAuth, relPath string) {
+	switch auth.Type {
+	case "noauth":
+	case "bearer":
+		config.Headers["Authorization"] = "Bearer " + auth.value(auth.Bearer, "token")
+	case "basic":
+		username := auth.value(auth.Basic, "username")
+		password := auth.value(auth.Basic, "password")
+		if strings.Contains(username+password, "{{") {
+			imp.warnings = append(imp.warnings, fmt.Sprintf("%s: basic auth uses variables and was not converted", relPath))
+			return
+		}
+		config.Headers["Authorization"] = "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password))
+	case "apikey":
+		if auth.value(auth.APIKey, "in") == "query" {
+			imp.warnings = append(imp.warnings, fmt.Sprintf("%s: query-string API key auth was not converted", relPath))
+			return
+		}
+		config.Headers[auth.value(auth.APIKey, "key")] = auth.value(auth.APIKey, "value")
+	default:
+		imp.warnings = append(imp.warnings, fmt.Sprintf("%s: %s auth is not supported", relPath, auth.Type))
+	}
+}
+
+// environment builds an api-man environment from Postman variables. The
+// variable used as the URL base becomes baseURL; the rest become variables.
+func (imp *postmanImport) environment(vars []postmanKeyValue, auth *postmanAuth) Environment {
+	env := Environment{
+		Headers:   map[string]string{},
+		Cookies:   map[string]string{},
+		Auth:      map[string]string{},
+		Variables: map[string]string{},
+	}
+
+	baseVar := ""
+	if m := postmanLeadingVar.FindStringSubmatch(imp.baseToken); m != nil {
+		baseVar = m[1]
+	} else {
+		env.BaseURL = imp.baseToken
+	}
+
+	for _, kv := range vars {
+		if !kv.active() || kv.Key == "" {
+			continue
+		}
+		if kv.Key == baseVar {
+			env.BaseURL = kv.stringValue()
+			continue
+		}
+		env.Variables[kv.Key] = kv.stringValue()
+	}
+
+	if auth != nil {
+		switch auth.Type {
+		case "bearer":
+			env.Auth["type"] = "bearer"
+			env.Auth["token"] = auth.value(auth.Bearer, "token")
+		case "basic":
+			env.Auth["type"] = "basic"
+			env.Auth["username"] = auth.value(auth.Basic, "username")
+			env.Auth["password"] = auth.value(auth.Basic, "password")
+		case "apikey":
+			if auth.value(auth.APIKey, "in") != "query" {
+				env.Auth["type"] = "api-key"
+				env.Auth["header"] = auth.value(auth.APIKey, "key")
+				env.Auth["key"] = auth.value(auth.APIKey, "value")
+			}
+		}
+	}
+	return env
+}
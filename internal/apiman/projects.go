@@ -0,0 +1,207 @@
+// projects.go
+package apiman
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// The project registry names workspaces, so that api-man --project billing
+// works from any directory and api-man project use billing makes billing
+// the workspace used outside any other. It lives in
+// ~/.config/api-man/projects.json, next to the workspace templates.
+
+// projectFlag holds the global --project flag.
+var projectFlag string
+
+// ProjectRegistry is the content of projects.json.
+type ProjectRegistry struct {
+	// Current is the project used when no workspace is selected or found
+	// from the working directory.
+	Current string `json:"current,omitempty"`
+	// Projects maps project names to workspace directories.
+	Projects map[string]string `json:"projects"`
+}
+
+// Project is a registered workspace.
+type Project struct {
+	Name    string `json:"name"`
+	Dir     string `json:"dir"`
+	Current bool   `json:"current,omitempty"`
+	// Missing is set when the directory is no longer a workspace.
+	Missing bool `json:"missing,omitempty"`
+}
+
+// userConfigDir returns api-man's directory in the user's configuration
+// directory: $XDG_CONFIG_HOME/api-man, or ~/.config/api-man.
+func userConfigDir() (string, error) {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "api-man"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("finding home directory: %w", err)
+	}
+	return filepath.Join(home, ".config", "api-man"), nil
+}
+
+func projectsFile() (string, error) {
+	dir, err := userConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "projects.json"), nil
+}
+
+// LoadProjects reads the project registry, empty when there is none yet.
+func LoadProjects() (*ProjectRegistry, error) {
+	registry := &ProjectRegistry{Projects: map[string]string{}}
+	file, err := projectsFile()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return registry, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading project registry: %w", err)
+	}
+	if err := json.Unmarshal(data, registry); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", file, err)
+	}
+	if registry.Projects == nil {
+		registry.Projects = map[string]string{}
+	}
+	return registry, nil
+}
+
+func (r *ProjectRegistry) save() error {
+	file, err := projectsFile()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return fmt.Errorf("creating %s: %w", filepath.Dir(file), err)
+	}
+	if err := writeJSONFileAtomic(file, r, 0644); err != nil {
+		return fmt.Errorf("writing project registry: %w", err)
+	}
+	return nil
+}
+
+// List returns the registered projects, sorted by name.
+func (r *ProjectRegistry) List() []Project {
+	projects := make([]Project, 0, len(r.Projects))
+	for _, name := range sortedKeys(r.Projects) {
+		dir := r.Projects[name]
+		projects = append(projects, Project{
+			Name:    name,
+			Dir:     dir,
+			Current: name == r.Current,
+			Missing: !isWorkspaceRoot(dir),
+		})
+	}
+	return projects
+}
+
+// Dir returns the workspace directory of project name.
+func (r *ProjectRegistry) Dir(name string) (string, error) {
+	dir, ok := r.Projects[name]
+	if !ok {
+		return "", fmt.Errorf("project %q not found (add it with api-man project add %s <dir>)", name, name)
+	}
+	if !isWorkspaceRoot(dir) {
+		return "", fmt.Errorf("project %s: %s is not an api-man workspace anymore", name, dir)
+	}
+	return dir, nil
+}
+
+// AddProject registers the workspace in dir as name, replacing a project
+// of that name. It returns the directory registered.
+func AddProject(name, dir string) (string, error) {
+	if err := ValidateEnvironmentName(name); err != nil {
+		return "", fmt.Errorf("invalid project name: %w", err)
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", fmt.Errorf("resolving %s: %w", dir, err)
+	}
+	if !isWorkspaceRoot(dir) {
+		return "", fmt.Errorf("%s is not an api-man workspace (run api-man init there)", dir)
+	}
+	registry, err := LoadProjects()
+	if err != nil {
+		return "", err
+	}
+	registry.Projects[name] = dir
+	return dir, registry.save()
+}
+
+// UseProject makes name the current project; "" clears it.
+func UseProject(name string) error {
+	registry, err := LoadProjects()
+	if err != nil {
+		return err
+	}
+	if name != "" {
+		if _, err := registry.Dir(name); err != nil {
+			return err
+		}
+	}
+	registry.Current = name
+	return registry.save()
+}
+
+// RemoveProject unregisters name, leaving its workspace alone.
+func RemoveProject(name string) error {
+	registry, err := LoadProjects()
+	if err != nil {
+		return err
+	}
+	if _, ok := registry.Projects[name]; !ok {
+		return fmt.Errorf("project %q not found", name)
+	}
+	delete(registry.Projects, name)
+	if registry.Current == name {
+		registry.Current = ""
+	}
+	return registry.save()
+}
+
+// projectWorkspace returns the directory of the --project flag's project,
+// or else of the current project when current is set.
+func projectWorkspace(current bool) (string, error) {
+	if projectFlag == "" && !current {
+		return "", nil
+	}
+	registry, err := LoadProjects()
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case projectFlag != "":
+		return registry.Dir(projectFlag)
+	case registry.Current != "":
+		return registry.Dir(registry.Current)
+	}
+	return "", nil
+}
+
+// projectName returns the name the workspace in dir is registered under,
+// if any.
+func projectName(dir string) string {
+	registry, err := LoadProjects()
+	if err != nil {
+		return ""
+	}
+	for _, name := range sortedKeys(registry.Projects) {
+		if registry.Projects[name] == dir {
+			return name
+		}
+	}
+	return ""
+}
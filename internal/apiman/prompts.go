@@ -0,0 +1,71 @@
+// prompts.go
+package apiman
+
+import (
+	"fmt"
+	"strings"
+)
+
+// RequestPrompt declares a variable the user is asked for when the request
+// is run, for requests shared between people who each fill in their own
+// values:
+//
+//	"prompts": [
+//	  {"name": "customerId", "description": "Customer to look up"},
+//	  {"name": "otp", "description": "One-time password", "secret": true}
+//	]
+//
+// The answer is used like a --var, so {{customerId}} resolves to it.
+type RequestPrompt struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// Default is used when the answer is left empty, and without asking
+	// when prompting is off.
+	Default string `json:"default,omitempty"`
+	// Secret hides the answer while it is typed.
+	Secret bool `json:"secret,omitempty"`
+}
+
+// label is what the user is asked, e.g. "Customer to look up [42]".
+func (p RequestPrompt) label() string {
+	label := p.Name
+	if p.Description != "" {
+		label = p.Description
+	}
+	if p.Default != "" && !p.Secret {
+		label += " [" + p.Default + "]"
+	}
+	return label
+}
+
+// MissingPromptsError lists prompts a request declares that have no value,
+// no default and were not asked for, e.g. with --no-prompt.
+type MissingPromptsError struct {
+	Names []string
+}
+
+func (e *MissingPromptsError) Error() string {
+	return fmt.Sprintf("missing value(s) for prompt(s) %s: pass --var %s=<value>",
+		strings.Join(e.Names, ", "), e.Names[0])
+}
+
+// applyPromptDefaults fills prompts without a value in vars from their
+// defaults. Prompts left without a value are reported in a
+// *MissingPromptsError.
+func applyPromptDefaults(prompts []RequestPrompt, vars map[string]string) error {
+	var missing []string
+	for _, prompt := range prompts {
+		if _, ok := vars[prompt.Name]; ok {
+			continue
+		}
+		if prompt.Default == "" {
+			missing = append(missing, prompt.Name)
+			continue
+		}
+		vars[prompt.Name] = prompt.Default
+	}
+	if len(missing) > 0 {
+		return &MissingPromptsError{Names: missing}
+	}
+	return nil
+}
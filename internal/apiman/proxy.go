@@ -0,0 +1,75 @@
+// proxy.go
+package apiman
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+// ProxySettings selects the proxy requests are sent through. When neither
+// proxy is set, the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment
+// variables apply as usual.
+type ProxySettings struct {
+	HTTPProxy  string
+	HTTPSProxy string
+	// NoProxy is a comma-separated list of hosts, domains (".corp.example")
+	// and CIDR ranges that are reached directly. Like HTTP_PROXY, loopback
+	// addresses are always reached directly.
+	NoProxy string
+	// Forced sends every request through HTTPProxy, NoProxy and loopback
+	// addresses included.
+	Forced bool
+}
+
+// proxySettings returns env's proxies, or forces every request through
+// override (from --proxy) when set.
+func (env *Environment) proxySettings(override string) ProxySettings {
+	if override != "" {
+		return ProxySettings{HTTPProxy: override, HTTPSProxy: override, Forced: true}
+	}
+	return ProxySettings{
+		HTTPProxy:  env.HTTPProxy,
+		HTTPSProxy: env.HTTPSProxy,
+		NoProxy:    env.NoProxy,
+	}
+}
+
+func (p ProxySettings) isZero() bool {
+	return p.HTTPProxy == "" && p.HTTPSProxy == ""
+}
+
+// apply routes transport through the configured proxies. Zero settings
+// leave the transport's default (the proxy environment variables) alone.
+func (p ProxySettings) apply(transport *http.Transport) error {
+	if p.isZero() {
+		return nil
+	}
+	var proxyURL *url.URL
+	for _, proxy := range []string{p.HTTPProxy, p.HTTPSProxy} {
+		if proxy == "" {
+			continue
+		}
+		u, err := url.Parse(proxy)
+		if err != nil || u.Host == "" {
+			return fmt.Errorf("invalid proxy URL %q", proxy)
+		}
+		proxyURL = u
+	}
+
+	if p.Forced {
+		transport.Proxy = http.ProxyURL(proxyURL)
+		return nil
+	}
+	proxyFunc := (&httpproxy.Config{
+		HTTPProxy:  p.HTTPProxy,
+		HTTPSProxy: p.HTTPSProxy,
+		NoProxy:    p.NoProxy,
+	}).ProxyFunc()
+	transport.Proxy = func(req *http.Request) (*url.URL, error) {
+		return proxyFunc(req.URL)
+	}
+	return nil
+}
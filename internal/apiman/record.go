@@ -0,0 +1,425 @@
+// record.go
+package apiman
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// hopHeaders are connection-level headers a proxy doesn't pass on.
+var hopHeaders = []string{"Connection", "Proxy-Connection", "Keep-Alive", "Proxy-Authenticate", "Proxy-Authorization", "Te", "Trailer", "Transfer-Encoding", "Upgrade"}
+
+// unrecordedHeaders are request headers set by whatever client was
+// recorded, which api-man sets itself.
+var unrecordedHeaders = []string{"Host", "Content-Length", "Accept-Encoding", "User-Agent"}
+
+// pathIDPattern matches path segments that identify a resource rather than
+// name one: numbers, UUIDs and long hex strings.
+var pathIDPattern = regexp.MustCompile(`^([0-9]+|[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}|[0-9a-fA-F]{16,})$`)
+
+// RecordOptions configures a recording proxy.
+type RecordOptions struct {
+	// Name is the session the traffic is recorded as, and the collection
+	// and environment requests are created in. Without it the proxy only
+	// logs.
+	Name string
+	// Target makes the proxy a reverse proxy in front of this URL. Without
+	// it, clients use the proxy as their HTTP proxy.
+	Target string
+	// Log receives a line per exchange and per request created.
+	Log io.Writer
+}
+
+// Recorder is an HTTP proxy that records the traffic passing through it.
+// Each exchange is appended to the session file, and each method and path
+// not seen before becomes a request config, with IDs in the path turned
+// into path params and credentials left out.
+type Recorder struct {
+	cm        *ConfigManager
+	opts      RecordOptions
+	target    *url.URL
+	transport *http.Transport
+	markers   []string
+
+	mu      sync.Mutex
+	session *os.File
+	baseURL string
+	// seen maps the operation key of every request in the collection to
+	// its path.
+	seen      map[string]string
+	tunneled  map[string]bool
+	Exchanges int
+	Created   []string
+}
+
+// sessionFile is where the session name is recorded, one JSON history
+// entry per line.
+func (cm *ConfigManager) sessionFile(name string) string {
+	return filepath.Join(cm.stateDir(), "sessions", name+".jsonl")
+}
+
+// NewRecorder starts recording session opts.Name, replacing an earlier
+// recording of the same name. Requests already in the collection are not
+// created again.
+func (cm *ConfigManager) NewRecorder(opts RecordOptions) (*Recorder, error) {
+	if opts.Log == nil {
+		opts.Log = io.Discard
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// Clients pointed at the proxy through HTTP_PROXY would otherwise have
+	// it forward to itself.
+	transport.Proxy = nil
+	transport.DisableCompression = true
+	r := &Recorder{
+		cm:        cm,
+		opts:      opts,
+		transport: transport,
+		seen:      make(map[string]string),
+		tunneled:  make(map[string]bool),
+	}
+	if opts.Target != "" {
+		target, err := url.Parse(opts.Target)
+		if err != nil || target.Host == "" || (target.Scheme != "http" && target.Scheme != "https") {
+			return nil, fmt.Errorf("invalid target %q: expected an http:// or https:// URL", opts.Target)
+		}
+		r.target = target
+		r.baseURL = strings.TrimSuffix(opts.Target, "/")
+	}
+	if opts.Name == "" {
+		return r, nil
+	}
+	if name := sanitizeRequestPathSegment(opts.Name); name != opts.Name {
+		return nil, fmt.Errorf("invalid session name %q (try %q)", opts.Name, name)
+	}
+
+	markers, err := cm.secretMarkers()
+	if err != nil {
+		return nil, err
+	}
+	r.markers = append(markers, "cookie")
+	if env, err := cm.loadEnvironmentFile(opts.Name); err == nil {
+		r.baseURL = strings.TrimSuffix(env.BaseURL, "/")
+	}
+	paths, err := cm.RequestPaths()
+	if err != nil {
+		return nil, fmt.Errorf("listing requests: %w", err)
+	}
+	for _, path := range paths {
+		if !strings.HasPrefix(path, opts.Name+"/") {
+			continue
+		}
+		config, err := cm.LoadRequest(path)
+		if err != nil {
+			return nil, fmt.Errorf("loading %s: %w", path, err)
+		}
+		r.seen[operationKey(config.Method, config.URL)] = path
+	}
+
+	file := cm.sessionFile(opts.Name)
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return nil, fmt.Errorf("creating sessions directory: %w", err)
+	}
+	if r.session, err = os.Create(file); err != nil {
+		return nil, fmt.Errorf("creating session file: %w", err)
+	}
+	return r, nil
+}
+
+// Close ends the recording.
+func (r *Recorder) Close() error {
+	if r.session == nil {
+		return nil
+	}
+	return r.session.Close()
+}
+
+// ServeHTTP forwards req and records the exchange.
+func (r *Recorder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method == http.MethodConnect {
+		r.tunnel(w, req)
+		return
+	}
+	target := req.URL
+	if r.target != nil {
+		target = r.target.JoinPath(req.URL.Path)
+		target.RawQuery = req.URL.RawQuery
+	} else if !req.URL.IsAbs() {
+		http.Error(w, "api-man proxy: configure this address as your HTTP proxy, or start the proxy with --target", http.StatusBadRequest)
+		return
+	}
+
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("api-man proxy: reading request body: %v", err), http.StatusBadRequest)
+		return
+	}
+	out, err := http.NewRequestWithContext(req.Context(), req.Method, target.String(), bytes.NewReader(body))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("api-man proxy: %v", err), http.StatusBadRequest)
+		return
+	}
+	out.Header = req.Header.Clone()
+	for _, name := range hopHeaders {
+		out.Header.Del(name)
+	}
+	if r.target == nil {
+		out.Host = req.Host
+	}
+
+	start := time.Now()
+	resp, err := r.transport.RoundTrip(out)
+	if err != nil {
+		r.logf("✗ %s %s: %v\n", req.Method, target, err)
+		http.Error(w, fmt.Sprintf("api-man proxy: %v", err), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	duration := time.Since(start)
+	for _, name := range hopHeaders {
+		resp.Header.Del(name)
+	}
+	for name, values := range resp.Header {
+		w.Header()[name] = values
+	}
+	w.WriteHeader(resp.StatusCode)
+	w.Write(respBody)
+	if err != nil {
+		r.logf("✗ %s %s: reading response: %v\n", req.Method, target, err)
+		return
+	}
+
+	result := &ExecutionResult{Status: resp.Status, StatusCode: resp.StatusCode, Headers: resp.Header, Body: respBody}
+	if err := decodeResponse(result); err != nil {
+		r.logf("⚠️  %s %s: %v\n", req.Method, target, err)
+	}
+	r.record(&HistoryEntry{
+		Method:         req.Method,
+		URL:            target.String(),
+		RequestHeaders: r.recordedHeaders(out.Header),
+		RequestBody:    string(body),
+		Status:         resp.Status,
+		StatusCode:     resp.StatusCode,
+		Headers:        resp.Header,
+		Body:           string(result.Body),
+		DurationMS:     duration.Milliseconds(),
+		Timestamp:      start,
+	})
+}
+
+// tunnel passes a CONNECT tunnel through unrecorded: the HTTPS traffic
+// inside it can't be read without intercepting TLS.
+func (r *Recorder) tunnel(w http.ResponseWriter, req *http.Request) {
+	upstream, err := net.DialTimeout("tcp", req.Host, 30*time.Second)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("api-man proxy: %v", err), http.StatusBadGateway)
+		return
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		upstream.Close()
+		http.Error(w, "api-man proxy: tunneling not supported", http.StatusInternalServerError)
+		return
+	}
+	client, buffered, err := hijacker.Hijack()
+	if err != nil {
+		upstream.Close()
+		return
+	}
+
+	r.mu.Lock()
+	if !r.tunneled[req.Host] {
+		r.tunneled[req.Host] = true
+		r.logf("⚠️  HTTPS to %s passes through unrecorded; record it with --target https://%s\n", req.Host, req.Host)
+	}
+	r.mu.Unlock()
+
+	fmt.Fprint(client, "HTTP/1.1 200 Connection Established\r\n\r\n")
+	go func() {
+		io.Copy(upstream, buffered)
+		upstream.Close()
+	}()
+	io.Copy(client, upstream)
+	client.Close()
+}
+
+// recordedHeaders returns the request headers worth keeping: not
+// credentials, and not those any client sends.
+func (r *Recorder) recordedHeaders(header http.Header) http.Header {
+	kept := header.Clone()
+	for _, name := range unrecordedHeaders {
+		kept.Del(name)
+	}
+	for name := range kept {
+		if isSecretKey(name, r.markers) {
+			kept.Del(name)
+		}
+	}
+	return kept
+}
+
+// record logs an exchange, appends it to the session and creates a request
+// for it if its method and path are new.
+func (r *Recorder) record(entry *HistoryEntry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Exchanges++
+	u, _ := url.Parse(entry.URL)
+	r.logf("→ %s %s %d (%dms)\n", entry.Method, u.RequestURI(), entry.StatusCode, entry.DurationMS)
+	if r.session == nil {
+		return
+	}
+
+	path, err := r.addRequest(entry, u)
+	if err != nil {
+		r.logf("✗ creating request for %s %s: %v\n", entry.Method, u.Path, err)
+	}
+	entry.Request = path
+	entry.Environment = r.opts.Name
+	line, err := json.Marshal(entry)
+	if err == nil {
+		_, err = r.session.Write(append(line, '\n'))
+	}
+	if err != nil {
+		r.logf("✗ writing session: %v\n", err)
+	}
+}
+
+// addRequest returns the request entry is an example of, creating it in
+// the collection when its method and path haven't been seen. Requests to
+// the environment's baseURL (the target, or the first origin seen) are
+// relative to it; others keep their absolute URL.
+func (r *Recorder) addRequest(entry *HistoryEntry, u *url.URL) (string, error) {
+	origin := u.Scheme + "://" + u.Host
+	if r.baseURL == "" {
+		r.baseURL = origin
+	}
+	if _, ok := r.cm.environmentFile(r.opts.Name); !ok {
+		env := Environment{
+			BaseURL:   r.baseURL,
+			Headers:   map[string]string{},
+			Cookies:   map[string]string{},
+			Auth:      map[string]string{},
+			Variables: map[string]string{},
+		}
+		if err := r.cm.SaveEnvironment(r.opts.Name, env); err != nil {
+			return "", err
+		}
+		r.logf("+ environment %s (baseURL %s)\n", r.opts.Name, r.baseURL)
+	}
+
+	requestURL := u.Scheme + "://" + u.Host + u.EscapedPath()
+	if rest, ok := strings.CutPrefix(requestURL, r.baseURL); ok && (rest == "" || strings.HasPrefix(rest, "/")) {
+		requestURL = rest
+	}
+	template, pathParams := templatePath(requestURL)
+	key := operationKey(entry.Method, template)
+	if path, ok := r.seen[key]; ok {
+		return path, nil
+	}
+
+	_, route, absolute := strings.Cut(template, "://")
+	if !absolute {
+		route = template
+	}
+	route = strings.Trim(strings.NewReplacer("{", "", "}", "").Replace(route), "/")
+	base := sanitizeRequestPathSegment(strings.ToLower(entry.Method) + "-" + route)
+	name := base
+	for i := 2; ; i++ {
+		if _, exists := r.cm.requestFile(r.opts.Name + "/" + name); !exists {
+			break
+		}
+		name = fmt.Sprintf("%s-%d", base, i)
+	}
+	path := r.opts.Name + "/" + name
+
+	config := RequestConfig{
+		Name:        name,
+		Description: fmt.Sprintf("Recorded by api-man proxy on %s", entry.Timestamp.Format("2006-01-02")),
+		Method:      entry.Method,
+		URL:         template,
+		Headers:     flattenHeaders(entry.RequestHeaders),
+		Cookies:     map[string]string{},
+		Body:        entry.RequestBody,
+		Params:      map[string]interface{}{},
+		PathParams:  pathParams,
+		Timeout:     30,
+	}
+	for param, values := range u.Query() {
+		config.Params[param] = values[0]
+	}
+	if err := r.cm.SaveRequest(path, config); err != nil {
+		return "", err
+	}
+	r.seen[key] = path
+	r.Created = append(r.Created, path)
+	r.logf("+ %s (%s %s)\n", path, entry.Method, template)
+	return path, nil
+}
+
+// templatePath replaces the IDs in a URL path with path params named after
+// the segment before them, e.g. /users/42 becomes /users/{userId} with
+// userId 42.
+func templatePath(path string) (string, map[string]string) {
+	var params map[string]string
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if !pathIDPattern.MatchString(segment) {
+			continue
+		}
+		name := "id"
+		if i > 0 && !strings.HasPrefix(segments[i-1], "{") {
+			name = paramName(segments[i-1]) + "Id"
+		}
+		for n := 2; params[name] != ""; n++ {
+			name = fmt.Sprintf("%s%d", strings.TrimRight(name, "0123456789"), n)
+		}
+		if params == nil {
+			params = make(map[string]string)
+		}
+		params[name] = segment
+		segments[i] = "{" + name + "}"
+	}
+	return strings.Join(segments, "/"), params
+}
+
+// paramName turns a collection segment such as "line-items" into the
+// singular camelCase "lineItem".
+func paramName(segment string) string {
+	words := strings.FieldsFunc(strings.ToLower(segment), func(r rune) bool {
+		return !('a' <= r && r <= 'z' || '0' <= r && r <= '9')
+	})
+	if len(words) == 0 {
+		return "id"
+	}
+	last := words[len(words)-1]
+	switch {
+	case strings.HasSuffix(last, "ies"):
+		last = strings.TrimSuffix(last, "ies") + "y"
+	case strings.HasSuffix(last, "ses"), strings.HasSuffix(last, "xes"):
+		last = strings.TrimSuffix(last, "es")
+	case strings.HasSuffix(last, "s") && !strings.HasSuffix(last, "ss"):
+		last = strings.TrimSuffix(last, "s")
+	}
+	words[len(words)-1] = last
+	name := words[0]
+	for _, word := range words[1:] {
+		name += strings.ToUpper(word[:1]) + word[1:]
+	}
+	return name
+}
+
+func (r *Recorder) logf(format string, args ...interface{}) {
+	fmt.Fprintf(r.opts.Log, format, args...)
+}
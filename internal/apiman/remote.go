@@ -0,0 +1,502 @@
+// remote.go
+package apiman
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// A remote shares requests/, environments/ and suites/ with a team through
+// a git repository or an S3 bucket. api-man remote pull and push compare
+// each file with the version last pulled or pushed, recorded by its hash in
+// .api-man/remote.json: a file changed on one side only is copied to the
+// other, and a file changed differently on both sides is a conflict that
+// neither command overwrites unless told which side wins. Secrets stay
+// local: push refuses files with literal secrets (api-man sync moves them
+// to the secret store), and hidden files and .env files are never synced.
+
+// remoteDirs are the workspace directories a remote holds.
+var remoteDirs = []string{"requests", "environments", "suites"}
+
+// errRemoteMoved is returned by a remoteStore's Push when the remote
+// changed after Fetch.
+var errRemoteMoved = errors.New("the remote changed while pushing (run api-man remote pull, then push again)")
+
+// RemoteState is the workspace's remote and what was last synced with it.
+type RemoteState struct {
+	URL string `json:"url"`
+	// Base maps each synced file to the SHA-256 of its content as of the
+	// last pull or push.
+	Base map[string]string `json:"base,omitempty"`
+	// Synced is when the last pull or push finished.
+	Synced time.Time `json:"synced"`
+}
+
+// RemoteChange is a file copied, or to be copied, one way.
+type RemoteChange struct {
+	Path string `json:"path"`
+	// Action is "add", "update" or "delete".
+	Action string `json:"action"`
+}
+
+// RemoteReport is the outcome of a pull, a push or a status check.
+type RemoteReport struct {
+	URL string `json:"url"`
+	// Incoming are remote changes: pulled by a pull, pending otherwise.
+	Incoming []RemoteChange `json:"incoming,omitempty"`
+	// Outgoing are local changes: pushed by a push, pending otherwise.
+	Outgoing []RemoteChange `json:"outgoing,omitempty"`
+	// Conflicts are files changed differently on both sides and left alone.
+	Conflicts []string `json:"conflicts,omitempty"`
+	// Resolved are conflicts settled by --ours, --theirs or --force.
+	Resolved []string `json:"resolved,omitempty"`
+	// Secrets are literal secrets that stopped a push, as "<file>: <field>".
+	Secrets []string `json:"secrets,omitempty"`
+}
+
+// remoteStore reads and writes the files of a remote, keyed by their
+// slash-separated path in the workspace, e.g. "requests/users/get.json".
+type remoteStore interface {
+	// Fetch returns every synced file on the remote.
+	Fetch(ctx context.Context) (map[string][]byte, error)
+	// Push writes the changed files to the remote; nil content deletes one.
+	Push(ctx context.Context, changes map[string][]byte, message string) error
+	// Close releases what Fetch set up.
+	Close() error
+}
+
+// newRemoteStore returns the store for a remote URL: s3://bucket/prefix for
+// S3, anything else is handed to git.
+func newRemoteStore(rawURL string) (remoteStore, error) {
+	if strings.HasPrefix(rawURL, "s3://") {
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", rawURL, err)
+		}
+		if u.Host == "" {
+			return nil, fmt.Errorf("invalid remote %q: no bucket (expected s3://bucket/prefix)", rawURL)
+		}
+		return newS3Remote(u), nil
+	}
+	if strings.TrimSpace(rawURL) == "" || strings.HasPrefix(rawURL, "-") {
+		return nil, fmt.Errorf("invalid remote %q (expected a git URL or s3://bucket/prefix)", rawURL)
+	}
+	return &gitRemote{url: rawURL}, nil
+}
+
+func (cm *ConfigManager) remoteFile() string {
+	return filepath.Join(cm.stateDir(), "remote.json")
+}
+
+// LoadRemote returns the workspace's remote.
+func (cm *ConfigManager) LoadRemote() (*RemoteState, error) {
+	data, err := os.ReadFile(cm.remoteFile())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("no remote (add one with api-man remote add <git-url|s3-url>)")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading remote: %w", err)
+	}
+	state := &RemoteState{}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", cm.remoteFile(), err)
+	}
+	return state, nil
+}
+
+func (cm *ConfigManager) saveRemote(state *RemoteState) error {
+	if err := os.MkdirAll(cm.stateDir(), 0755); err != nil {
+		return fmt.Errorf("creating state directory: %w", err)
+	}
+	if err := writeJSONFileAtomic(cm.remoteFile(), state, 0644); err != nil {
+		return fmt.Errorf("writing remote: %w", err)
+	}
+	return nil
+}
+
+// AddRemote makes rawURL the workspace's remote. Replacing the remote
+// forgets what was synced with the previous one.
+func (cm *ConfigManager) AddRemote(rawURL string) error {
+	if _, err := newRemoteStore(rawURL); err != nil {
+		return err
+	}
+	if state, err := cm.LoadRemote(); err == nil && state.URL == rawURL {
+		return nil
+	}
+	return cm.saveRemote(&RemoteState{URL: rawURL})
+}
+
+// RemoveRemote forgets the workspace's remote, leaving the remote itself
+// alone.
+func (cm *ConfigManager) RemoveRemote() error {
+	if _, err := cm.LoadRemote(); err != nil {
+		return err
+	}
+	if err := os.Remove(cm.remoteFile()); err != nil {
+		return fmt.Errorf("removing remote: %w", err)
+	}
+	os.RemoveAll(cm.remoteConflictsDir())
+	return nil
+}
+
+// remoteConflictsDir holds the remote's version of conflicting files after
+// a pull, under their workspace paths.
+func (cm *ConfigManager) remoteConflictsDir() string {
+	return filepath.Join(cm.stateDir(), "remote", "conflicts")
+}
+
+// isRemotePath reports whether the slash-separated workspace path p is a
+// file remotes sync: inside remoteDirs, neither hidden nor a .env file.
+func isRemotePath(p string) bool {
+	if !filepath.IsLocal(filepath.FromSlash(p)) {
+		return false
+	}
+	dir, _, _ := strings.Cut(p, "/")
+	if !slices.Contains(remoteDirs, dir) || dir == p {
+		return false
+	}
+	for _, segment := range strings.Split(p, "/") {
+		if strings.HasPrefix(segment, ".") {
+			return false
+		}
+	}
+	return !strings.HasSuffix(p, ".env")
+}
+
+// snapshotRemoteDirs reads the synced files under root, which is a
+// workspace or a checkout of a remote.
+func snapshotRemoteDirs(root string) (map[string][]byte, error) {
+	files := make(map[string][]byte)
+	for _, dir := range remoteDirs {
+		err := filepath.WalkDir(filepath.Join(root, dir), func(file string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(root, file)
+			if err != nil {
+				return err
+			}
+			rel = filepath.ToSlash(rel)
+			if d.IsDir() {
+				if strings.HasPrefix(d.Name(), ".") && rel != dir {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !d.Type().IsRegular() || !isRemotePath(rel) {
+				return nil
+			}
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return err
+			}
+			files[rel] = data
+			return nil
+		})
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("reading %s: %w", dir, err)
+		}
+	}
+	return files, nil
+}
+
+// remotePlan compares the local and remote files with the last synced
+// versions.
+type remotePlan struct {
+	local, remote map[string][]byte
+	incoming      []RemoteChange
+	outgoing      []RemoteChange
+	conflicts     []string
+	// inSync maps the files that are the same on both sides to their hash.
+	inSync map[string]string
+}
+
+func planRemoteSync(base map[string]string, local, remote map[string][]byte) *remotePlan {
+	plan := &remotePlan{local: local, remote: remote, inSync: make(map[string]string)}
+	paths := make(map[string]bool)
+	for _, files := range []map[string][]byte{local, remote} {
+		for p := range files {
+			paths[p] = true
+		}
+	}
+	for p := range base {
+		paths[p] = true
+	}
+
+	for _, p := range sortedKeys(paths) {
+		localData, inLocal := local[p]
+		remoteData, inRemote := remote[p]
+		localHash, remoteHash := "", ""
+		if inLocal {
+			localHash = sha256Hex(localData)
+		}
+		if inRemote {
+			remoteHash = sha256Hex(remoteData)
+		}
+		switch {
+		case localHash == remoteHash:
+			if inLocal {
+				plan.inSync[p] = localHash
+			}
+		case localHash == base[p]:
+			plan.incoming = append(plan.incoming, RemoteChange{Path: p, Action: changeAction(inLocal, inRemote)})
+		case remoteHash == base[p]:
+			plan.outgoing = append(plan.outgoing, RemoteChange{Path: p, Action: changeAction(inRemote, inLocal)})
+		default:
+			plan.conflicts = append(plan.conflicts, p)
+		}
+	}
+	return plan
+}
+
+// changeAction names the change turning a file that does or doesn't exist
+// into one that does or doesn't.
+func changeAction(existed, exists bool) string {
+	switch {
+	case !existed:
+		return "add"
+	case !exists:
+		return "delete"
+	}
+	return "update"
+}
+
+// openRemote fetches the remote and compares it with the workspace.
+func (cm *ConfigManager) openRemote(ctx context.Context) (*RemoteState, remoteStore, *remotePlan, error) {
+	state, err := cm.LoadRemote()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	store, err := newRemoteStore(state.URL)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	remote, err := store.Fetch(ctx)
+	if err != nil {
+		store.Close()
+		return nil, nil, nil, fmt.Errorf("fetching %s: %w", state.URL, err)
+	}
+	local, err := snapshotRemoteDirs(cm.configDir)
+	if err != nil {
+		store.Close()
+		return nil, nil, nil, err
+	}
+	return state, store, planRemoteSync(state.Base, local, remote), nil
+}
+
+// RemoteStatus reports the changes waiting on each side, without changing
+// anything.
+func (cm *ConfigManager) RemoteStatus(ctx context.Context) (*RemoteReport, error) {
+	state, store, plan, err := cm.openRemote(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+	return &RemoteReport{URL: state.URL, Incoming: plan.incoming, Outgoing: plan.outgoing, Conflicts: plan.conflicts}, nil
+}
+
+// PullRemote copies the remote's changes into the workspace. Conflicts are
+// left alone, with the remote's version saved in .api-man/remote/conflicts/,
+// unless resolve is "theirs" (take the remote's version) or "ours" (keep
+// the local one, to be pushed next).
+func (cm *ConfigManager) PullRemote(ctx context.Context, resolve string) (*RemoteReport, error) {
+	unlock, err := cm.lockState("remote")
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	state, store, plan, err := cm.openRemote(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+
+	report := &RemoteReport{URL: state.URL, Incoming: plan.incoming, Outgoing: plan.outgoing}
+	base := plan.inSync
+	take := func(p string) error {
+		data, ok := plan.remote[p]
+		file := filepath.Join(cm.configDir, filepath.FromSlash(p))
+		if !ok {
+			if err := os.Remove(file); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return fmt.Errorf("removing %s: %w", p, err)
+			}
+			return nil
+		}
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			return fmt.Errorf("creating %s: %w", path.Dir(p), err)
+		}
+		if err := writeFileAtomic(file, data, 0644); err != nil {
+			return fmt.Errorf("writing %s: %w", p, err)
+		}
+		base[p] = sha256Hex(data)
+		return nil
+	}
+	for _, change := range plan.incoming {
+		if err := take(change.Path); err != nil {
+			return nil, err
+		}
+	}
+	for _, change := range plan.outgoing {
+		if hash, ok := state.Base[change.Path]; ok {
+			base[change.Path] = hash
+		}
+	}
+
+	os.RemoveAll(cm.remoteConflictsDir())
+	for _, p := range plan.conflicts {
+		data, inRemote := plan.remote[p]
+		_, inLocal := plan.local[p]
+		switch resolve {
+		case "theirs":
+			if err := take(p); err != nil {
+				return nil, err
+			}
+			report.Resolved = append(report.Resolved, p)
+			continue
+		case "ours":
+			// The remote's version becomes the base, so the local one is
+			// an outgoing change.
+			if inRemote {
+				base[p] = sha256Hex(data)
+			}
+			report.Resolved = append(report.Resolved, p)
+			report.Outgoing = append(report.Outgoing, RemoteChange{Path: p, Action: changeAction(inRemote, inLocal)})
+			continue
+		}
+		if hash, ok := state.Base[p]; ok {
+			base[p] = hash
+		}
+		report.Conflicts = append(report.Conflicts, p)
+		if inRemote {
+			saved := filepath.Join(cm.remoteConflictsDir(), filepath.FromSlash(p))
+			if err := os.MkdirAll(filepath.Dir(saved), 0755); err != nil {
+				return nil, fmt.Errorf("saving the remote's %s: %w", p, err)
+			}
+			if err := os.WriteFile(saved, data, 0644); err != nil {
+				return nil, fmt.Errorf("saving the remote's %s: %w", p, err)
+			}
+		}
+	}
+
+	state.Base = base
+	state.Synced = time.Now().UTC()
+	if err := cm.saveRemote(state); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// PushOptions configure PushRemote.
+type PushOptions struct {
+	// Message describes the change, as the commit message on git remotes.
+	Message string
+	// Force overwrites conflicting remote changes with the local files.
+	Force bool
+}
+
+// PushRemote copies the workspace's changes to the remote. It fails without
+// pushing anything when a file to push holds a literal secret, or changed
+// on the remote too and opts.Force isn't set. Remote changes to other files
+// are left to the next pull.
+func (cm *ConfigManager) PushRemote(ctx context.Context, opts PushOptions) (*RemoteReport, error) {
+	unlock, err := cm.lockState("remote")
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	state, store, plan, err := cm.openRemote(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+
+	report := &RemoteReport{URL: state.URL, Incoming: plan.incoming, Outgoing: plan.outgoing}
+	if opts.Force {
+		for _, p := range plan.conflicts {
+			_, inRemote := plan.remote[p]
+			_, inLocal := plan.local[p]
+			report.Outgoing = append(report.Outgoing, RemoteChange{Path: p, Action: changeAction(inRemote, inLocal)})
+			report.Resolved = append(report.Resolved, p)
+		}
+	} else if len(plan.conflicts) > 0 {
+		report.Conflicts = plan.conflicts
+		return report, nil
+	}
+
+	changes := make(map[string][]byte, len(report.Outgoing))
+	for _, change := range report.Outgoing {
+		changes[change.Path] = plan.local[change.Path]
+	}
+	if report.Secrets, err = cm.literalSecrets(changes); err != nil {
+		return nil, err
+	}
+	if len(report.Secrets) > 0 || len(changes) == 0 {
+		return report, nil
+	}
+
+	message := cmp.Or(opts.Message, "Update api-man workspace")
+	if err := store.Push(ctx, changes, message); err != nil {
+		if errors.Is(err, errRemoteMoved) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("pushing to %s: %w", state.URL, err)
+	}
+
+	base := plan.inSync
+	for _, change := range plan.incoming {
+		if hash, ok := state.Base[change.Path]; ok {
+			base[change.Path] = hash
+		}
+	}
+	for p, data := range changes {
+		if data != nil {
+			base[p] = sha256Hex(data)
+		}
+	}
+	state.Base = base
+	state.Synced = time.Now().UTC()
+	if err := cm.saveRemote(state); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// literalSecrets returns the literal secrets, as "<file>: <field>", in the
+// request and environment files about to be pushed.
+func (cm *ConfigManager) literalSecrets(changes map[string][]byte) ([]string, error) {
+	markers, err := cm.secretMarkers()
+	if err != nil {
+		return nil, err
+	}
+	files, err := cm.workspaceFiles()
+	if err != nil {
+		return nil, err
+	}
+	var secrets []string
+	for _, file := range files {
+		rel := cm.relativePath(file.path)
+		if changes[filepath.ToSlash(rel)] == nil {
+			continue
+		}
+		// Invalid files are for api-man lint to report.
+		_, value, err := file.read(rel)
+		if err != nil {
+			continue
+		}
+		for _, field := range file.kind.secretFields(value, markers) {
+			secrets = append(secrets, fmt.Sprintf("%s: %s", rel, field.label))
+		}
+	}
+	return secrets, nil
+}
@@ -0,0 +1,170 @@
+package apiman
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeS3 is an in-memory bucket named "bucket", served path-style, which
+// honours If-Match and If-None-Match: * on writes.
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	writes  int
+}
+
+func newFakeS3(t *testing.T) *fakeS3 {
+	s3 := &fakeS3{objects: make(map[string][]byte)}
+	server := httptest.NewServer(s3)
+	t.Cleanup(server.Close)
+	t.Setenv("AWS_ENDPOINT_URL_S3", server.URL)
+	t.Setenv("AWS_ACCESS_KEY_ID", "id")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	return s3
+}
+
+func (s *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key, ok := strings.CutPrefix(r.URL.Path, "/bucket/")
+	switch {
+	case !ok || key == "":
+		var listing struct {
+			XMLName  xml.Name `xml:"ListBucketResult"`
+			Contents []struct {
+				Key string `xml:"Key"`
+			} `xml:"Contents"`
+		}
+		for _, k := range sortedKeys(s.objects) {
+			if strings.HasPrefix(k, r.URL.Query().Get("prefix")) {
+				listing.Contents = append(listing.Contents, struct {
+					Key string `xml:"Key"`
+				}{k})
+			}
+		}
+		xml.NewEncoder(w).Encode(listing)
+	case r.Method == http.MethodGet:
+		data, ok := s.objects[key]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("ETag", s.etag(key))
+		w.Write(data)
+	case !s.conditionHolds(r, key):
+		w.WriteHeader(http.StatusPreconditionFailed)
+	case r.Method == http.MethodPut:
+		s.objects[key], _ = io.ReadAll(r.Body)
+		s.writes++
+	case r.Method == http.MethodDelete:
+		delete(s.objects, key)
+		s.writes++
+	}
+}
+
+func (s *fakeS3) etag(key string) string {
+	return `"` + sha256Hex(s.objects[key])[:32] + `"`
+}
+
+func (s *fakeS3) conditionHolds(r *http.Request, key string) bool {
+	_, exists := s.objects[key]
+	if etag := r.Header.Get("If-Match"); etag != "" && (!exists || etag != s.etag(key)) {
+		return false
+	}
+	return r.Header.Get("If-None-Match") != "*" || !exists
+}
+
+func TestS3PushDetectsConcurrentChanges(t *testing.T) {
+	s3 := newFakeS3(t)
+	s3.objects["team/requests/a.json"] = []byte("a")
+	s3.objects["team/requests/b.json"] = []byte("b")
+	u, err := url.Parse("s3://bucket/team")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	tests := []struct {
+		name    string
+		change  func()
+		push    map[string][]byte
+		wantErr error
+	}{
+		{"unchanged", func() {}, map[string][]byte{"requests/a.json": []byte("a2"), "requests/c.json": []byte("c")}, nil},
+		{"updated", func() { s3.objects["team/requests/a.json"] = []byte("theirs") }, map[string][]byte{"requests/a.json": []byte("ours")}, errRemoteMoved},
+		{"added", func() { s3.objects["team/requests/d.json"] = []byte("theirs") }, map[string][]byte{"requests/d.json": []byte("ours")}, errRemoteMoved},
+		{"deleted", func() { s3.objects["team/requests/b.json"] = []byte("theirs") }, map[string][]byte{"requests/b.json": nil}, errRemoteMoved},
+	}
+	for _, tt := range tests {
+		remote := newS3Remote(u)
+		if _, err := remote.Fetch(ctx); err != nil {
+			t.Fatal(err)
+		}
+		s3.mu.Lock()
+		tt.change()
+		s3.mu.Unlock()
+		if err := remote.Push(ctx, tt.push, ""); !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: push returned %v, want %v", tt.name, err, tt.wantErr)
+		}
+	}
+	if got := string(s3.objects["team/requests/a.json"]); got != "theirs" {
+		t.Errorf("a.json overwritten: %q", got)
+	}
+}
+
+func TestPushRefusesLiteralSecrets(t *testing.T) {
+	s3 := newFakeS3(t)
+	cm, err := InitWorkspace(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cm.AddRemote("s3://bucket/team"); err != nil {
+		t.Fatal(err)
+	}
+	request := RequestConfig{
+		Method: "GET",
+		URL:    "/users",
+		EnvOverrides: map[string]*RequestOverride{
+			"prod": {
+				Headers: map[string]string{"Authorization": "Bearer literal-token"},
+				Cookies: map[string]string{"session_token": "literal-session"},
+			},
+		},
+	}
+	if err := cm.SaveRequest("users", request); err != nil {
+		t.Fatal(err)
+	}
+	env := Environment{
+		BaseURL: "https://api.example.com",
+		Tracing: &TracingConfig{Endpoint: "https://otel.example.com", Headers: map[string]string{"X-Api-Key": "literal-key"}},
+	}
+	if err := cm.SaveEnvironment("prod", env); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := cm.PushRemote(context.Background(), PushOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"requests/users/request.json: envOverrides.prod.headers.Authorization",
+		"requests/users/request.json: envOverrides.prod.cookies.session_token",
+		"environments/prod.json: tracing.headers.X-Api-Key",
+	} {
+		if !slices.Contains(report.Secrets, want) {
+			t.Errorf("push not refused for %s; secrets: %q", want, report.Secrets)
+		}
+	}
+	if s3.writes != 0 {
+		t.Errorf("%d objects written despite literal secrets", s3.writes)
+	}
+}
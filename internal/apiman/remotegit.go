@@ -0,0 +1,109 @@
+// remotegit.go
+package apiman
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// gitRemote syncs with a git repository through the git command, so the
+// user's credential helpers and SSH keys apply. Fetch makes a shallow clone
+// in a temporary directory; Push commits the changes there and pushes them,
+// failing with errRemoteMoved when someone pushed in between. The synced
+// directories sit at the root of the repository.
+type gitRemote struct {
+	url string
+	// dir is the clone made by Fetch.
+	dir string
+	// env is added to git's environment.
+	env []string
+}
+
+func (g *gitRemote) Fetch(ctx context.Context) (map[string][]byte, error) {
+	if _, err := exec.LookPath("git"); err != nil {
+		return nil, fmt.Errorf("git remotes need git installed: %w", err)
+	}
+	dir, err := os.MkdirTemp("", "api-man-remote-*")
+	if err != nil {
+		return nil, err
+	}
+	g.dir = dir
+	if _, err := g.git(ctx, "", "clone", "--quiet", "--depth", "1", g.url, dir); err != nil {
+		return nil, err
+	}
+	return snapshotRemoteDirs(dir)
+}
+
+func (g *gitRemote) Push(ctx context.Context, changes map[string][]byte, message string) error {
+	for p, data := range changes {
+		file := filepath.Join(g.dir, filepath.FromSlash(p))
+		if data == nil {
+			if err := os.Remove(file); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(file, data, 0644); err != nil {
+			return err
+		}
+	}
+	if _, err := g.git(ctx, g.dir, "add", "--all"); err != nil {
+		return err
+	}
+	status, err := g.git(ctx, g.dir, "status", "--porcelain")
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(status) == "" {
+		return nil
+	}
+	if email, _ := g.git(ctx, g.dir, "config", "user.email"); strings.TrimSpace(email) == "" {
+		// Without an identity of the user's, commit as api-man.
+		g.env = append(g.env, "GIT_AUTHOR_NAME=api-man", "GIT_AUTHOR_EMAIL=api-man@localhost",
+			"GIT_COMMITTER_NAME=api-man", "GIT_COMMITTER_EMAIL=api-man@localhost")
+	}
+	if _, err := g.git(ctx, g.dir, "commit", "--quiet", "--message", message); err != nil {
+		return err
+	}
+	_, err = g.git(ctx, g.dir, "push", "--quiet", "origin", "HEAD")
+	if err != nil && strings.Contains(err.Error(), "[rejected]") {
+		return errRemoteMoved
+	}
+	return err
+}
+
+func (g *gitRemote) Close() error {
+	if g.dir == "" {
+		return nil
+	}
+	return os.RemoveAll(g.dir)
+}
+
+// git runs a git command in dir ("" for the working directory), returning
+// its output or an error with what it printed on stderr.
+func (g *gitRemote) git(ctx context.Context, dir string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	// Never wait for a password on the terminal: credentials come from
+	// helpers and agents.
+	cmd.Env = append(append(os.Environ(), "GIT_TERMINAL_PROMPT=0"), g.env...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return "", fmt.Errorf("git %s: %s", args[0], message)
+		}
+		return "", fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return stdout.String(), nil
+}
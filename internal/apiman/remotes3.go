@@ -0,0 +1,186 @@
+// remotes3.go
+package apiman
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// s3Remote syncs with s3://bucket/prefix, one object per file under the
+// prefix. Credentials are found like aws-sm's: AWS_ACCESS_KEY_ID and
+// AWS_SECRET_ACCESS_KEY, or the AWS_PROFILE profile of ~/.aws/credentials.
+// The region comes from AWS_REGION or AWS_DEFAULT_REGION (default
+// us-east-1); AWS_ENDPOINT_URL_S3 or AWS_ENDPOINT_URL point it at an
+// S3-compatible service such as MinIO, addressed path-style. Push writes
+// conditionally on the ETags Fetch saw, so it doesn't overwrite objects
+// changed in between.
+type s3Remote struct {
+	bucket string
+	// prefix is "" or ends with a slash.
+	prefix string
+	region string
+	// endpoint is set for S3-compatible services.
+	endpoint string
+	creds    *awsCredentials
+	// etags maps each file Fetch read to its object's ETag.
+	etags map[string]string
+}
+
+func newS3Remote(u *url.URL) *s3Remote {
+	remote := &s3Remote{
+		bucket:   u.Host,
+		region:   cmp.Or(awsRegion(""), "us-east-1"),
+		endpoint: strings.TrimRight(cmp.Or(os.Getenv("AWS_ENDPOINT_URL_S3"), os.Getenv("AWS_ENDPOINT_URL")), "/"),
+	}
+	if prefix := strings.Trim(u.Path, "/"); prefix != "" {
+		remote.prefix = prefix + "/"
+	}
+	return remote
+}
+
+// s3Error is the XML body of a failed S3 request.
+type s3Error struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+func (s *s3Remote) Fetch(ctx context.Context) (map[string][]byte, error) {
+	var keys []string
+	query := url.Values{"list-type": {"2"}, "prefix": {s.prefix}}
+	for {
+		body, _, err := s.do(ctx, http.MethodGet, "", query, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		var page struct {
+			Contents []struct {
+				Key string `xml:"Key"`
+			} `xml:"Contents"`
+			IsTruncated           bool   `xml:"IsTruncated"`
+			NextContinuationToken string `xml:"NextContinuationToken"`
+		}
+		if err := xml.Unmarshal(body, &page); err != nil {
+			return nil, fmt.Errorf("s3: parsing the listing of %s: %w", s.bucket, err)
+		}
+		for _, object := range page.Contents {
+			keys = append(keys, object.Key)
+		}
+		if !page.IsTruncated || page.NextContinuationToken == "" {
+			break
+		}
+		query.Set("continuation-token", page.NextContinuationToken)
+	}
+
+	files := make(map[string][]byte)
+	s.etags = make(map[string]string)
+	for _, key := range keys {
+		p := strings.TrimPrefix(key, s.prefix)
+		if !isRemotePath(p) {
+			continue
+		}
+		data, header, err := s.do(ctx, http.MethodGet, key, nil, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		files[p] = data
+		s.etags[p] = header.Get("ETag")
+	}
+	return files, nil
+}
+
+// Push writes an object only if it still has the ETag Fetch saw, or
+// doesn't exist yet when Fetch saw none, and returns errRemoteMoved when S3
+// rejects the condition.
+func (s *s3Remote) Push(ctx context.Context, changes map[string][]byte, message string) error {
+	for _, p := range sortedKeys(changes) {
+		method := http.MethodPut
+		if changes[p] == nil {
+			method = http.MethodDelete
+		}
+		condition := http.Header{}
+		if etag, ok := s.etags[p]; ok && etag != "" {
+			condition.Set("If-Match", etag)
+		} else if !ok && method == http.MethodPut {
+			condition.Set("If-None-Match", "*")
+		}
+		if _, _, err := s.do(ctx, method, s.prefix+p, nil, changes[p], condition); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *s3Remote) Close() error {
+	return nil
+}
+
+// do sends a signed request for key ("" for the bucket) with the extra
+// header and returns the response body and header. A failed precondition
+// is errRemoteMoved.
+func (s *s3Remote) do(ctx context.Context, method, key string, query url.Values, body []byte, header http.Header) ([]byte, http.Header, error) {
+	if s.creds == nil {
+		creds, err := loadAWSCredentials()
+		if err != nil {
+			return nil, nil, fmt.Errorf("s3: %w", err)
+		}
+		s.creds = &creds
+	}
+
+	target := &url.URL{Scheme: "https", Host: s.bucket + ".s3." + s.region + ".amazonaws.com", Path: "/" + key}
+	if s.endpoint != "" {
+		endpoint, err := url.Parse(s.endpoint)
+		if err != nil {
+			return nil, nil, fmt.Errorf("s3: parsing endpoint %s: %w", s.endpoint, err)
+		}
+		target = endpoint.JoinPath(s.bucket, key)
+	}
+	target.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, method, target.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, fmt.Errorf("s3: %w", err)
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.Header.Set("X-Amz-Content-Sha256", sha256Hex(body))
+	signAWSv4(req, body, *s.creds, s.region, "s3", time.Now().UTC())
+
+	resp, err := awsHTTPClient.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("s3: %s %s: %w", method, s.objectName(key), err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("s3: %s %s: %w", method, s.objectName(key), err)
+	}
+	if resp.StatusCode >= 300 {
+		var failure s3Error
+		xml.Unmarshal(data, &failure)
+		// S3 answers 409 ConditionalRequestConflict when a concurrent
+		// write to the object is in progress.
+		if resp.StatusCode == http.StatusPreconditionFailed || failure.Code == "ConditionalRequestConflict" {
+			return nil, nil, errRemoteMoved
+		}
+		message := resp.Status
+		if failure.Code != "" {
+			message = failure.Code + ": " + failure.Message
+		}
+		return nil, nil, fmt.Errorf("s3: %s %s: %s", method, s.objectName(key), message)
+	}
+	return data, resp.Header, nil
+}
+
+func (s *s3Remote) objectName(key string) string {
+	return "s3://" + s.bucket + "/" + key
+}
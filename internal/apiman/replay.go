@@ -0,0 +1,267 @@
+// replay.go
+package apiman
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// replayIgnoredHeaders differ between a recorded response and its replay
+// without the response differing: recordings keep the encoding the client
+// asked for, while replayed bodies are decoded.
+var replayIgnoredHeaders = []string{"Content-Length", "Content-Encoding"}
+
+// ReplayStep is one recorded exchange sent again.
+type ReplayStep struct {
+	Index    int
+	Recorded *HistoryEntry
+	// Diff compares the recorded response (A) with the replayed one (B).
+	// It is nil when the request failed.
+	Diff *EnvironmentDiff
+	Err  error
+}
+
+// OK reports whether the replayed response matched the recording.
+func (s *ReplayStep) OK() bool {
+	return s.Err == nil && s.Diff.Equal()
+}
+
+// ListSessions returns the names of the recorded sessions, sorted.
+func (cm *ConfigManager) ListSessions() ([]string, error) {
+	matches, err := filepath.Glob(cm.sessionFile("*"))
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(matches))
+	for i, match := range matches {
+		names[i] = strings.TrimSuffix(filepath.Base(match), ".jsonl")
+	}
+	slices.Sort(names)
+	return names, nil
+}
+
+// LoadSession reads the exchanges of a recorded session in the order they
+// happened.
+func (cm *ConfigManager) LoadSession(name string) ([]*HistoryEntry, error) {
+	file, err := os.Open(cm.sessionFile(name))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("session %q not found (record one with api-man proxy --record %s)", name, name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading session: %w", err)
+	}
+	defer file.Close()
+
+	var entries []*HistoryEntry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 64<<20)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var entry HistoryEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("parsing session %s line %d: %w", name, line, err)
+		}
+		entries = append(entries, &entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading session: %w", err)
+	}
+	return entries, nil
+}
+
+// ReplaySession sends the requests of a recorded session (see LoadSession)
+// again, one at a time in their original order and with their original
+// bodies, against envName, and compares each response with the recorded
+// one. Requests to the base URL they were recorded against are moved onto
+// envName's, whose headers, cookies and auth are applied over the recorded
+// headers; requests to other hosts are sent unchanged. progress, if not nil, is called after
+// each step. Ctrl+C (ctx) stops the replay after the request in flight.
+func (cm *ConfigManager) ReplaySession(ctx context.Context, entries []*HistoryEntry, envName string, opts DiffOptions, progress func(*ReplayStep)) ([]*ReplayStep, error) {
+	env, client, err := cm.environmentClient(envName)
+	if err != nil {
+		return nil, err
+	}
+	opts.IgnoreHeaders = append(slices.Clone(opts.IgnoreHeaders), replayIgnoredHeaders...)
+
+	recordedBases := make(map[string]string)
+	var steps []*ReplayStep
+	for i, entry := range entries {
+		if ctx.Err() != nil {
+			break
+		}
+		base, ok := recordedBases[entry.Environment]
+		if !ok {
+			base = cm.recordedBaseURL(entry)
+			recordedBases[entry.Environment] = base
+		}
+
+		step := &ReplayStep{Index: i + 1, Recorded: entry}
+		result, err := cm.replayExchange(ctx, client, entry, base, envName, env)
+		if err != nil {
+			step.Err = err
+		} else {
+			step.Diff = compareResults(entry.Request, recordedResult(entry), result, opts)
+		}
+		steps = append(steps, step)
+		if progress != nil {
+			progress(step)
+		}
+	}
+	return steps, nil
+}
+
+// environmentClient loads envName with its variables and secrets resolved,
+// and returns it with a client using its proxy and TLS settings that
+// doesn't follow redirects, for sending requests that weren't built from a
+// request file.
+func (cm *ConfigManager) environmentClient(envName string) (*Environment, *http.Client, error) {
+	env, err := cm.LoadEnvironment(envName)
+	if err != nil {
+		return nil, nil, fmt.Errorf("loading environment: %w", err)
+	}
+	if env, err = cm.resolveEnvironment(envName, env); err != nil {
+		return nil, nil, err
+	}
+	transport, err := cm.httpTransport(env, "")
+	if err != nil {
+		return nil, nil, err
+	}
+	client := &http.Client{
+		Transport: transport,
+		Timeout:   30 * time.Second,
+		// Redirects are compared as they are returned.
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	return env, client, nil
+}
+
+// resolveEnvironment returns env with its variables and secrets resolved.
+func (cm *ConfigManager) resolveEnvironment(envName string, env *Environment) (*Environment, error) {
+	vars, err := cm.environmentVariables(envName, env)
+	if err != nil {
+		return nil, err
+	}
+	secrets, err := cm.resolveSecrets(env)
+	if err != nil {
+		return nil, err
+	}
+	maps.Copy(vars, secrets)
+	return interpolateEnvironment(env, vars), nil
+}
+
+// applyEnvironmentCredentials sets the headers, cookies and auth of env, a
+// resolved environment, on a request that wasn't built from a request file.
+func (cm *ConfigManager) applyEnvironmentCredentials(req *http.Request, envName string, env *Environment) error {
+	for key, value := range env.Headers {
+		if value != "" {
+			req.Header.Set(key, value)
+		}
+	}
+	for name, value := range env.Cookies {
+		if value != "" {
+			req.AddCookie(&http.Cookie{Name: name, Value: value})
+		}
+	}
+	return cm.applyAuth(req, envName, env)
+}
+
+// recordedBaseURL returns the base URL entry was recorded against: the
+// baseURL of the environment recorded with it, or its origin when that is
+// gone or no longer matches.
+func (cm *ConfigManager) recordedBaseURL(entry *HistoryEntry) string {
+	if entry.Environment != "" {
+		if env, err := cm.LoadEnvironment(entry.Environment); err == nil {
+			base := strings.TrimSuffix(env.BaseURL, "/")
+			if base != "" && strings.HasPrefix(entry.URL, base) {
+				return base
+			}
+		}
+	}
+	u, err := url.Parse(entry.URL)
+	if err != nil {
+		return ""
+	}
+	return u.Scheme + "://" + u.Host
+}
+
+// replayExchange sends entry's request to env and records the execution.
+func (cm *ConfigManager) replayExchange(ctx context.Context, client *http.Client, entry *HistoryEntry, recordedBase, envName string, env *Environment) (*ExecutionResult, error) {
+	target := entry.URL
+	rest, rebased := strings.CutPrefix(entry.URL, recordedBase)
+	rebased = rebased && recordedBase != ""
+	if rebased {
+		target = strings.TrimSuffix(requestBaseURL(env.BaseURL), "/") + rest
+	}
+	if err := cm.confirmSend(envName, env, entry.Method, target, false); err != nil {
+		return nil, err
+	}
+	req, redacted, err := cm.unredactedRequest(ctx, entry, target)
+	if err != nil {
+		return nil, err
+	}
+	if rebased || redacted {
+		if err := cm.applyEnvironmentCredentials(req, envName, env); err != nil {
+			return nil, err
+		}
+	}
+
+	startedAt := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, cancelled(ctx, err, startedAt)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, cancelled(ctx, fmt.Errorf("reading response body: %w", err), startedAt)
+	}
+	result := &ExecutionResult{
+		Request:        entry.Request,
+		Environment:    envName,
+		Method:         entry.Method,
+		URL:            target,
+		Status:         resp.Status,
+		StatusCode:     resp.StatusCode,
+		Headers:        resp.Header,
+		Body:           body,
+		Duration:       time.Since(startedAt),
+		StartedAt:      startedAt,
+		RequestHeaders: req.Header,
+		RequestBody:    entry.RequestBody,
+	}
+	if err := decodeResponse(result); err != nil {
+		return nil, err
+	}
+	cm.recordExecution(result, req.Header)
+	return result, nil
+}
+
+// recordedResult presents a recorded exchange as the result it was.
+func recordedResult(entry *HistoryEntry) *ExecutionResult {
+	return &ExecutionResult{
+		Request:     entry.Request,
+		Environment: "recorded",
+		Method:      entry.Method,
+		URL:         entry.URL,
+		Status:      entry.Status,
+		StatusCode:  entry.StatusCode,
+		Headers:     entry.Headers,
+		Body:        []byte(entry.Body),
+		Duration:    time.Duration(entry.DurationMS) * time.Millisecond,
+		StartedAt:   entry.Timestamp,
+		RequestBody: entry.RequestBody,
+	}
+}
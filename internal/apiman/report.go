@@ -0,0 +1,276 @@
+// report.go
+package apiman
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// reportFormats are the test report formats accepted by --report.
+var reportFormats = []string{"junit", "tap"}
+
+// maxAttachedBody caps how much of a request or response body is attached
+// to a failed test in a report.
+const maxAttachedBody = 64 * 1024
+
+// WriteTestReport writes report to out as JUnit XML or TAP version 13.
+// Failed tests carry their assertion messages and, when the request was
+// sent, the request and response.
+func WriteTestReport(out io.Writer, report *TestReport, format string) error {
+	switch format {
+	case "junit":
+		return writeJUnitReport(out, report)
+	case "tap":
+		return writeTAPReport(out, report)
+	default:
+		return fmt.Errorf("unknown report format %q (expected one of %s)", format, strings.Join(reportFormats, ", "))
+	}
+}
+
+// WriteTestReportFile writes report to path, creating its directory.
+func WriteTestReportFile(path string, report *TestReport, format string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("creating report directory: %w", err)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("creating report: %w", err)
+	}
+	if err := WriteTestReport(f, report, format); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Errors   int              `xml:"errors,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Errors    int             `xml:"errors,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Time      string          `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr"`
+	Cases     []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitProblem `xml:"failure,omitempty"`
+	Error     *junitProblem `xml:"error,omitempty"`
+	Skipped   *junitSkipped `xml:"skipped,omitempty"`
+	SystemOut *junitOutput  `xml:"system-out,omitempty"`
+}
+
+type junitProblem struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",cdata"`
+}
+
+type junitOutput struct {
+	Text string `xml:",cdata"`
+}
+
+type junitSkipped struct {
+	Message string `xml:"message,attr,omitempty"`
+}
+
+func writeJUnitReport(out io.Writer, report *TestReport) error {
+	name := report.Name
+	if name == "" {
+		name = "api-man test"
+	}
+	suite := junitTestSuite{
+		Name:      name,
+		Timestamp: time.Now().UTC().Format("2006-01-02T15:04:05"),
+	}
+	var total int64
+	for _, result := range report.Results {
+		tc := junitTestCase{
+			Name:      result.Request,
+			ClassName: junitClassName(name, result.Environment),
+			Time:      junitSeconds(result.DurationMS),
+		}
+		total += result.DurationMS
+		switch {
+		case result.Skipped:
+			tc.Skipped = &junitSkipped{Message: "no assertions"}
+			suite.Skipped++
+		case result.Execution == nil && result.Error != "":
+			// The request never completed, so nothing was asserted.
+			tc.Error = &junitProblem{Message: result.Error, Type: "error", Text: result.Error}
+			suite.Errors++
+		case !result.Passed:
+			message, details := failureSummary(result)
+			tc.Failure = &junitProblem{Message: message, Type: "assertion", Text: details}
+			if result.Execution != nil {
+				tc.SystemOut = &junitOutput{Text: formatExchange(result.Execution)}
+			}
+			suite.Failures++
+		}
+		suite.Cases = append(suite.Cases, tc)
+	}
+	suite.Tests = len(suite.Cases)
+	suite.Time = junitSeconds(total)
+
+	doc := junitTestSuites{
+		Name:     name,
+		Tests:    suite.Tests,
+		Failures: suite.Failures,
+		Errors:   suite.Errors,
+		Skipped:  suite.Skipped,
+		Time:     suite.Time,
+		Suites:   []junitTestSuite{suite},
+	}
+	if _, err := io.WriteString(out, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(out)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(doc); err != nil {
+		return fmt.Errorf("writing JUnit report: %w", err)
+	}
+	_, err := io.WriteString(out, "\n")
+	return err
+}
+
+// junitClassName groups test cases by run and environment, which CI
+// servers display like a package and class.
+func junitClassName(name, env string) string {
+	className := strings.NewReplacer(" ", "-", ".", "-").Replace(name)
+	if env != "" {
+		className += "." + env
+	}
+	return className
+}
+
+func junitSeconds(ms int64) string {
+	return fmt.Sprintf("%.3f", float64(ms)/1000)
+}
+
+// failureSummary returns a one-line message for a failed result and the
+// failed assertions, one per line.
+func failureSummary(result TestResult) (string, string) {
+	var failed []string
+	for _, a := range result.Assertions {
+		if !a.Passed {
+			failed = append(failed, fmt.Sprintf("%s: %s", a.Name, a.Message))
+		}
+	}
+	if len(failed) == 0 {
+		return result.Error, result.Error
+	}
+	return fmt.Sprintf("%d assertion(s) failed", len(failed)), strings.Join(failed, "\n")
+}
+
+// tapDiagnostic is the YAML block attached to a failed TAP test.
+type tapDiagnostic struct {
+	Message    string   `yaml:"message"`
+	Severity   string   `yaml:"severity"`
+	DurationMS int64    `yaml:"duration_ms"`
+	Failures   []string `yaml:"failures,omitempty"`
+	Request    string   `yaml:"request,omitempty"`
+	Response   string   `yaml:"response,omitempty"`
+}
+
+func writeTAPReport(out io.Writer, report *TestReport) error {
+	fmt.Fprintln(out, "TAP version 13")
+	fmt.Fprintf(out, "1..%d\n", len(report.Results))
+	for i, result := range report.Results {
+		description := result.Request
+		if result.Environment != "" {
+			description += " (" + result.Environment + ")"
+		}
+		switch {
+		case result.Skipped:
+			fmt.Fprintf(out, "ok %d - %s # SKIP no assertions\n", i+1, description)
+		case result.Passed:
+			fmt.Fprintf(out, "ok %d - %s # time=%dms\n", i+1, description, result.DurationMS)
+		default:
+			fmt.Fprintf(out, "not ok %d - %s\n", i+1, description)
+			message, _ := failureSummary(result)
+			diagnostic := tapDiagnostic{
+				Message:    message,
+				Severity:   "fail",
+				DurationMS: result.DurationMS,
+			}
+			for _, a := range result.Assertions {
+				if !a.Passed {
+					diagnostic.Failures = append(diagnostic.Failures, fmt.Sprintf("%s: %s", a.Name, a.Message))
+				}
+			}
+			if result.Execution == nil {
+				diagnostic.Severity = "error"
+			} else {
+				diagnostic.Request, diagnostic.Response = exchangeParts(result.Execution)
+			}
+			var data strings.Builder
+			encoder := yaml.NewEncoder(&data)
+			encoder.SetIndent(2)
+			if err := encoder.Encode(diagnostic); err != nil {
+				return fmt.Errorf("writing TAP report: %w", err)
+			}
+			fmt.Fprintln(out, "  ---")
+			fmt.Fprintln(out, indentLines(strings.TrimRight(data.String(), "\n"), "  "))
+			fmt.Fprintln(out, "  ...")
+		}
+	}
+	return nil
+}
+
+// formatExchange renders the request and response of a failed test for
+// attaching to a report.
+func formatExchange(exec *ExecutionResult) string {
+	request, response := exchangeParts(exec)
+	return request + "\n" + response
+}
+
+func exchangeParts(exec *ExecutionResult) (string, string) {
+	var req strings.Builder
+	fmt.Fprintf(&req, "%s %s\n", exec.Method, exec.URL)
+	writeAttachedMessage(&req, exec.RequestHeaders, []byte(exec.RequestBody))
+
+	var resp strings.Builder
+	fmt.Fprintf(&resp, "%s (%dms)\n", exec.Status, exec.DurationMS())
+	writeAttachedMessage(&resp, exec.Headers, exec.Body)
+	return req.String(), resp.String()
+}
+
+func writeAttachedMessage(b *strings.Builder, headers http.Header, body []byte) {
+	writeHeaders(b, headers, "")
+	if len(body) == 0 {
+		return
+	}
+	b.WriteString("\n")
+	switch {
+	case isBinaryBody(body):
+		fmt.Fprintf(b, "(binary data, %d bytes)\n", len(body))
+	case len(body) > maxAttachedBody:
+		fmt.Fprintf(b, "%s\n(truncated, %d bytes total)\n", body[:maxAttachedBody], len(body))
+	default:
+		b.Write(body)
+		b.WriteString("\n")
+	}
+}
@@ -0,0 +1,253 @@
+// requestfiles.go
+package apiman
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// requestFolders are the folders inside requests/<path>/ that belong to the
+// request rather than being requests of their own.
+var requestFolders = []string{requestDataDir, requestExamplesDir}
+
+// isRequestFolder reports whether dir is one of requestFolders of a request
+// rather than a folder of requests.
+func isRequestFolder(dir string) bool {
+	if !slices.Contains(requestFolders, filepath.Base(dir)) {
+		return false
+	}
+	parent := filepath.Dir(dir)
+	if _, ok := findConfigFile(parent); ok {
+		return true
+	}
+	_, ok := findConfigFile(filepath.Join(parent, "request"))
+	return ok
+}
+
+// requestFileSet lists the files making up a stored request: the request
+// file itself (requests/<path>.json or requests/<path>/request.json), the
+// files directly inside requests/<path>/, which hold its body templates,
+// hook scripts and notes, and those in its requestFolders. Other
+// subdirectories are separate requests and don't belong to it.
+type requestFileSet struct {
+	// File is the request file and Nested whether it is <path>/request.*.
+	File   string
+	Nested bool
+	// Dir is requests/<path> and Extra the files in it besides File.
+	Dir   string
+	Extra []string
+}
+
+func (cm *ConfigManager) requestFileSet(requestPath string) (*requestFileSet, error) {
+	file, ok := cm.requestFile(requestPath)
+	if !ok {
+		return nil, fmt.Errorf("request %s not found", requestPath)
+	}
+	dir := filepath.Join(cm.requestsDir, requestPath)
+	set := &requestFileSet{File: file, Nested: filepath.Dir(file) == dir, Dir: dir}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("reading request directory: %w", err)
+	}
+	for _, entry := range entries {
+		name := filepath.Join(dir, entry.Name())
+		if entry.Type().IsRegular() && name != file {
+			set.Extra = append(set.Extra, name)
+		}
+	}
+	for _, folder := range requestFolders {
+		entries, err := os.ReadDir(filepath.Join(dir, folder))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("reading request directory: %w", err)
+		}
+		for _, entry := range entries {
+			if entry.Type().IsRegular() {
+				set.Extra = append(set.Extra, filepath.Join(dir, folder, entry.Name()))
+			}
+		}
+	}
+	return set, nil
+}
+
+// removeEmptyDirs removes the set's directory and folders once they are
+// empty.
+func (s *requestFileSet) removeEmptyDirs(cm *ConfigManager) {
+	for _, folder := range requestFolders {
+		cm.removeEmptyDirs(filepath.Join(s.Dir, folder))
+	}
+	cm.removeEmptyDirs(s.Dir)
+}
+
+// targets maps every file in the set to where it would live as newPath,
+// keeping the request's layout and format.
+func (s *requestFileSet) targets(cm *ConfigManager, newPath string) map[string]string {
+	dir := filepath.Join(cm.requestsDir, newPath)
+	targets := make(map[string]string, len(s.Extra)+1)
+	if s.Nested {
+		targets[s.File] = filepath.Join(dir, filepath.Base(s.File))
+	} else {
+		targets[s.File] = dir + filepath.Ext(s.File)
+	}
+	for _, file := range s.Extra {
+		rel, _ := filepath.Rel(s.Dir, file)
+		targets[file] = filepath.Join(dir, rel)
+	}
+	return targets
+}
+
+// cleanRequestPath normalises a request path given on the command line.
+// When dest ends in "/" the source's base name is appended, like mv.
+func cleanRequestPath(dest, source string) string {
+	dest = filepath.ToSlash(dest)
+	if strings.HasSuffix(dest, "/") {
+		dest += path.Base(source)
+	}
+	return strings.Trim(path.Clean("/"+dest), "/")
+}
+
+// MoveRequest renames a request, moving its body templates, hooks, notes,
+// data files and examples along with it. newPath may end in "/" to keep the
+// request's name.
+func (cm *ConfigManager) MoveRequest(oldPath, newPath string) (string, error) {
+	return cm.relocateRequest(oldPath, newPath, true)
+}
+
+// CopyRequest copies a request with its body templates, hooks, notes, data
+// files and examples.
+func (cm *ConfigManager) CopyRequest(oldPath, newPath string) (string, error) {
+	return cm.relocateRequest(oldPath, newPath, false)
+}
+
+func (cm *ConfigManager) relocateRequest(oldPath, newPath string, move bool) (string, error) {
+	oldPath = cleanRequestPath(oldPath, "")
+	newPath = cleanRequestPath(newPath, oldPath)
+	if newPath == "" || newPath == oldPath {
+		return "", fmt.Errorf("invalid destination %q", newPath)
+	}
+	if strings.HasPrefix(newPath, oldPath+"/") {
+		return "", fmt.Errorf("cannot put %s inside itself", oldPath)
+	}
+	if _, exists := cm.requestFile(newPath); exists {
+		return "", fmt.Errorf("request %s already exists", newPath)
+	}
+
+	set, err := cm.requestFileSet(oldPath)
+	if err != nil {
+		return "", err
+	}
+	targets := set.targets(cm, newPath)
+	for _, target := range targets {
+		if fileExists(target) {
+			return "", fmt.Errorf("%s already exists", cm.relativePath(target))
+		}
+	}
+
+	for source, target := range targets {
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return "", fmt.Errorf("creating directory: %w", err)
+		}
+		if move {
+			err = os.Rename(source, target)
+		} else {
+			err = copyFileMode(source, target)
+		}
+		if err != nil {
+			return "", fmt.Errorf("writing %s: %w", cm.relativePath(target), err)
+		}
+	}
+	if move {
+		set.removeEmptyDirs(cm)
+	}
+
+	// Body templates are referenced by name, so activeBody stays valid; only
+	// a name that mirrored the old path is updated.
+	config, err := cm.LoadRequest(newPath)
+	if err != nil {
+		return newPath, err
+	}
+	if config.Name == path.Base(oldPath) {
+		config.Name = path.Base(newPath)
+		if err := cm.SaveRequest(newPath, *config); err != nil {
+			return newPath, err
+		}
+	}
+	return newPath, nil
+}
+
+// saveRequestEdits writes a method, URL and body edited in the TUI to
+// targetPath, which is sourcePath itself or a new request copied from it
+// with its body templates and hooks. The body goes to the active body
+// template when the request has one, or inline otherwise; a binary active
+// body, which the TUI only previews, is left alone.
+func (cm *ConfigManager) saveRequestEdits(sourcePath, targetPath, method, url, body string) (string, error) {
+	targetPath = cleanRequestPath(targetPath, sourcePath)
+	if targetPath == "" {
+		return "", fmt.Errorf("invalid request path")
+	}
+	if targetPath != sourcePath {
+		var err error
+		if targetPath, err = cm.CopyRequest(sourcePath, targetPath); err != nil {
+			return "", err
+		}
+	}
+	config, err := cm.LoadRequest(targetPath)
+	if err != nil {
+		return "", err
+	}
+	config.Method, config.URL = method, url
+	if err := cm.SaveRequest(targetPath, *config); err != nil {
+		return "", err
+	}
+	if hasBinaryBody(config) {
+		return targetPath, nil
+	}
+	if err := cm.SaveBody(targetPath, body); err != nil {
+		return "", err
+	}
+	return targetPath, nil
+}
+
+// DeleteRequest deletes a request with its body templates, hooks, notes,
+// data files and examples.
+func (cm *ConfigManager) DeleteRequest(requestPath string) error {
+	set, err := cm.requestFileSet(cleanRequestPath(requestPath, ""))
+	if err != nil {
+		return err
+	}
+	for _, file := range append([]string{set.File}, set.Extra...) {
+		if err := os.Remove(file); err != nil {
+			return fmt.Errorf("removing %s: %w", cm.relativePath(file), err)
+		}
+	}
+	set.removeEmptyDirs(cm)
+	return nil
+}
+
+// removeEmptyDirs removes dir and then its parents while they are empty
+// (or already gone), stopping at the requests directory.
+func (cm *ConfigManager) removeEmptyDirs(dir string) {
+	for dir != cm.requestsDir && strings.HasPrefix(dir, cm.requestsDir) {
+		if err := os.Remove(dir); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+func copyFileMode(src, dst string) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(dst, data, info.Mode().Perm())
+}
@@ -0,0 +1,147 @@
+// runall.go
+package apiman
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"sync"
+	"text/tabwriter"
+)
+
+// BatchResult is the outcome of one request of a batch run by RunBatch.
+type BatchResult struct {
+	Request    string `json:"request"`
+	Status     string `json:"status,omitempty"`
+	StatusCode int    `json:"statusCode,omitempty"`
+	DurationMS int64  `json:"durationMs"`
+	Size       int    `json:"size"`
+	OverBudget bool   `json:"overBudget,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// OK reports whether the request got a response below 400.
+func (r *BatchResult) OK() bool {
+	return r.Error == "" && r.StatusCode < 400
+}
+
+// ResolveRequestPattern returns the requests a run-all target names: a
+// request, a directory of requests, or a glob such as "users/*" or
+// "*/get-*". A glob matches a request when it matches the request's path or
+// one of its parent directories, so "users/*" includes users/admin/list.
+func (cm *ConfigManager) ResolveRequestPattern(pattern string) ([]string, error) {
+	pattern = strings.Trim(pattern, "/")
+	if !strings.ContainsAny(pattern, "*?[") {
+		return cm.ResolveRequestTargets(pattern)
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+	}
+	paths, err := cm.RequestPaths()
+	if err != nil {
+		return nil, err
+	}
+	var matches []string
+	for _, p := range paths {
+		for prefix := p; prefix != "."; prefix = path.Dir(prefix) {
+			if ok, _ := path.Match(pattern, prefix); ok {
+				matches = append(matches, p)
+				break
+			}
+		}
+	}
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("no requests match %s", pattern)
+	}
+	return matches, nil
+}
+
+// RunBatch executes requestPaths against envName, parallel at a time, and
+// returns their results in the order given. done, when set, is called as
+// each request finishes, one call at a time. Cancelling ctx aborts the
+// requests in flight and skips the rest.
+func (cm *ConfigManager) RunBatch(ctx context.Context, requestPaths []string, envName string, parallel int, done func(BatchResult)) []BatchResult {
+	results := make([]BatchResult, len(requestPaths))
+	workers := min(max(parallel, 1), len(requestPaths))
+	jobs := make(chan int)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				result := BatchResult{Request: requestPaths[i]}
+				exec, err := cm.RunRequestContext(ctx, requestPaths[i], envName, RequestOptions{})
+				if err != nil {
+					result.Error = err.Error()
+				} else {
+					result.Status = exec.Status
+					result.StatusCode = exec.StatusCode
+					result.DurationMS = exec.DurationMS()
+					result.Size = len(exec.Body)
+					result.OverBudget = exec.OverBudget()
+				}
+				results[i] = result
+				if done != nil {
+					mu.Lock()
+					done(result)
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	for i := range requestPaths {
+		if ctx.Err() != nil {
+			results[i] = BatchResult{Request: requestPaths[i], Error: "skipped: cancelled"}
+			continue
+		}
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return results
+}
+
+// printBatchResult writes the one-line progress report of a finished
+// request.
+func printBatchResult(out io.Writer, result BatchResult) {
+	if result.Error != "" {
+		fmt.Fprintf(out, "✗ %s\n    %s\n", result.Request, result.Error)
+		return
+	}
+	marker := "✓"
+	if !result.OK() {
+		marker = "✗"
+	}
+	fmt.Fprintf(out, "%s %s %d (%dms, %s)\n", marker, result.Request, result.StatusCode, result.DurationMS, formatSize(int64(result.Size)))
+}
+
+// printBatchSummary writes the status, latency and size of every request as
+// a table, then how many failed.
+func printBatchSummary(out io.Writer, results []BatchResult) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "REQUEST\tSTATUS\tTIME\tSIZE\tRESULT")
+	failed := 0
+	for _, result := range results {
+		status, duration, size := "-", "-", "-"
+		if result.Error == "" {
+			status = fmt.Sprint(result.StatusCode)
+			duration = fmt.Sprintf("%dms", result.DurationMS)
+			if result.OverBudget {
+				duration += " ⚠️"
+			}
+			size = formatSize(int64(result.Size))
+		}
+		outcome := "ok"
+		if !result.OK() {
+			outcome = "FAIL"
+			failed++
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", result.Request, status, duration, size, outcome)
+	}
+	w.Flush()
+	fmt.Fprintf(out, "\n%d ok, %d failed\n", len(results)-failed, failed)
+}
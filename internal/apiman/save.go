@@ -0,0 +1,85 @@
+// save.go
+package apiman
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// defaultSaveName is used when a save path names a directory.
+const defaultSaveName = "{{request}}-{{timestamp}}"
+
+// SaveResponse writes the response body, byte for byte, to the path given by
+// pathTemplate and returns the path written. The template may use
+// {{request}}, {{env}}, {{timestamp}} and {{status}}; relative paths are
+// resolved against the workspace. A path ending in a separator, or naming an
+// existing directory, gets the file name from the Content-Disposition header
+// or a generated one with an extension matching the response's Content-Type.
+func (cm *ConfigManager) SaveResponse(result *ExecutionResult, pathTemplate string) (string, error) {
+	now := time.Now()
+	path := expandSaveTemplate(pathTemplate, result, now)
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(cm.configDir, path)
+	}
+	if strings.HasSuffix(pathTemplate, "/") || strings.HasSuffix(pathTemplate, string(filepath.Separator)) || dirExists(path) {
+		name := attachmentName(result)
+		if name == "" {
+			name = expandSaveTemplate(defaultSaveName, result, now) + responseExtension(result)
+		}
+		path = filepath.Join(path, name)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", fmt.Errorf("creating directory for response: %w", err)
+	}
+	if err := os.WriteFile(path, result.Body, 0644); err != nil {
+		return "", fmt.Errorf("writing response: %w", err)
+	}
+	return path, nil
+}
+
+func expandSaveTemplate(template string, result *ExecutionResult, now time.Time) string {
+	return strings.NewReplacer(
+		"{{request}}", sanitizeRequestPathSegment(result.Request),
+		"{{env}}", sanitizeRequestPathSegment(result.Environment),
+		"{{timestamp}}", now.Format("20060102-150405"),
+		"{{status}}", strconv.Itoa(result.StatusCode),
+	).Replace(template)
+}
+
+// responseExtension picks a file extension for a response body from its
+// Content-Type, falling back to sniffing JSON and text.
+func responseExtension(result *ExecutionResult) string {
+	mediaType, _, _ := mime.ParseMediaType(result.Headers.Get("Content-Type"))
+	switch {
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		return ".json"
+	case strings.HasPrefix(mediaType, "text/plain"):
+		return ".txt"
+	}
+	if exts, _ := mime.ExtensionsByType(mediaType); len(exts) > 0 {
+		return exts[0]
+	}
+	switch {
+	case json.Valid(result.Body):
+		return ".json"
+	case isBinaryBody(result.Body):
+		return ".bin"
+	default:
+		return ".txt"
+	}
+}
+
+// isBinaryBody reports whether body would garble a terminal: anything that
+// isn't valid UTF-8 or contains NUL bytes.
+func isBinaryBody(body []byte) bool {
+	return !utf8.Valid(body) || bytes.IndexByte(body, 0) >= 0
+}
@@ -0,0 +1,211 @@
+// schema.go
+package apiman
+
+import (
+	"fmt"
+	"math"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// schemaViolation is one place where a JSON value breaks its schema.
+type schemaViolation struct {
+	Path    string
+	Message string
+}
+
+func (v schemaViolation) String() string {
+	return v.Path + ": " + v.Message
+}
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// validateSchema checks a decoded JSON value against a JSON Schema as
+// written by jsonSchema, returning every violation with its JSONPath.
+// Supported keywords: type, enum, required, properties,
+// additionalProperties, items, allOf, anyOf, oneOf, the length, size and
+// range limits, pattern and the date-time, date, email, uuid and uri
+// formats.
+func validateSchema(schema map[string]interface{}, value interface{}) []schemaViolation {
+	var violations []schemaViolation
+	checkSchema(schema, value, "$", &violations)
+	return violations
+}
+
+func checkSchema(schema map[string]interface{}, value interface{}, path string, out *[]schemaViolation) {
+	fail := func(format string, args ...interface{}) {
+		*out = append(*out, schemaViolation{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if types := schemaTypes(schema); len(types) > 0 && !slices.ContainsFunc(types, func(t string) bool { return matchesJSONType(t, value) }) {
+		fail("expected %s, got %s", strings.Join(types, " or "), jsonTypeName(value))
+		return
+	}
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		if !slices.ContainsFunc(enum, func(e interface{}) bool { return reflect.DeepEqual(e, value) }) {
+			fail("%s is not one of %s", compactJSON(value), compactJSON(enum))
+		}
+	}
+
+	if parts, ok := schema["allOf"].([]interface{}); ok {
+		for _, part := range parts {
+			if sub, ok := part.(map[string]interface{}); ok {
+				checkSchema(sub, value, path, out)
+			}
+		}
+	}
+	if parts, ok := schema["anyOf"].([]interface{}); ok && countMatching(parts, value) == 0 {
+		fail("does not match any of the anyOf schemas")
+	}
+	if parts, ok := schema["oneOf"].([]interface{}); ok {
+		if n := countMatching(parts, value); n != 1 {
+			fail("matches %d of the oneOf schemas, expected exactly 1", n)
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		properties, _ := schema["properties"].(map[string]interface{})
+		if required, ok := schema["required"].([]interface{}); ok {
+			for _, entry := range required {
+				name, _ := entry.(string)
+				if _, present := v[name]; !present {
+					*out = append(*out, schemaViolation{Path: jsonPathChild(path, name), Message: "required property is missing"})
+				}
+			}
+		}
+		for _, name := range sortedKeys(v) {
+			childPath := jsonPathChild(path, name)
+			if sub, ok := properties[name].(map[string]interface{}); ok {
+				checkSchema(sub, v[name], childPath, out)
+				continue
+			}
+			switch additional := schema["additionalProperties"].(type) {
+			case bool:
+				if !additional {
+					*out = append(*out, schemaViolation{Path: childPath, Message: "property is not allowed"})
+				}
+			case map[string]interface{}:
+				checkSchema(additional, v[name], childPath, out)
+			}
+		}
+
+	case []interface{}:
+		if limit, ok := schemaNumber(schema, "minItems"); ok && float64(len(v)) < limit {
+			fail("has %d items, expected at least %v", len(v), limit)
+		}
+		if limit, ok := schemaNumber(schema, "maxItems"); ok && float64(len(v)) > limit {
+			fail("has %d items, expected at most %v", len(v), limit)
+		}
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range v {
+				checkSchema(items, item, fmt.Sprintf("%s[%d]", path, i), out)
+			}
+		}
+
+	case string:
+		length := float64(utf8.RuneCountInString(v))
+		if limit, ok := schemaNumber(schema, "minLength"); ok && length < limit {
+			fail("is %v characters, expected at least %v", length, limit)
+		}
+		if limit, ok := schemaNumber(schema, "maxLength"); ok && length > limit {
+			fail("is %v characters, expected at most %v", length, limit)
+		}
+		if pattern, ok := schema["pattern"].(string); ok {
+			if re, err := regexp.Compile(pattern); err == nil && !re.MatchString(v) {
+				fail("%q does not match /%s/", v, pattern)
+			}
+		}
+		if format, ok := schema["format"].(string); ok && !matchesFormat(format, v) {
+			fail("%q is not a valid %s", v, format)
+		}
+
+	case float64:
+		if limit, ok := schemaNumber(schema, "minimum"); ok {
+			if exclusive, _ := schema["exclusiveMinimum"].(bool); (exclusive && v <= limit) || v < limit {
+				fail("%v is less than the minimum %v", v, limit)
+			}
+		}
+		if limit, ok := schemaNumber(schema, "maximum"); ok {
+			if exclusive, _ := schema["exclusiveMaximum"].(bool); (exclusive && v >= limit) || v > limit {
+				fail("%v is greater than the maximum %v", v, limit)
+			}
+		}
+	}
+}
+
+func schemaTypes(schema map[string]interface{}) []string {
+	switch t := schema["type"].(type) {
+	case string:
+		return []string{t}
+	case []interface{}:
+		var types []string
+		for _, name := range t {
+			if name, ok := name.(string); ok {
+				types = append(types, name)
+			}
+		}
+		return types
+	}
+	return nil
+}
+
+func matchesJSONType(typeName string, value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return typeName == "null"
+	case map[string]interface{}:
+		return typeName == "object"
+	case []interface{}:
+		return typeName == "array"
+	case string:
+		return typeName == "string"
+	case bool:
+		return typeName == "boolean"
+	case float64:
+		return typeName == "number" || (typeName == "integer" && v == math.Trunc(v))
+	}
+	return false
+}
+
+func countMatching(schemas []interface{}, value interface{}) int {
+	n := 0
+	for _, s := range schemas {
+		if sub, ok := s.(map[string]interface{}); ok && len(validateSchema(sub, value)) == 0 {
+			n++
+		}
+	}
+	return n
+}
+
+func schemaNumber(schema map[string]interface{}, keyword string) (float64, bool) {
+	n, ok := schema[keyword].(float64)
+	return n, ok
+}
+
+// matchesFormat checks the string formats worth catching; others pass.
+func matchesFormat(format, value string) bool {
+	switch format {
+	case "date-time":
+		_, err := time.Parse(time.RFC3339, value)
+		return err == nil
+	case "date":
+		_, err := time.Parse(time.DateOnly, value)
+		return err == nil
+	case "email":
+		_, err := mail.ParseAddress(value)
+		return err == nil
+	case "uuid":
+		return uuidPattern.MatchString(value)
+	case "uri", "url":
+		u, err := url.Parse(value)
+		return err == nil && u.Scheme != ""
+	}
+	return true
+}
@@ -0,0 +1,309 @@
+// script.go
+package apiman
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/dop251/goja"
+)
+
+// scriptTimeout bounds a single script, so a runaway loop can't hang a run.
+const scriptTimeout = 5 * time.Second
+
+// scriptPrefix marks a hook or extract rule written in JavaScript.
+const scriptPrefix = "js:"
+
+// scriptScope is the data inline JavaScript runs against: "expect"
+// assertions, "js:" extract rules and "js:" hooks, checks too small for a
+// shell hook. Scripts see
+//
+//	response  status, statusText, headers (lower-case names), body (text)
+//	          and durationMs of the response, when there is one
+//	body      the JSON response body, parsed; in a pre-request hook, the
+//	          JSON request body, which the hook may change
+//	request   method, url, headers and body of the request
+//	vars      the request's variables, including values from earlier chain
+//	          steps; hooks export what they set on it
+//	env       the shell's environment variables
+//
+// and console.log, which writes to stderr. Request and Response are nil when
+// there is none.
+type scriptScope struct {
+	Request   *scriptRequest
+	Response  *scriptResponse
+	Variables map[string]string
+}
+
+type scriptRequest struct {
+	Method  string            `json:"method"`
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers"`
+	Body    string            `json:"body"`
+}
+
+type scriptResponse struct {
+	Status     int               `json:"status"`
+	StatusText string            `json:"statusText"`
+	Headers    map[string]string `json:"headers"`
+	Body       string            `json:"body"`
+	DurationMS int64             `json:"durationMs"`
+}
+
+// responseScope is the scope of assertions and extract rules evaluated
+// against result.
+func responseScope(result *ExecutionResult) scriptScope {
+	return scriptScope{
+		Request: &scriptRequest{
+			Method:  result.Method,
+			URL:     result.URL,
+			Headers: flattenHeaders(result.RequestHeaders),
+			Body:    result.RequestBody,
+		},
+		Response: &scriptResponse{
+			Status:     result.StatusCode,
+			StatusText: result.Status,
+			Headers:    lowerHeaders(flattenHeaders(result.Headers)),
+			Body:       string(result.Body),
+			DurationMS: result.DurationMS(),
+		},
+		Variables: mergeVariables(result.ResolvedVariables, result.Variables),
+	}
+}
+
+func lowerHeaders(headers map[string]string) map[string]string {
+	lower := make(map[string]string, len(headers))
+	for name, value := range headers {
+		lower[strings.ToLower(name)] = value
+	}
+	return lower
+}
+
+// scriptRuntime is a JavaScript runtime holding a scope.
+type scriptRuntime struct {
+	vm *goja.Runtime
+}
+
+// newScriptRuntime sets up a runtime with scope's globals. The JSON body is
+// the response's, or the request's when there is no response.
+func newScriptRuntime(scope scriptScope) (*scriptRuntime, error) {
+	rt := &scriptRuntime{vm: goja.New()}
+	console := rt.vm.NewObject()
+	console.Set("log", func(call goja.FunctionCall) goja.Value {
+		args := make([]string, len(call.Arguments))
+		for i, arg := range call.Arguments {
+			args[i] = arg.String()
+		}
+		fmt.Fprintln(os.Stderr, strings.Join(args, " "))
+		return goja.Undefined()
+	})
+	rt.vm.Set("console", console)
+
+	environ := make(map[string]string)
+	for _, entry := range os.Environ() {
+		if name, value, ok := strings.Cut(entry, "="); ok {
+			environ[name] = value
+		}
+	}
+	globals := map[string]interface{}{"env": environ, "vars": scope.Variables}
+	if globals["vars"] == nil {
+		globals["vars"] = map[string]string{}
+	}
+	body := ""
+	if scope.Request != nil {
+		globals["request"] = scope.Request
+		body = scope.Request.Body
+	}
+	if scope.Response != nil {
+		globals["response"] = scope.Response
+		body = scope.Response.Body
+	}
+	for name, value := range globals {
+		if err := rt.setJSON(name, value); err != nil {
+			return nil, err
+		}
+	}
+	rt.vm.Set("body", goja.Undefined())
+	if json.Valid([]byte(body)) {
+		if err := rt.setJSON("body", json.RawMessage(body)); err != nil {
+			return nil, err
+		}
+	}
+	return rt, nil
+}
+
+// setJSON defines a global holding value as plain JavaScript data.
+func (rt *scriptRuntime) setJSON(name string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	parsed, err := rt.vm.RunString("(" + string(data) + ")")
+	if err != nil {
+		return fmt.Errorf("setting up %s: %w", name, err)
+	}
+	return rt.vm.Set(name, parsed)
+}
+
+// getJSON returns a global encoded as JSON, or "" when it is undefined.
+func (rt *scriptRuntime) getJSON(name string) (string, error) {
+	value := rt.vm.Get(name)
+	if value == nil || goja.IsUndefined(value) {
+		return "", nil
+	}
+	stringify, _ := goja.AssertFunction(rt.vm.Get("JSON").ToObject(rt.vm).Get("stringify"))
+	encoded, err := stringify(goja.Undefined(), value)
+	if err != nil {
+		return "", err
+	}
+	if goja.IsUndefined(encoded) {
+		return "", nil
+	}
+	return encoded.String(), nil
+}
+
+// run evaluates source, stopping it after scriptTimeout.
+func (rt *scriptRuntime) run(source string) (goja.Value, error) {
+	timer := time.AfterFunc(scriptTimeout, func() {
+		rt.vm.Interrupt(fmt.Sprintf("script ran longer than %s", scriptTimeout))
+	})
+	defer timer.Stop()
+	value, err := rt.vm.RunString(source)
+	if err != nil {
+		var exception *goja.Exception
+		if errors.As(err, &exception) {
+			return nil, errors.New(exception.Value().String())
+		}
+		var interrupted *goja.InterruptedError
+		if errors.As(err, &interrupted) {
+			return nil, fmt.Errorf("%v", interrupted.Value())
+		}
+		return nil, err
+	}
+	return value, nil
+}
+
+// checkScript reports a syntax error in source without running it.
+func checkScript(source string) error {
+	_, err := goja.Compile("", source, false)
+	return err
+}
+
+// evalScript evaluates a JavaScript expression against scope.
+func evalScript(source string, scope scriptScope) (goja.Value, error) {
+	rt, err := newScriptRuntime(scope)
+	if err != nil {
+		return nil, err
+	}
+	return rt.run(source)
+}
+
+// scriptValueString converts a script's result into a variable value, as
+// jsonValueString does for extracted JSON.
+func scriptValueString(value goja.Value) string {
+	if value == nil || goja.IsUndefined(value) || goja.IsNull(value) {
+		return ""
+	}
+	return jsonValueString(value.Export())
+}
+
+// runScriptHook runs a hook written in JavaScript. It receives the same
+// input as a shell hook and its changes to request, body and vars become
+// the hook's output.
+func runScriptHook(source string, input HookInput) (*HookOutput, error) {
+	scope := scriptScope{
+		Request: &scriptRequest{
+			Method:  input.Method,
+			URL:     input.URL,
+			Headers: maps.Clone(input.Headers),
+			Body:    input.Body,
+		},
+		Variables: input.Variables,
+	}
+	if response := input.Response; response != nil {
+		scope.Response = &scriptResponse{
+			Status:     response.StatusCode,
+			StatusText: response.Status,
+			Headers:    lowerHeaders(response.Headers),
+			Body:       response.Body,
+			DurationMS: response.DurationMS,
+		}
+	}
+	rt, err := newScriptRuntime(scope)
+	if err != nil {
+		return nil, err
+	}
+	bodyBefore, err := rt.getJSON("body")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := rt.run(source); err != nil {
+		return nil, err
+	}
+
+	output := &HookOutput{}
+	varsJSON, err := rt.getJSON("vars")
+	if err != nil {
+		return nil, err
+	}
+	var vars map[string]interface{}
+	if err := json.Unmarshal([]byte(varsJSON), &vars); err != nil {
+		return nil, fmt.Errorf("vars must stay an object: %w", err)
+	}
+	for name, value := range vars {
+		if s := jsonValueString(value); s != input.Variables[name] {
+			if output.Variables == nil {
+				output.Variables = make(map[string]string)
+			}
+			output.Variables[name] = s
+		}
+	}
+	if input.Response != nil {
+		// Post-response hooks can only set variables.
+		return output, nil
+	}
+
+	requestJSON, err := rt.getJSON("request")
+	if err != nil {
+		return nil, err
+	}
+	var request scriptRequest
+	if err := json.Unmarshal([]byte(requestJSON), &request); err != nil {
+		return nil, fmt.Errorf("request must stay an object: %w", err)
+	}
+	if request.Method != input.Method {
+		output.Method = &request.Method
+	}
+	if request.URL != input.URL {
+		output.URL = &request.URL
+	}
+	for name, value := range request.Headers {
+		if input.Headers[name] != value {
+			if output.Headers == nil {
+				output.Headers = make(map[string]string)
+			}
+			output.Headers[name] = value
+		}
+	}
+	for name := range input.Headers {
+		if _, ok := request.Headers[name]; !ok {
+			if output.Headers == nil {
+				output.Headers = make(map[string]string)
+			}
+			output.Headers[name] = ""
+		}
+	}
+	if request.Body != input.Body {
+		output.Body = &request.Body
+	} else if bodyAfter, err := rt.getJSON("body"); err != nil {
+		return nil, err
+	} else if bodyAfter != bodyBefore {
+		output.Body = &bodyAfter
+	}
+	return output, nil
+}
@@ -0,0 +1,151 @@
+// search.go
+package apiman
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// requestEntry is the searchable summary of a stored request.
+type requestEntry struct {
+	Path        string   `json:"path"`
+	Method      string   `json:"method,omitempty"`
+	URL         string   `json:"url,omitempty"`
+	Name        string   `json:"name,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+}
+
+// requestIndex loads a summary of every request in the workspace, sorted by
+// path. gRPC requests have the method GRPC and their full method as URL, and
+// tags include those inherited from _defaults.json files.
+// Requests that fail to load are listed by path alone.
+func (cm *ConfigManager) requestIndex() ([]requestEntry, error) {
+	paths, err := cm.RequestPaths()
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]requestEntry, 0, len(paths))
+	for _, path := range paths {
+		entry := requestEntry{Path: path}
+		if config, err := cm.LoadRequest(path); err == nil {
+			entry.Method = strings.ToUpper(config.Method)
+			entry.URL = config.URL
+			if config.GRPC != nil {
+				entry.Method = "GRPC"
+				entry.URL = config.GRPC.FullMethod()
+			}
+			if defaults, err := cm.requestDefaults(path); err == nil {
+				config.applyDefaults(defaults)
+			}
+			entry.Tags = config.Tags
+			entry.Name = config.Name
+			entry.Description = config.Description
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// searchRequests returns the entries matching query, best match first. Each
+// whitespace-separated term must fuzzily match the path, name, URL, method,
+// tags or description, i.e. its characters must appear there in order; "gtusr"
+// finds "get-user". Path and name matches rank above the others, and
+// contiguous matches and matches at word starts rank higher.
+func searchRequests(entries []requestEntry, query string) []requestEntry {
+	terms := strings.Fields(strings.ToLower(query))
+	if len(terms) == 0 {
+		return entries
+	}
+
+	type scored struct {
+		entry requestEntry
+		score int
+	}
+	var matches []scored
+	for _, entry := range entries {
+		total := 0
+		for _, term := range terms {
+			best := 0
+			for _, field := range []struct {
+				text   string
+				weight int
+			}{
+				{entry.Path, 3},
+				{entry.Name, 3},
+				{entry.URL, 2},
+				{entry.Method, 2},
+				{strings.Join(entry.Tags, " "), 2},
+				{entry.Description, 1},
+			} {
+				if score := fuzzyScore(term, field.text); score > 0 {
+					best = max(best, score*field.weight)
+				}
+			}
+			if best == 0 {
+				total = 0
+				break
+			}
+			total += best
+		}
+		if total > 0 {
+			matches = append(matches, scored{entry, total})
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].score > matches[j].score
+	})
+	results := make([]requestEntry, len(matches))
+	for i, match := range matches {
+		results[i] = match.entry
+	}
+	return results
+}
+
+// fuzzyScore scores how well term (lower case) matches text as an ordered
+// subsequence, returning 0 when it doesn't. An exact substring scores
+// highest.
+func fuzzyScore(term, text string) int {
+	if text == "" {
+		return 0
+	}
+	lower := strings.ToLower(text)
+	if i := strings.Index(lower, term); i >= 0 {
+		score := 10 * len(term)
+		if i == 0 || isWordBoundary(rune(lower[i-1])) {
+			score += 5
+		}
+		return score
+	}
+
+	score := 0
+	run := 0
+	prev := ' '
+	remaining := []rune(term)
+	for _, r := range lower {
+		if len(remaining) == 0 {
+			break
+		}
+		if r == remaining[0] {
+			remaining = remaining[1:]
+			run++
+			score += run
+			if isWordBoundary(prev) {
+				score += 3
+			}
+		} else {
+			run = 0
+		}
+		prev = r
+	}
+	if len(remaining) > 0 {
+		return 0
+	}
+	return score
+}
+
+func isWordBoundary(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+}
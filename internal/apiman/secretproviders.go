@@ -0,0 +1,251 @@
+// secretproviders.go
+package apiman
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Secrets kept in an external backend are referenced as
+// {{provider:reference}} and fetched when a request is executed, so rotated
+// values never need copying into the workspace:
+//
+//	"auth": {"type": "bearer", "token": "{{vault:secret/data/api#token}}"}
+//	"headers": {"X-Api-Key": "{{aws-sm:prod/api-key}}"}
+//
+// vault and aws-sm are built in (see vault.go and awssm.go). Any other
+// provider is an executable named api-man-secret-<provider>, looked up in
+// the workspace's plugins/ directory and then on PATH, which is run with
+// the reference as its argument and prints the value on stdout.
+const externalSecretTimeout = 30 * time.Second
+
+// secretPluginPrefix is the name every secret provider executable starts
+// with.
+const secretPluginPrefix = "api-man-secret-"
+
+// secretCacheTTLEnv sets how long fetched values are reused, as a Go
+// duration; "0" disables the cache.
+const secretCacheTTLEnv = "API_MAN_SECRET_CACHE_TTL"
+
+const defaultSecretCacheTTL = 5 * time.Minute
+
+// externalSecretPattern matches the name inside an external secret
+// reference: the provider and the provider-specific reference.
+var externalSecretPattern = regexp.MustCompile(`^([a-z][a-z0-9-]*):(.+)$`)
+
+// SecretProvider fetches secrets from an external backend. The reference is
+// everything after "provider:" in the placeholder, including any #key
+// suffix.
+type SecretProvider interface {
+	FetchSecret(ctx context.Context, reference string) (string, error)
+}
+
+var (
+	secretProvidersMu sync.RWMutex
+	secretProviders   = map[string]SecretProvider{
+		"vault":  vaultProvider{},
+		"aws-sm": awsSecretsManagerProvider{},
+	}
+)
+
+// RegisterSecretProvider makes {{name:reference}} resolve through p, for
+// programs embedding api-man. It replaces any provider, built-in or
+// plugin, of the same name.
+func RegisterSecretProvider(name string, p SecretProvider) {
+	secretProvidersMu.Lock()
+	defer secretProvidersMu.Unlock()
+	secretProviders[name] = p
+}
+
+// isExternalSecret reports whether a placeholder name references an external
+// secret.
+func isExternalSecret(name string) bool {
+	return externalSecretPattern.MatchString(name)
+}
+
+// cachedSecret is a fetched value and when it stops being reused.
+type cachedSecret struct {
+	value   string
+	expires time.Time
+}
+
+// externalSecretCache holds fetched values for this process, keyed by
+// workspace and reference, so run-all, suites and load tests don't fetch
+// the same secret for every request. Values are never written to disk.
+// fetching serializes fetches of one reference, so parallel requests wait
+// for the first fetch instead of repeating it.
+var externalSecretCache = struct {
+	sync.Mutex
+	entries  map[string]cachedSecret
+	fetching map[string]*sync.Mutex
+}{entries: make(map[string]cachedSecret), fetching: make(map[string]*sync.Mutex)}
+
+// cachedExternalSecret returns the cached value for key, if still fresh.
+func cachedExternalSecret(key string) (string, bool) {
+	externalSecretCache.Lock()
+	defer externalSecretCache.Unlock()
+	cached, ok := externalSecretCache.entries[key]
+	if !ok || !time.Now().Before(cached.expires) {
+		return "", false
+	}
+	return cached.value, true
+}
+
+// resolveExternalSecret returns the value of an external secret reference
+// such as "vault:secret/data/api#token".
+func (cm *ConfigManager) resolveExternalSecret(name string) (string, error) {
+	match := externalSecretPattern.FindStringSubmatch(name)
+	if match == nil {
+		return "", fmt.Errorf("invalid secret reference %q", name)
+	}
+	providerName, reference := match[1], match[2]
+
+	ttl, err := secretCacheTTL()
+	if err != nil {
+		return "", err
+	}
+	key := cm.configDir + "\x00" + name
+	if value, ok := cachedExternalSecret(key); ok {
+		return value, nil
+	}
+	externalSecretCache.Lock()
+	fetching, ok := externalSecretCache.fetching[key]
+	if !ok {
+		fetching = &sync.Mutex{}
+		externalSecretCache.fetching[key] = fetching
+	}
+	externalSecretCache.Unlock()
+	fetching.Lock()
+	defer fetching.Unlock()
+	if value, ok := cachedExternalSecret(key); ok {
+		return value, nil
+	}
+
+	provider, err := cm.secretProvider(providerName)
+	if err != nil {
+		return "", err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), externalSecretTimeout)
+	defer cancel()
+	value, err := provider.FetchSecret(ctx, reference)
+	if err != nil {
+		return "", err
+	}
+
+	if ttl > 0 {
+		externalSecretCache.Lock()
+		externalSecretCache.entries[key] = cachedSecret{value: value, expires: time.Now().Add(ttl)}
+		externalSecretCache.Unlock()
+	}
+	return value, nil
+}
+
+func secretCacheTTL() (time.Duration, error) {
+	raw := os.Getenv(secretCacheTTLEnv)
+	if raw == "" {
+		return defaultSecretCacheTTL, nil
+	}
+	if raw == "0" {
+		return 0, nil
+	}
+	ttl, err := time.ParseDuration(raw)
+	if err != nil || ttl < 0 {
+		return 0, fmt.Errorf("invalid %s %q (expected a duration such as 10m, or 0)", secretCacheTTLEnv, raw)
+	}
+	return ttl, nil
+}
+
+// secretProvider returns the registered provider for name, or the plugin
+// executable implementing it.
+func (cm *ConfigManager) secretProvider(name string) (SecretProvider, error) {
+	secretProvidersMu.RLock()
+	provider, ok := secretProviders[name]
+	secretProvidersMu.RUnlock()
+	if ok {
+		return provider, nil
+	}
+
+	plugin := secretPluginPrefix + name
+	local := filepath.Join(cm.configDir, "plugins", plugin)
+	if info, err := os.Stat(local); err == nil && !info.IsDir() {
+		return secretPlugin{path: local, provider: name, workspace: cm.configDir}, nil
+	}
+	path, err := exec.LookPath(plugin)
+	if errors.Is(err, exec.ErrNotFound) {
+		return nil, fmt.Errorf("unknown secret provider %q: no %s in plugins/ or on PATH", name, plugin)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return secretPlugin{path: path, provider: name, workspace: cm.configDir}, nil
+}
+
+// secretPlugin runs an api-man-secret-<provider> executable.
+type secretPlugin struct {
+	path      string
+	provider  string
+	workspace string
+}
+
+func (p secretPlugin) FetchSecret(ctx context.Context, reference string) (string, error) {
+	cmd := exec.CommandContext(ctx, p.path, reference)
+	cmd.Dir = p.workspace
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(),
+		"API_MAN_SECRET_PROVIDER="+p.provider,
+		"API_MAN_WORKSPACE="+p.workspace,
+	)
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return "", fmt.Errorf("%s: no reply within %s", filepath.Base(p.path), externalSecretTimeout)
+		}
+		return "", fmt.Errorf("%s: %w", filepath.Base(p.path), err)
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(stdout.String(), "\n"), "\r"), nil
+}
+
+// splitSecretKey splits "path#key" into the path and the key selecting one
+// field of a structured secret.
+func splitSecretKey(reference string) (string, string) {
+	if i := strings.LastIndex(reference, "#"); i >= 0 {
+		return reference[:i], reference[i+1:]
+	}
+	return reference, ""
+}
+
+// structuredSecretField returns the field key of a structured secret, or
+// its only field when key is empty. Non-string values are returned as JSON.
+func structuredSecretField(provider, reference string, fields map[string]interface{}, key string) (string, error) {
+	if key == "" {
+		if len(fields) != 1 {
+			return "", fmt.Errorf("%s: %s has %d fields (%s); pick one with #field", provider, reference, len(fields), strings.Join(sortedKeys(fields), ", "))
+		}
+		for only := range fields {
+			key = only
+		}
+	}
+	value, ok := fields[key]
+	if !ok {
+		return "", fmt.Errorf("%s: %s has no field %q (fields: %s)", provider, reference, key, strings.Join(sortedKeys(fields), ", "))
+	}
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
@@ -0,0 +1,480 @@
+// secrets.go
+package apiman
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/zalando/go-keyring"
+	"golang.org/x/term"
+)
+
+// Secrets are referenced as {{secret.NAME}} anywhere variables are allowed
+// and resolved when a request is executed. They live either in the OS
+// keychain (the default) or, when API_MAN_SECRETS_BACKEND=file or the
+// workspace already has one, in secrets.json with every value encrypted by
+// a passphrase. The encrypted file is safe to commit.
+const (
+	secretsFileName       = "secrets.json"
+	secretsPassphraseEnv  = "API_MAN_SECRETS_PASSPHRASE"
+	secretsBackendEnv     = "API_MAN_SECRETS_BACKEND"
+	secretsKDFIterations  = 600000
+	secretsCheckPlaintext = "api-man"
+)
+
+// ErrSecretNotFound is returned when a secret name has no stored value.
+var ErrSecretNotFound = errors.New("secret not found")
+
+// SecretStore stores named secret values.
+type SecretStore interface {
+	Get(name string) (string, error)
+	Set(name, value string) error
+	Delete(name string) error
+	List() ([]string, error)
+	// Describe names the backend for messages, e.g. "OS keychain".
+	Describe() string
+}
+
+// Secrets returns the workspace's secret store, creating it on first use.
+func (cm *ConfigManager) Secrets() (SecretStore, error) {
+	if cm.secrets != nil {
+		return cm.secrets, nil
+	}
+
+	filePath := filepath.Join(cm.configDir, secretsFileName)
+	backend := os.Getenv(secretsBackendEnv)
+	if backend == "" {
+		backend = "keyring"
+		if fileExists(filePath) {
+			backend = "file"
+		}
+	}
+
+	switch backend {
+	case "keyring":
+		cm.secrets = &keyringSecretStore{
+			service:   "api-man:" + cm.configDir,
+			indexPath: filepath.Join(cm.stateDir(), "secret-names.json"),
+		}
+	case "file":
+		cm.secrets = &fileSecretStore{path: filePath, lock: func() (func(), error) { return cm.lockState("secrets") }}
+	default:
+		return nil, fmt.Errorf("unknown %s %q (use keyring or file)", secretsBackendEnv, backend)
+	}
+	return cm.secrets, nil
+}
+
+// resolveSecrets finds {{secret.NAME}} and external {{provider:reference}}
+// references in the given values (encoded as JSON to reach nested strings)
+// and returns them as variables.
+func (cm *ConfigManager) resolveSecrets(values ...interface{}) (map[string]string, error) {
+	var names, external []string
+	for _, value := range values {
+		text, ok := value.(string)
+		if !ok {
+			data, err := json.Marshal(value)
+			if err != nil {
+				continue
+			}
+			text = string(data)
+		}
+		for _, match := range placeholderPattern.FindAllStringSubmatch(text, -1) {
+			if name, ok := strings.CutPrefix(match[1], "secret."); ok {
+				names = append(names, name)
+			} else if isExternalSecret(match[1]) {
+				external = append(external, match[1])
+			}
+		}
+	}
+	if len(names) == 0 && len(external) == 0 {
+		return nil, nil
+	}
+
+	resolved := make(map[string]string, len(names)+len(external))
+	for _, ref := range external {
+		if _, done := resolved[ref]; done {
+			continue
+		}
+		value, err := cm.resolveExternalSecret(ref)
+		if err != nil {
+			return nil, fmt.Errorf("resolving {{%s}}: %w", ref, err)
+		}
+		resolved[ref] = value
+	}
+	if len(names) == 0 {
+		return resolved, nil
+	}
+
+	store, err := cm.Secrets()
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		if _, done := resolved["secret."+name]; done {
+			continue
+		}
+		value, err := store.Get(name)
+		if err != nil {
+			return nil, fmt.Errorf("resolving {{secret.%s}} from %s: %w", name, store.Describe(), err)
+		}
+		resolved["secret."+name] = value
+	}
+	return resolved, nil
+}
+
+// keyringSecretStore keeps values in the OS keychain. Keychains cannot be
+// enumerated portably, so the names (not the values) are tracked in
+// .api-man/secret-names.json.
+type keyringSecretStore struct {
+	service   string
+	indexPath string
+}
+
+func (s *keyringSecretStore) Describe() string { return "OS keychain" }
+
+func (s *keyringSecretStore) Get(name string) (string, error) {
+	value, err := keyring.Get(s.service, name)
+	if errors.Is(err, keyring.ErrNotFound) {
+		return "", ErrSecretNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("reading keychain (set %s=file to use an encrypted secrets.json instead): %w", secretsBackendEnv, err)
+	}
+	return value, nil
+}
+
+func (s *keyringSecretStore) Set(name, value string) error {
+	if err := keyring.Set(s.service, name, value); err != nil {
+		return fmt.Errorf("writing keychain (set %s=file to use an encrypted secrets.json instead): %w", secretsBackendEnv, err)
+	}
+	names, err := s.List()
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(names, name) {
+		names = append(names, name)
+	}
+	return s.writeIndex(names)
+}
+
+func (s *keyringSecretStore) Delete(name string) error {
+	err := keyring.Delete(s.service, name)
+	if errors.Is(err, keyring.ErrNotFound) {
+		err = ErrSecretNotFound
+	}
+	names, listErr := s.List()
+	if listErr != nil {
+		return listErr
+	}
+	var kept []string
+	for _, n := range names {
+		if n != name {
+			kept = append(kept, n)
+		}
+	}
+	if writeErr := s.writeIndex(kept); writeErr != nil {
+		return writeErr
+	}
+	return err
+}
+
+func (s *keyringSecretStore) List() ([]string, error) {
+	data, err := os.ReadFile(s.indexPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading secret index: %w", err)
+	}
+	var names []string
+	if err := json.Unmarshal(data, &names); err != nil {
+		return nil, fmt.Errorf("parsing secret index: %w", err)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (s *keyringSecretStore) writeIndex(names []string) error {
+	if names == nil {
+		names = []string{}
+	}
+	sort.Strings(names)
+	if err := os.MkdirAll(filepath.Dir(s.indexPath), 0755); err != nil {
+		return fmt.Errorf("creating state directory: %w", err)
+	}
+	return writeJSONFileAtomic(s.indexPath, names, 0644)
+}
+
+// secretsFile is the on-disk form of fileSecretStore. Each value is
+// AES-256-GCM encrypted (nonce prepended) with a key derived from the
+// passphrase; Check lets a wrong passphrase be reported as such. From
+// version 2 each value is bound to its name, passed as additional data, so
+// values can't be swapped between names.
+type secretsFile struct {
+	Version    int               `json:"version,omitempty"`
+	KDF        string            `json:"kdf"`
+	Iterations int               `json:"iterations"`
+	Salt       string            `json:"salt"`
+	Check      string            `json:"check"`
+	Secrets    map[string]string `json:"secrets"`
+}
+
+// secretsFileVersion is the version of the secrets files api-man writes.
+const secretsFileVersion = 2
+
+type fileSecretStore struct {
+	path string
+	// lock serializes changes to the file between processes.
+	lock func() (func(), error)
+	file *secretsFile
+	aead cipher.AEAD
+}
+
+func (s *fileSecretStore) Describe() string { return secretsFileName }
+
+// readSecretsFile reads the secrets file at path, returning nil when there
+// is none yet.
+func readSecretsFile(path string) (*secretsFile, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", secretsFileName, err)
+	}
+	file := &secretsFile{}
+	if err := json.Unmarshal(data, file); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", secretsFileName, err)
+	}
+	if file.Secrets == nil {
+		file.Secrets = make(map[string]string)
+	}
+	return file, nil
+}
+
+// open loads the file (or starts a new one) and derives the key, asking for
+// the passphrase once per process.
+func (s *fileSecretStore) open() error {
+	if s.aead != nil {
+		return nil
+	}
+
+	file, err := readSecretsFile(s.path)
+	if err != nil {
+		return err
+	}
+	if file == nil {
+		salt := make([]byte, 16)
+		if _, err := rand.Read(salt); err != nil {
+			return fmt.Errorf("generating salt: %w", err)
+		}
+		file = &secretsFile{
+			Version:    secretsFileVersion,
+			KDF:        "pbkdf2-sha256",
+			Iterations: secretsKDFIterations,
+			Salt:       base64.StdEncoding.EncodeToString(salt),
+			Secrets:    make(map[string]string),
+		}
+	}
+
+	passphrase, err := secretsPassphrase()
+	if err != nil {
+		return err
+	}
+	salt, err := base64.StdEncoding.DecodeString(file.Salt)
+	if err != nil {
+		return fmt.Errorf("parsing %s salt: %w", secretsFileName, err)
+	}
+	key, err := pbkdf2.Key(sha256.New, passphrase, salt, file.Iterations, 32)
+	if err != nil {
+		return fmt.Errorf("deriving key: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return fmt.Errorf("creating cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return fmt.Errorf("creating cipher: %w", err)
+	}
+	s.file, s.aead = file, aead
+
+	if file.Check == "" {
+		file.Check, err = s.seal("", secretsCheckPlaintext)
+		return err
+	}
+	if check, err := s.unseal("", file.Check); err != nil || check != secretsCheckPlaintext {
+		s.file, s.aead = nil, nil
+		return fmt.Errorf("wrong passphrase for %s", secretsFileName)
+	}
+	return s.upgrade()
+}
+
+// upgrade binds the values of a version 1 file to their names. The file is
+// rewritten with the next change.
+func (s *fileSecretStore) upgrade() error {
+	if s.file.Version >= secretsFileVersion {
+		return nil
+	}
+	for name, sealed := range s.file.Secrets {
+		value, err := s.unsealWith(sealed, nil)
+		if err != nil {
+			return fmt.Errorf("secret %s: %w", name, err)
+		}
+		if s.file.Secrets[name], err = s.seal(name, value); err != nil {
+			return err
+		}
+	}
+	s.file.Version = secretsFileVersion
+	return nil
+}
+
+func (s *fileSecretStore) Get(name string) (string, error) {
+	if err := s.open(); err != nil {
+		return "", err
+	}
+	sealed, ok := s.file.Secrets[name]
+	if !ok {
+		return "", ErrSecretNotFound
+	}
+	return s.unseal(name, sealed)
+}
+
+func (s *fileSecretStore) Set(name, value string) error {
+	return s.update(func(secrets map[string]string) error {
+		sealed, err := s.seal(name, value)
+		if err != nil {
+			return err
+		}
+		secrets[name] = sealed
+		return nil
+	})
+}
+
+func (s *fileSecretStore) Delete(name string) error {
+	return s.update(func(secrets map[string]string) error {
+		if _, ok := secrets[name]; !ok {
+			return ErrSecretNotFound
+		}
+		delete(secrets, name)
+		return nil
+	})
+}
+
+// update applies change to the secrets under the file's lock, reading the
+// file again first so that secrets another process saved meanwhile are
+// kept, and replaces the file atomically.
+func (s *fileSecretStore) update(change func(secrets map[string]string) error) error {
+	if err := s.open(); err != nil {
+		return err
+	}
+	unlock, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	file, err := readSecretsFile(s.path)
+	if err != nil {
+		return err
+	}
+	switch {
+	case file == nil:
+		// Not saved yet: the file opened is new.
+	case file.Salt == s.file.Salt && file.Iterations == s.file.Iterations:
+		s.file = file
+		if err := s.upgrade(); err != nil {
+			return err
+		}
+	default:
+		// The file was replaced with one using another key.
+		s.file, s.aead = nil, nil
+		if err := s.open(); err != nil {
+			return err
+		}
+	}
+	if err := change(s.file.Secrets); err != nil {
+		return err
+	}
+	return writeJSONFileAtomic(s.path, s.file, 0644)
+}
+
+// List reads names straight from the file; they are not encrypted, so no
+// passphrase is needed.
+func (s *fileSecretStore) List() ([]string, error) {
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", secretsFileName, err)
+	}
+	var file secretsFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", secretsFileName, err)
+	}
+	return sortedKeys(file.Secrets), nil
+}
+
+// seal encrypts plaintext, bound to the secret name; the check value is
+// sealed with no name.
+func (s *fileSecretStore) seal(name, plaintext string) (string, error) {
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("generating nonce: %w", err)
+	}
+	sealed := s.aead.Seal(nonce, nonce, []byte(plaintext), []byte(name))
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (s *fileSecretStore) unseal(name, encoded string) (string, error) {
+	return s.unsealWith(encoded, []byte(name))
+}
+
+// unsealWith decrypts encoded with the additional data it was sealed with.
+func (s *fileSecretStore) unsealWith(encoded string, additionalData []byte) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(data) < s.aead.NonceSize() {
+		return "", fmt.Errorf("corrupt secret value")
+	}
+	nonce, ciphertext := data[:s.aead.NonceSize()], data[s.aead.NonceSize():]
+	plaintext, err := s.aead.Open(nil, nonce, ciphertext, additionalData)
+	if err != nil {
+		return "", fmt.Errorf("decrypting secret: %w", err)
+	}
+	return string(plaintext), nil
+}
+
+// secretsPassphrase reads the passphrase from API_MAN_SECRETS_PASSPHRASE or,
+// on a terminal, prompts for it.
+func secretsPassphrase() (string, error) {
+	if passphrase := os.Getenv(secretsPassphraseEnv); passphrase != "" {
+		return passphrase, nil
+	}
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return "", fmt.Errorf("%s is encrypted: set %s", secretsFileName, secretsPassphraseEnv)
+	}
+	fmt.Fprintf(os.Stderr, "Passphrase for %s: ", secretsFileName)
+	passphrase, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("reading passphrase: %w", err)
+	}
+	if len(passphrase) == 0 {
+		return "", fmt.Errorf("empty passphrase")
+	}
+	return string(passphrase), nil
+}
@@ -0,0 +1,127 @@
+package apiman
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newTestFileSecretStore(t *testing.T, cm *ConfigManager) *fileSecretStore {
+	t.Helper()
+	return &fileSecretStore{
+		path: filepath.Join(cm.configDir, secretsFileName),
+		lock: func() (func(), error) { return cm.lockState("secrets") },
+	}
+}
+
+func readTestSecretsFile(t *testing.T, path string) *secretsFile {
+	t.Helper()
+	file, err := readSecretsFile(path)
+	if err != nil || file == nil {
+		t.Fatalf("reading secrets file: %v", err)
+	}
+	return file
+}
+
+func TestFileSecretsAreBoundToTheirNames(t *testing.T) {
+	t.Setenv(secretsPassphraseEnv, "test passphrase")
+	cm, err := InitWorkspace(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := newTestFileSecretStore(t, cm)
+	if err := store.Set("dev_token", "dev-value"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Set("prod_token", "prod-value"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Swapping the ciphertexts doesn't hand one secret out as the other.
+	file := readTestSecretsFile(t, store.path)
+	file.Secrets["dev_token"], file.Secrets["prod_token"] = file.Secrets["prod_token"], file.Secrets["dev_token"]
+	if err := writeJSONFile(store.path, file); err != nil {
+		t.Fatal(err)
+	}
+	if value, err := newTestFileSecretStore(t, cm).Get("dev_token"); err == nil {
+		t.Errorf("swapped secret decrypted as %q", value)
+	}
+}
+
+func TestFileSecretsUpgradeVersion1(t *testing.T) {
+	t.Setenv(secretsPassphraseEnv, "test passphrase")
+	cm, err := InitWorkspace(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := newTestFileSecretStore(t, cm)
+	if err := store.Set("placeholder", "x"); err != nil {
+		t.Fatal(err)
+	}
+	// A version 1 file, whose values were sealed without their name.
+	nonce := make([]byte, store.aead.NonceSize())
+	rand.Read(nonce)
+	file := readTestSecretsFile(t, store.path)
+	file.Version = 0
+	file.Secrets = map[string]string{"old": base64.StdEncoding.EncodeToString(store.aead.Seal(nonce, nonce, []byte("old-value"), nil))}
+	if err := writeJSONFile(store.path, file); err != nil {
+		t.Fatal(err)
+	}
+
+	store = newTestFileSecretStore(t, cm)
+	if value, err := store.Get("old"); err != nil || value != "old-value" {
+		t.Fatalf("version 1 secret read as %q, %v", value, err)
+	}
+	if err := store.Set("new", "new-value"); err != nil {
+		t.Fatal(err)
+	}
+	if file := readTestSecretsFile(t, store.path); file.Version != secretsFileVersion {
+		t.Errorf("file saved as version %d", file.Version)
+	}
+	if value, err := newTestFileSecretStore(t, cm).Get("old"); err != nil || value != "old-value" {
+		t.Errorf("upgraded secret read as %q, %v", value, err)
+	}
+}
+
+func TestFileSecretsKeepConcurrentChanges(t *testing.T) {
+	t.Setenv(secretsPassphraseEnv, "test passphrase")
+	cm, err := InitWorkspace(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := newTestFileSecretStore(t, cm)
+	if err := first.Set("a", "1"); err != nil {
+		t.Fatal(err)
+	}
+	// Both stores have read the file before either changes it.
+	second := newTestFileSecretStore(t, cm)
+	if _, err := second.Get("a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := first.Set("b", "2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := second.Set("c", "3"); err != nil {
+		t.Fatal(err)
+	}
+	if err := second.Delete("a"); err != nil {
+		t.Fatal(err)
+	}
+
+	names, err := newTestFileSecretStore(t, cm).List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(names, ","); got != "b,c" {
+		t.Errorf("secrets %s, want b,c", got)
+	}
+	entries, _ := os.ReadDir(cm.configDir)
+	for _, entry := range entries {
+		if filepath.Ext(entry.Name()) == ".tmp" {
+			t.Errorf("temporary file %s left behind", entry.Name())
+		}
+	}
+}
@@ -0,0 +1,186 @@
+// snippets.go
+package apiman
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// codeLanguages are the languages api-man export code writes snippets in.
+var codeLanguages = []string{"go", "python", "js", "java"}
+
+// ExportCode renders a stored request, resolved against envName, as a
+// ready-to-run snippet in lang: Go with net/http, Python with requests,
+// JavaScript with fetch or Java with java.net.http. Like ExportCurl the
+// snippet carries the resolved URL, headers (auth included) and body, but not
+// the environment's TLS or proxy settings.
+func (cm *ConfigManager) ExportCode(requestPath, envName, lang string) (string, error) {
+	prepared, err := cm.PrepareRequest(requestPath, envName, RequestOptions{})
+	if err != nil {
+		return "", err
+	}
+	if prepared.Config.GRPC != nil {
+		return "", errGRPCRequest(requestPath)
+	}
+	if prepared.Config.WebSocket != nil {
+		return "", errWebSocketRequest(requestPath)
+	}
+	body, err := readRequestBody(prepared.Request)
+	if err != nil {
+		return "", err
+	}
+	return buildCodeSnippet(prepared.Request, body, lang)
+}
+
+// snippetHeader is one request header, repeated values joined.
+type snippetHeader struct {
+	Name, Value string
+}
+
+// snippetHeaders returns the headers a snippet sets, sorted. Headers the
+// HTTP client computes itself are left out; Java's client refuses them.
+func snippetHeaders(req *http.Request) []snippetHeader {
+	var headers []snippetHeader
+	for name, values := range req.Header {
+		switch name {
+		case "Host", "Content-Length", "Connection", "Expect", "Upgrade":
+			continue
+		}
+		headers = append(headers, snippetHeader{name, strings.Join(values, ", ")})
+	}
+	sort.Slice(headers, func(i, j int) bool { return headers[i].Name < headers[j].Name })
+	return headers
+}
+
+func buildCodeSnippet(req *http.Request, body, lang string) (string, error) {
+	headers := snippetHeaders(req)
+	url := req.URL.String()
+	switch lang {
+	case "go":
+		return goSnippet(req.Method, url, headers, body), nil
+	case "python":
+		return pythonSnippet(req.Method, url, headers, body), nil
+	case "js", "javascript":
+		return jsSnippet(req.Method, url, headers, body), nil
+	case "java":
+		return javaSnippet(req.Method, url, headers, body), nil
+	default:
+		return "", fmt.Errorf("unknown language %q (expected one of %s)", lang, strings.Join(codeLanguages, ", "))
+	}
+}
+
+// quoteLiteral quotes s as a JSON string, which is also a valid string
+// literal in Python, JavaScript and Java.
+func quoteLiteral(s string) string {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+func goSnippet(method, url string, headers []snippetHeader, body string) string {
+	var b strings.Builder
+	b.WriteString("package main\n\nimport (\n\t\"fmt\"\n\t\"io\"\n\t\"net/http\"\n")
+	if body != "" {
+		b.WriteString("\t\"strings\"\n")
+	}
+	b.WriteString(")\n\nfunc main() {\n")
+	reqBody := "nil"
+	if body != "" {
+		fmt.Fprintf(&b, "\tbody := strings.NewReader(%s)\n", strconv.Quote(body))
+		reqBody = "body"
+	}
+	fmt.Fprintf(&b, "\treq, err := http.NewRequest(%s, %s, %s)\n", strconv.Quote(method), strconv.Quote(url), reqBody)
+	b.WriteString("\tif err != nil {\n\t\tpanic(err)\n\t}\n")
+	for _, h := range headers {
+		fmt.Fprintf(&b, "\treq.Header.Set(%s, %s)\n", strconv.Quote(h.Name), strconv.Quote(h.Value))
+	}
+	b.WriteString(`
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		panic(err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(resp.Status)
+	fmt.Println(string(data))
+}
+`)
+	return b.String()
+}
+
+func pythonSnippet(method, url string, headers []snippetHeader, body string) string {
+	var b strings.Builder
+	b.WriteString("import requests\n\nresponse = requests.request(\n")
+	fmt.Fprintf(&b, "    %s,\n    %s,\n", quoteLiteral(method), quoteLiteral(url))
+	if len(headers) > 0 {
+		b.WriteString("    headers={\n")
+		for _, h := range headers {
+			fmt.Fprintf(&b, "        %s: %s,\n", quoteLiteral(h.Name), quoteLiteral(h.Value))
+		}
+		b.WriteString("    },\n")
+	}
+	if body != "" {
+		fmt.Fprintf(&b, "    data=%s,\n", quoteLiteral(body))
+	}
+	b.WriteString(")\nprint(response.status_code)\nprint(response.text)\n")
+	return b.String()
+}
+
+func jsSnippet(method, url string, headers []snippetHeader, body string) string {
+	var b strings.Builder
+	b.WriteString("// Node.js 18+ (as an ES module) or a browser\n")
+	fmt.Fprintf(&b, "const response = await fetch(%s, {\n  method: %s,\n", quoteLiteral(url), quoteLiteral(method))
+	if len(headers) > 0 {
+		b.WriteString("  headers: {\n")
+		for _, h := range headers {
+			fmt.Fprintf(&b, "    %s: %s,\n", quoteLiteral(h.Name), quoteLiteral(h.Value))
+		}
+		b.WriteString("  },\n")
+	}
+	if body != "" {
+		fmt.Fprintf(&b, "  body: %s,\n", quoteLiteral(body))
+	}
+	b.WriteString("});\nconsole.log(response.status);\nconsole.log(await response.text());\n")
+	return b.String()
+}
+
+func javaSnippet(method, url string, headers []snippetHeader, body string) string {
+	var b strings.Builder
+	b.WriteString(`import java.net.URI;
+import java.net.http.HttpClient;
+import java.net.http.HttpRequest;
+import java.net.http.HttpResponse;
+
+public class Main {
+    public static void main(String[] args) throws Exception {
+        HttpRequest request = HttpRequest.newBuilder()
+`)
+	fmt.Fprintf(&b, "                .uri(URI.create(%s))\n", quoteLiteral(url))
+	for _, h := range headers {
+		fmt.Fprintf(&b, "                .header(%s, %s)\n", quoteLiteral(h.Name), quoteLiteral(h.Value))
+	}
+	publisher := "HttpRequest.BodyPublishers.noBody()"
+	if body != "" {
+		publisher = "HttpRequest.BodyPublishers.ofString(" + quoteLiteral(body) + ")"
+	}
+	fmt.Fprintf(&b, "                .method(%s, %s)\n", quoteLiteral(method), publisher)
+	b.WriteString(`                .build();
+        HttpResponse<String> response = HttpClient.newHttpClient()
+                .send(request, HttpResponse.BodyHandlers.ofString());
+        System.out.println(response.statusCode());
+        System.out.println(response.body());
+    }
+}
+`)
+	return b.String()
+}
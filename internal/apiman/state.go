@@ -0,0 +1,97 @@
+// state.go
+package apiman
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Several api-man processes may share a workspace's state directory at once:
+// a watch session next to manual runs, or parallel CI jobs. Files there are
+// written whole to a temporary file and renamed into place, so a reader
+// never sees half a file, and read-modify-write updates hold a lock file in
+// .api-man/locks/ so they don't lose each other's changes.
+
+const (
+	// stateLockTimeout is how long to wait for another process to release
+	// a lock before giving up.
+	stateLockTimeout = 10 * time.Second
+	// staleLockAge is when a lock is taken to be left behind by a process
+	// that died holding it: locks are only held for a file write or two.
+	staleLockAge = 30 * time.Second
+)
+
+// tempFileMarker is part of the name of every temporary file writeFileAtomic
+// creates; ones a crash left behind are removed by api-man doctor --fix.
+const tempFileMarker = ".tmp-"
+
+func (cm *ConfigManager) locksDir() string {
+	return filepath.Join(cm.stateDir(), "locks")
+}
+
+// lockState takes the workspace lock name, waiting while another process
+// holds it, and returns the function releasing it.
+func (cm *ConfigManager) lockState(name string) (func(), error) {
+	if err := os.MkdirAll(cm.locksDir(), 0755); err != nil {
+		return nil, fmt.Errorf("creating locks directory: %w", err)
+	}
+	path := filepath.Join(cm.locksDir(), sanitizeRequestPathSegment(name)+".lock")
+	deadline := time.Now().Add(stateLockTimeout)
+	for {
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			file.WriteString(strconv.Itoa(os.Getpid()))
+			file.Close()
+			return func() { os.Remove(path) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("taking lock %s: %w", name, err)
+		}
+		if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > staleLockAge {
+			os.Remove(path)
+			continue
+		}
+		if time.Now().After(deadline) {
+			holder, _ := os.ReadFile(path)
+			return nil, fmt.Errorf("timed out waiting for lock %s held by process %s (remove %s if that process is gone)", name, strings.TrimSpace(string(holder)), path)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// writeFileAtomic writes data to path through a temporary file in the same
+// directory, so path holds either its old content or all of data, never
+// part of it.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	file, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+tempFileMarker+"*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Chmod(perm)
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
+
+// writeJSONFileAtomic is writeJSONFile through writeFileAtomic, for state
+// files other processes may be reading.
+func writeJSONFileAtomic(path string, v interface{}, perm os.FileMode) error {
+	data, err := encodeConfig(path, v)
+	if err != nil {
+		return fmt.Errorf("marshaling %s: %w", filepath.Base(path), err)
+	}
+	return writeFileAtomic(path, data, perm)
+}
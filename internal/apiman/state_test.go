@@ -0,0 +1,72 @@
+package apiman
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLockStateExcludesAndBreaksStaleLocks(t *testing.T) {
+	cm, err := InitWorkspace(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	unlock, err := cm.lockState("history")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	taken := make(chan struct{})
+	go func() {
+		unlock, err := cm.lockState("history")
+		if err != nil {
+			t.Error(err)
+		} else {
+			unlock()
+		}
+		close(taken)
+	}()
+	select {
+	case <-taken:
+		t.Fatal("lock taken twice")
+	case <-time.After(100 * time.Millisecond):
+	}
+	unlock()
+	<-taken
+
+	// A lock left by a process that died is taken over once it is stale.
+	path := filepath.Join(cm.locksDir(), "history.lock")
+	if err := os.WriteFile(path, []byte("1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-2 * staleLockAge)
+	if err := os.Chtimes(path, old, old); err != nil {
+		t.Fatal(err)
+	}
+	unlock, err = cm.lockState("history")
+	if err != nil {
+		t.Fatalf("stale lock not broken: %v", err)
+	}
+	unlock()
+	if fileExists(path) {
+		t.Error("lock file left behind")
+	}
+}
+
+func TestWriteFileAtomicReplacesContent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	for _, content := range []string{"first", "second"} {
+		if err := writeFileAtomic(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil || string(data) != content {
+			t.Errorf("got %q, %v; want %q", data, err, content)
+		}
+	}
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 {
+		t.Errorf("temporary files left behind: %d entries", len(entries))
+	}
+}
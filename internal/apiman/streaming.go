@@ -0,0 +1,204 @@
+// streaming.go
+package apiman
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"strings"
+	"time"
+)
+
+// StreamRequest sends a request and writes the response to out as it
+// arrives instead of buffering it: Server-Sent Events are printed one event
+// at a time, NDJSON one pretty-printed line at a time, and anything else as
+// raw chunks. Each is prefixed with the time since the request was sent.
+// WebSocket requests print each message sent and received.
+// Cancelling ctx (e.g. on Ctrl+C) closes the connection and is not an
+// error; the returned result holds everything received until then.
+func (cm *ConfigManager) StreamRequest(ctx context.Context, requestPath, envName string, opts RequestOptions, out io.Writer) (*ExecutionResult, error) {
+	prepared, err := cm.PrepareRequest(requestPath, envName, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := cm.confirmPrepared(prepared, opts.Confirmed); err != nil {
+		return nil, err
+	}
+	if prepared.Config.GRPC != nil {
+		return nil, errGRPCRequest(requestPath)
+	}
+	if prepared.Config.WebSocket != nil {
+		return cm.runWebSocket(ctx, prepared, out)
+	}
+
+	req := prepared.Request.WithContext(ctx)
+	// Streams are open-ended, so only the context bounds the request.
+	client := prepared.Client()
+	client.Timeout = 0
+
+	startedAt := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	fmt.Fprintf(out, "Status: %s\n", resp.Status)
+	fmt.Fprintf(out, "Headers:\n")
+	for _, key := range sortedKeys(resp.Header) {
+		for _, value := range resp.Header[key] {
+			fmt.Fprintf(out, "  %s: %s\n", key, value)
+		}
+	}
+	fmt.Fprintln(out)
+
+	wire := &countingReader{r: resp.Body}
+	var decoded io.Reader = wire
+	encoding := resp.Header.Get("Content-Encoding")
+	if isEncoded(encoding) {
+		if decoded, err = decodingReader(encoding, wire); err != nil {
+			return nil, err
+		}
+	}
+	var received bytes.Buffer
+	body := io.TeeReader(decoded, &received)
+	elapsed := func() string {
+		return fmt.Sprintf("[+%.3fs]", time.Since(startedAt).Seconds())
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	switch mediaType {
+	case "text/event-stream":
+		err = streamSSE(body, out, elapsed)
+	case "application/x-ndjson", "application/jsonl", "application/jsonlines", "application/x-jsonlines":
+		err = streamNDJSON(body, out, elapsed)
+	default:
+		err = streamChunks(body, out, elapsed)
+	}
+	duration := time.Since(startedAt)
+	if ctx.Err() != nil {
+		fmt.Fprintf(out, "%s connection closed\n", elapsed())
+	} else if err != nil {
+		return nil, fmt.Errorf("reading response stream: %w", err)
+	} else {
+		fmt.Fprintf(out, "%s stream ended\n", elapsed())
+	}
+
+	result := &ExecutionResult{
+		Request:     requestPath,
+		Environment: envName,
+		Method:      req.Method,
+		URL:         req.URL.String(),
+		Status:      resp.Status,
+		StatusCode:  resp.StatusCode,
+		Headers:     resp.Header,
+		Body:        received.Bytes(),
+		Duration:    duration,
+		StartedAt:   startedAt,
+	}
+	if isEncoded(encoding) {
+		result.ContentEncoding = encoding
+		result.EncodedSize = wire.n
+	}
+	return cm.finishExecution(prepared, result, req.Header)
+}
+
+// sseEvent is one dispatched Server-Sent Event.
+type sseEvent struct {
+	event string
+	id    string
+	data  []string
+}
+
+// streamSSE parses an event stream as described in the HTML spec: fields
+// accumulate until a blank line dispatches the event.
+func streamSSE(r io.Reader, out io.Writer, elapsed func() string) error {
+	scanner := newLineScanner(r)
+	var ev sseEvent
+	dispatch := func() {
+		if len(ev.data) == 0 && ev.event == "" {
+			return
+		}
+		name := ev.event
+		if name == "" {
+			name = "message"
+		}
+		label := "event: " + name
+		if ev.id != "" {
+			label += "  id: " + ev.id
+		}
+		fmt.Fprintf(out, "%s %s\n", elapsed(), label)
+		fmt.Fprintln(out, indentLines(prettyBody([]byte(strings.Join(ev.data, "\n")), ""), "  "))
+		ev = sseEvent{}
+	}
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			dispatch()
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			continue // comment / keep-alive
+		}
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "event":
+			ev.event = value
+		case "data":
+			ev.data = append(ev.data, value)
+		case "id":
+			ev.id = value
+		}
+	}
+	dispatch()
+	return scanner.Err()
+}
+
+// streamNDJSON prints each line of a newline-delimited JSON stream as it
+// arrives.
+func streamNDJSON(r io.Reader, out io.Writer, elapsed func() string) error {
+	scanner := newLineScanner(r)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		fmt.Fprintf(out, "%s\n%s\n", elapsed(), indentLines(prettyBody(line, ""), "  "))
+	}
+	return scanner.Err()
+}
+
+// streamChunks prints whatever each read returns.
+func streamChunks(r io.Reader, out io.Writer, elapsed func() string) error {
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			fmt.Fprintf(out, "%s %d bytes\n%s\n", elapsed(), n, strings.TrimRight(string(buf[:n]), "\n"))
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// newLineScanner returns a line scanner that accepts lines up to 1 MiB,
+// since single events (e.g. LLM completions) can be large.
+func newLineScanner(r io.Reader) *bufio.Scanner {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	return scanner
+}
+
+func indentLines(s, prefix string) string {
+	return prefix + strings.ReplaceAll(s, "\n", "\n"+prefix)
+}
@@ -0,0 +1,186 @@
+// suite.go
+package apiman
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+)
+
+// Suite is a named set of requests run together, e.g. to smoke-test a
+// deployment. Suites live at suites/<name>.json in the workspace:
+//
+//	{
+//	  "description": "Post-deploy smoke test",
+//	  "parallel": 4,
+//	  "variables": {"userId": "1"},
+//	  "requests": [
+//	    {"request": "health"},
+//	    {"request": "users/get-user", "variables": {"userId": "2"}},
+//	    {"request": "billing", "environment": "billing-dev"}
+//	  ]
+//	}
+//
+// An entry naming a directory runs every request beneath it. Requests with
+// assertions pass when they hold; requests without pass unless they get a
+// 4xx/5xx response. Unlike chains, entries are independent: nothing is
+// extracted or passed between them.
+type Suite struct {
+	Name        string            `json:"-"`
+	Description string            `json:"description,omitempty"`
+	Variables   map[string]string `json:"variables,omitempty"`
+	// Parallel is how many requests run at once; 0 or 1 runs them in order.
+	Parallel int `json:"parallel,omitempty"`
+	// EnforceBudgets fails requests that take longer than their
+	// latencyBudgetMs.
+	EnforceBudgets bool         `json:"enforceBudgets,omitempty"`
+	Requests       []SuiteEntry `json:"requests"`
+}
+
+type SuiteEntry struct {
+	Request string `json:"request"`
+	// Environment replaces the environment the suite is run against.
+	Environment string `json:"environment,omitempty"`
+	// Variables are layered over the suite's variables.
+	Variables map[string]string `json:"variables,omitempty"`
+}
+
+func (cm *ConfigManager) suitesDir() string {
+	return filepath.Join(cm.configDir, "suites")
+}
+
+// ListSuites returns the names of every suite file in suites/.
+func (cm *ConfigManager) ListSuites() ([]string, error) {
+	entries, err := os.ReadDir(cm.suitesDir())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("reading suites directory: %w", err)
+	}
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".json") {
+			names = append(names, strings.TrimSuffix(entry.Name(), ".json"))
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// LoadSuite reads suites/<name>.json.
+func (cm *ConfigManager) LoadSuite(name string) (*Suite, error) {
+	data, err := os.ReadFile(filepath.Join(cm.suitesDir(), name+".json"))
+	if err != nil {
+		return nil, fmt.Errorf("reading suite file: %w", err)
+	}
+	var suite Suite
+	if err := json.Unmarshal(data, &suite); err != nil {
+		return nil, fmt.Errorf("parsing suite file: %w", err)
+	}
+	if len(suite.Requests) == 0 {
+		return nil, fmt.Errorf("suite %q has no requests", name)
+	}
+	for i, entry := range suite.Requests {
+		if entry.Request == "" {
+			return nil, fmt.Errorf("suite %q: entry %d is missing request", name, i+1)
+		}
+	}
+	suite.Name = name
+	return &suite, nil
+}
+
+// suiteRun is one request execution planned from a suite entry.
+type suiteRun struct {
+	path string
+	env  string
+	vars map[string]string
+}
+
+// RunSuite executes every request in suite against envName, printing each
+// result as it completes and a summary table at the end. Results are
+// reported in suite order regardless of Parallel.
+func (cm *ConfigManager) RunSuite(suite *Suite, envName string, out io.Writer) (*TestReport, error) {
+	var runs []suiteRun
+	for _, entry := range suite.Requests {
+		paths, err := cm.ResolveRequestTargets(entry.Request)
+		if err != nil {
+			return nil, err
+		}
+		env := envName
+		if entry.Environment != "" {
+			env = entry.Environment
+		}
+		vars := mergeVariables(suite.Variables, entry.Variables)
+		for _, path := range paths {
+			runs = append(runs, suiteRun{path: path, env: env, vars: vars})
+		}
+	}
+
+	results := make([]TestResult, len(runs))
+	workers := min(max(suite.Parallel, 1), len(runs))
+	jobs := make(chan int)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				run := runs[i]
+				result := cm.runTest(run.path, run.env, RequestOptions{Variables: run.vars}, false)
+				result.Environment = run.env
+				if suite.EnforceBudgets && result.OverBudget && result.Passed {
+					result.Passed = false
+					result.Error = fmt.Sprintf("took %dms, over the %dms budget", result.DurationMS, result.BudgetMS)
+				}
+				results[i] = result
+
+				mu.Lock()
+				printTestResult(out, result)
+				mu.Unlock()
+			}
+		}()
+	}
+	for i := range runs {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	report := &TestReport{Name: suite.Name, Environment: envName}
+	for _, result := range results {
+		report.add(result)
+	}
+	fmt.Fprintln(out)
+	printSuiteSummary(out, report)
+	return report, nil
+}
+
+func printSuiteSummary(out io.Writer, report *TestReport) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "REQUEST\tENV\tSTATUS\tTIME\tRESULT")
+	for _, result := range report.Results {
+		status := "-"
+		if result.StatusCode != 0 {
+			status = fmt.Sprint(result.StatusCode)
+		}
+		outcome := "pass"
+		if !result.Passed {
+			outcome = "FAIL"
+		}
+		duration := fmt.Sprintf("%dms", result.DurationMS)
+		if result.OverBudget {
+			duration += fmt.Sprintf(" (budget %dms)", result.BudgetMS)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", result.Request, result.Environment, status, duration, outcome)
+	}
+	w.Flush()
+	fmt.Fprintf(out, "\n%d passed, %d failed\n", report.Passed, report.Failed)
+}
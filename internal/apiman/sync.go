@@ -0,0 +1,392 @@
+// sync.go
+package apiman
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// secretKeyMarkers are the parts of a header, cookie or variable name that
+// mark its value as a secret for api-man sync, compared case-insensitively
+// with - and _ removed. api-man.json can add more with "secretKeys".
+var secretKeyMarkers = []string{"password", "passwd", "secret", "token", "apikey", "authorization", "credential", "privatekey"}
+
+// authSecretFields are the auth settings holding credentials.
+var authSecretFields = []string{"password", "token", "clientSecret", "secret", "key"}
+
+// authSchemePattern matches the scheme an Authorization value starts with,
+// which sync leaves in place: "Bearer {{secret.NAME}}".
+var authSchemePattern = regexp.MustCompile(`^(?i)(bearer|basic|token|digest) +`)
+
+var secretNameInvalid = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// SyncOptions configure SyncWorkspace.
+type SyncOptions struct {
+	// Check reports what would change without writing anything.
+	Check bool
+}
+
+// SyncReport lists what SyncWorkspace changed, or would change with Check.
+type SyncReport struct {
+	// Formatted are the files rewritten in the canonical format.
+	Formatted []string `json:"formatted,omitempty"`
+	// Secrets are the values moved to the secret store, as
+	// "<file>: <field> -> {{secret.NAME}}".
+	Secrets []string `json:"secrets,omitempty"`
+	// Invalid are the files that failed to parse or validate, with the
+	// problem; they are left alone.
+	Invalid []string `json:"invalid,omitempty"`
+}
+
+// Clean reports whether the workspace was already in sync and valid.
+func (r *SyncReport) Clean() bool {
+	return len(r.Formatted) == 0 && len(r.Secrets) == 0 && len(r.Invalid) == 0
+}
+
+// SyncWorkspace prepares the workspace for version control. Every request,
+// environment and collection environments file is validated and rewritten
+// in the format api-man itself writes (fields in a fixed order, two-space
+// indentation, a trailing newline), so edits from the web UI, the TUI and
+// editors produce the same bytes. Values of headers, cookies, variables and
+// auth settings that are secrets (see secretKeyMarkers) are moved to the
+// secret store and replaced by {{secret.NAME}} references. Body templates
+// are sent as written and left alone.
+func (cm *ConfigManager) SyncWorkspace(opts SyncOptions) (*SyncReport, error) {
+	report := &SyncReport{}
+	markers, err := cm.secretMarkers()
+	if err != nil {
+		return nil, err
+	}
+	var store SecretStore
+	secretStore := func() (SecretStore, error) {
+		if store == nil {
+			s, err := cm.Secrets()
+			if err != nil {
+				return nil, err
+			}
+			store = s
+		}
+		return store, nil
+	}
+
+	files, err := cm.workspaceFiles()
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		rel := cm.relativePath(file.path)
+		data, value, err := file.read(rel)
+		if err != nil {
+			report.Invalid = append(report.Invalid, fmt.Sprintf("%s: %v", rel, err))
+			continue
+		}
+
+		for _, field := range file.kind.secretFields(value, markers) {
+			name := file.secretName(field.label)
+			reference := "{{secret." + name + "}}"
+			value := field.values[field.key]
+			prefix := authSchemePattern.FindString(value)
+			secret := strings.TrimPrefix(value, prefix)
+			if !opts.Check {
+				s, err := secretStore()
+				if err != nil {
+					return nil, err
+				}
+				if name, err = freeSecretName(s, name, secret); err != nil {
+					return nil, err
+				}
+				reference = "{{secret." + name + "}}"
+				if err := s.Set(name, secret); err != nil {
+					return nil, fmt.Errorf("storing secret %s: %w", name, err)
+				}
+			}
+			field.values[field.key] = prefix + reference
+			report.Secrets = append(report.Secrets, fmt.Sprintf("%s: %s -> %s", rel, field.label, reference))
+		}
+
+		canonical, err := encodeConfig(file.path, value)
+		if err != nil {
+			return nil, fmt.Errorf("encoding %s: %w", rel, err)
+		}
+		if bytes.Equal(canonical, data) {
+			continue
+		}
+		report.Formatted = append(report.Formatted, rel)
+		if opts.Check {
+			continue
+		}
+		if err := os.WriteFile(file.path, canonical, 0644); err != nil {
+			return nil, fmt.Errorf("writing %s: %w", rel, err)
+		}
+	}
+	return report, nil
+}
+
+// secretMarkers returns secretKeyMarkers plus the workspace's secretKeys,
+// normalized for matching.
+func (cm *ConfigManager) secretMarkers() ([]string, error) {
+	markers := slices.Clone(secretKeyMarkers)
+	config, err := cm.workspaceConfig()
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range config.SecretKeys {
+		markers = append(markers, normalizeSecretKey(key))
+	}
+	return markers, nil
+}
+
+func normalizeSecretKey(key string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", "_", "").Replace(key))
+}
+
+// isSecretKey reports whether a value named key should be a secret.
+func isSecretKey(key string, markers []string) bool {
+	key = normalizeSecretKey(key)
+	for _, marker := range markers {
+		if marker != "" && strings.Contains(key, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// needsScrubbing reports whether value is a literal secret rather than
+// empty or already built from placeholders.
+func needsScrubbing(value string) bool {
+	return strings.TrimSpace(value) != "" && !strings.Contains(value, "{{")
+}
+
+// freeSecretName returns name, or name with a numeric suffix when the store
+// already holds a different value under it.
+func freeSecretName(store SecretStore, name, value string) (string, error) {
+	candidate := name
+	for i := 2; ; i++ {
+		existing, err := store.Get(candidate)
+		if errors.Is(err, ErrSecretNotFound) || (err == nil && existing == value) {
+			return candidate, nil
+		}
+		if err != nil {
+			return "", fmt.Errorf("reading secret %s: %w", candidate, err)
+		}
+		candidate = fmt.Sprintf("%s-%d", name, i)
+	}
+}
+
+// workspaceFile is a request, environment or workspace config file, as
+// checked by api-man sync and api-man lint.
+type workspaceFile struct {
+	path string
+	kind configKind
+	// name is the request path, environment name or collection.
+	name string
+	// scope names the request or environment in generated secret names.
+	scope string
+}
+
+// read returns the file's content and its strictly decoded value; see
+// configKind.decode.
+func (f workspaceFile) read(rel string) ([]byte, interface{}, error) {
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return nil, nil, err
+	}
+	jsonData := data
+	if isYAMLFile(f.path) {
+		if jsonData, err = yamlToJSON(data); err != nil {
+			return data, nil, err
+		}
+	}
+	value, err := f.kind.decode(jsonData, rel)
+	return data, value, err
+}
+
+func (f workspaceFile) secretName(label string) string {
+	name := f.scope + "." + label
+	return strings.Trim(secretNameInvalid.ReplaceAllString(name, "-"), "-.")
+}
+
+// secretField is a value sync moves to the secret store.
+type secretField struct {
+	label  string
+	values map[string]string
+	key    string
+}
+
+type configKind int
+
+const (
+	configRequest configKind = iota
+	configEnvironment
+	configCollectionEnvironments
+	configWorkspace
+	configDefaults
+)
+
+// decode parses a file of this kind strictly: unknown fields and newer
+// schema versions are errors, since rewriting would drop or corrupt them.
+func (k configKind) decode(data []byte, rel string) (interface{}, error) {
+	var value interface{}
+	switch k {
+	case configRequest:
+		value = &RequestConfig{}
+	case configEnvironment:
+		value = &Environment{}
+	case configCollectionEnvironments:
+		value = &CollectionEnvironments{}
+	case configWorkspace:
+		value = &WorkspaceConfig{}
+	case configDefaults:
+		value = &RequestDefaults{}
+	}
+	if err := decodeStrict(data, value); err != nil {
+		if k == configRequest && decodeStrict(data, &LegacyRequestConfig{}) == nil {
+			return nil, fmt.Errorf("written by an older api-man (run api-man migrate): %w", err)
+		}
+		return nil, err
+	}
+
+	switch v := value.(type) {
+	case *RequestConfig:
+		if err := checkSchemaVersion(rel, v.SchemaVersion); err != nil {
+			return nil, err
+		}
+		if v.GRPC == nil && strings.TrimSpace(v.URL) == "" {
+			return nil, fmt.Errorf("url is empty")
+		}
+	case *Environment:
+		if err := checkSchemaVersion(rel, v.SchemaVersion); err != nil {
+			return nil, err
+		}
+	case *CollectionEnvironments:
+		if err := checkSchemaVersion(rel, v.SchemaVersion); err != nil {
+			return nil, err
+		}
+	}
+	return value, nil
+}
+
+func decodeStrict(data []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(v)
+}
+
+// secretFields returns the literal secret values in a decoded file.
+func (k configKind) secretFields(value interface{}, markers []string) []secretField {
+	var fields []secretField
+	collect := func(group string, values map[string]string, secret func(string) bool) {
+		for _, key := range sortedKeys(values) {
+			if secret(key) && needsScrubbing(values[key]) {
+				fields = append(fields, secretField{label: group + "." + key, values: values, key: key})
+			}
+		}
+	}
+	isMarked := func(key string) bool { return isSecretKey(key, markers) }
+	isAuthSecret := func(key string) bool { return slices.Contains(authSecretFields, key) }
+
+	switch v := value.(type) {
+	case *RequestConfig:
+		collect("headers", v.Headers, isMarked)
+		collect("cookies", v.Cookies, isMarked)
+		for _, name := range sortedKeys(v.EnvOverrides) {
+			if override := v.EnvOverrides[name]; override != nil {
+				collect("envOverrides."+name+".headers", override.Headers, isMarked)
+				collect("envOverrides."+name+".cookies", override.Cookies, isMarked)
+			}
+		}
+	case *Environment:
+		collect("headers", v.Headers, isMarked)
+		collect("cookies", v.Cookies, isMarked)
+		collect("auth", v.Auth, isAuthSecret)
+		collect("variables", v.Variables, isMarked)
+		if v.Tracing != nil {
+			collect("tracing.headers", v.Tracing.Headers, isMarked)
+		}
+	case *RequestDefaults:
+		collect("headers", v.Headers, isMarked)
+	case *CollectionEnvironments:
+		for _, name := range sortedKeys(v.Environments) {
+			env := v.Environments[name]
+			for _, field := range configEnvironment.secretFields(&env, markers) {
+				field.label = name + "." + field.label
+				fields = append(fields, field)
+			}
+		}
+	}
+	return fields
+}
+
+// workspaceFiles returns every request, every environment, each collection's
+// environments.json, every _defaults.json and api-man.json.
+func (cm *ConfigManager) workspaceFiles() ([]workspaceFile, error) {
+	var files []workspaceFile
+	paths, err := cm.RequestPaths()
+	if err != nil {
+		return nil, fmt.Errorf("listing requests: %w", err)
+	}
+	// A request stored both as .json and .yaml is listed twice.
+	for _, p := range slices.Compact(paths) {
+		if file, ok := cm.requestFile(p); ok {
+			files = append(files, workspaceFile{path: file, kind: configRequest, name: p, scope: strings.ReplaceAll(p, "/", ".")})
+		}
+	}
+
+	var collectionFiles, defaultsFiles []workspaceFile
+	if root := filepath.Join(cm.configDir, defaultsFileName); fileExists(root) {
+		defaultsFiles = append(defaultsFiles, workspaceFile{path: root, kind: configDefaults, scope: "defaults"})
+	}
+	err = filepath.WalkDir(cm.requestsDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || (d.Name() != "environments.json" && d.Name() != defaultsFileName) {
+			return nil
+		}
+		rel, err := filepath.Rel(cm.requestsDir, filepath.Dir(path))
+		if err != nil {
+			return err
+		}
+		dir := filepath.ToSlash(rel)
+		if d.Name() == defaultsFileName {
+			scope := "defaults"
+			if dir != "." {
+				scope += "." + strings.ReplaceAll(dir, "/", ".")
+			}
+			defaultsFiles = append(defaultsFiles, workspaceFile{path: path, kind: configDefaults, name: dir, scope: scope})
+			return nil
+		}
+		collectionFiles = append(collectionFiles, workspaceFile{path: path, kind: configCollectionEnvironments, name: dir, scope: strings.ReplaceAll(dir, "/", ".")})
+		return nil
+	})
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("listing collection environments: %w", err)
+	}
+	files = append(files, collectionFiles...)
+	files = append(files, defaultsFiles...)
+
+	envs, err := cm.ListEnvironments()
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(envs)
+	for _, name := range envs {
+		if file, ok := cm.environmentFile(name); ok {
+			files = append(files, workspaceFile{path: file, kind: configEnvironment, name: name, scope: name})
+		}
+	}
+
+	if marker := filepath.Join(cm.configDir, workspaceMarker); fileExists(marker) {
+		files = append(files, workspaceFile{path: marker, kind: configWorkspace})
+	}
+	return files, nil
+}
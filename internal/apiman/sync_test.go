@@ -0,0 +1,152 @@
+package apiman
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSyncWorkspace(t *testing.T) {
+	t.Setenv(secretsBackendEnv, "file")
+	t.Setenv(secretsPassphraseEnv, "test passphrase")
+	cm, err := InitWorkspace(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	write := func(path, content string) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(filepath.Join(cm.configDir, workspaceMarker), `{"schemaVersion": 1, "secretKeys": ["session"]}`)
+	envFile := filepath.Join(cm.environmentsDir, "dev.json")
+	write(envFile, `{"baseURL": "https://api.example.com", "schemaVersion": 1,
+		"headers": {"X-Api-Key": "k-123", "Accept": "application/json"},
+		"auth": {"type": "bearer", "token": "t-456"},
+		"variables": {"db_password": "hunter2", "region": "eu", "api_token": "{{env.TOKEN}}"},
+		"tracing": {"headers": {"X-Trace-Token": "x"}}}`)
+	requestFile := filepath.Join(cm.requestsDir, "orders", "list", "request.json")
+	write(requestFile, `{"schemaVersion": 1, "method": "GET", "url": "/orders",
+		"headers": {"Authorization": "Bearer s3cr3t"}, "cookies": {"session_id": "c-789"},
+		"envOverrides": {"prod": {"headers": {"X-Token": "p-000"}}}}`)
+	badFile := filepath.Join(cm.requestsDir, "orders", "bad", "request.json")
+	write(badFile, `{"schemaVersion": 1, "method": "GET", "url": "/orders", "unknownField": true}`)
+
+	// A different value already stored under a generated name isn't replaced.
+	store, err := cm.Secrets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Set("dev.variables.db_password", "other"); err != nil {
+		t.Fatal(err)
+	}
+
+	snapshot := func() map[string]string {
+		contents := map[string]string{}
+		for _, path := range []string{envFile, requestFile, badFile} {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			contents[path] = string(data)
+		}
+		return contents
+	}
+	before := snapshot()
+
+	report, err := cm.SyncWorkspace(SyncOptions{Check: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Clean() {
+		t.Fatal("check found the workspace clean")
+	}
+	wantSecrets := []string{
+		"requests/orders/list/request.json: headers.Authorization -> {{secret.orders.list.headers.Authorization}}",
+		"requests/orders/list/request.json: cookies.session_id -> {{secret.orders.list.cookies.session_id}}",
+		"requests/orders/list/request.json: envOverrides.prod.headers.X-Token -> {{secret.orders.list.envOverrides.prod.headers.X-Token}}",
+		"environments/dev.json: headers.X-Api-Key -> {{secret.dev.headers.X-Api-Key}}",
+		"environments/dev.json: auth.token -> {{secret.dev.auth.token}}",
+		"environments/dev.json: variables.db_password -> {{secret.dev.variables.db_password}}",
+		"environments/dev.json: tracing.headers.X-Trace-Token -> {{secret.dev.tracing.headers.X-Trace-Token}}",
+	}
+	for _, want := range wantSecrets {
+		if !slices.Contains(report.Secrets, want) {
+			t.Errorf("check didn't report %s in:\n%s", want, strings.Join(report.Secrets, "\n"))
+		}
+	}
+	if len(report.Secrets) != len(wantSecrets) {
+		t.Errorf("check reported %d secrets, want %d:\n%s", len(report.Secrets), len(wantSecrets), strings.Join(report.Secrets, "\n"))
+	}
+	for _, want := range []string{"requests/orders/list/request.json", "environments/dev.json"} {
+		if !slices.Contains(report.Formatted, want) {
+			t.Errorf("check didn't report %s as formatted: %q", want, report.Formatted)
+		}
+	}
+	if len(report.Invalid) != 1 || !strings.HasPrefix(report.Invalid[0], "requests/orders/bad/request.json: ") || !strings.Contains(report.Invalid[0], "unknownField") {
+		t.Errorf("invalid %q", report.Invalid)
+	}
+	if after := snapshot(); !maps.Equal(after, before) {
+		t.Error("check changed files")
+	}
+	if names, _ := store.List(); len(names) != 1 {
+		t.Errorf("check stored secrets: %q", names)
+	}
+
+	if _, err := cm.SyncWorkspace(SyncOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	env, err := cm.LoadEnvironment("dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if env.Auth["token"] != "{{secret.dev.auth.token}}" || env.Variables["db_password"] != "{{secret.dev.variables.db_password-2}}" ||
+		env.Variables["region"] != "eu" || env.Variables["api_token"] != "{{env.TOKEN}}" || env.Headers["Accept"] != "application/json" {
+		t.Errorf("synced environment: auth %v, variables %v, headers %v", env.Auth, env.Variables, env.Headers)
+	}
+	request, err := cm.LoadRequest("orders/list")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if request.Headers["Authorization"] != "Bearer {{secret.orders.list.headers.Authorization}}" {
+		t.Errorf("synced Authorization %q", request.Headers["Authorization"])
+	}
+	for name, want := range map[string]string{
+		"orders.list.headers.Authorization":             "s3cr3t",
+		"orders.list.cookies.session_id":                "c-789",
+		"dev.variables.db_password":                     "other",
+		"dev.variables.db_password-2":                   "hunter2",
+		"dev.tracing.headers.X-Trace-Token":             "x",
+		"orders.list.envOverrides.prod.headers.X-Token": "p-000",
+	} {
+		if got, err := store.Get(name); err != nil || got != want {
+			t.Errorf("secret %s = %q, %v; want %q", name, got, err, want)
+		}
+	}
+	data, err := os.ReadFile(requestFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(string(data), "}\n") || strings.Contains(string(data), "\t") {
+		t.Errorf("request not rewritten in the canonical format:\n%s", data)
+	}
+	if data, _ := os.ReadFile(badFile); string(data) != before[badFile] {
+		t.Error("invalid file rewritten")
+	}
+
+	// Synced, the workspace checks clean apart from the invalid file.
+	report, err = cm.SyncWorkspace(SyncOptions{Check: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Formatted) != 0 || len(report.Secrets) != 0 || len(report.Invalid) != 1 {
+		t.Errorf("second check: %+v", report)
+	}
+}
@@ -0,0 +1,403 @@
+// templates.go
+package apiman
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// api-man init --template starts a workspace from a template instead of the
+// sample dev/prod environments and users/get-users request. The built-in
+// templates are rest-crud, graphql and microservice; user templates are
+// JSON or YAML files in ~/.config/api-man/templates ($XDG_CONFIG_HOME is
+// honoured), and override a built-in of the same name.
+
+// WorkspaceTemplate is what a template creates in a new workspace.
+type WorkspaceTemplate struct {
+	Description string `json:"description,omitempty"`
+	// Directories are created under requests/ for requests to come.
+	Directories []string `json:"directories,omitempty"`
+	// Defaults is written to the workspace's _defaults.json, holding the
+	// headers, timeout and retry policy of every request.
+	Defaults     *RequestDefaults         `json:"defaults,omitempty"`
+	Environments map[string]Environment   `json:"environments,omitempty"`
+	Requests     map[string]RequestConfig `json:"requests,omitempty"`
+	Suites       map[string]*Suite        `json:"suites,omitempty"`
+}
+
+// TemplateInfo describes a template api-man init can use.
+type TemplateInfo struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// File is the user template's file; built-in templates have none.
+	File string `json:"file,omitempty"`
+}
+
+// userTemplatesDir returns the directory of the user's templates.
+func userTemplatesDir() (string, error) {
+	dir, err := userConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "templates"), nil
+}
+
+// ListWorkspaceTemplates returns the built-in and user templates, sorted by
+// name. A user template hides the built-in one of its name.
+func ListWorkspaceTemplates() ([]TemplateInfo, error) {
+	byName := map[string]TemplateInfo{}
+	for name, template := range builtinTemplates {
+		byName[name] = TemplateInfo{Name: name, Description: template.Description}
+	}
+	dir, err := userTemplatesDir()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("reading templates directory: %w", err)
+	}
+	for _, entry := range entries {
+		ext := configFileExt(entry.Name())
+		if entry.IsDir() || ext == "" {
+			continue
+		}
+		file := filepath.Join(dir, entry.Name())
+		info := TemplateInfo{Name: strings.TrimSuffix(entry.Name(), ext), File: file}
+		if template, err := readWorkspaceTemplate(file); err == nil {
+			info.Description = template.Description
+		} else {
+			info.Description = "⚠️  " + err.Error()
+		}
+		byName[info.Name] = info
+	}
+
+	templates := make([]TemplateInfo, 0, len(byName))
+	for _, name := range sortedKeys(byName) {
+		templates = append(templates, byName[name])
+	}
+	return templates, nil
+}
+
+// LoadWorkspaceTemplate returns the template name: a user template, a
+// built-in one or, when name is a path to a .json, .yaml or .yml file, that
+// file.
+func LoadWorkspaceTemplate(name string) (*WorkspaceTemplate, error) {
+	if configFileExt(name) != "" || strings.ContainsRune(name, filepath.Separator) || strings.Contains(name, "/") {
+		return readWorkspaceTemplate(name)
+	}
+	dir, err := userTemplatesDir()
+	if err != nil {
+		return nil, err
+	}
+	if file, ok := findConfigFile(filepath.Join(dir, name)); ok {
+		return readWorkspaceTemplate(file)
+	}
+	if template, ok := builtinTemplates[name]; ok {
+		return template, nil
+	}
+	templates, err := ListWorkspaceTemplates()
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(templates))
+	for i, template := range templates {
+		names[i] = template.Name
+	}
+	return nil, fmt.Errorf("template %q not found (available: %s)", name, strings.Join(names, ", "))
+}
+
+func readWorkspaceTemplate(file string) (*WorkspaceTemplate, error) {
+	data, err := readConfigFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("reading template: %w", err)
+	}
+	var template WorkspaceTemplate
+	if err := json.Unmarshal(data, &template); err != nil {
+		return nil, fmt.Errorf("parsing template %s: %w", filepath.Base(file), err)
+	}
+	for _, name := range sortedKeys(template.Environments) {
+		if err := ValidateEnvironmentName(name); err != nil {
+			return nil, fmt.Errorf("template %s: environment %q: %w", filepath.Base(file), name, err)
+		}
+	}
+	for _, name := range sortedKeys(template.Suites) {
+		if err := validateTemplatePath(name); err != nil {
+			return nil, fmt.Errorf("template %s: suite %q: %w", filepath.Base(file), name, err)
+		}
+	}
+	for _, path := range append(sortedKeys(template.Requests), template.Directories...) {
+		if err := validateTemplatePath(path); err != nil {
+			return nil, fmt.Errorf("template %s: %q: %w", filepath.Base(file), path, err)
+		}
+	}
+	return &template, nil
+}
+
+// validateTemplatePath rejects paths that would leave the directory they
+// are created in.
+func validateTemplatePath(path string) error {
+	clean := filepath.ToSlash(filepath.Clean(path))
+	if path == "" || filepath.IsAbs(path) || clean == ".." || strings.HasPrefix(clean, "../") {
+		return fmt.Errorf("must be a relative path inside the workspace")
+	}
+	return nil
+}
+
+// TemplateResult lists what applying a template created. Files that
+// already existed are left alone and not listed.
+type TemplateResult struct {
+	Environments []string `json:"environments,omitempty"`
+	Requests     []string `json:"requests,omitempty"`
+	Suites       []string `json:"suites,omitempty"`
+	Directories  []string `json:"directories,omitempty"`
+	Defaults     bool     `json:"defaults,omitempty"`
+}
+
+// InitWorkspaceFromTemplate creates a workspace rooted at root from
+// template, with the api-man.json marker, and opens it. Unlike InitWorkspace
+// it creates nothing the template doesn't have. Files that already exist
+// are left alone.
+func InitWorkspaceFromTemplate(root string, template *WorkspaceTemplate) (*ConfigManager, *TemplateResult, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, nil, fmt.Errorf("initializing workspace: %w", err)
+	}
+	cm := &ConfigManager{
+		configDir:       root,
+		requestsDir:     filepath.Join(root, "requests"),
+		environmentsDir: filepath.Join(root, "environments"),
+	}
+	for _, dir := range []string{cm.requestsDir, cm.environmentsDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, nil, fmt.Errorf("creating directory %s: %w", dir, err)
+		}
+	}
+	if err := writeWorkspaceMarker(root); err != nil {
+		return nil, nil, fmt.Errorf("initializing workspace: %w", err)
+	}
+	result, err := cm.applyTemplate(template)
+	if err != nil {
+		return nil, nil, fmt.Errorf("applying template: %w", err)
+	}
+	return cm, result, nil
+}
+
+func (cm *ConfigManager) applyTemplate(template *WorkspaceTemplate) (*TemplateResult, error) {
+	result := &TemplateResult{}
+	for _, dir := range template.Directories {
+		path := filepath.Join(cm.requestsDir, dir)
+		if dirExists(path) {
+			continue
+		}
+		if err := os.MkdirAll(path, 0755); err != nil {
+			return nil, fmt.Errorf("creating directory %s: %w", dir, err)
+		}
+		result.Directories = append(result.Directories, filepath.ToSlash(dir))
+	}
+
+	if template.Defaults != nil {
+		file := filepath.Join(cm.configDir, defaultsFileName)
+		if !fileExists(file) {
+			if err := writeJSONFile(file, template.Defaults); err != nil {
+				return nil, fmt.Errorf("writing %s: %w", defaultsFileName, err)
+			}
+			result.Defaults = true
+		}
+	}
+
+	for _, name := range sortedKeys(template.Environments) {
+		if _, exists := cm.environmentFile(name); exists {
+			continue
+		}
+		if err := cm.SaveEnvironment(name, template.Environments[name]); err != nil {
+			return nil, err
+		}
+		result.Environments = append(result.Environments, name)
+	}
+
+	for _, path := range sortedKeys(template.Requests) {
+		if _, exists := cm.requestFile(path); exists {
+			continue
+		}
+		if err := cm.SaveRequest(path, template.Requests[path]); err != nil {
+			return nil, fmt.Errorf("saving request %s: %w", path, err)
+		}
+		result.Requests = append(result.Requests, path)
+	}
+
+	for _, name := range sortedKeys(template.Suites) {
+		file := filepath.Join(cm.suitesDir(), name+".json")
+		if fileExists(file) {
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			return nil, fmt.Errorf("creating suites directory: %w", err)
+		}
+		if err := writeJSONFile(file, template.Suites[name]); err != nil {
+			return nil, fmt.Errorf("writing suite %s: %w", name, err)
+		}
+		result.Suites = append(result.Suites, name)
+	}
+	sort.Strings(result.Directories)
+	return result, nil
+}
+
+// templateEnvironment returns an environment of a built-in template.
+func templateEnvironment(baseURL string, headers, variables map[string]string) Environment {
+	return Environment{
+		BaseURL:   baseURL,
+		Headers:   headers,
+		Cookies:   map[string]string{},
+		Auth:      map[string]string{},
+		Variables: variables,
+	}
+}
+
+// templateRequest returns a request of a built-in template expecting
+// status.
+func templateRequest(name, method, url, body string, status int) RequestConfig {
+	return RequestConfig{
+		Name:       name,
+		Method:     method,
+		URL:        url,
+		Headers:    map[string]string{},
+		Cookies:    map[string]string{},
+		Body:       body,
+		Params:     map[string]interface{}{},
+		Assertions: &Assertions{Status: status},
+	}
+}
+
+var builtinTemplates = map[string]*WorkspaceTemplate{
+	"rest-crud":    restCRUDTemplate(),
+	"graphql":      graphQLTemplate(),
+	"microservice": microserviceTemplate(),
+}
+
+// restCRUDTemplate has the five requests of a JSON resource, with a bearer
+// token per environment and a suite running them in order.
+func restCRUDTemplate() *WorkspaceTemplate {
+	headers := map[string]string{"Authorization": "Bearer {{token}}"}
+	getItem := templateRequest("Get item", "GET", "/items/{id}", "", 200)
+	getItem.PathParams = map[string]string{"id": "{{itemId}}"}
+	createItem := templateRequest("Create item", "POST", "/items", "{\n  \"name\": \"Example\"\n}", 201)
+	createItem.Extract = map[string]string{"itemId": "$.id"}
+	updateItem := templateRequest("Update item", "PUT", "/items/{id}", "{\n  \"name\": \"Renamed\"\n}", 200)
+	updateItem.PathParams = map[string]string{"id": "{{itemId}}"}
+	deleteItem := templateRequest("Delete item", "DELETE", "/items/{id}", "", 204)
+	deleteItem.PathParams = map[string]string{"id": "{{itemId}}"}
+
+	return &WorkspaceTemplate{
+		Description: "JSON REST resource: list, get, create, update and delete, with a CRUD suite",
+		Defaults: &RequestDefaults{
+			Headers: map[string]string{"Content-Type": "application/json", "Accept": "application/json"},
+			Timeout: 30,
+		},
+		Environments: map[string]Environment{
+			"dev":     templateEnvironment("http://localhost:3000", headers, map[string]string{"token": ""}),
+			"staging": templateEnvironment("https://staging.api.example.com", headers, map[string]string{"token": ""}),
+			"prod":    templateEnvironment("https://api.example.com", headers, map[string]string{"token": ""}),
+		},
+		Requests: map[string]RequestConfig{
+			"items/list-items":  templateRequest("List items", "GET", "/items", "", 200),
+			"items/create-item": createItem,
+			"items/get-item":    getItem,
+			"items/update-item": updateItem,
+			"items/delete-item": deleteItem,
+		},
+		Suites: map[string]*Suite{
+			"crud": {
+				Description: "Create an item, read it back, update it and delete it",
+				Requests: []SuiteEntry{
+					{Request: "items/create-item"},
+					{Request: "items/get-item"},
+					{Request: "items/update-item"},
+					{Request: "items/list-items"},
+					{Request: "items/delete-item"},
+				},
+			},
+		},
+	}
+}
+
+// graphQLTemplate has a schema introspection query and a query with
+// variables, both POSTed to /graphql.
+func graphQLTemplate() *WorkspaceTemplate {
+	headers := map[string]string{"Authorization": "Bearer {{token}}"}
+	introspection := templateRequest("Introspect schema", "POST", "/graphql",
+		"{\n  \"query\": \"{ __schema { queryType { name } types { name kind } } }\"\n}", 200)
+	introspection.Assertions.JSONPath = []JSONPathAssertion{{Path: "$.data.__schema.queryType.name"}}
+	query := templateRequest("Query", "POST", "/graphql",
+		"{\n  \"query\": \"query Item($id: ID!) { item(id: $id) { id name } }\",\n  \"variables\": {\"id\": \"{{itemId}}\"}\n}", 200)
+	query.Assertions.Expect = []string{"!body.errors"}
+
+	return &WorkspaceTemplate{
+		Description: "GraphQL endpoint: schema introspection and a query with variables",
+		Defaults: &RequestDefaults{
+			Headers: map[string]string{"Content-Type": "application/json", "Accept": "application/json"},
+			Timeout: 30,
+		},
+		Environments: map[string]Environment{
+			"dev":  templateEnvironment("http://localhost:4000", headers, map[string]string{"token": "", "itemId": "1"}),
+			"prod": templateEnvironment("https://api.example.com", headers, map[string]string{"token": "", "itemId": "1"}),
+		},
+		Requests: map[string]RequestConfig{
+			"graphql/introspection": introspection,
+			"graphql/query":         query,
+		},
+		Suites: map[string]*Suite{
+			"smoke": {
+				Description: "The schema is served and a query answers without errors",
+				Requests:    []SuiteEntry{{Request: "graphql"}},
+			},
+		},
+	}
+}
+
+// microserviceTemplate has health, readiness and metrics probes with
+// latency budgets, retried requests and a parallel smoke suite across
+// local, staging and prod.
+func microserviceTemplate() *WorkspaceTemplate {
+	health := templateRequest("Liveness", "GET", "/healthz", "", 200)
+	health.LatencyBudgetMS = 200
+	ready := templateRequest("Readiness", "GET", "/readyz", "", 200)
+	ready.LatencyBudgetMS = 500
+	metrics := templateRequest("Metrics", "GET", "/metrics", "", 200)
+	metrics.Assertions.BodyContains = []string{"# TYPE"}
+	version := templateRequest("Version", "GET", "/version", "", 200)
+	headers := map[string]string{"X-Client": "api-man"}
+
+	return &WorkspaceTemplate{
+		Description: "Service probes: liveness, readiness, metrics and version, with a smoke suite",
+		Directories: []string{"api"},
+		Defaults: &RequestDefaults{
+			Headers: map[string]string{"Accept": "application/json"},
+			Timeout: 10,
+			Retry:   &RetryPolicy{Attempts: 3, DelayMS: 500},
+		},
+		Environments: map[string]Environment{
+			"local":   templateEnvironment("http://localhost:8080", headers, map[string]string{}),
+			"staging": templateEnvironment("https://service.staging.example.com", headers, map[string]string{}),
+			"prod":    templateEnvironment("https://service.example.com", headers, map[string]string{}),
+		},
+		Requests: map[string]RequestConfig{
+			"ops/health":  health,
+			"ops/ready":   ready,
+			"ops/metrics": metrics,
+			"ops/version": version,
+		},
+		Suites: map[string]*Suite{
+			"smoke": {
+				Description:    "Post-deploy check that the service is up within its latency budgets",
+				Parallel:       4,
+				EnforceBudgets: true,
+				Requests:       []SuiteEntry{{Request: "ops"}},
+			},
+		},
+	}
+}
@@ -0,0 +1,146 @@
+// testrunner.go
+package apiman
+
+import (
+	"fmt"
+	"io"
+)
+
+// TestResult is the outcome of executing one request and evaluating the
+// assertions saved with it.
+type TestResult struct {
+	Request     string `json:"request"`
+	Environment string `json:"environment,omitempty"`
+	StatusCode  int    `json:"statusCode,omitempty"`
+	DurationMS  int64  `json:"durationMs"`
+	// BudgetMS is the request's latency budget and OverBudget whether the
+	// response took longer.
+	BudgetMS   int64             `json:"budgetMs,omitempty"`
+	OverBudget bool              `json:"overBudget,omitempty"`
+	Assertions []AssertionResult `json:"assertions,omitempty"`
+	Skipped    bool              `json:"skipped,omitempty"`
+	Passed     bool              `json:"passed"`
+	Error      string            `json:"error,omitempty"`
+	// Execution is the exchange behind the result, attached to reports of
+	// failed tests.
+	Execution *ExecutionResult `json:"-"`
+}
+
+// TestReport collects the results of a test run.
+type TestReport struct {
+	// Name identifies the run in reports, e.g. the suite name.
+	Name        string       `json:"name,omitempty"`
+	Environment string       `json:"environment"`
+	Results     []TestResult `json:"results"`
+	Passed      int          `json:"passed"`
+	Failed      int          `json:"failed"`
+	Skipped     int          `json:"skipped"`
+}
+
+// OK reports whether every executed request passed.
+func (r *TestReport) OK() bool {
+	return r.Failed == 0
+}
+
+// RunTests executes every request in requestPaths against envName and
+// evaluates its assertions block. Requests without assertions are skipped
+// rather than executed.
+func (cm *ConfigManager) RunTests(requestPaths []string, envName string, out io.Writer) *TestReport {
+	report := &TestReport{Environment: envName}
+
+	for _, path := range requestPaths {
+		result := cm.runTest(path, envName, RequestOptions{}, true)
+		result.Environment = envName
+		printTestResult(out, result)
+		report.add(result)
+	}
+
+	fmt.Fprintf(out, "\n%d passed, %d failed, %d skipped\n", report.Passed, report.Failed, report.Skipped)
+	return report
+}
+
+// runTest executes one request and evaluates its assertions, plus schema
+// validation when the request has validateResponse set. A request without
+// either is skipped when skipUnasserted is set and otherwise passes unless
+// it gets a 4xx/5xx response.
+func (cm *ConfigManager) runTest(path, envName string, opts RequestOptions, skipUnasserted bool) TestResult {
+	result := TestResult{Request: path}
+
+	config, err := cm.LoadRequest(path)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	checked := !config.Assertions.IsEmpty() || config.ValidateResponse
+	if skipUnasserted && !checked {
+		result.Skipped = true
+		return result
+	}
+
+	exec, err := cm.RunRequest(path, envName, opts)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Execution = exec
+	result.StatusCode = exec.StatusCode
+	result.DurationMS = exec.DurationMS()
+	result.BudgetMS = exec.BudgetMS
+	result.OverBudget = exec.OverBudget()
+	if !checked {
+		result.Passed = exec.StatusCode < 400
+		if !result.Passed {
+			result.Error = fmt.Sprintf("request returned %s", exec.Status)
+		}
+		return result
+	}
+	result.Assertions = cm.evaluateAssertions(config.Assertions, exec, opts)
+	if config.ValidateResponse {
+		result.Assertions = append(result.Assertions, schemaAssertion(config.Schema, exec))
+	}
+	result.Passed = assertionsPassed(result.Assertions)
+	return result
+}
+
+func (r *TestReport) add(result TestResult) {
+	switch {
+	case result.Skipped:
+		r.Skipped++
+	case result.Passed:
+		r.Passed++
+	default:
+		r.Failed++
+	}
+	r.Results = append(r.Results, result)
+}
+
+func printTestResult(out io.Writer, result TestResult) {
+	switch {
+	case result.Skipped:
+		fmt.Fprintf(out, "- %s (no assertions)\n", result.Request)
+		return
+	case result.Error != "" && result.StatusCode != 0:
+		fmt.Fprintf(out, "✗ %s %d (%dms)\n    %s\n", result.Request, result.StatusCode, result.DurationMS, result.Error)
+		return
+	case result.Error != "":
+		fmt.Fprintf(out, "✗ %s\n    %s\n", result.Request, result.Error)
+		return
+	}
+
+	marker := "✓"
+	if !result.Passed {
+		marker = "✗"
+	}
+	duration := fmt.Sprintf("%dms", result.DurationMS)
+	if result.OverBudget {
+		duration = fmt.Sprintf("%dms, over the %dms budget ⚠️", result.DurationMS, result.BudgetMS)
+	}
+	fmt.Fprintf(out, "%s %s %d (%s)\n", marker, result.Request, result.StatusCode, duration)
+	for _, a := range result.Assertions {
+		if a.Passed {
+			fmt.Fprintf(out, "    ✓ %s\n", a.Name)
+		} else {
+			fmt.Fprintf(out, "    ✗ %s: %s\n", a.Name, a.Message)
+		}
+	}
+}
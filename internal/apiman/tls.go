@@ -0,0 +1,125 @@
+// tls.go
+package apiman
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// tlsConfig builds the TLS configuration for env's TLS settings, or returns
+// nil when it has none. Certificate paths are relative to the workspace.
+func (cm *ConfigManager) tlsConfig(env *Environment) (*tls.Config, error) {
+	if env.CACertFile == "" && env.ClientCertFile == "" && env.ClientKeyFile == "" &&
+		!env.InsecureSkipVerify && env.MinVersion == "" {
+		return nil, nil
+	}
+
+	config := &tls.Config{InsecureSkipVerify: env.InsecureSkipVerify}
+	if env.MinVersion != "" {
+		version, ok := tlsVersions[env.MinVersion]
+		if !ok {
+			return nil, fmt.Errorf("unsupported minVersion %q (expected 1.0, 1.1, 1.2 or 1.3)", env.MinVersion)
+		}
+		config.MinVersion = version
+	}
+
+	if env.CACertFile != "" {
+		pem, err := os.ReadFile(cm.workspacePath(env.CACertFile))
+		if err != nil {
+			return nil, fmt.Errorf("reading caCertFile: %w", err)
+		}
+		// Trust the system roots as well, so one environment can reach both
+		// internal and public hosts.
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no PEM certificates found in %s", env.CACertFile)
+		}
+		config.RootCAs = pool
+	}
+
+	if env.ClientCertFile != "" || env.ClientKeyFile != "" {
+		if env.ClientCertFile == "" || env.ClientKeyFile == "" {
+			return nil, fmt.Errorf("clientCertFile and clientKeyFile must be set together")
+		}
+		cert, err := tls.LoadX509KeyPair(cm.workspacePath(env.ClientCertFile), cm.workspacePath(env.ClientKeyFile))
+		if err != nil {
+			return nil, fmt.Errorf("loading client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// httpTransport returns a transport applying env's proxy, TLS and
+// connection target (see dialTarget) settings and challenge-based
+// authentication, or nil to use http.DefaultTransport when it has none of
+// them.
+func (cm *ConfigManager) httpTransport(env *Environment, proxyOverride string) (http.RoundTripper, error) {
+	tlsConfig, err := cm.tlsConfig(env)
+	if err != nil {
+		return nil, err
+	}
+	network, address := cm.dialTarget(env)
+	var transport http.RoundTripper
+	if proxy := env.proxySettings(proxyOverride); tlsConfig != nil || !proxy.isZero() || network != "" {
+		custom := http.DefaultTransport.(*http.Transport).Clone()
+		custom.TLSClientConfig = tlsConfig
+		if err := proxy.apply(custom); err != nil {
+			return nil, err
+		}
+		if network != "" {
+			dialTo(custom, network, address)
+		}
+		transport = custom
+	}
+	switch env.Auth["type"] {
+	case "digest":
+		transport = newDigestTransport(transport, env.Auth["username"], env.Auth["password"])
+	case "ntlm":
+		transport = newNTLMTransport(transport, "NTLM", env.Auth)
+	case "negotiate":
+		transport = newNTLMTransport(transport, "Negotiate", env.Auth)
+	}
+	return transport, nil
+}
+
+// authTransport is a transport that authenticates requests itself because
+// the scheme needs a challenge from the server, like Digest and NTLM.
+type authTransport interface {
+	http.RoundTripper
+	// unwrap returns the transport the requests are sent through.
+	unwrap() http.RoundTripper
+	// withBase returns the same authentication sending through base, e.g. a
+	// transport tuned for a load test.
+	withBase(base http.RoundTripper) http.RoundTripper
+}
+
+// unwrapTransport returns the *http.Transport underneath rt, if any.
+func unwrapTransport(rt http.RoundTripper) (*http.Transport, bool) {
+	if auth, ok := rt.(authTransport); ok {
+		rt = auth.unwrap()
+	}
+	transport, ok := rt.(*http.Transport)
+	return transport, ok
+}
+
+func (cm *ConfigManager) workspacePath(path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(cm.configDir, path)
+}
@@ -0,0 +1,222 @@
+// tracing.go
+package apiman
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TracingConfig turns on OpenTelemetry tracing for an environment's
+// requests: each one carries a W3C traceparent header and, when Endpoint is
+// set, is reported as a client span to an OTLP/HTTP collector.
+type TracingConfig struct {
+	// Endpoint is the collector's OTLP/HTTP address, such as
+	// http://localhost:4318; spans are posted to its /v1/traces.
+	Endpoint string `json:"endpoint,omitempty"`
+	// Headers are sent with every export, e.g. an API key.
+	Headers map[string]string `json:"headers,omitempty"`
+	// ServiceName is the service.name of the spans; "api-man" by default.
+	ServiceName string `json:"serviceName,omitempty"`
+}
+
+// traceparentPattern matches a version 00 W3C traceparent header.
+var traceparentPattern = regexp.MustCompile(`^00-([0-9a-f]{32})-([0-9a-f]{16})-([0-9a-f]{2})$`)
+
+// TraceContext identifies the span of one execution within its trace.
+type TraceContext struct {
+	TraceID string
+	SpanID  string
+	// ParentSpanID is the span the execution continues, from a
+	// traceparent header the request already had or the TRACEPARENT
+	// environment variable, or "" when it starts a new trace.
+	ParentSpanID string
+	Sampled      bool
+}
+
+// newTraceContext starts the span of a request whose traceparent header, or
+// else the TRACEPARENT environment variable, is parent. An invalid or empty
+// parent starts a new, sampled trace.
+func newTraceContext(parent string) *TraceContext {
+	if parent == "" {
+		parent = os.Getenv("TRACEPARENT")
+	}
+	if match := traceparentPattern.FindStringSubmatch(strings.TrimSpace(parent)); match != nil &&
+		strings.Trim(match[1], "0") != "" && strings.Trim(match[2], "0") != "" {
+		flags, _ := strconv.ParseUint(match[3], 16, 8)
+		return &TraceContext{TraceID: match[1], SpanID: randomHex(8), ParentSpanID: match[2], Sampled: flags&1 == 1}
+	}
+	return &TraceContext{TraceID: randomHex(16), SpanID: randomHex(8), Sampled: true}
+}
+
+// child returns a new span in the same trace with the same parent, for
+// requests sent more than once, such as load test samples.
+func (t *TraceContext) child() *TraceContext {
+	child := *t
+	child.SpanID = randomHex(8)
+	return &child
+}
+
+// Header is the traceparent header value that makes the server's spans
+// children of this one.
+func (t *TraceContext) Header() string {
+	flags := "00"
+	if t.Sampled {
+		flags = "01"
+	}
+	return "00-" + t.TraceID + "-" + t.SpanID + "-" + flags
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// tracesURL returns the OTLP/HTTP traces URL of a collector endpoint.
+func tracesURL(endpoint string) string {
+	endpoint = strings.TrimSuffix(endpoint, "/")
+	if strings.HasSuffix(endpoint, "/v1/traces") {
+		return endpoint
+	}
+	return endpoint + "/v1/traces"
+}
+
+// otlpAttribute is a key-value pair in OTLP/JSON.
+type otlpAttribute struct {
+	Key   string                 `json:"key"`
+	Value map[string]interface{} `json:"value"`
+}
+
+func stringAttribute(key, value string) otlpAttribute {
+	return otlpAttribute{Key: key, Value: map[string]interface{}{"stringValue": value}}
+}
+
+func intAttribute(key string, value int) otlpAttribute {
+	// OTLP/JSON encodes 64-bit integers as strings.
+	return otlpAttribute{Key: key, Value: map[string]interface{}{"intValue": strconv.Itoa(value)}}
+}
+
+// OTLP span kind and status codes.
+const (
+	otlpSpanKindClient  = 3
+	otlpStatusCodeError = 2
+)
+
+// spanRequest builds the OTLP/JSON export of prepared's span: a client span
+// from startedAt to end, ending in result or, when no response came back,
+// err.
+func spanRequest(prepared *PreparedRequest, result *ExecutionResult, err error, startedAt, end time.Time) ([]byte, error) {
+	req := prepared.Request
+	attributes := []otlpAttribute{
+		stringAttribute("http.request.method", req.Method),
+		stringAttribute("url.full", redactURL(req.URL)),
+		stringAttribute("server.address", req.URL.Hostname()),
+		stringAttribute("apiman.request", prepared.Path),
+		stringAttribute("apiman.environment", prepared.Environment),
+	}
+	status := map[string]interface{}{}
+	switch {
+	case err != nil:
+		attributes = append(attributes, stringAttribute("error.type", fmt.Sprintf("%T", err)))
+		status = map[string]interface{}{"code": otlpStatusCodeError, "message": err.Error()}
+	case result.Method == "GRPC":
+		attributes = append(attributes, stringAttribute("rpc.system", "grpc"), stringAttribute("rpc.grpc.status_code", result.Status))
+		if result.Status != "OK" {
+			status = map[string]interface{}{"code": otlpStatusCodeError}
+		}
+	default:
+		attributes = append(attributes, intAttribute("http.response.status_code", result.StatusCode))
+		if result.StatusCode >= 400 {
+			attributes = append(attributes, stringAttribute("error.type", strconv.Itoa(result.StatusCode)))
+			status = map[string]interface{}{"code": otlpStatusCodeError}
+		}
+	}
+	span := map[string]interface{}{
+		"traceId":           prepared.Trace.TraceID,
+		"spanId":            prepared.Trace.SpanID,
+		"name":              req.Method + " " + prepared.Path,
+		"kind":              otlpSpanKindClient,
+		"startTimeUnixNano": strconv.FormatInt(startedAt.UnixNano(), 10),
+		"endTimeUnixNano":   strconv.FormatInt(end.UnixNano(), 10),
+		"attributes":        attributes,
+		"status":            status,
+	}
+	if prepared.Trace.ParentSpanID != "" {
+		span["parentSpanId"] = prepared.Trace.ParentSpanID
+	}
+	service := prepared.Tracing.ServiceName
+	if service == "" {
+		service = "api-man"
+	}
+	return json.Marshal(map[string]interface{}{
+		"resourceSpans": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{"attributes": []otlpAttribute{stringAttribute("service.name", service)}},
+			"scopeSpans": []interface{}{map[string]interface{}{
+				"scope": map[string]interface{}{"name": "api-man"},
+				"spans": []interface{}{span},
+			}},
+		}},
+	})
+}
+
+// redactURL returns u without its user info, which spans must not carry.
+func redactURL(u *url.URL) string {
+	redacted := *u
+	redacted.User = nil
+	return redacted.String()
+}
+
+// exportSpan reports prepared's execution to the environment's collector
+// when tracing is on and the trace is sampled. Like the history, a failed
+// export never fails the request itself, so errors are only reported.
+func exportSpan(prepared *PreparedRequest, result *ExecutionResult, execErr error, startedAt time.Time) {
+	if prepared.Trace == nil || !prepared.Trace.Sampled || prepared.Tracing == nil || prepared.Tracing.Endpoint == "" {
+		return
+	}
+	end := time.Now()
+	if result != nil {
+		end = startedAt.Add(result.Duration)
+	}
+	data, err := spanRequest(prepared, result, execErr, startedAt, end)
+	if err == nil {
+		err = postSpan(prepared.Tracing, data)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: exporting trace span: %v\n", err)
+	}
+}
+
+func postSpan(tracing *TracingConfig, data []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tracesURL(tracing.Endpoint), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range tracing.Headers {
+		if value != "" {
+			req.Header.Set(key, value)
+		}
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("collector returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,932 @@
+// tui.go
+package apiman
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/spinner"
+	"github.com/charmbracelet/bubbles/textarea"
+	"github.com/charmbracelet/bubbles/textinput"
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// The TUI is a terminal front-end for the workspace: browse requests/, pick
+// an environment, tweak the URL and body for one execution and read the
+// response. Edits are only written back to disk with ctrl+w.
+
+type tuiView int
+
+const (
+	viewRequests tuiView = iota
+	viewEnvironments
+	viewDetail
+	viewHistory
+	viewHistoryEntry
+	viewNotes
+	viewProjects
+)
+
+// Panes of the request view that take keys, in tab order.
+const (
+	focusURL = iota
+	focusBody
+	focusResponse
+)
+
+// sideBySideWidth is the terminal width from which the request editor and
+// the response are shown side by side rather than stacked.
+const sideBySideWidth = 110
+
+var httpMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD", "OPTIONS", "TRACE"}
+
+// methodColors color methods in the TUI; other methods, such as WebDAV's
+// PROPFIND or PURGE, are orange.
+var methodColors = map[string]string{
+	"GET": "10", "POST": "11", "PUT": "12", "PATCH": "13", "DELETE": "9",
+	"HEAD": "14", "OPTIONS": "14", "TRACE": "14", "CONNECT": "14",
+}
+
+var (
+	tuiTitleStyle    = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("12"))
+	tuiSelectedStyle = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("0")).Background(lipgloss.Color("12"))
+	tuiDimStyle      = lipgloss.NewStyle().Foreground(lipgloss.Color("8"))
+	tuiErrorStyle    = lipgloss.NewStyle().Foreground(lipgloss.Color("9"))
+	tuiLabelStyle    = lipgloss.NewStyle().Bold(true)
+)
+
+// responseMsg delivers the outcome of sendRequest or replayHistory to
+// Update. id tells the latest request from ones it superseded.
+type responseMsg struct {
+	id     int
+	result *ExecutionResult
+	err    error
+	replay bool
+	// entry is the history entry replayed.
+	entry *HistoryEntry
+}
+
+type tuiModel struct {
+	cm     *ConfigManager
+	view   tuiView
+	width  int
+	height int
+
+	// Request browser
+	requests  []requestEntry
+	filtered  []requestEntry
+	cursor    int
+	filter    textinput.Model
+	filtering bool
+
+	// Environment picker
+	environments []string
+	envCursor    int
+	env          string
+
+	// Request detail
+	requestPath string
+	config      *RequestConfig
+	method      string
+	urlInput    textinput.Model
+	bodyInput   textarea.Model
+	// bodyFile is the body template the body was read from, or "" for
+	// an inline body. Binary bodies are shown by their size and sent as
+	// stored.
+	bodyFile  string
+	focus     int
+	saving    bool
+	saveInput textinput.Model
+
+	// Response view
+	sending  bool
+	sendID   int
+	sentAt   time.Time
+	cancel   context.CancelFunc
+	spinner  spinner.Model
+	result   *ExecutionResult
+	err      error
+	response viewport.Model
+	pendingG bool
+	notice   string
+	// resend sends the request again once the user confirms it, after the
+	// environment asked for confirmation.
+	resend func() tea.Cmd
+
+	// History
+	history       []*HistoryEntry
+	historyCursor int
+	historyEntry  *HistoryEntry
+	historyDetail viewport.Model
+	sessionStart  time.Time
+
+	// Notes of the open request
+	notes     viewport.Model
+	notesText string
+
+	// Project switcher
+	project       string
+	projects      []Project
+	projectCursor int
+}
+
+func newTUIModel(cm *ConfigManager) (*tuiModel, error) {
+	requests, err := cm.requestIndex()
+	if err != nil {
+		return nil, fmt.Errorf("listing requests: %w", err)
+	}
+	environments, err := cm.ListEnvironments()
+	if err != nil {
+		return nil, fmt.Errorf("listing environments: %w", err)
+	}
+
+	filter := textinput.New()
+	filter.Prompt = "/"
+	filter.Placeholder = "search names, URLs, methods"
+
+	urlInput := textinput.New()
+	urlInput.Prompt = ""
+
+	saveInput := textinput.New()
+	saveInput.Prompt = "Save as: "
+
+	bodyInput := textarea.New()
+	bodyInput.ShowLineNumbers = false
+	bodyInput.CharLimit = 0
+	bodyInput.MaxHeight = 0
+
+	response := viewport.New(0, 0)
+	response.SetHorizontalStep(8)
+	historyDetail := viewport.New(0, 0)
+	historyDetail.SetHorizontalStep(8)
+	notes := viewport.New(0, 0)
+
+	progress := spinner.New(spinner.WithSpinner(spinner.Dot), spinner.WithStyle(tuiTitleStyle))
+
+	m := &tuiModel{
+		cm:            cm,
+		requests:      requests,
+		filtered:      requests,
+		filter:        filter,
+		environments:  environments,
+		urlInput:      urlInput,
+		saveInput:     saveInput,
+		bodyInput:     bodyInput,
+		response:      response,
+		spinner:       progress,
+		historyDetail: historyDetail,
+		notes:         notes,
+		sessionStart:  time.Now(),
+		project:       projectName(cm.configDir),
+	}
+	m.env = defaultEnvironment(environments)
+	for i, name := range environments {
+		if name == m.env {
+			m.envCursor = i
+		}
+	}
+	return m, nil
+}
+
+// defaultEnvironment prefers "dev", falling back to the first environment.
+func defaultEnvironment(environments []string) string {
+	for _, name := range environments {
+		if name == "dev" {
+			return name
+		}
+	}
+	if len(environments) > 0 {
+		return environments[0]
+	}
+	return ""
+}
+
+// runTUI starts the interactive request browser.
+func runTUI(cm *ConfigManager) error {
+	// Requests needing confirmation are confirmed in the TUI rather than
+	// on the terminal it draws on.
+	cm.confirm = nil
+	m, err := newTUIModel(cm)
+	if err != nil {
+		return err
+	}
+	_, err = tea.NewProgram(m, tea.WithAltScreen()).Run()
+	return err
+}
+
+func (m *tuiModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m *tuiModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+		m.layout()
+		m.historyDetail.Width = msg.Width
+		m.historyDetail.Height = max(msg.Height-7, 1)
+		m.notes.Width = msg.Width
+		m.notes.Height = max(msg.Height-5, 1)
+		return m, nil
+	case notesEditedMsg:
+		m.finishNotesEdit(msg)
+		return m, nil
+	case spinner.TickMsg:
+		// The spinner stops ticking once the response arrives.
+		if !m.sending {
+			return m, nil
+		}
+		var cmd tea.Cmd
+		m.spinner, cmd = m.spinner.Update(msg)
+		return m, cmd
+	case responseMsg:
+		if msg.id != m.sendID {
+			return m, nil
+		}
+		m.sending = false
+		m.cancel()
+		var confirm *ConfirmationRequiredError
+		if errors.As(msg.err, &confirm) {
+			m.askConfirmation(confirm, msg)
+			return m, nil
+		}
+		if msg.replay {
+			m.finishReplay(msg.err)
+			return m, nil
+		}
+		m.result, m.err = msg.result, msg.err
+		m.notice = ""
+		m.setResponseContent()
+		return m, nil
+	case tea.KeyMsg:
+		if msg.String() == "ctrl+c" {
+			if m.sending {
+				m.cancel()
+			}
+			return m, tea.Quit
+		}
+		// Esc aborts a request in flight instead of leaving the view.
+		if msg.String() == "esc" && m.sending {
+			m.cancel()
+			return m, nil
+		}
+		if m.resend != nil {
+			return m.updateConfirmation(msg)
+		}
+		switch m.view {
+		case viewRequests:
+			return m.updateRequests(msg)
+		case viewEnvironments:
+			return m.updateEnvironments(msg)
+		case viewDetail:
+			if m.saving {
+				return m.updateSave(msg)
+			}
+			if m.focus == focusResponse {
+				return m.updateResponse(msg)
+			}
+			return m.updateDetail(msg)
+		case viewHistory:
+			return m.updateHistory(msg)
+		case viewHistoryEntry:
+			return m.updateHistoryEntry(msg)
+		case viewNotes:
+			return m.updateNotes(msg)
+		case viewProjects:
+			return m.updateProjects(msg)
+		}
+	}
+	return m, nil
+}
+
+func (m *tuiModel) updateRequests(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if m.filtering {
+		switch msg.String() {
+		case "enter", "esc":
+			m.filtering = false
+			m.filter.Blur()
+			if msg.String() == "esc" {
+				m.filter.SetValue("")
+				m.applyFilter()
+			}
+			return m, nil
+		}
+		var cmd tea.Cmd
+		m.filter, cmd = m.filter.Update(msg)
+		m.applyFilter()
+		return m, cmd
+	}
+
+	switch msg.String() {
+	case "q":
+		return m, tea.Quit
+	case "up", "k":
+		if m.cursor > 0 {
+			m.cursor--
+		}
+	case "down", "j":
+		if m.cursor < len(m.filtered)-1 {
+			m.cursor++
+		}
+	case "/":
+		m.filtering = true
+		return m, m.filter.Focus()
+	case "e":
+		m.view = viewEnvironments
+	case "h":
+		m.openHistory()
+	case "p":
+		m.openProjects()
+	case "enter":
+		if len(m.filtered) > 0 {
+			return m, m.openRequest(m.filtered[m.cursor].Path)
+		}
+	}
+	return m, nil
+}
+
+// applyFilter narrows the request list to fuzzy matches of the filter,
+// best first, and moves the cursor to the top match.
+func (m *tuiModel) applyFilter() {
+	m.filtered = searchRequests(m.requests, m.filter.Value())
+	m.cursor = 0
+}
+
+func (m *tuiModel) updateEnvironments(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "up", "k":
+		if m.envCursor > 0 {
+			m.envCursor--
+		}
+	case "down", "j":
+		if m.envCursor < len(m.environments)-1 {
+			m.envCursor++
+		}
+	case "enter":
+		if len(m.environments) > 0 {
+			m.env = m.environments[m.envCursor]
+		}
+		m.view = viewRequests
+	case "esc", "q":
+		m.view = viewRequests
+	}
+	return m, nil
+}
+
+// openRequest loads a request into the editor, using the active body
+// template when one is set.
+func (m *tuiModel) openRequest(path string) tea.Cmd {
+	config, err := m.cm.LoadRequest(path)
+	if err != nil {
+		m.err = err
+		return nil
+	}
+	m.requestPath = path
+	m.config = config
+	m.method = strings.ToUpper(config.Method)
+	m.urlInput.SetValue(config.URL)
+	m.urlInput.CursorEnd()
+
+	body, file, err := m.cm.activeBody(path, config)
+	if err != nil {
+		m.err = err
+		return nil
+	}
+	m.bodyFile = file
+	m.bodyInput.SetValue(bodyPreview(file, body))
+
+	m.err = nil
+	m.result = nil
+	m.notice = ""
+	m.setResponseContent()
+	m.view = viewDetail
+	m.layout()
+	return m.setFocus(focusURL)
+}
+
+// sideBySide reports whether the request view puts the editor and the
+// response next to each other; narrower terminals stack them.
+func (m *tuiModel) sideBySide() bool {
+	return m.width >= sideBySideWidth
+}
+
+// paneSizes returns the width of the editor and response panes and the
+// height of each: the whole request view side by side, or a share of it
+// when stacked.
+func (m *tuiModel) paneSizes() (editorWidth, responseWidth, editorHeight, responseHeight int) {
+	// The header, status and help lines take four rows.
+	height := max(m.height-4, 8)
+	if m.sideBySide() {
+		editorWidth = (m.width - 3) / 2
+		return editorWidth, m.width - 3 - editorWidth, height, height
+	}
+	editorHeight = height * 2 / 5
+	return m.width, m.width, editorHeight, height - editorHeight - 1
+}
+
+// layout sizes the URL input, body editor and response viewport to their
+// panes; the body gets whatever height the URL and header list leave.
+func (m *tuiModel) layout() {
+	editorWidth, responseWidth, editorHeight, responseHeight := m.paneSizes()
+	m.urlInput.Width = max(editorWidth-9, 10)
+	m.bodyInput.SetWidth(max(editorWidth, 10))
+	used := 3
+	if m.config != nil && len(m.config.Headers) > 0 {
+		used += len(m.config.Headers) + 2
+	}
+	m.bodyInput.SetHeight(max(editorHeight-used, 3))
+	m.response.Width = responseWidth
+	m.response.Height = max(responseHeight-2, 1)
+}
+
+// setFocus moves the keyboard to the URL, the body or the response pane.
+func (m *tuiModel) setFocus(focus int) tea.Cmd {
+	m.focus = focus
+	m.urlInput.Blur()
+	m.bodyInput.Blur()
+	switch focus {
+	case focusURL:
+		return m.urlInput.Focus()
+	case focusBody:
+		return m.bodyInput.Focus()
+	}
+	return nil
+}
+
+func (m *tuiModel) updateDetail(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "esc":
+		m.view = viewRequests
+		return m, nil
+	case "tab":
+		return m, m.setFocus((m.focus + 1) % 3)
+	case "shift+tab":
+		return m, m.setFocus((m.focus + 2) % 3)
+	case "ctrl+t":
+		m.method = nextMethod(m.method, strings.ToUpper(m.config.Method))
+		return m, nil
+	case "ctrl+r":
+		return m, m.sendRequest(false)
+	case "ctrl+w":
+		return m, m.startSave()
+	case "ctrl+n":
+		m.openNotes()
+		return m, nil
+	}
+
+	var cmd tea.Cmd
+	if m.focus == focusURL {
+		m.urlInput, cmd = m.urlInput.Update(msg)
+	} else if !isBinaryBodyFile(m.bodyFile) {
+		m.bodyInput, cmd = m.bodyInput.Update(msg)
+	}
+	return m, cmd
+}
+
+// startSave asks where to save the edited request, offering its own path.
+func (m *tuiModel) startSave() tea.Cmd {
+	m.saving = true
+	m.notice = ""
+	m.saveInput.SetValue(m.requestPath)
+	m.saveInput.CursorEnd()
+	m.urlInput.Blur()
+	m.bodyInput.Blur()
+	return m.saveInput.Focus()
+}
+
+// updateSave edits the save path; enter writes the request there, to its
+// own file or as a copy, and esc goes back to editing.
+func (m *tuiModel) updateSave(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "esc":
+		m.saving = false
+		m.saveInput.Blur()
+		return m, m.setFocus(m.focus)
+	case "enter":
+		m.saving = false
+		m.saveInput.Blur()
+		path, err := m.cm.saveRequestEdits(m.requestPath, m.saveInput.Value(), m.method, m.urlInput.Value(), m.bodyInput.Value())
+		if err != nil {
+			m.notice = tuiErrorStyle.Render(err.Error())
+			return m, m.setFocus(m.focus)
+		}
+		m.notice = "✓ Saved " + path
+		if config, err := m.cm.LoadRequest(path); err == nil {
+			m.requestPath, m.config = path, config
+		}
+		if requests, err := m.cm.requestIndex(); err == nil {
+			m.requests = requests
+			m.applyFilter()
+		}
+		return m, m.setFocus(m.focus)
+	}
+	var cmd tea.Cmd
+	m.saveInput, cmd = m.saveInput.Update(msg)
+	return m, cmd
+}
+
+// nextMethod returns the method after method for ctrl+t to switch to: the
+// standard methods in turn, followed by the request's own method when it is
+// another one.
+func nextMethod(method, own string) string {
+	methods := httpMethods
+	if own != "" && !slices.Contains(httpMethods, own) {
+		methods = append(slices.Clone(httpMethods), own)
+	}
+	for i, candidate := range methods {
+		if candidate == method {
+			return methods[(i+1)%len(methods)]
+		}
+	}
+	return methods[0]
+}
+
+// sendRequest executes the edited request with the selected environment in
+// the background, cancelling a request still in flight; m.cancel aborts it.
+// The spinner runs until its responseMsg arrives.
+// confirmed sends it even if the environment asks for confirmation.
+func (m *tuiModel) sendRequest(confirmed bool) tea.Cmd {
+	if m.sending {
+		m.cancel()
+	}
+	cm, path, env := m.cm, m.requestPath, m.env
+	opts := RequestOptions{Method: m.method, URL: m.urlInput.Value(), Confirmed: confirmed}
+	if !isBinaryBodyFile(m.bodyFile) {
+		body := m.bodyInput.Value()
+		opts.Body, opts.BodyFile = &body, m.bodyFile
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	m.sendID++
+	id := m.sendID
+	m.sending, m.sentAt, m.cancel = true, time.Now(), cancel
+	send := func() tea.Msg {
+		result, err := cm.RunRequestContext(ctx, path, env, opts)
+		return responseMsg{id: id, result: result, err: err}
+	}
+	return tea.Batch(send, m.spinner.Tick)
+}
+
+// askConfirmation asks whether to send the request the environment wants
+// confirmed; updateConfirmation takes the answer.
+func (m *tuiModel) askConfirmation(confirm *ConfirmationRequiredError, msg responseMsg) {
+	m.resend = func() tea.Cmd { return m.sendRequest(true) }
+	if msg.replay {
+		m.resend = func() tea.Cmd { return m.replayHistory(msg.entry, true) }
+	}
+	m.notice = tuiErrorStyle.Render(fmt.Sprintf("⚠️  Send %s %s to %s?", confirm.Method, confirm.URL, confirm.Environment))
+}
+
+func (m *tuiModel) updateConfirmation(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	resend := m.resend
+	m.resend = nil
+	if msg.String() == "y" {
+		m.notice = ""
+		return m, resend()
+	}
+	m.notice = tuiDimStyle.Render("Not sent")
+	return m, nil
+}
+
+// sendingView shows the spinner and how long the request has been waiting.
+func (m *tuiModel) sendingView() string {
+	elapsed := time.Since(m.sentAt).Truncate(100 * time.Millisecond)
+	return m.spinner.View() + " Sending... " + tuiDimStyle.Render(fmt.Sprintf("%s  (esc to cancel)", elapsed))
+}
+
+// updateResponse scrolls the response pane while it has the focus.
+func (m *tuiModel) updateResponse(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	key := msg.String()
+	pendingG := m.pendingG
+	m.pendingG = false
+
+	switch key {
+	case "q":
+		return m, tea.Quit
+	case "esc", "backspace":
+		return m, m.setFocus(focusURL)
+	case "tab":
+		return m, m.setFocus(focusURL)
+	case "shift+tab":
+		return m, m.setFocus(focusBody)
+	case "ctrl+t":
+		m.method = nextMethod(m.method, strings.ToUpper(m.config.Method))
+		return m, nil
+	case "ctrl+r":
+		return m, m.sendRequest(false)
+	case "ctrl+w":
+		return m, m.startSave()
+	case "ctrl+n":
+		m.openNotes()
+		return m, nil
+	case "g":
+		if pendingG {
+			m.response.GotoTop()
+		} else {
+			m.pendingG = true
+		}
+		return m, nil
+	case "G":
+		m.response.GotoBottom()
+		return m, nil
+	case "home":
+		m.response.SetXOffset(0)
+		return m, nil
+	case "w":
+		if m.result != nil {
+			path, err := m.cm.dumpResponse(m.result)
+			if err != nil {
+				m.notice = tuiErrorStyle.Render(err.Error())
+			} else {
+				m.notice = "✓ Saved response to " + path
+			}
+		}
+		return m, nil
+	}
+
+	var cmd tea.Cmd
+	m.response, cmd = m.response.Update(msg)
+	return m, cmd
+}
+
+// setResponseContent loads the headers and the full, pretty-printed body of
+// the last response into the scrollable viewport.
+func (m *tuiModel) setResponseContent() {
+	if m.result == nil {
+		m.response.SetContent("")
+		return
+	}
+	var lines []string
+	for _, key := range sortedKeys(m.result.Headers) {
+		lines = append(lines, headerNameStyle.Render(key)+tuiDimStyle.Render(": "+strings.Join(m.result.Headers[key], ", ")))
+	}
+	lines = append(lines, "")
+	body := highlightBody(prettyBody(m.result.Body, m.result.Headers.Get("Content-Type")), m.result.Headers.Get("Content-Type"))
+	lines = append(lines, strings.Split(body, "\n")...)
+	m.response.SetContent(strings.Join(lines, "\n"))
+	m.response.GotoTop()
+	m.response.SetXOffset(0)
+}
+
+// dumpResponse writes the raw response body to .api-man/responses/ and
+// returns the file's path relative to the workspace.
+func (cm *ConfigManager) dumpResponse(result *ExecutionResult) (string, error) {
+	path, err := cm.SaveResponse(result, filepath.Join(cm.stateDir(), "responses")+string(filepath.Separator))
+	if err != nil {
+		return "", err
+	}
+	if rel, err := filepath.Rel(cm.configDir, path); err == nil {
+		return rel, nil
+	}
+	return path, nil
+}
+
+func (m *tuiModel) View() string {
+	var content, help string
+	switch m.view {
+	case viewRequests:
+		content = m.requestsView()
+		help = "↑/↓ move • enter open • / filter • e environment • h history • p project • q quit"
+	case viewEnvironments:
+		content = m.environmentsView()
+		help = "↑/↓ move • enter select • esc back"
+	case viewDetail:
+		content = m.detailView()
+		help = "tab next pane • ctrl+t method • ctrl+r send • ctrl+w save request • ctrl+n notes • esc back"
+		switch {
+		case m.saving:
+			help = "enter save • esc cancel"
+		case m.focus == focusResponse:
+			help = "↑/↓/pgup/pgdn scroll • gg/G top/bottom • ←/→ pan • w save to file • ctrl+r resend • tab/esc edit • q quit"
+		}
+	case viewHistory:
+		content = m.historyView()
+		help = "↑/↓ move • enter show • r resend • esc back • q quit"
+	case viewHistoryEntry:
+		content = m.historyEntryView()
+		help = "↑/↓/pgup/pgdn scroll • ←/→ pan • r resend • esc back • q quit"
+	case viewNotes:
+		content = m.notesView()
+		help = "↑/↓/pgup/pgdn scroll • e edit in $EDITOR • esc back • q quit"
+	case viewProjects:
+		content = m.projectsView()
+		help = "↑/↓ move • enter switch • esc back"
+	}
+	if m.resend != nil {
+		help = "y send • any other key cancels"
+	}
+	return content + "\n" + tuiDimStyle.Render(help)
+}
+
+func (m *tuiModel) header(title string) string {
+	env := m.env
+	if env == "" {
+		env = "none"
+	}
+	context := "env: " + env
+	if m.project != "" {
+		context = "project: " + m.project + "  " + context
+	}
+	return tuiTitleStyle.Render("API-Man") + "  " + title + "  " + tuiDimStyle.Render(context) + "\n\n"
+}
+
+// listWindow returns the [start, end) range of a list of n items that keeps
+// cursor visible within height rows.
+func listWindow(n, cursor, height int) (int, int) {
+	if height <= 0 || n <= height {
+		return 0, n
+	}
+	start := max(cursor-height/2, 0)
+	end := min(start+height, n)
+	return end - height, end
+}
+
+func (m *tuiModel) requestsView() string {
+	var b strings.Builder
+	b.WriteString(m.header("Requests"))
+	if m.filtering || m.filter.Value() != "" {
+		b.WriteString(m.filter.View() + "\n\n")
+	}
+	switch {
+	case len(m.requests) == 0:
+		b.WriteString(tuiDimStyle.Render("No requests found. Run api-man generate or api-man import to add some.") + "\n")
+		return b.String()
+	case len(m.filtered) == 0:
+		b.WriteString(tuiDimStyle.Render("No requests match.") + "\n")
+		return b.String()
+	}
+
+	start, end := listWindow(len(m.filtered), m.cursor, m.height-6)
+	for i := start; i < end; i++ {
+		entry := m.filtered[i]
+		if i == m.cursor {
+			b.WriteString(tuiSelectedStyle.Render(fmt.Sprintf("> %-7s %s", entry.Method, entry.Path)) + "\n")
+		} else {
+			b.WriteString("  " + methodStyle(entry.Method).Render(fmt.Sprintf("%-7s", entry.Method)) + " " + entry.Path + "\n")
+		}
+	}
+	if m.err != nil {
+		b.WriteString("\n" + tuiErrorStyle.Render(m.err.Error()) + "\n")
+	}
+	return b.String()
+}
+
+func (m *tuiModel) environmentsView() string {
+	var b strings.Builder
+	b.WriteString(m.header("Select environment"))
+	if len(m.environments) == 0 {
+		b.WriteString(tuiDimStyle.Render("No environments found in environments/.") + "\n")
+	}
+	for i, name := range m.environments {
+		marker := "  "
+		if name == m.env {
+			marker = "* "
+		}
+		if i == m.envCursor {
+			b.WriteString(tuiSelectedStyle.Render(marker+name) + "\n")
+		} else {
+			b.WriteString(marker + name + "\n")
+		}
+	}
+	return b.String()
+}
+
+// detailView renders the request editor and the last response as two panes,
+// side by side on wide terminals and stacked otherwise. The focused pane's
+// title is highlighted.
+func (m *tuiModel) detailView() string {
+	editorWidth, responseWidth, editorHeight, responseHeight := m.paneSizes()
+
+	var editor strings.Builder
+	editor.WriteString(methodStyle(m.method).Render(fmt.Sprintf("%-7s", m.method)) + " " + m.urlInput.View() + "\n\n")
+	if len(m.config.Headers) > 0 {
+		editor.WriteString(tuiLabelStyle.Render("Headers") + "\n")
+		for _, key := range sortedKeys(m.config.Headers) {
+			editor.WriteString(tuiDimStyle.Render(fmt.Sprintf("  %s: %s", key, m.config.Headers[key])) + "\n")
+		}
+		editor.WriteString("\n")
+	}
+	editor.WriteString(m.paneTitle("Body", m.focus == focusBody) + "\n")
+	editor.WriteString(m.bodyInput.View())
+
+	editorPane := fitLines(editor.String(), editorWidth, editorHeight)
+	responsePane := fitLines(m.responsePane(), responseWidth, responseHeight)
+
+	var b strings.Builder
+	b.WriteString(m.header(m.requestPath))
+	if m.sideBySide() {
+		for i := range editorPane {
+			b.WriteString(editorPane[i] + tuiDimStyle.Render(" │ ") + responsePane[i] + "\n")
+		}
+	} else {
+		b.WriteString(strings.Join(editorPane, "\n") + "\n")
+		b.WriteString(tuiDimStyle.Render(strings.Repeat("─", m.width)) + "\n")
+		b.WriteString(strings.Join(responsePane, "\n") + "\n")
+	}
+	if m.saving {
+		b.WriteString(m.saveInput.View())
+	} else {
+		b.WriteString(m.notice)
+	}
+	return b.String()
+}
+
+// paneTitle renders a pane's title, highlighted while the pane has focus.
+func (m *tuiModel) paneTitle(title string, focused bool) string {
+	if focused {
+		return tuiSelectedStyle.Render(" " + title + " ")
+	}
+	return tuiLabelStyle.Render(title)
+}
+
+// responsePane renders the last response: a status line, then the headers
+// and body scrolling in the response viewport.
+func (m *tuiModel) responsePane() string {
+	var b strings.Builder
+	b.WriteString(m.paneTitle("Response", m.focus == focusResponse) + "  ")
+	if m.sending {
+		b.WriteString(m.sendingView() + "\n")
+		return b.String()
+	}
+	var cancelled *CancelledError
+	if errors.As(m.err, &cancelled) {
+		b.WriteString(tuiErrorStyle.Render("✗ Cancelled") + tuiDimStyle.Render(fmt.Sprintf("  after %s", cancelled.Elapsed.Round(time.Millisecond))) + "\n")
+		return b.String()
+	}
+	if m.err != nil {
+		b.WriteString(tuiErrorStyle.Render("Error: "+m.err.Error()) + "\n")
+		return b.String()
+	}
+	if m.result == nil {
+		b.WriteString(tuiDimStyle.Render("ctrl+r to send") + "\n")
+		return b.String()
+	}
+
+	b.WriteString(statusStyle(m.result.StatusCode).Render(m.result.Status))
+	if m.result.OverBudget() {
+		b.WriteString("  " + budgetStyle.Render("⚠️  "+m.result.budgetNote()))
+	} else {
+		b.WriteString(tuiDimStyle.Render(fmt.Sprintf("  %dms", m.result.DurationMS())))
+	}
+	if !m.response.AtTop() || !m.response.AtBottom() {
+		b.WriteString(tuiDimStyle.Render(fmt.Sprintf("  %3.f%%", m.response.ScrollPercent()*100)))
+	}
+	b.WriteString("\n\n")
+	b.WriteString(m.response.View())
+	return b.String()
+}
+
+// fitLines cuts or pads s to exactly height lines of width columns, so
+// panes line up whatever they contain.
+func fitLines(s string, width, height int) []string {
+	lines := strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+	fitted := make([]string, height)
+	truncate := lipgloss.NewStyle().MaxWidth(width)
+	for i := range fitted {
+		line := ""
+		if i < len(lines) {
+			line = truncate.Render(lines[i])
+		}
+		fitted[i] = line + strings.Repeat(" ", max(width-lipgloss.Width(line), 0))
+	}
+	return fitted
+}
+
+func methodStyle(method string) lipgloss.Style {
+	color, ok := methodColors[strings.ToUpper(method)]
+	if !ok {
+		color = "208"
+	}
+	return lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color(color))
+}
+
+func statusStyle(code int) lipgloss.Style {
+	color := "10"
+	switch {
+	case code >= 500:
+		color = "9"
+	case code >= 400:
+		color = "11"
+	case code >= 300:
+		color = "14"
+	}
+	return lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color(color))
+}
+
+// prettyBody indents JSON bodies keeping their key order, and formats
+// anything else by its content type.
+func prettyBody(body []byte, contentType string) string {
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, body, "", "  "); err == nil {
+		return buf.String()
+	}
+	return formatResponseBody(body, contentType)
+}
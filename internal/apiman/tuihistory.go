@@ -0,0 +1,195 @@
+// tuihistory.go
+package apiman
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// The TUI's history pane lists the latest executions stored in
+// .api-man/history.db, newest first, with the ones from this session marked.
+// An entry opens to the full request and response, and r sends it again.
+
+// tuiHistoryLimit is the number of entries the history pane lists.
+const tuiHistoryLimit = 500
+
+// openHistory loads the stored history into the history list.
+func (m *tuiModel) openHistory() {
+	entries, err := m.cm.ListHistory(tuiHistoryLimit)
+	m.history, m.err = entries, err
+	m.historyCursor = 0
+	m.notice = ""
+	m.view = viewHistory
+}
+
+func (m *tuiModel) updateHistory(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "q":
+		return m, tea.Quit
+	case "esc", "h":
+		m.err = nil
+		m.view = viewRequests
+	case "up", "k":
+		if m.historyCursor > 0 {
+			m.historyCursor--
+		}
+	case "down", "j":
+		if m.historyCursor < len(m.history)-1 {
+			m.historyCursor++
+		}
+	case "enter":
+		if len(m.history) > 0 {
+			m.showHistoryEntry(m.history[m.historyCursor])
+		}
+	case "r":
+		if len(m.history) > 0 {
+			return m, m.replayHistory(m.history[m.historyCursor], false)
+		}
+	}
+	return m, nil
+}
+
+func (m *tuiModel) updateHistoryEntry(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "q":
+		return m, tea.Quit
+	case "esc", "backspace":
+		m.notice = ""
+		m.view = viewHistory
+		return m, nil
+	case "r":
+		return m, m.replayHistory(m.historyEntry, false)
+	}
+	var cmd tea.Cmd
+	m.historyDetail, cmd = m.historyDetail.Update(msg)
+	return m, cmd
+}
+
+// showHistoryEntry loads what entry sent and received into the scrollable
+// history detail viewport.
+func (m *tuiModel) showHistoryEntry(entry *HistoryEntry) {
+	m.historyEntry = entry
+	var lines []string
+	lines = append(lines, tuiLabelStyle.Render(entry.Method)+" "+entry.URL)
+	for _, key := range sortedKeys(entry.RequestHeaders) {
+		lines = append(lines, headerNameStyle.Render(key)+tuiDimStyle.Render(": "+strings.Join(entry.RequestHeaders[key], ", ")))
+	}
+	if entry.RequestBody != "" {
+		contentType := entry.RequestHeaders.Get("Content-Type")
+		lines = append(lines, "")
+		lines = append(lines, strings.Split(highlightBody(prettyBody([]byte(entry.RequestBody), contentType), contentType), "\n")...)
+	}
+	lines = append(lines, "", strings.Repeat("─", max(m.width, 10)), "")
+	if entry.Error != "" {
+		lines = append(lines, tuiErrorStyle.Render("Error: "+entry.Error))
+	} else {
+		lines = append(lines, statusStyle(entry.StatusCode).Render(entry.Status)+tuiDimStyle.Render(fmt.Sprintf("  %dms", entry.DurationMS)))
+		for _, key := range sortedKeys(entry.Headers) {
+			lines = append(lines, headerNameStyle.Render(key)+tuiDimStyle.Render(": "+strings.Join(entry.Headers[key], ", ")))
+		}
+		contentType := entry.Headers.Get("Content-Type")
+		lines = append(lines, "")
+		lines = append(lines, strings.Split(highlightBody(prettyBody([]byte(entry.Body), contentType), contentType), "\n")...)
+	}
+	m.historyDetail.SetContent(strings.Join(lines, "\n"))
+	m.historyDetail.GotoTop()
+	m.historyDetail.SetXOffset(0)
+	m.view = viewHistoryEntry
+}
+
+// replayHistory sends entry again in the background like sendRequest; the
+// new execution is shown once its responseMsg arrives.
+func (m *tuiModel) replayHistory(entry *HistoryEntry, confirmed bool) tea.Cmd {
+	if m.sending {
+		m.cancel()
+	}
+	cm := m.cm
+	ctx, cancel := context.WithCancel(context.Background())
+	m.sendID++
+	id := m.sendID
+	m.sending, m.sentAt, m.cancel = true, time.Now(), cancel
+	m.notice = ""
+	replay := func() tea.Msg {
+		result, err := cm.ReplayHistory(ctx, entry, confirmed)
+		return responseMsg{id: id, result: result, err: err, replay: true, entry: entry}
+	}
+	return tea.Batch(replay, m.spinner.Tick)
+}
+
+// finishReplay reloads the history, which now starts with the replayed
+// execution, and opens it.
+func (m *tuiModel) finishReplay(err error) {
+	m.openHistory()
+	if err != nil {
+		m.notice = tuiErrorStyle.Render(err.Error())
+		return
+	}
+	if len(m.history) > 0 {
+		m.showHistoryEntry(m.history[0])
+	}
+}
+
+func (m *tuiModel) historyView() string {
+	var b strings.Builder
+	b.WriteString(m.header("History"))
+	if m.sending {
+		b.WriteString(m.sendingView() + "\n\n")
+	}
+	if m.err != nil {
+		b.WriteString(tuiErrorStyle.Render(m.err.Error()) + "\n")
+		return b.String()
+	}
+	if len(m.history) == 0 {
+		b.WriteString(tuiDimStyle.Render("No history yet. Executed requests are recorded in .api-man/history.db.") + "\n")
+		return b.String()
+	}
+
+	start, end := listWindow(len(m.history), m.historyCursor, m.height-6)
+	for i := start; i < end; i++ {
+		entry := m.history[i]
+		// Entries from this session are marked with a dot.
+		marker := "  "
+		if !entry.Timestamp.Before(m.sessionStart) {
+			marker = "• "
+		}
+		status := entry.Status
+		if entry.Error != "" {
+			status = "error"
+		}
+		rest := fmt.Sprintf("%-40s %-16s %6dms", truncateForDisplay(entry.Label(), 40), truncateForDisplay(status, 16), entry.DurationMS)
+		method := fmt.Sprintf("%-7s", entry.Method)
+		timestamp := entry.Timestamp.Local().Format("15:04:05")
+		if i == m.historyCursor {
+			b.WriteString(tuiSelectedStyle.Render(marker+timestamp+" "+method+" "+rest) + "\n")
+		} else {
+			b.WriteString(marker + timestamp + " " + methodStyle(entry.Method).Render(method) + " " + rest + "\n")
+		}
+	}
+	if m.notice != "" {
+		b.WriteString("\n" + m.notice + "\n")
+	}
+	return b.String()
+}
+
+func (m *tuiModel) historyEntryView() string {
+	var b strings.Builder
+	entry := m.historyEntry
+	b.WriteString(m.header(entry.Label()))
+	if m.sending {
+		b.WriteString(m.sendingView() + "\n")
+		return b.String()
+	}
+	b.WriteString(tuiDimStyle.Render(entry.Timestamp.Local().Format("2006-01-02 15:04:05")))
+	if entry.Environment != "" {
+		b.WriteString(tuiDimStyle.Render("  env: " + entry.Environment))
+	}
+	b.WriteString("\n\n" + m.historyDetail.View() + "\n")
+	if m.notice != "" {
+		b.WriteString(m.notice + "\n")
+	}
+	return b.String()
+}
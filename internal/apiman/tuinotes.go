@@ -0,0 +1,123 @@
+// tuinotes.go
+package apiman
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// ctrl+n in the request view opens the request's notes.md with the names
+// of its saved examples; e edits the notes in $EDITOR, suspending the TUI
+// until the editor exits.
+
+// notesEditedMsg reports the end of an editor session on a request's notes.
+type notesEditedMsg struct {
+	changed bool
+	err     error
+}
+
+// openNotes loads the notes of the open request into the notes viewport.
+func (m *tuiModel) openNotes() {
+	notes, err := m.cm.LoadNotes(m.requestPath)
+	if err != nil {
+		m.notice = tuiErrorStyle.Render(err.Error())
+		return
+	}
+	m.notesText = notes
+
+	var lines []string
+	if notes == "" {
+		lines = append(lines, tuiDimStyle.Render("No notes yet. Press e to write some in notes.md."))
+	}
+	for _, line := range strings.Split(strings.TrimRight(notes, "\n"), "\n") {
+		if strings.HasPrefix(line, "#") {
+			line = tuiLabelStyle.Render(line)
+		}
+		lines = append(lines, line)
+	}
+	if examples, err := m.cm.ListExamples(m.requestPath); err == nil && len(examples) > 0 {
+		lines = append(lines, "", strings.Repeat("─", max(m.width, 10)), "", tuiLabelStyle.Render("Examples"))
+		for _, example := range examples {
+			lines = append(lines, fmt.Sprintf("  %-20s ", example.Name)+statusStyle(example.StatusCode).Render(example.Status)+
+				tuiDimStyle.Render("  "+example.Timestamp.Local().Format("2006-01-02")))
+		}
+	}
+	m.notes.SetContent(strings.Join(lines, "\n"))
+	m.notes.GotoTop()
+	m.view = viewNotes
+}
+
+func (m *tuiModel) updateNotes(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "q":
+		return m, tea.Quit
+	case "esc", "backspace", "ctrl+n":
+		m.notice = ""
+		m.view = viewDetail
+		return m, nil
+	case "e":
+		return m, m.editNotes()
+	}
+	var cmd tea.Cmd
+	m.notes, cmd = m.notes.Update(msg)
+	return m, cmd
+}
+
+// editNotes opens the notes in the user's editor through a temporary file
+// and saves them when they changed.
+func (m *tuiModel) editNotes() tea.Cmd {
+	file, err := os.CreateTemp("", "api-man-notes-*.md")
+	if err == nil {
+		_, err = file.WriteString(m.notesText)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		m.notice = tuiErrorStyle.Render(fmt.Sprintf("writing temporary file: %v", err))
+		return nil
+	}
+	cm, path, notes, name := m.cm, m.requestPath, m.notesText, file.Name()
+	editor := editorCommand()
+	cmd := exec.Command(editor[0], append(editor[1:], name)...)
+	return tea.ExecProcess(cmd, func(err error) tea.Msg {
+		defer os.Remove(name)
+		if err != nil {
+			return notesEditedMsg{err: fmt.Errorf("running editor %s: %w", editor[0], err)}
+		}
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return notesEditedMsg{err: fmt.Errorf("reading edited file: %w", err)}
+		}
+		if string(data) == notes {
+			return notesEditedMsg{}
+		}
+		return notesEditedMsg{changed: true, err: cm.SaveNotes(path, string(data))}
+	})
+}
+
+// finishNotesEdit shows the notes as saved, or why they weren't.
+func (m *tuiModel) finishNotesEdit(msg notesEditedMsg) {
+	switch {
+	case msg.err != nil:
+		m.notice = tuiErrorStyle.Render(msg.err.Error())
+		return
+	case msg.changed:
+		m.notice = "✓ Saved notes"
+	default:
+		m.notice = "No changes to notes"
+	}
+	m.openNotes()
+}
+
+func (m *tuiModel) notesView() string {
+	var b strings.Builder
+	b.WriteString(m.header(m.requestPath + " · notes"))
+	b.WriteString(m.notes.View() + "\n")
+	b.WriteString(m.notice)
+	return b.String()
+}
@@ -0,0 +1,127 @@
+// tuiprojects.go
+package apiman
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// p in the request list opens the project switcher, which lists the
+// projects of api-man project add. Picking one reopens the TUI on its
+// workspace for the rest of the session; the current project of api-man
+// project use is left alone.
+
+// openProjects loads the project registry into the switcher.
+func (m *tuiModel) openProjects() {
+	registry, err := LoadProjects()
+	if err != nil {
+		m.err = err
+		return
+	}
+	m.projects = registry.List()
+	m.projectCursor = 0
+	for i, project := range m.projects {
+		if project.Name == m.project {
+			m.projectCursor = i
+		}
+	}
+	m.err = nil
+	m.view = viewProjects
+}
+
+func (m *tuiModel) updateProjects(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "up", "k":
+		if m.projectCursor > 0 {
+			m.projectCursor--
+		}
+	case "down", "j":
+		if m.projectCursor < len(m.projects)-1 {
+			m.projectCursor++
+		}
+	case "enter":
+		if len(m.projects) > 0 {
+			if err := m.switchProject(m.projects[m.projectCursor]); err != nil {
+				m.err = err
+				return m, nil
+			}
+		}
+		m.view = viewRequests
+	case "esc", "q":
+		m.err = nil
+		m.view = viewRequests
+	}
+	return m, nil
+}
+
+// switchProject points the TUI at project's workspace, reloading its
+// requests and environments and keeping the environment selected when the
+// new workspace has one of that name.
+func (m *tuiModel) switchProject(project Project) error {
+	if project.Missing {
+		return fmt.Errorf("project %s: %s is not an api-man workspace anymore", project.Name, project.Dir)
+	}
+	cm, err := OpenWorkspace(project.Dir)
+	if err != nil {
+		return fmt.Errorf("opening project %s: %w", project.Name, err)
+	}
+	cm.assumeYes = m.cm.assumeYes
+	requests, err := cm.requestIndex()
+	if err != nil {
+		return fmt.Errorf("listing requests: %w", err)
+	}
+	environments, err := cm.ListEnvironments()
+	if err != nil {
+		return fmt.Errorf("listing environments: %w", err)
+	}
+
+	m.cm = cm
+	m.project = project.Name
+	m.requests = requests
+	m.filter.SetValue("")
+	m.filtered = requests
+	m.cursor = 0
+	m.environments = environments
+	if !slices.Contains(environments, m.env) {
+		m.env = defaultEnvironment(environments)
+	}
+	m.envCursor = 0
+	for i, name := range environments {
+		if name == m.env {
+			m.envCursor = i
+		}
+	}
+	m.history = nil
+	m.err = nil
+	return nil
+}
+
+func (m *tuiModel) projectsView() string {
+	var b strings.Builder
+	b.WriteString(m.header("Switch project"))
+	if len(m.projects) == 0 {
+		b.WriteString(tuiDimStyle.Render("No projects. Add one with api-man project add <name> [dir].") + "\n")
+	}
+	for i, project := range m.projects {
+		marker := "  "
+		if project.Name == m.project {
+			marker = "* "
+		}
+		line := fmt.Sprintf("%s%-20s %s", marker, project.Name, project.Dir)
+		switch {
+		case i == m.projectCursor:
+			b.WriteString(tuiSelectedStyle.Render(line) + "\n")
+		case project.Missing:
+			b.WriteString(tuiDimStyle.Render(line+"  ✗ not a workspace") + "\n")
+		default:
+			b.WriteString(line + "\n")
+		}
+	}
+	if m.err != nil {
+		b.WriteString("\n" + tuiErrorStyle.Render(m.err.Error()) + "\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,124 @@
+// validate.go
+package apiman
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"strconv"
+	"strings"
+)
+
+// ErrNoSchema is returned when validating a request that wasn't generated
+// from an OpenAPI spec.
+var ErrNoSchema = errors.New("request has no OpenAPI schema (generate it with api-man generate)")
+
+// ValidateResponse checks a response's status, content type and body
+// against the responses documented for the request, returning a
+// description of each mismatch.
+func ValidateResponse(schema *RequestSchema, result *ExecutionResult) ([]string, error) {
+	if schema == nil || len(schema.Responses) == 0 {
+		return nil, ErrNoSchema
+	}
+
+	key, response, ok := documentedResponse(schema.Responses, result.StatusCode)
+	if !ok {
+		return []string{fmt.Sprintf("status %d is not documented (documented: %s)",
+			result.StatusCode, strings.Join(sortedKeys(schema.Responses), ", "))}, nil
+	}
+
+	var problems []string
+	contentType := result.Headers.Get("Content-Type")
+	if len(response.ContentTypes) > 0 && len(result.Body) > 0 && !contentTypeDocumented(response.ContentTypes, contentType) {
+		problems = append(problems, fmt.Sprintf("content type %q is not documented for %s (expected %s)",
+			contentType, key, strings.Join(response.ContentTypes, ", ")))
+	}
+	if response.Body != nil && (contentType == "" || isJSONContentType(contentType)) {
+		var body interface{}
+		if err := json.Unmarshal(result.Body, &body); err != nil {
+			problems = append(problems, fmt.Sprintf("body is not JSON: %v", err))
+		} else {
+			for _, violation := range validateSchema(response.Body, body) {
+				problems = append(problems, violation.String())
+			}
+		}
+	}
+	return problems, nil
+}
+
+// documentedResponse finds the response documented for status: an exact
+// code first, then a range such as "2XX", then "default".
+func documentedResponse(responses map[string]ResponseSchema, status int) (string, ResponseSchema, bool) {
+	code := strconv.Itoa(status)
+	for _, key := range []string{code, code[:1] + "XX", code[:1] + "xx", "default"} {
+		if response, ok := responses[key]; ok {
+			return key, response, true
+		}
+	}
+	return "", ResponseSchema{}, false
+}
+
+// contentTypeDocumented reports whether contentType matches one of the
+// documented media types, which may use wildcards like "text/*".
+func contentTypeDocumented(documented []string, contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = strings.ToLower(strings.TrimSpace(contentType))
+	}
+	for _, candidate := range documented {
+		candidate, _, _ = strings.Cut(strings.ToLower(candidate), ";")
+		candidate = strings.TrimSpace(candidate)
+		prefix, isWildcard := strings.CutSuffix(candidate, "/*")
+		switch {
+		case candidate == "*/*", candidate == mediaType:
+			return true
+		case isWildcard && strings.HasPrefix(mediaType, prefix+"/"):
+			return true
+		}
+	}
+	return false
+}
+
+// BodySchemaError reports a request body that doesn't match the schema of
+// the OpenAPI operation it was generated from.
+type BodySchemaError struct {
+	Problems []string
+}
+
+func (e *BodySchemaError) Error() string {
+	return fmt.Sprintf("request body does not match the OpenAPI schema (use --force to send it anyway):\n    %s",
+		strings.Join(e.Problems, "\n    "))
+}
+
+// validateRequestBody checks an interpolated body against the request's
+// body schema, returning a *BodySchemaError if it doesn't match. Requests
+// without a body schema, and empty bodies, aren't checked.
+func validateRequestBody(schema *RequestSchema, body string) error {
+	if schema == nil || schema.Body == nil || strings.TrimSpace(body) == "" {
+		return nil
+	}
+	var value interface{}
+	if err := json.Unmarshal([]byte(body), &value); err != nil {
+		return &BodySchemaError{Problems: []string{fmt.Sprintf("body is not JSON: %v", err)}}
+	}
+	violations := validateSchema(schema.Body, value)
+	if len(violations) == 0 {
+		return nil
+	}
+	problems := make([]string, len(violations))
+	for i, violation := range violations {
+		problems[i] = violation.String()
+	}
+	return &BodySchemaError{Problems: problems}
+}
+
+// schemaAssertion reports response validation as a test assertion.
+func schemaAssertion(schema *RequestSchema, result *ExecutionResult) AssertionResult {
+	name := "response matches OpenAPI schema"
+	problems, err := ValidateResponse(schema, result)
+	if err != nil {
+		return AssertionResult{Name: name, Message: err.Error()}
+	}
+	return check(name, len(problems) == 0, "%s", strings.Join(problems, "; "))
+}
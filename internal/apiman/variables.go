@@ -0,0 +1,103 @@
+// variables.go
+package apiman
+
+import (
+	"maps"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// placeholderPattern matches {{name}} placeholders, allowing whitespace
+// inside the braces.
+var placeholderPattern = regexp.MustCompile(`\{\{\s*([^{}\s]+)\s*\}\}`)
+
+// interpolate replaces every {{key}} placeholder in s with its value from
+// vars, then evaluates template functions such as {{uuid}} (see
+// templateFunctions), including those in the substituted values.
+func interpolate(s string, vars map[string]string) string {
+	return expandFunctions(substitute(s, vars))
+}
+
+// interpolateUntrusted is interpolate for text sent by a caller who mustn't
+// read the process environment: {{env.NAME}} is only filled from vars.
+func interpolateUntrusted(s string, vars map[string]string) string {
+	return expandFunctions(substitutePlaceholders(s, vars, false))
+}
+
+// substitute replaces every {{key}} placeholder in s with its value from
+// vars. {{env.NAME}} reads the NAME variable from the process environment
+// unless vars defines "env.NAME" itself. Unknown placeholders are left
+// untouched so they stay visible.
+func substitute(s string, vars map[string]string) string {
+	return substitutePlaceholders(s, vars, true)
+}
+
+func substitutePlaceholders(s string, vars map[string]string, processEnv bool) string {
+	if !strings.Contains(s, "{{") {
+		return s
+	}
+	return placeholderPattern.ReplaceAllStringFunc(s, func(match string) string {
+		key := placeholderPattern.FindStringSubmatch(match)[1]
+		if value, ok := vars[key]; ok {
+			return value
+		}
+		if name, ok := strings.CutPrefix(key, "env."); ok && processEnv {
+			if value, ok := os.LookupEnv(name); ok {
+				return value
+			}
+		}
+		return match
+	})
+}
+
+// interpolateMap returns a copy of m with every value interpolated.
+func interpolateMap(m map[string]string, vars map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	out := make(map[string]string, len(m))
+	for key, value := range m {
+		out[key] = interpolate(value, vars)
+	}
+	return out
+}
+
+// interpolateEnvironment returns a copy of env whose header, cookie and auth
+// values have their placeholders resolved against vars. Auth values only get
+// variables substituted: auth types such as jwt evaluate their own helpers.
+func interpolateEnvironment(env *Environment, vars map[string]string) *Environment {
+	resolved := *env
+	resolved.vars = vars
+	resolved.BaseURL = interpolate(env.BaseURL, vars)
+	resolved.Headers = interpolateMap(env.Headers, vars)
+	resolved.Cookies = interpolateMap(env.Cookies, vars)
+	if env.Auth != nil {
+		resolved.Auth = make(map[string]string, len(env.Auth))
+		for key, value := range env.Auth {
+			resolved.Auth[key] = substitute(value, vars)
+		}
+	}
+	resolved.HTTPProxy = interpolate(env.HTTPProxy, vars)
+	resolved.HTTPSProxy = interpolate(env.HTTPSProxy, vars)
+	resolved.CACertFile = interpolate(env.CACertFile, vars)
+	resolved.ClientCertFile = interpolate(env.ClientCertFile, vars)
+	resolved.ClientKeyFile = interpolate(env.ClientKeyFile, vars)
+	resolved.ConnectTo = interpolate(env.ConnectTo, vars)
+	if env.Tracing != nil {
+		tracing := *env.Tracing
+		tracing.Endpoint = interpolate(tracing.Endpoint, vars)
+		tracing.Headers = interpolateMap(tracing.Headers, vars)
+		resolved.Tracing = &tracing
+	}
+	return &resolved
+}
+
+// mergeVariables layers each map over the previous ones; later maps win.
+func mergeVariables(layers ...map[string]string) map[string]string {
+	merged := make(map[string]string)
+	for _, layer := range layers {
+		maps.Copy(merged, layer)
+	}
+	return merged
+}
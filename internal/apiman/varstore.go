@@ -0,0 +1,158 @@
+// varstore.go
+package apiman
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// The variable store keeps values extracted from responses, one file per
+// environment under .api-man/variables/. Stored values are layered over the
+// environment's own variables on later runs, so a login request can feed
+// {{token}} to every request after it.
+
+func (cm *ConfigManager) variableStorePath(envName string) string {
+	return filepath.Join(cm.stateDir(), "variables", sanitizeRequestPathSegment(envName)+".json")
+}
+
+// StoredVariables returns the values stored for envName.
+func (cm *ConfigManager) StoredVariables(envName string) (map[string]string, error) {
+	data, err := os.ReadFile(cm.variableStorePath(envName))
+	if errors.Is(err, os.ErrNotExist) {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading variable store: %w", err)
+	}
+	values := map[string]string{}
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, fmt.Errorf("parsing variable store: %w", err)
+	}
+	return values, nil
+}
+
+// StoreVariables adds values to envName's store, replacing any with the
+// same name.
+func (cm *ConfigManager) StoreVariables(envName string, values map[string]string) error {
+	unlock, err := cm.lockState("variables-" + envName)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	stored, err := cm.StoredVariables(envName)
+	if err != nil {
+		return err
+	}
+	return cm.writeVariableStore(envName, mergeVariables(stored, values))
+}
+
+// ClearStoredVariables removes names from envName's store, or everything
+// when no names are given.
+func (cm *ConfigManager) ClearStoredVariables(envName string, names ...string) error {
+	if len(names) == 0 {
+		if err := os.Remove(cm.variableStorePath(envName)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("removing variable store: %w", err)
+		}
+		return nil
+	}
+	unlock, err := cm.lockState("variables-" + envName)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	stored, err := cm.StoredVariables(envName)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if _, ok := stored[name]; !ok {
+			return fmt.Errorf("variable %q is not stored for environment %q", name, envName)
+		}
+		delete(stored, name)
+	}
+	return cm.writeVariableStore(envName, stored)
+}
+
+func (cm *ConfigManager) writeVariableStore(envName string, values map[string]string) error {
+	path := cm.variableStorePath(envName)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("creating variable store directory: %w", err)
+	}
+	data, err := json.MarshalIndent(values, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding variable store: %w", err)
+	}
+	// Extracted values are often tokens, so keep them private.
+	if err := writeFileAtomic(path, data, 0600); err != nil {
+		return fmt.Errorf("writing variable store: %w", err)
+	}
+	return nil
+}
+
+// extractVariables evaluates extraction rules against a response. A rule is
+// a JSONPath expression ("$.token") evaluated against the JSON body,
+// "query:<jq expression>" run against it, "header:<Name>" for a response
+// header, "regex:<pattern>" matched against the body, taking the first
+// capture group if there is one, or "js:<expression>" (see scriptScope).
+// The values extracted before a failing rule are returned with the error.
+func extractVariables(result *ExecutionResult, extract map[string]string) (map[string]string, error) {
+	var doc interface{}
+	var docErr error
+	parsed := false
+	extracted := make(map[string]string, len(extract))
+	for _, name := range sortedKeys(extract) {
+		rule := extract[name]
+		switch {
+		case strings.HasPrefix(rule, "header:"):
+			header := strings.TrimSpace(strings.TrimPrefix(rule, "header:"))
+			values := result.Headers.Values(header)
+			if len(values) == 0 {
+				return extracted, fmt.Errorf("extracting %s: response has no %s header", name, header)
+			}
+			extracted[name] = values[0]
+		case strings.HasPrefix(rule, "regex:"):
+			re, err := regexp.Compile(strings.TrimPrefix(rule, "regex:"))
+			if err != nil {
+				return extracted, fmt.Errorf("extracting %s: %w", name, err)
+			}
+			match := re.FindSubmatch(result.Body)
+			if match == nil {
+				return extracted, fmt.Errorf("extracting %s: /%s/ does not match the response body", name, re)
+			}
+			extracted[name] = string(match[min(1, len(match)-1)])
+		case strings.HasPrefix(rule, scriptPrefix):
+			value, err := evalScript(strings.TrimPrefix(rule, scriptPrefix), responseScope(result))
+			if err != nil {
+				return extracted, fmt.Errorf("extracting %s: %w", name, err)
+			}
+			extracted[name] = scriptValueString(value)
+		default:
+			if !parsed {
+				// Numbers stay json.Number, so a 64-bit ID is extracted
+				// as sent.
+				doc, docErr = decodeJSON(result.Body)
+				parsed = true
+			}
+			if docErr != nil {
+				return extracted, fmt.Errorf("extracting %s: response body is not JSON: %w", name, docErr)
+			}
+			var value interface{}
+			var err error
+			if query, ok := strings.CutPrefix(rule, "query:"); ok {
+				value, err = querySingle(doc, strings.TrimSpace(query))
+			} else {
+				value, err = EvalJSONPath(doc, rule)
+			}
+			if err != nil {
+				return extracted, fmt.Errorf("extracting %s: %w", name, err)
+			}
+			extracted[name] = jsonValueString(value)
+		}
+	}
+	return extracted, nil
+}
@@ -0,0 +1,21 @@
+package apiman
+
+import "testing"
+
+func TestExtractVariablesKeepsLargeIDs(t *testing.T) {
+	result := &ExecutionResult{Body: []byte(`{"id": 9223372036854775807, "user": {"id": 1234567890123456789}, "score": 0.1}`)}
+	extracted, err := extractVariables(result, map[string]string{
+		"id":     "$.id",
+		"userId": "query:.user.id",
+		"score":  "$.score",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"id": "9223372036854775807", "userId": "1234567890123456789", "score": "0.1"}
+	for name, value := range want {
+		if extracted[name] != value {
+			t.Errorf("%s = %s, want %s", name, extracted[name], value)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+// vault.go
+package apiman
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// vaultProvider reads {{vault:<path>#<field>}} from HashiCorp Vault over its
+// HTTP API, configured like the vault CLI: VAULT_ADDR, VAULT_TOKEN (or the
+// token vault login saved in ~/.vault-token), VAULT_NAMESPACE, VAULT_CACERT
+// and VAULT_SKIP_VERIFY. The path is the API path, so KV version 2 secrets
+// include data/: {{vault:secret/data/api#token}}. Both KV versions are
+// understood; #field may be left out when the secret has a single field.
+type vaultProvider struct{}
+
+func (vaultProvider) FetchSecret(ctx context.Context, reference string) (string, error) {
+	secretPath, field := splitSecretKey(reference)
+	secretPath = strings.Trim(secretPath, "/")
+
+	addr := strings.TrimRight(os.Getenv("VAULT_ADDR"), "/")
+	if addr == "" {
+		return "", fmt.Errorf("vault: VAULT_ADDR is not set")
+	}
+	token, err := vaultToken()
+	if err != nil {
+		return "", err
+	}
+	client, err := vaultClient()
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, addr+"/v1/"+secretPath, nil)
+	if err != nil {
+		return "", fmt.Errorf("vault: %w", err)
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if namespace := os.Getenv("VAULT_NAMESPACE"); namespace != "" {
+		req.Header.Set("X-Vault-Namespace", namespace)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("vault: reading %s: %w", secretPath, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("vault: reading %s: %w", secretPath, err)
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusUnauthorized:
+		return "", fmt.Errorf("vault: permission denied reading %s: the token is invalid, expired or lacks a policy for this path (check VAULT_TOKEN or run vault login)", secretPath)
+	case resp.StatusCode == http.StatusNotFound:
+		return "", fmt.Errorf("vault: no secret at %s (KV version 2 paths include data/, e.g. secret/data/api)", secretPath)
+	case resp.StatusCode >= 300:
+		return "", fmt.Errorf("vault: reading %s: %s%s", secretPath, resp.Status, vaultErrors(body))
+	}
+
+	var secret struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &secret); err != nil {
+		return "", fmt.Errorf("vault: parsing %s: %w", secretPath, err)
+	}
+	fields := secret.Data
+	// KV version 2 nests the secret under data.data, beside data.metadata.
+	if inner, ok := fields["data"].(map[string]interface{}); ok {
+		if _, ok := fields["metadata"]; ok {
+			fields = inner
+		}
+	}
+	return structuredSecretField("vault", secretPath, fields, field)
+}
+
+// vaultToken returns VAULT_TOKEN, or the token saved by vault login.
+func vaultToken() (string, error) {
+	if token := os.Getenv("VAULT_TOKEN"); token != "" {
+		return token, nil
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		if data, err := os.ReadFile(filepath.Join(home, ".vault-token")); err == nil {
+			if token := strings.TrimSpace(string(data)); token != "" {
+				return token, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("vault: no token: set VAULT_TOKEN or run vault login")
+}
+
+func vaultClient() (*http.Client, error) {
+	caFile := os.Getenv("VAULT_CACERT")
+	skipVerify, _ := strconv.ParseBool(os.Getenv("VAULT_SKIP_VERIFY"))
+	if caFile == "" && !skipVerify {
+		return http.DefaultClient, nil
+	}
+	config := &tls.Config{InsecureSkipVerify: skipVerify}
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("vault: reading VAULT_CACERT: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("vault: no certificates in VAULT_CACERT %s", caFile)
+		}
+		config.RootCAs = pool
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = config
+	return &http.Client{Transport: transport}, nil
+}
+
+// vaultErrors formats the errors of a Vault error response.
+func vaultErrors(body []byte) string {
+	var response struct {
+		Errors []string `json:"errors"`
+	}
+	if json.Unmarshal(body, &response) != nil || len(response.Errors) == 0 {
+		return ""
+	}
+	return ": " + strings.Join(response.Errors, "; ")
+}
@@ -0,0 +1,135 @@
+// watch.go
+package apiman
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchDebounce collapses the burst of events editors produce when saving.
+const watchDebounce = 200 * time.Millisecond
+
+// WatchRequest executes a request, then executes it again whenever its
+// request file, active body file or environment file changes, printing how
+// the response differs from the previous run. It returns when ctx is
+// cancelled.
+func (cm *ConfigManager) WatchRequest(ctx context.Context, requestPath, envName string, opts RequestOptions, out io.Writer) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("creating file watcher: %w", err)
+	}
+	defer watcher.Close()
+
+	// Directories are watched rather than the files themselves, since many
+	// editors save by replacing the file.
+	files := cm.watchedFiles(requestPath, envName)
+	for _, dir := range watchedDirs(files) {
+		if err := watcher.Add(dir); err != nil {
+			return fmt.Errorf("watching %s: %w", dir, err)
+		}
+	}
+	fmt.Fprintf(out, "Watching %s (%s) for changes. Press Ctrl+C to stop.\n", requestPath, envName)
+
+	var previous *ExecutionResult
+	run := func() {
+		fmt.Fprintf(out, "\n[%s] ", time.Now().Format("15:04:05"))
+		result, err := cm.RunRequestContext(ctx, requestPath, envName, opts)
+		if err != nil {
+			fmt.Fprintf(out, "✗ %v\n", err)
+			return
+		}
+		fmt.Fprintf(out, "%s (%dms)\n", result.Status, result.DurationMS())
+		if previous == nil {
+			fmt.Fprintln(out, formatResponseBody(result.Body, result.Headers.Get("Content-Type")))
+		} else {
+			printResponseChanges(out, previous, result)
+		}
+		previous = result
+	}
+	run()
+
+	var debounce <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if files[filepath.Clean(event.Name)] && event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) != 0 {
+				debounce = time.After(watchDebounce)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			fmt.Fprintf(out, "⚠️  watch error: %v\n", err)
+		case <-debounce:
+			debounce = nil
+			run()
+			// A new activeBody may point at a different file.
+			files = cm.watchedFiles(requestPath, envName)
+			for _, dir := range watchedDirs(files) {
+				watcher.Add(dir)
+			}
+		}
+	}
+}
+
+// watchedFiles returns the files a request's execution depends on.
+func (cm *ConfigManager) watchedFiles(requestPath, envName string) map[string]bool {
+	files := map[string]bool{}
+	for _, ext := range configExtensions {
+		files[filepath.Join(cm.requestsDir, requestPath+ext)] = true
+		files[filepath.Join(cm.requestsDir, requestPath, "request"+ext)] = true
+	}
+	// The environment and every environment it extends.
+	for name := envName; name != "" && !files[filepath.Join(cm.environmentsDir, name+".json")]; {
+		for _, ext := range configExtensions {
+			files[filepath.Join(cm.environmentsDir, name+ext)] = true
+		}
+		env, err := cm.loadEnvironmentFile(name)
+		if err != nil {
+			break
+		}
+		name = env.Extends
+	}
+	if config, err := cm.LoadRequest(requestPath); err == nil && config.ActiveBody != "" {
+		files[filepath.Join(cm.requestsDir, requestPath, bodyFileName(config.ActiveBody))] = true
+	}
+	return files
+}
+
+// watchedDirs returns the existing directories containing files.
+func watchedDirs(files map[string]bool) []string {
+	seen := map[string]bool{}
+	var dirs []string
+	for file := range files {
+		dir := filepath.Dir(file)
+		if seen[dir] {
+			continue
+		}
+		seen[dir] = true
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+// printResponseChanges reports how current differs from previous.
+func printResponseChanges(out io.Writer, previous, current *ExecutionResult) {
+	if previous.Status != current.Status {
+		fmt.Fprintf(out, "- status: %s\n+ status: %s\n", previous.Status, current.Status)
+	}
+	if !writeLineDiff(out, formatResponseBody(previous.Body, previous.Headers.Get("Content-Type")), formatResponseBody(current.Body, current.Headers.Get("Content-Type"))) {
+		fmt.Fprintln(out, "(response body unchanged)")
+	}
+}
@@ -1,29 +1,52 @@
-package main
+package apiman
 
 import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"net/url"
+	"os"
+	"regexp"
 	"sort"
 	"strings"
 	"time"
 )
 
+// The web server only listens on the loopback interface and only answers
+// requests whose Host is a loopback name, so other machines and DNS
+// rebinding pages can't reach it. Requests other than GET must carry the
+// token from /api/session in csrfHeader, which pages on other origins can't
+// read or send.
+const csrfHeader = "X-CSRF-Token"
+
 type WebServer struct {
 	cm     *ConfigManager
 	port   string
 	static string
+	// csrfToken is generated at startup and checked by localOnly.
+	csrfToken string
 }
 
 type APIRequest struct {
 	Request     RequestData `json:"request"`
 	Environment string      `json:"environment"`
 	Collection  string      `json:"collection,omitempty"`
+	// Confirmed sends the request even if the environment wants it
+	// confirmed first.
+	Confirmed bool `json:"confirmed,omitempty"`
 }
 
 type RequestData struct {
+	// Path names the stored request being sent. Only secrets referenced
+	// by it or by the environment are resolved.
+	Path    string            `json:"path,omitempty"`
 	Method  string            `json:"method"`
 	URL     string            `json:"url"`
 	Headers map[string]string `json:"headers"`
@@ -35,10 +58,20 @@ type APIResponse struct {
 	Headers map[string]string `json:"headers"`
 	Body    string            `json:"body"`
 	Time    string            `json:"time"`
-	Curl    string            `json:"curl,omitempty"`
-	Request *ExecutedRequest  `json:"request,omitempty"`
-	Error   bool              `json:"error,omitempty"`
-	Message string            `json:"message,omitempty"`
+	// Encoding and EncodedSize describe a compressed body that was decoded
+	// for display.
+	Encoding    string           `json:"encoding,omitempty"`
+	EncodedSize int              `json:"encodedSize,omitempty"`
+	Curl        string           `json:"curl,omitempty"`
+	Request     *ExecutedRequest `json:"request,omitempty"`
+	Error       bool             `json:"error,omitempty"`
+	Message     string           `json:"message,omitempty"`
+	// Confirm is set when the request wasn't sent because it needs
+	// confirmation; resending it with "confirmed" sends it.
+	Confirm bool `json:"confirm,omitempty"`
+	// secrets are the secrets the request was sent with, redacted from
+	// the history.
+	secrets map[string]string
 }
 
 type ExecutedRequest struct {
@@ -57,15 +90,22 @@ func NewWebServer(port, staticDir string) (*WebServer, error) {
 		return nil, fmt.Errorf("creating config manager: %w", err)
 	}
 
+	token := make([]byte, 32)
+	if _, err := rand.Read(token); err != nil {
+		return nil, fmt.Errorf("generating CSRF token: %w", err)
+	}
+
 	return &WebServer{
-		cm:     cm,
-		port:   port,
-		static: staticDir,
+		cm:        cm,
+		port:      port,
+		static:    staticDir,
+		csrfToken: hex.EncodeToString(token),
 	}, nil
 }
 
 func (ws *WebServer) Start() error {
 	// API routes
+	http.HandleFunc("/api/session", ws.handleSession)
 	http.HandleFunc("/api/environments", ws.handleEnvironments)
 	http.HandleFunc("/api/collection-environments/", ws.handleCollectionEnvironments)
 	http.HandleFunc("/api/requests", ws.handleRequests)
@@ -85,24 +125,50 @@ func (ws *WebServer) Start() error {
 	fmt.Printf("🌐 Web server starting on http://localhost:%s\n", ws.port)
 	fmt.Printf("📁 Serving static files from: %s\n", ws.static)
 
-	return http.ListenAndServe(":"+ws.port, ws.corsMiddleware(http.DefaultServeMux))
+	return http.ListenAndServe(net.JoinHostPort("127.0.0.1", ws.port), ws.localOnly(http.DefaultServeMux))
 }
 
-func (ws *WebServer) corsMiddleware(next http.Handler) http.Handler {
+// localOnly rejects requests addressed to a host other than this machine
+// and state-changing API requests without the CSRF token.
+func (ws *WebServer) localOnly(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
+		if !isLoopbackHost(r.Host) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		if r.Method != http.MethodGet && r.Method != http.MethodHead && strings.HasPrefix(r.URL.Path, "/api/") &&
+			subtle.ConstantTimeCompare([]byte(r.Header.Get(csrfHeader)), []byte(ws.csrfToken)) != 1 {
+			http.Error(w, "Missing or invalid "+csrfHeader, http.StatusForbidden)
 			return
 		}
-
 		next.ServeHTTP(w, r)
 	})
 }
 
+// isLoopbackHost reports whether a Host header names this machine.
+func isLoopbackHost(host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.Trim(host, "[]")
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// handleSession gives the web UI the CSRF token to send with its requests.
+func (ws *WebServer) handleSession(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(map[string]string{"token": ws.csrfToken})
+}
+
 func (ws *WebServer) handleEnvironments(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
@@ -284,6 +350,28 @@ func (ws *WebServer) handleOpenAPIPreview(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	if IsPostmanCollection(data) {
+		preview, err := ws.cm.PreviewPostmanCollection(data, strings.TrimSpace(r.FormValue("collection")))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error loading Postman collection: %v", err), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(preview)
+		return
+	}
+
+	if IsInsomniaExport(data) {
+		preview, err := ws.cm.PreviewInsomniaExport(data, strings.TrimSpace(r.FormValue("collection")))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error loading Insomnia export: %v", err), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(preview)
+		return
+	}
+
 	spec, err := LoadOpenAPISpecFromData(data)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Error loading OpenAPI spec: %v", err), http.StatusBadRequest)
@@ -344,6 +432,28 @@ func (ws *WebServer) handleImportOpenAPI(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	if IsPostmanCollection(data) {
+		result, err := ws.cm.ImportPostmanCollection(data, nil, opts)
+		if err != nil {
+			ws.writeImportError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+		return
+	}
+
+	if IsInsomniaExport(data) {
+		result, err := ws.cm.ImportInsomniaExport(data, opts)
+		if err != nil {
+			ws.writeImportError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+		return
+	}
+
 	spec, err := LoadOpenAPISpecFromData(data)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Error loading OpenAPI spec: %v", err), http.StatusBadRequest)
@@ -359,7 +469,7 @@ func (ws *WebServer) handleImportOpenAPI(w http.ResponseWriter, r *http.Request)
 	specPath, specErr := ws.cm.SaveCollectionSpec(result.Collection, data, detectSpecExt(header.Filename, data))
 	if specErr != nil {
 		// Generated files succeeded; failure to persist the source spec is non-fatal.
-		fmt.Printf("warning: failed to save source spec for %s: %v\n", result.Collection, specErr)
+		fmt.Fprintf(os.Stderr, "Warning: failed to save source spec for %s: %v\n", result.Collection, specErr)
 	} else {
 		result.SpecPath = specPath
 	}
@@ -592,8 +702,24 @@ func (ws *WebServer) handleExecute(w http.ResponseWriter, r *http.Request) {
 
 	// Execute request
 	startTime := time.Now()
-	response, err := ws.executeHTTPRequest(apiReq.Request, env)
+	envKey := apiReq.Environment
+	if apiReq.Collection != "" {
+		envKey = apiReq.Collection + "/" + apiReq.Environment
+	}
+	response, err := ws.executeHTTPRequest(apiReq.Request, envKey, env, apiReq.Confirmed)
 	duration := time.Since(startTime)
+	var confirmErr *ConfirmationRequiredError
+	if errors.As(err, &confirmErr) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(APIResponse{
+			Error:   true,
+			Message: fmt.Sprintf("Send %s %s to %s?", confirmErr.Method, confirmErr.URL, confirmErr.Environment),
+			Confirm: true,
+		})
+		return
+	}
+	ws.recordHistory(apiReq, response, err, startTime, duration)
 
 	if err != nil {
 		apiResponse := APIResponse{
@@ -615,26 +741,110 @@ func (ws *WebServer) handleExecute(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
-func (ws *WebServer) executeHTTPRequest(reqData RequestData, env *Environment) (*APIResponse, error) {
+// recordHistory stores a request sent from the web UI alongside CLI runs.
+func (ws *WebServer) recordHistory(apiReq APIRequest, response *APIResponse, execErr error, startTime time.Time, duration time.Duration) {
+	entry := &HistoryEntry{
+		Environment:    apiReq.Environment,
+		Method:         apiReq.Request.Method,
+		URL:            apiReq.Request.URL,
+		RequestHeaders: make(http.Header),
+		RequestBody:    apiReq.Request.Body,
+		DurationMS:     duration.Milliseconds(),
+		Timestamp:      startTime,
+	}
+	for key, value := range apiReq.Request.Headers {
+		entry.RequestHeaders.Set(key, value)
+	}
+	if response != nil && response.Request != nil {
+		entry.URL = response.Request.URL
+	}
+	if execErr != nil {
+		entry.Error = execErr.Error()
+	} else {
+		entry.Status = response.Status
+		fmt.Sscanf(response.Status, "%d", &entry.StatusCode)
+		entry.Headers = make(http.Header)
+		for key, value := range response.Headers {
+			entry.Headers.Set(key, value)
+		}
+		entry.Body = response.Body
+	}
+	var secrets map[string]string
+	if response != nil {
+		secrets = response.secrets
+	}
+	err := ws.cm.redactHistory(entry, secrets)
+	if err == nil {
+		err = ws.cm.RecordHistory(entry)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to record history: %v\n", err)
+	}
+	ws.cm.recordMetric(&MetricRecord{
+		Timestamp:     startTime,
+		Environment:   entry.Environment,
+		Method:        entry.Method,
+		Source:        metricSourceWeb,
+		StatusCode:    entry.StatusCode,
+		Error:         entry.Error,
+		DurationMS:    durationMS(duration),
+		RequestBytes:  len(entry.RequestBody),
+		ResponseBytes: len(entry.Body),
+	})
+}
+
+func (ws *WebServer) executeHTTPRequest(reqData RequestData, envName string, env *Environment, confirmed bool) (*APIResponse, error) {
+	// Resolve {{variables}}, and the {{secret.NAME}} and provider
+	// references of the environment and the stored request only, never
+	// those written into the request sent: a page able to reach the server
+	// could otherwise read any secret back through the curl command.
+	stored := []interface{}{env}
+	if reqData.Path != "" {
+		if config, err := ws.cm.LoadRequest(reqData.Path); err == nil {
+			stored = append(stored, config)
+			if names, _, err := ws.cm.ListBodies(reqData.Path); err == nil {
+				for _, name := range names {
+					if content, err := ws.cm.LoadBodyContent(reqData.Path, name); err == nil {
+						stored = append(stored, content)
+					}
+				}
+			}
+		}
+	}
+	secrets, err := ws.cm.resolveSecrets(stored...)
+	if err != nil {
+		return nil, err
+	}
+	envVars, err := ws.cm.environmentVariables(envName, env)
+	if err != nil {
+		return nil, err
+	}
+	vars := mergeVariables(storedProcessEnv(stored...), envVars, secrets)
+	env = interpolateEnvironment(env, vars)
+
 	// Build full URL
-	baseURL := env.BaseURL
+	baseURL := requestBaseURL(env.BaseURL)
 	if baseURL != "" && baseURL[len(baseURL)-1] == '/' {
 		baseURL = baseURL[:len(baseURL)-1]
 	}
-	fullURL := baseURL + reqData.URL
+	fullURL := baseURL + interpolateUntrusted(reqData.URL, vars)
+	reqBody := interpolateUntrusted(reqData.Body, vars)
 
 	// Create HTTP request
 	var httpReq *http.Request
-	var err error
 
-	if reqData.Body != "" {
-		httpReq, err = http.NewRequest(reqData.Method, fullURL, strings.NewReader(reqData.Body))
+	if reqBody != "" {
+		httpReq, err = http.NewRequest(reqData.Method, fullURL, strings.NewReader(reqBody))
 	} else {
 		httpReq, err = http.NewRequest(reqData.Method, fullURL, nil)
 	}
 	if err != nil {
 		return nil, fmt.Errorf("creating request: %w", err)
 	}
+	// The web UI has no terminal to ask on, so the browser confirms.
+	if err := ws.cm.confirmSend(envName, env, httpReq.Method, httpReq.URL.String(), confirmed); err != nil {
+		return nil, err
+	}
 
 	// Apply environment headers
 	for key, value := range env.Headers {
@@ -646,7 +856,7 @@ func (ws *WebServer) executeHTTPRequest(reqData RequestData, env *Environment) (
 	// Apply request headers (override environment headers)
 	for key, value := range reqData.Headers {
 		if value != "" {
-			httpReq.Header.Set(key, value)
+			httpReq.Header.Set(key, interpolateUntrusted(value, vars))
 		}
 	}
 
@@ -661,17 +871,24 @@ func (ws *WebServer) executeHTTPRequest(reqData RequestData, env *Environment) (
 		}
 	}
 
-	applyEnvironmentAuth(httpReq, env)
+	if err := ws.cm.applyAuth(httpReq, envName, env); err != nil {
+		return nil, err
+	}
 
-	curlCommand := buildCurlCommand(httpReq)
+	curlCommand := redactSecretValues(buildCurlCommand(httpReq), secrets)
 	executedRequest := &ExecutedRequest{
 		Method: httpReq.Method,
-		URL:    httpReq.URL.String(),
+		URL:    redactSecretValues(httpReq.URL.String(), secrets),
 	}
 
 	// Create HTTP client
+	transport, err := ws.cm.httpTransport(env, "")
+	if err != nil {
+		return nil, err
+	}
 	client := &http.Client{
-		Timeout: 30 * time.Second,
+		Transport: transport,
+		Timeout:   30 * time.Second,
 	}
 
 	startTime := time.Now()
@@ -694,6 +911,14 @@ func (ws *WebServer) executeHTTPRequest(reqData RequestData, env *Environment) (
 		}, fmt.Errorf("reading response body: %w", err)
 	}
 
+	decoded := &ExecutionResult{Headers: resp.Header, Body: body}
+	if err := decodeResponse(decoded); err != nil {
+		return &APIResponse{
+			Curl:    curlCommand,
+			Request: executedRequest,
+		}, err
+	}
+
 	// Convert headers to map[string]string
 	headers := make(map[string]string)
 	for key, values := range resp.Header {
@@ -701,15 +926,64 @@ func (ws *WebServer) executeHTTPRequest(reqData RequestData, env *Environment) (
 	}
 
 	return &APIResponse{
-		Status:  resp.Status,
-		Headers: headers,
-		Body:    string(body),
-		Time:    fmt.Sprintf("%dms", duration.Milliseconds()),
-		Curl:    curlCommand,
-		Request: executedRequest,
+		Status:      resp.Status,
+		Headers:     headers,
+		Body:        string(decoded.Body),
+		Time:        fmt.Sprintf("%dms", duration.Milliseconds()),
+		Encoding:    decoded.ContentEncoding,
+		EncodedSize: decoded.EncodedSize,
+		Curl:        curlCommand,
+		Request:     executedRequest,
+		secrets:     secrets,
 	}, nil
 }
 
+// storedProcessEnv returns the {{env.NAME}} variables the stored values
+// reference, which the request sent may use as well.
+func storedProcessEnv(stored ...interface{}) map[string]string {
+	data, err := json.Marshal(stored)
+	if err != nil {
+		return nil
+	}
+	vars := make(map[string]string)
+	for _, match := range placeholderPattern.FindAllStringSubmatch(string(data), -1) {
+		if name, ok := strings.CutPrefix(match[1], "env."); ok {
+			if value, ok := os.LookupEnv(name); ok {
+				vars[match[1]] = value
+			}
+		}
+	}
+	return vars
+}
+
+// redactSecretValues puts the references back in place of the secret values
+// they resolved to, as sent or URL-encoded, so the values aren't echoed to
+// the browser. Basic credentials holding a secret are replaced whole.
+func redactSecretValues(s string, secrets map[string]string) string {
+	refs := sortedKeys(secrets)
+	// Longer values first, in case one contains another.
+	sort.SliceStable(refs, func(i, j int) bool { return len(secrets[refs[i]]) > len(secrets[refs[j]]) })
+	for _, ref := range refs {
+		value := secrets[ref]
+		if value == "" {
+			continue
+		}
+		for _, encoded := range []string{value, url.QueryEscape(value), url.PathEscape(value)} {
+			s = strings.ReplaceAll(s, encoded, "{{"+ref+"}}")
+		}
+		s = basicCredentialsPattern.ReplaceAllStringFunc(s, func(match string) string {
+			decoded, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(match, "Basic "))
+			if err == nil && strings.Contains(string(decoded), value) {
+				return "Basic [redacted]"
+			}
+			return match
+		})
+	}
+	return s
+}
+
+var basicCredentialsPattern = regexp.MustCompile(`Basic [A-Za-z0-9+/]+=*`)
+
 func buildCurlCommand(req *http.Request) string {
 	parts := []string{
 		fmt.Sprintf("curl -X %s %s", shellQuote(req.Method), shellQuote(req.URL.String())),
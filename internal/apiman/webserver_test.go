@@ -0,0 +1,134 @@
+package apiman
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWebServerLocalOnly(t *testing.T) {
+	ws := &WebServer{csrfToken: "token"}
+	handler := ws.localOnly(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	tests := []struct {
+		method, host, token string
+		status              int
+	}{
+		{"GET", "localhost:3000", "", http.StatusOK},
+		{"GET", "127.0.0.1:3000", "", http.StatusOK},
+		{"GET", "[::1]:3000", "", http.StatusOK},
+		{"GET", "attacker.example:3000", "", http.StatusForbidden},
+		{"GET", "192.168.1.20:3000", "", http.StatusForbidden},
+		{"POST", "localhost:3000", "", http.StatusForbidden},
+		{"POST", "localhost:3000", "wrong", http.StatusForbidden},
+		{"OPTIONS", "localhost:3000", "", http.StatusForbidden},
+		{"POST", "localhost:3000", "token", http.StatusOK},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, "http://"+tt.host+"/api/execute", nil)
+		if tt.token != "" {
+			req.Header.Set(csrfHeader, tt.token)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != tt.status {
+			t.Errorf("%s to %s with token %q: got %d, want %d", tt.method, tt.host, tt.token, rec.Code, tt.status)
+		}
+		if origin := rec.Header().Get("Access-Control-Allow-Origin"); origin != "" {
+			t.Errorf("Access-Control-Allow-Origin %q sent", origin)
+		}
+	}
+}
+
+func TestExecuteResolvesOnlyStoredSecrets(t *testing.T) {
+	t.Setenv(secretsBackendEnv, "file")
+	t.Setenv(secretsPassphraseEnv, "test passphrase")
+
+	var received http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Clone()
+	}))
+	defer server.Close()
+
+	cm, err := InitWorkspace(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := cm.Secrets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, value := range map[string]string{"api_token": "s3cr3t-api", "prod_token": "s3cr3t-prod"} {
+		if err := store.Set(name, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	env := &Environment{BaseURL: server.URL, Headers: map[string]string{"X-Api-Token": "{{secret.api_token}}"}}
+	ws := &WebServer{cm: cm}
+
+	response, err := ws.executeHTTPRequest(RequestData{
+		Method:  "GET",
+		URL:     "/?token={{secret.api_token}}",
+		Headers: map[string]string{"X-Stolen": "{{secret.prod_token}}"},
+	}, "dev", env, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := received.Get("X-Api-Token"); got != "s3cr3t-api" {
+		t.Errorf("environment secret not sent: %q", got)
+	}
+	if got := received.Get("X-Stolen"); got != "{{secret.prod_token}}" {
+		t.Errorf("secret referenced only by the caller was resolved: %q", got)
+	}
+	for _, echoed := range []string{response.Curl, response.Request.URL} {
+		if strings.Contains(echoed, "s3cr3t") {
+			t.Errorf("secret value echoed back: %s", echoed)
+		}
+	}
+	if !strings.Contains(response.Curl, "X-Api-Token: {{secret.api_token}}") {
+		t.Errorf("curl doesn't show the reference:\n%s", response.Curl)
+	}
+}
+
+func TestExecuteIgnoresProviderReferencesFromTheCaller(t *testing.T) {
+	vault := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("vault read %s for a caller's reference", r.URL.Path)
+	}))
+	defer vault.Close()
+	t.Setenv("VAULT_ADDR", vault.URL)
+	t.Setenv("VAULT_TOKEN", "token")
+	t.Setenv("API_MAN_TEST_KEY", "process-secret")
+
+	var received http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Clone()
+	}))
+	defer server.Close()
+
+	cm, err := InitWorkspace(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ws := &WebServer{cm: cm}
+	response, err := ws.executeHTTPRequest(RequestData{
+		Method: "GET",
+		URL:    "/",
+		Headers: map[string]string{
+			"X-Vault": "{{vault:secret/data/prod#token}}",
+			"X-Env":   "{{env.API_MAN_TEST_KEY}}",
+		},
+	}, "dev", &Environment{BaseURL: server.URL}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := received.Get("X-Vault"); got != "{{vault:secret/data/prod#token}}" {
+		t.Errorf("caller's provider reference resolved: %q", got)
+	}
+	if got := received.Get("X-Env"); got != "{{env.API_MAN_TEST_KEY}}" {
+		t.Errorf("caller's process environment reference resolved: %q", got)
+	}
+	if strings.Contains(response.Curl, "process-secret") {
+		t.Errorf("process environment echoed back:\n%s", response.Curl)
+	}
+}
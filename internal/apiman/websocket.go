@@ -0,0 +1,349 @@
+// websocket.go
+package apiman
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// WebSocketConfig turns a request into a WebSocket session. The request URL
+// (ws://, wss://, or http(s):// from the environment's baseURL) is opened
+// with the request's headers, cookies and auth, through the environment's
+// proxy and TLS settings. The body, when there is one, is sent as the first
+// text message; then messages are received until Receive have arrived, the
+// server closes the connection or the timeout elapses. The result's body is
+// a JSON array of the messages received: JSON messages as they are, other
+// text as strings and binary messages base64-encoded.
+type WebSocketConfig struct {
+	// Subprotocols are offered to the server in Sec-WebSocket-Protocol.
+	Subprotocols []string `json:"subprotocols,omitempty"`
+	// Receive is how many messages to wait for; 0 waits for the server to
+	// close the connection, the timeout or, when streamed by api-man run,
+	// Ctrl+C.
+	Receive int `json:"receive,omitempty"`
+}
+
+// WebSocket frame opcodes (RFC 6455, section 5.2).
+const (
+	wsContinuation = 0x0
+	wsText         = 0x1
+	wsBinary       = 0x2
+	wsClose        = 0x8
+	wsPing         = 0x9
+	wsPong         = 0xa
+)
+
+// maxWebSocketMessage caps the size of a message received, so a broken
+// frame length can't exhaust memory.
+const maxWebSocketMessage = 16 << 20
+
+// wsAcceptGUID is hashed with the client's key into Sec-WebSocket-Accept.
+const wsAcceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// errWebSocketRequest reports that a WebSocket request was used where only
+// plain HTTP requests work.
+func errWebSocketRequest(requestPath string) error {
+	return fmt.Errorf("%s is a WebSocket request; run it with api-man run", requestPath)
+}
+
+// webSocketURLScheme maps WebSocket URL schemes to the HTTP ones the
+// opening handshake is sent with.
+var webSocketURLScheme = map[string]string{"ws": "http", "wss": "https"}
+
+// runWebSocket opens the WebSocket session of prepared. With out, each
+// message is written there as it is sent or received and only ctx ends the
+// session early; without, the request's timeout bounds it too.
+func (cm *ConfigManager) runWebSocket(ctx context.Context, prepared *PreparedRequest, out io.Writer) (*ExecutionResult, error) {
+	ws := prepared.Config.WebSocket
+	body, err := readRequestBody(prepared.Request)
+	if err != nil {
+		return nil, err
+	}
+
+	sessionCtx, cancel := ctx, context.CancelFunc(func() {})
+	if out == nil {
+		sessionCtx, cancel = context.WithTimeout(ctx, prepared.timeout())
+	}
+	defer cancel()
+
+	req := prepared.Request.Clone(sessionCtx)
+	req.Body, req.GetBody, req.ContentLength = nil, nil, 0
+	req.Header.Del("Content-Length")
+	if scheme, ok := webSocketURLScheme[req.URL.Scheme]; ok {
+		req.URL.Scheme = scheme
+	}
+	keyBytes := make([]byte, 16)
+	rand.Read(keyBytes)
+	key := base64.StdEncoding.EncodeToString(keyBytes)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", key)
+	if len(ws.Subprotocols) > 0 {
+		req.Header.Set("Sec-WebSocket-Protocol", strings.Join(ws.Subprotocols, ", "))
+	}
+
+	// The session, not the client, is bounded by the timeout.
+	client := prepared.Client()
+	client.Timeout = 0
+	startedAt := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, cancelled(ctx, err, startedAt)
+	}
+	defer resp.Body.Close()
+
+	result := &ExecutionResult{
+		Request:     prepared.Path,
+		Environment: prepared.Environment,
+		Method:      req.Method,
+		URL:         prepared.Request.URL.String(),
+		Status:      resp.Status,
+		StatusCode:  resp.StatusCode,
+		Headers:     resp.Header,
+		StartedAt:   startedAt,
+	}
+	if out != nil {
+		fmt.Fprintf(out, "Status: %s\n", resp.Status)
+		fmt.Fprintf(out, "Headers:\n")
+		for _, name := range sortedKeys(resp.Header) {
+			for _, value := range resp.Header[name] {
+				fmt.Fprintf(out, "  %s: %s\n", name, value)
+			}
+		}
+		fmt.Fprintln(out)
+	}
+	// A server refusing the upgrade answers like any HTTP request.
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		if result.Body, err = io.ReadAll(resp.Body); err != nil {
+			return nil, cancelled(ctx, fmt.Errorf("reading response body: %w", err), startedAt)
+		}
+		result.Duration = time.Since(startedAt)
+		if out != nil && len(result.Body) > 0 {
+			fmt.Fprintln(out, prettyBody(result.Body, resp.Header.Get("Content-Type")))
+		}
+		return cm.finishExecution(prepared, result, req.Header)
+	}
+	if resp.Header.Get("Sec-WebSocket-Accept") != webSocketAccept(key) {
+		return nil, errors.New("server answered the WebSocket handshake with the wrong Sec-WebSocket-Accept")
+	}
+	conn, ok := resp.Body.(io.ReadWriteCloser)
+	if !ok {
+		return nil, errors.New("WebSocket connection isn't writable")
+	}
+	// Closing the connection unblocks the read when the session ends early.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-sessionCtx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	elapsed := func() string {
+		return fmt.Sprintf("[+%.3fs]", time.Since(startedAt).Seconds())
+	}
+
+	if body != "" {
+		if err := writeWebSocketFrame(conn, wsText, []byte(body)); err != nil {
+			return nil, cancelled(ctx, fmt.Errorf("sending message: %w", err), startedAt)
+		}
+		if out != nil {
+			fmt.Fprintf(out, "%s → sent\n%s\n", elapsed(), indentLines(prettyBody([]byte(body), ""), "  "))
+		}
+	}
+
+	var messages []json.RawMessage
+	reader := bufio.NewReader(conn)
+	ending := "connection closed"
+	for ws.Receive == 0 || len(messages) < ws.Receive {
+		opcode, payload, err := readWebSocketMessage(reader, conn)
+		if err != nil {
+			if sessionCtx.Err() == nil {
+				if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+					break
+				}
+				return nil, fmt.Errorf("reading message: %w", err)
+			}
+			if ctx.Err() != nil && out == nil {
+				return nil, cancelled(ctx, ctx.Err(), startedAt)
+			}
+			if ctx.Err() == nil {
+				if ws.Receive > 0 {
+					return nil, fmt.Errorf("received %d of %d message(s) before the %s timeout", len(messages), ws.Receive, prepared.timeout())
+				}
+				ending = "timeout reached"
+			}
+			break
+		}
+		if opcode == wsClose {
+			ending = "closed by the server" + webSocketCloseReason(payload)
+			writeWebSocketFrame(conn, wsClose, payload[:min(len(payload), 2)])
+			break
+		}
+		messages = append(messages, webSocketMessageJSON(opcode, payload))
+		if out != nil {
+			kind := "received"
+			if opcode == wsBinary {
+				kind = fmt.Sprintf("received %d bytes", len(payload))
+				payload = []byte(base64.StdEncoding.EncodeToString(payload))
+			}
+			fmt.Fprintf(out, "%s ← %s\n%s\n", elapsed(), kind, indentLines(prettyBody(payload, ""), "  "))
+		}
+		if ws.Receive > 0 && len(messages) == ws.Receive {
+			// 1000: normal closure
+			writeWebSocketFrame(conn, wsClose, []byte{0x03, 0xe8})
+			ending = fmt.Sprintf("received %d message(s)", len(messages))
+		}
+	}
+	result.Duration = time.Since(startedAt)
+	if out != nil {
+		fmt.Fprintf(out, "%s %s\n", elapsed(), ending)
+	}
+
+	if messages == nil {
+		messages = []json.RawMessage{}
+	}
+	if result.Body, err = json.MarshalIndent(messages, "", "  "); err != nil {
+		return nil, err
+	}
+	return cm.finishExecution(prepared, result, req.Header)
+}
+
+// webSocketAccept is the Sec-WebSocket-Accept a server answers key with.
+func webSocketAccept(key string) string {
+	sum := sha1.Sum([]byte(key + wsAcceptGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// webSocketMessageJSON returns a message as it appears in the result body:
+// JSON text as it is, other text as a string, binary data base64-encoded.
+func webSocketMessageJSON(opcode byte, payload []byte) json.RawMessage {
+	if opcode == wsText && json.Valid(payload) {
+		return payload
+	}
+	value := string(payload)
+	if opcode == wsBinary || !utf8.Valid(payload) {
+		value = base64.StdEncoding.EncodeToString(payload)
+	}
+	data, _ := json.Marshal(value)
+	return data
+}
+
+// webSocketCloseReason describes the status code and reason of a close
+// frame's payload.
+func webSocketCloseReason(payload []byte) string {
+	if len(payload) < 2 {
+		return ""
+	}
+	reason := fmt.Sprintf(" (%d", binary.BigEndian.Uint16(payload))
+	if len(payload) > 2 {
+		reason += ": " + string(payload[2:])
+	}
+	return reason + ")"
+}
+
+// writeWebSocketFrame writes payload as a single masked frame, as clients
+// must send them.
+func writeWebSocketFrame(w io.Writer, opcode byte, payload []byte) error {
+	frame := []byte{0x80 | opcode}
+	switch n := len(payload); {
+	case n < 126:
+		frame = append(frame, 0x80|byte(n))
+	case n <= 0xffff:
+		frame = append(frame, 0x80|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(n))
+	default:
+		frame = append(frame, 0x80|127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(n))
+	}
+	var mask [4]byte
+	rand.Read(mask[:])
+	frame = append(frame, mask[:]...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	_, err := w.Write(frame)
+	return err
+}
+
+// readWebSocketMessage reads frames until a whole message or a close frame
+// has arrived, answering pings on w along the way.
+func readWebSocketMessage(r *bufio.Reader, w io.Writer) (byte, []byte, error) {
+	var opcode byte
+	var message []byte
+	for {
+		var head [2]byte
+		if _, err := io.ReadFull(r, head[:]); err != nil {
+			return 0, nil, err
+		}
+		fin, op := head[0]&0x80 != 0, head[0]&0x0f
+		length := uint64(head[1] & 0x7f)
+		switch length {
+		case 126:
+			var ext [2]byte
+			if _, err := io.ReadFull(r, ext[:]); err != nil {
+				return 0, nil, err
+			}
+			length = uint64(binary.BigEndian.Uint16(ext[:]))
+		case 127:
+			var ext [8]byte
+			if _, err := io.ReadFull(r, ext[:]); err != nil {
+				return 0, nil, err
+			}
+			length = binary.BigEndian.Uint64(ext[:])
+		}
+		if length+uint64(len(message)) > maxWebSocketMessage {
+			return 0, nil, fmt.Errorf("message larger than %d bytes", maxWebSocketMessage)
+		}
+		var mask [4]byte
+		masked := head[1]&0x80 != 0
+		if masked {
+			if _, err := io.ReadFull(r, mask[:]); err != nil {
+				return 0, nil, err
+			}
+		}
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(r, payload); err != nil {
+			return 0, nil, err
+		}
+		if masked {
+			for i := range payload {
+				payload[i] ^= mask[i%4]
+			}
+		}
+
+		switch op {
+		case wsPing:
+			if err := writeWebSocketFrame(w, wsPong, payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case wsPong:
+			continue
+		case wsClose:
+			return wsClose, payload, nil
+		case wsContinuation:
+			message = append(message, payload...)
+		default:
+			opcode, message = op, payload
+		}
+		if fin {
+			return opcode, message, nil
+		}
+	}
+}
@@ -0,0 +1,197 @@
+// workspace.go
+package apiman
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// workspaceMarker marks the root of a workspace, the way go.mod marks a
+// module: commands run anywhere below it use that workspace.
+const workspaceMarker = "api-man.json"
+
+// workspaceEnvVar selects the workspace when --workspace isn't given.
+const workspaceEnvVar = "APIMAN_WORKSPACE"
+
+// workspaceFlag holds the global --workspace flag.
+var workspaceFlag string
+
+// WorkspaceConfig is the content of api-man.json.
+type WorkspaceConfig struct {
+	SchemaVersion int `json:"schemaVersion"`
+	// SecretKeys are extra header, cookie and variable names whose values
+	// api-man sync moves to the secret store, on top of secretKeyMarkers.
+	SecretKeys []string `json:"secretKeys,omitempty"`
+	// Confirm makes requests that change data need confirmation before
+	// they are sent, in every environment or those it lists; see
+	// ConfirmConfig.
+	Confirm *ConfirmConfig `json:"confirm,omitempty"`
+}
+
+// FindWorkspace returns the workspace directory commands operate on, in
+// order of preference:
+//
+//  1. the --workspace flag
+//  2. the workspace of the --project flag's project
+//  3. the APIMAN_WORKSPACE environment variable
+//  4. the nearest directory at or above the working directory containing
+//     api-man.json, or (for workspaces created before the marker existed)
+//     both requests/ and environments/
+//  5. the workspace of the current project (api-man project use)
+//  6. the global workspace, ~/.api-man
+func FindWorkspace() (string, error) {
+	if dir := explicitWorkspace(); dir != "" {
+		return filepath.Abs(dir)
+	}
+	if dir, ok := findLocalWorkspace(); ok {
+		return dir, nil
+	}
+	dir, err := projectWorkspace(true)
+	if err != nil {
+		return "", err
+	}
+	if dir != "" {
+		return dir, nil
+	}
+	return globalWorkspace()
+}
+
+// explicitWorkspace returns the directory named by --workspace, --project
+// or APIMAN_WORKSPACE, if any. An unknown --project is reported by
+// applyGlobalFlags.
+func explicitWorkspace() string {
+	if workspaceFlag != "" {
+		return workspaceFlag
+	}
+	if dir, err := projectWorkspace(false); err == nil && dir != "" {
+		return dir
+	}
+	return os.Getenv(workspaceEnvVar)
+}
+
+// OpenWorkspace opens the workspace rooted at root without creating
+// anything in it, for programs embedding api-man. root must hold
+// api-man.json or both requests/ and environments/.
+func OpenWorkspace(root string) (*ConfigManager, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, fmt.Errorf("opening workspace: %w", err)
+	}
+	if !isWorkspaceRoot(root) {
+		return nil, fmt.Errorf("%s is not an api-man workspace (run api-man init there)", root)
+	}
+	return &ConfigManager{
+		configDir:       root,
+		requestsDir:     filepath.Join(root, "requests"),
+		environmentsDir: filepath.Join(root, "environments"),
+	}, nil
+}
+
+// InitWorkspace creates a workspace rooted at root, with the default
+// environments, a sample request and the api-man.json marker, and opens it.
+// Files that already exist are left alone.
+func InitWorkspace(root string) (*ConfigManager, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, fmt.Errorf("initializing workspace: %w", err)
+	}
+	cm, err := newConfigManagerAt(root)
+	if err != nil {
+		return nil, fmt.Errorf("initializing workspace: %w", err)
+	}
+	if err := writeWorkspaceMarker(root); err != nil {
+		return nil, fmt.Errorf("initializing workspace: %w", err)
+	}
+	return cm, nil
+}
+
+// Dir returns the root directory of the workspace.
+func (cm *ConfigManager) Dir() string {
+	return cm.configDir
+}
+
+// inWorkspace reports whether a workspace was selected explicitly, found
+// above the working directory or is the current project's, rather than
+// falling back to the global one.
+func inWorkspace() bool {
+	if explicitWorkspace() != "" {
+		return true
+	}
+	if _, ok := findLocalWorkspace(); ok {
+		return true
+	}
+	dir, err := projectWorkspace(true)
+	return err == nil && dir != ""
+}
+
+// findLocalWorkspace walks up from the working directory looking for a
+// workspace root.
+func findLocalWorkspace() (string, bool) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return "", false
+	}
+	for {
+		if isWorkspaceRoot(dir) {
+			return dir, true
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
+
+func isWorkspaceRoot(dir string) bool {
+	if _, err := os.Stat(filepath.Join(dir, workspaceMarker)); err == nil {
+		return true
+	}
+	return dirExists(filepath.Join(dir, "requests")) && dirExists(filepath.Join(dir, "environments"))
+}
+
+func globalWorkspace() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("finding home directory for the global workspace: %w", err)
+	}
+	return filepath.Join(home, ".api-man"), nil
+}
+
+// workspaceConfig reads api-man.json. A workspace without one gets the
+// defaults.
+func (cm *ConfigManager) workspaceConfig() (*WorkspaceConfig, error) {
+	data, err := os.ReadFile(filepath.Join(cm.configDir, workspaceMarker))
+	if errors.Is(err, os.ErrNotExist) {
+		return &WorkspaceConfig{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading workspace config: %w", err)
+	}
+	var config WorkspaceConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", workspaceMarker, err)
+	}
+	return &config, nil
+}
+
+// writeWorkspaceMarker creates dir/api-man.json unless it already exists.
+func writeWorkspaceMarker(dir string) error {
+	path := filepath.Join(dir, workspaceMarker)
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("checking workspace marker: %w", err)
+	}
+	data, err := json.MarshalIndent(WorkspaceConfig{SchemaVersion: CurrentSchemaVersion}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding workspace marker: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("writing workspace marker: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+// openapi.go
+
+// Package openapi loads OpenAPI 3 and Swagger 2.0 specs, generates workspace
+// requests from them like api-man generate, and checks responses against the
+// schemas those requests were generated with.
+package openapi
+
+import (
+	"net/http"
+
+	"api-man/internal/apiman"
+	"api-man/pkg/runner"
+	"api-man/pkg/workspace"
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// Spec is a loaded spec. Swagger 2.0 specs are converted to OpenAPI 3.
+type Spec = openapi3.T
+
+// GenerateResult says what Generate and Import wrote.
+type GenerateResult = apiman.OpenAPIImportResult
+
+// ImportOptions choose the collection name and whether to overwrite it.
+type ImportOptions = apiman.ImportOptions
+
+// Schema is the request and response schemas a request was generated with,
+// kept in its "schema" field.
+type Schema = apiman.RequestSchema
+
+// ErrNoSchema is returned by ValidateResponse for requests that weren't
+// generated from a spec.
+var ErrNoSchema = apiman.ErrNoSchema
+
+// Load loads a YAML or JSON spec from a file or an http(s) URL, following
+// $refs relative to it. header is sent when fetching from the spec's host.
+func Load(location string, header http.Header) (*Spec, error) {
+	return apiman.LoadOpenAPISpec(location, header)
+}
+
+// Parse loads a spec from data. External $refs aren't followed.
+func Parse(data []byte) (*Spec, error) {
+	return apiman.LoadOpenAPISpecFromData(data)
+}
+
+// Generate writes a request for every operation in spec to the workspace,
+// under a collection named after the spec, replacing an earlier generation.
+func Generate(ws *workspace.Workspace, spec *Spec) (*GenerateResult, error) {
+	return ws.GenerateRequestsFromOpenAPI(spec)
+}
+
+// Import writes a request for every operation in spec to the workspace with
+// the given options.
+func Import(ws *workspace.Workspace, spec *Spec, opts ImportOptions) (*GenerateResult, error) {
+	return ws.ImportRequestsFromOpenAPI(spec, opts)
+}
+
+// ExportOptions choose which requests Export describes and the document's
+// title and version.
+type ExportOptions = apiman.OpenAPIExportOptions
+
+// ExportResult holds the document Export built and the requests it skipped
+// or could only partly describe.
+type ExportResult = apiman.OpenAPIExportResult
+
+// Export describes the workspace's requests as an OpenAPI 3 document, like
+// api-man openapi export. Encode it with Encode.
+func Export(ws *workspace.Workspace, opts ExportOptions) (*ExportResult, error) {
+	return ws.ExportOpenAPI(opts)
+}
+
+// Encode encodes spec as YAML, or as JSON when asJSON is set.
+func Encode(spec *Spec, asJSON bool) ([]byte, error) {
+	return apiman.EncodeOpenAPI(spec, asJSON)
+}
+
+// ValidateResponse checks result against the response schemas in schema,
+// returning one message per problem.
+func ValidateResponse(schema *Schema, result *runner.Result) ([]string, error) {
+	return apiman.ValidateResponse(schema, result)
+}
@@ -0,0 +1,100 @@
+// runner.go
+
+// Package runner executes the requests, tests, chains and suites of an
+// api-man workspace, the way api-man run, test, chain run and suite run do.
+// Executions are recorded in the workspace history and extract rules store
+// their values, as on the command line:
+//
+//	ws, err := workspace.Open("testdata/api")
+//	if err != nil {
+//		return err
+//	}
+//	result, err := runner.Run(ws, "users/get-user", "dev", runner.Options{
+//		PathParams: map[string]string{"id": "42"},
+//	})
+package runner
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"api-man/internal/apiman"
+	"api-man/pkg/workspace"
+)
+
+// Options change a single execution: extra parameters, headers, variables,
+// a replacement body, a timeout or a proxy.
+type Options = apiman.RequestOptions
+
+// Result is the outcome of an execution: the response and what was sent.
+type Result = apiman.ExecutionResult
+
+// PreparedRequest is a request resolved against an environment but not
+// sent.
+type PreparedRequest = apiman.PreparedRequest
+
+// CancelledError is returned when the context of RunContext is cancelled
+// before the response has been read.
+type CancelledError = apiman.CancelledError
+
+// TestReport summarises a test or suite run; OK reports whether every
+// assertion passed.
+type TestReport = apiman.TestReport
+
+// TestResult is the outcome of one request in a TestReport.
+type TestResult = apiman.TestResult
+
+// ChainResult is the outcome of a chain run.
+type ChainResult = apiman.ChainResult
+
+// Run executes the request at requestPath against the environment envName.
+func Run(ws *workspace.Workspace, requestPath, envName string, opts Options) (*Result, error) {
+	return ws.RunRequest(requestPath, envName, opts)
+}
+
+// RunContext is Run with a context: cancelling ctx aborts the request
+// immediately instead of waiting for its timeout.
+func RunContext(ctx context.Context, ws *workspace.Workspace, requestPath, envName string, opts Options) (*Result, error) {
+	return ws.RunRequestContext(ctx, requestPath, envName, opts)
+}
+
+// Stream executes a request, copying the response body to out as it
+// arrives, until the response ends or ctx is done.
+func Stream(ctx context.Context, ws *workspace.Workspace, requestPath, envName string, opts Options, out io.Writer) (*Result, error) {
+	return ws.StreamRequest(ctx, requestPath, envName, opts, out)
+}
+
+// Prepare resolves a request against an environment without sending it.
+func Prepare(ws *workspace.Workspace, requestPath, envName string, opts Options) (*PreparedRequest, error) {
+	return ws.PrepareRequest(requestPath, envName, opts)
+}
+
+// Test runs the request at target, or every request under it when it is a
+// directory, and checks their assertions. Progress is written to out, which
+// may be io.Discard.
+func Test(ws *workspace.Workspace, target, envName string, out io.Writer) (*TestReport, error) {
+	paths, err := ws.ResolveRequestTargets(target)
+	if err != nil {
+		return nil, fmt.Errorf("resolving requests: %w", err)
+	}
+	return ws.RunTests(paths, envName, out), nil
+}
+
+// RunSuite runs the suite stored as suites/<name>.json.
+func RunSuite(ws *workspace.Workspace, name, envName string, out io.Writer) (*TestReport, error) {
+	suite, err := ws.LoadSuite(name)
+	if err != nil {
+		return nil, fmt.Errorf("loading suite: %w", err)
+	}
+	return ws.RunSuite(suite, envName, out)
+}
+
+// RunChain runs the chain stored as chains/<name>.json.
+func RunChain(ws *workspace.Workspace, name, envName string, out io.Writer) (*ChainResult, error) {
+	chain, err := ws.LoadChain(name)
+	if err != nil {
+		return nil, fmt.Errorf("loading chain: %w", err)
+	}
+	return ws.RunChain(chain, envName, out), nil
+}
@@ -0,0 +1,68 @@
+// workspace.go
+
+// Package workspace opens api-man workspaces, the directories of requests,
+// environments, body templates, chains and suites the api-man command works
+// on, so Go programs and tests can read and change them:
+//
+//	ws, err := workspace.Open("testdata/api")
+//	if err != nil {
+//		return err
+//	}
+//	req, err := ws.LoadRequest("users/get-user")
+//
+// Use package runner to execute the requests of a workspace.
+package workspace
+
+import "api-man/internal/apiman"
+
+// Workspace is an open workspace. Its methods load and save requests,
+// environments, body templates, chains, suites, history and stored
+// variables.
+type Workspace = apiman.ConfigManager
+
+// Request is a stored request, as in requests/<path>.json.
+type Request = apiman.RequestConfig
+
+// Environment is a stored environment, as in environments/<name>.json.
+type Environment = apiman.Environment
+
+// Chain is a sequence of requests passing values between them, as in
+// chains/<name>.json.
+type Chain = apiman.Chain
+
+// Suite is a group of requests tested together, as in suites/<name>.json.
+type Suite = apiman.Suite
+
+// HistoryEntry is a recorded execution.
+type HistoryEntry = apiman.HistoryEntry
+
+// Open opens the existing workspace in dir without creating anything in it.
+// dir must contain api-man.json, or both requests/ and environments/.
+func Open(dir string) (*Workspace, error) {
+	return apiman.OpenWorkspace(dir)
+}
+
+// Init creates a workspace in dir like api-man init, with the default
+// environments, a sample request and api-man.json, and opens it. Existing
+// files are left alone.
+func Init(dir string) (*Workspace, error) {
+	return apiman.InitWorkspace(dir)
+}
+
+// Find opens the workspace the api-man command would use from the working
+// directory: the one named by APIMAN_WORKSPACE, else the nearest directory
+// containing api-man.json, else ~/.api-man, which is created if needed.
+func Find() (*Workspace, error) {
+	return apiman.NewConfigManager()
+}
+
+// SecretProvider fetches secrets referenced as {{provider:reference}} from
+// an external backend.
+type SecretProvider = apiman.SecretProvider
+
+// RegisterSecretProvider makes {{name:reference}} placeholders resolve
+// through p when requests are prepared, alongside the built-in vault and
+// aws-sm providers.
+func RegisterSecretProvider(name string, p SecretProvider) {
+	apiman.RegisterSecretProvider(name, p)
+}